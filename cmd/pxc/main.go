@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/brynnjknight/proxer/internal/cmd"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
 )
 
 // Version information (set during build)
@@ -20,7 +22,15 @@ func main() {
 
 	// Execute the root command
 	if err := cmd.Execute(); err != nil {
+		// Commands run in containers exit pxc with their own status
+		var exitErr *cmd.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if hint := proxmox.Hint(err); hint != "" {
+			fmt.Fprintf(os.Stderr, "Hint: %s\n", hint)
+		}
 		os.Exit(1)
 	}
 }
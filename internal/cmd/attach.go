@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/terminal"
+)
+
+var (
+	attachIndex      int
+	attachDetachKeys string
+)
+
+// attachCmd represents the attach command
+var attachCmd = &cobra.Command{
+	Use:   "attach [OPTIONS] SERVICE",
+	Short: "Attach to a service container's console",
+	Long: `Attach your terminal to the console of a service's container (pct console).
+
+Use attach to debug boot and init problems: you see the container's console
+as its init system writes it, including output from before any shell exists.
+
+ATTACH VS EXEC:
+  • attach connects to the existing console (tty) of the container; nothing
+    new is started inside the container
+  • exec starts a new process inside the running container (pct exec); use it
+    to run commands or open a shell once the container has booted
+
+DETACHING:
+  Type the detach key sequence (default: ctrl-p,ctrl-q) to leave the console.
+  The container keeps running. Change the sequence with --detach-keys or the
+  detach_keys setting in .pxc.yaml.
+
+The container is looked up from what 'pxc up' recorded for the project, so the
+service must have been deployed from the same stack file and project name.`,
+	Example: `  # Attach to the web service's console
+  pxc attach web
+
+  # Attach to the second replica of a scaled service
+  pxc attach worker --index 2
+
+  # Use a different detach sequence
+  pxc attach web --detach-keys ctrl-x,q`,
+	Args: cobra.ExactArgs(1),
+	RunE: runAttach,
+}
+
+func init() {
+	rootCmd.AddCommand(attachCmd)
+
+	attachCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	attachCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	attachCmd.Flags().IntVar(&attachIndex, "index", 1, "Replica to attach to for scaled services")
+	attachCmd.Flags().StringVar(&attachDetachKeys, "detach-keys", "", "Key sequence for detaching (default: ctrl-p,ctrl-q)")
+}
+
+func runAttach(cmd *cobra.Command, args []string) error {
+	containerID, err := resolveServiceTarget(args[0], attachIndex)
+	if err != nil {
+		return err
+	}
+
+	spec, keys, err := detachKeys(attachDetachKeys)
+	if err != nil {
+		return err
+	}
+
+	if IsDryRun() {
+		PrintInfo("DRY RUN: Would attach to console of container %d", containerID)
+		return nil
+	}
+
+	PrintInfo("Attaching to container %d (detach with %s)", containerID, spec)
+
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		restore, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+
+	console := exec.Command("pct", "console", strconv.Itoa(containerID))
+	console.Stdout = os.Stdout
+	console.Stderr = os.Stderr
+
+	start := time.Now()
+	detached, err := terminal.Run(console, os.Stdin, keys)
+	proxmox.AuditCommand(console, start, err)
+	if err != nil {
+		return fmt.Errorf("console session failed: %w", err)
+	}
+	if detached {
+		// The terminal is still raw here, so end the line explicitly
+		fmt.Print("\r\n")
+		PrintInfo("Detached from container %d", containerID)
+	}
+
+	return nil
+}
+
+// detachKeys returns the detach key sequence given with --detach-keys, or
+// else by the detach_keys setting, and the bytes a terminal sends for it
+func detachKeys(flag string) (string, []byte, error) {
+	spec := flag
+	if spec == "" {
+		spec = viper.GetString("detach_keys")
+	}
+	keys, err := terminal.ParseDetachKeys(spec)
+	return spec, keys, err
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestAttachArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "service name", args: []string{"web"}},
+		{name: "missing service", args: []string{}, wantErr: true},
+		{name: "too many services", args: []string{"web", "api"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := attachCmd.Args(attachCmd, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Args(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveServiceContainer(t *testing.T) {
+	stack := &models.LXCStack{
+		Version: "1.0",
+		Services: map[string]models.Service{
+			"web":    {Template: "nginx:latest"},
+			"worker": {Template: "python:3.11", Scale: 3},
+			"cache":  {Template: "redis:7"},
+		},
+	}
+	projectState := &state.ProjectState{
+		Project: "shop",
+		Services: map[string]state.ServiceState{
+			"web":      {ContainerID: 301},
+			"worker":   {ContainerID: 310},
+			"worker-2": {ContainerID: 311},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		service  string
+		index    int
+		expected int
+		errorMsg string
+	}{
+		{name: "single service", service: "web", index: 1, expected: 301},
+		{name: "first replica", service: "worker", index: 1, expected: 310},
+		{name: "second replica", service: "worker", index: 2, expected: 311},
+		{
+			name:     "replica not deployed",
+			service:  "worker",
+			index:    3,
+			errorMsg: "replica 3 of service 'worker' has no container (run 'pxc up' first)",
+		},
+		{
+			name:     "index beyond scale",
+			service:  "web",
+			index:    2,
+			errorMsg: "service 'web' has 1 replica(s), index 2 is out of range",
+		},
+		{
+			name:     "service not deployed",
+			service:  "cache",
+			index:    1,
+			errorMsg: "service 'cache' has no container (run 'pxc up' first)",
+		},
+		{
+			name:     "undefined service",
+			service:  "db",
+			index:    1,
+			errorMsg: "service 'db' is not defined in the stack",
+		},
+		{
+			name:     "invalid index",
+			service:  "web",
+			index:    0,
+			errorMsg: "index must be at least 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containerID, err := resolveServiceContainer(stack, projectState, tt.service, tt.index)
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Errorf("resolveServiceContainer() error = %v, want %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveServiceContainer() unexpected error: %v", err)
+			}
+			if containerID != tt.expected {
+				t.Errorf("resolveServiceContainer() = %d, want %d", containerID, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveServiceTarget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lxc-stack.yml")
+	if err := os.WriteFile(path, []byte(`version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 2
+`), 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+
+	projectState := &state.ProjectState{
+		Project: "shop",
+		Services: map[string]state.ServiceState{
+			"web-1": {ContainerID: 342},
+			"web-2": {ContainerID: 343},
+		},
+	}
+	if err := projectState.Save(state.Path(dir, "shop")); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	originalFile, originalProject := stackFile, projectName
+	defer func() {
+		stackFile, projectName = originalFile, originalProject
+	}()
+	stackFile, projectName = path, "shop"
+
+	for index, expected := range map[int]int{1: 342, 2: 343} {
+		containerID, err := resolveServiceTarget("web", index)
+		if err != nil {
+			t.Fatalf("resolveServiceTarget(web, %d) unexpected error: %v", index, err)
+		}
+		if containerID != expected {
+			t.Errorf("resolveServiceTarget(web, %d) = %d, want %d", index, containerID, expected)
+		}
+	}
+}
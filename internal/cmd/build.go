@@ -1,8 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -10,12 +17,26 @@ import (
 	"github.com/brynnjknight/proxer/internal/models"
 	"github.com/brynnjknight/proxer/pkg/builder"
 	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
 )
 
 var (
 	buildFile    string
 	tag          string
 	buildArgsBld map[string]string
+	buildOutput  string
+	abortCleanup bool
+	compress     string
+	keepFailed   bool
+	buildFrom    string
+	buildLabels  []string
+	labelFile    string
+	squash       bool
+	reclaimCmds  []string
+	readyProbe   string
+	progress     string
+	noCache      bool
+	buildTarget  string
 )
 
 // buildCmd represents the build command
@@ -46,6 +67,52 @@ CONFIGURATION:
     template_storage: "local"     # Where to save resulting template
     temp_container_prefix: "pxc-build-"  # Temporary container naming
 
+COMPRESSION:
+  --compress also exports the template as a vzdump archive to the template
+  storage, compressed with the chosen algorithm:
+    none   No compression: fastest export, largest archive
+    lzo    Very fast, moderate size reduction
+    gzip   Slower, smaller archives; widely compatible
+    zstd   Fast with small archives; the best default on modern hosts
+  Prefer none or lzo on fast networks or when CPU is scarce, and zstd or gzip
+  when storage is slow or archives are copied between nodes.
+
+PROGRESS:
+  --progress controls how setup and cleanup steps are shown:
+    plain  Numbered lines (#1, #2, ...) for each step's start, output and
+           result with its duration; nothing is redrawn, so logs stay
+           readable in CI
+    tty    One line per step, updated in place with the elapsed time; step
+           output is only shown when the step fails
+    auto   tty on a terminal, plain otherwise (default)
+
+OUTPUT:
+  --output type=tar,dest=PATH archives the finished container's root
+  filesystem to PATH (via pct mount and tar) instead of converting it to a
+  template; the build container is removed afterwards. The archive is
+  compressed according to the suffix of PATH (.gz, .xz, .zst or none for
+  .tar) and keeps numeric file owners. type=template is the default.
+
+SQUASH:
+  --squash minimizes the template after the cleanup steps: package manager
+  caches, /tmp, /var/tmp and log contents are removed and the root filesystem
+  is trimmed with pct fstrim so thin storage gets the freed blocks back.
+  --reclaim-command replaces the default commands. Squashing does not rewrite
+  the root filesystem: space is only returned on storage that supports
+  discard (lvmthin, zfs, ceph), and a template cloned from a base template
+  still shares that template's blocks.
+
+CACHE:
+  Setup steps are cached like image layers: after each step the container
+  is snapshotted under a hash of the base template, build arguments and all
+  steps up to it, including the contents of copied files. A later build
+  resumes from the deepest matching snapshot and only runs the steps after
+  it. Snapshots are kept in a stopped container per template name, named
+  pxc-cache-<name>, and any of them can serve any template. Caching needs
+  build storage that supports snapshots (lvmthin, zfspool, rbd, btrfs) and
+  is skipped otherwise. --no-cache runs every step and replaces the cache;
+  remove a pxc-cache-* container with pct destroy to free its space.
+
 TROUBLESHOOTING:
   Common Issues:
   • "Base template not found" 
@@ -57,6 +124,14 @@ TROUBLESHOOTING:
     → Verify file paths exist on host
     → Check package availability in base image
   
+  • "template storage ... does not support container templates"
+    → template_storage must have the vztmpl content type
+    → List suitable storages: pvesm status --content vztmpl
+
+  • "is running but pct exec failed"
+    → The container started but pct exec could not reach it in time
+    → Use --ready-probe status to only wait for the running state
+
   • "Resource allocation failed"
     → Check available resources: pct list
     → Verify storage has sufficient space
@@ -84,9 +159,18 @@ SECURITY:
   # Build with build arguments
   pxc build --build-arg NODE_ENV=production --build-arg VERSION=1.2.3
 
+  # Run every setup step, ignoring the build cache
+  pxc build --no-cache
+
   # Dry run to see what would happen
   pxc build --dry-run --verbose
 
+  # Show template reference, storage, size and executed steps
+  pxc build -t webapp:1.0 --output wide
+
+  # Write the root filesystem to a tarball instead of registering a template
+  pxc build --output type=tar,dest=./webapp-rootfs.tar.zst
+
   # Build with custom storage
   pxc build -t myapp:1.0 --config custom.yaml
 
@@ -102,6 +186,19 @@ func init() {
 	buildCmd.Flags().StringVarP(&buildFile, "file", "f", "LXCfile.yml", "Path to LXCfile")
 	buildCmd.Flags().StringVarP(&tag, "tag", "t", "", "Template name and optionally tag (name:tag)")
 	buildCmd.Flags().StringToStringVar(&buildArgsBld, "build-arg", map[string]string{}, "Set build-time variables")
+	buildCmd.Flags().BoolVar(&abortCleanup, "abort-on-cleanup-error", false, "Fail the build when a cleanup step fails (steps with ignore_errors excepted)")
+	buildCmd.Flags().BoolVar(&keepFailed, "keep-on-failure", false, "Keep the temporary container when the build fails, for inspection")
+	buildCmd.Flags().StringVar(&compress, "compress", "", "Compression for the exported template archive (none, gzip, zstd, lzo)")
+	buildCmd.Flags().StringVar(&buildFrom, "build-from", "", "Base template to build from instead of the LXCfile's from")
+	buildCmd.Flags().StringArrayVar(&buildLabels, "label", []string{}, "Set a label on the template (KEY=VALUE, can specify multiple)")
+	buildCmd.Flags().StringVar(&labelFile, "label-file", "", "Read template labels from a file of KEY=VALUE lines")
+	buildCmd.Flags().BoolVar(&squash, "squash", false, "Reclaim caches, temporary files and free blocks before creating the template")
+	buildCmd.Flags().StringArrayVar(&reclaimCmds, "reclaim-command", []string{}, "Command to run in the container when squashing, instead of the defaults (can specify multiple)")
+	buildCmd.Flags().StringVar(&readyProbe, "ready-probe", "exec", "How to tell the build container is ready (exec, status, both)")
+	buildCmd.Flags().StringVar(&progress, "progress", "auto", "How to show build steps (auto, plain, tty)")
+	buildCmd.Flags().BoolVar(&noCache, "no-cache", false, "Run every setup step instead of resuming from cached snapshots")
+	buildCmd.Flags().StringVar(&buildTarget, "target", "", "Build stage to make the template instead of the final stage")
+	buildCmd.Flags().StringVarP(&buildOutput, "output", "o", "", "Output format for the build result (wide), or what to produce (type=template|tar,dest=PATH)")
 
 	// Add examples for help
 	buildCmd.SetUsageTemplate(buildCmd.UsageTemplate() + `
@@ -113,6 +210,32 @@ Examples:
 }
 
 func runBuild(cmd *cobra.Command, args []string) error {
+	if err := requirePCTTransport("build"); err != nil {
+		return err
+	}
+	wide, outputType, outputDest, err := parseBuildOutput(buildOutput)
+	if err != nil {
+		return err
+	}
+	if outputType == "tar" && compress != "" {
+		return fmt.Errorf("--compress only applies to template output; a tar archive is compressed according to the dest suffix")
+	}
+	if err := builder.ValidateCompression(compress); err != nil {
+		return err
+	}
+	if err := builder.ValidateReadyProbe(readyProbe); err != nil {
+		return err
+	}
+	if err := builder.ValidateProgress(progress); err != nil {
+		return err
+	}
+	if progress == "auto" && IsNonInteractive() {
+		progress = "plain"
+	}
+	if len(reclaimCmds) > 0 && !squash {
+		return fmt.Errorf("--reclaim-command requires --squash")
+	}
+
 	// Validate that the LXCfile exists
 	if _, err := os.Stat(buildFile); os.IsNotExist(err) {
 		return fmt.Errorf("LXCfile not found: %s", buildFile)
@@ -130,12 +253,53 @@ func runBuild(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalid LXCfile: %w", err)
 	}
 
+	// Stop at an intermediate stage if requested
+	if lxcfile, err = lxcfile.ForTarget(buildTarget); err != nil {
+		return err
+	}
+	if buildTarget != "" {
+		PrintInfo("Build target: %s", buildTarget)
+	}
+
+	// Add labels from --label-file and --label
+	lxcfile.Labels, err = mergeBuildLabels(lxcfile.Labels, labelFile, buildLabels)
+	if err != nil {
+		return err
+	}
+
 	// Determine the template name
 	templateName := tag
 	if templateName == "" {
 		templateName = lxcfile.GetTemplateName()
 	}
 
+	// Create builder instance with configuration from config file
+	bldr := builder.New(&builder.Config{
+		Verbose:             IsVerbose(),
+		DryRun:              IsDryRun(),
+		ProxmoxNode:         viper.GetString("proxmox_node"),
+		Storage:             viper.GetString("storage"),
+		TemplateStorage:     viper.GetString("template_storage"),
+		AbortOnCleanupError: abortCleanup,
+		Compress:            compress,
+		OutputType:          outputType,
+		OutputDest:          outputDest,
+		KeepOnFailure:       keepFailed,
+		Squash:              squash,
+		ReclaimCommands:     reclaimCmds,
+		ReadyProbe:          readyProbe,
+		Progress:            progress,
+	})
+
+	// Build from another base template if requested
+	if buildFrom != "" {
+		from, err := bldr.ResolveBaseTemplate(buildFrom)
+		if err != nil {
+			return fmt.Errorf("invalid --build-from: %w", err)
+		}
+		lxcfile = builder.WithBaseTemplate(lxcfile, from)
+	}
+
 	PrintInfo("Building template: %s", templateName)
 	PrintInfo("Base template: %s", lxcfile.From)
 
@@ -145,37 +309,143 @@ func runBuild(cmd *cobra.Command, args []string) error {
 
 	if IsDryRun() {
 		PrintWarning("Dry run mode - no actual build will be performed")
-		return printDryRunPlan(lxcfile, templateName)
+		return printDryRunPlan(lxcfile, templateName, outputDest)
 	}
 
-	// Create builder instance with configuration from config file
-	bldr := builder.New(&builder.Config{
-		Verbose:     IsVerbose(),
-		DryRun:      IsDryRun(),
-		ProxmoxNode: viper.GetString("proxmox_node"),
-		Storage:     viper.GetString("storage"),
-		TemplateStorage: viper.GetString("template_storage"),
-	})
-
-	// Execute the build
-	result, err := bldr.BuildTemplate(lxcfile, templateName, buildArgsBld)
+	// Execute the build, resuming from the build cache
+	cache, err := bldr.LocalCache(templateName, noCache)
 	if err != nil {
+		return fmt.Errorf("build cache: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := bldr.BuildTemplateWithCache(ctx, lxcfile, templateName, buildArgsBld, cache)
+	if err != nil {
+		var buildErr *builder.BuildError
+		if keepFailed && errors.As(err, &buildErr) {
+			printKeptContainer(os.Stdout, buildErr)
+		}
 		return fmt.Errorf("build failed: %w", err)
 	}
 
+	if result.ArchivePath != "" {
+		PrintSuccess("Root filesystem archive written: %s", result.ArchivePath)
+		PrintInfo("Build time: %v", result.BuildDuration)
+		return nil
+	}
+
 	// Report success
 	PrintSuccess("Template built successfully: %s", result.TemplateName)
 	PrintInfo("Template path: %s", result.TemplatePath)
 	PrintInfo("Build time: %v", result.BuildDuration)
 
-	if IsVerbose() {
-		PrintInfo("Container ID used: %d", result.ContainerID)
-		PrintInfo("Steps executed: %d", len(result.ExecutedSteps))
+	if wide || IsVerbose() {
+		client := proxmox.NewClient(viper.GetString("proxmox_node"), IsVerbose(), IsDryRun())
+		volume, err := client.GetTemplateVolume(result.ContainerID)
+		if err != nil {
+			PrintWarning("Could not determine template size: %v", err)
+		}
+		printBuildResult(os.Stdout, result, volume)
 	}
 
 	return nil
 }
 
+// parseBuildOutput interprets --output: "wide" for a detailed result, or an
+// output spec such as "type=tar,dest=rootfs.tar.gz". A relative dest is made
+// absolute since pct and tar run from a different working directory.
+func parseBuildOutput(value string) (wide bool, outputType, dest string, err error) {
+	switch {
+	case value == "":
+		return false, "template", "", nil
+	case value == "wide":
+		return true, "template", "", nil
+	case !strings.Contains(value, "="):
+		return false, "", "", fmt.Errorf("unsupported output format '%s' (supported: wide, type=template|tar[,dest=PATH])", value)
+	}
+
+	outputType, dest, err = builder.ParseOutput(value)
+	if err != nil {
+		return false, "", "", fmt.Errorf("invalid --output: %w", err)
+	}
+	if dest != "" {
+		if dest, err = filepath.Abs(dest); err != nil {
+			return false, "", "", fmt.Errorf("invalid --output dest: %w", err)
+		}
+	}
+	return false, outputType, dest, nil
+}
+
+// printKeptContainer explains how to inspect and remove a container kept
+// after a failed build
+func printKeptContainer(w io.Writer, buildErr *builder.BuildError) {
+	fmt.Fprintf(w, "\nBuild failed at %s; container %d was kept for inspection:\n", buildErr.Step, buildErr.ContainerID)
+	fmt.Fprintf(w, "  Enter it:   pct enter %d\n", buildErr.ContainerID)
+	fmt.Fprintf(w, "  Remove it:  pct stop %d && pct destroy %d\n\n", buildErr.ContainerID, buildErr.ContainerID)
+}
+
+// printBuildResult writes a summary of the produced template. volume is the
+// template's root filesystem as reported by the storage and may be nil.
+func printBuildResult(w io.Writer, result *builder.BuildResult, volume *proxmox.StorageVolume) {
+	fmt.Fprintln(w, "\nBuild Result:")
+	fmt.Fprintf(w, "  Template:     %s\n", result.TemplateName)
+	fmt.Fprintf(w, "  Reference:    %s\n", result.TemplatePath)
+	fmt.Fprintf(w, "  Container ID: %d\n", result.ContainerID)
+	storage, size, format := result.Storage, int64(0), ""
+	if volume != nil {
+		storage, size, format = volume.Storage(), volume.Size, volume.ArchiveFormat()
+	}
+	if storage != "" {
+		fmt.Fprintf(w, "  Storage:      %s\n", storage)
+	}
+	fmt.Fprintf(w, "  Size:         %s\n", formatMemory(size))
+	if format != "" {
+		fmt.Fprintf(w, "  Format:       %s\n", format)
+	}
+	fmt.Fprintf(w, "  Steps:        %d\n", len(result.ExecutedSteps))
+	if len(result.Steps) > 0 {
+		for _, step := range result.Steps {
+			fmt.Fprintf(w, "                %-8s %-24s %s\n", step.Phase, step.Name, step.Status)
+		}
+	} else if len(result.ExecutedSteps) > 0 {
+		fmt.Fprintf(w, "                %s\n", strings.Join(result.ExecutedSteps, ", "))
+	}
+	fmt.Fprintf(w, "  Build time:   %v\n", result.BuildDuration)
+	fmt.Fprintln(w)
+}
+
+// mergeBuildLabels layers template labels: the LXCfile's labels, then those
+// from the label file, then --label values
+func mergeBuildLabels(lxcfileLabels map[string]string, labelFile string, flags []string) (map[string]string, error) {
+	labels := make(map[string]string, len(lxcfileLabels))
+	for key, value := range lxcfileLabels {
+		labels[key] = value
+	}
+
+	if labelFile != "" {
+		fileLabels, err := config.LoadLabelFile(labelFile)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileLabels {
+			labels[key] = value
+		}
+	}
+
+	for _, flag := range flags {
+		key, value, found := strings.Cut(flag, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid label '%s', expected KEY=VALUE", flag)
+		}
+		if err := models.ValidateLabelKey(key); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+
+	return labels, nil
+}
+
 func printBuildSummary(lxcfile *models.LXCfile) {
 	fmt.Println("\nBuild Summary:")
 	fmt.Printf("  Base: %s\n", lxcfile.From)
@@ -191,6 +461,10 @@ func printBuildSummary(lxcfile *models.LXCfile) {
 
 	fmt.Printf("  Setup steps: %d\n", len(lxcfile.Setup))
 
+	if stages := lxcfile.StageOrder(); len(stages) > 0 {
+		fmt.Printf("  Stages: %s\n", strings.Join(stages, ", "))
+	}
+
 	if len(lxcfile.Cleanup) > 0 {
 		fmt.Printf("  Cleanup steps: %d\n", len(lxcfile.Cleanup))
 	}
@@ -211,8 +485,12 @@ func printBuildSummary(lxcfile *models.LXCfile) {
 	fmt.Println()
 }
 
-func printDryRunPlan(lxcfile *models.LXCfile, templateName string) error {
+func printDryRunPlan(lxcfile *models.LXCfile, templateName, archiveDest string) error {
 	fmt.Println("\nDry Run Plan:")
+	for _, name := range lxcfile.StageOrder() {
+		stage := lxcfile.Stages[name]
+		fmt.Printf("  Stage %s: %d setup steps from %s, then copy its files out\n", name, len(stage.Setup), stage.From)
+	}
 	fmt.Printf("  1. Create temporary container from base: %s\n", lxcfile.From)
 
 	for i, step := range lxcfile.Setup {
@@ -233,7 +511,11 @@ func printDryRunPlan(lxcfile *models.LXCfile, templateName string) error {
 		fmt.Printf("  %d. Run cleanup steps (%d steps)\n", len(lxcfile.Setup)+3, len(lxcfile.Cleanup))
 	}
 
-	fmt.Printf("  %d. Export template as: %s\n", len(lxcfile.Setup)+4, templateName)
+	if archiveDest != "" {
+		fmt.Printf("  %d. Export root filesystem to: %s\n", len(lxcfile.Setup)+4, archiveDest)
+	} else {
+		fmt.Printf("  %d. Export template as: %s\n", len(lxcfile.Setup)+4, templateName)
+	}
 	fmt.Printf("  %d. Clean up temporary container\n", len(lxcfile.Setup)+5)
 
 	return nil
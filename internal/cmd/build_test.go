@@ -1,15 +1,19 @@
 package cmd
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	
 	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/builder"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
 )
 
 func TestBuildCommand(t *testing.T) {
@@ -324,7 +328,7 @@ func TestPrintBuildSummary(t *testing.T) {
 func TestPrintDryRunPlan(t *testing.T) {
 	lxcfile := createTestLXCfile()
 	
-	err := printDryRunPlan(lxcfile, "test:1.0")
+	err := printDryRunPlan(lxcfile, "test:1.0", "")
 	if err != nil {
 		t.Errorf("printDryRunPlan returned unexpected error: %v", err)
 	}
@@ -406,4 +410,152 @@ func TestTruncateString(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestPrintBuildResult(t *testing.T) {
+	result := &builder.BuildResult{
+		TemplateName:  "webapp:1.0",
+		TemplatePath:  "12345",
+		Storage:       "local-lvm",
+		ContainerID:   12345,
+		BuildDuration: 90 * time.Second,
+		ExecutedSteps: []string{"Step 1", "Step 2", "Cleanup 1"},
+	}
+
+	var buf bytes.Buffer
+	printBuildResult(&buf, result, &proxmox.StorageVolume{
+		VolID:  "local-lvm:base-12345-disk-0",
+		Format: "raw",
+		Size:   2 * 1024 * 1024 * 1024,
+	})
+	output := buf.String()
+
+	expected := []string{
+		"Template:     webapp:1.0",
+		"Reference:    12345",
+		"Container ID: 12345",
+		"Storage:      local-lvm",
+		"Size:         2.0GB",
+		"Format:       raw",
+		"Steps:        3",
+		"Step 1, Step 2, Cleanup 1",
+		"Build time:   1m30s",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Build result missing %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestPrintKeptContainer(t *testing.T) {
+	var buf bytes.Buffer
+	printKeptContainer(&buf, &builder.BuildError{Step: "migrate", ContainerID: 12345})
+
+	output := buf.String()
+	for _, want := range []string{"Build failed at migrate", "container 12345 was kept", "pct enter 12345", "pct destroy 12345"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestMergeBuildLabels(t *testing.T) {
+	labelFile := filepath.Join(t.TempDir(), "labels.txt")
+	content := "# Compliance\ntier=backend\ncompliance/owner=platform-team\nversion=1.0\n"
+	if err := os.WriteFile(labelFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write label file: %v", err)
+	}
+	lxcfileLabels := map[string]string{"tier": "frontend", "project": "shop"}
+
+	tests := []struct {
+		name      string
+		labelFile string
+		flags     []string
+		expected  map[string]string
+		errorMsg  string
+	}{
+		{
+			name:     "LXCfile labels only",
+			expected: map[string]string{"tier": "frontend", "project": "shop"},
+		},
+		{
+			name:      "label file overrides LXCfile",
+			labelFile: labelFile,
+			expected:  map[string]string{"tier": "backend", "project": "shop", "compliance/owner": "platform-team", "version": "1.0"},
+		},
+		{
+			name:      "--label overrides label file",
+			labelFile: labelFile,
+			flags:     []string{"version=1.1", "build=a=b"},
+			expected:  map[string]string{"tier": "backend", "project": "shop", "compliance/owner": "platform-team", "version": "1.1", "build": "a=b"},
+		},
+		{
+			name:     "label without value",
+			flags:    []string{"tier"},
+			errorMsg: "invalid label 'tier', expected KEY=VALUE",
+		},
+		{
+			name:     "invalid label key",
+			flags:    []string{"bad key=1"},
+			errorMsg: "invalid label key 'bad key'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, err := mergeBuildLabels(lxcfileLabels, tt.labelFile, tt.flags)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("mergeBuildLabels() error = %v, want %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeBuildLabels() unexpected error: %v", err)
+			}
+			if len(labels) != len(tt.expected) {
+				t.Errorf("mergeBuildLabels() = %v, want %v", labels, tt.expected)
+			}
+			for key, value := range tt.expected {
+				if labels[key] != value {
+					t.Errorf("label %s = %q, want %q", key, labels[key], value)
+				}
+			}
+		})
+	}
+
+	if lxcfileLabels["tier"] != "frontend" {
+		t.Error("mergeBuildLabels() modified the LXCfile labels")
+	}
+}
+
+func TestParseBuildOutput(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	wide, outputType, dest, err := parseBuildOutput("type=tar,dest=rootfs.tar.zst")
+	if err != nil {
+		t.Fatalf("parseBuildOutput() unexpected error: %v", err)
+	}
+	if wide || outputType != "tar" || dest != filepath.Join(dir, "rootfs.tar.zst") {
+		t.Errorf("parseBuildOutput() = %v, %q, %q, want a tar output with an absolute dest", wide, outputType, dest)
+	}
+
+	if wide, outputType, _, _ := parseBuildOutput("wide"); !wide || outputType != "template" {
+		t.Errorf("parseBuildOutput(wide) = %v, %q, want a wide template output", wide, outputType)
+	}
+	if _, _, _, err := parseBuildOutput("json"); err == nil {
+		t.Error("parseBuildOutput(json) expected an unsupported format error")
+	}
+	if _, _, _, err := parseBuildOutput("type=tar,dest=missing/rootfs.tar"); err == nil || !strings.Contains(err.Error(), "invalid --output") {
+		t.Errorf("parseBuildOutput() error = %v, want an invalid --output error", err)
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+)
+
+// completionCmd represents the completion command
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate shell completion scripts",
+	Long: `Generate a completion script for your shell.
+
+Besides commands and flags, service names are completed for commands that
+take them (up, logs, stats, attach, enter, exec), read from the stack file given with
+-f/--file or lxc-stack.yml in the current directory.
+
+BASH:
+  # Current shell
+  source <(pxc completion bash)
+  # Every new shell (needs the bash-completion package)
+  pxc completion bash > /etc/bash_completion.d/pxc
+
+ZSH:
+  # Every new shell (compinit must be enabled)
+  pxc completion zsh > "${fpath[1]}/_pxc"
+
+FISH:
+  pxc completion fish > ~/.config/fish/completions/pxc.fish
+
+POWERSHELL:
+  pxc completion powershell | Out-String | Invoke-Expression`,
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+		return fmt.Errorf("unsupported shell '%s'", args[0])
+	},
+}
+
+func init() {
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(completionCmd)
+
+	// Commands taking any number of services
+	for _, cmd := range []*cobra.Command{upCmd, logsCmd, statsCmd, restartCmd, watchCmd} {
+		cmd.ValidArgsFunction = completeServiceNames
+	}
+	// Commands taking a single service
+	for _, cmd := range []*cobra.Command{attachCmd, enterCmd, execCmd} {
+		cmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeServiceNames(cmd, args, toComplete)
+		}
+	}
+}
+
+// completeServiceNames suggests the services defined in the command's stack
+// file that start with toComplete and are not already given
+func completeServiceNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	path, _ := cmd.Flags().GetString("file")
+	if path == "" {
+		path = config.GetDefaultStackfile()
+	}
+
+	stack, err := config.LoadLXCStack(path)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	given := make(map[string]bool, len(args))
+	for _, arg := range args {
+		given[arg] = true
+	}
+
+	var names []string
+	for name := range stack.Services {
+		if !given[name] && strings.HasPrefix(name, toComplete) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCompleteServiceNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lxc-stack.yml")
+	if err := os.WriteFile(path, []byte(`version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+  worker:
+    template: "alpine:3.19"
+  database:
+    template: "postgres:15"
+`), 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		toComplete string
+		expected   []string
+	}{
+		{name: "all services", expected: []string{"database", "web", "worker"}},
+		{name: "prefix", toComplete: "w", expected: []string{"web", "worker"}},
+		{name: "skips services already given", args: []string{"web"}, expected: []string{"database", "worker"}},
+		{name: "no match", toComplete: "cache", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{Use: "logs"}
+			cmd.Flags().StringP("file", "f", "", "")
+			if err := cmd.Flags().Set("file", path); err != nil {
+				t.Fatalf("Failed to set file flag: %v", err)
+			}
+
+			names, directive := completeServiceNames(cmd, tt.args, tt.toComplete)
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("completeServiceNames() = %v, want %v", names, tt.expected)
+			}
+			if directive != cobra.ShellCompDirectiveNoFileComp {
+				t.Errorf("directive = %v, want NoFileComp", directive)
+			}
+		})
+	}
+
+	t.Run("missing stack file", func(t *testing.T) {
+		cmd := &cobra.Command{Use: "logs"}
+		cmd.Flags().StringP("file", "f", filepath.Join(t.TempDir(), "missing.yml"), "")
+
+		names, _ := completeServiceNames(cmd, nil, "")
+		if names != nil {
+			t.Errorf("completeServiceNames() = %v, want no suggestions", names)
+		}
+	})
+}
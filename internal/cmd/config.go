@@ -0,0 +1,405 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/registry"
+	"github.com/brynnjknight/proxer/pkg/terminal"
+)
+
+// configKey describes a setting that can be managed with 'pxc config'
+type configKey struct {
+	description string
+	validate    func(value string) error
+}
+
+var storageIDPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
+var nodeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+
+// configKeys lists the known configuration keys
+var configKeys = map[string]configKey{
+	"storage": {
+		description: "Container storage backend",
+		validate:    validateStorageID,
+	},
+	"template_storage": {
+		description: "Template storage location",
+		validate:    validateStorageID,
+	},
+	"proxmox_node": {
+		description: "Target Proxmox node",
+		validate: func(value string) error {
+			if !nodeNamePattern.MatchString(value) {
+				return fmt.Errorf("invalid node name '%s'", value)
+			}
+			return nil
+		},
+	},
+	"vmid_range": {
+		description: "Range of container IDs to allocate from (MIN-MAX)",
+		validate:    validateVMIDRange,
+	},
+	"temp_container_prefix": {
+		description: "Hostname prefix for temporary build containers",
+		validate: func(value string) error {
+			if !nodeNamePattern.MatchString(value + "x") {
+				return fmt.Errorf("invalid hostname prefix '%s'", value)
+			}
+			return nil
+		},
+	},
+	"registry": {
+		description: "Template registry for pxc push and pull (path, ssh://, http(s):// or s3:// URL)",
+		validate:    registry.CheckLocation,
+	},
+	"secrets_provider": {
+		description: "Command printing an external secret, given its name as the argument",
+		validate: func(value string) error {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("secrets provider must not be empty")
+			}
+			return nil
+		},
+	},
+	"detach_keys": {
+		description: "Key sequence for detaching from attach sessions",
+		validate: func(value string) error {
+			_, err := terminal.ParseDetachKeys(value)
+			return err
+		},
+	},
+}
+
+// configKeyAliases maps flag-style names to their config keys
+var configKeyAliases = map[string]string{
+	"node":                  "proxmox_node",
+	"template-storage":      "template_storage",
+	"vmid-range":            "vmid_range",
+	"temp-container-prefix": "temp_container_prefix",
+	"detach-keys":           "detach_keys",
+}
+
+var (
+	configDev      bool
+	configServices bool
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config [OPTIONS]",
+	Short: "Print the resolved stack or manage the pxc configuration file",
+	Long: `Without a subcommand, print the stack as pxc up deploys it: its includes
+merged, ${VAR} references interpolated, Compose deploy blocks and resource
+profiles expanded, the memory and cores of settings.default_resources filled
+into each service, and relative paths made absolute. With --dev, the
+development overrides are applied first. The output is canonical YAML,
+suited to debugging which setting wins and to diffing in CI. Use
+'pxc validate' to check the stack for errors.
+
+The set and get subcommands read and write settings in the pxc
+configuration file. The file used is the one pxc resolves at startup: the
+--config flag value, ./.pxc.yaml or $HOME/.pxc.yaml. If none exists,
+$HOME/.pxc.yaml is created. Comments and the order of existing settings are
+kept when a value is changed.
+
+KNOWN KEYS:
+` + configKeysHelp(),
+	Example: `  # Print the resolved stack
+  pxc config
+
+  # Print it with the development overrides applied
+  pxc config --dev
+
+  # List the services of another stack file
+  pxc config -f lxc-stack.prod.yml --services`,
+	Args: cobra.NoArgs,
+	RunE: runConfig,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Set a configuration value",
+	Example: `  pxc config set storage local-zfs
+  pxc config set node pve2
+  pxc config set vmid_range 9000-9999`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := configFilePath()
+		if err != nil {
+			return err
+		}
+		key, err := setConfigValue(path, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		PrintSuccess("Set %s in %s", key, path)
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print a configuration value",
+	Long: `Print a value from the configuration file.
+
+Command-line flags and environment variables are not applied; the value is
+what the file contains.`,
+	Example: `  pxc config get storage`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := configFilePath()
+		if err != nil {
+			return err
+		}
+		value, err := getConfigValue(path, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), value)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configGetCmd)
+
+	configCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	configCmd.Flags().BoolVar(&configDev, "dev", false, "Apply the development overrides")
+	configCmd.Flags().BoolVar(&configServices, "services", false, "Print the service names, one per line")
+}
+
+func runConfig(cmd *cobra.Command, args []string) error {
+	if stackFile == "" {
+		stackFile = config.GetDefaultStackfile()
+	}
+
+	load := config.LoadLXCStack
+	if configDev {
+		load = config.LoadDevelopmentStack
+	}
+	stack, err := load(stackFile)
+	if err != nil {
+		return fmt.Errorf("failed to load stack: %w", err)
+	}
+	stack.ApplyDefaultResources()
+
+	if configServices {
+		names := make([]string, 0, len(stack.Services))
+		for name := range stack.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(cmd.OutOrStdout(), name)
+		}
+		return nil
+	}
+
+	data, err := marshalStack(stack)
+	if err != nil {
+		return err
+	}
+	_, err = cmd.OutOrStdout().Write(data)
+	return err
+}
+
+// configKeysHelp renders the known keys for the help text
+func configKeysHelp() string {
+	var b strings.Builder
+	for _, name := range knownConfigKeys() {
+		fmt.Fprintf(&b, "  %-22s %s\n", name, configKeys[name].description)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// configFilePath returns the config file in use, or $HOME/.pxc.yaml when no
+// config file was found
+func configFilePath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	if used := viper.ConfigFileUsed(); used != "" {
+		if _, err := os.Stat(used); err == nil {
+			return used, nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, ".pxc.yaml"), nil
+}
+
+// resolveConfigKey validates a key name and resolves aliases
+func resolveConfigKey(name string) (string, error) {
+	if alias, ok := configKeyAliases[name]; ok {
+		name = alias
+	}
+	if _, ok := configKeys[name]; !ok {
+		return "", fmt.Errorf("unknown config key '%s' (known keys: %s)", name, strings.Join(knownConfigKeys(), ", "))
+	}
+	return name, nil
+}
+
+func knownConfigKeys() []string {
+	names := make([]string, 0, len(configKeys))
+	for name := range configKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setConfigValue validates and writes a key to the config file at path,
+// creating the file if needed. It returns the resolved key name.
+func setConfigValue(path, name, value string) (string, error) {
+	key, err := resolveConfigKey(name)
+	if err != nil {
+		return "", err
+	}
+	if err := configKeys[key].validate(value); err != nil {
+		return "", fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	doc, err := readConfigDocument(path)
+	if err != nil {
+		return "", err
+	}
+	root := doc.Content[0]
+
+	updated := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			root.Content[i+1].Kind = yaml.ScalarNode
+			root.Content[i+1].Tag = "!!str"
+			root.Content[i+1].Value = value
+			root.Content[i+1].Content = nil
+			updated = true
+			break
+		}
+	}
+	if !updated {
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+		)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write config file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// getConfigValue reads a key from the config file at path
+func getConfigValue(path, name string) (string, error) {
+	key, err := resolveConfigKey(name)
+	if err != nil {
+		return "", err
+	}
+
+	doc, err := readConfigDocument(path)
+	if err != nil {
+		return "", err
+	}
+	root := doc.Content[0]
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			return root.Content[i+1].Value, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not set in %s", key, path)
+}
+
+// readConfigDocument parses the config file as a YAML node tree so comments
+// survive a rewrite. A missing or empty file yields an empty mapping.
+func readConfigDocument(path string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := yaml.Unmarshal(data, doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file %s must contain a mapping of settings", path)
+	}
+	return doc, nil
+}
+
+func validateStorageID(value string) error {
+	if !storageIDPattern.MatchString(value) {
+		return fmt.Errorf("invalid storage ID '%s'", value)
+	}
+	return nil
+}
+
+// validateVMIDRange checks a MIN-MAX container ID range
+func validateVMIDRange(value string) error {
+	_, _, err := parseVMIDRange(value)
+	return err
+}
+
+// parseVMIDRange parses a MIN-MAX container ID range
+func parseVMIDRange(value string) (int, int, error) {
+	minText, maxText, found := strings.Cut(value, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("vmid range '%s' must be in the form MIN-MAX", value)
+	}
+	minID, err := strconv.Atoi(strings.TrimSpace(minText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vmid range '%s': %w", value, err)
+	}
+	maxID, err := strconv.Atoi(strings.TrimSpace(maxText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vmid range '%s': %w", value, err)
+	}
+	if minID < 100 || maxID > 999999999 || minID > maxID {
+		return 0, 0, fmt.Errorf("vmid range '%s' must satisfy 100 <= MIN <= MAX <= 999999999", value)
+	}
+	return minID, maxID, nil
+}
+
+// containerIDRange returns the vmid_range setting new containers get their
+// IDs from, zero for the default range
+func containerIDRange() (int, int, error) {
+	value := viper.GetString("vmid_range")
+	if value == "" {
+		return 0, 0, nil
+	}
+	return parseVMIDRange(value)
+}
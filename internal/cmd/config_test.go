@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigSetGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".pxc.yaml")
+	original := `# Proxmox settings
+storage: local-lvm  # container storage
+proxmox_node: pve
+`
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key      string
+		value    string
+		resolved string
+	}{
+		{key: "storage", value: "local-zfs", resolved: "storage"},
+		{key: "node", value: "pve2", resolved: "proxmox_node"},
+		{key: "vmid_range", value: "9000-9999", resolved: "vmid_range"},
+		{key: "detach_keys", value: "ctrl-x,q", resolved: "detach_keys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			key, err := setConfigValue(path, tt.key, tt.value)
+			if err != nil {
+				t.Fatalf("setConfigValue() unexpected error: %v", err)
+			}
+			if key != tt.resolved {
+				t.Errorf("setConfigValue() key = %q, want %q", key, tt.resolved)
+			}
+
+			value, err := getConfigValue(path, tt.key)
+			if err != nil {
+				t.Fatalf("getConfigValue() unexpected error: %v", err)
+			}
+			if value != tt.value {
+				t.Errorf("getConfigValue() = %q, want %q", value, tt.value)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Proxmox settings", "# container storage", "storage: local-zfs"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config file missing %q, got:\n%s", want, data)
+		}
+	}
+}
+
+func TestConfigSetCreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".pxc.yaml")
+
+	if _, err := setConfigValue(path, "template_storage", "nfs-templates"); err != nil {
+		t.Fatalf("setConfigValue() unexpected error: %v", err)
+	}
+
+	value, err := getConfigValue(path, "template_storage")
+	if err != nil {
+		t.Fatalf("getConfigValue() unexpected error: %v", err)
+	}
+	if value != "nfs-templates" {
+		t.Errorf("getConfigValue() = %q, want nfs-templates", value)
+	}
+}
+
+func TestConfigSetGetErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".pxc.yaml")
+
+	tests := []struct {
+		name     string
+		key      string
+		value    string
+		errorMsg string
+	}{
+		{name: "unknown key", key: "storage_pool", value: "local", errorMsg: "unknown config key 'storage_pool'"},
+		{name: "invalid storage", key: "storage", value: "local lvm", errorMsg: "invalid value for storage"},
+		{name: "invalid vmid range", key: "vmid_range", value: "9999-9000", errorMsg: "invalid value for vmid_range"},
+		{name: "invalid detach keys", key: "detach_keys", value: "ctrl-1", errorMsg: "invalid value for detach_keys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := setConfigValue(path, tt.key, tt.value)
+			if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("setConfigValue() error = %v, want containing %q", err, tt.errorMsg)
+			}
+		})
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("rejected values should not create the config file")
+	}
+
+	if _, err := getConfigValue(path, "bogus"); err == nil || !strings.Contains(err.Error(), "unknown config key") {
+		t.Errorf("getConfigValue() error = %v, want unknown config key", err)
+	}
+	if _, err := getConfigValue(path, "storage"); err == nil || !strings.Contains(err.Error(), "is not set") {
+		t.Errorf("getConfigValue() error = %v, want not set", err)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lxc-stack.yml")
+	stack := `version: "1.0"
+settings:
+  default_resources:
+    memory: 1024
+    cores: 2
+services:
+  web:
+    template: "9000"
+    environment:
+      MODE: ${MODE:-production}
+    resources:
+      memory: 512
+development:
+  services:
+    web:
+      environment:
+        MODE: development
+  extra_services:
+    adminer:
+      template: "9001"
+`
+	if err := os.WriteFile(path, []byte(stack), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dev      bool
+		services bool
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:    "resolved stack",
+			want:    []string{"MODE: production", "memory: 512", "cores: 2", "development:"},
+			notWant: []string{"${MODE", "adminer:\n    template"},
+		},
+		{
+			name:    "development overrides",
+			dev:     true,
+			want:    []string{"MODE: development", "  adminer:\n    template: \"9001\"\n    resources:\n      cores: 2\n      memory: 1024"},
+			notWant: []string{"development:"},
+		},
+		{
+			name:     "service names",
+			dev:      true,
+			services: true,
+			want:     []string{"adminer\nweb\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackFile, configDev, configServices = path, tt.dev, tt.services
+			defer func() { stackFile, configDev, configServices = "", false, false }()
+
+			var out strings.Builder
+			configCmd.SetOut(&out)
+			defer configCmd.SetOut(nil)
+			if err := runConfig(configCmd, nil); err != nil {
+				t.Fatalf("runConfig() unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("output contains %q:\n%s", notWant, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/brynnjknight/proxer/pkg/terminal"
+)
+
+// Where confirmation prompts are asked and answered. The prompt goes to
+// stderr so machine-readable output on stdout stays clean.
+var (
+	promptIn        io.Reader = os.Stdin
+	promptOut       io.Writer = os.Stderr
+	stdinIsTerminal           = func() bool { return terminal.IsTerminal(int(os.Stdin.Fd())) }
+)
+
+// IsNonInteractive returns true if pxc must not prompt: --non-interactive
+// was given or CI=true is set, as CI systems do
+func IsNonInteractive() bool {
+	if nonInteractive {
+		return true
+	}
+	ci := strings.ToLower(os.Getenv("CI"))
+	return ci == "true" || ci == "1"
+}
+
+// confirmDestructive asks before an operation that deletes data, described
+// by action such as "remove the volumes of project 'web'". yes skips the
+// question. Without a terminal to ask on, or in non-interactive mode,
+// the operation is refused unless yes is set; the default answer is no.
+func confirmDestructive(action string, yes bool) error {
+	if yes {
+		return nil
+	}
+	if IsNonInteractive() || !stdinIsTerminal() {
+		return fmt.Errorf("refusing to %s without confirmation; pass --yes to proceed", action)
+	}
+
+	fmt.Fprintf(promptOut, "This will %s. Continue? [y/N] ", action)
+	answer, _ := bufio.NewReader(promptIn).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("aborted")
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfirmDestructive(t *testing.T) {
+	originalIn, originalOut, originalTerminal := promptIn, promptOut, stdinIsTerminal
+	originalNonInteractive := nonInteractive
+	defer func() {
+		promptIn, promptOut, stdinIsTerminal = originalIn, originalOut, originalTerminal
+		nonInteractive = originalNonInteractive
+	}()
+
+	tests := []struct {
+		name           string
+		nonInteractive bool
+		ci             string
+		terminal       bool
+		yes            bool
+		answer         string
+		wantErr        string
+		wantPrompt     bool
+	}{
+		{name: "non-interactive without yes", nonInteractive: true, terminal: true, wantErr: "refusing to remove the volumes without confirmation; pass --yes to proceed"},
+		{name: "CI without yes", ci: "true", terminal: true, wantErr: "refusing to remove the volumes without confirmation; pass --yes to proceed"},
+		{name: "non-interactive with yes", nonInteractive: true, yes: true},
+		{name: "no terminal without yes", wantErr: "refusing to remove the volumes without confirmation; pass --yes to proceed"},
+		{name: "confirmed at the prompt", terminal: true, answer: "y\n", wantPrompt: true},
+		{name: "empty answer declines", terminal: true, answer: "\n", wantErr: "aborted", wantPrompt: true},
+		{name: "CI=false prompts", ci: "false", terminal: true, answer: "yes\n", wantPrompt: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CI", tt.ci)
+			nonInteractive = tt.nonInteractive
+			terminal := tt.terminal
+			stdinIsTerminal = func() bool { return terminal }
+			var prompt bytes.Buffer
+			promptIn, promptOut = strings.NewReader(tt.answer), &prompt
+
+			err := confirmDestructive("remove the volumes", tt.yes)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("confirmDestructive() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("confirmDestructive() unexpected error: %v", err)
+			}
+			if prompted := prompt.Len() > 0; prompted != tt.wantPrompt {
+				t.Errorf("prompted = %v (%q), want %v", prompted, prompt.String(), tt.wantPrompt)
+			}
+		})
+	}
+}
+
+func TestDownVolumesNonInteractive(t *testing.T) {
+	originalFile, originalVolumes, originalOutput := stackFile, removeVolumes, downOutput
+	originalNonInteractive, originalYes, originalProject := nonInteractive, downYes, projectName
+	defer func() {
+		stackFile, removeVolumes, downOutput = originalFile, originalVolumes, originalOutput
+		nonInteractive, downYes, projectName = originalNonInteractive, originalYes, originalProject
+	}()
+
+	stackFile = filepath.Join(t.TempDir(), "lxc-stack.yml")
+	content := "version: \"1.0\"\nservices:\n  db:\n    template: \"postgres:15\"\n    volumes:\n      - data:/var/lib/postgresql\nvolumes:\n  data: {}\n"
+	if err := os.WriteFile(stackFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+	removeVolumes, downOutput, downYes, projectName = true, "json", false, "ci"
+	nonInteractive = true
+
+	err := runDown(downCmd, nil)
+	if err == nil || !strings.Contains(err.Error(), "pass --yes") {
+		t.Fatalf("runDown() error = %v, want a confirmation error", err)
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+var (
+	convertOutput string
+	convertForce  bool
+)
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert [OPTIONS]",
+	Short: "Convert a Compose file to an lxc-stack.yml",
+	Long: `Convert reads a docker-compose.yml and writes the equivalent lxc-stack.yml.
+
+pxc up and the other stack commands also load Compose files directly,
+converting them the same way; convert writes the result out so it can be
+reviewed and extended with settings Compose has no equivalent for.
+
+CONVERSION:
+  image           → template (an LXC template of that name must exist)
+  build           → build (context, args, target); proxer builds from the
+                    LXCfile.yml in the context, so dockerfile is left out
+  healthcheck     → health (CMD and CMD-SHELL tests run in the container)
+  ports, volumes  → short syntax; tmpfs mounts are left out
+  environment     → map; entries without a value become ${NAME}
+  depends_on      → depends_on, keeping service_healthy conditions
+  container_name  → hostname, unless hostname is set
+  restart         → restart; on-failure:N also sets restart_policy
+  deploy, labels, networks, secrets, configs, dns, pid, shm_size, scale
+                  → copied over
+
+Settings without an equivalent, such as command or privileged, are left out
+with a warning. ${VAR} references are kept and substituted when the stack
+is loaded.`,
+	Example: `  # Convert docker-compose.yml to lxc-stack.yml next to it
+  pxc convert
+
+  # Print the converted stack instead
+  pxc convert -f compose.yaml -o -`,
+	Args: cobra.NoArgs,
+	RunE: runConvert,
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to Compose file (default: docker-compose.yml)")
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "Path to write the stack to, - for stdout (default: lxc-stack.yml next to the Compose file)")
+	convertCmd.Flags().BoolVar(&convertForce, "force", false, "Overwrite an existing output file")
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	source := stackFile
+	if source == "" {
+		source = defaultComposeFile()
+	}
+
+	target := convertOutput
+	if target == "" {
+		target = filepath.Join(filepath.Dir(source), "lxc-stack.yml")
+	}
+	if target != "-" && !convertForce {
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("%s already exists, use --force to overwrite it", target)
+		}
+	}
+
+	stack, warnings, err := config.LoadCompose(source)
+	if err != nil {
+		return err
+	}
+	data, err := marshalStack(stack)
+	if err != nil {
+		return err
+	}
+
+	// Warnings go to stderr so the stack can be piped
+	for _, warning := range warnings {
+		output.Fprintf(os.Stderr, output.Warning, "%s: %s", warning.Path, warning.Message)
+	}
+
+	if target == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	PrintSuccess("Converted %s to %s", source, target)
+	return nil
+}
+
+// defaultComposeFile returns the first Compose file in the current
+// directory, docker-compose.yml if there is none
+func defaultComposeFile() string {
+	for _, candidate := range []string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"} {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return "docker-compose.yml"
+}
+
+// marshalStack encodes a stack as YAML indented like the examples
+func marshalStack(stack *models.LXCStack) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(stack); err != nil {
+		return nil, fmt.Errorf("failed to encode stack: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode stack: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+)
+
+func TestRunConvert(t *testing.T) {
+	defer func() {
+		stackFile, convertOutput, convertForce = "", "", false
+	}()
+
+	dir := t.TempDir()
+	stackFile = filepath.Join(dir, "docker-compose.yml")
+	content := `services:
+  db:
+    image: postgres:15
+    healthcheck:
+      test: ["CMD", "pg_isready"]
+      interval: 10s
+`
+	if err := os.WriteFile(stackFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+
+	if err := runConvert(convertCmd, nil); err != nil {
+		t.Fatalf("runConvert() unexpected error: %v", err)
+	}
+	target := filepath.Join(dir, "lxc-stack.yml")
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("stack was not written: %v", err)
+	}
+	if !strings.Contains(string(data), "template: postgres:15") || !strings.Contains(string(data), "interval: 10s") {
+		t.Errorf("converted stack =\n%s", data)
+	}
+
+	// The written stack loads like the Compose file
+	stack, err := config.LoadLXCStack(target)
+	if err != nil {
+		t.Fatalf("LoadLXCStack() unexpected error: %v", err)
+	}
+	if health := stack.Services["db"].Health; health == nil || health.Test != "pg_isready" {
+		t.Errorf("db health = %+v", health)
+	}
+
+	if err := runConvert(convertCmd, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("runConvert() over an existing stack error = %v, want already exists", err)
+	}
+	convertForce = true
+	if err := runConvert(convertCmd, nil); err != nil {
+		t.Errorf("runConvert() with --force unexpected error: %v", err)
+	}
+}
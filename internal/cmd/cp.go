@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+var (
+	cpArchive bool
+	cpChown   string
+	cpIndex   int
+)
+
+// cpCmd represents the cp command
+var cpCmd = &cobra.Command{
+	Use:   "cp [OPTIONS] SRC_PATH SERVICE:DEST_PATH",
+	Short: "Copy files from the host into a service container",
+	Long: `Copy a file or directory from the host into a service's container.
+
+Directories are packed into a tar archive, pushed with pct push and extracted
+in the container, so the modes, owners and symlinks of the tree are kept; the
+contents of SRC_PATH end up in DEST_PATH. Single files are pushed as they
+are unless --archive is given, which copies them the same way to keep their
+mode and owner.
+
+--chown USER[:GROUP] gives the copied files to another owner instead of
+their host owner. DEST_PATH must be absolute.
+
+The container is looked up from what 'pxc up' recorded for the project.`,
+	Example: `  # Copy a config file into the web service
+  pxc cp nginx.conf web:/etc/nginx/nginx.conf
+
+  # Copy a directory tree keeping its permissions and owners
+  pxc cp ./public web:/srv/www
+
+  # Copy a file keeping its mode and owner
+  pxc cp -a deploy.sh web:/usr/local/bin/deploy.sh
+
+  # Copy a tree owned by the app user
+  pxc cp --chown app:app ./uploads web:/srv/app/uploads`,
+	Args: cobra.ExactArgs(2),
+	RunE: runCp,
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+
+	cpCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	cpCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	cpCmd.Flags().IntVar(&cpIndex, "index", 1, "Replica to copy into for scaled services")
+	cpCmd.Flags().BoolVarP(&cpArchive, "archive", "a", false, "Copy files through a tar archive too, keeping their mode and owner")
+	cpCmd.Flags().StringVar(&cpChown, "chown", "", "Owner of the copied files (USER[:GROUP]) instead of their host owner")
+}
+
+func runCp(cmd *cobra.Command, args []string) error {
+	if err := requirePCTTransport("cp"); err != nil {
+		return err
+	}
+	service, dest, err := parseCopyDest(args[1])
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(cpChown, " \t") || strings.HasPrefix(cpChown, ":") || strings.HasSuffix(cpChown, ":") {
+		return fmt.Errorf("invalid --chown '%s', must be USER or USER:GROUP", cpChown)
+	}
+	if _, err := os.Stat(args[0]); err != nil {
+		return fmt.Errorf("cannot copy %s: %w", args[0], err)
+	}
+
+	containerID, err := resolveServiceTarget(service, cpIndex)
+	if err != nil {
+		return err
+	}
+
+	client := proxmox.NewClient(viper.GetString("proxmox_node"), IsVerbose(), IsDryRun())
+	if err := client.CopyToContainer(containerID, args[0], dest, proxmox.CopyOptions{Archive: cpArchive, Chown: cpChown}); err != nil {
+		return err
+	}
+	if !IsDryRun() {
+		PrintSuccess("Copied %s to %s:%s", args[0], service, dest)
+	}
+	return nil
+}
+
+// parseCopyDest splits a SERVICE:DEST_PATH argument
+func parseCopyDest(arg string) (string, string, error) {
+	service, dest, found := strings.Cut(arg, ":")
+	if !found || service == "" {
+		return "", "", fmt.Errorf("destination '%s' must be SERVICE:DEST_PATH", arg)
+	}
+	if !path.IsAbs(dest) {
+		return "", "", fmt.Errorf("destination path '%s' must be absolute", dest)
+	}
+	return service, path.Clean(dest), nil
+}
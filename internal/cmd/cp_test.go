@@ -0,0 +1,36 @@
+package cmd
+
+import "testing"
+
+func TestParseCopyDest(t *testing.T) {
+	tests := []struct {
+		arg         string
+		wantService string
+		wantDest    string
+		wantErr     bool
+	}{
+		{arg: "web:/etc/nginx/nginx.conf", wantService: "web", wantDest: "/etc/nginx/nginx.conf"},
+		{arg: "web:/srv/www/", wantService: "web", wantDest: "/srv/www"},
+		{arg: "web:relative/path", wantErr: true},
+		{arg: ":/srv", wantErr: true},
+		{arg: "/srv/www", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			service, dest, err := parseCopyDest(tt.arg)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseCopyDest(%q) expected error, got %q %q", tt.arg, service, dest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCopyDest(%q) unexpected error: %v", tt.arg, err)
+			}
+			if service != tt.wantService || dest != tt.wantDest {
+				t.Errorf("parseCopyDest(%q) = %q, %q, want %q, %q", tt.arg, service, dest, tt.wantService, tt.wantDest)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+)
+
+var (
+	diffFiles  []string
+	diffFormat string
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff -f BASE -f OTHER [OPTIONS]",
+	Short: "Compare two stack files",
+	Long: `Compare the services, networks and volumes of two stack files.
+
+Entries are reported as added, removed or changed. For changed entries each
+differing field is shown with its old and new value, using the stack file's
+keys: nested fields such as environment variables and resources are compared
+one by one (environment.LOG_LEVEL, resources.memory), lists such as ports are
+compared as a whole. Includes are resolved before comparing.
+
+Use --format json for a machine-readable report.`,
+	Example: `  # Review what production changes compared to the base stack
+  pxc diff -f lxc-stack.yml -f lxc-stack.prod.yml
+
+  # Machine-readable report
+  pxc diff -f base.yml -f prod.yml --format json`,
+	Args: cobra.NoArgs,
+	RunE: runDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringArrayVarP(&diffFiles, "file", "f", []string{}, "Stack file to compare (give exactly two: base, then other)")
+	diffCmd.Flags().StringVar(&diffFormat, "format", "", "Output format (json)")
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	if diffFormat != "" && diffFormat != "json" {
+		return fmt.Errorf("unsupported format '%s' (supported: json)", diffFormat)
+	}
+	if len(diffFiles) != 2 {
+		return fmt.Errorf("diff needs exactly two stack files (-f BASE -f OTHER), got %d", len(diffFiles))
+	}
+
+	base, err := config.LoadLXCStack(diffFiles[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", diffFiles[0], err)
+	}
+	other, err := config.LoadLXCStack(diffFiles[1])
+	if err != nil {
+		return fmt.Errorf("%s: %w", diffFiles[1], err)
+	}
+
+	diff, err := config.DiffStacks(base, other)
+	if err != nil {
+		return err
+	}
+
+	if diffFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	printStackDiff(os.Stdout, diff)
+	return nil
+}
+
+// printStackDiff prints a stack diff for people: + added, - removed and
+// ~ changed entries, with the old and new value of each changed field
+func printStackDiff(w io.Writer, diff *config.StackDiff) {
+	if diff.Empty() {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+
+	sections := []struct {
+		title   string
+		entries []config.EntryDiff
+	}{
+		{"Services", diff.Services},
+		{"Networks", diff.Networks},
+		{"Volumes", diff.Volumes},
+	}
+	for _, section := range sections {
+		if len(section.entries) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", section.title)
+		for _, entry := range section.entries {
+			switch entry.Change {
+			case "added":
+				fmt.Fprintf(w, "  %s\n", color.GreenString("+ %s", entry.Name))
+			case "removed":
+				fmt.Fprintf(w, "  %s\n", color.RedString("- %s", entry.Name))
+			default:
+				fmt.Fprintf(w, "  %s\n", color.YellowString("~ %s", entry.Name))
+				for _, field := range entry.Fields {
+					fmt.Fprintf(w, "      %s: %s -> %s\n", field.Path, formatDiffValue(field.Old), formatDiffValue(field.New))
+				}
+			}
+		}
+	}
+}
+
+// formatDiffValue shows a field value as JSON, or (unset) if it is missing
+func formatDiffValue(value interface{}) string {
+	if value == nil {
+		return "(unset)"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fatih/color"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+)
+
+func TestPrintStackDiff(t *testing.T) {
+	originalNoColor := color.NoColor
+	defer func() { color.NoColor = originalNoColor }()
+	color.NoColor = true
+
+	diff := &config.StackDiff{
+		Services: []config.EntryDiff{
+			{Name: "cache", Change: "added"},
+			{Name: "web", Change: "changed", Fields: []config.FieldChange{
+				{Path: "template", Old: "nginx:1.24", New: "nginx:1.25"},
+				{Path: "environment.WORKERS", New: "4"},
+			}},
+		},
+		Volumes: []config.EntryDiff{{Name: "scratch", Change: "removed"}},
+	}
+
+	var buf bytes.Buffer
+	printStackDiff(&buf, diff)
+
+	expected := `Services:
+  + cache
+  ~ web
+      template: "nginx:1.24" -> "nginx:1.25"
+      environment.WORKERS: (unset) -> "4"
+Volumes:
+  - scratch
+`
+	if buf.String() != expected {
+		t.Errorf("printStackDiff() =\n%s\nwant\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	printStackDiff(&buf, &config.StackDiff{})
+	if buf.String() != "No differences\n" {
+		t.Errorf("printStackDiff() of an empty diff = %q", buf.String())
+	}
+}
@@ -1,20 +1,34 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/brynnjknight/proxer/internal/models"
 	"github.com/brynnjknight/proxer/pkg/config"
 	"github.com/brynnjknight/proxer/pkg/runner"
+	"github.com/brynnjknight/proxer/pkg/state"
 )
 
 var (
 	removeVolumes bool
 	removeOrphans bool
+	downForce     bool
+	downYes       bool
+	downKeepGoing bool
 	timeout       int
+	downOutput    string
 )
 
 // downCmd represents the down command
@@ -53,14 +67,19 @@ STOP SEQUENCE:
   3. database (stops last, ensures no active connections)
 
 TIMEOUT HANDLING:
-  • Each container gets timeout seconds to stop gracefully
-  • After timeout, containers are forcibly terminated
+  • Each container gets timeout seconds to stop gracefully (pct shutdown)
+  • After timeout, containers are forcibly stopped (pct stop) and listed
+    at the end, or under force_stopped with --output json
   • Database containers may need longer timeouts for clean shutdown
   • Use --timeout to adjust based on your application needs
 
 ORPHAN REMOVAL:
-  • --remove-orphans removes containers not defined in current stack
-  • Useful when services have been removed from lxc-stack.yml
+  • --remove-orphans removes containers not defined in current stack:
+    containers of services removed from lxc-stack.yml, replicas above a
+    service's scale, and containers tagged pxc-<project> that the project
+    state does not record
+  • The orphans are listed and confirmed before anything is torn down;
+    --force (or --yes) skips the question
   • Prevents accumulation of unused containers
 
 TROUBLESHOOTING:
@@ -80,6 +99,12 @@ TROUBLESHOOTING:
     → Check for external bridge dependencies
     → Manual cleanup may be required
 
+ERROR HANDLING:
+  Every container and volume is attempted even when one cannot be removed;
+  the failures are reported together at the end and pxc exits non-zero.
+  With --keep-going=false teardown stops at the first failure and reports
+  what was not attempted.
+
 RECOVERY:
   If down fails partially:
   • Use pxc ps to see remaining containers
@@ -89,15 +114,21 @@ RECOVERY:
 	Example: `  # Stop and remove containers (preserves volumes)
   pxc down
 
-  # Remove everything including volumes (DESTRUCTIVE)
+  # Remove everything including volumes (DESTRUCTIVE, asks first)
   pxc down --volumes
 
+  # Remove volumes without a prompt, e.g. in CI
+  pxc down --volumes --yes
+
   # Use custom stack file
   pxc down -f my-stack.yml
 
-  # Remove orphaned containers not in stack
+  # Remove orphaned containers not in stack (asks first)
   pxc down --remove-orphans
 
+  # Remove orphaned containers without a prompt
+  pxc down --remove-orphans --force
+
   # Increase stop timeout for databases
   pxc down --timeout 60
 
@@ -105,7 +136,7 @@ RECOVERY:
   pxc down --dry-run --verbose
 
   # Emergency cleanup (if normal down fails)
-  pxc down --timeout 5 --remove-orphans --volumes`,
+  pxc down --timeout 5 --remove-orphans --volumes --yes`,
 	RunE: runDown,
 }
 
@@ -117,10 +148,22 @@ func init() {
 	downCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
 	downCmd.Flags().BoolVar(&removeVolumes, "volumes", false, "Remove named volumes")
 	downCmd.Flags().BoolVar(&removeOrphans, "remove-orphans", false, "Remove containers not defined in stack")
-	downCmd.Flags().IntVarP(&timeout, "timeout", "t", 10, "Timeout in seconds for container stop")
+	downCmd.Flags().IntVarP(&timeout, "timeout", "t", 10, "Seconds each container gets to shut down before it is stopped forcibly (0 stops at once)")
+	downCmd.Flags().StringVarP(&downOutput, "output", "o", "", "Output format for the teardown report (json)")
+	downCmd.Flags().BoolVarP(&downYes, "yes", "y", false, "Remove volumes and orphaned containers without asking for confirmation")
+	downCmd.Flags().BoolVar(&downForce, "force", false, "Remove orphaned containers without asking for confirmation")
+	downCmd.Flags().BoolVar(&downKeepGoing, "keep-going", true, "Attempt every resource when one fails; --keep-going=false stops at the first error")
 }
 
 func runDown(cmd *cobra.Command, args []string) error {
+	if downOutput != "" && downOutput != "json" {
+		return fmt.Errorf("unsupported output format '%s' (supported: json)", downOutput)
+	}
+	jsonOutput := downOutput == "json"
+	if timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative")
+	}
+
 	// Determine stack file
 	if stackFile == "" {
 		stackFile = config.GetDefaultStackfile()
@@ -131,27 +174,51 @@ func runDown(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Load project config next to the stack file
+	if err := loadProjectConfig(stackFile); err != nil {
+		return err
+	}
+
 	// Determine project name
 	if projectName == "" {
 		projectName = getProjectNameFromPath(stackFile)
 	}
 
-	PrintInfo("Stopping stack: %s", projectName)
-	PrintInfo("Stack file: %s", stackFile)
+	if !jsonOutput {
+		PrintInfo("Stopping stack: %s", projectName)
+		PrintInfo("Stack file: %s", stackFile)
 
-	if removeVolumes {
-		PrintWarning("Volumes will be removed")
-	}
+		if removeVolumes {
+			PrintWarning("Volumes will be removed")
+		}
 
-	if IsVerbose() {
-		printDownSummary()
+		if IsVerbose() {
+			printDownSummary()
+		}
 	}
 
-	if IsDryRun() {
+	if IsDryRun() && !jsonOutput {
 		PrintWarning("Dry run mode - no actual removal will be performed")
 		return printDownDryRun()
 	}
 
+	if removeVolumes {
+		if err := confirmDestructive(fmt.Sprintf("remove the volumes of project '%s' and the data in them", projectName), downYes); err != nil {
+			return err
+		}
+	}
+
+	// Keep stdout clean for the JSON report
+	var progress io.Writer = os.Stdout
+	if jsonOutput {
+		progress = io.Discard
+	}
+
+	api, err := proxmoxAPI()
+	if err != nil {
+		return err
+	}
+
 	// Create orchestrator
 	orchestrator := runner.New(&runner.Config{
 		Verbose:         IsVerbose(),
@@ -161,27 +228,92 @@ func runDown(cmd *cobra.Command, args []string) error {
 		ProxmoxNode:     viper.GetString("proxmox_node"),
 		Storage:         viper.GetString("storage"),
 		TemplateStorage: viper.GetString("template_storage"),
+		StopTimeout:     time.Duration(timeout) * time.Second,
+		StopOnError:     !downKeepGoing,
+		Output:          progress,
+		API:             api,
 	})
 
-	// Stop the stack
-	if err := orchestrator.Down(stackFile, removeVolumes); err != nil {
+	// Orphans are found and confirmed before anything is torn down
+	var orphans []runner.Orphan
+	if removeOrphans {
+		orphans, err = orchestrator.FindOrphans(context.Background(), stackFile)
+		if err != nil {
+			return fmt.Errorf("failed to find orphaned containers: %w", err)
+		}
+		if len(orphans) > 0 {
+			if !jsonOutput {
+				printOrphans(os.Stdout, orphans)
+			}
+			action := fmt.Sprintf("destroy %d orphaned container(s) of project '%s'", len(orphans), projectName)
+			if err := confirmDestructive(action, downForce || downYes); err != nil {
+				return err
+			}
+		} else if !jsonOutput {
+			PrintInfo("No orphaned containers found")
+		}
+	}
+
+	// Stop the stack; Ctrl+C skips the services not yet removed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	result, err := orchestrator.Down(ctx, stackFile, removeVolumes)
+	stop()
+	if err != nil {
 		return fmt.Errorf("failed to stop stack: %w", err)
 	}
 
-	// Handle orphan removal if requested
-	if removeOrphans {
-		if err := removeOrphanedContainers(); err != nil {
-			PrintWarning("Failed to remove orphaned containers: %v", err)
+	// Remove the orphans, unless teardown stopped at an error
+	if len(orphans) > 0 && !downKeepGoing && len(result.Errors) > 0 {
+		result.Skipped = append(result.Skipped, "orphans")
+	} else if len(orphans) > 0 {
+		if err := orchestrator.RemoveOrphans(context.Background(), orphans, result); err != nil {
+			if !jsonOutput {
+				PrintWarning("Failed to remove orphaned containers: %v", err)
+			}
+			result.Errors = append(result.Errors, runner.TeardownError{Resource: "orphans", Error: err.Error()})
+		}
+	}
+
+	if jsonOutput {
+		if err := printDownJSON(os.Stdout, result); err != nil {
+			return err
 		}
 	}
 
-	PrintSuccess("Stack stopped successfully")
+	if len(result.ForceStopped) > 0 && !jsonOutput {
+		PrintWarning("Stopped forcibly after not shutting down within %ds: %s", timeout, strings.Join(result.ForceStopped, ", "))
+	}
+
+	// Every failure is named so a scripted teardown knows what is left
+	if err := result.Err(); err != nil {
+		return err
+	}
+
+	if !jsonOutput {
+		PrintSuccess("Stack stopped successfully")
+	}
 	return nil
 }
 
+// printDownJSON writes the teardown report as JSON
+func printDownJSON(w io.Writer, result *runner.DownResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// loadDownStack loads the stack pxc down tears down, as it was deployed
+func loadDownStack() (*models.LXCStack, error) {
+	projectState, err := state.Load(state.Path(filepath.Dir(stackFile), projectName), projectName)
+	if err != nil {
+		return nil, err
+	}
+	return loadProjectStack(projectState)
+}
+
 func printDownSummary() {
 	// Load stack to show summary
-	stack, err := config.LoadLXCStack(stackFile)
+	stack, err := loadDownStack()
 	if err != nil {
 		return
 	}
@@ -216,7 +348,7 @@ func printDownSummary() {
 
 func printDownDryRun() error {
 	// Load and validate stack
-	stack, err := config.LoadLXCStack(stackFile)
+	stack, err := loadDownStack()
 	if err != nil {
 		return err
 	}
@@ -274,13 +406,20 @@ func printDownDryRun() error {
 	return nil
 }
 
-func removeOrphanedContainers() error {
-	// TODO: Implement orphan container removal
-	// This would:
-	// 1. List all containers tagged with project name
-	// 2. Compare with containers defined in stack
-	// 3. Remove any that aren't defined
-
-	PrintInfo("Removing orphaned containers (placeholder)")
-	return nil
+// printOrphans lists the orphaned containers down is about to destroy
+func printOrphans(w io.Writer, orphans []runner.Orphan) {
+	fmt.Fprintf(w, "Orphaned containers not defined in the stack:\n")
+	for _, orphan := range orphans {
+		line := fmt.Sprintf("  %d", orphan.ContainerID)
+		if orphan.Name != "" {
+			line += " " + orphan.Name
+		}
+		if orphan.Key != "" {
+			line += fmt.Sprintf(" (recorded as %s)", orphan.Key)
+		}
+		if orphan.Node != "" {
+			line += " on node " + orphan.Node
+		}
+		fmt.Fprintln(w, line)
+	}
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -8,6 +10,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/runner"
 )
 
 func TestDownCommand(t *testing.T) {
@@ -492,4 +496,44 @@ services:
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestPrintDownJSON(t *testing.T) {
+	result := &runner.DownResult{
+		Stopped:         []string{"web", "cache"},
+		Removed:         []string{"web"},
+		VolumesRemoved:  []string{},
+		NetworksRemoved: []string{},
+		Errors: []runner.TeardownError{
+			{Resource: "cache", Error: "failed to destroy container 201: storage busy"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := printDownJSON(&buf, result); err != nil {
+		t.Fatalf("printDownJSON() unexpected error: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	for _, key := range []string{"stopped", "removed", "volumes_removed", "networks_removed", "errors"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("Expected key %q in output:\n%s", key, buf.String())
+		}
+	}
+
+	errs, ok := decoded["errors"].([]interface{})
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Expected one error entry, got %v", decoded["errors"])
+	}
+	entry := errs[0].(map[string]interface{})
+	if entry["resource"] != "cache" || !strings.Contains(entry["error"].(string), "storage busy") {
+		t.Errorf("Unexpected error entry: %v", entry)
+	}
+	if volumes, ok := decoded["volumes_removed"].([]interface{}); !ok || len(volumes) != 0 {
+		t.Errorf("Expected empty volumes_removed list, got %v", decoded["volumes_removed"])
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// enterShells are the shells tried by 'pxc enter', in order of preference
+var enterShells = []string{"/bin/bash", "/bin/sh"}
+
+var (
+	enterIndex      int
+	enterDetachKeys string
+
+	// containerUser and containerWorkdir are shared by enter and exec
+	containerUser    string
+	containerWorkdir string
+)
+
+// enterCmd represents the enter command
+var enterCmd = &cobra.Command{
+	Use:   "enter [OPTIONS] SERVICE",
+	Short: "Open an interactive root shell in a service container",
+	Long: `Open an interactive shell in a service's running container, as root
+unless --user is given.
+
+bash is used when the container has it, otherwise sh. This is a shortcut for
+running a shell with pct exec; exit the shell to return, or type the detach
+keys (default: ctrl-p,ctrl-q, see --detach-keys and the detach_keys setting)
+to leave it running in the background.
+
+The container is looked up from what 'pxc up' recorded for the project, so the
+service must have been deployed from the same stack file and project name.`,
+	Example: `  # Open a shell in the web service
+  pxc enter web
+
+  # Open a shell in the second replica of a scaled service
+  pxc enter worker --index 2
+
+  # Open a shell as the app user in the app directory
+  pxc enter web --user node --workdir /srv/app`,
+	Args: cobra.ExactArgs(1),
+	RunE: runEnter,
+}
+
+func init() {
+	rootCmd.AddCommand(enterCmd)
+
+	enterCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	enterCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	enterCmd.Flags().IntVar(&enterIndex, "index", 1, "Replica to enter for scaled services")
+	enterCmd.Flags().StringVarP(&containerUser, "user", "u", "", "User to run the shell as (default: root)")
+	enterCmd.Flags().StringVarP(&containerWorkdir, "workdir", "w", "", "Directory to start the shell in")
+	enterCmd.Flags().StringVar(&enterDetachKeys, "detach-keys", "", "Key sequence for detaching from the shell (default: ctrl-p,ctrl-q)")
+}
+
+func runEnter(cmd *cobra.Command, args []string) error {
+	if err := requirePCTTransport("enter"); err != nil {
+		return err
+	}
+	containerID, err := resolveServiceTarget(args[0], enterIndex)
+	if err != nil {
+		return err
+	}
+	_, keys, err := detachKeys(enterDetachKeys)
+	if err != nil {
+		return err
+	}
+
+	if IsDryRun() {
+		PrintInfo("DRY RUN: Would open a shell (%s) in container %d", strings.Join(enterShells, " or "), containerID)
+		return nil
+	}
+
+	shell, err := selectShell(containerID, func(path string) bool {
+		return proxmox.RunCommand(exec.Command("pct", "exec", strconv.Itoa(containerID), "--", "test", "-x", path)) == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if IsVerbose() {
+		PrintInfo("Entering container %d with %s", containerID, shell)
+	}
+
+	// The shell's exit status is the user's business, not an error
+	if _, err := runInContainer(containerExecArgs(containerID, nil, []string{shell, "-l"}), keys); err != nil {
+		return fmt.Errorf("failed to enter container %d: %w", containerID, err)
+	}
+	return nil
+}
+
+// containerExecArgs returns the pct arguments that run command in a container
+// with the --user and --workdir options and the given environment
+func containerExecArgs(containerID int, env []string, command []string) []string {
+	return proxmox.ExecArgs(containerID, proxmox.ExecOptions{User: containerUser, WorkDir: containerWorkdir, Env: env}, command)
+}
+
+// selectShell returns the first of enterShells that exists in the container
+func selectShell(containerID int, exists func(path string) bool) (string, error) {
+	for _, shell := range enterShells {
+		if exists(shell) {
+			return shell, nil
+		}
+	}
+	return "", fmt.Errorf("no shell found in container %d (tried %s); use 'pct exec %d -- <command>' to run a command directly",
+		containerID, strings.Join(enterShells, ", "), containerID)
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSelectShell(t *testing.T) {
+	tests := []struct {
+		name      string
+		available []string
+		expected  string
+		wantErr   bool
+	}{
+		{name: "bash preferred", available: []string{"/bin/sh", "/bin/bash"}, expected: "/bin/bash"},
+		{name: "falls back to sh", available: []string{"/bin/sh"}, expected: "/bin/sh"},
+		{name: "no shell", available: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var probed []string
+			shell, err := selectShell(342, func(path string) bool {
+				probed = append(probed, path)
+				for _, available := range tt.available {
+					if available == path {
+						return true
+					}
+				}
+				return false
+			})
+
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "no shell found in container 342") {
+					t.Errorf("selectShell() error = %v, want no shell found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectShell() unexpected error: %v", err)
+			}
+			if shell != tt.expected {
+				t.Errorf("selectShell() = %q, want %q", shell, tt.expected)
+			}
+			if probed[0] != "/bin/bash" {
+				t.Errorf("first probed shell = %q, want /bin/bash", probed[0])
+			}
+		})
+	}
+}
+
+func TestEnterArgs(t *testing.T) {
+	if err := enterCmd.Args(enterCmd, []string{}); err == nil {
+		t.Error("enter without a service should fail")
+	}
+	if err := enterCmd.Args(enterCmd, []string{"web"}); err != nil {
+		t.Errorf("enter web: unexpected error: %v", err)
+	}
+	if flag := enterCmd.Flags().Lookup("index"); flag == nil || flag.DefValue != "1" {
+		t.Error("enter should have an --index flag defaulting to 1")
+	}
+}
+
+func TestContainerExecArgs(t *testing.T) {
+	originalUser, originalWorkdir := containerUser, containerWorkdir
+	defer func() { containerUser, containerWorkdir = originalUser, originalWorkdir }()
+
+	// Same argv as a build run step produces for this user and workdir
+	expected := []string{"exec", "342", "--", "su", "-s", "/bin/sh", "node", "-c", "cd /srv/app && exec sh -c 'npm ci'"}
+
+	for _, command := range []*cobra.Command{execCmd, enterCmd} {
+		containerUser, containerWorkdir = "", ""
+		if err := command.ParseFlags([]string{"--user", "node", "--workdir", "/srv/app"}); err != nil {
+			t.Fatalf("%s: ParseFlags() unexpected error: %v", command.Name(), err)
+		}
+
+		got := containerExecArgs(342, nil, []string{"sh", "-c", "npm ci"})
+		if strings.Join(got, "|") != strings.Join(expected, "|") {
+			t.Errorf("%s: containerExecArgs() = %q, want %q", command.Name(), got, expected)
+		}
+	}
+}
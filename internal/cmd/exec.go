@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/terminal"
+)
+
+var (
+	execIndex      int
+	execEnv        []string
+	execDetachKeys string
+)
+
+// ExitError reports that a command run in a container exited with a
+// non-zero status; pxc exits with the same status
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.Code)
+}
+
+// runInContainer runs pct with the terminal's standard streams and returns
+// the exit status of the command it ran. When standard input is a terminal,
+// the session runs on a pseudo-terminal that watches for the detach keys;
+// a detached session reports status 0.
+var runInContainer = func(pctArgs []string, keys []byte) (int, error) {
+	command := exec.Command("pct", pctArgs...)
+
+	var err error
+	if fd := int(os.Stdin.Fd()); terminal.IsTerminal(fd) {
+		err = runInteractive(command, fd, keys)
+	} else {
+		command.Stdin = os.Stdin
+		command.Stdout = os.Stdout
+		command.Stderr = os.Stderr
+		err = proxmox.RunCommand(command)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 0, err
+	}
+	return 0, nil
+}
+
+// runInteractive runs an interactive pct session with the terminal on fd in
+// raw mode until it ends or the detach keys are typed. Detaching leaves pct
+// exec and the process in the container running, with their further output
+// discarded.
+func runInteractive(command *exec.Cmd, fd int, keys []byte) error {
+	restore, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	start := time.Now()
+	detached, err := terminal.RunPTY(command, os.Stdin, os.Stdout, keys)
+	proxmox.AuditCommand(command, start, err)
+	if detached {
+		// The terminal is still raw here, so end the line explicitly
+		fmt.Print("\r\n")
+		PrintInfo("Detached from the session; the command keeps running in the container")
+	}
+	return err
+}
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec [OPTIONS] SERVICE COMMAND [ARGS...]",
+	Short: "Run a command in a service container",
+	Long: `Run a command in a service's running container with pct exec.
+
+The command runs as root from / unless --user or --workdir is given; --env
+sets extra environment variables for it. Standard input, output and error are
+connected to the command, and pxc exits with the command's exit status, so
+scripts can branch on it. From a terminal, the command runs on a terminal
+too; type the detach keys (default: ctrl-p,ctrl-q, see --detach-keys and the
+detach_keys setting) to leave it running in the background, its further output
+discarded. Put options for pxc before the service name; everything after the
+command is passed to it.
+
+The container is looked up from what 'pxc up' recorded for the project, so the
+service must have been deployed from the same stack file and project name.`,
+	Example: `  # List the app directory of the web service
+  pxc exec web ls -la /srv/app
+
+  # Run database migrations as the app user from the app directory
+  pxc exec --user node --workdir /srv/app web npm run migrate
+
+  # Run the test suite with extra environment variables
+  pxc exec -e NODE_ENV=test -e CI=1 --workdir /srv/app web npm test
+
+  # Check the second replica of a scaled service
+  pxc exec --index 2 worker systemctl status worker`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runExec,
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	// Flags after the command belong to the command
+	execCmd.Flags().SetInterspersed(false)
+
+	execCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	execCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	execCmd.Flags().IntVar(&execIndex, "index", 1, "Replica to run the command in for scaled services")
+	execCmd.Flags().StringVarP(&containerUser, "user", "u", "", "User to run the command as (default: root)")
+	execCmd.Flags().StringVarP(&containerWorkdir, "workdir", "w", "", "Directory to run the command in")
+	execCmd.Flags().StringArrayVarP(&execEnv, "env", "e", []string{}, "Set an environment variable for the command (KEY=VALUE, can specify multiple)")
+	execCmd.Flags().StringVar(&execDetachKeys, "detach-keys", "", "Key sequence for detaching from an interactive command (default: ctrl-p,ctrl-q)")
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	if err := requirePCTTransport("exec"); err != nil {
+		return err
+	}
+	if err := validateExecEnv(execEnv); err != nil {
+		return err
+	}
+	_, keys, err := detachKeys(execDetachKeys)
+	if err != nil {
+		return err
+	}
+
+	containerID, err := resolveServiceTarget(args[0], execIndex)
+	if err != nil {
+		return err
+	}
+
+	pctArgs := containerExecArgs(containerID, execEnv, args[1:])
+	if IsDryRun() {
+		PrintInfo("DRY RUN: Would run: pct %s", strings.Join(pctArgs, " "))
+		return nil
+	}
+	if IsVerbose() {
+		PrintInfo("Executing: pct %s", strings.Join(pctArgs, " "))
+	}
+
+	code, err := runInContainer(pctArgs, keys)
+	if err != nil {
+		return fmt.Errorf("failed to run command in container %d: %w", containerID, err)
+	}
+	if code != 0 {
+		// The command reported its own failure; only pass on the status
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+// validateExecEnv checks that every --env value is KEY=VALUE
+func validateExecEnv(env []string) error {
+	for _, variable := range env {
+		if key, _, found := strings.Cut(variable, "="); !found || key == "" || strings.ContainsAny(key, " \t") {
+			return fmt.Errorf("invalid environment variable '%s', must be KEY=VALUE", variable)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/state"
+	"github.com/brynnjknight/proxer/pkg/terminal"
+)
+
+func TestRunExec(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lxc-stack.yml")
+	if err := os.WriteFile(path, []byte(`version: "1.0"
+services:
+  web:
+    template: "node:18"
+`), 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+	projectState := &state.ProjectState{
+		Project:  "shop",
+		Services: map[string]state.ServiceState{"web": {ContainerID: 342}},
+	}
+	if err := projectState.Save(state.Path(dir, "shop")); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	originalFile, originalProject, originalRun := stackFile, projectName, runInContainer
+	originalUser, originalWorkdir, originalEnv := containerUser, containerWorkdir, execEnv
+	defer func() {
+		stackFile, projectName, runInContainer = originalFile, originalProject, originalRun
+		containerUser, containerWorkdir, execEnv = originalUser, originalWorkdir, originalEnv
+		execDetachKeys = ""
+	}()
+	viper.SetDefault("detach_keys", terminal.DefaultDetachKeys)
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		expected []string
+		keys     []byte
+		errorMsg string
+	}{
+		{
+			name:     "env and workdir forwarded",
+			args:     []string{"-e", "NODE_ENV=test", "--env", "GREETING=hello world", "--workdir", "/srv/app", "web", "npm", "test"},
+			expected: []string{"exec", "342", "--", "sh", "-c", "cd /srv/app && exec env NODE_ENV=test 'GREETING=hello world' npm test"},
+		},
+		{
+			name:     "env without workdir",
+			args:     []string{"-e", "CI=1", "web", "printenv", "CI"},
+			expected: []string{"exec", "342", "--", "env", "CI=1", "printenv", "CI"},
+		},
+		{
+			name:     "failing command exit status",
+			args:     []string{"web", "false"},
+			exitCode: 3,
+			expected: []string{"exec", "342", "--", "false"},
+			errorMsg: "command exited with status 3",
+		},
+		{
+			name:     "invalid env",
+			args:     []string{"-e", "=oops", "web", "true"},
+			errorMsg: "invalid environment variable '=oops', must be KEY=VALUE",
+		},
+		{
+			name:     "detach keys",
+			args:     []string{"--detach-keys", "ctrl-x,q", "web", "sh"},
+			expected: []string{"exec", "342", "--", "sh"},
+			keys:     []byte{0x18, 'q'},
+		},
+		{
+			name:     "invalid detach keys",
+			args:     []string{"--detach-keys", "ab", "web", "sh"},
+			errorMsg: "invalid detach key 'ab'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackFile, projectName = path, "shop"
+			containerUser, containerWorkdir, execEnv, execDetachKeys = "", "", []string{}, ""
+			if err := execCmd.ParseFlags(tt.args); err != nil {
+				t.Fatalf("ParseFlags() unexpected error: %v", err)
+			}
+
+			var ran []string
+			var detach []byte
+			runInContainer = func(pctArgs []string, keys []byte) (int, error) {
+				ran, detach = pctArgs, keys
+				return tt.exitCode, nil
+			}
+
+			err := runExec(execCmd, execCmd.Flags().Args())
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Fatalf("runExec() error = %v, want %q", err, tt.errorMsg)
+				}
+			} else if err != nil {
+				t.Fatalf("runExec() unexpected error: %v", err)
+			}
+
+			if tt.exitCode != 0 {
+				var exitErr *ExitError
+				if !errors.As(err, &exitErr) || exitErr.Code != tt.exitCode {
+					t.Errorf("runExec() error = %#v, want ExitError with code %d", err, tt.exitCode)
+				}
+			}
+			if strings.Join(ran, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("pct args = %q, want %q", ran, tt.expected)
+			}
+			if tt.keys != nil && string(detach) != string(tt.keys) {
+				t.Errorf("detach keys = %q, want %q", detach, tt.keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+var (
+	logsFollow bool
+	logsTail   int
+)
+
+// logColors is the palette service log prefixes are colored from
+var logColors = []color.Attribute{
+	color.FgCyan,
+	color.FgYellow,
+	color.FgGreen,
+	color.FgMagenta,
+	color.FgBlue,
+	color.FgHiCyan,
+	color.FgHiYellow,
+	color.FgHiGreen,
+	color.FgHiMagenta,
+	color.FgHiBlue,
+}
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs [OPTIONS] [SERVICE...]",
+	Short: "Show logs from service containers",
+	Long: `Show the system journal of service containers (journalctl via pct exec).
+
+Without arguments, logs of every deployed service in the stack are shown.
+Each line is prefixed with the service (or replica) it came from. Prefixes
+are aligned and every service gets its own color, which stays the same from
+run to run; replicas of a service share the color. Use --no-color for plain
+prefixes.
+
+With --follow, a container that stops or restarts is waited for and its
+journal reattached once it runs again; a notice is printed in both cases.
+
+The containers are looked up from what 'pxc up' recorded for the project, so
+the services must have been deployed from the same stack file and project name.`,
+	Example: `  # Show recent logs of all services
+  pxc logs
+
+  # Follow the logs of two services
+  pxc logs --follow web worker
+
+  # Show the last 50 lines without colors
+  pxc logs --tail 50 --no-color`,
+	RunE: runLogs,
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	logsCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	logsCmd.Flags().BoolVar(&logsFollow, "follow", false, "Follow log output")
+	logsCmd.Flags().IntVarP(&logsTail, "tail", "n", 100, "Number of lines to show from the end of each log (0 for all)")
+}
+
+// logSource is a container whose logs are shown under a label
+type logSource struct {
+	Service     string
+	Label       string
+	ContainerID int
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	if err := requirePCTTransport("logs"); err != nil {
+		return err
+	}
+	stack, projectState, err := loadStackState()
+	if err != nil {
+		return err
+	}
+
+	sources, err := collectLogSources(stack, projectState, args)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		PrintInfo("No deployed services found (run 'pxc up' first)")
+		return nil
+	}
+
+	width := logLabelWidth(sources)
+
+	if IsDryRun() {
+		for _, source := range sources {
+			fmt.Printf("%sDRY RUN: Would show logs of container %d\n",
+				logPrefix(source.Label, source.Service, width), source.ContainerID)
+		}
+		return nil
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, len(sources))
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source logSource) {
+			defer wg.Done()
+			errs[i] = streamContainerLogs(os.Stdout, &mu, source, logPrefix(source.Label, source.Service, width))
+		}(i, source)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			PrintWarning("Failed to read logs of %s: %v", sources[i].Label, err)
+		}
+	}
+	return nil
+}
+
+// collectLogSources returns the deployed containers of the given services,
+// or of every service when none are given. Replicas of scaled services are
+// labelled service-N.
+func collectLogSources(stack *models.LXCStack, projectState *state.ProjectState, services []string) ([]logSource, error) {
+	if len(services) == 0 {
+		for name := range stack.Services {
+			services = append(services, name)
+		}
+		sort.Strings(services)
+	}
+
+	var sources []logSource
+	for _, name := range services {
+		service, exists := stack.Services[name]
+		if !exists {
+			return nil, fmt.Errorf("service '%s' is not defined in the stack", name)
+		}
+
+		replicas := service.Scale
+		if replicas < 1 {
+			replicas = 1
+		}
+		for index := 1; index <= replicas; index++ {
+			containerID, err := resolveServiceContainer(stack, projectState, name, index)
+			if err != nil {
+				continue
+			}
+			label := name
+			if replicas > 1 {
+				label = fmt.Sprintf("%s-%d", name, index)
+			}
+			sources = append(sources, logSource{Service: name, Label: label, ContainerID: containerID})
+		}
+	}
+	return sources, nil
+}
+
+// logLabelWidth returns the width prefixes are padded to
+func logLabelWidth(sources []logSource) int {
+	width := 0
+	for _, source := range sources {
+		if len(source.Label) > width {
+			width = len(source.Label)
+		}
+	}
+	return width
+}
+
+// serviceColor returns the prefix color of a service. The color depends only
+// on the service name, so it is the same on every run.
+func serviceColor(service string) *color.Color {
+	hash := fnv.New32a()
+	hash.Write([]byte(service))
+	return color.New(logColors[hash.Sum32()%uint32(len(logColors))])
+}
+
+// logPrefix returns the "label | " prefix for a log line, padded to width and
+// colored for the service unless colors are disabled
+func logPrefix(label, service string, width int) string {
+	return serviceColor(service).Sprintf("%-*s |", width, label) + " "
+}
+
+// streamContainerLogs copies a container's journal to w, prefixing each line.
+// When following, the stream is reattached after the container restarts.
+func streamContainerLogs(w io.Writer, mu *sync.Mutex, source logSource, prefix string) error {
+	if !logsFollow {
+		return runJournal(w, mu, source.ContainerID, prefix, time.Time{})
+	}
+
+	client := proxmox.NewClient(viper.GetString("proxmox_node"), IsVerbose(), IsDryRun())
+	follower := &logFollower{
+		containerID: source.ContainerID,
+		stream: func(since time.Time) error {
+			return runJournal(w, mu, source.ContainerID, prefix, since)
+		},
+		status: func(containerID int) (string, error) {
+			container, err := client.GetContainer(context.Background(), containerID)
+			if err != nil {
+				return "", err
+			}
+			return container.Status, nil
+		},
+		notice: func(message string) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(w, "%s(%s)\n", prefix, message)
+		},
+		sleep:    time.Sleep,
+		now:      time.Now,
+		interval: logsPollInterval,
+	}
+	return follower.run()
+}
+
+// journalArgs returns the pct arguments showing a container's journal: the
+// last --tail lines, or everything since a reconnect when since is set
+func journalArgs(containerID int, since time.Time) []string {
+	args := []string{"exec", strconv.Itoa(containerID), "--", "journalctl", "--no-pager"}
+	if !since.IsZero() {
+		args = append(args, "--since", "@"+strconv.FormatInt(since.Unix(), 10))
+	} else if logsTail > 0 {
+		args = append(args, "-n", strconv.Itoa(logsTail))
+	}
+	if logsFollow {
+		args = append(args, "-f")
+	}
+	return args
+}
+
+// runJournal copies a container's journal to w until journalctl exits
+func runJournal(w io.Writer, mu *sync.Mutex, containerID int, prefix string, since time.Time) error {
+	logs := exec.Command("pct", journalArgs(containerID, since)...)
+	stdout, err := logs.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := logs.Start(); err != nil {
+		proxmox.AuditCommand(logs, start, err)
+		return err
+	}
+	if err := prefixLines(w, mu, prefix, stdout); err != nil {
+		return err
+	}
+	err = logs.Wait()
+	proxmox.AuditCommand(logs, start, err)
+	return err
+}
+
+// logsPollInterval is how often a followed container's status is checked
+// while waiting for it to run again
+var logsPollInterval = 2 * time.Second
+
+// maxLogReconnects is how many times in a row the journal of a running
+// container may end before following gives up on it
+const maxLogReconnects = 3
+
+// logFollower follows a container's journal across restarts. When the
+// stream ends, the container's status is polled: a stopped container is
+// waited for, and once it runs again the stream is reattached from the time
+// it ended.
+type logFollower struct {
+	containerID int
+	stream      func(since time.Time) error
+	status      func(containerID int) (string, error)
+	notice      func(message string)
+	sleep       func(time.Duration)
+	now         func() time.Time
+	interval    time.Duration
+}
+
+// run follows the journal until the container no longer exists or its
+// journal keeps ending while it is running
+func (f *logFollower) run() error {
+	var since time.Time
+	failures := 0
+	for {
+		err := f.stream(since)
+		since = f.now()
+
+		restarted := false
+		for {
+			status, statusErr := f.status(f.containerID)
+			if statusErr != nil {
+				f.notice(fmt.Sprintf("container %d is gone, stopped following", f.containerID))
+				return nil
+			}
+			if status == "running" {
+				break
+			}
+			if !restarted {
+				f.notice(fmt.Sprintf("container %d is %s, waiting for it to restart", f.containerID, status))
+				restarted = true
+			}
+			f.sleep(f.interval)
+		}
+
+		// The journal ended although the container kept running
+		if !restarted {
+			failures++
+			if failures >= maxLogReconnects {
+				if err == nil {
+					err = fmt.Errorf("journal of container %d keeps ending", f.containerID)
+				}
+				return err
+			}
+			f.sleep(f.interval)
+		} else {
+			failures = 0
+		}
+
+		f.notice(fmt.Sprintf("container %d is running, reconnecting", f.containerID))
+	}
+}
+
+// prefixLines writes each line read from r to w with prefix. Lines are
+// written whole while holding mu, so concurrent streams do not interleave
+// within a line.
+func prefixLines(w io.Writer, mu *sync.Mutex, prefix string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := prefix + strings.TrimRight(scanner.Text(), "\r") + "\n"
+		mu.Lock()
+		_, err := io.WriteString(w, line)
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestServiceColorStable(t *testing.T) {
+	originalNoColor := color.NoColor
+	defer func() { color.NoColor = originalNoColor }()
+	color.NoColor = false
+
+	services := []string{"web", "database", "cache", "worker", "scheduler"}
+	seen := make(map[string]bool)
+	for _, service := range services {
+		first := logPrefix(service, service, 9)
+		second := logPrefix(service, service, 9)
+		if first != second {
+			t.Errorf("logPrefix(%q) changed between calls: %q vs %q", service, first, second)
+		}
+		if !strings.HasPrefix(first, "\x1b[") {
+			t.Errorf("logPrefix(%q) = %q, want a colored prefix", service, first)
+		}
+		seen[serviceColor(service).Sprint("x")] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("Expected services to get different colors, all got the same")
+	}
+
+	// Replicas share the color of their service
+	if logPrefix("web-1", "web", 5) != serviceColor("web").Sprint("web-1 |")+" " {
+		t.Errorf("Replica prefix does not use the service color")
+	}
+}
+
+func TestLogPrefixNoColor(t *testing.T) {
+	originalNoColor := color.NoColor
+	defer func() { color.NoColor = originalNoColor }()
+	color.NoColor = true
+
+	tests := []struct {
+		label    string
+		width    int
+		expected string
+	}{
+		{"web", 8, "web      | "},
+		{"database", 8, "database | "},
+		{"worker-2", 8, "worker-2 | "},
+	}
+
+	for _, tt := range tests {
+		if got := logPrefix(tt.label, tt.label, tt.width); got != tt.expected {
+			t.Errorf("logPrefix(%q, %d) = %q, want %q", tt.label, tt.width, got, tt.expected)
+		}
+	}
+}
+
+func TestPrefixLines(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	input := strings.NewReader("started\r\nlistening on :80\n")
+
+	if err := prefixLines(&buf, &mu, "web | ", input); err != nil {
+		t.Fatalf("prefixLines() unexpected error: %v", err)
+	}
+
+	expected := "web | started\nweb | listening on :80\n"
+	if buf.String() != expected {
+		t.Errorf("prefixLines() = %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestCollectLogSources(t *testing.T) {
+	stack := &models.LXCStack{
+		Services: map[string]models.Service{
+			"web":      {Template: "nginx:latest", Scale: 2},
+			"database": {Template: "postgres:15"},
+			"cache":    {Template: "redis:7"},
+		},
+	}
+	projectState := &state.ProjectState{
+		Services: map[string]state.ServiceState{
+			"web-1":    {ContainerID: 201},
+			"web-2":    {ContainerID: 202},
+			"database": {ContainerID: 210},
+		},
+	}
+
+	sources, err := collectLogSources(stack, projectState, nil)
+	if err != nil {
+		t.Fatalf("collectLogSources() unexpected error: %v", err)
+	}
+
+	var labels []string
+	for _, source := range sources {
+		labels = append(labels, source.Label)
+	}
+	if strings.Join(labels, ",") != "database,web-1,web-2" {
+		t.Errorf("labels = %v, want [database web-1 web-2]", labels)
+	}
+	if width := logLabelWidth(sources); width != len("database") {
+		t.Errorf("logLabelWidth() = %d, want %d", width, len("database"))
+	}
+
+	if _, err := collectLogSources(stack, projectState, []string{"missing"}); err == nil {
+		t.Error("Expected error for undefined service")
+	}
+}
+
+func TestLogFollowerReconnect(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	clock := start
+
+	var streams []time.Time
+	var notices []string
+	statuses := []string{"stopped", "stopped", "running"}
+	sleeps := 0
+
+	follower := &logFollower{
+		containerID: 301,
+		stream: func(since time.Time) error {
+			streams = append(streams, since)
+			clock = clock.Add(time.Minute)
+			return errors.New("exit status 255")
+		},
+		status: func(containerID int) (string, error) {
+			if len(statuses) == 0 {
+				return "", errors.New("container 301 not found")
+			}
+			status := statuses[0]
+			statuses = statuses[1:]
+			return status, nil
+		},
+		notice:   func(message string) { notices = append(notices, message) },
+		sleep:    func(time.Duration) { sleeps++ },
+		now:      func() time.Time { return clock },
+		interval: time.Second,
+	}
+
+	if err := follower.run(); err != nil {
+		t.Fatalf("run() unexpected error: %v", err)
+	}
+
+	// Attached with --tail first, then again from when the stream ended
+	if len(streams) != 2 || !streams[0].IsZero() || !streams[1].Equal(start.Add(time.Minute)) {
+		t.Errorf("streams since = %v, want [zero %v]", streams, start.Add(time.Minute))
+	}
+	expected := []string{
+		"container 301 is stopped, waiting for it to restart",
+		"container 301 is running, reconnecting",
+		"container 301 is gone, stopped following",
+	}
+	if strings.Join(notices, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("notices = %q, want %q", notices, expected)
+	}
+	if sleeps != 2 {
+		t.Errorf("slept %d times, want 2 while the container was stopped", sleeps)
+	}
+
+	t.Run("journal ending while running gives up", func(t *testing.T) {
+		streams, notices = nil, nil
+		follower.status = func(containerID int) (string, error) { return "running", nil }
+		err := follower.run()
+		if err == nil || err.Error() != "exit status 255" {
+			t.Fatalf("run() error = %v, want the journal error", err)
+		}
+		if len(streams) != maxLogReconnects {
+			t.Errorf("stream attached %d times, want %d", len(streams), maxLogReconnects)
+		}
+	})
+}
+
+func TestJournalArgs(t *testing.T) {
+	originalFollow, originalTail := logsFollow, logsTail
+	defer func() { logsFollow, logsTail = originalFollow, originalTail }()
+	logsFollow, logsTail = true, 50
+
+	got := strings.Join(journalArgs(301, time.Time{}), " ")
+	if got != "exec 301 -- journalctl --no-pager -n 50 -f" {
+		t.Errorf("journalArgs() = %q", got)
+	}
+	got = strings.Join(journalArgs(301, time.Unix(1700000060, 0)), " ")
+	if got != "exec 301 -- journalctl --no-pager --since @1700000060 -f" {
+		t.Errorf("journalArgs() after reconnect = %q", got)
+	}
+}
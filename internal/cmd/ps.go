@@ -1,17 +1,28 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/config"
 	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/runner"
+	"github.com/brynnjknight/proxer/pkg/state"
 )
 
 var (
@@ -20,6 +31,9 @@ var (
 	format     string
 	noTrunc    bool
 	filterTags []string
+	lastN      int
+
+	showServices bool
 )
 
 // psCmd represents the ps command
@@ -45,17 +59,49 @@ FILTERING:
   • tag=value: Filter by container labels/tags
   • name=pattern: Filter by name pattern
   • status=state: Filter by container status
+  Use --last N to show only the N most recently created containers,
+  newest first, after filters are applied.
 
 FORMAT OPTIONS:
-  --format supports Go template syntax with these fields:
+  --format wide adds the disk size, init PID and stack labels to the table.
+  Names, tags and labels are truncated in the table and templates unless
+  --no-trunc is given.
+
+  --format json and --format yaml print every field of each container for
+  automation, with sizes in bytes and uptime in seconds. They include the
+  CPU and memory usage of running containers, measured over half a second.
+
+  Containers recorded for the stack in the current directory (or -f) get
+  the labels pxc.project, pxc.service and pxc.replica.
+
+  --format also takes a Go template, executed for each container. Starting
+  it with "table " prints a header and aligns the columns. Fields:
   • {{.VMID}} - Container ID
   • {{.Name}} - Container name
   • {{.Status}} - Container status
   • {{.Uptime}} - Container uptime
-  • {{.Memory}} - Memory usage
-  • {{.CPU}} - CPU usage
+  • {{.CPUs}} - CPU cores
+  • {{.CPU}} - CPU usage, 100% being one core
+  • {{.Memory}} - Memory limit
+  • {{.MemoryUsage}} - Memory in use
+  • {{.Disk}} - Root disk size
+  • {{.PID}} - Init process ID
   • {{.Template}} - Source template
   • {{.Node}} - Proxmox node
+  • {{.Tags}} - Container tags
+  • {{.Labels}} - Container labels (key=value, comma-separated)
+  • {{.Project}}, {{.Service}} - Stack project and service
+  • {{.Label "key"}} - Value of one label
+
+SERVICES VIEW:
+  --services lists the services defined in the stack file instead of
+  containers, including services that have not been deployed:
+  • SERVICE: Service name from the stack file
+  • DESIRED: Replicas the stack asks for (scale)
+  • RUNNING: Replicas with a running container
+  • STATUS: running, partial, stopped or not deployed
+  • HEALTH: Result of the service's health check (- without one)
+  Use --format json or yaml for machine-readable output.
 
 STATUS VALUES:
   • running: Container is active and operational
@@ -65,15 +111,16 @@ STATUS VALUES:
   • error: Container in error state
 
 RESOURCE MONITORING:
-  The ps command shows real-time resource usage:
-  • Memory: Shows current/limit (e.g., "512MB/1024MB")
-  • CPU: Shows current usage percentage
-  • Uptime: Shows time since last start
+  The table shows each container's limits and uptime. Its CPU and memory
+  usage is in --format json and yaml, and in templates using {{.CPU}} or
+  {{.MemoryUsage}}. Use 'pxc stats' to watch the usage of stack services,
+  including network and block I/O.
 
 INTEGRATION:
   Output can be processed by other tools:
   • Use --quiet for container IDs only
-  • Use --format for custom output
+  • Use --format json or yaml for structured output
+  • Use --format with a template for custom output
   • Combine with shell tools: pxc ps --quiet | xargs pct stop
 
 TROUBLESHOOTING:
@@ -111,16 +158,27 @@ AUTOMATION:
   pxc ps --filter tag=production
 
   # Custom table format
-  pxc ps --format "table {{.VMID}}\t{{.Name}}\t{{.Status}}\t{{.Memory}}"
+  pxc ps --format "table {{.VMID}}\t{{.Name}}\t{{.Status}}\t{{.MemoryUsage}}"
+
+  # Structured output for automation
+  pxc ps --format json | jq '.[] | select(.labels["pxc.service"] == "web")'
+  pxc ps --format yaml
 
-  # JSON-like output for automation
-  pxc ps --format "{{.VMID}},{{.Name}},{{.Status}}"
+  # CSV-like output
+  pxc ps --format "{{.VMID}},{{.Name}},{{.Status}},{{.CPU}}"
+
+  # Show the containers from the latest deploy
+  pxc ps --last 3
 
   # Show full information without truncation
   pxc ps --no-trunc
 
+  # Show stack services and how many replicas are up
+  pxc ps --services
+  pxc ps --services --format json
+
   # Monitor specific project containers
-  pxc ps --filter tag=myproject --format "table {{.Name}}\t{{.Status}}\t{{.Uptime}}"`,
+  pxc ps --filter tag=myproject --format "table {{.Name}}\t{{.Service}}\t{{.Status}}\t{{.Uptime}}"`,
 	RunE: runPS,
 }
 
@@ -130,17 +188,37 @@ func init() {
 	// PS-specific flags
 	psCmd.Flags().BoolVarP(&showAll, "all", "a", false, "Show all containers (not just pxc-managed)")
 	psCmd.Flags().BoolVarP(&showQuiet, "quiet", "q", false, "Only display container IDs")
-	psCmd.Flags().StringVar(&format, "format", "", "Format output using a custom template")
+	psCmd.Flags().StringVar(&format, "format", "", "Format output: table, wide, json, yaml or a Go template")
 	psCmd.Flags().BoolVar(&noTrunc, "no-trunc", false, "Don't truncate output")
 	psCmd.Flags().StringSliceVar(&filterTags, "filter", []string{}, "Filter containers (e.g., tag=webapp)")
+	psCmd.Flags().IntVarP(&lastN, "last", "n", 0, "Show the N most recently created containers")
+	psCmd.Flags().BoolVar(&showServices, "services", false, "List stack services with desired and running replicas")
+	psCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file for --services (default: lxc-stack.yml)")
+	psCmd.Flags().StringVar(&projectName, "project-name", "", "Project name for --services (default: directory name)")
 }
 
 func runPS(cmd *cobra.Command, args []string) error {
+	if showServices {
+		return runPSServices()
+	}
+
+	api, err := proxmoxAPI()
+	if err != nil {
+		return err
+	}
+	if lastN > 0 && api != nil {
+		return fmt.Errorf("--last is not supported with --transport api, which does not report creation times")
+	}
+
 	// Create Proxmox client
 	client := proxmox.NewClient("", IsVerbose(), IsDryRun())
+	var lister containerLister = client
+	if api != nil {
+		lister = proxmox.NewAPIClient(viper.GetString("proxmox_node"), *api, IsVerbose(), IsDryRun())
+	}
 
 	// Get all containers
-	containers, err := client.ListContainers()
+	containers, err := lister.ListContainers()
 	if err != nil {
 		return fmt.Errorf("failed to list containers: %w", err)
 	}
@@ -153,6 +231,16 @@ func runPS(cmd *cobra.Command, args []string) error {
 	// Apply additional filters
 	containers = applyFilters(containers, filterTags)
 
+	if lastN < 0 {
+		return fmt.Errorf("--last must be a positive number")
+	}
+	if lastN > 0 {
+		if err := client.PopulateCreatedTimes(containers); err != nil {
+			return err
+		}
+		containers = lastCreated(containers, lastN)
+	}
+
 	// Handle quiet mode
 	if showQuiet {
 		for _, container := range containers {
@@ -161,13 +249,113 @@ func runPS(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	// Handle custom format
-	if format != "" {
-		return printCustomFormat(containers, format)
+	if format == "" || format == "table" {
+		return printContainerTable(os.Stdout, containers, false)
+	}
+
+	node := viper.GetString("proxmox_node")
+	if node == "" {
+		node, _ = proxmox.LocalNode()
+	}
+	for i := range containers {
+		containers[i].Node = node
+	}
+	if err := addStackLabels(containers); err != nil {
+		return err
+	}
+
+	// The API reports usage, disk sizes and PIDs along with the list
+	populateUsage := func() {
+		if api == nil {
+			client.PopulateUsage(containers, psSampleInterval)
+		}
+	}
+	if api == nil && (format == "wide" || format == "json" || format == "yaml" ||
+		strings.Contains(format, ".Disk}}") || strings.Contains(format, ".PID}}")) {
+		if err := client.PopulateDetails(containers); err != nil {
+			PrintWarning("Disk sizes and PIDs unavailable: %v", err)
+		}
+	}
+	switch format {
+	case "wide":
+		return printContainerTable(os.Stdout, containers, true)
+	case "json":
+		populateUsage()
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(nonNil(containers))
+	case "yaml":
+		populateUsage()
+		return yaml.NewEncoder(os.Stdout).Encode(nonNil(containers))
+	default:
+		if strings.Contains(format, ".CPU}}") || strings.Contains(format, ".MemoryUsage") {
+			populateUsage()
+		}
+		return printCustomFormat(os.Stdout, containers, format)
+	}
+}
+
+// containerLister lists the containers of a node with either transport
+type containerLister interface {
+	ListContainers() ([]proxmox.ContainerInfo, error)
+}
+
+// psSampleInterval is how long ps measures CPU usage over
+var psSampleInterval = 500 * time.Millisecond
+
+// nonNil returns an empty list instead of nil, so structured output prints
+// [] for no containers
+func nonNil(containers []proxmox.ContainerInfo) []proxmox.ContainerInfo {
+	if containers == nil {
+		return []proxmox.ContainerInfo{}
+	}
+	return containers
+}
+
+// Labels ps gives the containers recorded for the stack
+const (
+	labelProject = "pxc.project"
+	labelService = "pxc.service"
+	labelReplica = "pxc.replica"
+)
+
+// addStackLabels labels the containers recorded for the stack in the
+// working directory, or the one given with -f, with their project, service
+// and replica. Without a stack file the containers are left as they are.
+func addStackLabels(containers []proxmox.ContainerInfo) error {
+	if stackFile == "" {
+		if _, err := os.Stat(config.GetDefaultStackfile()); err != nil {
+			return nil
+		}
+	}
+	stack, projectState, err := loadStackState()
+	if err != nil {
+		return err
 	}
 
-	// Default table format
-	return printContainerTable(containers)
+	owners := make(map[int]map[string]string)
+	for name, service := range stack.Services {
+		for index := 1; index <= max(service.Scale, 1); index++ {
+			containerID, err := resolveServiceContainer(stack, projectState, name, index)
+			if err != nil {
+				continue
+			}
+			owners[containerID] = map[string]string{
+				labelProject: projectState.Project,
+				labelService: name,
+				labelReplica: strconv.Itoa(index),
+			}
+		}
+	}
+	for i := range containers {
+		for key, value := range owners[containers[i].VMID] {
+			if containers[i].Labels == nil {
+				containers[i].Labels = make(map[string]string)
+			}
+			containers[i].Labels[key] = value
+		}
+	}
+	return nil
 }
 
 // applyFilters applies tag and other filters to the container list
@@ -214,8 +402,23 @@ func applyFilters(containers []proxmox.ContainerInfo, filters []string) []proxmo
 	return filtered
 }
 
-// printContainerTable prints containers in a table format
-func printContainerTable(containers []proxmox.ContainerInfo) error {
+// lastCreated returns the n most recently created containers, newest first.
+// Containers without a known creation time sort last.
+func lastCreated(containers []proxmox.ContainerInfo, n int) []proxmox.ContainerInfo {
+	sorted := make([]proxmox.ContainerInfo, len(containers))
+	copy(sorted, containers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedTime.After(sorted[j].CreatedTime)
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// printContainerTable prints containers in a table format; wide adds the
+// disk size, init PID and labels
+func printContainerTable(out io.Writer, containers []proxmox.ContainerInfo, wide bool) error {
 	if len(containers) == 0 {
 		if !showAll {
 			PrintInfo("No pxc-managed containers found. Use --all to see all containers.")
@@ -226,11 +429,15 @@ func printContainerTable(containers []proxmox.ContainerInfo) error {
 	}
 
 	// Create tabwriter for aligned output
-	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
 	defer w.Flush()
 
 	// Print header
-	fmt.Fprintln(w, "CONTAINER ID\tNAME\tSTATUS\tCPUS\tMEMORY\tUPTIME\tTAGS")
+	header := "CONTAINER ID\tNAME\tSTATUS\tCPUS\tMEMORY\tUPTIME\tTAGS"
+	if wide {
+		header += "\tDISK\tPID\tLABELS"
+	}
+	fmt.Fprintln(w, header)
 
 	// Print containers
 	for _, container := range containers {
@@ -240,39 +447,142 @@ func printContainerTable(containers []proxmox.ContainerInfo) error {
 		uptime := formatUptime(container.Uptime)
 		tags := formatTags(container.Tags)
 
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s",
 			container.VMID,
-			truncateStringPS(container.Name, 20),
+			psTrunc(container.Name, psNameWidth),
 			status,
 			cpus,
 			memory,
 			uptime,
 			tags,
 		)
+		if wide {
+			pid := "-"
+			if container.PID > 0 {
+				pid = strconv.Itoa(container.PID)
+			}
+			fmt.Fprintf(w, "\t%s\t%s\t%s", formatMemory(container.Disk), pid, formatLabels(container.Labels))
+		}
+		fmt.Fprintln(w)
 	}
 
 	return nil
 }
 
-// printCustomFormat prints containers using a custom format template
-func printCustomFormat(containers []proxmox.ContainerInfo, format string) error {
-	// Simple template replacement - could be enhanced with proper templating
+// psRow is a container as --format templates see it, each field formatted
+// as in the table
+type psRow struct {
+	VMID        string
+	Name        string
+	Status      string
+	Uptime      string
+	CPUs        string
+	CPU         string
+	Memory      string
+	MemoryUsage string
+	Disk        string
+	PID         string
+	Template    string
+	Node        string
+	Tags        string
+	Labels      string
+	Project     string
+	Service     string
+
+	labels map[string]string
+}
+
+// Label returns the value of a container label, empty if it is not set
+func (r psRow) Label(key string) string {
+	return r.labels[key]
+}
+
+// psHeader is the header row of a "table" template
+var psHeader = psRow{
+	VMID:        "CONTAINER ID",
+	Name:        "NAME",
+	Status:      "STATUS",
+	Uptime:      "UPTIME",
+	CPUs:        "CPUS",
+	CPU:         "CPU %",
+	Memory:      "MEMORY",
+	MemoryUsage: "MEM USAGE",
+	Disk:        "DISK",
+	PID:         "PID",
+	Template:    "TEMPLATE",
+	Node:        "NODE",
+	Tags:        "TAGS",
+	Labels:      "LABELS",
+	Project:     "PROJECT",
+	Service:     "SERVICE",
+}
+
+// newPSRow formats a container for templates
+func newPSRow(container proxmox.ContainerInfo) psRow {
+	row := psRow{
+		VMID:        strconv.Itoa(container.VMID),
+		Name:        psTrunc(container.Name, psNameWidth),
+		Status:      container.Status,
+		Uptime:      formatUptime(container.Uptime),
+		CPUs:        formatCPUs(container.CPUs),
+		CPU:         "-",
+		Memory:      formatMemory(container.Memory),
+		MemoryUsage: formatMemory(container.MemoryUsage),
+		Disk:        formatMemory(container.Disk),
+		PID:         "-",
+		Template:    orDash(container.Template),
+		Node:        orDash(container.Node),
+		Tags:        formatTags(container.Tags),
+		Labels:      formatLabels(container.Labels),
+		Project:     orDash(container.Labels[labelProject]),
+		Service:     orDash(container.Labels[labelService]),
+		labels:      container.Labels,
+	}
+	if container.Status == "running" {
+		row.CPU = fmt.Sprintf("%.1f%%", container.CPUUsage)
+	}
+	if container.PID > 0 {
+		row.PID = strconv.Itoa(container.PID)
+	}
+	return row
+}
+
+// orDash returns s, or - if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// printCustomFormat prints containers with a Go template, one line each. A
+// template starting with "table " also prints a header and aligns columns.
+// Names and tags are truncated as in the table unless --no-trunc is given.
+func printCustomFormat(out io.Writer, containers []proxmox.ContainerInfo, format string) error {
+	format = strings.ReplaceAll(format, "\\t", "\t")
+	format = strings.ReplaceAll(format, "\\n", "\n")
+	text, table := strings.CutPrefix(format, "table ")
+
+	tmpl, err := template.New("format").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid --format template: %w", err)
+	}
+
+	w := out
+	if table {
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		defer tw.Flush()
+		w = tw
+		if err := tmpl.Execute(w, psHeader); err != nil {
+			return fmt.Errorf("failed to format header: %w", err)
+		}
+		fmt.Fprintln(w)
+	}
 	for _, container := range containers {
-		output := format
-		output = strings.ReplaceAll(output, "{{.VMID}}", strconv.Itoa(container.VMID))
-		output = strings.ReplaceAll(output, "{{.Name}}", container.Name)
-		output = strings.ReplaceAll(output, "{{.Status}}", container.Status)
-		output = strings.ReplaceAll(output, "{{.CPUs}}", formatCPUs(container.CPUs))
-		output = strings.ReplaceAll(output, "{{.Memory}}", formatMemory(container.Memory))
-		output = strings.ReplaceAll(output, "{{.Uptime}}", formatUptime(container.Uptime))
-		output = strings.ReplaceAll(output, "{{.Tags}}", container.Tags)
-		output = strings.ReplaceAll(output, "\\t", "\t")
-		output = strings.ReplaceAll(output, "\\n", "\n")
-
-		// Handle table prefix
-		output = strings.TrimPrefix(output, "table ")
-
-		fmt.Println(output)
+		if err := tmpl.Execute(w, newPSRow(container)); err != nil {
+			return fmt.Errorf("failed to format container %d: %w", container.VMID, err)
+		}
+		fmt.Fprintln(w)
 	}
 	return nil
 }
@@ -352,18 +662,178 @@ func formatTags(tags string) string {
 	if tags == "" {
 		return "-"
 	}
+	return psTrunc(tags, psTagsWidth)
+}
 
-	if !noTrunc && len(tags) > 20 {
-		return tags[:17] + "..."
+// formatLabels formats labels as sorted key=value pairs and truncates them
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
 	}
-
-	return tags
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return psTrunc(strings.Join(pairs, ","), psLabelsWidth)
 }
 
-// truncateStringPS truncates a string to maxLen characters (ps-specific version)
-func truncateStringPS(s string, maxLen int) string {
-	if noTrunc || len(s) <= maxLen {
+// Widths ps truncates fields to unless --no-trunc is given
+const (
+	psNameWidth   = 20
+	psTagsWidth   = 20
+	psLabelsWidth = 40
+)
+
+// psTrunc truncates a ps field to width characters unless --no-trunc is
+// given. Every ps output path truncates through it.
+func psTrunc(s string, width int) string {
+	if noTrunc || len(s) <= width {
 		return s
 	}
-	return s[:maxLen-3] + "..."
+	return s[:width-3] + "..."
+}
+
+// ServiceStatus summarises the deployment of a stack service
+type ServiceStatus struct {
+	Service    string `json:"service" yaml:"service"`
+	Desired    int    `json:"desired" yaml:"desired"`
+	Running    int    `json:"running" yaml:"running"`
+	Containers []int  `json:"containers" yaml:"containers"`
+	Status     string `json:"status" yaml:"status"` // running, partial, stopped or not deployed
+	Health     string `json:"health" yaml:"health"` // healthy, unhealthy or - without a health check
+}
+
+// runPSServices lists the services of the stack with their deploy status
+func runPSServices() error {
+	if format != "" && format != "table" && format != "json" && format != "yaml" {
+		return fmt.Errorf("unsupported format '%s' for --services (supported: table, json, yaml)", format)
+	}
+
+	stack, projectState, err := loadStackState()
+	if err != nil {
+		return err
+	}
+
+	api, err := proxmoxAPI()
+	if err != nil {
+		return err
+	}
+	var client containerLister = proxmox.NewClient(viper.GetString("proxmox_node"), IsVerbose(), IsDryRun())
+	if api != nil {
+		client = proxmox.NewAPIClient(viper.GetString("proxmox_node"), *api, IsVerbose(), IsDryRun())
+	}
+	containers, err := client.ListContainers()
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	live := make(map[int]string, len(containers))
+	for _, container := range containers {
+		live[container.VMID] = container.Status
+	}
+
+	var probe func(containerID int, health *models.HealthCheck) error
+	if !IsDryRun() {
+		orchestrator := runner.New(&runner.Config{
+			ProxmoxNode: viper.GetString("proxmox_node"),
+			API:         api,
+			Output:      io.Discard,
+		})
+		probe = func(containerID int, health *models.HealthCheck) error {
+			return orchestrator.CheckHealth(context.Background(), containerID, health)
+		}
+	}
+
+	statuses := collectServiceStatuses(stack, projectState, live, probe)
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	}
+	if format == "yaml" {
+		return yaml.NewEncoder(os.Stdout).Encode(statuses)
+	}
+	return printServiceStatuses(os.Stdout, statuses)
+}
+
+// collectServiceStatuses maps each service of the stack to its recorded
+// containers and their live status. live holds the status of every existing
+// container by ID. Running replicas of services with a health check are
+// probed with probe; a nil probe skips health checks.
+func collectServiceStatuses(stack *models.LXCStack, projectState *state.ProjectState, live map[int]string,
+	probe func(containerID int, health *models.HealthCheck) error) []ServiceStatus {
+	names := make([]string, 0, len(stack.Services))
+	for name := range stack.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := make([]ServiceStatus, 0, len(names))
+	for _, name := range names {
+		service := stack.Services[name]
+		status := ServiceStatus{Service: name, Desired: service.Scale, Containers: []int{}, Health: "-"}
+		if status.Desired < 1 {
+			status.Desired = 1
+		}
+
+		var running []int
+		for index := 1; index <= status.Desired; index++ {
+			containerID, err := resolveServiceContainer(stack, projectState, name, index)
+			if err != nil {
+				continue
+			}
+			containerStatus, exists := live[containerID]
+			if !exists {
+				continue
+			}
+			status.Containers = append(status.Containers, containerID)
+			if containerStatus == "running" {
+				running = append(running, containerID)
+			}
+		}
+		status.Running = len(running)
+
+		switch {
+		case len(status.Containers) == 0:
+			status.Status = "not deployed"
+		case status.Running == 0:
+			status.Status = "stopped"
+		case status.Running < status.Desired:
+			status.Status = "partial"
+		default:
+			status.Status = "running"
+		}
+
+		if service.Health != nil && probe != nil && len(running) > 0 {
+			status.Health = "healthy"
+			for _, containerID := range running {
+				if err := probe(containerID, service.Health); err != nil {
+					status.Health = "unhealthy"
+					break
+				}
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// printServiceStatuses writes the services table
+func printServiceStatuses(w io.Writer, statuses []ServiceStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tDESIRED\tRUNNING\tCONTAINERS\tSTATUS\tHEALTH")
+	for _, status := range statuses {
+		containers := "-"
+		if len(status.Containers) > 0 {
+			ids := make([]string, len(status.Containers))
+			for i, id := range status.Containers {
+				ids[i] = strconv.Itoa(id)
+			}
+			containers = strings.Join(ids, ",")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n",
+			status.Service, status.Desired, status.Running, containers, status.Status, status.Health)
+	}
+	return tw.Flush()
 }
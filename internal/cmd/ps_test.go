@@ -1,13 +1,21 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
 )
 
 func TestPsCommand(t *testing.T) {
@@ -596,4 +604,213 @@ services:
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestCollectServiceStatuses(t *testing.T) {
+	stack := &models.LXCStack{
+		Services: map[string]models.Service{
+			"web":      {Template: "nginx:latest", Scale: 3, Health: &models.HealthCheck{TCPPort: 80}},
+			"database": {Template: "postgres:15", Health: &models.HealthCheck{Test: "pg_isready"}},
+			"cache":    {Template: "redis:7"},
+			"worker":   {Template: "alpine:3.19"},
+		},
+	}
+	projectState := &state.ProjectState{
+		Project: "shop",
+		Services: map[string]state.ServiceState{
+			"web-1":    {ContainerID: 201},
+			"web-2":    {ContainerID: 202},
+			"web-3":    {ContainerID: 203}, // recorded but destroyed outside pxc
+			"database": {ContainerID: 210},
+			"worker":   {ContainerID: 220},
+		},
+	}
+	live := map[int]string{201: "running", 202: "running", 210: "running", 220: "stopped"}
+
+	probe := func(containerID int, health *models.HealthCheck) error {
+		if containerID == 210 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	statuses := collectServiceStatuses(stack, projectState, live, probe)
+
+	expected := []ServiceStatus{
+		{Service: "cache", Desired: 1, Running: 0, Containers: []int{}, Status: "not deployed", Health: "-"},
+		{Service: "database", Desired: 1, Running: 1, Containers: []int{210}, Status: "running", Health: "unhealthy"},
+		{Service: "web", Desired: 3, Running: 2, Containers: []int{201, 202}, Status: "partial", Health: "healthy"},
+		{Service: "worker", Desired: 1, Running: 0, Containers: []int{220}, Status: "stopped", Health: "-"},
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("collectServiceStatuses() =\n%+v\nwant\n%+v", statuses, expected)
+	}
+
+	var buf bytes.Buffer
+	if err := printServiceStatuses(&buf, statuses); err != nil {
+		t.Fatalf("printServiceStatuses() unexpected error: %v", err)
+	}
+	for _, want := range []string{"SERVICE", "not deployed", "201,202", "partial"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in table output:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestLastCreated(t *testing.T) {
+	now := time.Now()
+	containers := []proxmox.ContainerInfo{
+		{VMID: 100, Name: "old", CreatedTime: now.Add(-72 * time.Hour)},
+		{VMID: 101, Name: "unknown"},
+		{VMID: 102, Name: "newest", CreatedTime: now.Add(-time.Minute)},
+		{VMID: 103, Name: "recent", CreatedTime: now.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		n        int
+		expected []int
+	}{
+		{name: "limit to latest", n: 2, expected: []int{102, 103}},
+		{name: "unknown creation time sorts last", n: 4, expected: []int{102, 103, 100, 101}},
+		{name: "more than available", n: 10, expected: []int{102, 103, 100, 101}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, container := range lastCreated(containers, tt.n) {
+				got = append(got, container.VMID)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("lastCreated(%d) = %v, want %v", tt.n, got, tt.expected)
+			}
+		})
+	}
+
+	if containers[0].VMID != 100 {
+		t.Error("lastCreated() reordered its input")
+	}
+}
+
+func TestPsNoTrunc(t *testing.T) {
+	containers := []proxmox.ContainerInfo{{
+		VMID:   342,
+		Name:   "shop-production-frontend-web-1",
+		Status: "running",
+		Tags:   "pxc;shop;frontend;production",
+		Labels: map[string]string{"com.example.team": "storefront", "com.example.tier": "frontend"},
+	}}
+	fullLabels := "com.example.team=storefront,com.example.tier=frontend"
+
+	outputs := map[string]func(w *bytes.Buffer) error{
+		"table": func(w *bytes.Buffer) error { return printContainerTable(w, containers, false) },
+		"wide":  func(w *bytes.Buffer) error { return printContainerTable(w, containers, true) },
+		"custom": func(w *bytes.Buffer) error {
+			return printCustomFormat(w, containers, "{{.Name}} {{.Tags}} {{.Labels}}")
+		},
+	}
+
+	original := noTrunc
+	defer func() { noTrunc = original }()
+
+	for name, write := range outputs {
+		t.Run(name, func(t *testing.T) {
+			noTrunc = false
+			var truncated bytes.Buffer
+			if err := write(&truncated); err != nil {
+				t.Fatalf("print unexpected error: %v", err)
+			}
+			if strings.Contains(truncated.String(), containers[0].Name) {
+				t.Errorf("name not truncated without --no-trunc:\n%s", truncated.String())
+			}
+			if !strings.Contains(truncated.String(), "shop-production-f...") {
+				t.Errorf("expected truncated name, got:\n%s", truncated.String())
+			}
+
+			noTrunc = true
+			var full bytes.Buffer
+			if err := write(&full); err != nil {
+				t.Fatalf("print unexpected error: %v", err)
+			}
+			want := []string{containers[0].Name, containers[0].Tags}
+			if name != "table" {
+				want = append(want, fullLabels)
+			}
+			for _, value := range want {
+				if !strings.Contains(full.String(), value) {
+					t.Errorf("--no-trunc output missing %q:\n%s", value, full.String())
+				}
+			}
+			if strings.Contains(full.String(), "...") {
+				t.Errorf("--no-trunc output still truncated:\n%s", full.String())
+			}
+		})
+	}
+}
+
+func TestPsTemplateFormat(t *testing.T) {
+	containers := []proxmox.ContainerInfo{
+		{
+			VMID:        201,
+			Name:        "shop-web-1",
+			Status:      "running",
+			CPUUsage:    12.5,
+			MemoryUsage: 256 << 20,
+			Labels:      map[string]string{labelProject: "shop", labelService: "web", labelReplica: "1"},
+		},
+		{VMID: 202, Name: "scratch", Status: "stopped"},
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "lines",
+			format: `{{.VMID}},{{.Service}},{{.CPU}},{{.MemoryUsage}}`,
+			want:   "201,web,12.5%,256MB\n202,-,-,-\n",
+		},
+		{
+			name:   "table",
+			format: `table {{.VMID}}\t{{.Project}}\t{{.Status}}`,
+			want:   "CONTAINER ID  PROJECT  STATUS\n201           shop     running\n202           -        stopped\n",
+		},
+		{
+			name:   "label",
+			format: `{{.Name}} {{.Label "pxc.replica"}}`,
+			want:   "shop-web-1 1\nscratch \n",
+		},
+		{
+			name:    "invalid template",
+			format:  `{{.Name`,
+			wantErr: "invalid --format template",
+		},
+		{
+			name:    "unknown field",
+			format:  `{{.Size}}`,
+			wantErr: "failed to format container 201",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := printCustomFormat(&out, containers, tt.format)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("printCustomFormat() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("printCustomFormat() unexpected error: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("printCustomFormat() =\n%q\nwant\n%q", out.String(), tt.want)
+			}
+		})
+	}
+}
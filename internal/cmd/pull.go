@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/registry"
+)
+
+var pullVMID int
+
+// pullCmd represents the pull command
+var pullCmd = &cobra.Command{
+	Use:   "pull NAME[:TAG]",
+	Short: "Pull a template from the template registry",
+	Long: `Pull downloads a template pushed with 'pxc push' and restores it as a
+container template on this node (default tag: latest).
+
+The archive is checked against the digest in the registry's manifest before
+it is restored to the configured storage. The template gets the next free
+container ID, or the one given with --vmid; use --vmid to give a template
+the same ID on every node, so stacks can refer to it as template: "ID".
+
+The registry is configured as for 'pxc push'.`,
+	Example: `  # Pull a template
+  pxc pull myapp:1.2
+
+  # Pull it to a fixed container ID
+  pxc pull myapp:1.2 --vmid 9001`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPull,
+}
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+
+	pullCmd.Flags().StringVar(&registryLocation, "registry", "", "Template registry to pull from (overrides config)")
+	pullCmd.Flags().IntVar(&pullVMID, "vmid", 0, "Container ID for the template (default: next free ID)")
+}
+
+func runPull(cmd *cobra.Command, args []string) error {
+	name, tag, err := registry.ParseReference(args[0])
+	if err != nil {
+		return err
+	}
+	if pullVMID != 0 && pullVMID < 100 {
+		return fmt.Errorf("invalid --vmid %d: container IDs start at 100", pullVMID)
+	}
+	location := registryLocationSetting()
+
+	if IsDryRun() {
+		PrintInfo("DRY RUN: Would pull %s:%s from %s and restore it as a template", name, tag, location)
+		return nil
+	}
+
+	store, err := registry.Open(location)
+	if err != nil {
+		return err
+	}
+	reg := registry.New(store)
+	manifest, err := reg.Manifest(name, tag)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "pxc-pull-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	PrintInfo("Downloading %s:%s (%s)", name, tag, formatMemory(manifest.Size))
+	archive := filepath.Join(dir, path.Base(manifest.Archive))
+	if err := reg.Download(manifest, archive); err != nil {
+		return err
+	}
+
+	storage := viper.GetString("storage")
+	if storage == "" {
+		storage = "local-lvm"
+	}
+	vmid, err := registry.NewTemplates(storage, IsVerbose(), os.Stdout).Import(archive, pullVMID)
+	if err != nil {
+		return err
+	}
+	PrintSuccess("Pulled %s:%s as template %d", name, tag, vmid)
+	PrintInfo("Use it in a stack with template: \"%d\"", vmid)
+	return nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/registry"
+)
+
+var registryLocation string
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push TEMPLATE NAME[:TAG]",
+	Short: "Push a built template to the template registry",
+	Long: `Push exports a template container with vzdump and uploads the archive
+to the template registry as NAME:TAG (default tag: latest), so other nodes
+can 'pxc pull' it instead of building it again.
+
+TEMPLATE is the container ID of the template, as printed by 'pxc build'.
+The archive is written to a temporary directory first ($TMPDIR, default
+/tmp), which needs room for it. It is uploaded before the manifest that
+tags it, so an interrupted push leaves the previous NAME:TAG in place.
+
+REGISTRY:
+  The registry is the 'registry' setting in .pxc.yaml, PXC_REGISTRY or
+  --registry:
+    /mnt/pve/shared/pxc-registry   directory, e.g. storage shared by the nodes
+    ssh://root@pve2/var/lib/pxc    directory on another node, over ssh
+    https://registry.example.com   server accepting GET and PUT; set
+                                   PXC_REGISTRY_TOKEN for a bearer token
+    s3://bucket/prefix             S3 bucket; credentials from
+                                   AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+                                   AWS_REGION and AWS_ENDPOINT_URL`,
+	Example: `  # Build a template and push it
+  pxc build -t myapp:1.2
+  pxc push 9001 myapp:1.2
+
+  # Push to a registry not in the config file
+  pxc push 9001 myapp:1.2 --registry s3://templates/pxc`,
+	Args: cobra.ExactArgs(2),
+	RunE: runPush,
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+
+	pushCmd.Flags().StringVar(&registryLocation, "registry", "", "Template registry to push to (overrides config)")
+}
+
+func runPush(cmd *cobra.Command, args []string) error {
+	vmid, err := strconv.Atoi(args[0])
+	if err != nil || vmid < 100 {
+		return fmt.Errorf("invalid template '%s': give the container ID of the template", args[0])
+	}
+	name, tag, err := registry.ParseReference(args[1])
+	if err != nil {
+		return err
+	}
+	location := registryLocationSetting()
+
+	if IsDryRun() {
+		PrintInfo("DRY RUN: Would export template %d and push it as %s:%s to %s", vmid, name, tag, location)
+		return nil
+	}
+
+	store, err := registry.Open(location)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "pxc-push-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	PrintInfo("Exporting template %d", vmid)
+	templates := registry.NewTemplates(viper.GetString("storage"), IsVerbose(), os.Stdout)
+	archive, manifest, err := templates.Export(vmid, dir)
+	if err != nil {
+		return err
+	}
+
+	PrintInfo("Pushing %s:%s to %s", name, tag, location)
+	manifest.Name, manifest.Tag = name, tag
+	pushed, err := registry.New(store).Push(archive, manifest)
+	if err != nil {
+		return err
+	}
+	PrintSuccess("Pushed %s:%s (%s, %s)", name, tag, pushed.Digest, formatMemory(pushed.Size))
+	return nil
+}
+
+// registryLocationSetting returns the registry given with --registry, or
+// else the configured one
+func registryLocationSetting() string {
+	if registryLocation != "" {
+		return registryLocation
+	}
+	return viper.GetString("registry")
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/runner"
+)
+
+// restartCmd represents the restart command
+var restartCmd = &cobra.Command{
+	Use:   "restart [OPTIONS] [SERVICE...]",
+	Short: "Restart service containers",
+	Long: `Restart the containers of services, or of every service in the stack.
+
+Services are restarted one container at a time in dependency order. Each
+container gets --timeout seconds to shut down cleanly before it is stopped
+forcibly, and is then started again. A container that fails to start is
+retried as its service's restart policy allows (see 'pxc start'). A service
+with a health check must become healthy again before the next container is
+restarted; if it does not, the restart stops there and pxc exits with an
+error.
+
+The containers are looked up from what 'pxc up' recorded for the project, so
+the services must have been deployed from the same stack file and project name.`,
+	Example: `  # Restart every service
+  pxc restart
+
+  # Restart the database, giving it a minute to shut down
+  pxc restart --timeout 60 database`,
+	RunE: runRestart,
+}
+
+func init() {
+	rootCmd.AddCommand(restartCmd)
+
+	restartCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	restartCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	restartCmd.Flags().IntVarP(&timeout, "timeout", "t", 10, "Seconds each container gets to shut down before it is stopped forcibly (0 stops at once)")
+}
+
+func runRestart(cmd *cobra.Command, args []string) error {
+	if timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative")
+	}
+
+	orchestrator, err := lifecycleOrchestrator()
+	if err != nil {
+		return err
+	}
+
+	results, err := orchestrator.Restart(context.Background(), stackFile, args)
+	if err != nil {
+		return fmt.Errorf("restart failed: %w", err)
+	}
+
+	if len(results) == 0 {
+		PrintInfo("No deployed services to restart")
+		return nil
+	}
+	PrintSuccess("Restarted %d container(s)", len(results))
+	return nil
+}
+
+// lifecycleOrchestrator resolves the stack file and project of restart,
+// stop and start and returns an orchestrator for them
+func lifecycleOrchestrator() (*runner.Orchestrator, error) {
+	if stackFile == "" {
+		stackFile = config.GetDefaultStackfile()
+	}
+	if err := config.ValidateConfigExists(stackFile); err != nil {
+		return nil, err
+	}
+	if err := loadProjectConfig(stackFile); err != nil {
+		return nil, err
+	}
+	if projectName == "" {
+		projectName = getProjectNameFromPath(stackFile)
+	}
+
+	api, err := proxmoxAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.New(&runner.Config{
+		Verbose:         IsVerbose(),
+		DryRun:          IsDryRun(),
+		ProjectName:     projectName,
+		BaseDir:         filepath.Dir(stackFile),
+		ProxmoxNode:     viper.GetString("proxmox_node"),
+		Storage:         viper.GetString("storage"),
+		TemplateStorage: viper.GetString("template_storage"),
+		StopTimeout:     time.Duration(timeout) * time.Second,
+		API:             api,
+		SecretsProvider: viper.GetString("secrets_provider"),
+	}), nil
+}
@@ -3,16 +3,32 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/output"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/terminal"
 )
 
 var (
 	cfgFile string
 	verbose bool
 	dryRun  bool
+	noColor bool
+	ascii   bool
+
+	quiet     bool
+	logLevel  string
+	logFormat string
+
+	nonInteractive bool
 
 	// Version information
 	version   string
@@ -36,16 +52,33 @@ CONFIGURATION:
   2. ./.pxc.yaml (current directory)
   3. $HOME/.pxc.yaml (home directory)
 
+  Stack commands (up, down) also load a .pxc.yaml found next to the stack
+  file, unless --config is given. Settings are resolved with this
+  precedence (highest first):
+  1. Command-line flags (--storage, --template-storage, --node)
+  2. Environment variables
+  3. Project .pxc.yaml in the stack file's directory (not with --config)
+  4. Config file from --config, ./.pxc.yaml or $HOME/.pxc.yaml
+
   Key configuration options:
     storage: "local-lvm"          # Container storage backend
     template_storage: "local"     # Template storage location
     proxmox_node: "pve"          # Target Proxmox node
+    audit_log: "/var/log/pxc/audit.jsonl"  # Record executed commands
+    transport: "api"             # Use the Proxmox HTTP API (default: pct)
+    api_url: "https://pve.example.com:8006"
+    api_token_id: "pxc@pve!laptop"   # Secret in PXC_API_TOKEN_SECRET
 
 ENVIRONMENT VARIABLES:
   PXC_STORAGE              Override default storage backend
   PXC_TEMPLATE_STORAGE     Override template storage location
   PXC_PROXMOX_NODE         Override target Proxmox node
   PXC_CONFIG               Override config file location
+  PXC_TRANSPORT            pct or api
+  PXC_API_URL              Proxmox API URL for the api transport
+  PXC_API_TOKEN_ID         API token ID (USER@REALM!TOKENID)
+  PXC_API_TOKEN_SECRET     API token secret
+  PXC_API_INSECURE         Skip TLS verification of the API (true/false)
 
 DOCUMENTATION:
   For comprehensive configuration documentation:
@@ -53,6 +86,42 @@ DOCUMENTATION:
     docs/lxc-stack-reference.md    # Multi-container orchestration
     docs/configuration-guide.md    # Best practices and patterns
 
+OUTPUT:
+  Use --no-color (or set NO_COLOR) to disable ANSI colors and --ascii to
+  replace symbols with [INFO]/[OK]/[WARN]/[ERROR] for CI logs.
+
+  --log-level debug|info|warn|error sets which messages are logged:
+  debug adds the commands pxc runs (like --verbose), and --quiet (warn)
+  leaves only warnings and errors, so scripts see just their results.
+  --log-format json logs one {"time","level","msg"} object per line
+  instead; tables and other command results are printed as before.
+
+NON-INTERACTIVE MODE:
+  --non-interactive (implied by CI=true) never prompts: operations that
+  delete data, such as 'pxc down --volumes', fail unless --yes is given.
+  Colors and live-updating progress are disabled as well. Without a
+  terminal on stdin pxc does not prompt either.
+
+INTERPOLATION:
+  Values in stack files may reference environment variables as ${VAR},
+  ${VAR:-default} or ${VAR:?message}; write $$ for a literal $. An unset
+  variable without a default fails the command unless --env-missing is
+  empty (substitute "") or keep (leave ${VAR} as written).
+
+REMOTE CLUSTERS:
+  transport: api (or --transport api) manages containers through the
+  Proxmox VE HTTP API with an API token instead of running pct, so pxc up,
+  down and restart work from another machine against proxmox_node. The API
+  cannot run commands in containers: template builds, health checks,
+  configs, secrets, named volumes and pxc exec still need pxc on the node.
+
+AUDIT LOG:
+  --audit-log FILE (or audit_log in the config) appends one JSON line per
+  pct, pvesm, pvesh or hook command pxc runs, with its time, arguments,
+  exit status and duration. Values of --password and of NAME=VALUE
+  arguments naming a password, secret, token, key or credential are
+  replaced with [REDACTED].
+
 TROUBLESHOOTING:
   • Use --dry-run to preview actions without execution
   • Use --verbose for detailed operation logging
@@ -98,25 +167,88 @@ func SetVersionInfo(v, commit, date string) {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(configureOutput, configureLogging, initConfig, configureAudit)
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pxc.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file, used instead of ./.pxc.yaml, $HOME/.pxc.yaml and the project .pxc.yaml next to the stack file")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "show what would be done without executing")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "disable colored output (also honors NO_COLOR)")
+	rootCmd.PersistentFlags().BoolVar(&ascii, "ascii", false, "use [INFO]/[OK]/[WARN]/[ERROR] instead of unicode symbols")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "only log warnings and errors (same as --log-level warn)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "lowest level of messages to log: "+strings.Join(output.LevelNames, ", ")+" (default info, debug with --verbose)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log message format: text or json (one JSON object per line)")
+	rootCmd.PersistentFlags().BoolVar(&nonInteractive, "non-interactive", false, "never prompt: destructive operations need --yes; also disables colors and live progress (implied by CI=true)")
+	rootCmd.PersistentFlags().Var(&envMissingFlag{mode: config.EnvMissingError}, "env-missing", "handling of unset ${VAR} references without a default in stack files: error, empty or keep")
+	rootCmd.PersistentFlags().String("storage", "", "container storage backend (overrides config)")
+	rootCmd.PersistentFlags().String("template-storage", "", "template storage location (overrides config)")
+	rootCmd.PersistentFlags().String("node", "", "target Proxmox node (overrides config)")
+	rootCmd.PersistentFlags().String("transport", "", "how to reach Proxmox: pct on the node, or api for the HTTP API (overrides config)")
+	rootCmd.PersistentFlags().String("audit-log", "", "append every executed pct and Proxmox command to this file as JSON lines (overrides config)")
+	bindConfigFlags()
+}
+
+// envMissingFlag is the --env-missing flag; setting it configures how stack
+// files are interpolated
+type envMissingFlag struct {
+	mode config.EnvMissingMode
+}
+
+func (f *envMissingFlag) String() string { return string(f.mode) }
+
+func (f *envMissingFlag) Type() string { return "mode" }
+
+func (f *envMissingFlag) Set(value string) error {
+	mode, err := config.ParseEnvMissingMode(value)
+	if err != nil {
+		return err
+	}
+	f.mode = mode
+	config.SetEnvMissing(mode)
+	return nil
+}
 
-	// Version command
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "version",
-		Short: "Show version information",
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Printf("pxc version %s\n", version)
-			if verbose {
-				fmt.Printf("Git commit: %s\n", gitCommit)
-				fmt.Printf("Build date: %s\n", buildDate)
-			}
-		},
-	})
+// configureOutput applies the --no-color and --ascii output modes.
+// Non-interactive runs get no colors either.
+func configureOutput() {
+	if noColor || os.Getenv("NO_COLOR") != "" || IsNonInteractive() {
+		output.SetColor(false)
+	}
+	output.SetASCII(ascii)
+}
+
+// configureLogging sets up the shared logger from --log-level, --quiet,
+// --verbose and --log-format
+func configureLogging() {
+	level, err := resolveLogLevel()
+	cobra.CheckErr(err)
+	if logFormat != "text" && logFormat != "json" {
+		cobra.CheckErr(fmt.Errorf("invalid log format '%s', must be text or json", logFormat))
+	}
+	output.SetDefault(output.NewLogger(nil, level, logFormat == "json"))
+}
+
+// resolveLogLevel returns the level set by --log-level, --quiet or
+// --verbose, which are mutually exclusive
+func resolveLogLevel() (output.Level, error) {
+	set := 0
+	for _, flag := range []bool{logLevel != "", quiet, verbose} {
+		if flag {
+			set++
+		}
+	}
+	if set > 1 {
+		return output.Info, fmt.Errorf("--log-level, --quiet and --verbose cannot be combined")
+	}
+	switch {
+	case logLevel != "":
+		return output.ParseLevel(logLevel)
+	case quiet:
+		return output.Warning, nil
+	case verbose:
+		return output.Debug, nil
+	}
+	return output.Info, nil
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -136,6 +268,7 @@ func initConfig() {
 		viper.SetConfigName(".pxc")
 	}
 
+	viper.SetDefault("detach_keys", terminal.DefaultDetachKeys)
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
@@ -144,26 +277,145 @@ func initConfig() {
 	}
 }
 
-// Utility functions for consistent output
+// bindConfigFlags binds the global configuration flags to their viper keys so
+// an explicitly set flag takes precedence over environment and config files
+func bindConfigFlags() {
+	flags := rootCmd.PersistentFlags()
+	cobra.CheckErr(viper.BindPFlag("storage", flags.Lookup("storage")))
+	cobra.CheckErr(viper.BindPFlag("template_storage", flags.Lookup("template-storage")))
+	cobra.CheckErr(viper.BindPFlag("proxmox_node", flags.Lookup("node")))
+	cobra.CheckErr(viper.BindPFlag("audit_log", flags.Lookup("audit-log")))
+	cobra.CheckErr(viper.BindPFlag("transport", flags.Lookup("transport")))
+	for _, key := range []string{"transport", "api_url", "api_token_id", "api_token_secret", "api_insecure", "registry", "secrets_provider"} {
+		cobra.CheckErr(viper.BindEnv(key, "PXC_"+strings.ToUpper(key)))
+	}
+}
+
+// proxmoxAPI returns the HTTP API settings when the api transport is
+// selected, nil for the default pct transport
+func proxmoxAPI() (*proxmox.APIConfig, error) {
+	switch transport := viper.GetString("transport"); transport {
+	case "", proxmox.TransportPCT:
+		return nil, nil
+	case proxmox.TransportAPI:
+		api := &proxmox.APIConfig{
+			URL:         viper.GetString("api_url"),
+			TokenID:     viper.GetString("api_token_id"),
+			TokenSecret: viper.GetString("api_token_secret"),
+			Insecure:    viper.GetBool("api_insecure"),
+		}
+		if err := api.Validate(); err != nil {
+			return nil, err
+		}
+		return api, nil
+	default:
+		return nil, fmt.Errorf("invalid transport '%s', must be %s or %s", transport, proxmox.TransportPCT, proxmox.TransportAPI)
+	}
+}
+
+// requirePCTTransport fails a command that runs pct or other tools on the
+// node when the api transport is selected
+func requirePCTTransport(command string) error {
+	api, err := proxmoxAPI()
+	if err != nil {
+		return err
+	}
+	if api != nil {
+		return fmt.Errorf("pxc %s is not supported with --transport api, run it on the node with transport pct", command)
+	}
+	return nil
+}
+
+// configureAudit opens the audit log set by --audit-log or the audit_log
+// config option, if any
+func configureAudit() {
+	path := viper.GetString("audit_log")
+	if path == "" {
+		return
+	}
+	log, err := proxmox.OpenAuditLog(path)
+	cobra.CheckErr(err)
+	proxmox.SetAuditLog(log)
+}
+
+// proxmoxTarget splits the node and storage settings for deploying a stack
+// into the values given by flag or environment, which win over the stack's
+// settings.proxmox, and the values from config files, which it overrides
+func proxmoxTarget() (overrides, defaults models.ProxmoxConfig) {
+	settings := []struct {
+		key, flag          string
+		override, fallback *string
+	}{
+		{"proxmox_node", "node", &overrides.Node, &defaults.Node},
+		{"storage", "storage", &overrides.Storage, &defaults.Storage},
+		{"template_storage", "template-storage", &overrides.TemplateStorage, &defaults.TemplateStorage},
+	}
+	for _, setting := range settings {
+		_, fromEnv := os.LookupEnv(strings.ToUpper(setting.key))
+		if rootCmd.PersistentFlags().Changed(setting.flag) || fromEnv {
+			*setting.override = viper.GetString(setting.key)
+		} else {
+			*setting.fallback = viper.GetString(setting.key)
+		}
+	}
+	return overrides, defaults
+}
+
+// loadProjectConfig merges a .pxc.yaml found in the stack file's directory
+// over the already loaded config. It is skipped when --config was given or
+// when the project config is the file already in use.
+func loadProjectConfig(stackFile string) error {
+	if cfgFile != "" {
+		return nil
+	}
+
+	projectConfig, err := filepath.Abs(filepath.Join(filepath.Dir(stackFile), ".pxc.yaml"))
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(projectConfig); err != nil {
+		return nil
+	}
+	if used, err := filepath.Abs(viper.ConfigFileUsed()); err == nil && used == projectConfig {
+		return nil
+	}
+
+	project := viper.New()
+	project.SetConfigFile(projectConfig)
+	if err := project.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read project config %s: %w", projectConfig, err)
+	}
+	if err := viper.MergeConfigMap(project.AllSettings()); err != nil {
+		return fmt.Errorf("failed to merge project config %s: %w", projectConfig, err)
+	}
+
+	if verbose {
+		fmt.Fprintln(os.Stderr, color.GreenString("Using project config file: %s", projectConfig))
+	}
+	return nil
+}
+
+// Utility functions for consistent output, through the shared logger
 func PrintSuccess(format string, args ...interface{}) {
-	fmt.Printf(color.GreenString("✓ ")+format+"\n", args...)
+	output.Default().Logf(output.Success, format, args...)
 }
 
 func PrintWarning(format string, args ...interface{}) {
-	fmt.Printf(color.YellowString("⚠ ")+format+"\n", args...)
+	output.Default().Logf(output.Warning, format, args...)
 }
 
 func PrintError(format string, args ...interface{}) {
-	fmt.Printf(color.RedString("✗ ")+format+"\n", args...)
+	output.Default().Logf(output.Error, format, args...)
 }
 
 func PrintInfo(format string, args ...interface{}) {
-	fmt.Printf(color.BlueString("ℹ ")+format+"\n", args...)
+	output.Default().Logf(output.Info, format, args...)
 }
 
-// IsVerbose returns true if verbose mode is enabled
+// IsVerbose returns true if verbose mode is enabled, by --verbose or
+// --log-level debug
 func IsVerbose() bool {
-	return verbose
+	return verbose || output.Default().Enabled(output.Debug)
 }
 
 // IsDryRun returns true if dry-run mode is enabled
@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+func TestLoadProjectConfig(t *testing.T) {
+	homeDir := t.TempDir()
+	projectDir := t.TempDir()
+
+	homeConfig := filepath.Join(homeDir, ".pxc.yaml")
+	err := os.WriteFile(homeConfig, []byte(`storage: "home-storage"
+template_storage: "home-templates"
+proxmox_node: "home-node"`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write home config: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(projectDir, ".pxc.yaml"), []byte(`storage: "project-storage"
+proxmox_node: "project-node"`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write project config: %v", err)
+	}
+	stackPath := filepath.Join(projectDir, "lxc-stack.yml")
+
+	// setup loads the home config the way initConfig does
+	setup := func(t *testing.T) {
+		t.Helper()
+		viper.Reset()
+		bindConfigFlags()
+		cfgFile = ""
+		viper.SetConfigFile(homeConfig)
+		if err := viper.ReadInConfig(); err != nil {
+			t.Fatalf("Failed to read home config: %v", err)
+		}
+	}
+	defer viper.Reset()
+
+	t.Run("project config overrides home config", func(t *testing.T) {
+		setup(t)
+
+		if err := loadProjectConfig(stackPath); err != nil {
+			t.Fatalf("loadProjectConfig() unexpected error: %v", err)
+		}
+
+		if got := viper.GetString("storage"); got != "project-storage" {
+			t.Errorf("storage = %q, want %q", got, "project-storage")
+		}
+		if got := viper.GetString("proxmox_node"); got != "project-node" {
+			t.Errorf("proxmox_node = %q, want %q", got, "project-node")
+		}
+		if got := viper.GetString("template_storage"); got != "home-templates" {
+			t.Errorf("template_storage = %q, want home config value %q", got, "home-templates")
+		}
+	})
+
+	t.Run("flags override project config", func(t *testing.T) {
+		setup(t)
+
+		flags := rootCmd.PersistentFlags()
+		if err := flags.Set("storage", "flag-storage"); err != nil {
+			t.Fatalf("Failed to set flag: %v", err)
+		}
+		defer func() {
+			_ = flags.Set("storage", "")
+			flags.Lookup("storage").Changed = false
+		}()
+
+		if err := loadProjectConfig(stackPath); err != nil {
+			t.Fatalf("loadProjectConfig() unexpected error: %v", err)
+		}
+
+		if got := viper.GetString("storage"); got != "flag-storage" {
+			t.Errorf("storage = %q, want %q", got, "flag-storage")
+		}
+		if got := viper.GetString("proxmox_node"); got != "project-node" {
+			t.Errorf("proxmox_node = %q, want %q", got, "project-node")
+		}
+	})
+
+	t.Run("explicit --config skips project config", func(t *testing.T) {
+		setup(t)
+		cfgFile = homeConfig
+		defer func() { cfgFile = "" }()
+
+		if err := loadProjectConfig(stackPath); err != nil {
+			t.Fatalf("loadProjectConfig() unexpected error: %v", err)
+		}
+
+		if got := viper.GetString("storage"); got != "home-storage" {
+			t.Errorf("storage = %q, want %q", got, "home-storage")
+		}
+	})
+
+	t.Run("no project config", func(t *testing.T) {
+		setup(t)
+
+		if err := loadProjectConfig(filepath.Join(t.TempDir(), "lxc-stack.yml")); err != nil {
+			t.Fatalf("loadProjectConfig() unexpected error: %v", err)
+		}
+
+		if got := viper.GetString("storage"); got != "home-storage" {
+			t.Errorf("storage = %q, want %q", got, "home-storage")
+		}
+	})
+}
+
+func TestConfigFlagSkipsProjectConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "explicit.yaml")
+	err := os.WriteFile(configPath, []byte(`storage: "explicit-storage"
+proxmox_node: "explicit-node"`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	projectDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(projectDir, ".pxc.yaml"), []byte(`storage: "project-storage"
+template_storage: "project-templates"`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write project config: %v", err)
+	}
+
+	viper.Reset()
+	defer viper.Reset()
+	bindConfigFlags()
+	flags := rootCmd.PersistentFlags()
+	if err := flags.Set("config", configPath); err != nil {
+		t.Fatalf("Failed to set flag: %v", err)
+	}
+	defer func() {
+		cfgFile = ""
+		flags.Lookup("config").Changed = false
+	}()
+	initConfig()
+
+	if err := loadProjectConfig(filepath.Join(projectDir, "lxc-stack.yml")); err != nil {
+		t.Fatalf("loadProjectConfig() unexpected error: %v", err)
+	}
+
+	if got := viper.GetString("storage"); got != "explicit-storage" {
+		t.Errorf("storage = %q, want %q from --config", got, "explicit-storage")
+	}
+	if got := viper.GetString("proxmox_node"); got != "explicit-node" {
+		t.Errorf("proxmox_node = %q, want %q from --config", got, "explicit-node")
+	}
+	if got := viper.GetString("template_storage"); got != "" {
+		t.Errorf("template_storage = %q, want it unset, not taken from the project config", got)
+	}
+	if !strings.Contains(rootCmd.Long, "unless --config is given") {
+		t.Error("root help does not say --config replaces the project config")
+	}
+}
+
+func TestProxmoxTarget(t *testing.T) {
+	setup := func(t *testing.T) {
+		t.Helper()
+		viper.Reset()
+		bindConfigFlags()
+		viper.AutomaticEnv()
+		viper.SetConfigType("yaml")
+		err := viper.ReadConfig(strings.NewReader(`proxmox_node: "config-node"
+storage: "config-storage"
+template_storage: "config-templates"`))
+		if err != nil {
+			t.Fatalf("Failed to read config: %v", err)
+		}
+	}
+	defer viper.Reset()
+
+	t.Run("config files are defaults", func(t *testing.T) {
+		setup(t)
+
+		overrides, defaults := proxmoxTarget()
+		if !reflect.DeepEqual(overrides, models.ProxmoxConfig{}) {
+			t.Errorf("overrides = %+v, want none", overrides)
+		}
+		want := models.ProxmoxConfig{Node: "config-node", Storage: "config-storage", TemplateStorage: "config-templates"}
+		if !reflect.DeepEqual(defaults, want) {
+			t.Errorf("defaults = %+v, want %+v", defaults, want)
+		}
+	})
+
+	t.Run("flag and environment override", func(t *testing.T) {
+		setup(t)
+		t.Setenv("STORAGE", "env-storage")
+
+		flags := rootCmd.PersistentFlags()
+		if err := flags.Set("node", "flag-node"); err != nil {
+			t.Fatalf("Failed to set flag: %v", err)
+		}
+		defer func() {
+			_ = flags.Set("node", "")
+			flags.Lookup("node").Changed = false
+		}()
+
+		overrides, defaults := proxmoxTarget()
+		want := models.ProxmoxConfig{Node: "flag-node", Storage: "env-storage"}
+		if !reflect.DeepEqual(overrides, want) {
+			t.Errorf("overrides = %+v, want %+v", overrides, want)
+		}
+		if !reflect.DeepEqual(defaults, models.ProxmoxConfig{TemplateStorage: "config-templates"}) {
+			t.Errorf("defaults = %+v, want only template storage", defaults)
+		}
+	})
+}
+
+// captureStdout returns everything written to os.Stdout while fn runs
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+
+	original := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = original }()
+
+	fn()
+
+	w.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read captured output: %v", err)
+	}
+	return string(data)
+}
+
+func TestConfigureOutput(t *testing.T) {
+	originalNoColor := color.NoColor
+	defer func() {
+		color.NoColor = originalNoColor
+		noColor = false
+		ascii = false
+		output.SetASCII(false)
+	}()
+
+	t.Run("no-color and ascii", func(t *testing.T) {
+		color.NoColor = false
+		noColor = true
+		ascii = true
+		configureOutput()
+
+		got := captureStdout(t, func() {
+			PrintInfo("Starting stack: %s", "shop")
+			PrintSuccess("done")
+			PrintWarning("careful")
+			PrintError("failed")
+		})
+
+		expected := "[INFO] Starting stack: shop\n[OK] done\n[WARN] careful\n[ERROR] failed\n"
+		if got != expected {
+			t.Errorf("output = %q, want %q", got, expected)
+		}
+	})
+
+	t.Run("NO_COLOR environment variable", func(t *testing.T) {
+		t.Setenv("NO_COLOR", "1")
+		color.NoColor = false
+		noColor = false
+		ascii = false
+		configureOutput()
+
+		got := captureStdout(t, func() {
+			PrintSuccess("done")
+		})
+
+		if got != "✓ done\n" {
+			t.Errorf("output = %q, want %q", got, "✓ done\n")
+		}
+	})
+}
+
+func TestConfigureLogging(t *testing.T) {
+	originalNoColor := color.NoColor
+	defer func() {
+		color.NoColor = originalNoColor
+		output.SetASCII(false)
+		quiet, verbose, logLevel = false, false, ""
+		output.SetDefault(output.NewLogger(nil, output.Info, false))
+	}()
+	color.NoColor = true
+	output.SetASCII(true)
+
+	tests := []struct {
+		name     string
+		quiet    bool
+		verbose  bool
+		level    string
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "default",
+			expected: "[INFO] starting\n[WARN] careful\n",
+		},
+		{
+			name:     "quiet",
+			quiet:    true,
+			expected: "[WARN] careful\n",
+		},
+		{
+			name:     "error level",
+			level:    "error",
+			expected: "",
+		},
+		{
+			name:    "quiet and verbose",
+			quiet:   true,
+			verbose: true,
+			wantErr: "cannot be combined",
+		},
+		{
+			name:    "unknown level",
+			level:   "trace",
+			wantErr: "invalid log level 'trace'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quiet, verbose, logLevel = tt.quiet, tt.verbose, tt.level
+			level, err := resolveLogLevel()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveLogLevel() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveLogLevel() unexpected error: %v", err)
+			}
+			output.SetDefault(output.NewLogger(nil, level, false))
+
+			got := captureStdout(t, func() {
+				PrintInfo("starting")
+				PrintWarning("careful")
+			})
+			if got != tt.expected {
+				t.Errorf("output = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
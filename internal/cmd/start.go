@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// startCmd represents the start command
+var startCmd = &cobra.Command{
+	Use:   "start [OPTIONS] [SERVICE...]",
+	Short: "Start stopped service containers",
+	Long: `Start the containers of services, or of every service in the stack, that
+'pxc up' created and that are stopped, e.g. by 'pxc stop'.
+
+Services are started in dependency order; containers that are running are
+left alone. A service with a health check must become healthy before the
+next container is started; if it does not, pxc stops there and exits with an
+error. Replicas of scaled services are all started.
+
+A container that fails to start is retried as its service's restart policy
+allows: not at all with restart: "no", otherwise up to
+restart_policy.max_attempts times (3 if unlimited), waiting restart_policy.delay
+(default 1s) first and doubling it after each failure.`,
+	Example: `  # Start every stopped service
+  pxc start
+
+  # Start the database only
+  pxc start database`,
+	RunE: runStart,
+}
+
+func init() {
+	rootCmd.AddCommand(startCmd)
+
+	startCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	startCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+}
+
+func runStart(cmd *cobra.Command, args []string) error {
+	orchestrator, err := lifecycleOrchestrator()
+	if err != nil {
+		return err
+	}
+
+	results, err := orchestrator.Start(context.Background(), stackFile, args)
+	if err != nil {
+		return fmt.Errorf("start failed: %w", err)
+	}
+
+	if len(results) == 0 {
+		PrintInfo("No deployed services to start")
+		return nil
+	}
+	PrintSuccess("Started %d container(s)", len(results))
+	return nil
+}
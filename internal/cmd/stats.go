@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+var statsNoStream bool
+
+// statsInterval is how often pxc stats samples the containers
+var statsInterval = time.Second
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats [OPTIONS] [SERVICE...]",
+	Short: "Display a live stream of service container resource usage",
+	Long: `Display the resource usage of service containers, refreshed every second
+until interrupted with Ctrl+C.
+
+Without arguments, every deployed service in the stack is shown; replicas
+of scaled services are shown as service-N. Columns:
+  • CPU %: CPU usage since the previous sample, 100% being one core
+  • MEM USAGE / LIMIT: Memory in use, including page cache, and the limit
+  • MEM %: Memory in use as a share of the limit
+  • NET I/O: Bytes received and sent on the container's interfaces
+  • BLOCK I/O: Bytes read from and written to block devices
+
+With the pct transport, usage is read from the containers' cgroups and
+/proc/net/dev on the node. With the api transport, it is the usage Proxmox
+last measured for each container. Stopped containers show - for every
+column.
+
+Use --no-stream to print a single snapshot, measured over one second, and
+exit.`,
+	Example: `  # Watch the usage of every service
+  pxc stats
+
+  # Print the usage of two services once
+  pxc stats --no-stream web worker`,
+	RunE: runStats,
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	statsCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	statsCmd.Flags().BoolVar(&statsNoStream, "no-stream", false, "Print a single snapshot instead of refreshing")
+}
+
+// statsClient reads the resource usage of containers
+type statsClient interface {
+	ReadContainerStats(vmid int) (*proxmox.ContainerMetrics, error)
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	stack, projectState, err := loadStackState()
+	if err != nil {
+		return err
+	}
+
+	sources, err := collectLogSources(stack, projectState, args)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		PrintInfo("No deployed services found (run 'pxc up' first)")
+		return nil
+	}
+
+	api, err := proxmoxAPI()
+	if err != nil {
+		return err
+	}
+	// Containers placed on other cluster nodes are read through their node
+	clients := make(map[string]statsClient)
+	targets := make([]statsClient, len(sources))
+	for i, source := range sources {
+		node := containerNode(projectState, source.ContainerID)
+		if node == "" {
+			node = viper.GetString("proxmox_node")
+		}
+		if _, exists := clients[node]; !exists {
+			if api != nil {
+				clients[node] = proxmox.NewAPIClient(node, *api, IsVerbose(), IsDryRun())
+			} else {
+				clients[node] = proxmox.NewClient(node, IsVerbose(), IsDryRun())
+			}
+		}
+		targets[i] = clients[node]
+	}
+
+	previous := sampleStats(sources, targets)
+	if statsNoStream {
+		time.Sleep(statsInterval)
+		return printStats(os.Stdout, sources, previous, sampleStats(sources, targets))
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+		}
+		current := sampleStats(sources, targets)
+		// Clear the screen and redraw from the top, as docker stats does
+		fmt.Print("\033[H\033[2J")
+		if err := printStats(os.Stdout, sources, previous, current); err != nil {
+			return err
+		}
+		previous = current
+	}
+}
+
+// containerNode returns the node the project state records a container on,
+// empty for the configured node
+func containerNode(projectState *state.ProjectState, containerID int) string {
+	for _, entry := range projectState.Services {
+		if entry.ContainerID == containerID {
+			return entry.Node
+		}
+	}
+	return ""
+}
+
+// sampleStats reads the usage of every source at once with its client. A
+// container whose usage cannot be read, such as a stopped one, has no
+// sample.
+func sampleStats(sources []logSource, clients []statsClient) []*proxmox.ContainerMetrics {
+	samples := make([]*proxmox.ContainerMetrics, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source logSource) {
+			defer wg.Done()
+			if metrics, err := clients[i].ReadContainerStats(source.ContainerID); err == nil {
+				samples[i] = metrics
+			}
+		}(i, source)
+	}
+	wg.Wait()
+	return samples
+}
+
+// printStats writes the usage table. The CPU usage is measured between the
+// previous and current sample of each container.
+func printStats(w io.Writer, sources []logSource, previous, current []*proxmox.ContainerMetrics) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER ID\tSERVICE\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O")
+	for i, source := range sources {
+		metrics := current[i]
+		if metrics == nil {
+			fmt.Fprintf(tw, "%d\t%s\t-\t-\t-\t-\t-\n", source.ContainerID, source.Label)
+			continue
+		}
+
+		// API samples carry Proxmox's average, cgroup samples need two
+		cpu := "-"
+		if metrics.CgroupVersion == 0 {
+			cpu = fmt.Sprintf("%.2f%%", metrics.CPUAverage)
+		} else if previous[i] != nil {
+			cpu = fmt.Sprintf("%.2f%%", metrics.CPUPercent(previous[i]))
+		}
+		limit, memPercent := "unlimited", "-"
+		if metrics.MemoryLimit > 0 {
+			limit = formatIO(metrics.MemoryLimit)
+			memPercent = fmt.Sprintf("%.2f%%", float64(metrics.MemoryCurrent)/float64(metrics.MemoryLimit)*100)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s / %s\t%s\t%s / %s\t%s / %s\n",
+			source.ContainerID, source.Label, cpu,
+			formatIO(metrics.MemoryCurrent), limit, memPercent,
+			formatIO(metrics.NetRx), formatIO(metrics.NetTx),
+			formatIO(metrics.BlockRead), formatIO(metrics.BlockWrite))
+	}
+	return tw.Flush()
+}
+
+// formatIO formats a byte count like formatMemory, but shows none as 0B
+func formatIO(bytes int64) string {
+	if bytes == 0 {
+		return "0B"
+	}
+	return formatMemory(bytes)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+func TestPrintStats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sources := []logSource{
+		{Service: "web", Label: "web-1", ContainerID: 101},
+		{Service: "web", Label: "web-2", ContainerID: 102},
+		{Service: "db", Label: "db", ContainerID: 103},
+		{Service: "cache", Label: "cache", ContainerID: 104},
+	}
+	previous := []*proxmox.ContainerMetrics{
+		{CPUUsage: 10 * time.Second, CgroupVersion: 2, ReadAt: start},
+		nil,
+		nil,
+		nil,
+	}
+	current := []*proxmox.ContainerMetrics{
+		{CPUUsage: 10500 * time.Millisecond, MemoryCurrent: 256 << 20, MemoryLimit: 512 << 20,
+			NetRx: 2 << 20, NetTx: 1 << 10, BlockRead: 3 << 30, CgroupVersion: 2, ReadAt: start.Add(time.Second)},
+		{CPUUsage: time.Second, MemoryCurrent: 64 << 20, CgroupVersion: 1, ReadAt: start.Add(time.Second)},
+		{CPUAverage: 12.5, MemoryCurrent: 128 << 20, MemoryLimit: 1 << 30, ReadAt: start.Add(time.Second)},
+		nil,
+	}
+
+	var out bytes.Buffer
+	if err := printStats(&out, sources, previous, current); err != nil {
+		t.Fatalf("printStats() unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("printStats() printed %d lines, want 5:\n%s", len(lines), out.String())
+	}
+	tests := []struct {
+		line int
+		want []string
+	}{
+		{0, []string{"CONTAINER ID", "SERVICE", "CPU %", "MEM USAGE / LIMIT", "MEM %", "NET I/O", "BLOCK I/O"}},
+		{1, []string{"101", "web-1", "50.00%", "256MB / 512MB", "50.00%", "2MB / 1KB", "3.0GB / 0B"}},
+		{2, []string{"102", "web-2", " - ", "64MB / unlimited", "0B / 0B"}},
+		{3, []string{"103", "db", "12.50%", "128MB / 1.0GB", "12.50%"}},
+		{4, []string{"104", "cache", "-"}},
+	}
+	for _, tt := range tests {
+		for _, want := range tt.want {
+			if !strings.Contains(lines[tt.line], want) {
+				t.Errorf("line %d = %q, want it to contain %q", tt.line, lines[tt.line], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// stopCmd represents the stop command
+var stopCmd = &cobra.Command{
+	Use:   "stop [OPTIONS] [SERVICE...]",
+	Short: "Stop service containers without removing them",
+	Long: `Stop the containers of services, or of every service in the stack, and
+keep them for 'pxc start'.
+
+Services are stopped in reverse dependency order, so dependents stop before
+the services they depend on. Each container gets --timeout seconds to shut
+down cleanly before it is stopped forcibly. Replicas of scaled services are
+all stopped.
+
+Stopped containers are recorded as stopped by hand: restart policies,
+including unless-stopped, leave them down until 'pxc start', 'pxc restart'
+or 'pxc up' starts them again. Use 'pxc down' to remove the containers.`,
+	Example: `  # Stop every service
+  pxc stop
+
+  # Stop the workers, giving them a minute to finish their jobs
+  pxc stop --timeout 60 worker`,
+	RunE: runStop,
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+
+	stopCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	stopCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	stopCmd.Flags().IntVarP(&timeout, "timeout", "t", 10, "Seconds each container gets to shut down before it is stopped forcibly (0 stops at once)")
+}
+
+func runStop(cmd *cobra.Command, args []string) error {
+	if timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative")
+	}
+
+	orchestrator, err := lifecycleOrchestrator()
+	if err != nil {
+		return err
+	}
+
+	results, err := orchestrator.Stop(context.Background(), stackFile, args)
+	if err != nil {
+		return fmt.Errorf("stop failed: %w", err)
+	}
+
+	if len(results) == 0 {
+		PrintInfo("No deployed services to stop")
+		return nil
+	}
+	PrintSuccess("Stopped %d container(s)", len(results))
+	return nil
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/runner"
+)
+
+var (
+	superviseInterval time.Duration
+	superviseSystemd  bool
+)
+
+// superviseCmd represents the supervise command
+var superviseCmd = &cobra.Command{
+	Use:   "supervise [OPTIONS] [SERVICE...]",
+	Short: "Restart stopped containers according to their restart policies",
+	Long: `Supervise keeps running and enforces the restart policies of a deployed
+stack: every --interval it checks the containers of the services, or of
+every service, and starts those that stopped.
+
+LXC reports no exit status, so a container that stops without 'pxc stop'
+counts as failed:
+  • restart: "no" leaves it down
+  • on-failure and unless-stopped (the default) restart it, unless it was
+    stopped with 'pxc stop'
+  • always restarts it too when it was stopped with 'pxc stop' before the
+    supervisor started, e.g. before the node rebooted
+
+A restart waits restart_policy.delay (default 1s), doubled after each
+consecutive failure up to 5 minutes; a container that keeps running for 10
+seconds starts over at the initial delay. A service that has been restarted
+restart_policy.max_attempts times within restart_policy.window is given up
+on until it is started again by hand.
+
+The stack and the project state are read again on every check, so services
+deployed, scaled or removed while supervising are picked up.
+
+SYSTEMD:
+  --systemd prints a systemd unit that runs the supervisor for this stack
+  on boot and restarts the supervisor itself if it exits.`,
+	Example: `  # Supervise every service in the foreground
+  pxc supervise
+
+  # Check the workers every 30 seconds
+  pxc supervise --interval 30s worker
+
+  # Install the supervisor as a systemd service
+  pxc supervise --systemd > /etc/systemd/system/pxc-myapp.service
+  systemctl enable --now pxc-myapp.service`,
+	RunE: runSupervise,
+}
+
+func init() {
+	rootCmd.AddCommand(superviseCmd)
+
+	superviseCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	superviseCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+	superviseCmd.Flags().DurationVar(&superviseInterval, "interval", runner.DefaultSuperviseInterval, "How often to check the containers")
+	superviseCmd.Flags().BoolVar(&superviseSystemd, "systemd", false, "Print a systemd unit running the supervisor instead of running it")
+}
+
+func runSupervise(cmd *cobra.Command, args []string) error {
+	if superviseInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	if superviseSystemd {
+		if stackFile == "" {
+			stackFile = config.GetDefaultStackfile()
+		}
+		if projectName == "" {
+			projectName = getProjectNameFromPath(stackFile)
+		}
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate the pxc executable: %w", err)
+		}
+		absStack, err := filepath.Abs(stackFile)
+		if err != nil {
+			return fmt.Errorf("failed to resolve stack file: %w", err)
+		}
+		flags, err := supervisorFlags()
+		if err != nil {
+			return err
+		}
+		fmt.Print(supervisorUnit(executable, absStack, projectName, superviseInterval, flags, args))
+		return nil
+	}
+
+	orchestrator, err := lifecycleOrchestrator()
+	if err != nil {
+		return err
+	}
+	supervisor := orchestrator.NewSupervisor(stackFile, args, superviseInterval)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Check once before settling in, so a broken stack fails at once
+	if err := supervisor.Poll(ctx); err != nil {
+		return fmt.Errorf("supervise failed: %w", err)
+	}
+	PrintInfo("Supervising project %s every %v (press Ctrl+C to stop)", projectName, superviseInterval)
+
+	supervisor.Run(ctx, func(err error) {
+		PrintWarning("%v", err)
+	})
+	return nil
+}
+
+// supervisorFlags returns the global flags given to this command that
+// choose how Proxmox is reached, so the supervisor unit reaches it the same
+// way: --config as an absolute path, --transport and --node
+func supervisorFlags() ([]string, error) {
+	var flags []string
+	if cfgFile != "" {
+		path, err := filepath.Abs(cfgFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve config file: %w", err)
+		}
+		flags = append(flags, "--config", path)
+	}
+	for _, name := range []string{"transport", "node"} {
+		if value, _ := rootCmd.PersistentFlags().GetString(name); value != "" {
+			flags = append(flags, "--"+name, value)
+		}
+	}
+	return flags, nil
+}
+
+// supervisorUnit returns a systemd unit that runs 'pxc supervise' for a
+// stack once the node's guests are up, passing flags on to it
+func supervisorUnit(executable, stackFile, project string, interval time.Duration, flags, services []string) string {
+	command := []string{systemdQuote(executable), "supervise"}
+	for _, flag := range flags {
+		command = append(command, systemdQuote(flag))
+	}
+	command = append(command, "-f", systemdQuote(stackFile),
+		"--project-name", systemdQuote(project), "--interval", interval.String())
+	for _, service := range services {
+		command = append(command, systemdQuote(service))
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=pxc supervisor for project %s\n", project)
+	b.WriteString("After=network-online.target pve-guests.service\n")
+	b.WriteString("Wants=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdQuote(filepath.Dir(stackFile)))
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(command, " "))
+	b.WriteString("Restart=always\n")
+	b.WriteString("RestartSec=5\n\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// systemdQuote quotes a unit file argument that contains spaces
+func systemdQuote(arg string) string {
+	if !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+	return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+}
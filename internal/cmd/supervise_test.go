@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSupervisorUnit(t *testing.T) {
+	flags := []string{"--config", "/etc/pxc/pxc.yaml", "--transport", "api", "--node", "pve2"}
+	unit := supervisorUnit("/usr/local/bin/pxc", "/srv/my app/lxc-stack.yml", "myapp", 30*time.Second, flags, []string{"worker"})
+
+	expected := []string{
+		"Description=pxc supervisor for project myapp\n",
+		"After=network-online.target pve-guests.service\n",
+		`WorkingDirectory="/srv/my app"` + "\n",
+		`ExecStart=/usr/local/bin/pxc supervise --config /etc/pxc/pxc.yaml --transport api --node pve2 -f "/srv/my app/lxc-stack.yml" --project-name myapp --interval 30s worker` + "\n",
+		"Restart=always\n",
+		"WantedBy=multi-user.target\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(unit, line) {
+			t.Errorf("unit is missing %q:\n%s", line, unit)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// templatesCmd represents the templates command
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List container templates with their size and format",
+	Long: `List container templates available on the configured storages.
+
+Two kinds of templates are listed:
+  • Template archives (vztmpl content) on the template storage, e.g. the
+    base images referenced by 'from:' in an LXCfile
+  • Container templates built by 'pxc build' on the container storage
+
+Sizes and formats are queried from the storage (pvesm list), and the list is
+sorted by size, largest first, so bloated templates are easy to spot.
+
+The storages default to 'template_storage' and 'storage' from .pxc.yaml and
+can be overridden with --template-storage and --storage.`,
+	Example: `  # List templates on the configured storages
+  pxc templates
+
+  # List templates on another storage
+  pxc templates --storage local-zfs --template-storage nfs-templates`,
+	Args: cobra.NoArgs,
+	RunE: runTemplates,
+}
+
+func init() {
+	rootCmd.AddCommand(templatesCmd)
+}
+
+func runTemplates(cmd *cobra.Command, args []string) error {
+	api, err := proxmoxAPI()
+	if err != nil {
+		return err
+	}
+	var client volumeLister = proxmox.NewClient(viper.GetString("proxmox_node"), IsVerbose(), IsDryRun())
+	if api != nil {
+		client = proxmox.NewAPIClient(viper.GetString("proxmox_node"), *api, IsVerbose(), IsDryRun())
+	}
+
+	templateStorage := viper.GetString("template_storage")
+	if templateStorage == "" {
+		templateStorage = "local"
+	}
+	storage := viper.GetString("storage")
+	if storage == "" {
+		storage = "local-lvm"
+	}
+
+	var volumes []proxmox.StorageVolume
+	queries := []struct{ storage, content string }{
+		{templateStorage, "vztmpl"},
+		{storage, "rootdir"},
+	}
+	for _, query := range queries {
+		listed, err := client.ListStorageVolumes(query.storage, query.content, 0)
+		if err != nil {
+			PrintWarning("Could not list templates on %s: %v", query.storage, err)
+			continue
+		}
+		volumes = append(volumes, listed...)
+	}
+
+	templates := templateVolumes(volumes)
+	if len(templates) == 0 {
+		PrintInfo("No templates found")
+		return nil
+	}
+
+	return printTemplates(os.Stdout, templates)
+}
+
+// volumeLister lists storage volumes with either transport
+type volumeLister interface {
+	ListStorageVolumes(storage, content string, vmid int) ([]proxmox.StorageVolume, error)
+}
+
+// templateVolumes returns the template archives and built container
+// templates among volumes, largest first. Container templates are the
+// volumes Proxmox renames to base-<vmid>-disk-N on conversion.
+func templateVolumes(volumes []proxmox.StorageVolume) []proxmox.StorageVolume {
+	seen := make(map[string]bool)
+	var templates []proxmox.StorageVolume
+	for _, volume := range volumes {
+		_, name, _ := strings.Cut(volume.VolID, ":")
+		if volume.Type != "vztmpl" && !strings.HasPrefix(name, "base-") {
+			continue
+		}
+		if seen[volume.VolID] {
+			continue
+		}
+		seen[volume.VolID] = true
+		templates = append(templates, volume)
+	}
+
+	sort.SliceStable(templates, func(i, j int) bool {
+		return templates[i].Size > templates[j].Size
+	})
+	return templates
+}
+
+// printTemplates writes the templates table
+func printTemplates(w io.Writer, templates []proxmox.StorageVolume) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEMPLATE\tVMID\tSTORAGE\tFORMAT\tSIZE")
+	for _, template := range templates {
+		vmid := "-"
+		if template.VMID != 0 {
+			vmid = strconv.Itoa(template.VMID)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			template.VolID, vmid, template.Storage(), template.ArchiveFormat(), formatMemory(template.Size))
+	}
+	return tw.Flush()
+}
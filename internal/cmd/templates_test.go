@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+func TestTemplateVolumes(t *testing.T) {
+	volumes := []proxmox.StorageVolume{
+		{VolID: "local:vztmpl/alpine-3.18-default_20230607_amd64.tar.xz", Format: "txz", Type: "vztmpl", Size: 3 << 20},
+		{VolID: "local-lvm:vm-101-disk-0", Format: "raw", Type: "rootdir", Size: 8 << 30, VMID: 101},
+		{VolID: "local-lvm:base-9000-disk-0", Format: "raw", Type: "rootdir", Size: 2 << 30, VMID: 9000},
+		{VolID: "local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst", Format: "tzst", Type: "vztmpl", Size: 120 << 20},
+		{VolID: "local:vztmpl/alpine-3.18-default_20230607_amd64.tar.xz", Format: "txz", Type: "vztmpl", Size: 3 << 20},
+	}
+
+	templates := templateVolumes(volumes)
+
+	var got []string
+	for _, template := range templates {
+		got = append(got, template.VolID)
+	}
+	want := []string{
+		"local-lvm:base-9000-disk-0",
+		"local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst",
+		"local:vztmpl/alpine-3.18-default_20230607_amd64.tar.xz",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("templateVolumes() = %v, want %v", got, want)
+	}
+}
+
+func TestPrintTemplates(t *testing.T) {
+	templates := []proxmox.StorageVolume{
+		{VolID: "local-lvm:base-9000-disk-0", Format: "raw", Type: "rootdir", Size: 2 << 30, VMID: 9000},
+		{VolID: "local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst", Format: "tzst", Type: "vztmpl", Size: 120 << 20},
+		{VolID: "nfs:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.gz", Format: "tgz", Type: "vztmpl", Size: 130 << 20},
+	}
+
+	var buf bytes.Buffer
+	if err := printTemplates(&buf, templates); err != nil {
+		t.Fatalf("printTemplates() unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("printTemplates() wrote %d lines, want 4:\n%s", len(lines), buf.String())
+	}
+
+	expected := [][]string{
+		{"TEMPLATE", "VMID", "STORAGE", "FORMAT", "SIZE"},
+		{"local-lvm:base-9000-disk-0", "9000", "local-lvm", "raw", "2.0GB"},
+		{"local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst", "-", "local", "tar.zst", "120MB"},
+		{"nfs:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.gz", "-", "nfs", "tar.gz", "130MB"},
+	}
+	for i, want := range expected {
+		if fields := strings.Fields(lines[i]); strings.Join(fields, " ") != strings.Join(want, " ") {
+			t.Errorf("line %d = %v, want %v", i, fields, want)
+		}
+	}
+}
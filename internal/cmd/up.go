@@ -1,14 +1,25 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/builder"
 	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/output"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
 	"github.com/brynnjknight/proxer/pkg/runner"
 )
 
@@ -18,8 +29,28 @@ var (
 	detach        bool
 	buildArgs     map[string]string
 	buildServices []string
+	printOrder    bool
+	scaleFile     string
+	scaleFlags    map[string]int
+	waitFor       string
+	renew         bool
+	renewBatch    int
+	healthchecks  []string
+	noHealthcheck []string
+	strictUp      bool
+	noDeps        bool
+	ignoreHealth  bool
+	upWatch       bool
+	upParallel    int
+	upDev         bool
+	upRollback    bool
+	upNoRollback  bool
+	upResume      bool
 )
 
+// upResumeFlag marks the background pxc up that --wait-for --detach starts
+const upResumeFlag = "wait-for-resume"
+
 // upCmd represents the up command
 var upCmd = &cobra.Command{
 	Use:   "up [OPTIONS] [SERVICE...]",
@@ -30,9 +61,13 @@ This command orchestrates the complete deployment process:
 1. Validates stack configuration and resolves service dependencies
 2. Builds any missing container templates from LXCfile definitions
 3. Creates custom networks and named volumes as defined
+   (then runs any init hooks, e.g. migrations or certificate generation)
 4. Creates containers with proper resource allocation and configuration
-5. Starts containers in dependency order (respecting depends_on)
+5. Starts containers in dependency order (respecting depends_on), deploying
+   up to --parallel services at once whose dependencies are up
 6. Waits for health checks to pass on all services
+   (or only on the service named by --wait-for, which is deployed first and
+   reported once healthy, or on none with --ignore-health)
 7. Executes post-start hooks for additional setup
 
 By default, looks for lxc-stack.yml in the current directory.
@@ -46,6 +81,11 @@ DEPENDENCY RESOLUTION:
   2. api (depends on database) 
   3. web (depends on api)
 
+  Naming services deploys them together with everything they depend on.
+  --no-deps deploys only the named services; their dependencies are assumed
+  to be running already. --ignore-health starts each service as soon as its
+  dependencies are started, without waiting for their health checks.
+
 NETWORKING:
   • Default network is created automatically if no custom networks defined
   • Services can communicate using service names as hostnames
@@ -86,10 +126,17 @@ TROUBLESHOOTING:
 
 SCALING AND LOAD BALANCING:
   • Use 'scale' parameter to run multiple instances of stateless services
+  • Override counts per environment with --scale-file (service: count YAML)
+    and --scale service=N; inline --scale wins over the scale file
   • Scaled instances are named service-1, service-2, etc.
   • Load balancing requires external proxy (nginx, haproxy, etc.)
 
 DEVELOPMENT MODE:
+  • --watch keeps running after the stack is up and watches the build
+    context of each build-based service; when files in it change, that
+    service's template is rebuilt and its container recreated while the
+    other services keep running. Paths listed in the context's .pxcignore
+    are not watched, and a burst of changes triggers a single rebuild.
   • Development overrides automatically applied when detected
   • Extra services (debug, docs) started alongside main services
   • Volume mounts enable live code reloading`,
@@ -99,9 +146,15 @@ DEVELOPMENT MODE:
   # Use custom stack file
   pxc up -f my-stack.yml
 
-  # Start specific services only
+  # Start specific services only (and the services they depend on)
   pxc up web database
 
+  # Redeploy web alone, leaving its dependencies as they are
+  pxc up --no-deps web
+
+  # Start everything without waiting for health checks between services
+  pxc up --ignore-health
+
   # Set project name for isolation
   pxc up --project-name myapp-prod
 
@@ -111,11 +164,26 @@ DEVELOPMENT MODE:
   # Detached mode (background)
   pxc up --detach
 
-  # Dry run to validate configuration
+  # Dry run to validate configuration, including that bind mount sources exist
   pxc up --dry-run --verbose
 
+  # Apply per-environment replica counts, overriding one inline
+  pxc up --scale-file scales.prod.yml --scale worker=4
+
+  # Return as soon as the database is healthy, deploying the rest in the background
+  pxc up --detach --wait-for database
+
+  # Show the resolved startup and shutdown order without deploying
+  pxc up --print-order
+
   # Force rebuild specific services
-  pxc up --build web --build-arg NODE_ENV=development`,
+  pxc up --build web --build-arg NODE_ENV=development
+
+  # Rebuild and recreate services as their build contexts change
+  pxc up --watch
+
+  # Deploy with the development overrides and extra services
+  pxc up --dev`,
 	RunE: runUp,
 }
 
@@ -126,8 +194,29 @@ func init() {
 	upCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
 	upCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
 	upCmd.Flags().BoolVarP(&detach, "detach", "d", false, "Run containers in background")
-	upCmd.Flags().StringToStringVar(&buildArgs, "build-arg", map[string]string{}, "Set build-time variables")
+	upCmd.Flags().StringToStringVar(&buildArgs, "build-arg", map[string]string{}, "Set build-time variables (KEY=VALUE for all services, SERVICE:KEY=VALUE for one)")
+	upCmd.Flags().StringVar(&buildFrom, "build-from", "", "Base template to build all service templates from, overriding build.from and the LXCfiles")
+	upCmd.Flags().StringVar(&readyProbe, "ready-probe", "exec", "How to tell a build container is ready (exec, status, both)")
 	upCmd.Flags().StringSliceVar(&buildServices, "build", []string{}, "Build only specified services")
+	upCmd.Flags().StringVar(&scaleFile, "scale-file", "", "YAML file mapping services to replica counts")
+	upCmd.Flags().StringToIntVar(&scaleFlags, "scale", map[string]int{}, "Set replica count for a service (service=N)")
+	upCmd.Flags().StringVar(&waitFor, "wait-for", "", "Deploy this service and its dependencies first and report once it is healthy; with --detach the other services are deployed in the background")
+	upCmd.Flags().BoolVar(&renew, "renew", false, "Replace the containers of services without host ports one batch at a time, keeping the old ones until the new ones are healthy")
+	upCmd.Flags().IntVar(&renewBatch, "batch", 1, "Number of containers --renew replaces at a time")
+	upCmd.Flags().StringArrayVar(&healthchecks, "healthcheck", []string{}, "Override a service's health test for this run (SERVICE=COMMAND)")
+	upCmd.Flags().StringSliceVar(&noHealthcheck, "no-healthcheck", []string{}, "Disable the health check of these services for this run")
+	upCmd.Flags().BoolVar(&noDeps, "no-deps", false, "Deploy only the named services, not the services they depend on")
+	upCmd.Flags().BoolVar(&ignoreHealth, "ignore-health", false, "Start dependent services without waiting for health checks to pass")
+	upCmd.Flags().BoolVar(&strictUp, "strict", false, "Fail instead of warning when the stack would over-commit the node's memory, disk or cores")
+	upCmd.Flags().BoolVar(&printOrder, "print-order", false, "Print the resolved service startup and shutdown order and exit")
+	upCmd.Flags().BoolVar(&upWatch, "watch", false, "Keep running and rebuild and recreate services whose build context changes")
+	upCmd.Flags().IntVar(&upParallel, "parallel", 4, "Number of services to deploy at once; services still wait for their dependencies")
+	upCmd.Flags().BoolVar(&upDev, "dev", false, "Apply the development overrides and start the extra services (default: on if lxc-stack.dev.yml exists)")
+	upCmd.Flags().BoolVar(&upRollback, "rollback", true, "Stop and remove the containers a failed run created and restore the previous project state")
+	upCmd.Flags().BoolVar(&upNoRollback, "no-rollback", false, "Leave the containers of a failed run in place for inspection")
+	upCmd.MarkFlagsMutuallyExclusive("rollback", "no-rollback")
+	upCmd.Flags().BoolVar(&upResume, upResumeFlag, false, "Deploy the services after the --wait-for service (set by pxc for --detach)")
+	_ = upCmd.Flags().MarkHidden(upResumeFlag)
 }
 
 func runUp(cmd *cobra.Command, args []string) error {
@@ -141,11 +230,71 @@ func runUp(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Load project config next to the stack file
+	if err := loadProjectConfig(stackFile); err != nil {
+		return err
+	}
+
 	// Determine project name
 	if projectName == "" {
 		projectName = getProjectNameFromPath(stackFile)
 	}
 
+	// Resolve replica count overrides
+	scales, err := resolveScales(scaleFile, scaleFlags)
+	if err != nil {
+		return err
+	}
+
+	// Split global and service-scoped build args
+	globalArgs, serviceArgs, err := splitBuildArgs(buildArgs)
+	if err != nil {
+		return err
+	}
+
+	if renewBatch < 1 {
+		return fmt.Errorf("--batch must be at least 1")
+	}
+	if upParallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if err := builder.ValidateReadyProbe(readyProbe); err != nil {
+		return err
+	}
+	api, err := proxmoxAPI()
+	if err != nil {
+		return err
+	}
+	if noDeps && len(args) == 0 {
+		return fmt.Errorf("--no-deps requires the services to deploy")
+	}
+	if ignoreHealth && (waitFor != "" || renew) {
+		return fmt.Errorf("--ignore-health cannot be combined with --wait-for or --renew, which wait for health checks")
+	}
+	if upWatch && detach {
+		return fmt.Errorf("--watch cannot be combined with --detach, it keeps running in the foreground")
+	}
+
+	healthTests, err := parseHealthchecks(healthchecks)
+	if err != nil {
+		return err
+	}
+
+	// A development file next to the stack file turns development mode on
+	// unless --dev=false is given
+	if devFile := config.DevelopmentFile(stackFile); devFile != "" && !cmd.Flags().Changed("dev") {
+		upDev = true
+		PrintInfo("Using development overrides from %s", devFile)
+	}
+
+	if printOrder {
+		stack, err := loadUpStack()
+		if err != nil {
+			return err
+		}
+		return printServiceOrder(os.Stdout, stack)
+	}
+
 	PrintInfo("Starting stack: %s", projectName)
 	PrintInfo("Stack file: %s", stackFile)
 
@@ -155,28 +304,88 @@ func runUp(cmd *cobra.Command, args []string) error {
 
 	if IsDryRun() {
 		PrintWarning("Dry run mode - no actual deployment will be performed")
-		return printUpDryRun()
+		return printUpDryRun(args, scales, serviceArgs)
 	}
 
-	// Create orchestrator
-	orchestrator := runner.New(&runner.Config{
+	// Create orchestrator; the stack's settings.proxmox sits between flags
+	// or environment and the config files
+	overrides, defaults := proxmoxTarget()
+	minID, maxID, err := containerIDRange()
+	if err != nil {
+		return err
+	}
+	upConfig := runner.Config{
 		Verbose:         IsVerbose(),
 		DryRun:          IsDryRun(),
 		ProjectName:     projectName,
 		BaseDir:         filepath.Dir(stackFile),
-		ProxmoxNode:     viper.GetString("proxmox_node"),
-		Storage:         viper.GetString("storage"),
-		TemplateStorage: viper.GetString("template_storage"),
-	})
+		ProxmoxNode:     overrides.Node,
+		Storage:         overrides.Storage,
+		TemplateStorage: overrides.TemplateStorage,
+		ProxmoxDefaults: defaults,
+		Scales:          scales,
+		WaitFor:         waitFor,
+
+		BuildArgs:        globalArgs,
+		ServiceBuildArgs: serviceArgs,
+		BuildFrom:        buildFrom,
+		ReadyProbe:       readyProbe,
+		Renew:            renew,
+		Batch:            renewBatch,
+		HealthChecks:     healthTests,
+		NoHealthChecks:   noHealthcheck,
+		Strict:           strictUp,
+		Services:         args,
+		NoDeps:           noDeps,
+		IgnoreHealth:     ignoreHealth,
+		API:              api,
+		MinContainerID:   minID,
+		MaxContainerID:   maxID,
+		Parallel:         upParallel,
+		SecretsProvider:  viper.GetString("secrets_provider"),
+		Development:      upDev,
+		Rollback:         upRollback && !upNoRollback,
+	}
 
-	// Deploy the stack
-	result, err := orchestrator.Up(stackFile)
-	if err != nil {
-		return fmt.Errorf("deployment failed: %w", err)
+	// With --wait-for, the service and what it needs are deployed first and
+	// reported as soon as it is ready. The other services follow here, or in
+	// a background pxc up with --detach.
+	deployRest := true
+	if waitFor != "" && !upResume {
+		remaining, err := servicesAfterWaitFor(args)
+		if err != nil {
+			return err
+		}
+		first, err := deployStack(waitForConfig(upConfig))
+		if err != nil {
+			return fmt.Errorf("deployment failed: %w", err)
+		}
+		printDeploymentResults(first)
+		PrintSuccess("Service %s is ready", waitFor)
+		switch {
+		case len(remaining) == 0:
+			deployRest = false
+		case detach:
+			logPath, err := resumeInBackground()
+			if err != nil {
+				return err
+			}
+			PrintInfo("Deploying %s in the background; see %s", strings.Join(remaining, ", "), logPath)
+			return nil
+		}
+	}
+
+	if deployRest {
+		result, err := deployStack(&upConfig)
+		if err != nil {
+			return fmt.Errorf("deployment failed: %w", err)
+		}
+		printDeploymentResults(result)
 	}
 
-	// Print results
-	printDeploymentResults(result)
+	if upWatch {
+		return watchBuilds(upConfig, args)
+	}
 
 	if !detach {
 		PrintInfo("Use 'pxc ps' to view running containers")
@@ -186,9 +395,183 @@ func runUp(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// deployStack runs up with config; Ctrl+C stops it and removes what it
+// created
+func deployStack(config *runner.Config) (*runner.DeploymentResult, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return runner.New(config).Up(ctx, stackFile)
+}
+
+// waitForConfig returns the configuration that deploys only the --wait-for
+// service and, unless --no-deps is given, the services it depends on
+func waitForConfig(upConfig runner.Config) *runner.Config {
+	upConfig.Services = []string{upConfig.WaitFor}
+	return &upConfig
+}
+
+// servicesAfterWaitFor returns the selected services that are deployed
+// after the --wait-for service and what it needs, in startup order
+func servicesAfterWaitFor(services []string) ([]string, error) {
+	stack, err := loadUpStack()
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := stack.Services[waitFor]; !exists {
+		return nil, fmt.Errorf("wait-for service '%s' is not defined in the stack", waitFor)
+	}
+	order, err := stack.GetServiceDependencyOrder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dependencies: %w", err)
+	}
+	if len(services) > 0 {
+		order = stack.SelectServices(order, services, !noDeps)
+	}
+
+	first := make(map[string]bool)
+	for _, name := range stack.SelectServices(order, []string{waitFor}, !noDeps) {
+		first[name] = true
+	}
+	if !first[waitFor] {
+		return nil, fmt.Errorf("wait-for service '%s' is not among the services being deployed", waitFor)
+	}
+	var remaining []string
+	for _, name := range order {
+		if !first[name] {
+			remaining = append(remaining, name)
+		}
+	}
+	return remaining, nil
+}
+
+// resumeInBackground starts pxc up again with the same arguments in a
+// session of its own to deploy the services after the --wait-for service,
+// and returns the file it logs to
+func resumeInBackground() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the pxc executable: %w", err)
+	}
+	logPath := filepath.Join(filepath.Dir(stackFile), ".pxc", projectName+".up.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(logPath), err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", logPath, err)
+	}
+	defer logFile.Close()
+
+	background := exec.Command(executable, resumeArgs(os.Args[1:])...)
+	background.Stdout = logFile
+	background.Stderr = logFile
+	background.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := background.Start(); err != nil {
+		return "", fmt.Errorf("failed to continue the deployment in the background: %w", err)
+	}
+	return logPath, background.Process.Release()
+}
+
+// resumeArgs returns the arguments of a background pxc up that deploys the
+// rest of a --wait-for run: the same ones, marked as resuming
+func resumeArgs(args []string) []string {
+	return append(append([]string{}, args...), "--"+upResumeFlag)
+}
+
+// watchBuilds watches the build contexts of the deployed services and
+// redeploys a service, rebuilding its template and recreating its container,
+// once changes to its context settle. It runs until interrupted.
+func watchBuilds(upConfig runner.Config, services []string) error {
+	stack, err := loadUpStack()
+	if err != nil {
+		return err
+	}
+	if len(services) > 0 {
+		order, err := stack.GetServiceDependencyOrder()
+		if err != nil {
+			return fmt.Errorf("failed to resolve dependencies: %w", err)
+		}
+		services = stack.SelectServices(order, services, !noDeps)
+	}
+
+	contexts := runner.WatchContexts(stack, services)
+	if len(contexts) == 0 {
+		PrintWarning("No services with a build context to watch")
+		return nil
+	}
+	watcher, err := runner.NewWatcher(contexts, runner.DefaultWatchInterval, runner.DefaultWatchDebounce)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(contexts))
+	for name := range contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	PrintInfo("Watching build contexts of %s (press Ctrl+C to stop)", strings.Join(names, ", "))
+
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		close(stop)
+		cancel()
+	}()
+
+	watcher.Run(stop, func(change runner.WatchChange) {
+		PrintInfo("Build context of %s changed (%s), rebuilding", change.Service, summarizeFiles(change.Files))
+		result, err := runner.New(rebuildConfig(upConfig, change.Service)).Up(ctx, stackFile)
+		if err != nil {
+			PrintError("Failed to redeploy %s: %v", change.Service, err)
+			return
+		}
+		for _, service := range result.Services {
+			PrintSuccess("Service %s redeployed: container %d (%s)", service.Name, service.ContainerID, service.Status)
+		}
+	}, func(err error) {
+		PrintWarning("%v", err)
+	})
+
+	PrintInfo("Stopped watching; containers are left running")
+	return nil
+}
+
+// rebuildConfig returns the configuration that redeploys only service,
+// rebuilding its template and recreating its containers
+func rebuildConfig(upConfig runner.Config, service string) *runner.Config {
+	upConfig.Services = []string{service}
+	upConfig.NoDeps = true
+	upConfig.Recreate = []string{service}
+	upConfig.WaitFor = ""
+	return &upConfig
+}
+
+// summarizeFiles names the first few changed files
+func summarizeFiles(files []string) string {
+	const shown = 3
+	if len(files) <= shown {
+		return strings.Join(files, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(files[:shown], ", "), len(files)-shown)
+}
+
+// loadUpStack loads the stack pxc up deploys, with the development
+// overrides applied in development mode
+func loadUpStack() (*models.LXCStack, error) {
+	if upDev {
+		return config.LoadDevelopmentStack(stackFile)
+	}
+	return config.LoadLXCStack(stackFile)
+}
+
 func printUpSummary() {
 	// Load stack to show summary
-	stack, err := config.LoadLXCStack(stackFile)
+	stack, err := loadUpStack()
 	if err != nil {
 		return
 	}
@@ -226,16 +609,42 @@ func printUpSummary() {
 	fmt.Println()
 }
 
-func printUpDryRun() error {
+func printUpDryRun(services []string, scales map[string]int, serviceArgs map[string]map[string]string) error {
 	// Load and validate stack
-	stack, err := config.LoadLXCStack(stackFile)
+	stack, err := loadUpStack()
 	if err != nil {
 		return err
 	}
+	for _, warning := range stack.DeployWarnings() {
+		PrintWarning("%s", warning.Message)
+	}
+
+	if err := stack.ApplyScale(scales); err != nil {
+		return fmt.Errorf("invalid scale override: %w", err)
+	}
 
 	if err := stack.Validate(); err != nil {
 		return fmt.Errorf("invalid stack: %w", err)
 	}
+	if err := stack.CheckBindSources(); err != nil {
+		return fmt.Errorf("invalid stack: %w", err)
+	}
+
+	if waitFor != "" {
+		if _, exists := stack.Services[waitFor]; !exists {
+			return fmt.Errorf("wait-for service '%s' is not defined in the stack", waitFor)
+		}
+	}
+	for service := range serviceArgs {
+		if _, exists := stack.Services[service]; !exists {
+			return fmt.Errorf("build-arg references undefined service '%s'", service)
+		}
+	}
+	for _, service := range services {
+		if _, exists := stack.Services[service]; !exists {
+			return fmt.Errorf("service '%s' is not defined in the stack", service)
+		}
+	}
 
 	fmt.Println("\nDry Run Plan:")
 
@@ -254,8 +663,25 @@ func printUpDryRun() error {
 	if err != nil {
 		return fmt.Errorf("failed to resolve dependencies: %w", err)
 	}
+	if len(services) > 0 {
+		serviceOrder = stack.SelectServices(serviceOrder, services, !noDeps)
+	}
+	if waitFor != "" {
+		serviceOrder = stack.PrioritizeService(serviceOrder, waitFor)
+	}
 
 	step := 3
+
+	// Show init hooks
+	if stack.Hooks != nil && len(stack.Hooks.Init) > 0 {
+		where := "on host"
+		if stack.Hooks.InitTemplate != "" {
+			where = fmt.Sprintf("in ephemeral container from %s", stack.Hooks.InitTemplate)
+		}
+		fmt.Printf("  %d. Execute init hooks %s (%d hooks)\n", step, where, len(stack.Hooks.Init))
+		step++
+	}
+
 	for _, serviceName := range serviceOrder {
 		service := stack.Services[serviceName]
 
@@ -264,8 +690,17 @@ func printUpDryRun() error {
 			step++
 		}
 
-		fmt.Printf("  %d. Create and start container for service '%s'\n", step, serviceName)
+		if service.Scale > 1 {
+			fmt.Printf("  %d. Create and start %d containers for service '%s'\n", step, service.Scale, serviceName)
+		} else {
+			fmt.Printf("  %d. Create and start container for service '%s'\n", step, serviceName)
+		}
 		step++
+
+		if serviceName == waitFor {
+			fmt.Printf("  %d. Wait for service '%s' to become healthy\n", step, serviceName)
+			step++
+		}
 	}
 
 	// Show hooks
@@ -276,24 +711,104 @@ func printUpDryRun() error {
 	return nil
 }
 
+// resolveScales merges replica counts from a scale file with inline --scale
+// values, which take precedence
+func resolveScales(file string, inline map[string]int) (map[string]int, error) {
+	scales := make(map[string]int)
+
+	if file != "" {
+		fileScales, err := config.LoadScaleFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for name, count := range fileScales {
+			scales[name] = count
+		}
+	}
+
+	for name, count := range inline {
+		scales[name] = count
+	}
+
+	return scales, nil
+}
+
+// printServiceResult writes the outcome of deploying a service or replica
+func printServiceResult(service runner.ServiceResult, indent string) {
+	if service.Error != nil {
+		PrintError("%s%s: Failed - %v", indent, service.Name, service.Error)
+		if hint := proxmox.Hint(service.Error); hint != "" {
+			fmt.Printf("%s  Hint: %s\n", indent, hint)
+		}
+		return
+	}
+	fmt.Printf("%s%s%s: Container %d (%s)\n", indent, output.Prefix(output.Success),
+		service.Name, service.ContainerID, service.Status)
+	if len(service.Ports) > 0 {
+		fmt.Printf("%s  Ports: %s\n", indent, strings.Join(service.Ports, ", "))
+	}
+	if IsVerbose() && service.BuildTime > 0 {
+		fmt.Printf("%s  Build time: %v\n", indent, service.BuildTime)
+	}
+	if IsVerbose() && service.StartTime > 0 {
+		fmt.Printf("%s  Start time: %v\n", indent, service.StartTime)
+	}
+}
+
+// printScaledServiceResult writes the outcome of deploying a scaled service,
+// followed by each of its replicas
+func printScaledServiceResult(service runner.ServiceResult) {
+	if service.Error != nil {
+		PrintError("  %s: Failed - %v", service.Name, service.Error)
+	} else {
+		fmt.Printf("  %s%s: %s\n", output.Prefix(output.Success), service.Name, service.Status)
+	}
+	for _, replica := range service.Replicas {
+		printServiceResult(replica, "    ")
+	}
+}
+
+// printServiceOrder writes the topological startup order and the reverse
+// shutdown order for a stack. Circular dependencies are reported instead of
+// an order and returned as an error.
+func printServiceOrder(w io.Writer, stack *models.LXCStack) error {
+	serviceOrder, err := stack.GetServiceDependencyOrder()
+	if err != nil {
+		fmt.Fprintf(w, "Dependency resolution failed: %v\n", err)
+		return fmt.Errorf("failed to resolve dependencies: %w", err)
+	}
+
+	fmt.Fprintln(w, "Startup order:")
+	for i, serviceName := range serviceOrder {
+		fmt.Fprintf(w, "  %d. %s\n", i+1, serviceName)
+	}
+
+	fmt.Fprintln(w, "Shutdown order:")
+	for i, serviceName := range reverseOrder(serviceOrder) {
+		fmt.Fprintf(w, "  %d. %s\n", i+1, serviceName)
+	}
+
+	return nil
+}
+
 func printDeploymentResults(result *runner.DeploymentResult) {
 	PrintSuccess("Stack deployed successfully in %v", result.DeploymentTime)
 
 	if len(result.Services) > 0 {
 		fmt.Println("\nServices:")
 		for _, service := range result.Services {
-			if service.Error != nil {
-				PrintError("  %s: Failed - %v", service.Name, service.Error)
-			} else {
-				fmt.Printf("  ✓ %s: Container %d (%s)\n",
-					service.Name, service.ContainerID, service.Status)
-				if IsVerbose() && service.BuildTime > 0 {
-					fmt.Printf("    Build time: %v\n", service.BuildTime)
-				}
-				if IsVerbose() && service.StartTime > 0 {
-					fmt.Printf("    Start time: %v\n", service.StartTime)
-				}
+			if len(service.Replicas) > 0 {
+				printScaledServiceResult(service)
+				continue
 			}
+			printServiceResult(service, "  ")
+		}
+	}
+
+	if len(result.RemovedReplicas) > 0 {
+		fmt.Println("\nRemoved replicas above scale:")
+		for _, replica := range result.RemovedReplicas {
+			fmt.Printf("  %s%s\n", output.Prefix(output.Success), replica)
 		}
 	}
 
@@ -303,7 +818,7 @@ func printDeploymentResults(result *runner.DeploymentResult) {
 			if network.Error != nil {
 				PrintError("  %s: Failed - %v", network.Name, network.Error)
 			} else {
-				fmt.Printf("  ✓ %s: %s\n", network.Name, network.Status)
+				fmt.Printf("  %s%s: %s\n", output.Prefix(output.Success), network.Name, network.Status)
 			}
 		}
 	}
@@ -314,8 +829,49 @@ func printDeploymentResults(result *runner.DeploymentResult) {
 			if volume.Error != nil {
 				PrintError("  %s: Failed - %v", volume.Name, volume.Error)
 			} else {
-				fmt.Printf("  ✓ %s: %s\n", volume.Name, volume.Status)
+				fmt.Printf("  %s%s: %s\n", output.Prefix(output.Success), volume.Name, volume.Status)
+			}
+		}
+	}
+}
+
+// parseHealthchecks parses --healthcheck SERVICE=COMMAND values. The command
+// may itself contain '=' and ','.
+func parseHealthchecks(values []string) (map[string]string, error) {
+	tests := make(map[string]string, len(values))
+	for _, value := range values {
+		service, test, found := strings.Cut(value, "=")
+		if !found || service == "" || strings.TrimSpace(test) == "" {
+			return nil, fmt.Errorf("invalid healthcheck '%s', expected SERVICE=COMMAND", value)
+		}
+		tests[service] = test
+	}
+	return tests, nil
+}
+
+// splitBuildArgs separates --build-arg values into global args (KEY=VALUE)
+// and service-scoped args (SERVICE:KEY=VALUE)
+func splitBuildArgs(args map[string]string) (map[string]string, map[string]map[string]string, error) {
+	global := make(map[string]string)
+	scoped := make(map[string]map[string]string)
+
+	for key, value := range args {
+		service, name, found := strings.Cut(key, ":")
+		if !found {
+			if key == "" {
+				return nil, nil, fmt.Errorf("invalid build-arg '=%s': name is empty", value)
 			}
+			global[key] = value
+			continue
+		}
+		if service == "" || name == "" {
+			return nil, nil, fmt.Errorf("invalid build-arg '%s=%s', expected SERVICE:KEY=VALUE", key, value)
 		}
+		if scoped[service] == nil {
+			scoped[service] = make(map[string]string)
+		}
+		scoped[service][name] = value
 	}
+
+	return global, scoped, nil
 }
@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/runner"
 )
 
 func TestUpCommand(t *testing.T) {
@@ -458,4 +463,307 @@ services:
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestPrintServiceOrder(t *testing.T) {
+	t.Run("dependency chain", func(t *testing.T) {
+		stack := &models.LXCStack{
+			Services: map[string]models.Service{
+				"web":      {Template: "nginx:latest", DependsOn: []string{"api"}},
+				"api":      {Template: "node:latest", DependsOn: []string{"database"}},
+				"database": {Template: "postgres:15"},
+			},
+		}
+
+		var buf bytes.Buffer
+		if err := printServiceOrder(&buf, stack); err != nil {
+			t.Fatalf("printServiceOrder() unexpected error: %v", err)
+		}
+
+		expected := `Startup order:
+  1. database
+  2. api
+  3. web
+Shutdown order:
+  1. web
+  2. api
+  3. database
+`
+		if buf.String() != expected {
+			t.Errorf("printServiceOrder() output =\n%s\nwant\n%s", buf.String(), expected)
+		}
+	})
+
+	t.Run("circular dependency", func(t *testing.T) {
+		stack := &models.LXCStack{
+			Services: map[string]models.Service{
+				"web": {Template: "nginx:latest", DependsOn: []string{"api"}},
+				"api": {Template: "node:latest", DependsOn: []string{"web"}},
+			},
+		}
+
+		var buf bytes.Buffer
+		err := printServiceOrder(&buf, stack)
+		if err == nil {
+			t.Fatal("printServiceOrder() expected error for circular dependency")
+		}
+
+		output := buf.String()
+		if !strings.Contains(output, "circular dependency") {
+			t.Errorf("Expected output to report circular dependency, got: %s", output)
+		}
+		if !strings.Contains(output, "api -> web -> api") {
+			t.Errorf("Expected output to show the cycle path, got: %s", output)
+		}
+		if strings.Contains(output, "Startup order") {
+			t.Errorf("Expected no order to be printed for a cycle, got: %s", output)
+		}
+	})
+}
+
+func TestServicesAfterWaitFor(t *testing.T) {
+	dir := t.TempDir()
+	stackFile = filepath.Join(dir, "lxc-stack.yml")
+	defer func() { stackFile = "" }()
+	stack := `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - api
+  api:
+    template: "node:18"
+    depends_on:
+      - database
+  database:
+    template: "postgres:15"
+  cache:
+    template: "redis:7"
+`
+	if err := os.WriteFile(stackFile, []byte(stack), 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		waitFor  string
+		services []string
+		noDeps   bool
+		want     []string
+		wantErr  string
+	}{
+		{name: "whole stack", waitFor: "api", want: []string{"cache", "web"}},
+		{name: "selected services", waitFor: "database", services: []string{"api"}, want: []string{"api"}},
+		{name: "without dependencies", waitFor: "api", services: []string{"api", "web"}, noDeps: true, want: []string{"web"}},
+		{name: "nothing left", waitFor: "web", services: []string{"web"}},
+		{name: "undefined service", waitFor: "queue", wantErr: "wait-for service 'queue' is not defined in the stack"},
+		{name: "not deployed", waitFor: "cache", services: []string{"web"}, wantErr: "wait-for service 'cache' is not among the services being deployed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waitFor, noDeps = tt.waitFor, tt.noDeps
+			defer func() { waitFor, noDeps = "", false }()
+
+			got, err := servicesAfterWaitFor(tt.services)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("servicesAfterWaitFor() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("servicesAfterWaitFor() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("servicesAfterWaitFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForConfig(t *testing.T) {
+	upConfig := runner.Config{WaitFor: "database", Services: []string{"web", "cache"}, NoDeps: true}
+
+	first := waitForConfig(upConfig)
+	if !reflect.DeepEqual(first.Services, []string{"database"}) || !first.NoDeps || first.WaitFor != "database" {
+		t.Errorf("waitForConfig() = %+v, want only the database with the run's options", first)
+	}
+	if !reflect.DeepEqual(upConfig.Services, []string{"web", "cache"}) {
+		t.Errorf("waitForConfig() changed the run's services to %v", upConfig.Services)
+	}
+
+	args := []string{"up", "-d", "--wait-for", "database"}
+	if got := resumeArgs(args); !reflect.DeepEqual(got, []string{"up", "-d", "--wait-for", "database", "--wait-for-resume"}) {
+		t.Errorf("resumeArgs() = %v", got)
+	}
+}
+
+func TestResolveScales(t *testing.T) {
+	scaleFilePath := filepath.Join(t.TempDir(), "scales.yml")
+	if err := os.WriteFile(scaleFilePath, []byte("web: 3\nworker: 2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write scale file: %v", err)
+	}
+
+	newStack := func() *models.LXCStack {
+		return &models.LXCStack{
+			Version: "1.0",
+			Services: map[string]models.Service{
+				"web":    {Template: "nginx:latest", Scale: 1},
+				"worker": {Template: "python:3.11", Scale: 1},
+			},
+		}
+	}
+
+	t.Run("scale file applies over stack values", func(t *testing.T) {
+		scales, err := resolveScales(scaleFilePath, nil)
+		if err != nil {
+			t.Fatalf("resolveScales() unexpected error: %v", err)
+		}
+
+		stack := newStack()
+		if err := stack.ApplyScale(scales); err != nil {
+			t.Fatalf("ApplyScale() unexpected error: %v", err)
+		}
+		if stack.Services["web"].Scale != 3 || stack.Services["worker"].Scale != 2 {
+			t.Errorf("scales = web:%d worker:%d, want web:3 worker:2",
+				stack.Services["web"].Scale, stack.Services["worker"].Scale)
+		}
+	})
+
+	t.Run("inline scale wins over scale file", func(t *testing.T) {
+		scales, err := resolveScales(scaleFilePath, map[string]int{"worker": 5})
+		if err != nil {
+			t.Fatalf("resolveScales() unexpected error: %v", err)
+		}
+		if scales["worker"] != 5 {
+			t.Errorf("worker scale = %d, want inline value 5", scales["worker"])
+		}
+		if scales["web"] != 3 {
+			t.Errorf("web scale = %d, want scale file value 3", scales["web"])
+		}
+	})
+
+	t.Run("unknown service in scale file", func(t *testing.T) {
+		unknownPath := filepath.Join(t.TempDir(), "scales.yml")
+		if err := os.WriteFile(unknownPath, []byte("api: 2\n"), 0644); err != nil {
+			t.Fatalf("Failed to write scale file: %v", err)
+		}
+
+		scales, err := resolveScales(unknownPath, nil)
+		if err != nil {
+			t.Fatalf("resolveScales() unexpected error: %v", err)
+		}
+
+		err = newStack().ApplyScale(scales)
+		if err == nil || !strings.Contains(err.Error(), "undefined service 'api'") {
+			t.Errorf("ApplyScale() error = %v, want undefined service error", err)
+		}
+	})
+}
+
+func TestSplitBuildArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     map[string]string
+		global   map[string]string
+		scoped   map[string]map[string]string
+		errorMsg string
+	}{
+		{
+			name:   "global only",
+			args:   map[string]string{"VERSION": "1.0", "NODE_ENV": "production"},
+			global: map[string]string{"VERSION": "1.0", "NODE_ENV": "production"},
+			scoped: map[string]map[string]string{},
+		},
+		{
+			name:   "scoped to services",
+			args:   map[string]string{"web:VERSION": "2.0", "api:VERSION": "3.1", "api:DEBUG": "1"},
+			global: map[string]string{},
+			scoped: map[string]map[string]string{
+				"web": {"VERSION": "2.0"},
+				"api": {"VERSION": "3.1", "DEBUG": "1"},
+			},
+		},
+		{
+			name:   "global and scoped together",
+			args:   map[string]string{"VERSION": "1.0", "web:VERSION": "2.0"},
+			global: map[string]string{"VERSION": "1.0"},
+			scoped: map[string]map[string]string{"web": {"VERSION": "2.0"}},
+		},
+		{
+			name:     "empty service",
+			args:     map[string]string{":VERSION": "1.0"},
+			errorMsg: "expected SERVICE:KEY=VALUE",
+		},
+		{
+			name:     "empty key",
+			args:     map[string]string{"web:": "1.0"},
+			errorMsg: "expected SERVICE:KEY=VALUE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global, scoped, err := splitBuildArgs(tt.args)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("splitBuildArgs() error = %v, want containing %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitBuildArgs() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(global, tt.global) {
+				t.Errorf("global = %v, want %v", global, tt.global)
+			}
+			if !reflect.DeepEqual(scoped, tt.scoped) {
+				t.Errorf("scoped = %v, want %v", scoped, tt.scoped)
+			}
+		})
+	}
+}
+
+func TestParseHealthchecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		expected map[string]string
+		errorMsg string
+	}{
+		{
+			name:     "command with equals and commas",
+			values:   []string{"web=curl -sf 'localhost:3000/health?a=1,b=2'", "cache=redis-cli ping"},
+			expected: map[string]string{"web": "curl -sf 'localhost:3000/health?a=1,b=2'", "cache": "redis-cli ping"},
+		},
+		{
+			name:     "missing command",
+			values:   []string{"web="},
+			errorMsg: "invalid healthcheck 'web=', expected SERVICE=COMMAND",
+		},
+		{
+			name:     "missing service",
+			values:   []string{"curl -sf localhost"},
+			errorMsg: "invalid healthcheck 'curl -sf localhost', expected SERVICE=COMMAND",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHealthchecks(tt.values)
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Errorf("parseHealthchecks() error = %v, want %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHealthchecks() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parseHealthchecks() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"fmt"
 	"path/filepath"
 
 	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/state"
 )
 
 // truncateString truncates a string to maxLen characters
@@ -44,3 +47,95 @@ func getVolumeNames(stack *models.LXCStack) []string {
 	}
 	return names
 }
+
+// reverseOrder returns a reversed copy of a service order, used for shutdown
+func reverseOrder(order []string) []string {
+	reversed := make([]string, len(order))
+	for i, name := range order {
+		reversed[len(order)-1-i] = name
+	}
+	return reversed
+}
+
+// resolveServiceContainer finds the container ID recorded by 'pxc up' for a
+// service replica. Replica 1 is recorded under the service name; further
+// replicas are recorded as service-N.
+func resolveServiceContainer(stack *models.LXCStack, projectState *state.ProjectState, service string, index int) (int, error) {
+	definition, exists := stack.Services[service]
+	if !exists {
+		return 0, fmt.Errorf("service '%s' is not defined in the stack", service)
+	}
+
+	if index < 1 {
+		return 0, fmt.Errorf("index must be at least 1")
+	}
+	replicas := definition.Scale
+	if replicas < 1 {
+		replicas = 1
+	}
+	if index > replicas {
+		return 0, fmt.Errorf("service '%s' has %d replica(s), index %d is out of range", service, replicas, index)
+	}
+
+	keys := []string{fmt.Sprintf("%s-%d", service, index)}
+	if index == 1 {
+		keys = append([]string{service}, keys...)
+	}
+	for _, key := range keys {
+		if recorded, exists := projectState.Services[key]; exists {
+			return recorded.ContainerID, nil
+		}
+	}
+
+	if index > 1 {
+		return 0, fmt.Errorf("replica %d of service '%s' has no container (run 'pxc up' first)", index, service)
+	}
+	return 0, fmt.Errorf("service '%s' has no container (run 'pxc up' first)", service)
+}
+
+// loadStackState loads the stack file and the state recorded for the project
+func loadStackState() (*models.LXCStack, *state.ProjectState, error) {
+	if stackFile == "" {
+		stackFile = config.GetDefaultStackfile()
+	}
+	if err := config.ValidateConfigExists(stackFile); err != nil {
+		return nil, nil, err
+	}
+	if err := loadProjectConfig(stackFile); err != nil {
+		return nil, nil, err
+	}
+	if projectName == "" {
+		projectName = getProjectNameFromPath(stackFile)
+	}
+
+	projectState, err := state.Load(state.Path(filepath.Dir(stackFile), projectName), projectName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stack, err := loadProjectStack(projectState)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stack, projectState, nil
+}
+
+// loadProjectStack loads the stack file as the project was last deployed:
+// with the development overrides if pxc up --dev deployed it
+func loadProjectStack(projectState *state.ProjectState) (*models.LXCStack, error) {
+	if projectState.Development {
+		return config.LoadDevelopmentStack(stackFile)
+	}
+	return config.LoadLXCStack(stackFile)
+}
+
+// resolveServiceTarget loads the stack and project state and returns the
+// container ID of a service replica
+func resolveServiceTarget(service string, index int) (int, error) {
+	stack, projectState, err := loadStackState()
+	if err != nil {
+		return 0, err
+	}
+
+	return resolveServiceContainer(stack, projectState, service, index)
+}
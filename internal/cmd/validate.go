@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/runner"
+)
+
+var (
+	validateFormat        string
+	validateCheckCapacity bool
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate [OPTIONS]",
+	Short: "Check a stack file or LXCfile for errors and warnings",
+	Long: `Validate loads a stack file, including the files it includes, and reports
+its validation error and lint warnings without deploying anything.
+
+Each problem is reported with the file, line and YAML path it refers to, such
+as services.web.dns. Errors prevent 'pxc up' from deploying the stack:
+  • The first validation error of the stack, such as duplicate host ports
+    or a depends_on naming an undefined service
+  • Dependency cycles in depends_on
+  • Build contexts that do not exist or have no LXCfile, and errors in the
+    LXCfiles of build contexts
+
+Warnings point out practices that make deployments fragile and definitions
+that have no effect:
+  • Templates using the latest tag
+  • Networks and volumes no service uses
+  • A depends_on naming a service that shares no network with it
+  • Deploy settings pxc ignores
+
+With --check-capacity, the memory and cores the services request are also
+compared with the nodes they are placed on, which needs access to Proxmox.
+
+A file named LXCfile* is validated as an LXCfile: its validation error and
+copy steps whose source does not exist are reported.
+
+Use --format json for a list of {file, path, line, message, severity}
+objects that editors and CI can consume. The command exits with status 1 if
+any error is found.`,
+	Example: `  # Check the default stack file
+  pxc validate
+
+  # Machine-readable report of another stack file
+  pxc validate -f lxc-stack.prod.yml --format json
+
+  # Check an LXCfile
+  pxc validate -f LXCfile.yml
+
+  # Also check that the stack fits its nodes
+  pxc validate --check-capacity`,
+	Args: cobra.NoArgs,
+	RunE: runValidate,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file or LXCfile (default: lxc-stack.yml)")
+	validateCmd.Flags().StringVar(&validateFormat, "format", "", "Output format (json)")
+	validateCmd.Flags().BoolVar(&validateCheckCapacity, "check-capacity", false, "Compare the stack's resources with its nodes")
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	if validateFormat != "" && validateFormat != "json" {
+		return fmt.Errorf("unsupported format '%s' (supported: json)", validateFormat)
+	}
+	if stackFile == "" {
+		stackFile = config.GetDefaultStackfile()
+	}
+
+	var problems []config.Problem
+	var err error
+	if isLXCfile(stackFile) {
+		problems, err = config.ValidateLXCfile(stackFile)
+	} else {
+		problems, err = config.ValidateStack(stackFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	if validateCheckCapacity && !isLXCfile(stackFile) && !hasErrors(problems) {
+		capacityProblems, err := checkStackCapacity(stackFile)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, capacityProblems...)
+	}
+
+	if validateFormat == "json" {
+		if err := printProblemsJSON(os.Stdout, problems); err != nil {
+			return err
+		}
+	} else {
+		printProblems(os.Stdout, stackFile, problems)
+	}
+
+	// The report already says what is wrong
+	if hasErrors(problems) {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// isLXCfile reports whether a file to validate is an LXCfile rather than a
+// stack file, going by its name
+func isLXCfile(filename string) bool {
+	return strings.HasPrefix(strings.ToLower(filepath.Base(filename)), "lxcfile")
+}
+
+// hasErrors reports whether any problem is an error
+func hasErrors(problems []config.Problem) bool {
+	for _, problem := range problems {
+		if problem.Severity == config.SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStackCapacity reports the nodes the stack's resources exceed as
+// warnings on the stack file
+func checkStackCapacity(stackFile string) ([]config.Problem, error) {
+	api, err := proxmoxAPI()
+	if err != nil {
+		return nil, err
+	}
+	orchestrator := runner.New(&runner.Config{
+		Verbose:     IsVerbose(),
+		BaseDir:     filepath.Dir(stackFile),
+		ProxmoxNode: viper.GetString("proxmox_node"),
+		Storage:     viper.GetString("storage"),
+		Output:      io.Discard,
+		API:         api,
+	})
+	messages, err := orchestrator.CheckCapacity(stackFile)
+	if err != nil {
+		return nil, err
+	}
+	var problems []config.Problem
+	for _, message := range messages {
+		problems = append(problems, config.Problem{File: stackFile, Message: message, Severity: config.SeverityWarning})
+	}
+	return problems, nil
+}
+
+// printProblemsJSON writes problems as a JSON array, empty rather than null
+// for a clean stack
+func printProblemsJSON(w io.Writer, problems []config.Problem) error {
+	if problems == nil {
+		problems = []config.Problem{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(problems)
+}
+
+// printProblems writes one file:line: severity: message line per problem,
+// in the format compilers use so editors can jump to it
+func printProblems(w io.Writer, filename string, problems []config.Problem) {
+	if len(problems) == 0 {
+		fmt.Fprintf(w, "%s: no problems found\n", filename)
+		return
+	}
+	for _, problem := range problems {
+		location := problem.File
+		if problem.Line > 0 {
+			location = fmt.Sprintf("%s:%d", problem.File, problem.Line)
+		}
+		if problem.Path != "" {
+			fmt.Fprintf(w, "%s: %s: %s (at %s)\n", location, problem.Severity, problem.Message, problem.Path)
+		} else {
+			fmt.Fprintf(w, "%s: %s: %s\n", location, problem.Severity, problem.Message)
+		}
+	}
+}
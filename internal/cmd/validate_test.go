@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+)
+
+func TestValidateJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lxc-stack.yml")
+	content := `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: -1
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+
+	problems, err := config.ValidateStack(path)
+	if err != nil {
+		t.Fatalf("ValidateStack() unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := printProblemsJSON(&buf, problems); err != nil {
+		t.Fatalf("printProblemsJSON() unexpected error: %v", err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not a JSON array: %v\n%s", err, buf.String())
+	}
+	expected := []map[string]interface{}{
+		{"file": path, "path": "services.web.scale", "line": float64(5), "message": "service 'web': scale cannot be negative", "severity": "error"},
+		{"file": path, "path": "services.web.template", "line": float64(4), "message": "service 'web': template 'nginx:latest' uses the latest tag; pin a version so redeploys are reproducible", "severity": "warning"},
+	}
+	if len(decoded) != len(expected) {
+		t.Fatalf("got %d problems, want %d:\n%s", len(decoded), len(expected), buf.String())
+	}
+	for i, want := range expected {
+		for key, value := range want {
+			if decoded[i][key] != value {
+				t.Errorf("problem %d %s = %v, want %v", i, key, decoded[i][key], value)
+			}
+		}
+	}
+
+	t.Run("clean stack is an empty array", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := printProblemsJSON(&buf, nil); err != nil {
+			t.Fatalf("printProblemsJSON() unexpected error: %v", err)
+		}
+		if strings.TrimSpace(buf.String()) != "[]" {
+			t.Errorf("output = %q, want []", buf.String())
+		}
+	})
+
+	t.Run("text lists file, line and path", func(t *testing.T) {
+		var buf bytes.Buffer
+		printProblems(&buf, path, problems)
+		want := path + ":5: error: service 'web': scale cannot be negative (at services.web.scale)\n"
+		if !strings.HasPrefix(buf.String(), want) {
+			t.Errorf("output = %q, want it to start with %q", buf.String(), want)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+var versionOutput string
+
+// versionInfo is the machine-readable form of the version command
+type versionInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// versionCmd represents the version command
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show version information",
+	Example: `  # Show version, Go version and platform
+  pxc version
+
+  # Include git commit and build date
+  pxc version --verbose
+
+  # Machine-readable output for tooling
+  pxc version --output json`,
+	RunE: runVersion,
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+
+	versionCmd.Flags().StringVarP(&versionOutput, "output", "o", "", "Output format (json)")
+}
+
+func runVersion(cmd *cobra.Command, args []string) error {
+	return printVersion(cmd.OutOrStdout(), versionOutput)
+}
+
+func currentVersionInfo() versionInfo {
+	return versionInfo{
+		Version:   version,
+		GitCommit: gitCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+// printVersion writes version information in the requested format
+func printVersion(w io.Writer, format string) error {
+	info := currentVersionInfo()
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	case "":
+		fmt.Fprintf(w, "pxc version %s\n", info.Version)
+		fmt.Fprintf(w, "Go version: %s\n", info.GoVersion)
+		fmt.Fprintf(w, "Platform: %s\n", info.Platform)
+		if verbose {
+			fmt.Fprintf(w, "Git commit: %s\n", info.GitCommit)
+			fmt.Fprintf(w, "Build date: %s\n", info.BuildDate)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format '%s' (supported: json)", format)
+	}
+}
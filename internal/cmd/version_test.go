@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPrintVersion(t *testing.T) {
+	originalVersion, originalCommit, originalDate := version, gitCommit, buildDate
+	defer SetVersionInfo(originalVersion, originalCommit, originalDate)
+
+	SetVersionInfo("1.4.0", "abc1234", "2024-05-01T12:00:00Z")
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+
+	t.Run("json output", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := printVersion(&buf, "json"); err != nil {
+			t.Fatalf("printVersion() unexpected error: %v", err)
+		}
+
+		var info map[string]string
+		if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+			t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+		}
+
+		expected := map[string]string{
+			"version":    "1.4.0",
+			"git_commit": "abc1234",
+			"build_date": "2024-05-01T12:00:00Z",
+			"go_version": runtime.Version(),
+			"platform":   platform,
+		}
+		for key, want := range expected {
+			if info[key] != want {
+				t.Errorf("%s = %q, want %q", key, info[key], want)
+			}
+		}
+	})
+
+	t.Run("human output includes go version and platform", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := printVersion(&buf, ""); err != nil {
+			t.Fatalf("printVersion() unexpected error: %v", err)
+		}
+
+		output := buf.String()
+		for _, want := range []string{"pxc version 1.4.0", "Go version: " + runtime.Version(), "Platform: " + platform} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Output missing %q, got:\n%s", want, output)
+			}
+		}
+		if strings.Contains(output, "abc1234") {
+			t.Errorf("Git commit should only be shown with --verbose, got:\n%s", output)
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		err := printVersion(&bytes.Buffer{}, "xml")
+		if err == nil || err.Error() != "unsupported output format 'xml' (supported: json)" {
+			t.Errorf("printVersion() error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brynnjknight/proxer/pkg/runner"
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch [OPTIONS] [SERVICE...]",
+	Short: "Push changed source files into running service containers",
+	Long: `Watch the host files and directories that the LXCfiles of services copy
+into their templates, and push the files that change into the running
+containers of the service, until interrupted with Ctrl+C.
+
+This gives a save-and-reload loop without rebuilding the template: each
+changed file is pushed with pct push to the path its copy step gives it,
+with its host permissions and the owner of the copy step, into every
+replica of the service. Files deleted on the host are removed from the
+containers. A service with a reload_signal is sent it after each sync.
+
+Without arguments, every service with a build context is watched. Copy
+steps from build stages or with build arguments in their source are not
+watched, nor paths the service bind-mounts a volume over, such as the
+source directories 'pxc up --dev' mounts, which are live already.
+
+Use 'pxc up --watch' instead to rebuild and recreate a service when
+anything in its build context changes, e.g. its setup commands.`,
+	Example: `  # Push source changes into every service
+  pxc watch
+
+  # Only the web service
+  pxc watch web`,
+	RunE: runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringVarP(&stackFile, "file", "f", "", "Path to stack file (default: lxc-stack.yml)")
+	watchCmd.Flags().StringVar(&projectName, "project-name", "", "Project name (default: directory name)")
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	stack, _, err := loadStackState()
+	if err != nil {
+		return err
+	}
+	for _, name := range args {
+		if _, exists := stack.Services[name]; !exists {
+			return fmt.Errorf("service '%s' is not defined in the stack", name)
+		}
+	}
+
+	rules, err := runner.SyncRules(stack, args)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		PrintWarning("No copied files to watch")
+		return nil
+	}
+	sources := make(map[string]string, len(rules))
+	byName := make(map[string]runner.SyncRule, len(rules))
+	for _, rule := range rules {
+		sources[rule.Name()] = rule.Source
+		byName[rule.Name()] = rule
+		PrintInfo("Watching %s for %s:%s", rule.Source, rule.Service, rule.Dest)
+	}
+	watcher, err := runner.NewWatcher(sources, runner.DefaultWatchInterval, runner.DefaultWatchDebounce)
+	if err != nil {
+		return err
+	}
+
+	orchestrator, err := lifecycleOrchestrator()
+	if err != nil {
+		return err
+	}
+	PrintInfo("Press Ctrl+C to stop")
+
+	stop := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	watcher.Run(stop, func(change runner.WatchChange) {
+		rule := byName[change.Service]
+		if err := orchestrator.SyncFiles(context.Background(), stackFile, rule, change.Files); err != nil {
+			PrintError("%v", err)
+			return
+		}
+		PrintSuccess("Synced %s to %s:%s", summarizeFiles(change.Files), rule.Service, rule.Dest)
+	}, func(err error) {
+		PrintWarning("%v", err)
+	})
+
+	PrintInfo("Stopped watching")
+	return nil
+}
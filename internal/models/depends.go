@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Conditions a dependency must meet before a service depending on it is
+// deployed
+const (
+	// ConditionServiceStarted waits for the dependency to be deployed; a
+	// failing health check of the dependency does not hold the service back
+	ConditionServiceStarted = "service_started"
+	// ConditionServiceHealthy waits for the dependency to pass its health
+	// check, and fails the service if it does not
+	ConditionServiceHealthy = "service_healthy"
+)
+
+// DependencyCondition returns the condition of a dependency of the service,
+// service_started unless the map form of depends_on set another
+func (s *Service) DependencyCondition(dependency string) string {
+	if condition := s.DependsOnConditions[dependency]; condition != "" {
+		return condition
+	}
+	return ConditionServiceStarted
+}
+
+// UnmarshalYAML decodes a service, accepting depends_on as a list of
+// service names or, as in Compose, a map of names to {condition: ...}, and
+// secrets entries as names or, as in Compose, {source: ..., target: ...}
+func (s *Service) UnmarshalYAML(value *yaml.Node) error {
+	type plain Service
+
+	node := *value
+	var conditions map[string]string
+	var secretMounts map[string]FileMount
+	if value.Kind == yaml.MappingNode {
+		node.Content = append([]*yaml.Node(nil), value.Content...)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, content := node.Content[i].Value, node.Content[i+1]
+			switch {
+			case key == "depends_on" && content.Kind == yaml.MappingNode:
+				names, parsed, err := parseDependencyMap(content)
+				if err != nil {
+					return err
+				}
+				node.Content[i+1] = names
+				conditions = parsed
+			case key == "secrets" && content.Kind == yaml.SequenceNode:
+				names, mounts, err := parseFileRefs(key, content)
+				if err != nil {
+					return err
+				}
+				node.Content[i+1] = names
+				secretMounts = mounts
+			}
+		}
+	}
+
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.DependsOnConditions = conditions
+	s.SecretMounts = secretMounts
+	return nil
+}
+
+// parseDependencyMap turns the map form of depends_on into a sequence of
+// the service names, in the order given, and their conditions
+func parseDependencyMap(node *yaml.Node) (*yaml.Node, map[string]string, error) {
+	names := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: node.Line, Column: node.Column}
+	conditions := make(map[string]string)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+		var options struct {
+			Condition string `yaml:"condition"`
+		}
+		if err := node.Content[i+1].Decode(&options); err != nil {
+			return nil, nil, fmt.Errorf("depends_on %s: %w", name, err)
+		}
+		if options.Condition != "" {
+			conditions[name] = options.Condition
+		}
+		names.Content = append(names.Content, node.Content[i])
+	}
+	return names, conditions, nil
+}
+
+// MarshalYAML writes depends_on in the map form when a dependency has a
+// condition, and secrets with a mount in the long form, so a stack
+// survives a round trip
+func (s Service) MarshalYAML() (interface{}, error) {
+	type plain Service
+
+	var node yaml.Node
+	if err := node.Encode(plain(s)); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "secrets" && len(s.SecretMounts) > 0 {
+			refs, err := fileRefsNode(s.Secrets, s.SecretMounts)
+			if err != nil {
+				return nil, err
+			}
+			node.Content[i+1] = refs
+		}
+		if node.Content[i].Value != "depends_on" || len(s.DependsOnConditions) == 0 {
+			continue
+		}
+		dependencies := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, name := range s.DependsOn {
+			condition := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			condition.Content = []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "condition"},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: s.DependencyCondition(name)},
+			}
+			dependencies.Content = append(dependencies.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, condition)
+		}
+		node.Content[i+1] = dependencies
+	}
+	return &node, nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDependsOnConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		dependsOn  string
+		wantOrder  []string
+		wantHealth bool
+		wantErr    string
+	}{
+		{
+			name:      "list",
+			dependsOn: "[database, cache]",
+			wantOrder: []string{"database", "cache"},
+		},
+		{
+			name: "map keeps order",
+			dependsOn: `
+      database:
+        condition: service_healthy
+      cache:
+        condition: service_started`,
+			wantOrder:  []string{"database", "cache"},
+			wantHealth: true,
+		},
+		{
+			name: "map without condition",
+			dependsOn: `
+      cache: {}`,
+			wantOrder: []string{"cache"},
+		},
+		{
+			name: "unknown condition",
+			dependsOn: `
+      database:
+        condition: service_completed_successfully`,
+			wantErr: "unsupported condition 'service_completed_successfully'",
+		},
+		{
+			name: "healthy without health check",
+			dependsOn: `
+      cache:
+        condition: service_healthy`,
+			wantErr: "needs a health check on service 'cache'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    depends_on: ` + tt.dependsOn + `
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+  cache:
+    template: "redis:7"
+`
+			var stack LXCStack
+			if err := yaml.Unmarshal([]byte(content), &stack); err != nil {
+				t.Fatalf("Unmarshal() unexpected error: %v", err)
+			}
+
+			err := stack.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() unexpected error: %v", err)
+			}
+
+			web := stack.Services["web"]
+			if strings.Join(web.DependsOn, ",") != strings.Join(tt.wantOrder, ",") {
+				t.Errorf("DependsOn = %v, want %v", web.DependsOn, tt.wantOrder)
+			}
+			if got := web.DependencyCondition("database") == ConditionServiceHealthy; got != tt.wantHealth {
+				t.Errorf("database condition = %q", web.DependencyCondition("database"))
+			}
+			if got := web.DependencyCondition("cache"); got != ConditionServiceStarted {
+				t.Errorf("cache condition = %q, want %q", got, ConditionServiceStarted)
+			}
+		})
+	}
+}
+
+func TestDependsOnConditionsRoundTrip(t *testing.T) {
+	service := Service{
+		Template:            "nginx:latest",
+		DependsOn:           []string{"database", "cache"},
+		DependsOnConditions: map[string]string{"database": ConditionServiceHealthy},
+	}
+
+	data, err := yaml.Marshal(service)
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), "condition: service_healthy") {
+		t.Errorf("Marshal() = %s, want the map form of depends_on", data)
+	}
+
+	var decoded Service
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	if strings.Join(decoded.DependsOn, ",") != "database,cache" || decoded.DependencyCondition("database") != ConditionServiceHealthy {
+		t.Errorf("round trip = %v %v", decoded.DependsOn, decoded.DependsOnConditions)
+	}
+}
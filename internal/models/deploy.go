@@ -0,0 +1,176 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Deploy is the Compose deploy block, accepted so Compose files can be
+// migrated as they are. Replicas and resources are mapped onto scale and
+// resources; other keys are reported by DeployWarnings and ignored.
+type Deploy struct {
+	Replicas  int                    `yaml:"replicas,omitempty"`
+	Resources *DeployResources       `yaml:"resources,omitempty"`
+	Other     map[string]interface{} `yaml:",inline"`
+}
+
+// DeployResources holds the Compose resource limits and reservations
+type DeployResources struct {
+	Limits       *DeployResourceSpec    `yaml:"limits,omitempty"`
+	Reservations *DeployResourceSpec    `yaml:"reservations,omitempty"`
+	Other        map[string]interface{} `yaml:",inline"`
+}
+
+// DeployResourceSpec is a Compose limit or reservation, e.g. cpus: "0.5"
+// and memory: 512M
+type DeployResourceSpec struct {
+	CPUs   string                 `yaml:"cpus,omitempty"`
+	Memory string                 `yaml:"memory,omitempty"`
+	Other  map[string]interface{} `yaml:",inline"`
+}
+
+// ApplyDeploy maps the deploy block of each service onto its scale and
+// resources. Scale and resources set on the service itself take precedence.
+func (s *LXCStack) ApplyDeploy() error {
+	for name, service := range s.Services {
+		if service.Deploy == nil {
+			continue
+		}
+		if err := service.applyDeploy(); err != nil {
+			return fmt.Errorf("service '%s': %w", name, err)
+		}
+		s.Services[name] = service
+	}
+	return nil
+}
+
+func (service *Service) applyDeploy() error {
+	deploy := service.Deploy
+	if deploy.Replicas < 0 {
+		return fmt.Errorf("deploy.replicas cannot be negative")
+	}
+	if deploy.Replicas > 0 {
+		if service.Scale != 0 && service.Scale != deploy.Replicas {
+			return fmt.Errorf("scale %d conflicts with deploy.replicas %d", service.Scale, deploy.Replicas)
+		}
+		service.Scale = deploy.Replicas
+	}
+
+	resources, err := deploy.resources()
+	if err != nil {
+		return err
+	}
+	if resources != (Resources{}) {
+		if service.Resources != nil {
+			resources = resources.Override(*service.Resources)
+		}
+		service.Resources = &resources
+	}
+	return nil
+}
+
+// resources converts the deploy resources. Proxmox has no reservations, so
+// a reservation is allocated as is unless a limit is also given.
+func (deploy *Deploy) resources() (Resources, error) {
+	var resources Resources
+	if deploy.Resources == nil {
+		return resources, nil
+	}
+
+	specs := []struct {
+		key  string
+		spec *DeployResourceSpec
+	}{
+		{"reservations", deploy.Resources.Reservations},
+		{"limits", deploy.Resources.Limits},
+	}
+	for _, entry := range specs {
+		if entry.spec == nil {
+			continue
+		}
+		if entry.spec.CPUs != "" {
+			cpus, err := strconv.ParseFloat(entry.spec.CPUs, 64)
+			if err != nil || cpus <= 0 {
+				return resources, fmt.Errorf("invalid deploy.resources.%s.cpus '%s', must be a positive number", entry.key, entry.spec.CPUs)
+			}
+			resources.Cores = int(math.Ceil(cpus))
+		}
+		if entry.spec.Memory != "" {
+			memory, err := parseDeployMemory(entry.spec.Memory)
+			if err != nil {
+				return resources, fmt.Errorf("invalid deploy.resources.%s.memory '%s', must be a size such as 512M or 1G", entry.key, entry.spec.Memory)
+			}
+			resources.Memory = memory
+		}
+	}
+	return resources, nil
+}
+
+// parseDeployMemory converts a Compose memory size to MB, rounding up
+func parseDeployMemory(size string) (int, error) {
+	match := shmSizePattern.FindStringSubmatch(strings.TrimSpace(size))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size")
+	}
+	value, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("invalid size")
+	}
+	switch strings.ToLower(match[2]) {
+	case "":
+		return int((value + 1<<20 - 1) >> 20), nil
+	case "k":
+		return int((value + 1<<10 - 1) >> 10), nil
+	case "g":
+		return int(value << 10), nil
+	}
+	return int(value), nil
+}
+
+// DeployWarnings reports the deploy keys of each service that pxc does not
+// map, such as placement or update_config
+func (s *LXCStack) DeployWarnings() []LintWarning {
+	names := make([]string, 0, len(s.Services))
+	for name := range s.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []LintWarning
+	for _, name := range names {
+		deploy := s.Services[name].Deploy
+		if deploy == nil {
+			continue
+		}
+		unmapped := unmappedKeys("deploy", deploy.Other)
+		if deploy.Resources != nil {
+			unmapped = append(unmapped, unmappedKeys("deploy.resources", deploy.Resources.Other)...)
+			if deploy.Resources.Limits != nil {
+				unmapped = append(unmapped, unmappedKeys("deploy.resources.limits", deploy.Resources.Limits.Other)...)
+			}
+			if deploy.Resources.Reservations != nil {
+				unmapped = append(unmapped, unmappedKeys("deploy.resources.reservations", deploy.Resources.Reservations.Other)...)
+			}
+		}
+		for _, key := range unmapped {
+			warnings = append(warnings, LintWarning{
+				Path:    "services." + name + "." + key,
+				Message: fmt.Sprintf("service '%s': %s is not supported and is ignored", name, key),
+			})
+		}
+	}
+	return warnings
+}
+
+// unmappedKeys returns the sorted keys of other prefixed with their block
+func unmappedKeys(block string, other map[string]interface{}) []string {
+	keys := make([]string, 0, len(other))
+	for key := range other {
+		keys = append(keys, block+"."+key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestApplyDeploy(t *testing.T) {
+	tests := []struct {
+		name          string
+		service       Service
+		wantScale     int
+		wantResources *Resources
+		errorMsg      string
+	}{
+		{
+			name:          "replicas and limits",
+			service:       Service{Deploy: &Deploy{Replicas: 3, Resources: &DeployResources{Limits: &DeployResourceSpec{CPUs: "0.5", Memory: "1G"}}}},
+			wantScale:     3,
+			wantResources: &Resources{Cores: 1, Memory: 1024},
+		},
+		{
+			name:          "limits win over reservations",
+			service:       Service{Deploy: &Deploy{Resources: &DeployResources{Limits: &DeployResourceSpec{Memory: "512m"}, Reservations: &DeployResourceSpec{CPUs: "2", Memory: "128m"}}}},
+			wantResources: &Resources{Cores: 2, Memory: 512},
+		},
+		{
+			name:          "service resources win over deploy",
+			service:       Service{Resources: &Resources{Memory: 2048, Swap: 512}, Deploy: &Deploy{Resources: &DeployResources{Limits: &DeployResourceSpec{CPUs: "4", Memory: "1g"}}}},
+			wantResources: &Resources{Cores: 4, Memory: 2048, Swap: 512},
+		},
+		{
+			name:      "matching scale",
+			service:   Service{Scale: 2, Deploy: &Deploy{Replicas: 2}},
+			wantScale: 2,
+		},
+		{
+			name:     "conflicting scale",
+			service:  Service{Scale: 2, Deploy: &Deploy{Replicas: 3}},
+			errorMsg: "service 'app': scale 2 conflicts with deploy.replicas 3",
+		},
+		{
+			name:     "negative replicas",
+			service:  Service{Deploy: &Deploy{Replicas: -1}},
+			errorMsg: "service 'app': deploy.replicas cannot be negative",
+		},
+		{
+			name:     "invalid cpus",
+			service:  Service{Deploy: &Deploy{Resources: &DeployResources{Limits: &DeployResourceSpec{CPUs: "half"}}}},
+			errorMsg: "service 'app': invalid deploy.resources.limits.cpus 'half', must be a positive number",
+		},
+		{
+			name:     "invalid memory",
+			service:  Service{Deploy: &Deploy{Resources: &DeployResources{Reservations: &DeployResourceSpec{Memory: "lots"}}}},
+			errorMsg: "service 'app': invalid deploy.resources.reservations.memory 'lots', must be a size such as 512M or 1G",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.service.Template = "debian:12"
+			stack := &LXCStack{Version: "1.0", Services: map[string]Service{"app": tt.service}}
+
+			err := stack.ApplyDeploy()
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Errorf("ApplyDeploy() error = %v, want %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyDeploy() unexpected error: %v", err)
+			}
+
+			app := stack.Services["app"]
+			if app.Scale != tt.wantScale {
+				t.Errorf("Scale = %d, want %d", app.Scale, tt.wantScale)
+			}
+			if (app.Resources == nil) != (tt.wantResources == nil) || (app.Resources != nil && *app.Resources != *tt.wantResources) {
+				t.Errorf("Resources = %+v, want %+v", app.Resources, tt.wantResources)
+			}
+		})
+	}
+}
+
+func TestDeployWarnings(t *testing.T) {
+	stack := &LXCStack{
+		Services: map[string]Service{
+			"web": {Deploy: &Deploy{
+				Replicas: 2,
+				Other:    map[string]interface{}{"update_config": nil, "mode": "replicated"},
+				Resources: &DeployResources{
+					Limits: &DeployResourceSpec{Memory: "512M", Other: map[string]interface{}{"pids": 100}},
+				},
+			}},
+			"db": {Template: "postgres:15"},
+		},
+	}
+
+	expected := []string{
+		"services.web.deploy.mode",
+		"services.web.deploy.update_config",
+		"services.web.deploy.resources.limits.pids",
+	}
+	warnings := stack.DeployWarnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("DeployWarnings() = %+v, want %d warnings", warnings, len(expected))
+	}
+	for i, path := range expected {
+		if warnings[i].Path != path {
+			t.Errorf("warning %d path = %q, want %q", i, warnings[i].Path, path)
+		}
+	}
+	if warnings[0].Message != "service 'web': deploy.mode is not supported and is ignored" {
+		t.Errorf("warning message = %q", warnings[0].Message)
+	}
+}
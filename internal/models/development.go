@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ApplyDevelopment merges the development overrides into the stack's
+// services, as Compose merges override files. A development service
+// overrides the settings it sets on the service of the same name: maps
+// such as environment and labels are merged key by key, resources field by
+// field, lists such as ports are extended, volumes replace the entries
+// mounted at the same container path, and other settings are replaced; a
+// build replaces a template or the other way around. Extra services are
+// added to the stack. The overrides are removed from the stack once
+// applied.
+func (s *LXCStack) ApplyDevelopment() error {
+	if s.Development == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(s.Development.Services))
+	for name := range s.Development.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		service, exists := s.Services[name]
+		if !exists {
+			return fmt.Errorf("development override for undefined service '%s'", name)
+		}
+		s.Services[name] = service.Override(s.Development.Services[name])
+	}
+
+	for name, service := range s.Development.ExtraServices {
+		if _, exists := s.Services[name]; exists {
+			return fmt.Errorf("development extra service '%s' is already defined in services", name)
+		}
+		if s.Services == nil {
+			s.Services = make(map[string]Service)
+		}
+		s.Services[name] = service
+	}
+
+	s.Development = nil
+	return nil
+}
+
+// Override returns the service with the settings set in other applied, as
+// ApplyDevelopment merges a development service into the service
+func (s Service) Override(other Service) Service {
+	merged := s
+	target := reflect.ValueOf(&merged).Elem()
+	source := reflect.ValueOf(other)
+	for i := 0; i < source.NumField(); i++ {
+		field := source.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		if target.Field(i).IsZero() {
+			target.Field(i).Set(field)
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Map:
+			combined := reflect.MakeMap(field.Type())
+			for _, m := range []reflect.Value{target.Field(i), field} {
+				iter := m.MapRange()
+				for iter.Next() {
+					combined.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+			target.Field(i).Set(combined)
+		case reflect.Slice:
+			if values, ok := field.Interface().([]string); ok {
+				target.Field(i).Set(reflect.ValueOf(appendMissing(target.Field(i).Interface().([]string), values)))
+			} else {
+				target.Field(i).Set(field)
+			}
+		default:
+			target.Field(i).Set(field)
+		}
+	}
+
+	if other.Resources != nil && s.Resources != nil {
+		resources := s.Resources.Override(*other.Resources)
+		merged.Resources = &resources
+	}
+	if len(other.Volumes) > 0 {
+		merged.Volumes = overrideVolumes(s.Volumes, other.Volumes)
+	}
+	if other.HasBuild() {
+		merged.Template = ""
+	} else if other.Template != "" {
+		merged.Build = nil
+	}
+	return merged
+}
+
+// appendMissing returns list extended with the values it does not contain
+func appendMissing(list, values []string) []string {
+	merged := append([]string(nil), list...)
+	for _, value := range values {
+		found := false
+		for _, existing := range merged {
+			found = found || existing == value
+		}
+		if !found {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+// overrideVolumes returns volumes with each override replacing the volume
+// mounted at the same container path, or added if there is none
+func overrideVolumes(volumes, overrides []string) []string {
+	merged := append([]string(nil), volumes...)
+	for _, override := range overrides {
+		replaced := false
+		for i, volume := range merged {
+			if ParseVolumeMount(volume).Target == ParseVolumeMount(override).Target {
+				merged[i], replaced = override, true
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
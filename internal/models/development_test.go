@@ -0,0 +1,110 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyDevelopment(t *testing.T) {
+	tests := []struct {
+		name     string
+		stack    LXCStack
+		expected map[string]Service
+		errorMsg string
+	}{
+		{
+			name: "overrides merge into services",
+			stack: LXCStack{
+				Services: map[string]Service{
+					"web": {
+						Template:    "9000",
+						Resources:   &Resources{Memory: 1024, Cores: 2},
+						Environment: map[string]string{"NODE_ENV": "production", "PORT": "3000"},
+						Ports:       []string{"80:3000"},
+						Volumes:     []string{"logs:/var/log/app", "./config:/etc/app"},
+						Restart:     "always",
+					},
+				},
+				Development: &Development{
+					Services: map[string]Service{
+						"web": {
+							Build:       "./web",
+							Resources:   &Resources{Memory: 2048},
+							Environment: map[string]string{"NODE_ENV": "development"},
+							Ports:       []string{"80:3000", "9229:9229"},
+							Volumes:     []string{"./web/src:/opt/app/src", "./config.dev:/etc/app"},
+							Restart:     "no",
+						},
+					},
+				},
+			},
+			expected: map[string]Service{
+				"web": {
+					Build:       "./web",
+					Resources:   &Resources{Memory: 2048, Cores: 2},
+					Environment: map[string]string{"NODE_ENV": "development", "PORT": "3000"},
+					Ports:       []string{"80:3000", "9229:9229"},
+					Volumes:     []string{"logs:/var/log/app", "./config.dev:/etc/app", "./web/src:/opt/app/src"},
+					Restart:     "no",
+				},
+			},
+		},
+		{
+			name: "extra services are added",
+			stack: LXCStack{
+				Services: map[string]Service{"db": {Template: "9001"}},
+				Development: &Development{
+					ExtraServices: map[string]Service{"adminer": {Template: "9002", Ports: []string{"8080:8080"}}},
+				},
+			},
+			expected: map[string]Service{
+				"db":      {Template: "9001"},
+				"adminer": {Template: "9002", Ports: []string{"8080:8080"}},
+			},
+		},
+		{
+			name: "no overrides",
+			stack: LXCStack{
+				Services: map[string]Service{"db": {Template: "9001"}},
+			},
+			expected: map[string]Service{"db": {Template: "9001"}},
+		},
+		{
+			name: "override of an undefined service",
+			stack: LXCStack{
+				Services:    map[string]Service{"db": {Template: "9001"}},
+				Development: &Development{Services: map[string]Service{"web": {Restart: "no"}}},
+			},
+			errorMsg: "development override for undefined service 'web'",
+		},
+		{
+			name: "extra service already defined",
+			stack: LXCStack{
+				Services:    map[string]Service{"db": {Template: "9001"}},
+				Development: &Development{ExtraServices: map[string]Service{"db": {Template: "9002"}}},
+			},
+			errorMsg: "development extra service 'db' is already defined in services",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.stack.ApplyDevelopment()
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Errorf("ApplyDevelopment() error = %v, want %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyDevelopment() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tt.stack.Services, tt.expected) {
+				t.Errorf("ApplyDevelopment() services =\n%+v\nwant\n%+v", tt.stack.Services, tt.expected)
+			}
+			if tt.stack.Development != nil {
+				t.Error("development overrides kept after applying them")
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"fmt"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretsDir is where secrets are placed in a container
+const SecretsDir = "/run/secrets"
+
+// FileMount is where and how a service places a config or secret in its
+// container, as given by the long form of its configs or secrets entries:
+//
+//	secrets:
+//	  - source: db_password
+//	    target: postgres_password
+//	    uid: "999"
+//	    mode: 0440
+type FileMount struct {
+	Target string `yaml:"target,omitempty" json:"target,omitempty"`
+	UID    string `yaml:"uid,omitempty" json:"uid,omitempty"` // User name or ID owning the file
+	GID    string `yaml:"gid,omitempty" json:"gid,omitempty"` // Group name or ID owning the file
+	Mode   int    `yaml:"mode,omitempty" json:"mode,omitempty"`
+}
+
+// SecretMount returns how the service places a secret, with the target
+// resolved: SecretsDir/<name> by default, and relative targets under
+// SecretsDir
+func (s Service) SecretMount(name string) FileMount {
+	mount := s.SecretMounts[name]
+	switch {
+	case mount.Target == "":
+		mount.Target = path.Join(SecretsDir, name)
+	case !path.IsAbs(mount.Target):
+		mount.Target = path.Join(SecretsDir, mount.Target)
+	}
+	return mount
+}
+
+// validateSecret checks that a secret has exactly one source
+func validateSecret(secret Secret) error {
+	sources := 0
+	for _, set := range []bool{secret.File != "", secret.Environment != "", secret.External} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("must set exactly one of 'file', 'environment' or 'external'")
+	}
+	if secret.Name != "" && !secret.External {
+		return fmt.Errorf("'name' is only used by external secrets")
+	}
+	return nil
+}
+
+// validateFileMounts checks the long-form entries of a service's configs
+// or secrets
+func validateFileMounts(kind string, mounts map[string]FileMount) error {
+	for name, mount := range mounts {
+		if mount.Mode < 0 || mount.Mode > 0777 {
+			return fmt.Errorf("%s '%s': mode %o is not a file mode", kind, name, mount.Mode)
+		}
+	}
+	return nil
+}
+
+// parseFileRefs turns a configs or secrets sequence, whose entries are
+// names or, as in Compose, {source: ..., target: ...} mappings, into a
+// sequence of the names, in the order given, and the mounts of the
+// mapping entries
+func parseFileRefs(key string, node *yaml.Node) (*yaml.Node, map[string]FileMount, error) {
+	names := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: node.Line, Column: node.Column}
+	var mounts map[string]FileMount
+	for _, entry := range node.Content {
+		if entry.Kind != yaml.MappingNode {
+			names.Content = append(names.Content, entry)
+			continue
+		}
+		var ref struct {
+			Source    string `yaml:"source"`
+			FileMount `yaml:",inline"`
+		}
+		if err := entry.Decode(&ref); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if ref.Source == "" {
+			return nil, nil, fmt.Errorf("%s: line %d: entry has no source", key, entry.Line)
+		}
+		if mounts == nil {
+			mounts = make(map[string]FileMount)
+		}
+		mounts[ref.Source] = ref.FileMount
+		names.Content = append(names.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: ref.Source, Line: entry.Line, Column: entry.Column})
+	}
+	return names, mounts, nil
+}
+
+// fileRefsNode writes configs or secrets in the long form for the names
+// that have a mount
+func fileRefsNode(names []string, mounts map[string]FileMount) (*yaml.Node, error) {
+	refs := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, name := range names {
+		mount, found := mounts[name]
+		if !found {
+			refs.Content = append(refs.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name})
+			continue
+		}
+		var entry yaml.Node
+		if err := entry.Encode(struct {
+			Source    string `yaml:"source"`
+			FileMount `yaml:",inline"`
+		}{name, mount}); err != nil {
+			return nil, err
+		}
+		refs.Content = append(refs.Content, &entry)
+	}
+	return refs, nil
+}
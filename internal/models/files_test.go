@@ -0,0 +1,143 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestServiceSecrets(t *testing.T) {
+	tests := []struct {
+		name       string
+		secrets    string
+		definition string
+		wantMounts map[string]FileMount
+		wantErr    string
+	}{
+		{
+			name:       "names",
+			secrets:    "[db_password, api_key]",
+			definition: "{file: ./db_password.txt}",
+		},
+		{
+			name: "long form",
+			secrets: `
+      - api_key
+      - source: db_password
+        target: postgres_password
+        uid: "999"
+        gid: postgres
+        mode: 0440`,
+			definition: "{environment: DB_PASSWORD}",
+			wantMounts: map[string]FileMount{"db_password": {Target: "postgres_password", UID: "999", GID: "postgres", Mode: 0440}},
+		},
+		{
+			name: "long form without source",
+			secrets: `
+      - target: postgres_password`,
+			definition: "{file: ./db_password.txt}",
+			wantErr:    "secrets: line 6: entry has no source",
+		},
+		{
+			name: "invalid mode",
+			secrets: `
+      - source: db_password
+        mode: 01777`,
+			definition: "{file: ./db_password.txt}",
+			wantErr:    "service 'web': secrets 'db_password': mode 1777 is not a file mode",
+		},
+		{
+			name:       "no source",
+			secrets:    "[db_password]",
+			definition: "{name: db}",
+			wantErr:    "secret 'db_password': must set exactly one of 'file', 'environment' or 'external'",
+		},
+		{
+			name:       "two sources",
+			secrets:    "[db_password]",
+			definition: "{file: ./db_password.txt, environment: DB_PASSWORD}",
+			wantErr:    "secret 'db_password': must set exactly one of 'file', 'environment' or 'external'",
+		},
+		{
+			name:       "name without external",
+			secrets:    "[db_password]",
+			definition: "{file: ./db_password.txt, name: db}",
+			wantErr:    "secret 'db_password': 'name' is only used by external secrets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    secrets: ` + tt.secrets + `
+secrets:
+  api_key:
+    external: true
+  db_password: ` + tt.definition + `
+`
+			var stack LXCStack
+			err := yaml.Unmarshal([]byte(content), &stack)
+			if err == nil {
+				err = stack.Validate()
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if mounts := stack.Services["web"].SecretMounts; !reflect.DeepEqual(mounts, tt.wantMounts) {
+				t.Errorf("SecretMounts = %v, want %v", mounts, tt.wantMounts)
+			}
+		})
+	}
+}
+
+func TestSecretMount(t *testing.T) {
+	service := Service{SecretMounts: map[string]FileMount{
+		"relative": {Target: "app/key", Mode: 0440},
+		"absolute": {Target: "/etc/ssl/private/key.pem"},
+	}}
+
+	tests := map[string]string{
+		"plain":    "/run/secrets/plain",
+		"relative": "/run/secrets/app/key",
+		"absolute": "/etc/ssl/private/key.pem",
+	}
+	for name, want := range tests {
+		if got := service.SecretMount(name).Target; got != want {
+			t.Errorf("SecretMount(%q).Target = %q, want %q", name, got, want)
+		}
+	}
+	if mode := service.SecretMount("relative").Mode; mode != 0440 {
+		t.Errorf("SecretMount(relative).Mode = %o, want 440", mode)
+	}
+}
+
+func TestSecretMountsRoundTrip(t *testing.T) {
+	service := Service{
+		Template:     "nginx:latest",
+		Secrets:      []string{"api_key", "db_password"},
+		SecretMounts: map[string]FileMount{"db_password": {Target: "postgres_password", UID: "999"}},
+	}
+
+	data, err := yaml.Marshal(service)
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+	var decoded Service
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Secrets, service.Secrets) || !reflect.DeepEqual(decoded.SecretMounts, service.SecretMounts) {
+		t.Errorf("round trip = %v %v, want %v %v\n%s", decoded.Secrets, decoded.SecretMounts, service.Secrets, service.SecretMounts, data)
+	}
+}
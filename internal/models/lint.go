@@ -0,0 +1,107 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintWarning is a problem in a stack that does not prevent deploying it.
+// Path is the YAML path of the offending entry, e.g. services.web.template.
+type LintWarning struct {
+	Path    string
+	Message string
+}
+
+// Lint checks a stack for practices that make deployments fragile and for
+// definitions that have no effect. It does not repeat the checks of
+// Validate.
+func (s *LXCStack) Lint() []LintWarning {
+	names := sortedKeys(s.Services)
+
+	var warnings []LintWarning
+	for _, name := range names {
+		service := s.Services[name]
+		if strings.HasSuffix(service.Template, ":latest") {
+			warnings = append(warnings, LintWarning{
+				Path:    "services." + name + ".template",
+				Message: fmt.Sprintf("service '%s': template '%s' uses the latest tag; pin a version so redeploys are reproducible", name, service.Template),
+			})
+		}
+		for i, dependency := range service.DependsOn {
+			target, defined := s.Services[dependency]
+			if !defined || sharesNetwork(service, target) {
+				continue
+			}
+			warnings = append(warnings, LintWarning{
+				Path:    fmt.Sprintf("services.%s.depends_on[%d]", name, i),
+				Message: fmt.Sprintf("service '%s' depends on '%s' but shares no network with it, so it cannot reach it", name, dependency),
+			})
+		}
+	}
+	warnings = append(warnings, s.unusedWarnings()...)
+	return append(warnings, s.DeployWarnings()...)
+}
+
+// unusedWarnings reports networks and named volumes that no service uses
+func (s *LXCStack) unusedWarnings() []LintWarning {
+	usedNetworks := make(map[string]bool)
+	usedVolumes := make(map[string]bool)
+	for _, service := range s.Services {
+		networks, volumes := s.RequiredResources(service)
+		for _, network := range networks {
+			usedNetworks[network] = true
+		}
+		for _, volume := range volumes {
+			usedVolumes[volume] = true
+		}
+	}
+
+	var warnings []LintWarning
+	for _, name := range sortedKeys(s.Networks) {
+		if !usedNetworks[name] {
+			warnings = append(warnings, LintWarning{
+				Path:    "networks." + name,
+				Message: fmt.Sprintf("network '%s' is not used by any service", name),
+			})
+		}
+	}
+	for _, name := range sortedKeys(s.Volumes) {
+		if !usedVolumes[name] {
+			warnings = append(warnings, LintWarning{
+				Path:    "volumes." + name,
+				Message: fmt.Sprintf("volume '%s' is not used by any service", name),
+			})
+		}
+	}
+	return warnings
+}
+
+// sharesNetwork reports whether two services are attached to a common
+// network; services without networks are on the default network
+func sharesNetwork(a, b Service) bool {
+	networks := func(service Service) []string {
+		if len(service.Networks) == 0 {
+			return []string{"default"}
+		}
+		return service.Networks
+	}
+	for _, x := range networks(a) {
+		for _, y := range networks(b) {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
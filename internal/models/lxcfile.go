@@ -1,7 +1,11 @@
 package models
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -10,6 +14,9 @@ type LXCfile struct {
 	// Required: Base template/image to start from
 	From string `yaml:"from" validate:"required"`
 
+	// Optional: Proxmox OS type (pct --ostype); inferred from 'from' if unset
+	OSType string `yaml:"ostype,omitempty"`
+
 	// Optional: Container metadata
 	Metadata *Metadata `yaml:"metadata,omitempty"`
 
@@ -45,6 +52,18 @@ type LXCfile struct {
 
 	// Optional: Labels for metadata and organization
 	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Optional: Named build stages that steps copy files from
+	Stages map[string]Stage `yaml:"stages,omitempty"`
+}
+
+// Stage is a named build stage: a container built from its own base
+// template whose files later steps copy with copy.from. A stage is only
+// part of the template when it is the build target.
+type Stage struct {
+	From   string      `yaml:"from"`
+	OSType string      `yaml:"ostype,omitempty"`
+	Setup  []SetupStep `yaml:"setup"`
 }
 
 // Metadata contains container metadata information
@@ -75,6 +94,32 @@ type Resources struct {
 	NetRate  int `yaml:"net_rate,omitempty"` // Network rate limit in MB/s
 }
 
+// Override returns r with the fields set in other replacing its own
+func (r Resources) Override(other Resources) Resources {
+	if other.Cores != 0 {
+		r.Cores = other.Cores
+	}
+	if other.CPULimit != 0 {
+		r.CPULimit = other.CPULimit
+	}
+	if other.CPUUnits != 0 {
+		r.CPUUnits = other.CPUUnits
+	}
+	if other.Memory != 0 {
+		r.Memory = other.Memory
+	}
+	if other.Swap != 0 {
+		r.Swap = other.Swap
+	}
+	if other.RootFS != 0 {
+		r.RootFS = other.RootFS
+	}
+	if other.NetRate != 0 {
+		r.NetRate = other.NetRate
+	}
+	return r
+}
+
 // Security defines security and isolation settings
 type Security struct {
 	Isolation    string        `yaml:"isolation,omitempty"` // default | strict | privileged
@@ -91,10 +136,18 @@ type Capabilities struct {
 
 // SetupStep represents a single step in the build process
 type SetupStep struct {
+	Name    string            `yaml:"name,omitempty"` // Shown in build output instead of "Step N"
 	Run     string            `yaml:"run,omitempty"`
 	Copy    *CopyStep         `yaml:"copy,omitempty"`
 	Env     map[string]string `yaml:"env,omitempty"`
 	WorkDir string            `yaml:"workdir,omitempty"`
+	User    string            `yaml:"user,omitempty"` // User a run step runs as (default: root)
+
+	// Continue the build if this step fails
+	IgnoreErrors bool `yaml:"ignore_errors,omitempty"`
+
+	// Build-arg condition: "ARG", "!ARG", "ARG == value" or "ARG != value"
+	When string `yaml:"when,omitempty"`
 }
 
 // CopyStep defines a file copy operation
@@ -103,6 +156,7 @@ type CopyStep struct {
 	Dest   string `yaml:"dest" validate:"required"`
 	Owner  string `yaml:"owner,omitempty"`
 	Mode   string `yaml:"mode,omitempty"`
+	From   string `yaml:"from,omitempty"` // Build stage to copy from instead of the host
 }
 
 // Startup defines the default startup configuration
@@ -137,69 +191,436 @@ type Port struct {
 	Protocol  string `yaml:"protocol,omitempty"` // tcp | udp
 }
 
-// HealthCheck defines health check configuration
+// HealthCheck defines health check configuration. Exactly one of Test,
+// TCPPort or HTTP selects how health is checked.
 type HealthCheck struct {
-	Test        string        `yaml:"test" validate:"required"`
+	Test        string        `yaml:"test,omitempty"`     // Command run inside the container
+	TCPPort     int           `yaml:"tcp_port,omitempty"` // Port that must accept connections
+	HTTP        *HTTPCheck    `yaml:"http,omitempty"`     // HTTP endpoint that must answer
 	Interval    time.Duration `yaml:"interval,omitempty"`
 	Timeout     time.Duration `yaml:"timeout,omitempty"`
 	Retries     int           `yaml:"retries,omitempty"`
 	StartPeriod time.Duration `yaml:"start_period,omitempty"`
 }
 
-// Validate performs basic validation on the LXCfile
+// HTTPCheck defines an HTTP health check against the container
+type HTTPCheck struct {
+	Path         string `yaml:"path,omitempty"`          // Request path (default: /)
+	Port         int    `yaml:"port"`                    // Container port
+	ExpectStatus int    `yaml:"expect_status,omitempty"` // Expected status code (default: 200)
+}
+
+// Validate checks that exactly one health check form is configured
+func (h *HealthCheck) Validate() error {
+	forms := 0
+	if h.Test != "" {
+		forms++
+	}
+	if h.TCPPort != 0 {
+		forms++
+	}
+	if h.HTTP != nil {
+		forms++
+	}
+
+	switch {
+	case forms == 0:
+		return fmt.Errorf("health check requires one of 'test', 'tcp_port' or 'http'")
+	case forms > 1:
+		return fmt.Errorf("health check must set only one of 'test', 'tcp_port' or 'http'")
+	}
+
+	if h.TCPPort != 0 && (h.TCPPort < 0 || h.TCPPort > 65535) {
+		return fmt.Errorf("health check tcp_port must be between 1 and 65535")
+	}
+
+	if h.HTTP != nil {
+		if h.HTTP.Port <= 0 || h.HTTP.Port > 65535 {
+			return fmt.Errorf("health check http port must be between 1 and 65535")
+		}
+		if h.HTTP.Path != "" && !strings.HasPrefix(h.HTTP.Path, "/") {
+			return fmt.Errorf("health check http path must start with '/'")
+		}
+		if h.HTTP.ExpectStatus != 0 && (h.HTTP.ExpectStatus < 100 || h.HTTP.ExpectStatus > 599) {
+			return fmt.Errorf("health check http expect_status must be a valid HTTP status code")
+		}
+	}
+
+	if h.Interval < 0 || h.Timeout < 0 || h.StartPeriod < 0 || h.Retries < 0 {
+		return fmt.Errorf("health check interval, timeout, start_period and retries cannot be negative")
+	}
+
+	return nil
+}
+
+// labelKeyPattern matches label keys: letters and digits, with '.', '-',
+// '_' and '/' allowed between them (e.g. org.opencontainers.image.version)
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// ValidateLabelKey checks that a label key is well formed
+func ValidateLabelKey(key string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key '%s': use letters, digits, '.', '-', '_' and '/', starting and ending with a letter or digit", key)
+	}
+	return nil
+}
+
+// Validate performs basic validation on the LXCfile. Every problem found is
+// reported, joined with errors.Join; for each step, mount and port, the
+// first one.
 func (l *LXCfile) Validate() error {
+	var errs []error
 	if l.From == "" {
-		return fmt.Errorf("'from' field is required")
+		errs = append(errs, fmt.Errorf("'from' field is required"))
+	}
+
+	if l.OSType != "" {
+		if err := ValidateOSType(l.OSType); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
 	if len(l.Setup) == 0 {
-		return fmt.Errorf("'setup' field is required and must contain at least one step")
+		errs = append(errs, fmt.Errorf("'setup' field is required and must contain at least one step"))
 	}
 
 	// Validate setup steps
-	for i, step := range l.Setup {
-		if step.Run == "" && step.Copy == nil && step.Env == nil && step.WorkDir == "" {
-			return fmt.Errorf("setup step %d must have at least one action (run, copy, env, or workdir)", i+1)
-		}
+	if err := l.validateSetupSteps("setup step", l.Setup); err != nil {
+		errs = append(errs, err)
+	}
 
-		if step.Copy != nil {
-			if step.Copy.Source == "" {
-				return fmt.Errorf("setup step %d: copy source is required", i+1)
-			}
-			if step.Copy.Dest == "" {
-				return fmt.Errorf("setup step %d: copy dest is required", i+1)
-			}
+	// Validate cleanup steps
+	for i, step := range l.Cleanup {
+		if err := l.validateCleanupStep(i, step); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
+	// Validate stages
+	if err := l.validateStages(); err != nil {
+		errs = append(errs, err)
+	}
+
 	// Validate mounts
 	for i, mount := range l.Mounts {
 		if mount.Target == "" {
-			return fmt.Errorf("mount %d: target is required", i+1)
+			errs = append(errs, fmt.Errorf("mount %d: target is required", i+1))
+		} else if mount.Type == "bind" && mount.Source == "" {
+			errs = append(errs, fmt.Errorf("mount %d: source is required for bind mount", i+1))
 		}
-		if mount.Type == "bind" && mount.Source == "" {
-			return fmt.Errorf("mount %d: source is required for bind mount", i+1)
+	}
+
+	// Validate labels
+	keys := make([]string, 0, len(l.Labels))
+	for key := range l.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := ValidateLabelKey(key); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
 	// Validate ports
 	for i, port := range l.Ports {
 		if port.Container <= 0 || port.Container > 65535 {
-			return fmt.Errorf("port %d: container port must be between 1 and 65535", i+1)
-		}
-		if port.Host != 0 && (port.Host <= 0 || port.Host > 65535) {
-			return fmt.Errorf("port %d: host port must be between 1 and 65535", i+1)
+			errs = append(errs, fmt.Errorf("port %d: container port must be between 1 and 65535", i+1))
+		} else if port.Host != 0 && (port.Host <= 0 || port.Host > 65535) {
+			errs = append(errs, fmt.Errorf("port %d: host port must be between 1 and 65535", i+1))
 		}
 	}
 
 	// Validate health check
-	if l.Health != nil && l.Health.Test == "" {
-		return fmt.Errorf("health check test command is required")
+	if l.Health != nil {
+		if err := l.Health.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateCleanupStep checks the cleanup step at index i
+func (l *LXCfile) validateCleanupStep(i int, step SetupStep) error {
+	if step.Run == "" && step.Copy == nil && step.Env == nil && step.WorkDir == "" {
+		return fmt.Errorf("cleanup step %d must have at least one action (run, copy, env, or workdir)", i+1)
+	}
+	if step.User != "" && step.Run == "" {
+		return fmt.Errorf("cleanup step %d: user only applies to run steps", i+1)
+	}
+
+	if step.Copy != nil && step.Copy.From != "" {
+		if err := l.validateStageCopy(*step.Copy); err != nil {
+			return fmt.Errorf("cleanup step %d: %w", i+1, err)
+		}
+	}
+
+	if _, err := ParseCondition(step.When); err != nil {
+		return fmt.Errorf("cleanup step %d: %w", i+1, err)
+	}
+	return nil
+}
+
+// validateSetupSteps checks the setup steps of the LXCfile or of a stage;
+// kind prefixes the errors, e.g. "setup step". The first problem of each
+// step is reported.
+func (l *LXCfile) validateSetupSteps(kind string, steps []SetupStep) error {
+	var errs []error
+	for i, step := range steps {
+		if err := l.validateSetupStep(kind, i, step); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateSetupStep checks the setup step at index i
+func (l *LXCfile) validateSetupStep(kind string, i int, step SetupStep) error {
+	if step.Run == "" && step.Copy == nil && step.Env == nil && step.WorkDir == "" {
+		return fmt.Errorf("%s %d must have at least one action (run, copy, env, or workdir)", kind, i+1)
+	}
+
+	if step.User != "" && step.Run == "" {
+		return fmt.Errorf("%s %d: user only applies to run steps", kind, i+1)
 	}
 
+	if step.Copy != nil {
+		if step.Copy.Source == "" {
+			return fmt.Errorf("%s %d: copy source is required", kind, i+1)
+		}
+		if step.Copy.Dest == "" {
+			return fmt.Errorf("%s %d: copy dest is required", kind, i+1)
+		}
+		if step.Copy.From != "" {
+			if err := l.validateStageCopy(*step.Copy); err != nil {
+				return fmt.Errorf("%s %d: %w", kind, i+1, err)
+			}
+		}
+	}
+
+	if _, err := ParseCondition(step.When); err != nil {
+		return fmt.Errorf("%s %d: %w", kind, i+1, err)
+	}
 	return nil
 }
 
+// validateStageCopy checks a copy step that copies from a stage
+func (l *LXCfile) validateStageCopy(copyStep CopyStep) error {
+	if _, found := l.Stages[copyStep.From]; !found {
+		return fmt.Errorf("copy from unknown stage '%s'", copyStep.From)
+	}
+	if !strings.HasPrefix(copyStep.Source, "/") && !strings.HasPrefix(copyStep.Source, "$") {
+		return fmt.Errorf("copy from stage '%s' needs an absolute source path", copyStep.From)
+	}
+	return nil
+}
+
+// stageNamePattern matches stage names
+var stageNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// validateStages checks the stages and that no stage copies from itself,
+// directly or through other stages
+func (l *LXCfile) validateStages() error {
+	names := make([]string, 0, len(l.Stages))
+	for name := range l.Stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		stage := l.Stages[name]
+		if !stageNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid stage name '%s'", name)
+		}
+		if stage.From == "" {
+			return fmt.Errorf("stage '%s': 'from' field is required", name)
+		}
+		if stage.OSType != "" {
+			if err := ValidateOSType(stage.OSType); err != nil {
+				return fmt.Errorf("stage '%s': %w", name, err)
+			}
+		}
+		if len(stage.Setup) == 0 {
+			return fmt.Errorf("stage '%s': 'setup' must contain at least one step", name)
+		}
+		if err := l.validateSetupSteps(fmt.Sprintf("stage '%s': setup step", name), stage.Setup); err != nil {
+			return err
+		}
+	}
+
+	// Depth-first search for a stage that is reached again while its own
+	// dependencies are still being visited
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(l.Stages))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("stages copy from each other in a cycle: %s", strings.Join(append(path, name), " -> "))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, dependency := range stageRefs(l.Stages[name].Setup) {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageRefs returns the stages that steps copy from, in the order they are
+// first referenced
+func stageRefs(steps ...[]SetupStep) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	for _, list := range steps {
+		for _, step := range list {
+			if step.Copy == nil || step.Copy.From == "" || seen[step.Copy.From] {
+				continue
+			}
+			seen[step.Copy.From] = true
+			refs = append(refs, step.Copy.From)
+		}
+	}
+	return refs
+}
+
+// StageOrder returns the stages that the setup and cleanup steps copy from,
+// directly or through other stages, each after the stages it copies from.
+// Stages nothing copies from are not built.
+func (l *LXCfile) StageOrder() []string {
+	var order []string
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, dependency := range stageRefs(l.Stages[name].Setup) {
+			visit(dependency)
+		}
+		order = append(order, name)
+	}
+	for _, name := range stageRefs(l.Setup, l.Cleanup) {
+		visit(name)
+	}
+	return order
+}
+
+// ForTarget returns the LXCfile that makes the named stage the template:
+// the stage's base template and setup steps, with the LXCfile's other
+// settings but without its cleanup steps, which belong to the final stage.
+// An empty target is the LXCfile itself.
+func (l *LXCfile) ForTarget(target string) (*LXCfile, error) {
+	if target == "" {
+		return l, nil
+	}
+	stage, found := l.Stages[target]
+	if !found {
+		names := make([]string, 0, len(l.Stages))
+		for name := range l.Stages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("build target '%s' not found: the LXCfile has no stages", target)
+		}
+		return nil, fmt.Errorf("build target '%s' not found (stages: %s)", target, strings.Join(names, ", "))
+	}
+
+	override := *l
+	override.From, override.OSType = stage.From, stage.OSType
+	override.Setup, override.Cleanup = stage.Setup, nil
+	return &override, nil
+}
+
+// Condition is a parsed step 'when' expression over build args
+type Condition struct {
+	Arg    string
+	Negate bool
+	Value  string
+	HasCmp bool // compares against Value rather than testing the arg is set
+}
+
+// ParseCondition parses "ARG", "!ARG", "ARG == value" or "ARG != value".
+// An empty expression always holds.
+func ParseCondition(expr string) (*Condition, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+
+	for _, op := range []string{"==", "!="} {
+		if left, right, found := strings.Cut(expr, op); found {
+			arg := strings.TrimSpace(left)
+			if !isConditionArg(arg) {
+				return nil, fmt.Errorf("invalid when condition '%s'", expr)
+			}
+			return &Condition{
+				Arg:    arg,
+				Negate: op == "!=",
+				Value:  strings.Trim(strings.TrimSpace(right), `"'`),
+				HasCmp: true,
+			}, nil
+		}
+	}
+
+	condition := &Condition{Arg: expr}
+	if rest, found := strings.CutPrefix(expr, "!"); found {
+		condition.Arg = strings.TrimSpace(rest)
+		condition.Negate = true
+	}
+	if !isConditionArg(condition.Arg) {
+		return nil, fmt.Errorf("invalid when condition '%s'", expr)
+	}
+
+	return condition, nil
+}
+
+// Evaluate reports whether the condition holds for the given build args. A
+// bare arg holds when it is set to anything other than "", "0" or "false".
+func (c *Condition) Evaluate(args map[string]string) bool {
+	if c == nil {
+		return true
+	}
+
+	value := args[c.Arg]
+	var holds bool
+	if c.HasCmp {
+		holds = value == c.Value
+	} else {
+		holds = value != "" && value != "0" && !strings.EqualFold(value, "false")
+	}
+
+	return holds != c.Negate
+}
+
+func isConditionArg(arg string) bool {
+	if arg == "" {
+		return false
+	}
+	for _, r := range arg {
+		if !(r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
 // GetTemplateName generates a template name based on metadata
 func (l *LXCfile) GetTemplateName() string {
 	if l.Metadata != nil && l.Metadata.Name != "" {
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -223,7 +224,45 @@ func TestLXCfileValidation(t *testing.T) {
 				},
 			},
 			wantErr:  true,
-			errorMsg: "health check test command is required",
+			errorMsg: "health check requires one of 'test', 'tcp_port' or 'http'",
+		},
+		{
+			name: "tcp port health check",
+			lxcfile: LXCfile{
+				From:   "ubuntu:22.04",
+				Setup:  []SetupStep{{Run: "apt-get update"}},
+				Health: &HealthCheck{TCPPort: 5432},
+			},
+			wantErr: false,
+		},
+		{
+			name: "http health check",
+			lxcfile: LXCfile{
+				From:   "ubuntu:22.04",
+				Setup:  []SetupStep{{Run: "apt-get update"}},
+				Health: &HealthCheck{HTTP: &HTTPCheck{Path: "/health", Port: 8080, ExpectStatus: 204}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "health check with multiple forms",
+			lxcfile: LXCfile{
+				From:   "ubuntu:22.04",
+				Setup:  []SetupStep{{Run: "apt-get update"}},
+				Health: &HealthCheck{Test: "pg_isready", TCPPort: 5432},
+			},
+			wantErr:  true,
+			errorMsg: "health check must set only one of 'test', 'tcp_port' or 'http'",
+		},
+		{
+			name: "http health check without port",
+			lxcfile: LXCfile{
+				From:   "ubuntu:22.04",
+				Setup:  []SetupStep{{Run: "apt-get update"}},
+				Health: &HealthCheck{HTTP: &HTTPCheck{Path: "/health"}},
+			},
+			wantErr:  true,
+			errorMsg: "health check http port must be between 1 and 65535",
 		},
 	}
 
@@ -346,12 +385,31 @@ func TestSetupStepValidation(t *testing.T) {
 			},
 			valid: true,
 		},
+		{
+			name: "named step with when and ignore_errors",
+			step: SetupStep{
+				Name:         "debug-tools",
+				Run:          "apt-get install -y strace",
+				When:         "DEBUG",
+				IgnoreErrors: true,
+			},
+			valid: true,
+		},
 		{
 			name:    "empty step",
 			step:    SetupStep{},
 			valid:   false,
 			message: "should have at least one action",
 		},
+		{
+			name: "invalid when condition",
+			step: SetupStep{
+				Run:  "true",
+				When: "ENV = production",
+			},
+			valid:   false,
+			message: "should reject malformed when",
+		},
 	}
 
 	for _, tt := range tests {
@@ -373,6 +431,72 @@ func TestSetupStepValidation(t *testing.T) {
 	}
 }
 
+func TestCleanupStepValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		step    SetupStep
+		wantErr bool
+	}{
+		{name: "valid cleanup step", step: SetupStep{Name: "purge-cache", Run: "apt-get clean"}},
+		{name: "empty cleanup step", step: SetupStep{Name: "nothing"}, wantErr: true},
+		{name: "invalid when", step: SetupStep{Run: "true", When: "== x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lxcfile := LXCfile{
+				From:    "ubuntu:22.04",
+				Setup:   []SetupStep{{Run: "apt-get update"}},
+				Cleanup: []SetupStep{tt.step},
+			}
+
+			err := lxcfile.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	args := map[string]string{"ENV": "production", "DEBUG": "false", "VERBOSE": "1"}
+
+	tests := []struct {
+		expr     string
+		expected bool
+		wantErr  bool
+	}{
+		{expr: "", expected: true},
+		{expr: "VERBOSE", expected: true},
+		{expr: "DEBUG", expected: false},
+		{expr: "MISSING", expected: false},
+		{expr: "!DEBUG", expected: true},
+		{expr: "ENV == production", expected: true},
+		{expr: "ENV != production", expected: false},
+		{expr: "MISSING != production", expected: true},
+		{expr: "ENV = production", wantErr: true},
+		{expr: "== production", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			condition, err := ParseCondition(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseCondition(%q) expected error", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCondition(%q) unexpected error: %v", tt.expr, err)
+			}
+			if got := condition.Evaluate(args); got != tt.expected {
+				t.Errorf("%q evaluated to %v, want %v", tt.expr, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestPortValidation(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -494,4 +618,125 @@ func TestMountValidation(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestStageValidation(t *testing.T) {
+	stage := func(setup ...SetupStep) Stage {
+		return Stage{From: "golang:1.22", Setup: setup}
+	}
+	copyFrom := func(from, source string) SetupStep {
+		return SetupStep{Copy: &CopyStep{From: from, Source: source, Dest: "/app"}}
+	}
+
+	tests := []struct {
+		name     string
+		stages   map[string]Stage
+		setup    []SetupStep
+		errorMsg string
+	}{
+		{
+			name:   "copy from a stage",
+			stages: map[string]Stage{"build": stage(SetupStep{Run: "make"})},
+			setup:  []SetupStep{copyFrom("build", "/src/app")},
+		},
+		{
+			name:   "build arg in source",
+			stages: map[string]Stage{"build": stage(SetupStep{Run: "make"})},
+			setup:  []SetupStep{copyFrom("build", "${SRC}/app")},
+		},
+		{
+			name:     "unknown stage",
+			setup:    []SetupStep{copyFrom("build", "/src/app")},
+			errorMsg: "setup step 1: copy from unknown stage 'build'",
+		},
+		{
+			name:     "relative source",
+			stages:   map[string]Stage{"build": stage(SetupStep{Run: "make"})},
+			setup:    []SetupStep{copyFrom("build", "src/app")},
+			errorMsg: "setup step 1: copy from stage 'build' needs an absolute source path",
+		},
+		{
+			name:     "stage without from",
+			stages:   map[string]Stage{"build": {Setup: []SetupStep{{Run: "make"}}}},
+			errorMsg: "stage 'build': 'from' field is required",
+		},
+		{
+			name:     "stage without steps",
+			stages:   map[string]Stage{"build": stage()},
+			errorMsg: "stage 'build': 'setup' must contain at least one step",
+		},
+		{
+			name:     "invalid stage step",
+			stages:   map[string]Stage{"build": stage(SetupStep{User: "app", WorkDir: "/src"})},
+			errorMsg: "stage 'build': setup step 1: user only applies to run steps",
+		},
+		{
+			name:     "invalid stage name",
+			stages:   map[string]Stage{"my stage": stage(SetupStep{Run: "make"})},
+			errorMsg: "invalid stage name 'my stage'",
+		},
+		{
+			name: "cycle",
+			stages: map[string]Stage{
+				"a": stage(copyFrom("b", "/b")),
+				"b": stage(copyFrom("a", "/a")),
+			},
+			errorMsg: "stages copy from each other in a cycle: a -> b -> a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lxcfile := LXCfile{From: "debian-12-standard", Stages: tt.stages, Setup: tt.setup}
+			if len(lxcfile.Setup) == 0 {
+				lxcfile.Setup = []SetupStep{{Run: "true"}}
+			}
+			err := lxcfile.Validate()
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.errorMsg {
+				t.Errorf("Validate() error = %v, want %q", err, tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestStageOrderAndTarget(t *testing.T) {
+	lxcfile := &LXCfile{
+		From: "debian-12-standard",
+		Stages: map[string]Stage{
+			"deps":  {From: "alpine:3.18", Setup: []SetupStep{{Run: "fetch"}}},
+			"build": {From: "golang:1.22", OSType: "alpine", Setup: []SetupStep{{Copy: &CopyStep{From: "deps", Source: "/deps", Dest: "/src/deps"}}, {Run: "make"}}},
+			"docs":  {From: "alpine:3.18", Setup: []SetupStep{{Run: "make docs"}}},
+		},
+		Setup:   []SetupStep{{Copy: &CopyStep{From: "build", Source: "/src/app", Dest: "/usr/local/bin/app"}}},
+		Cleanup: []SetupStep{{Run: "rm -rf /tmp/*"}},
+		Labels:  map[string]string{"tier": "backend"},
+	}
+
+	if order := strings.Join(lxcfile.StageOrder(), ","); order != "deps,build" {
+		t.Errorf("StageOrder() = %s, want deps,build", order)
+	}
+
+	target, err := lxcfile.ForTarget("build")
+	if err != nil {
+		t.Fatalf("ForTarget() unexpected error: %v", err)
+	}
+	if target.From != "golang:1.22" || target.OSType != "alpine" || len(target.Setup) != 2 || target.Cleanup != nil || target.Labels["tier"] != "backend" {
+		t.Errorf("ForTarget(build) = %+v, want the build stage with the LXCfile's labels and no cleanup", target)
+	}
+	if order := strings.Join(target.StageOrder(), ","); order != "deps" {
+		t.Errorf("StageOrder() of target = %s, want deps", order)
+	}
+
+	if same, err := lxcfile.ForTarget(""); err != nil || same != lxcfile {
+		t.Errorf("ForTarget(\"\") = %p, %v, want the LXCfile itself", same, err)
+	}
+	if _, err := lxcfile.ForTarget("runtime"); err == nil || err.Error() != "build target 'runtime' not found (stages: build, deps, docs)" {
+		t.Errorf("ForTarget(runtime) error = %v", err)
+	}
+}
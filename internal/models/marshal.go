@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalYAML writes the durations of a health check as strings such as
+// "30s", as they are written in stack files
+func (h HealthCheck) MarshalYAML() (interface{}, error) {
+	type plain HealthCheck
+	return encodeWithDurations(plain(h), map[string]time.Duration{
+		"interval":     h.Interval,
+		"timeout":      h.Timeout,
+		"start_period": h.StartPeriod,
+	})
+}
+
+// MarshalYAML writes the durations of a restart policy as strings
+func (p RestartPolicy) MarshalYAML() (interface{}, error) {
+	type plain RestartPolicy
+	return encodeWithDurations(plain(p), map[string]time.Duration{
+		"window": p.Window,
+		"delay":  p.Delay,
+	})
+}
+
+// encodeWithDurations encodes value to a mapping node and replaces the
+// nanosecond counts of its duration fields, by key, with duration strings
+func encodeWithDurations(value interface{}, durations map[string]time.Duration) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if duration, ok := durations[node.Content[i].Value]; ok {
+			node.Content[i+1].Tag = "!!str"
+			node.Content[i+1].Value = duration.String()
+		}
+	}
+	return &node, nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// nodeNamePattern matches Proxmox node names, which are host names
+var nodeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+
+// ClusterNodes returns the nodes listed in settings.proxmox.nodes
+func (s *LXCStack) ClusterNodes() []string {
+	if s.Settings == nil || s.Settings.Proxmox == nil {
+		return nil
+	}
+	return s.Settings.Proxmox.Nodes
+}
+
+// validateNodes checks the names in settings.proxmox.nodes
+func (s *LXCStack) validateNodes() error {
+	seen := make(map[string]bool)
+	for _, node := range s.ClusterNodes() {
+		if !nodeNamePattern.MatchString(node) {
+			return fmt.Errorf("settings.proxmox.nodes: invalid node name '%s'", node)
+		}
+		if seen[node] {
+			return fmt.Errorf("settings.proxmox.nodes: node '%s' is listed twice", node)
+		}
+		seen[node] = true
+	}
+	return nil
+}
+
+// validateServiceNode checks a service's node placement against
+// settings.proxmox.nodes, when the stack lists its nodes
+func (s *LXCStack) validateServiceNode(node string) error {
+	if !nodeNamePattern.MatchString(node) {
+		return fmt.Errorf("invalid node name '%s'", node)
+	}
+	nodes := s.ClusterNodes()
+	if len(nodes) == 0 {
+		return nil
+	}
+	for _, listed := range nodes {
+		if listed == node {
+			return nil
+		}
+	}
+	return fmt.Errorf("node '%s' is not in settings.proxmox.nodes %v", node, nodes)
+}
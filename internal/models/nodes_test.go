@@ -0,0 +1,49 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestServiceNodeValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   string
+		node    string
+		wantErr string
+	}{
+		{name: "any node", node: "pve2"},
+		{name: "listed node", nodes: "[pve1, pve2]", node: "pve2"},
+		{name: "unlisted node", nodes: "[pve1, pve2]", node: "pve3", wantErr: "node 'pve3' is not in settings.proxmox.nodes"},
+		{name: "invalid node", node: "pve_2", wantErr: "invalid node name 'pve_2'"},
+		{name: "invalid listed node", nodes: "[pve1, -pve2]", node: "pve1", wantErr: "settings.proxmox.nodes: invalid node name '-pve2'"},
+		{name: "node listed twice", nodes: "[pve1, pve1]", node: "pve1", wantErr: "node 'pve1' is listed twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "version: \"1.0\"\n"
+			if tt.nodes != "" {
+				content += "settings:\n  proxmox:\n    nodes: " + tt.nodes + "\n"
+			}
+			content += "services:\n  web:\n    template: \"9000\"\n    node: " + tt.node + "\n"
+
+			var stack LXCStack
+			if err := yaml.Unmarshal([]byte(content), &stack); err != nil {
+				t.Fatalf("Failed to parse stack: %v", err)
+			}
+			err := stack.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// OSTypes are the values pct create accepts for --ostype, which selects how
+// Proxmox sets up the container's init, network and console
+var OSTypes = []string{"alpine", "archlinux", "centos", "debian", "devuan", "fedora", "gentoo", "nixos", "opensuse", "ubuntu", "unmanaged"}
+
+// osTypeAliases maps distribution names found in template names to the
+// ostype Proxmox handles them as
+var osTypeAliases = map[string]string{
+	"almalinux":  "centos",
+	"arch":       "archlinux",
+	"rocky":      "centos",
+	"rockylinux": "centos",
+}
+
+// ValidateOSType checks an explicit ostype against the values pct accepts
+func ValidateOSType(osType string) error {
+	for _, known := range OSTypes {
+		if osType == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid ostype '%s', must be one of: %s", osType, strings.Join(OSTypes, ", "))
+}
+
+// InferOSType returns the ostype of a template reference such as
+// ubuntu:22.04 or local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst,
+// taken from the distribution name it starts with; empty if not known
+func InferOSType(template string) string {
+	name := template
+	if storage, volume, found := strings.Cut(template, ":vztmpl/"); found && storage != "" {
+		name = volume
+	}
+	name = strings.ToLower(path.Base(name))
+
+	distribution := strings.FieldsFunc(name, func(r rune) bool {
+		return r == ':' || r == '-' || r == '_' || r == '.'
+	})
+	if len(distribution) == 0 {
+		return ""
+	}
+	if osType, exists := osTypeAliases[distribution[0]]; exists {
+		return osType
+	}
+	if ValidateOSType(distribution[0]) == nil && distribution[0] != "unmanaged" {
+		return distribution[0]
+	}
+	return ""
+}
+
+// ResolveOSType returns an explicit ostype if set, else the one inferred
+// from the template
+func ResolveOSType(explicit, template string) string {
+	if explicit != "" {
+		return explicit
+	}
+	return InferOSType(template)
+}
@@ -0,0 +1,45 @@
+package models
+
+import "testing"
+
+func TestInferOSType(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"ubuntu:22.04", "ubuntu"},
+		{"debian:12", "debian"},
+		{"alpine", "alpine"},
+		{"local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst", "debian"},
+		{"local:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.zst", "ubuntu"},
+		{"local:vztmpl/rockylinux-9-default_20221109_amd64.tar.xz", "centos"},
+		{"archlinux-base_20230608-1_amd64.tar.zst", "archlinux"},
+		{"Fedora-39", "fedora"},
+		{"myapp:1.0", ""},
+		{"unmanaged", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			if got := InferOSType(tt.template); got != tt.want {
+				t.Errorf("InferOSType(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveOSType(t *testing.T) {
+	if got := ResolveOSType("", "ubuntu:22.04"); got != "ubuntu" {
+		t.Errorf("ResolveOSType() = %q, want ubuntu inferred from the template", got)
+	}
+	if got := ResolveOSType("debian", "ubuntu:22.04"); got != "debian" {
+		t.Errorf("ResolveOSType() = %q, want the explicit debian", got)
+	}
+	if err := ValidateOSType("devuan"); err != nil {
+		t.Errorf("ValidateOSType(devuan) unexpected error: %v", err)
+	}
+	if err := ValidateOSType("windows"); err == nil {
+		t.Error("ValidateOSType(windows) expected error")
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Restart delays: the first restart of a failed container waits
+// DefaultRestartDelay unless restart_policy sets a delay, and each further
+// consecutive failure doubles it up to MaxRestartDelay
+const (
+	DefaultRestartDelay = time.Second
+	MaxRestartDelay     = 5 * time.Minute
+)
+
+// RestartPolicyName returns the service's restart policy, defaulting to
+// unless-stopped
+func (s Service) RestartPolicyName() string {
+	if s.Restart == "" {
+		return "unless-stopped"
+	}
+	return s.Restart
+}
+
+// RestartsOnFailure reports whether the service's restart policy restarts a
+// container that failed; only "no" leaves it down
+func (s Service) RestartsOnFailure() bool {
+	return s.RestartPolicyName() != "no"
+}
+
+// RestartDelay returns how long to wait before restart attempt n (1 for the
+// first) of a failed container. A nil policy uses the default delay.
+func (p *RestartPolicy) RestartDelay(n int) time.Duration {
+	delay := DefaultRestartDelay
+	if p != nil && p.Delay > 0 {
+		delay = p.Delay
+	}
+	for i := 1; i < n && delay < MaxRestartDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxRestartDelay)
+}
@@ -1,8 +1,17 @@
 package models
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // LXCStack represents the structure of an lxc-stack.yml configuration
@@ -36,6 +45,12 @@ type LXCStack struct {
 
 	// Optional: Development overrides
 	Development *Development `yaml:"development,omitempty"`
+
+	// Optional: Stack files merged into this one, relative to this file
+	Include []string `yaml:"include,omitempty"`
+
+	// Optional: Named resource sizes services refer to with resource_profile
+	ResourceProfiles map[string]Resources `yaml:"x-resource-profiles,omitempty"`
 }
 
 // Service represents a container service definition
@@ -46,12 +61,23 @@ type Service struct {
 	// Alternative: use pre-built template
 	Template string `yaml:"template,omitempty"`
 
+	// Proxmox OS type (pct --ostype); inferred from the template if unset
+	OSType string `yaml:"ostype,omitempty"`
+
+	// Proxmox cluster node the service's containers run on; the stack's
+	// node if unset
+	Node string `yaml:"node,omitempty"`
+
 	// Container-specific overrides
 	Hostname string `yaml:"hostname,omitempty"`
 
 	// Resource limits (override LXCfile settings)
 	Resources *Resources `yaml:"resources,omitempty"`
 
+	// Named entry of x-resource-profiles to take resources from; fields
+	// set in resources override the profile
+	ResourceProfile string `yaml:"resource_profile,omitempty"`
+
 	// Environment variables
 	Environment map[string]string `yaml:"environment,omitempty"`
 
@@ -67,12 +93,19 @@ type Service struct {
 	// Service dependencies (start order)
 	DependsOn []string `yaml:"depends_on,omitempty"`
 
+	// Conditions of dependencies given in the map form of depends_on, by
+	// service name; see DependencyCondition
+	DependsOnConditions map[string]string `yaml:"-" json:"-"`
+
 	// Health check override
 	Health *HealthCheck `yaml:"health,omitempty"`
 
 	// Restart policy
 	Restart string `yaml:"restart,omitempty"` // no | always | on-failure | unless-stopped
 
+	// Restart backoff limits applied when restarting a failed container
+	RestartPolicy *RestartPolicy `yaml:"restart_policy,omitempty"`
+
 	// Security overrides
 	Security *Security `yaml:"security,omitempty"`
 
@@ -85,8 +118,304 @@ type Service struct {
 	// Scale this service
 	Scale int `yaml:"scale,omitempty"`
 
+	// Compose deploy block, mapped onto scale and resources
+	Deploy *Deploy `yaml:"deploy,omitempty"`
+
 	// Labels for the service
 	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Config files and secrets pushed into the container
+	Configs []string `yaml:"configs,omitempty"`
+	Secrets []string `yaml:"secrets,omitempty"`
+
+	// Targets, owners and modes of secrets given in the long form of
+	// secrets, by secret name; see SecretMount
+	SecretMounts map[string]FileMount `yaml:"-" json:"secret_mounts,omitempty"`
+
+	// Signal sent to the container's init process after configs or secrets
+	// change, instead of recreating the container (e.g. "HUP")
+	ReloadSignal string `yaml:"reload_signal,omitempty"`
+
+	// PID namespace: "host" or "service:<name>" to share another service's
+	Pid string `yaml:"pid,omitempty"`
+
+	// Size of /dev/shm, e.g. "256m" or "1g"
+	ShmSize string `yaml:"shm_size,omitempty"`
+
+	// DNS servers and search domains overriding the host's resolver settings
+	DNS       []string `yaml:"dns,omitempty"`
+	DNSSearch []string `yaml:"dns_search,omitempty"`
+}
+
+// PortMapping is a parsed entry of a service's ports list
+type PortMapping struct {
+	HostIP         string // Empty for all addresses
+	HostStart      int
+	HostEnd        int
+	ContainerStart int
+	ContainerEnd   int
+	Protocol       string // tcp or udp
+}
+
+// ParsePortMapping parses a ports entry: [[HOST_IP:]HOST:]CONTAINER[/PROTOCOL],
+// where HOST and CONTAINER are a port or a START-END range
+func ParsePortMapping(spec string) (PortMapping, error) {
+	mapping := PortMapping{Protocol: "tcp"}
+
+	ports := spec
+	if rest, protocol, found := strings.Cut(spec, "/"); found {
+		if protocol != "tcp" && protocol != "udp" {
+			return mapping, fmt.Errorf("invalid port mapping '%s': protocol must be tcp or udp", spec)
+		}
+		ports, mapping.Protocol = rest, protocol
+	}
+
+	parts := strings.Split(ports, ":")
+	var hostPart, containerPart string
+	switch len(parts) {
+	case 1:
+		hostPart, containerPart = parts[0], parts[0]
+	case 2:
+		hostPart, containerPart = parts[0], parts[1]
+	case 3:
+		mapping.HostIP, hostPart, containerPart = parts[0], parts[1], parts[2]
+	default:
+		return mapping, fmt.Errorf("invalid port mapping '%s'", spec)
+	}
+
+	var err error
+	if mapping.HostStart, mapping.HostEnd, err = parsePortRange(hostPart); err != nil {
+		return mapping, fmt.Errorf("invalid port mapping '%s': %w", spec, err)
+	}
+	if mapping.ContainerStart, mapping.ContainerEnd, err = parsePortRange(containerPart); err != nil {
+		return mapping, fmt.Errorf("invalid port mapping '%s': %w", spec, err)
+	}
+	if mapping.HostEnd-mapping.HostStart != mapping.ContainerEnd-mapping.ContainerStart {
+		return mapping, fmt.Errorf("invalid port mapping '%s': host and container ranges differ in size", spec)
+	}
+	return mapping, nil
+}
+
+// ForReplica returns the mapping used by replica index of a scaled service.
+// Replica 1 keeps the host ports; each further replica shifts them by the
+// size of the host range, so 8080:80 becomes 8081:80 for replica 2 and
+// 8000-8009:9000-9009 becomes 8010-8019:9000-9009.
+func (m PortMapping) ForReplica(index int) PortMapping {
+	offset := (index - 1) * (m.HostEnd - m.HostStart + 1)
+	m.HostStart += offset
+	m.HostEnd += offset
+	return m
+}
+
+// String formats the mapping as a ports entry
+func (m PortMapping) String() string {
+	spec := portRange(m.HostStart, m.HostEnd) + ":" + portRange(m.ContainerStart, m.ContainerEnd) + "/" + m.Protocol
+	if m.HostIP != "" {
+		spec = m.HostIP + ":" + spec
+	}
+	return spec
+}
+
+func portRange(start, end int) string {
+	if start == end {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d-%d", start, end)
+}
+
+// ReplicaPorts returns the port mappings of replica index of the service,
+// with host ports offset as described by PortMapping.ForReplica. The
+// service has been validated, so every entry parses.
+func (s Service) ReplicaPorts(index int) []PortMapping {
+	mappings := make([]PortMapping, 0, len(s.Ports))
+	for _, spec := range s.Ports {
+		mapping, err := ParsePortMapping(spec)
+		if err != nil {
+			continue
+		}
+		mappings = append(mappings, mapping.ForReplica(index))
+	}
+	return mappings
+}
+
+// parsePortRange parses a port or a START-END port range
+func parsePortRange(value string) (int, int, error) {
+	startText, endText, isRange := strings.Cut(value, "-")
+	start, err := strconv.Atoi(startText)
+	if err != nil || start < 1 || start > 65535 {
+		return 0, 0, fmt.Errorf("'%s' is not a port between 1 and 65535", startText)
+	}
+	if !isRange {
+		return start, start, nil
+	}
+	end, err := strconv.Atoi(endText)
+	if err != nil || end < 1 || end > 65535 {
+		return 0, 0, fmt.Errorf("'%s' is not a port between 1 and 65535", endText)
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("port range '%s' ends before it starts", value)
+	}
+	return start, end, nil
+}
+
+// replicaPort is a ports entry as used by one replica of a service
+type replicaPort struct {
+	spec    string
+	replica int
+	mapping PortMapping
+}
+
+func (p replicaPort) label() string {
+	if p.replica > 1 {
+		return fmt.Sprintf("'%s' (replica %d)", p.spec, p.replica)
+	}
+	return fmt.Sprintf("'%s'", p.spec)
+}
+
+// validatePorts checks that a service's ports entries are well formed and
+// that none of its replicas map the same host port twice
+func validatePorts(ports []string, replicas int) error {
+	var mappings []replicaPort
+	for _, spec := range ports {
+		mapping, err := ParsePortMapping(spec)
+		if err != nil {
+			return err
+		}
+		for replica := 1; replica <= replicas; replica++ {
+			shifted := mapping.ForReplica(replica)
+			if shifted.HostEnd > 65535 {
+				return fmt.Errorf("ports '%s': replica %d would map host ports beyond 65535", spec, replica)
+			}
+			mappings = append(mappings, replicaPort{spec: spec, replica: replica, mapping: shifted})
+		}
+	}
+
+	for i := range mappings {
+		for j := i + 1; j < len(mappings); j++ {
+			if err := portOverlap(mappings[i], mappings[j]); err != "" {
+				return fmt.Errorf("ports %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// portOverlap describes the host ports two entries both map, or returns ""
+// if they map none in common
+func portOverlap(p, q replicaPort) string {
+	a, b := p.mapping, q.mapping
+	if a.Protocol != b.Protocol {
+		return ""
+	}
+	// An empty host IP binds every address, so it clashes with any IP
+	if a.HostIP != "" && b.HostIP != "" && a.HostIP != b.HostIP {
+		return ""
+	}
+	start, end := max(a.HostStart, b.HostStart), min(a.HostEnd, b.HostEnd)
+	if start > end {
+		return ""
+	}
+	if start == end {
+		return fmt.Sprintf("%s and %s both map host port %d", p.label(), q.label(), start)
+	}
+	return fmt.Sprintf("%s and %s overlap on host ports %d-%d", p.label(), q.label(), start, end)
+}
+
+// validateStackPorts checks that no two services map the same host port,
+// counting every replica. Each service's own ports have been validated.
+func (s *LXCStack) validateStackPorts() error {
+	names := make([]string, 0, len(s.Services))
+	for name := range s.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mappings []replicaPort
+	var owners []string
+	for _, name := range names {
+		service := s.Services[name]
+		for _, spec := range service.Ports {
+			mapping, err := ParsePortMapping(spec)
+			if err != nil {
+				continue
+			}
+			for replica := 1; replica <= max(service.Scale, 1); replica++ {
+				mappings = append(mappings, replicaPort{spec: spec, replica: replica, mapping: mapping.ForReplica(replica)})
+				owners = append(owners, name)
+			}
+		}
+	}
+
+	for i := range mappings {
+		for j := i + 1; j < len(mappings); j++ {
+			if owners[i] == owners[j] {
+				continue
+			}
+			if err := portOverlap(mappings[i], mappings[j]); err != "" {
+				return fmt.Errorf("services '%s' and '%s': ports %s", owners[i], owners[j], err)
+			}
+		}
+	}
+	return nil
+}
+
+// PidService returns the service whose PID namespace this service shares,
+// or "" unless pid uses the service:<name> form
+func (s Service) PidService() string {
+	name, found := strings.CutPrefix(s.Pid, "service:")
+	if !found {
+		return ""
+	}
+	return name
+}
+
+// RequiredResources returns the networks and named volumes defined in the
+// stack that a service uses, which must exist before it is deployed. Host
+// paths and the default network are not included.
+func (s *LXCStack) RequiredResources(service Service) (networks, volumes []string) {
+	for _, network := range service.Networks {
+		if _, defined := s.Networks[network]; defined {
+			networks = append(networks, network)
+		}
+	}
+	for _, volume := range service.Volumes {
+		if name := parseVolumeName(volume); name != "" {
+			if _, defined := s.Volumes[name]; defined {
+				volumes = append(volumes, name)
+			}
+		}
+	}
+	return networks, volumes
+}
+
+var shmSizePattern = regexp.MustCompile(`^(?i)(\d+)\s*([kmg]?)b?$`)
+
+// ParseShmSize parses a size such as "64m", "1g" or "1048576" into bytes
+func ParseShmSize(size string) (int64, error) {
+	match := shmSizePattern.FindStringSubmatch(strings.TrimSpace(size))
+	if match == nil {
+		return 0, fmt.Errorf("invalid shm_size '%s', must be a size such as 64m or 1g", size)
+	}
+	value, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("invalid shm_size '%s', must be a size such as 64m or 1g", size)
+	}
+	switch strings.ToLower(match[2]) {
+	case "k":
+		value *= 1024
+	case "m":
+		value *= 1024 * 1024
+	case "g":
+		value *= 1024 * 1024 * 1024
+	}
+	return value, nil
+}
+
+// RestartPolicy caps how often a failing service is restarted
+type RestartPolicy struct {
+	MaxAttempts int           `yaml:"max_attempts,omitempty"` // Restarts allowed within window (0 = unlimited)
+	Window      time.Duration `yaml:"window,omitempty"`       // Period over which attempts are counted (0 = forever)
+	Delay       time.Duration `yaml:"delay,omitempty"`        // Initial delay, doubled after each consecutive failure
 }
 
 // BuildConfig represents build configuration for a service
@@ -95,6 +424,29 @@ type BuildConfig struct {
 	Dockerfile string            `yaml:"dockerfile,omitempty"`
 	Args       map[string]string `yaml:"args,omitempty"`
 	Target     string            `yaml:"target,omitempty"`
+	CacheFrom  []string          `yaml:"cache_from,omitempty"` // Containers or snapshots to resume builds from (VMID or VMID@snapshot)
+	CacheTo    string            `yaml:"cache_to,omitempty"`   // Container that keeps per-step snapshots of the build (VMID)
+	From       string            `yaml:"from,omitempty"`       // Base template used instead of the LXCfile's from
+}
+
+// CacheRef references a build cache: a container, optionally limited to one
+// of its snapshots
+type CacheRef struct {
+	VMID     int
+	Snapshot string
+}
+
+// ParseCacheRef parses a cache reference of the form VMID or VMID@snapshot
+func ParseCacheRef(ref string) (CacheRef, error) {
+	id, snapshot, _ := strings.Cut(strings.TrimSpace(ref), "@")
+	vmid, err := strconv.Atoi(id)
+	if err != nil || vmid < 100 {
+		return CacheRef{}, fmt.Errorf("invalid cache reference '%s', must be VMID or VMID@snapshot", ref)
+	}
+	if strings.Contains(ref, "@") && snapshot == "" {
+		return CacheRef{}, fmt.Errorf("invalid cache reference '%s', snapshot name is empty", ref)
+	}
+	return CacheRef{VMID: vmid, Snapshot: snapshot}, nil
 }
 
 // Volume represents a named volume definition
@@ -113,11 +465,14 @@ type Network struct {
 	Options  map[string]string `yaml:"options,omitempty"`
 }
 
-// Secret represents a secret definition
+// Secret represents a secret definition. Its content comes from exactly
+// one source: a file, an environment variable of the host running pxc, or
+// the secrets provider for external secrets.
 type Secret struct {
-	File     string `yaml:"file,omitempty"`
-	External bool   `yaml:"external,omitempty"`
-	Name     string `yaml:"name,omitempty"`
+	File        string `yaml:"file,omitempty"`
+	Environment string `yaml:"environment,omitempty"` // Name of the environment variable
+	External    bool   `yaml:"external,omitempty"`
+	Name        string `yaml:"name,omitempty"` // Name the provider knows an external secret by
 }
 
 // Config represents a configuration file definition
@@ -127,6 +482,11 @@ type Config struct {
 	Mode   int    `yaml:"mode,omitempty"`
 	User   string `yaml:"user,omitempty"`
 	Group  string `yaml:"group,omitempty"`
+
+	// Template substitutes ${VAR} references in the file for each service
+	// that uses it, from the service's build args and environment and from
+	// pxc's environment
+	Template bool `yaml:"template,omitempty"`
 }
 
 // BackupConfig represents backup configuration
@@ -150,6 +510,9 @@ type ProxmoxConfig struct {
 	Node            string `yaml:"node,omitempty"`
 	Storage         string `yaml:"storage,omitempty"`
 	TemplateStorage string `yaml:"template_storage,omitempty"`
+
+	// Cluster nodes services may be placed on with node; any node if unset
+	Nodes []string `yaml:"nodes,omitempty"`
 }
 
 // Hooks represents lifecycle event hooks
@@ -158,6 +521,12 @@ type Hooks struct {
 	PostStart []string `yaml:"post_start,omitempty"`
 	PreStop   []string `yaml:"pre_stop,omitempty"`
 	PostStop  []string `yaml:"post_stop,omitempty"`
+
+	// Init hooks run after networks and volumes exist but before any service starts
+	Init []string `yaml:"init,omitempty"`
+
+	// Run init hooks in an ephemeral container from this template instead of on the host
+	InitTemplate string `yaml:"init_template,omitempty"`
 }
 
 // Development represents development overrides
@@ -166,51 +535,90 @@ type Development struct {
 	ExtraServices map[string]Service `yaml:"extra_services,omitempty"`
 }
 
-// Validate performs basic validation on the LXCStack
+// Validate performs basic validation on the LXCStack. Every problem found
+// is reported, joined with errors.Join; for each service, the first one.
 func (s *LXCStack) Validate() error {
+	var errs []error
 	if s.Version == "" {
-		return fmt.Errorf("'version' field is required")
+		errs = append(errs, fmt.Errorf("'version' field is required"))
 	}
 
 	if len(s.Services) == 0 {
-		return fmt.Errorf("'services' field is required and must contain at least one service")
+		errs = append(errs, fmt.Errorf("'services' field is required and must contain at least one service"))
+	}
+
+	if err := s.validateNodes(); err != nil {
+		errs = append(errs, err)
 	}
 
 	// Validate services
-	for name, service := range s.Services {
-		if err := s.validateService(name, service); err != nil {
-			return fmt.Errorf("service '%s': %w", name, err)
+	serviceNames := sortedKeys(s.Services)
+	for _, name := range serviceNames {
+		if err := s.validateService(name, s.Services[name]); err != nil {
+			errs = append(errs, fmt.Errorf("service '%s': %w", name, err))
+		}
+	}
+
+	if err := s.validateStackPorts(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate secret sources
+	for _, name := range sortedKeys(s.Secrets) {
+		if err := validateSecret(s.Secrets[name]); err != nil {
+			errs = append(errs, fmt.Errorf("secret '%s': %w", name, err))
 		}
 	}
 
 	// Validate network references
-	for serviceName, service := range s.Services {
-		for _, networkName := range service.Networks {
+	for _, serviceName := range serviceNames {
+		for _, networkName := range s.Services[serviceName].Networks {
 			if _, exists := s.Networks[networkName]; !exists && networkName != "default" {
-				return fmt.Errorf("service '%s' references undefined network '%s'", serviceName, networkName)
+				errs = append(errs, fmt.Errorf("service '%s' references undefined network '%s'", serviceName, networkName))
 			}
 		}
 	}
 
+	// Validate hooks
+	if s.Hooks != nil && s.Hooks.InitTemplate != "" && len(s.Hooks.Init) == 0 {
+		errs = append(errs, fmt.Errorf("hooks: 'init_template' requires at least one 'init' hook"))
+	}
+
 	// Validate volume references
-	for serviceName, service := range s.Services {
-		for _, volume := range service.Volumes {
+	for _, serviceName := range serviceNames {
+		for _, volume := range s.Services[serviceName].Volumes {
 			// Parse volume string (name:path or host:container format)
 			if volumeName := parseVolumeName(volume); volumeName != "" {
 				if _, exists := s.Volumes[volumeName]; !exists {
 					// Check if it's a host path (starts with /) - those are valid
 					if volumeName[0] != '/' {
-						return fmt.Errorf("service '%s' references undefined volume '%s'", serviceName, volumeName)
+						errs = append(errs, fmt.Errorf("service '%s' references undefined volume '%s'", serviceName, volumeName))
 					}
 				}
 			}
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (s *LXCStack) validateService(name string, service Service) error {
+	if service.ResourceProfile != "" {
+		if _, exists := s.ResourceProfiles[service.ResourceProfile]; !exists {
+			return fmt.Errorf("references undefined resource profile '%s'", service.ResourceProfile)
+		}
+	}
+
+	if err := validateVolumeTargets(service.Volumes); err != nil {
+		return err
+	}
+
+	if service.Node != "" {
+		if err := s.validateServiceNode(service.Node); err != nil {
+			return err
+		}
+	}
+
 	// Must have either build config or template
 	if !service.HasBuild() && service.Template == "" {
 		return fmt.Errorf("must specify either 'build' or 'template'")
@@ -227,6 +635,20 @@ func (s *LXCStack) validateService(name string, service Service) error {
 		if buildConfig == nil || buildConfig.Context == "" {
 			return fmt.Errorf("build context is required")
 		}
+		for _, ref := range buildConfig.CacheFrom {
+			if _, err := ParseCacheRef(ref); err != nil {
+				return fmt.Errorf("build cache_from: %w", err)
+			}
+		}
+		if buildConfig.CacheTo != "" {
+			cacheTo, err := ParseCacheRef(buildConfig.CacheTo)
+			if err != nil {
+				return fmt.Errorf("build cache_to: %w", err)
+			}
+			if cacheTo.Snapshot != "" {
+				return fmt.Errorf("build cache_to must be a container ID, not a snapshot")
+			}
+		}
 	}
 
 	// Validate dependencies
@@ -234,6 +656,15 @@ func (s *LXCStack) validateService(name string, service Service) error {
 		if _, exists := s.Services[dep]; !exists {
 			return fmt.Errorf("depends_on references undefined service '%s'", dep)
 		}
+		switch service.DependencyCondition(dep) {
+		case ConditionServiceStarted:
+		case ConditionServiceHealthy:
+			if s.Services[dep].Health == nil {
+				return fmt.Errorf("depends_on %s: condition %s needs a health check on service '%s'", dep, ConditionServiceHealthy, dep)
+			}
+		default:
+			return fmt.Errorf("depends_on %s: unsupported condition '%s' (supported: %s, %s)", dep, service.DependencyCondition(dep), ConditionServiceStarted, ConditionServiceHealthy)
+		}
 	}
 
 	// Validate restart policy
@@ -251,10 +682,106 @@ func (s *LXCStack) validateService(name string, service Service) error {
 		}
 	}
 
+	// Validate health check
+	if service.Health != nil {
+		if err := service.Health.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Validate restart backoff
+	if policy := service.RestartPolicy; policy != nil {
+		if policy.MaxAttempts < 0 {
+			return fmt.Errorf("restart_policy: max_attempts cannot be negative")
+		}
+		if policy.Window < 0 {
+			return fmt.Errorf("restart_policy: window cannot be negative")
+		}
+		if policy.Delay < 0 {
+			return fmt.Errorf("restart_policy: delay cannot be negative")
+		}
+	}
+
 	// Validate scale
 	if service.Scale < 0 {
 		return fmt.Errorf("scale cannot be negative")
 	}
+	if err := s.checkReplicaName(name); err != nil {
+		return err
+	}
+
+	// Validate config and secret references
+	for _, configName := range service.Configs {
+		if _, exists := s.Configs[configName]; !exists {
+			return fmt.Errorf("configs references undefined config '%s'", configName)
+		}
+	}
+	for _, secretName := range service.Secrets {
+		if _, exists := s.Secrets[secretName]; !exists {
+			return fmt.Errorf("secrets references undefined secret '%s'", secretName)
+		}
+	}
+	if err := validateFileMounts("secrets", service.SecretMounts); err != nil {
+		return err
+	}
+
+	if err := validatePorts(service.Ports, max(service.Scale, 1)); err != nil {
+		return err
+	}
+
+	// Validate PID namespace sharing
+	if service.Pid != "" && service.Pid != "host" {
+		target := service.PidService()
+		if target == "" {
+			return fmt.Errorf("invalid pid '%s', must be \"host\" or \"service:<name>\"", service.Pid)
+		}
+		if target == name {
+			return fmt.Errorf("pid cannot reference the service itself")
+		}
+		if _, exists := s.Services[target]; !exists {
+			return fmt.Errorf("pid references undefined service '%s'", target)
+		}
+	}
+
+	if service.ShmSize != "" {
+		if _, err := ParseShmSize(service.ShmSize); err != nil {
+			return err
+		}
+	}
+
+	// Validate DNS overrides
+	for _, server := range service.DNS {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid dns entry '%s', must be an IP address", server)
+		}
+	}
+	for _, domain := range service.DNSSearch {
+		if domain == "" || strings.ContainsAny(domain, " \t") {
+			return fmt.Errorf("invalid dns_search entry '%s'", domain)
+		}
+	}
+
+	if service.OSType != "" {
+		if err := ValidateOSType(service.OSType); err != nil {
+			return err
+		}
+	}
+
+	// Validate reload signal
+	if service.ReloadSignal != "" {
+		validSignals := []string{"HUP", "INT", "QUIT", "TERM", "USR1", "USR2", "WINCH"}
+		signal := strings.TrimPrefix(strings.ToUpper(service.ReloadSignal), "SIG")
+		valid := false
+		for _, candidate := range validSignals {
+			if signal == candidate {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid reload_signal '%s', must be one of: %v", service.ReloadSignal, validSignals)
+		}
+	}
 
 	return nil
 }
@@ -272,6 +799,87 @@ func parseVolumeName(volume string) string {
 	return ""
 }
 
+// VolumeMount is a service volume entry of the form source:target[:mode]
+type VolumeMount struct {
+	Source   string // Named volume or host path; empty for an anonymous volume
+	Target   string // Path in the container
+	ReadOnly bool   // Mode ro
+}
+
+// ParseVolumeMount parses a service volume entry: a named volume or host
+// path mounted at a container path, optionally read-only with mode ro, or
+// an anonymous volume given as a container path only
+func ParseVolumeMount(volume string) VolumeMount {
+	parts := splitVolume(volume)
+	if len(parts) < 2 {
+		return VolumeMount{Target: parts[0]}
+	}
+	mount := VolumeMount{Source: parts[0], Target: parts[1]}
+	if len(parts) > 2 {
+		for _, option := range strings.Split(parts[2], ",") {
+			if option == "ro" {
+				mount.ReadOnly = true
+			}
+		}
+	}
+	return mount
+}
+
+// volumeTarget returns the container path of a volume entry: the second
+// field of source:target[:mode], or the whole entry for an anonymous volume
+func volumeTarget(volume string) string {
+	parts := splitVolume(volume)
+	if len(parts) >= 2 {
+		return parts[1]
+	}
+	return parts[0]
+}
+
+// validateVolumeTargets checks that every volume of a service mounts to an
+// absolute container path and that no two mount to the same one
+func validateVolumeTargets(volumes []string) error {
+	targets := make(map[string]string, len(volumes))
+	for _, volume := range volumes {
+		target := volumeTarget(volume)
+		if !path.IsAbs(target) {
+			return fmt.Errorf("volume '%s': container path '%s' must be absolute", volume, target)
+		}
+		target = path.Clean(target)
+		if other, exists := targets[target]; exists {
+			return fmt.Errorf("volumes '%s' and '%s' both mount to %s", other, volume, target)
+		}
+		targets[target] = volume
+	}
+	return nil
+}
+
+// CheckBindSources checks that the host paths bind mounted into services
+// exist. Unlike Validate it looks at the local filesystem, so it only
+// applies on the Proxmox host the stack is deployed from.
+func (s *LXCStack) CheckBindSources() error {
+	names := make([]string, 0, len(s.Services))
+	for name := range s.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, volume := range s.Services[name].Volumes {
+			source := parseVolumeName(volume)
+			if !strings.HasPrefix(source, "/") {
+				continue
+			}
+			if _, err := os.Stat(source); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("service '%s': bind mount source '%s' of volume '%s' does not exist", name, source, volume)
+				}
+				return fmt.Errorf("service '%s': cannot access bind mount source '%s': %w", name, source, err)
+			}
+		}
+	}
+	return nil
+}
+
 // splitVolume splits a volume string by colons, handling Windows paths
 func splitVolume(volume string) []string {
 	// Split by colon, but be careful with Windows paths like C:\path
@@ -294,16 +902,21 @@ func (s *LXCStack) GetServiceDependencyOrder() ([]string, error) {
 	visited := make(map[string]bool)
 	visiting := make(map[string]bool)
 
+	// path holds the services currently being visited, so a back-edge can be
+	// reported as the full cycle rather than a single service
+	var path []string
+
 	var visit func(string) error
 	visit = func(serviceName string) error {
 		if visiting[serviceName] {
-			return fmt.Errorf("circular dependency detected involving service '%s'", serviceName)
+			return fmt.Errorf("circular dependency detected: %s", formatCyclePath(path, serviceName))
 		}
 		if visited[serviceName] {
 			return nil
 		}
 
 		visiting[serviceName] = true
+		path = append(path, serviceName)
 
 		service := s.Services[serviceName]
 		for _, dep := range service.DependsOn {
@@ -311,7 +924,14 @@ func (s *LXCStack) GetServiceDependencyOrder() ([]string, error) {
 				return err
 			}
 		}
+		// A shared PID namespace must exist before the container joins it
+		if target := service.PidService(); target != "" {
+			if err := visit(target); err != nil {
+				return err
+			}
+		}
 
+		path = path[:len(path)-1]
 		visiting[serviceName] = false
 		visited[serviceName] = true
 		order = append(order, serviceName)
@@ -319,7 +939,15 @@ func (s *LXCStack) GetServiceDependencyOrder() ([]string, error) {
 		return nil
 	}
 
+	// Visit services in a stable order so the result and any cycle report
+	// don't depend on map iteration
+	names := make([]string, 0, len(s.Services))
 	for serviceName := range s.Services {
+		names = append(names, serviceName)
+	}
+	sort.Strings(names)
+
+	for _, serviceName := range names {
 		if err := visit(serviceName); err != nil {
 			return nil, err
 		}
@@ -328,6 +956,179 @@ func (s *LXCStack) GetServiceDependencyOrder() ([]string, error) {
 	return order, nil
 }
 
+// formatCyclePath renders the cycle that closes at serviceName, e.g. "a -> b -> a"
+func formatCyclePath(path []string, serviceName string) string {
+	start := 0
+	for i, name := range path {
+		if name == serviceName {
+			start = i
+			break
+		}
+	}
+
+	cycle := append(append([]string{}, path[start:]...), serviceName)
+	return strings.Join(cycle, " -> ")
+}
+
+// PrioritizeService reorders a dependency order so that the named service and
+// its transitive dependencies come first, keeping their relative order
+func (s *LXCStack) PrioritizeService(order []string, name string) []string {
+	needed := s.withDependencies([]string{name})
+
+	prioritized := make([]string, 0, len(order))
+	var rest []string
+	for _, service := range order {
+		if needed[service] {
+			prioritized = append(prioritized, service)
+		} else {
+			rest = append(rest, service)
+		}
+	}
+	return append(prioritized, rest...)
+}
+
+// SelectServices filters a dependency order down to the named services and,
+// with withDeps, everything they transitively depend on, keeping the order
+func (s *LXCStack) SelectServices(order []string, names []string, withDeps bool) []string {
+	selected := make(map[string]bool, len(names))
+	if withDeps {
+		selected = s.withDependencies(names)
+	} else {
+		for _, name := range names {
+			selected[name] = true
+		}
+	}
+
+	var filtered []string
+	for _, service := range order {
+		if selected[service] {
+			filtered = append(filtered, service)
+		}
+	}
+	return filtered
+}
+
+// withDependencies returns the named services and their transitive
+// dependencies, including services whose PID namespace they share
+func (s *LXCStack) withDependencies(names []string) map[string]bool {
+	needed := make(map[string]bool)
+	var collect func(string)
+	collect = func(service string) {
+		if needed[service] {
+			return
+		}
+		needed[service] = true
+		for _, dep := range s.Services[service].DependsOn {
+			collect(dep)
+		}
+		if target := s.Services[service].PidService(); target != "" {
+			collect(target)
+		}
+	}
+	for _, name := range names {
+		collect(name)
+	}
+	return needed
+}
+
+// checkReplicaName fails if name is taken by a replica of a scaled service:
+// replicas after the first are named <service>-<N>, e.g. web-2
+func (s *LXCStack) checkReplicaName(name string) error {
+	index := strings.LastIndex(name, "-")
+	if index <= 0 {
+		return nil
+	}
+	base, suffix := name[:index], name[index+1:]
+	replica, err := strconv.Atoi(suffix)
+	if err != nil || replica < 2 || strconv.Itoa(replica) != suffix {
+		return nil
+	}
+	if owner, exists := s.Services[base]; exists && owner.Scale >= replica {
+		return fmt.Errorf("name collides with replica %d of service '%s', which has scale %d", replica, base, owner.Scale)
+	}
+	return nil
+}
+
+// ApplyScale overrides service scale values with the given replica counts.
+// Every entry must name a defined service and use a non-negative count, and
+// no other service may be named like one of the replicas.
+func (s *LXCStack) ApplyScale(scales map[string]int) error {
+	names := make([]string, 0, len(scales))
+	for name := range scales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		service, exists := s.Services[name]
+		if !exists {
+			return fmt.Errorf("scale references undefined service '%s'", name)
+		}
+		if scales[name] < 0 {
+			return fmt.Errorf("service '%s': scale cannot be negative", name)
+		}
+
+		service.Scale = scales[name]
+		s.Services[name] = service
+	}
+
+	for name := range s.Services {
+		if err := s.checkReplicaName(name); err != nil {
+			return fmt.Errorf("service '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyResourceProfiles expands the resource_profile of each service into its
+// resources. Fields the service sets in resources override the profile's.
+func (s *LXCStack) ApplyResourceProfiles() error {
+	for name, service := range s.Services {
+		if service.ResourceProfile == "" {
+			continue
+		}
+		profile, exists := s.ResourceProfiles[service.ResourceProfile]
+		if !exists {
+			return fmt.Errorf("service '%s' references undefined resource profile '%s'", name, service.ResourceProfile)
+		}
+
+		resources := profile
+		if service.Resources != nil {
+			resources = profile.Override(*service.Resources)
+		}
+		service.Resources = &resources
+		s.Services[name] = service
+	}
+	return nil
+}
+
+// ApplyDefaultResources fills in the memory and cores of services that
+// don't set them from settings.default_resources, as deploying does
+func (s *LXCStack) ApplyDefaultResources() {
+	if s.Settings == nil || s.Settings.DefaultResources == nil {
+		return
+	}
+	defaults := s.Settings.DefaultResources
+	if defaults.Memory == 0 && defaults.Cores == 0 {
+		return
+	}
+	for name, service := range s.Services {
+		var resources Resources
+		if service.Resources != nil {
+			resources = *service.Resources
+		}
+		if resources.Memory == 0 {
+			resources.Memory = defaults.Memory
+		}
+		if resources.Cores == 0 {
+			resources.Cores = defaults.Cores
+		}
+		service.Resources = &resources
+		s.Services[name] = service
+	}
+}
+
 // GetBuildConfig returns the build configuration for a service
 func (s *Service) GetBuildConfig() *BuildConfig {
 	if s.Build == nil {
@@ -352,6 +1153,27 @@ func (s *Service) GetBuildConfig() *BuildConfig {
 		if target, ok := build["target"].(string); ok {
 			config.Target = target
 		}
+		if from, ok := build["from"].(string); ok {
+			config.From = from
+		}
+		switch cacheFrom := build["cache_from"].(type) {
+		case string:
+			config.CacheFrom = []string{cacheFrom}
+		case []interface{}:
+			for _, ref := range cacheFrom {
+				if strVal, ok := ref.(string); ok {
+					config.CacheFrom = append(config.CacheFrom, strVal)
+				} else if intVal, ok := ref.(int); ok {
+					config.CacheFrom = append(config.CacheFrom, strconv.Itoa(intVal))
+				}
+			}
+		}
+		switch cacheTo := build["cache_to"].(type) {
+		case string:
+			config.CacheTo = cacheTo
+		case int:
+			config.CacheTo = strconv.Itoa(cacheTo)
+		}
 		if args, ok := build["args"].(map[string]interface{}); ok {
 			config.Args = make(map[string]string)
 			for k, v := range args {
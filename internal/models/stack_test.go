@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -210,6 +213,270 @@ func TestLXCStackValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "negative restart max attempts",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {
+						Build:         "./web",
+						RestartPolicy: &RestartPolicy{MaxAttempts: -1},
+					},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web': restart_policy: max_attempts cannot be negative",
+		},
+		{
+			name: "init template without init hooks",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web"},
+				},
+				Hooks: &Hooks{InitTemplate: "local:vztmpl/alpine.tar.zst"},
+			},
+			wantErr:  true,
+			errorMsg: "hooks: 'init_template' requires at least one 'init' hook",
+		},
+		{
+			name: "config reload with signal",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {
+						Build:        "./web",
+						Configs:      []string{"nginx_conf"},
+						Secrets:      []string{"tls_key"},
+						ReloadSignal: "SIGHUP",
+					},
+				},
+				Configs: map[string]Config{"nginx_conf": {File: "./nginx.conf", Target: "/etc/nginx/nginx.conf"}},
+				Secrets: map[string]Secret{"tls_key": {File: "./tls.key"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "undefined config reference",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", Configs: []string{"nginx_conf"}},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web': configs references undefined config 'nginx_conf'",
+		},
+		{
+			name: "invalid reload signal",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", ReloadSignal: "RELOAD"},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web': invalid reload_signal 'RELOAD', must be one of: [HUP INT QUIT TERM USR1 USR2 WINCH]",
+		},
+		{
+			name: "multiple distinct ports",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", Ports: []string{"80:8080", "443:8443", "8000-8010:9000-9010", "53:53/udp", "53:53/tcp"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate host port in one service",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", Ports: []string{"80:8080", "443:8443", "80:9090"}},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web': ports '80:8080' and '80:9090' both map host port 80",
+		},
+		{
+			name: "overlapping host port ranges",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", Ports: []string{"8000-8010:9000-9010", "127.0.0.1:8005-8020:7005-7020"}},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web': ports '8000-8010:9000-9010' and '127.0.0.1:8005-8020:7005-7020' overlap on host ports 8005-8010",
+		},
+		{
+			name: "scaled service ports",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", Scale: 3, Ports: []string{"8080:80", "9000-9009:9000-9009"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "scaled service ports collide",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", Scale: 2, Ports: []string{"8080:80", "8081:443"}},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web': ports '8080:80' (replica 2) and '8081:443' both map host port 8081",
+		},
+		{
+			name: "scaled service ports beyond range",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", Scale: 2, Ports: []string{"65535:80"}},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web': ports '65535:80': replica 2 would map host ports beyond 65535",
+		},
+		{
+			name: "two services map one host port",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"api": {Build: "./api", Scale: 2, Ports: []string{"8080:80"}},
+					"web": {Build: "./web", Ports: []string{"8081:80"}},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "services 'api' and 'web': ports '8080:80' (replica 2) and '8081:80' both map host port 8081",
+		},
+		{
+			name: "two services on different host addresses",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"api": {Build: "./api", Ports: []string{"10.0.0.1:80:80"}},
+					"web": {Build: "./web", Ports: []string{"10.0.0.2:80:80", "80:80/udp"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid port mapping",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web": {Build: "./web", Ports: []string{"80:http"}},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web': invalid port mapping '80:http': 'http' is not a port between 1 and 65535",
+		},
+		{
+			name: "pid shares another service",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"app":     {Build: "./app", ShmSize: "512m"},
+					"sidecar": {Build: "./sidecar", Pid: "service:app"},
+					"tracer":  {Build: "./tracer", Pid: "host"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "pid references undefined service",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"sidecar": {Build: "./sidecar", Pid: "service:app"},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'sidecar': pid references undefined service 'app'",
+		},
+		{
+			name: "invalid pid mode",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"app": {Build: "./app", Pid: "container:app"},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'app': invalid pid 'container:app', must be \"host\" or \"service:<name>\"",
+		},
+		{
+			name: "invalid shm size",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"app": {Build: "./app", ShmSize: "lots"},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'app': invalid shm_size 'lots', must be a size such as 64m or 1g",
+		},
+		{
+			name: "valid dns overrides",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"app": {Build: "./app", DNS: []string{"10.0.0.53", "2001:db8::53"}, DNSSearch: []string{"internal.example.com"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "malformed dns entry",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"app": {Build: "./app", DNS: []string{"dns.example.com"}},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'app': invalid dns entry 'dns.example.com', must be an IP address",
+		},
+		{
+			name: "unknown ostype",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"app": {Template: "ubuntu:22.04", OSType: "windows"},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'app': invalid ostype 'windows', must be one of: alpine, archlinux, centos, debian, devuan, fedora, gentoo, nixos, opensuse, ubuntu, unmanaged",
+		},
+		{
+			name: "service named like a replica",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web":   {Template: "nginx:latest", Scale: 2},
+					"web-2": {Template: "nginx:latest"},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "service 'web-2': name collides with replica 2 of service 'web', which has scale 2",
+		},
+		{
+			name: "service named like a replica beyond scale",
+			stack: LXCStack{
+				Version: "1.0",
+				Services: map[string]Service{
+					"web":    {Template: "nginx:latest", Scale: 2},
+					"web-3":  {Template: "nginx:latest"},
+					"web-01": {Template: "nginx:latest"},
+				},
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -273,6 +540,50 @@ func TestServiceBuildConfig(t *testing.T) {
 			},
 			hasBuild: true,
 		},
+		{
+			name: "object build config with cache",
+			service: Service{
+				Build: map[string]interface{}{
+					"context":    "./web",
+					"cache_from": []interface{}{"9000", "9001@pxc-3f2a9c1b7d4e", 9002},
+					"cache_to":   9000,
+				},
+			},
+			expected: &BuildConfig{
+				Context:   "./web",
+				CacheFrom: []string{"9000", "9001@pxc-3f2a9c1b7d4e", "9002"},
+				CacheTo:   "9000",
+			},
+			hasBuild: true,
+		},
+		{
+			name: "object build config with single cache_from",
+			service: Service{
+				Build: map[string]interface{}{
+					"context":    "./web",
+					"cache_from": "9000",
+				},
+			},
+			expected: &BuildConfig{
+				Context:   "./web",
+				CacheFrom: []string{"9000"},
+			},
+			hasBuild: true,
+		},
+		{
+			name: "object build config with base template override",
+			service: Service{
+				Build: map[string]interface{}{
+					"context": "./web",
+					"from":    "debian:12",
+				},
+			},
+			expected: &BuildConfig{
+				Context: "./web",
+				From:    "debian:12",
+			},
+			hasBuild: true,
+		},
 		{
 			name: "no build config",
 			service: Service{
@@ -321,6 +632,15 @@ func TestServiceBuildConfig(t *testing.T) {
 			if got.Target != tt.expected.Target {
 				t.Errorf("GetBuildConfig().Target = %v, want %v", got.Target, tt.expected.Target)
 			}
+			if !reflect.DeepEqual(got.CacheFrom, tt.expected.CacheFrom) {
+				t.Errorf("GetBuildConfig().CacheFrom = %v, want %v", got.CacheFrom, tt.expected.CacheFrom)
+			}
+			if got.CacheTo != tt.expected.CacheTo {
+				t.Errorf("GetBuildConfig().CacheTo = %v, want %v", got.CacheTo, tt.expected.CacheTo)
+			}
+			if got.From != tt.expected.From {
+				t.Errorf("GetBuildConfig().From = %v, want %v", got.From, tt.expected.From)
+			}
 
 			// Test Args
 			if tt.expected.Args != nil {
@@ -338,6 +658,129 @@ func TestServiceBuildConfig(t *testing.T) {
 	}
 }
 
+func TestParseCacheRef(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected CacheRef
+		wantErr  bool
+	}{
+		{ref: "9000", expected: CacheRef{VMID: 9000}},
+		{ref: "9000@pxc-3f2a9c1b7d4e", expected: CacheRef{VMID: 9000, Snapshot: "pxc-3f2a9c1b7d4e"}},
+		{ref: "web:latest", wantErr: true},
+		{ref: "99", wantErr: true},
+		{ref: "9000@", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseCacheRef(tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseCacheRef(%q) expected error, got %+v", tt.ref, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCacheRef(%q) unexpected error: %v", tt.ref, err)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseCacheRef(%q) = %+v, want %+v", tt.ref, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParsePortMapping(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected PortMapping
+		wantErr  bool
+	}{
+		{spec: "8080", expected: PortMapping{HostStart: 8080, HostEnd: 8080, ContainerStart: 8080, ContainerEnd: 8080, Protocol: "tcp"}},
+		{spec: "80:3000", expected: PortMapping{HostStart: 80, HostEnd: 80, ContainerStart: 3000, ContainerEnd: 3000, Protocol: "tcp"}},
+		{spec: "127.0.0.1:53:5353/udp", expected: PortMapping{HostIP: "127.0.0.1", HostStart: 53, HostEnd: 53, ContainerStart: 5353, ContainerEnd: 5353, Protocol: "udp"}},
+		{spec: "8000-8002:9000-9002", expected: PortMapping{HostStart: 8000, HostEnd: 8002, ContainerStart: 9000, ContainerEnd: 9002, Protocol: "tcp"}},
+		{spec: "8000-8002:9000", wantErr: true},
+		{spec: "0:80", wantErr: true},
+		{spec: "80:70000", wantErr: true},
+		{spec: "90-80:90-80", wantErr: true},
+		{spec: "80:80/sctp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParsePortMapping(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParsePortMapping(%q) = %+v, want error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("ParsePortMapping(%q) = %+v, %v, want %+v", tt.spec, got, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServiceReplicaPorts(t *testing.T) {
+	service := Service{Ports: []string{"8080:80", "127.0.0.1:9000-9009:7000-7009/udp"}}
+
+	tests := []struct {
+		index    int
+		expected []string
+	}{
+		{index: 1, expected: []string{"8080:80/tcp", "127.0.0.1:9000-9009:7000-7009/udp"}},
+		{index: 2, expected: []string{"8081:80/tcp", "127.0.0.1:9010-9019:7000-7009/udp"}},
+		{index: 3, expected: []string{"8082:80/tcp", "127.0.0.1:9020-9029:7000-7009/udp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("replica %d", tt.index), func(t *testing.T) {
+			got := service.ReplicaPorts(tt.index)
+			specs := make([]string, len(got))
+			for i, mapping := range got {
+				specs[i] = mapping.String()
+			}
+			if !reflect.DeepEqual(specs, tt.expected) {
+				t.Errorf("ReplicaPorts(%d) = %v, want %v", tt.index, specs, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseShmSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+		wantErr  bool
+	}{
+		{size: "1048576", expected: 1048576},
+		{size: "64k", expected: 64 * 1024},
+		{size: "256m", expected: 256 * 1024 * 1024},
+		{size: "1G", expected: 1024 * 1024 * 1024},
+		{size: "512mb", expected: 512 * 1024 * 1024},
+		{size: "0", wantErr: true},
+		{size: "-1m", wantErr: true},
+		{size: "1t", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := ParseShmSize(tt.size)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseShmSize(%q) = %d, want error", tt.size, got)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("ParseShmSize(%q) = %d, %v, want %d", tt.size, got, err, tt.expected)
+			}
+		})
+	}
+}
+
 func TestGetServiceDependencyOrder(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -356,6 +799,16 @@ func TestGetServiceDependencyOrder(t *testing.T) {
 			},
 			expected: []string{"web", "database"}, // order may vary, but should contain both
 		},
+		{
+			name: "pid namespace owner starts first",
+			stack: LXCStack{
+				Services: map[string]Service{
+					"agent": {Build: "./agent", Pid: "service:web"},
+					"web":   {Build: "./web"},
+				},
+			},
+			expected: []string{"web", "agent"},
+		},
 		{
 			name: "simple dependency chain",
 			stack: LXCStack{
@@ -409,7 +862,49 @@ func TestGetServiceDependencyOrder(t *testing.T) {
 				},
 			},
 			wantErr:  true,
-			errorMsg: "circular dependency detected",
+			errorMsg: "circular dependency detected: api -> web -> api",
+		},
+		{
+			name: "three service cycle",
+			stack: LXCStack{
+				Services: map[string]Service{
+					"web": {
+						Build:     "./web",
+						DependsOn: []string{"api"},
+					},
+					"api": {
+						Build:     "./api",
+						DependsOn: []string{"worker"},
+					},
+					"worker": {
+						Build:     "./worker",
+						DependsOn: []string{"web"},
+					},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "circular dependency detected: api -> worker -> web -> api",
+		},
+		{
+			name: "cycle reached through an acyclic prefix",
+			stack: LXCStack{
+				Services: map[string]Service{
+					"app": {
+						Build:     "./app",
+						DependsOn: []string{"web"},
+					},
+					"web": {
+						Build:     "./web",
+						DependsOn: []string{"worker"},
+					},
+					"worker": {
+						Build:     "./worker",
+						DependsOn: []string{"web"},
+					},
+				},
+			},
+			wantErr:  true,
+			errorMsg: "circular dependency detected: web -> worker -> web",
 		},
 		{
 			name: "self dependency",
@@ -422,7 +917,7 @@ func TestGetServiceDependencyOrder(t *testing.T) {
 				},
 			},
 			wantErr:  true,
-			errorMsg: "circular dependency detected involving service 'web'",
+			errorMsg: "circular dependency detected: web -> web",
 		},
 	}
 
@@ -436,15 +931,7 @@ func TestGetServiceDependencyOrder(t *testing.T) {
 					return
 				}
 				if tt.errorMsg != "" && err.Error() != tt.errorMsg {
-					// For circular dependency, we just check that the error message contains the expected text
-					if tt.errorMsg == "circular dependency detected" {
-						if err.Error() != "circular dependency detected involving service 'web'" && 
-						   err.Error() != "circular dependency detected involving service 'api'" {
-							t.Errorf("GetServiceDependencyOrder() error = %v, want error containing %v", err.Error(), tt.errorMsg)
-						}
-					} else if err.Error() != tt.errorMsg {
-						t.Errorf("GetServiceDependencyOrder() error = %v, want %v", err.Error(), tt.errorMsg)
-					}
+					t.Errorf("GetServiceDependencyOrder() error = %v, want %v", err.Error(), tt.errorMsg)
 				}
 				return
 			}
@@ -532,4 +1019,248 @@ func TestParseVolumeName(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestParseVolumeMount(t *testing.T) {
+	tests := []struct {
+		volume   string
+		expected VolumeMount
+	}{
+		{volume: "db-data:/var/lib/postgresql/data", expected: VolumeMount{Source: "db-data", Target: "/var/lib/postgresql/data"}},
+		{volume: "/srv/www:/usr/share/nginx/html:ro", expected: VolumeMount{Source: "/srv/www", Target: "/usr/share/nginx/html", ReadOnly: true}},
+		{volume: "logs:/var/log:rw", expected: VolumeMount{Source: "logs", Target: "/var/log"}},
+		{volume: "/var/cache/app", expected: VolumeMount{Target: "/var/cache/app"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.volume, func(t *testing.T) {
+			if got := ParseVolumeMount(tt.volume); got != tt.expected {
+				t.Errorf("ParseVolumeMount(%q) = %+v, want %+v", tt.volume, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyScale(t *testing.T) {
+	newStack := func() *LXCStack {
+		return &LXCStack{
+			Version: "1.0",
+			Services: map[string]Service{
+				"web":    {Template: "nginx:latest", Scale: 2},
+				"worker": {Template: "python:3.11"},
+			},
+		}
+	}
+
+	t.Run("overrides stack scale", func(t *testing.T) {
+		stack := newStack()
+		if err := stack.ApplyScale(map[string]int{"web": 5, "worker": 3}); err != nil {
+			t.Fatalf("ApplyScale() unexpected error: %v", err)
+		}
+		if stack.Services["web"].Scale != 5 {
+			t.Errorf("web scale = %d, want 5", stack.Services["web"].Scale)
+		}
+		if stack.Services["worker"].Scale != 3 {
+			t.Errorf("worker scale = %d, want 3", stack.Services["worker"].Scale)
+		}
+	})
+
+	t.Run("unlisted services keep stack scale", func(t *testing.T) {
+		stack := newStack()
+		if err := stack.ApplyScale(map[string]int{"worker": 3}); err != nil {
+			t.Fatalf("ApplyScale() unexpected error: %v", err)
+		}
+		if stack.Services["web"].Scale != 2 {
+			t.Errorf("web scale = %d, want 2", stack.Services["web"].Scale)
+		}
+	})
+
+	t.Run("unknown service", func(t *testing.T) {
+		err := newStack().ApplyScale(map[string]int{"api": 2})
+		if err == nil || err.Error() != "scale references undefined service 'api'" {
+			t.Errorf("ApplyScale() error = %v, want undefined service error", err)
+		}
+	})
+
+	t.Run("negative count", func(t *testing.T) {
+		err := newStack().ApplyScale(map[string]int{"web": -1})
+		if err == nil || err.Error() != "service 'web': scale cannot be negative" {
+			t.Errorf("ApplyScale() error = %v, want negative scale error", err)
+		}
+	})
+
+	t.Run("replica named like a service", func(t *testing.T) {
+		stack := newStack()
+		stack.Services["worker-3"] = Service{Template: "python:3.11"}
+		err := stack.ApplyScale(map[string]int{"worker": 3})
+		if err == nil || err.Error() != "service 'worker-3': name collides with replica 3 of service 'worker', which has scale 3" {
+			t.Errorf("ApplyScale() error = %v, want replica name error", err)
+		}
+	})
+}
+
+func TestValidateVolumeTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		volumes  []string
+		errorMsg string
+	}{
+		{
+			name:    "valid set",
+			volumes: []string{"db-data:/var/lib/postgresql/data", "/srv/backup:/backup", "/etc/app:/etc/app:ro", "/cache"},
+		},
+		{
+			name:     "duplicate targets",
+			volumes:  []string{"db-data:/data", "/srv/data:/data/:ro"},
+			errorMsg: "service 'db': volumes 'db-data:/data' and '/srv/data:/data/:ro' both mount to /data",
+		},
+		{
+			name:     "relative target",
+			volumes:  []string{"db-data:var/lib/data"},
+			errorMsg: "service 'db': volume 'db-data:var/lib/data': container path 'var/lib/data' must be absolute",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stack := &LXCStack{
+				Version:  "1.0",
+				Services: map[string]Service{"db": {Template: "postgres:15", Volumes: tt.volumes}},
+				Volumes:  map[string]Volume{"db-data": {}},
+			}
+
+			err := stack.Validate()
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.errorMsg {
+				t.Errorf("Validate() error = %v, want %q", err, tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestCheckBindSources(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+
+	stack := &LXCStack{
+		Version: "1.0",
+		Services: map[string]Service{
+			"db": {Template: "postgres:15", Volumes: []string{"db-data:/data", dir + ":/backup"}},
+		},
+	}
+	if err := stack.CheckBindSources(); err != nil {
+		t.Errorf("CheckBindSources() unexpected error: %v", err)
+	}
+
+	stack.Services["web"] = Service{Template: "nginx:latest", Volumes: []string{missing + ":/srv:ro"}}
+	err := stack.CheckBindSources()
+	want := fmt.Sprintf("service 'web': bind mount source '%s' of volume '%s:/srv:ro' does not exist", missing, missing)
+	if err == nil || err.Error() != want {
+		t.Errorf("CheckBindSources() error = %v, want %q", err, want)
+	}
+}
+
+func TestApplyResourceProfiles(t *testing.T) {
+	newStack := func() *LXCStack {
+		return &LXCStack{
+			Version: "1.0",
+			ResourceProfiles: map[string]Resources{
+				"small": {Cores: 1, Memory: 512},
+				"large": {Cores: 4, Memory: 4096, RootFS: 32},
+			},
+			Services: map[string]Service{
+				"web":    {Template: "nginx:latest", ResourceProfile: "small"},
+				"db":     {Template: "postgres:15", ResourceProfile: "large", Resources: &Resources{Memory: 8192, Swap: 1024}},
+				"worker": {Template: "python:3.11", Resources: &Resources{Cores: 2}},
+			},
+		}
+	}
+
+	t.Run("expands profiles", func(t *testing.T) {
+		stack := newStack()
+		if err := stack.ApplyResourceProfiles(); err != nil {
+			t.Fatalf("ApplyResourceProfiles() unexpected error: %v", err)
+		}
+
+		expected := map[string]Resources{
+			"web":    {Cores: 1, Memory: 512},
+			"db":     {Cores: 4, Memory: 8192, Swap: 1024, RootFS: 32},
+			"worker": {Cores: 2},
+		}
+		for name, want := range expected {
+			if got := stack.Services[name].Resources; got == nil || *got != want {
+				t.Errorf("%s resources = %+v, want %+v", name, got, want)
+			}
+		}
+		if profile := stack.ResourceProfiles["large"]; profile.Memory != 4096 {
+			t.Errorf("override changed the profile: %+v", profile)
+		}
+	})
+
+	t.Run("undefined profile", func(t *testing.T) {
+		stack := newStack()
+		stack.Services["web"] = Service{Template: "nginx:latest", ResourceProfile: "medium"}
+
+		err := stack.ApplyResourceProfiles()
+		if err == nil || err.Error() != "service 'web' references undefined resource profile 'medium'" {
+			t.Errorf("ApplyResourceProfiles() error = %v, want undefined profile error", err)
+		}
+		err = stack.Validate()
+		if err == nil || err.Error() != "service 'web': references undefined resource profile 'medium'" {
+			t.Errorf("Validate() error = %v, want undefined profile error", err)
+		}
+	})
+}
+
+func TestPrioritizeService(t *testing.T) {
+	stack := &LXCStack{
+		Version: "1.0",
+		Services: map[string]Service{
+			"cache":    {Template: "redis:7"},
+			"database": {Template: "postgres:15"},
+			"api":      {Template: "node:18", DependsOn: []string{"database"}},
+			"web":      {Template: "nginx:latest", DependsOn: []string{"api", "cache"}},
+		},
+	}
+
+	order, err := stack.GetServiceDependencyOrder()
+	if err != nil {
+		t.Fatalf("GetServiceDependencyOrder() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		service  string
+		expected []string
+	}{
+		{
+			name:     "service with transitive dependency",
+			service:  "api",
+			expected: []string{"database", "api", "cache", "web"},
+		},
+		{
+			name:     "service without dependencies",
+			service:  "database",
+			expected: []string{"database", "api", "cache", "web"},
+		},
+		{
+			name:     "last service keeps full order",
+			service:  "web",
+			expected: order,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := stack.PrioritizeService(order, tt.service)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("PrioritizeService() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
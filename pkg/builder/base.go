@@ -0,0 +1,90 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// ResolveBaseTemplate checks that a base template is available and returns
+// the reference to create the build container from. It accepts a container
+// template ID, a volume ID such as local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst,
+// or a short name such as debian:12, which is looked up among the template
+// archives on the template storage. The template storage is checked to
+// accept container templates first.
+func (b *Builder) ResolveBaseTemplate(ref string) (string, error) {
+	if _, err := strconv.Atoi(ref); err == nil {
+		return ref, nil
+	}
+
+	if b.config.DryRun {
+		b.log("DRY RUN: Would check that base template %s is available", ref)
+		return ref, nil
+	}
+
+	storage := b.config.TemplateStorage
+	if volumeStorage, path, found := strings.Cut(ref, ":"); found && strings.Contains(path, "/") {
+		storage = volumeStorage
+	}
+	if storage == b.config.TemplateStorage {
+		if err := b.CheckTemplateStorage(); err != nil {
+			return "", err
+		}
+	}
+
+	output, err := b.output(b.ctx, "pvesm", "list", storage, "--content", "vztmpl")
+	if err != nil {
+		return "", fmt.Errorf("failed to list templates on storage '%s': %w", storage, err)
+	}
+	volumes, err := proxmox.ParseStorageList(string(output))
+	if err != nil {
+		return "", err
+	}
+
+	if resolved, ok := matchBaseTemplate(ref, volumes); ok {
+		return resolved, nil
+	}
+	return "", fmt.Errorf("base template '%s' is not available on storage '%s'", ref, storage)
+}
+
+// matchBaseTemplate finds ref among template archives. A volume ID must match
+// exactly; a short name like debian:12 matches archives named debian-12-*,
+// preferring the latest by name.
+func matchBaseTemplate(ref string, volumes []proxmox.StorageVolume) (string, bool) {
+	_, path, _ := strings.Cut(ref, ":")
+	if strings.Contains(path, "/") {
+		for _, volume := range volumes {
+			if volume.VolID == ref {
+				return ref, true
+			}
+		}
+		return "", false
+	}
+
+	prefix := strings.ReplaceAll(ref, ":", "-")
+	var matches []string
+	for _, volume := range volumes {
+		_, file, _ := strings.Cut(volume.VolID, "/")
+		rest, found := strings.CutPrefix(file, prefix)
+		if found && rest != "" && strings.ContainsRune("-_.", rune(rest[0])) {
+			matches = append(matches, volume.VolID)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sort.Strings(matches)
+	return matches[len(matches)-1], true
+}
+
+// WithBaseTemplate returns a copy of lxcfile that builds from another base
+// template. The original is left unchanged.
+func WithBaseTemplate(lxcfile *models.LXCfile, from string) *models.LXCfile {
+	override := *lxcfile
+	override.From = from
+	return &override
+}
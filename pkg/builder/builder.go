@@ -1,17 +1,21 @@
 package builder
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/fatih/color"
-
 	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/output"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
 )
 
 // Config holds configuration for the builder
@@ -26,20 +30,124 @@ type Config struct {
 	// Build settings
 	TempContainerPrefix string
 	TemplateStorage     string
+
+	// Fail the build when a cleanup step fails instead of only warning.
+	// Steps marked ignore_errors never fail the build.
+	AbortOnCleanupError bool
+
+	// Leave the temporary container in place when the build fails
+	KeepOnFailure bool
+
+	// Compression for the exported template archive (none, gzip, zstd, lzo).
+	// Empty keeps the Proxmox default and skips the archive export.
+	Compress string
+
+	// What the build produces (template or tar, see OutputTypes). A tar
+	// output writes the root filesystem to OutputDest instead of
+	// registering a template. Empty means template.
+	OutputType string
+	OutputDest string
+
+	// Reclaim space in the container after the cleanup steps, before it
+	// becomes a template. ReclaimCommands replace DefaultReclaimCommands.
+	Squash          bool
+	ReclaimCommands []string
+
+	// How waitForContainer decides a container is ready (exec, status or
+	// both, default exec)
+	ReadyProbe string
+
+	// How steps are shown (auto, plain or tty, see ProgressModes). Empty
+	// logs without step framing.
+	Progress string
+
+	// Logger filters and formats build logs (default: output.Default()).
+	// Below the info level, step output is not shown either.
+	Logger *output.Logger
+
+	// Output receives build logs and step output (default: the logger's
+	// writer)
+	Output io.Writer
+}
+
+// CompressionAlgorithms lists the supported --compress values
+var CompressionAlgorithms = []string{"none", "gzip", "zstd", "lzo"}
+
+// ValidateCompression checks a compression algorithm against the supported list
+func ValidateCompression(algorithm string) error {
+	if algorithm == "" {
+		return nil
+	}
+	for _, supported := range CompressionAlgorithms {
+		if algorithm == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported compression '%s', must be one of: %s", algorithm, strings.Join(CompressionAlgorithms, ", "))
 }
 
 // Builder handles the building of LXC templates
 type Builder struct {
 	config *Config
+
+	// execStep runs a single setup or cleanup step
+	execStep func(ctx context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error
+
+	// run executes an external command such as pct or vzdump
+	run func(ctx context.Context, name string, args ...string) error
+
+	// output executes an external command and returns its stdout
+	output func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+	// ctx stops the commands of the build it belongs to
+	ctx context.Context
+
+	// sleep pauses between readiness probes
+	sleep func(time.Duration)
+
+	// out receives logs; progress, if set, frames them by step
+	out      io.Writer
+	logger   *output.Logger
+	progress stepProgress
+
+	// templateStorageChecked is set once CheckTemplateStorage has passed
+	templateStorageChecked bool
 }
 
 // BuildResult contains the results of a build operation
 type BuildResult struct {
 	TemplateName  string
 	TemplatePath  string
+	ArchivePath   string // Root filesystem tarball of a tar output
+	Storage       string
 	ContainerID   int
 	BuildDuration time.Duration
 	ExecutedSteps []string
+	Steps         []StepResult
+}
+
+// BuildError reports the build step that failed and the container it ran
+// in. With KeepOnFailure set the container is left in place for inspection.
+type BuildError struct {
+	Step        string
+	ContainerID int
+	Cause       error
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("build step '%s' failed in container %d: %v", e.Step, e.ContainerID, e.Cause)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Cause
+}
+
+// StepResult records the outcome of a setup or cleanup step
+type StepResult struct {
+	Name   string
+	Phase  string // stage | setup | cleanup | squash
+	Status string // ok | failed | ignored | skipped | cached
+	Error  error
 }
 
 // New creates a new Builder instance
@@ -62,15 +170,42 @@ func New(config *Config) *Builder {
 		config.TemplateStorage = "local"
 	}
 
-	return &Builder{config: config}
+	if config.Logger == nil {
+		config.Logger = output.Default()
+	}
+	if config.Output == nil {
+		config.Output = config.Logger.Writer()
+	}
+
+	b := &Builder{config: config, out: config.Output, logger: config.Logger.WithVerbose(config.Verbose), ctx: context.Background()}
+	b.execStep = b.executeSetupStep
+	b.run = b.runCommand
+	b.output = b.outputCommand
+	b.sleep = time.Sleep
+	// Step framing would break up JSON logs, and quiet builds show no steps
+	if !b.logger.JSON() && b.logger.Enabled(output.Info) {
+		b.progress = newStepProgress(ResolveProgress(config.Progress, isTerminalWriter(config.Output)), config.Output, time.Now)
+	}
+
+	return b
 }
 
 // BuildTemplate builds an LXC template from an LXCfile configuration
-func (b *Builder) BuildTemplate(lxcfile *models.LXCfile, templateName string, buildArgs map[string]string) (*BuildResult, error) {
+func (b *Builder) BuildTemplate(ctx context.Context, lxcfile *models.LXCfile, templateName string, buildArgs map[string]string) (*BuildResult, error) {
+	return b.BuildTemplateWithCache(ctx, lxcfile, templateName, buildArgs, CacheOptions{})
+}
+
+// BuildTemplateWithCache builds an LXC template, resuming from the deepest
+// matching cache_from snapshot and writing per-step snapshots to cache_to.
+// When ctx is done the running command is interrupted and the temporary
+// containers are removed as after any failed step.
+func (b *Builder) BuildTemplateWithCache(ctx context.Context, lxcfile *models.LXCfile, templateName string, buildArgs map[string]string, cache CacheOptions) (*BuildResult, error) {
 	startTime := time.Now()
+	b = b.withContext(ctx)
 
 	result := &BuildResult{
 		TemplateName:  templateName,
+		Storage:       b.config.Storage,
 		ExecutedSteps: []string{},
 	}
 
@@ -81,71 +216,178 @@ func (b *Builder) BuildTemplate(lxcfile *models.LXCfile, templateName string, bu
 	}
 	result.ContainerID = containerID
 
-	if b.config.Verbose {
-		b.log("Using temporary container ID: %d", containerID)
+	b.logDebug("Using temporary container ID: %d", containerID)
+
+	// Setup steps run in the cache container when cache_to is set and
+	// there are steps to cache. Stages are covered by their own steps, so
+	// the cache is looked up before any of them is built.
+	keys := stepCacheKeys(lxcfile, buildArgs, stageCacheKeys(lxcfile, buildArgs))
+	setupID := containerID
+	if cache.To != "" && len(keys) > 0 {
+		cacheRef, err := models.ParseCacheRef(cache.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache_to: %w", err)
+		}
+		setupID = cacheRef.VMID
+	}
+
+	// Look up the deepest cached setup step
+	var hit cacheHit
+	var found bool
+	if len(cache.From) > 0 && len(keys) > 0 {
+		if b.config.DryRun {
+			b.log("DRY RUN: Would look up build cache in %s", strings.Join(cache.From, ", "))
+		} else if hit, found = b.findCache(cache.From, keys); found {
+			b.log("Resuming from cache %d@%s (%d of %d setup steps cached)", hit.VMID, hit.Snapshot, hit.Step+1, len(keys))
+		}
+	}
+	first := 0
+	if found {
+		first = hit.Step + 1
 	}
 
-	// Create temporary container from base template
-	if createErr := b.createTempContainer(containerID, lxcfile.From); createErr != nil {
-		return nil, fmt.Errorf("failed to create temporary container: %w", createErr)
+	// Build the stages that the steps still to run copy files from, and
+	// copy the files out of them before the template's own container is
+	// created
+	var artifacts map[string]string
+	if len(lxcfile.StageOrder()) > 0 {
+		dir, err := os.MkdirTemp("", "pxc-stages-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stage directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		pending := append(append([]models.SetupStep(nil), lxcfile.Setup[first:]...), lxcfile.Cleanup...)
+		if artifacts, err = b.buildStages(lxcfile, pending, buildArgs, dir, result); err != nil {
+			return nil, err
+		}
 	}
+	setup := withArtifacts(lxcfile.Setup, buildArgs, artifacts)
 
 	// Track if we should cleanup the container (not if it becomes a template)
-	shouldCleanup := true
+	shouldCleanup := false
+	built := false
 	defer func() {
+		if shouldCleanup && b.config.KeepOnFailure && !built {
+			b.logWarning("Keeping temporary container %d for inspection", containerID)
+			return
+		}
 		if shouldCleanup {
-			if cleanupErr := b.cleanupTempContainer(containerID); cleanupErr != nil {
+			if cleanupErr := b.detached().cleanupTempContainer(containerID); cleanupErr != nil {
 				b.logError("Failed to cleanup temporary container %d: %v", containerID, cleanupErr)
 			}
 		}
 	}()
 
+	// Create the container the setup steps run in
+	osType := models.ResolveOSType(lxcfile.OSType, lxcfile.From)
+	switch {
+	case setupID != containerID:
+		if err := b.prepareCacheContainer(setupID, cache.Hostname, lxcfile.From, osType, keys, hit, found); err != nil {
+			return nil, &BuildError{Step: "prepare cache container", ContainerID: setupID, Cause: err}
+		}
+		defer func() {
+			_ = b.detached().stopContainer(setupID)
+		}()
+	case found:
+		shouldCleanup = true
+		if err := b.cloneFromSnapshot(hit.VMID, hit.Snapshot, containerID); err != nil {
+			return nil, &BuildError{Step: "create container from cache", ContainerID: containerID, Cause: err}
+		}
+	default:
+		shouldCleanup = true
+		if createErr := b.createTempContainer(containerID, lxcfile.From, osType); createErr != nil {
+			return nil, &BuildError{Step: "create container", ContainerID: containerID, Cause: createErr}
+		}
+	}
+
 	// Start the container for configuration
-	if startErr := b.startContainer(containerID); startErr != nil {
-		return nil, fmt.Errorf("failed to start temporary container: %w", startErr)
+	if startErr := b.startContainer(setupID); startErr != nil {
+		return nil, &BuildError{Step: "start container", ContainerID: setupID, Cause: startErr}
 	}
 
 	// Wait for container to be ready
-	if waitErr := b.waitForContainer(containerID); waitErr != nil {
-		return nil, fmt.Errorf("container failed to become ready: %w", waitErr)
+	if waitErr := b.waitForContainer(setupID); waitErr != nil {
+		return nil, &BuildError{Step: "wait for container", ContainerID: setupID, Cause: waitErr}
+	}
+
+	// Record cached steps and snapshot each new step into the cache container
+	if found {
+		for i := 0; i < first; i++ {
+			outcome := StepResult{Name: setupStepName(lxcfile.Setup[i], "setup", i), Phase: "setup", Status: "cached"}
+			b.startStep(len(result.Steps)+1, i+1, len(lxcfile.Setup), "setup", outcome.Name)
+			b.finishStep(outcome)
+			result.Steps = append(result.Steps, outcome)
+		}
+	}
+	var afterStep func(index int) error
+	if setupID != containerID {
+		afterStep = func(index int) error {
+			return b.runPCTCommand("snapshot", strconv.Itoa(setupID), keys[index])
+		}
 	}
 
 	// Execute setup steps
-	for i, step := range lxcfile.Setup {
-		stepName := fmt.Sprintf("Step %d", i+1)
+	if err := b.runSteps(setupID, "setup", setup, first, buildArgs, result, afterStep); err != nil {
+		return nil, err
+	}
 
-		if err := b.executeSetupStep(containerID, step, stepName, buildArgs); err != nil {
-			return nil, fmt.Errorf("failed to execute %s: %w", stepName, err)
+	// Continue in a copy of the cache container so the cache keeps its state.
+	// The cache container is only used with setup steps to snapshot, but
+	// without any there is no snapshot to continue from.
+	if setupID != containerID {
+		if len(keys) == 0 {
+			return nil, &BuildError{Step: "create container from cache", ContainerID: containerID, Cause: fmt.Errorf("cache container %d has no snapshot to continue from", setupID)}
+		}
+		shouldCleanup = true
+		if err := b.cloneFromSnapshot(setupID, keys[len(keys)-1], containerID); err != nil {
+			return nil, &BuildError{Step: "create container from cache", ContainerID: containerID, Cause: err}
+		}
+		if err := b.startContainer(containerID); err != nil {
+			return nil, &BuildError{Step: "start container", ContainerID: containerID, Cause: err}
+		}
+		if err := b.waitForContainer(containerID); err != nil {
+			return nil, &BuildError{Step: "wait for container", ContainerID: containerID, Cause: err}
 		}
-
-		result.ExecutedSteps = append(result.ExecutedSteps, stepName)
 	}
 
 	// Apply resource and security configurations
 	if err := b.applyContainerConfig(containerID, lxcfile); err != nil {
-		return nil, fmt.Errorf("failed to apply container configuration: %w", err)
+		return nil, &BuildError{Step: "apply configuration", ContainerID: containerID, Cause: err}
 	}
 
 	// Execute cleanup steps if any
-	for i, step := range lxcfile.Cleanup {
-		stepName := fmt.Sprintf("Cleanup %d", i+1)
+	if err := b.runSteps(containerID, "cleanup", withArtifacts(lxcfile.Cleanup, buildArgs, artifacts), 0, buildArgs, result, nil); err != nil {
+		return nil, err
+	}
 
-		if err := b.executeSetupStep(containerID, step, stepName, buildArgs); err != nil {
-			b.logWarning("Cleanup step failed (continuing): %v", err)
-		} else {
-			result.ExecutedSteps = append(result.ExecutedSteps, stepName)
+	// Reclaim space left behind by the steps
+	if b.config.Squash {
+		if err := b.squash(containerID, result); err != nil {
+			return nil, err
 		}
 	}
 
 	// Stop the container before export
 	if err := b.stopContainer(containerID); err != nil {
-		return nil, fmt.Errorf("failed to stop container: %w", err)
+		return nil, &BuildError{Step: "stop container", ContainerID: containerID, Cause: err}
+	}
+
+	// Archive the root filesystem instead of registering a template; the
+	// container is removed afterwards like any other build container
+	if b.config.OutputType == "tar" {
+		if err := b.exportRootfs(containerID, b.config.OutputDest); err != nil {
+			return nil, &BuildError{Step: "export root filesystem", ContainerID: containerID, Cause: err}
+		}
+		result.ArchivePath = b.config.OutputDest
+		built = true
+		result.BuildDuration = time.Since(startTime)
+		return result, nil
 	}
 
 	// Export the configured container as a template
 	templatePath, err := b.exportTemplate(containerID, templateName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to export template: %w", err)
+		return nil, &BuildError{Step: "export template", ContainerID: containerID, Cause: err}
 	}
 	result.TemplatePath = templatePath
 
@@ -156,15 +398,45 @@ func (b *Builder) BuildTemplate(lxcfile *models.LXCfile, templateName string, bu
 	return result, nil
 }
 
+// withContext returns a copy of the builder whose commands stop when ctx is
+// done. Builds share a builder, so each one gets its own copy.
+func (b *Builder) withContext(ctx context.Context) *Builder {
+	scoped := *b
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// detached returns a copy of the builder whose commands keep running after
+// the build is cancelled, for removing what the build left behind
+func (b *Builder) detached() *Builder {
+	return b.withContext(context.WithoutCancel(b.ctx))
+}
+
+// lastContainerID is the most recent build container ID handed out, so
+// builds started in the same second get different IDs
+var (
+	lastContainerID   int
+	lastContainerIDMu sync.Mutex
+)
+
 // generateContainerID generates a unique container ID for the build process
 func (b *Builder) generateContainerID() (int, error) {
 	// Use timestamp-based ID to avoid conflicts
 	// In production, we might want to check with pct list first
-	return int(time.Now().Unix()%100000 + 10000), nil
+	lastContainerIDMu.Lock()
+	defer lastContainerIDMu.Unlock()
+
+	id := int(time.Now().Unix()%100000 + 10000)
+	if id <= lastContainerID {
+		id = lastContainerID + 1
+	}
+	lastContainerID = id
+	return id, nil
 }
 
-// createTempContainer creates a temporary LXC container from a base template
-func (b *Builder) createTempContainer(containerID int, baseTemplate string) error {
+// createTempContainer creates a temporary LXC container from a base
+// template, with osType as its ostype unless empty
+func (b *Builder) createTempContainer(containerID int, baseTemplate, osType string) error {
 	b.log("Creating temporary container %d from template: %s", containerID, baseTemplate)
 
 	if b.config.DryRun {
@@ -185,6 +457,9 @@ func (b *Builder) createTempContainer(containerID int, baseTemplate string) erro
 	if b.config.Storage != "" {
 		args = append(args, "--storage", b.config.Storage)
 	}
+	if osType != "" {
+		args = append(args, "--ostype", osType)
+	}
 
 	return b.runPCTCommand(args...)
 }
@@ -211,31 +486,88 @@ func (b *Builder) stopContainer(containerID int) error {
 	return b.runPCTCommand("stop", strconv.Itoa(containerID))
 }
 
-// waitForContainer waits for the container to be ready for commands
-func (b *Builder) waitForContainer(containerID int) error {
-	if b.config.DryRun {
-		return nil
+// runSteps executes setup or cleanup steps in order, starting at index
+// first, and records each outcome. A failing step aborts the build unless it
+// sets ignore_errors; failing cleanup steps only warn unless
+// AbortOnCleanupError is set. afterStep, if set, runs after every step that
+// did not abort the build.
+func (b *Builder) runSteps(containerID int, phase string, steps []models.SetupStep, first int, buildArgs map[string]string, result *BuildResult, afterStep func(index int) error) error {
+	// A workdir applies to its own step and every step after it, including
+	// when resuming past the step that set it
+	workDir := ""
+	for _, step := range steps[:first] {
+		if step.WorkDir != "" {
+			workDir = expandBuildArgs(step.WorkDir, buildArgs)
+		}
 	}
 
-	b.log("Waiting for container %d to be ready...", containerID)
+	for i := first; i < len(steps); i++ {
+		step := expandStep(steps[i], buildArgs)
+		if step.WorkDir != "" {
+			workDir = step.WorkDir
+		} else {
+			step.WorkDir = workDir
+		}
+		stepName := setupStepName(step, phase, i)
+		outcome := StepResult{Name: stepName, Phase: phase, Status: "ok"}
+		b.startStep(len(result.Steps)+1, i+1, len(steps), phase, stepName)
+
+		condition, err := models.ParseCondition(step.When)
+		if err != nil {
+			b.finishStep(StepResult{Status: "failed", Error: err})
+			return &BuildError{Step: stepName, ContainerID: containerID, Cause: err}
+		}
+		if !condition.Evaluate(buildArgs) {
+			b.log("%s: Skipped (when: %s)", stepName, step.When)
+			outcome.Status = "skipped"
+		} else if err := b.execStep(b.ctx, containerID, step, stepName, buildArgs); err != nil {
+			outcome.Error = err
+			switch {
+			case step.IgnoreErrors:
+				outcome.Status = "ignored"
+				b.logWarning("%s failed (ignored): %v", stepName, err)
+			case phase == "cleanup" && !b.config.AbortOnCleanupError:
+				outcome.Status = "failed"
+				b.logWarning("Cleanup step failed (continuing): %v", err)
+			default:
+				outcome.Status = "failed"
+				b.finishStep(outcome)
+				result.Steps = append(result.Steps, outcome)
+				return &BuildError{Step: stepName, ContainerID: containerID, Cause: err}
+			}
+		} else {
+			result.ExecutedSteps = append(result.ExecutedSteps, stepName)
+		}
+		b.finishStep(outcome)
+		result.Steps = append(result.Steps, outcome)
 
-	// Wait up to 60 seconds for container to be ready
-	for i := 0; i < 60; i++ {
-		// Try to execute a simple command
-		cmd := exec.Command("pct", "exec", strconv.Itoa(containerID), "--", "echo", "ready")
-		if err := cmd.Run(); err == nil {
-			return nil
+		if afterStep != nil {
+			if err := afterStep(i); err != nil {
+				return &BuildError{Step: stepName, ContainerID: containerID, Cause: fmt.Errorf("failed to snapshot step: %w", err)}
+			}
 		}
-		time.Sleep(1 * time.Second)
 	}
 
-	return fmt.Errorf("container %d did not become ready within 60 seconds", containerID)
+	return nil
+}
+
+// setupStepName returns the display name of a step
+func setupStepName(step models.SetupStep, phase string, index int) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	if phase == "cleanup" {
+		return fmt.Sprintf("Cleanup %d", index+1)
+	}
+	return fmt.Sprintf("Step %d", index+1)
 }
 
-// executeSetupStep executes a single setup step
-func (b *Builder) executeSetupStep(containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+// executeSetupStep executes a single setup step. Build args have already
+// been expanded in the step by runSteps.
+func (b *Builder) executeSetupStep(ctx context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+	b = b.withContext(ctx)
 	if step.Run != "" {
-		return b.executeRunStep(containerID, step.Run, stepName, buildArgs)
+		return b.executeRunStep(containerID, step.Run, step.WorkDir, step.User, stepName)
 	}
 
 	if step.Copy != nil {
@@ -246,29 +578,43 @@ func (b *Builder) executeSetupStep(containerID int, step models.SetupStep, stepN
 		return b.executeEnvStep(containerID, step.Env, stepName)
 	}
 
+	if step.WorkDir != "" {
+		b.log("%s: Setting working directory %s", stepName, step.WorkDir)
+		if b.config.DryRun {
+			return nil
+		}
+		return b.runPCTCommand(proxmox.ExecArgs(containerID, proxmox.ExecOptions{}, []string{"mkdir", "-p", step.WorkDir})...)
+	}
+
 	return fmt.Errorf("setup step has no actions")
 }
 
-// executeRunStep executes a run command in the container
-func (b *Builder) executeRunStep(containerID int, command, stepName string, buildArgs map[string]string) error {
+// executeRunStep executes a run command in the container, from workDir and as
+// user if set
+func (b *Builder) executeRunStep(containerID int, command, workDir, user, stepName string) error {
 	b.log("%s: Running command", stepName)
-	if b.config.Verbose {
-		b.log("Command: %s", command)
-	}
+	b.logDebug("Command: %s", command)
 
 	if b.config.DryRun {
 		return nil
 	}
 
-	// Substitute build args in the command
-	expandedCommand := b.expandBuildArgs(command, buildArgs)
+	if workDir != "" {
+		if err := b.runPCTCommand(proxmox.ExecArgs(containerID, proxmox.ExecOptions{}, []string{"mkdir", "-p", workDir})...); err != nil {
+			return fmt.Errorf("failed to create working directory %s: %w", workDir, err)
+		}
+	}
 
 	// Execute the command in the container
-	cmd := exec.Command("pct", "exec", strconv.Itoa(containerID), "--", "sh", "-c", expandedCommand)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := proxmox.CommandContext(b.ctx, "pct", runStepArgs(containerID, command, workDir, user)...)
+	cmd.Stdout, cmd.Stderr = b.commandOutput()
 
-	return cmd.Run()
+	return proxmox.RunCommand(cmd)
+}
+
+// runStepArgs returns the pct arguments for a run step
+func runStepArgs(containerID int, command, workDir, user string) []string {
+	return proxmox.ExecArgs(containerID, proxmox.ExecOptions{User: user, WorkDir: workDir}, []string{"sh", "-c", command})
 }
 
 // executeCopyStep copies files from host to container
@@ -280,36 +626,24 @@ func (b *Builder) executeCopyStep(containerID int, copyStep models.CopyStep, ste
 	}
 
 	// Verify source exists
-	if _, err := os.Stat(copyStep.Source); os.IsNotExist(err) {
+	info, err := os.Stat(copyStep.Source)
+	if os.IsNotExist(err) {
 		return fmt.Errorf("source file/directory does not exist: %s", copyStep.Source)
+	} else if err != nil {
+		return fmt.Errorf("failed to read copy source: %w", err)
 	}
 
-	// Create destination directory in container if needed
-	destDir := filepath.Dir(copyStep.Dest)
-	if destDir != "/" && destDir != "." {
-		cmd := exec.Command("pct", "exec", strconv.Itoa(containerID), "--", "mkdir", "-p", destDir)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to create destination directory: %w", err)
-		}
-	}
-
-	// Copy the file/directory
-	cmd := exec.Command("pct", "push", strconv.Itoa(containerID), copyStep.Source, copyStep.Dest)
-	if err := cmd.Run(); err != nil {
+	// Directories go through a tar archive that keeps their modes, owners
+	// and symlinks; the owner, if set, replaces the archived owners
+	archive := filepath.Join(os.TempDir(), fmt.Sprintf("pxc-build-copy-%d.tar", containerID))
+	steps, cleanup := proxmox.CopyPlan(containerID, copyStep.Source, info.IsDir(), copyStep.Dest, archive, proxmox.CopyOptions{Chown: copyStep.Owner})
+	defer os.Remove(archive)
+	if err := proxmox.RunCopyPlan(b.runInContext, steps, cleanup); err != nil {
 		return fmt.Errorf("failed to copy files: %w", err)
 	}
 
-	// Set ownership and permissions if specified
-	if copyStep.Owner != "" {
-		cmd = exec.Command("pct", "exec", strconv.Itoa(containerID), "--", "chown", "-R", copyStep.Owner, copyStep.Dest)
-		if err := cmd.Run(); err != nil {
-			b.logWarning("Failed to set ownership: %v", err)
-		}
-	}
-
 	if copyStep.Mode != "" {
-		cmd = exec.Command("pct", "exec", strconv.Itoa(containerID), "--", "chmod", "-R", copyStep.Mode, copyStep.Dest)
-		if err := cmd.Run(); err != nil {
+		if err := b.run(b.ctx, "pct", "exec", strconv.Itoa(containerID), "--", "chmod", "-R", copyStep.Mode, copyStep.Dest); err != nil {
 			b.logWarning("Failed to set permissions: %v", err)
 		}
 	}
@@ -328,9 +662,9 @@ func (b *Builder) executeEnvStep(containerID int, env map[string]string, stepNam
 	// Write environment variables to /etc/environment
 	for key, value := range env {
 		envLine := fmt.Sprintf("%s=%s", key, value)
-		cmd := exec.Command("pct", "exec", strconv.Itoa(containerID), "--", "sh", "-c",
+		cmd := proxmox.CommandContext(b.ctx, "pct", "exec", strconv.Itoa(containerID), "--", "sh", "-c",
 			fmt.Sprintf("echo '%s' >> /etc/environment", envLine))
-		if err := cmd.Run(); err != nil {
+		if err := proxmox.RunCommand(cmd); err != nil {
 			return fmt.Errorf("failed to set environment variable %s: %w", key, err)
 		}
 	}
@@ -379,6 +713,12 @@ func (b *Builder) applyContainerConfig(containerID int, lxcfile *models.LXCfile)
 		}
 	}
 
+	// Record labels in the description, which Proxmox shows as the
+	// template's notes
+	if len(lxcfile.Labels) > 0 {
+		args = append(args, "-description", formatLabels(lxcfile.Labels))
+	}
+
 	// Apply configuration if we have any settings to apply
 	if len(args) > 0 {
 		pctArgs := append([]string{"set", strconv.Itoa(containerID)}, args...)
@@ -388,26 +728,79 @@ func (b *Builder) applyContainerConfig(containerID int, lxcfile *models.LXCfile)
 	return nil
 }
 
+// formatLabels renders labels as sorted KEY=VALUE lines
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = key + "=" + labels[key]
+	}
+	return strings.Join(lines, "\n")
+}
+
 // exportTemplate converts the configured container to a template
 func (b *Builder) exportTemplate(containerID int, templateName string) (string, error) {
 	b.log("Converting container to template: %s", templateName)
 
 	if b.config.DryRun {
+		if b.config.Compress != "" {
+			b.log("DRY RUN: Would export template archive with %s compression", b.config.Compress)
+		}
 		// Return template name for dry run (format expected by pct create)
 		return templateName, nil
 	}
 
+	// The archive goes to the template storage, so check it before the
+	// container is converted
+	if b.config.Compress != "" {
+		if err := b.CheckTemplateStorage(); err != nil {
+			return "", err
+		}
+	}
+
 	// Convert container to template using pct template command
 	args := []string{"template", strconv.Itoa(containerID)}
 	if err := b.runPCTCommand(args...); err != nil {
 		return "", err
 	}
 
+	// Export a compressed archive of the template when requested
+	if b.config.Compress != "" {
+		if err := b.exportArchive(containerID); err != nil {
+			return "", err
+		}
+	}
+
 	// Return the container ID as the template reference
 	// Proxmox templates are referenced by container ID, not file path
 	return strconv.Itoa(containerID), nil
 }
 
+// exportArchive writes a vzdump archive of the template to the template
+// storage using the configured compression
+func (b *Builder) exportArchive(containerID int) error {
+	if err := ValidateCompression(b.config.Compress); err != nil {
+		return err
+	}
+
+	compress := b.config.Compress
+	if compress == "none" {
+		compress = "0"
+	}
+
+	b.log("Exporting template archive to %s (compression: %s)", b.config.TemplateStorage, b.config.Compress)
+
+	return b.run(b.ctx, "vzdump", strconv.Itoa(containerID),
+		"--mode", "stop",
+		"--compress", compress,
+		"--storage", b.config.TemplateStorage)
+}
+
 // cleanupTempContainer removes the temporary container
 func (b *Builder) cleanupTempContainer(containerID int) error {
 	if b.config.DryRun {
@@ -425,36 +818,122 @@ func (b *Builder) cleanupTempContainer(containerID int) error {
 
 // runPCTCommand executes a pct command
 func (b *Builder) runPCTCommand(args ...string) error {
-	cmd := exec.Command("pct", args...)
+	return b.run(b.ctx, "pct", args...)
+}
+
+// runInContext executes an external command in the build's context
+func (b *Builder) runInContext(name string, args ...string) error {
+	return b.run(b.ctx, name, args...)
+}
+
+// runCommand executes an external command
+func (b *Builder) runCommand(ctx context.Context, name string, args ...string) error {
+	cmd := proxmox.CommandContext(ctx, name, args...)
 
-	if b.config.Verbose {
-		b.log("Executing: pct %s", strings.Join(args, " "))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	if b.logger.Enabled(output.Debug) {
+		b.logDebug("Executing: %s %s", name, strings.Join(args, " "))
+		cmd.Stdout, cmd.Stderr = b.commandOutput()
 	}
 
-	return cmd.Run()
+	return proxmox.RunCommand(cmd)
 }
 
-// expandBuildArgs expands build arguments in a command string
-func (b *Builder) expandBuildArgs(command string, buildArgs map[string]string) string {
-	result := command
-	for key, value := range buildArgs {
-		result = strings.ReplaceAll(result, "${"+key+"}", value)
-		result = strings.ReplaceAll(result, "$"+key, value)
+// buildArgPattern matches $NAME and ${NAME} references
+var buildArgPattern = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+
+// expandBuildArgs replaces $NAME and ${NAME} references to build args in
+// text. Names match whole words only, so $APP does not touch $APP_HOME, and
+// references to unknown names are left for the shell.
+func expandBuildArgs(text string, buildArgs map[string]string) string {
+	if len(buildArgs) == 0 {
+		return text
+	}
+	return buildArgPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		match := buildArgPattern.FindStringSubmatch(ref)
+		name := match[1]
+		if name == "" {
+			name = match[2]
+		}
+		if value, ok := buildArgs[name]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// expandStep returns a copy of step with build args expanded in its run
+// command, copy source and destination, env values and workdir
+func expandStep(step models.SetupStep, buildArgs map[string]string) models.SetupStep {
+	step.Run = expandBuildArgs(step.Run, buildArgs)
+	step.WorkDir = expandBuildArgs(step.WorkDir, buildArgs)
+	step.User = expandBuildArgs(step.User, buildArgs)
+	if step.Copy != nil {
+		copyStep := *step.Copy
+		copyStep.Source = expandBuildArgs(copyStep.Source, buildArgs)
+		copyStep.Dest = expandBuildArgs(copyStep.Dest, buildArgs)
+		step.Copy = &copyStep
+	}
+	if step.Env != nil {
+		env := make(map[string]string, len(step.Env))
+		for key, value := range step.Env {
+			env[key] = expandBuildArgs(value, buildArgs)
+		}
+		step.Env = env
+	}
+	return step
+}
+
+// startStep and finishStep report a step to the progress display, if any
+func (b *Builder) startStep(number, index, total int, phase, name string) {
+	if b.progress != nil {
+		b.progress.start(number, index, total, phase, name)
 	}
-	return result
+}
+
+func (b *Builder) finishStep(outcome StepResult) {
+	if b.progress != nil {
+		b.progress.finish(outcome.Status, outcome.Error)
+	}
+}
+
+// logOutput is where log lines go: the progress display, or the output
+func (b *Builder) logOutput() io.Writer {
+	if b.progress != nil {
+		return b.progress.output()
+	}
+	return b.out
+}
+
+// commandOutput returns the stdout and stderr for commands whose output is
+// shown. With a progress display both belong to the running step. Quiet
+// builds only show what commands print to stderr, and JSON logs keep
+// stdout to themselves.
+func (b *Builder) commandOutput() (io.Writer, io.Writer) {
+	if b.progress != nil {
+		return b.progress.output(), b.progress.output()
+	}
+	if !b.logger.Enabled(output.Info) {
+		return io.Discard, os.Stderr
+	}
+	if b.logger.JSON() {
+		return os.Stderr, os.Stderr
+	}
+	return b.out, os.Stderr
 }
 
 // Logging functions
 func (b *Builder) log(format string, args ...interface{}) {
-	fmt.Printf(color.BlueString("ℹ ")+format+"\n", args...)
+	b.logger.Fprintf(b.logOutput(), output.Info, format, args...)
+}
+
+func (b *Builder) logDebug(format string, args ...interface{}) {
+	b.logger.Fprintf(b.logOutput(), output.Debug, format, args...)
 }
 
 func (b *Builder) logWarning(format string, args ...interface{}) {
-	fmt.Printf(color.YellowString("⚠ ")+format+"\n", args...)
+	b.logger.Fprintf(b.logOutput(), output.Warning, format, args...)
 }
 
 func (b *Builder) logError(format string, args ...interface{}) {
-	fmt.Printf(color.RedString("✗ ")+format+"\n", args...)
+	b.logger.Fprintf(b.logOutput(), output.Error, format, args...)
 }
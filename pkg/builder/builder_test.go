@@ -0,0 +1,844 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// newTestBuilder returns a dry-run builder whose steps fail when their name
+// is listed in failing
+func newTestBuilder(abortOnCleanupError bool, failing ...string) *Builder {
+	b := New(&Config{DryRun: true, AbortOnCleanupError: abortOnCleanupError})
+	b.execStep = func(_ context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+		for _, name := range failing {
+			if name == stepName {
+				return errors.New("exit status 1")
+			}
+		}
+		return nil
+	}
+	return b
+}
+
+func findStep(result *BuildResult, name string) *StepResult {
+	for i := range result.Steps {
+		if result.Steps[i].Name == name {
+			return &result.Steps[i]
+		}
+	}
+	return nil
+}
+
+func TestBuildTemplateCleanupFailure(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From: "ubuntu:22.04",
+		Setup: []models.SetupStep{
+			{Name: "install", Run: "apt-get install -y nginx"},
+		},
+		Cleanup: []models.SetupStep{
+			{Name: "purge-cache", Run: "apt-get clean"},
+			{Run: "rm -rf /tmp/*"},
+		},
+	}
+
+	t.Run("cleanup failure is reported and build continues", func(t *testing.T) {
+		result, err := newTestBuilder(false, "purge-cache").BuildTemplate(context.Background(), lxcfile, "web", nil)
+		if err != nil {
+			t.Fatalf("BuildTemplate() unexpected error: %v", err)
+		}
+
+		step := findStep(result, "purge-cache")
+		if step == nil {
+			t.Fatalf("result.Steps = %+v, missing purge-cache", result.Steps)
+		}
+		if step.Phase != "cleanup" || step.Status != "failed" || step.Error == nil {
+			t.Errorf("purge-cache = %+v, want failed cleanup step with error", step)
+		}
+		if next := findStep(result, "Cleanup 2"); next == nil || next.Status != "ok" {
+			t.Errorf("Cleanup 2 = %+v, want ok", next)
+		}
+		if strings.Join(result.ExecutedSteps, ",") != "install,Cleanup 2" {
+			t.Errorf("ExecutedSteps = %v, want [install Cleanup 2]", result.ExecutedSteps)
+		}
+	})
+
+	t.Run("abort on cleanup error fails the build", func(t *testing.T) {
+		_, err := newTestBuilder(true, "purge-cache").BuildTemplate(context.Background(), lxcfile, "web", nil)
+		if err == nil {
+			t.Fatal("BuildTemplate() expected error, got nil")
+		}
+		if !strings.Contains(err.Error(), "build step 'purge-cache' failed") {
+			t.Errorf("error = %v, want it to name purge-cache", err)
+		}
+	})
+}
+
+func TestRunSteps(t *testing.T) {
+	tests := []struct {
+		name      string
+		steps     []models.SetupStep
+		buildArgs map[string]string
+		failing   []string
+		statuses  map[string]string
+		wantErr   bool
+	}{
+		{
+			name: "ignore_errors keeps going",
+			steps: []models.SetupStep{
+				{Name: "optional", Run: "false", IgnoreErrors: true},
+				{Name: "next", Run: "true"},
+			},
+			failing:  []string{"optional"},
+			statuses: map[string]string{"optional": "ignored", "next": "ok"},
+		},
+		{
+			name: "failing setup step aborts",
+			steps: []models.SetupStep{
+				{Name: "broken", Run: "false"},
+				{Name: "never", Run: "true"},
+			},
+			failing:  []string{"broken"},
+			statuses: map[string]string{"broken": "failed"},
+			wantErr:  true,
+		},
+		{
+			name: "when skips steps",
+			steps: []models.SetupStep{
+				{Name: "debug-tools", Run: "apt-get install -y strace", When: "DEBUG"},
+				{Name: "prod-only", Run: "true", When: "ENV == production"},
+			},
+			buildArgs: map[string]string{"DEBUG": "false", "ENV": "production"},
+			statuses:  map[string]string{"debug-tools": "skipped", "prod-only": "ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &BuildResult{}
+			err := newTestBuilder(false, tt.failing...).runSteps(100, "setup", tt.steps, 0, tt.buildArgs, result, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runSteps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(result.Steps) != len(tt.statuses) {
+				t.Fatalf("recorded %d steps, want %d: %+v", len(result.Steps), len(tt.statuses), result.Steps)
+			}
+			for name, status := range tt.statuses {
+				if step := findStep(result, name); step == nil || step.Status != status {
+					t.Errorf("step %s = %+v, want status %s", name, step, status)
+				}
+			}
+		})
+	}
+}
+
+// storageStatus is pvesm status --content vztmpl output
+const storageStatus = `Name                 Type     Status           Total            Used       Available        %
+local                 dir     active        98497780        12485516        80962716   12.68%
+nfs-templates         nfs     active       976762584       310235136       666527448   31.76%
+`
+
+func TestExportTemplateCompression(t *testing.T) {
+	var commands []string
+	b := New(&Config{Compress: "zstd", TemplateStorage: "nfs-templates"})
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	b.output = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		return []byte(storageStatus), nil
+	}
+
+	if _, err := b.exportTemplate(12345, "web"); err != nil {
+		t.Fatalf("exportTemplate() unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"pct template 12345",
+		"vzdump 12345 --mode stop --compress zstd --storage nfs-templates",
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("commands = %q, want %q", commands, expected)
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		wantErr   bool
+	}{
+		{algorithm: ""},
+		{algorithm: "none"},
+		{algorithm: "gzip"},
+		{algorithm: "zstd"},
+		{algorithm: "lzo"},
+		{algorithm: "bzip2", wantErr: true},
+		{algorithm: "ZSTD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			err := ValidateCompression(tt.algorithm)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCompression(%q) error = %v, wantErr %v", tt.algorithm, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unknown algorithm fails the export", func(t *testing.T) {
+		b := New(&Config{Compress: "bzip2"})
+		b.run = func(_ context.Context, name string, args ...string) error { return nil }
+		b.output = func(_ context.Context, name string, args ...string) ([]byte, error) {
+			return []byte(storageStatus), nil
+		}
+
+		if _, err := b.exportTemplate(12345, "web"); err == nil {
+			t.Error("exportTemplate() expected error for unknown compression")
+		}
+	})
+}
+
+func TestBuildErrorKeepOnFailure(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From: "ubuntu:22.04",
+		Setup: []models.SetupStep{
+			{Name: "install", Run: "apt-get install -y nginx"},
+			{Name: "migrate", Run: "/opt/app/migrate"},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		keepOnFailure bool
+		wantDestroy   bool
+	}{
+		{name: "failed build is cleaned up", keepOnFailure: false, wantDestroy: true},
+		{name: "keep-on-failure leaves the container", keepOnFailure: true, wantDestroy: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var commands []string
+			b := newTestBuilder(false, "migrate")
+			b.config.DryRun = false
+			b.config.KeepOnFailure = tt.keepOnFailure
+			b.run = func(_ context.Context, name string, args ...string) error {
+				commands = append(commands, name+" "+strings.Join(args, " "))
+				return nil
+			}
+			b.output = func(_ context.Context, name string, args ...string) ([]byte, error) { return nil, nil }
+
+			_, err := b.BuildTemplate(context.Background(), lxcfile, "web", nil)
+
+			var buildErr *BuildError
+			if !errors.As(err, &buildErr) {
+				t.Fatalf("BuildTemplate() error = %v, want *BuildError", err)
+			}
+			if buildErr.Step != "migrate" {
+				t.Errorf("Step = %q, want migrate", buildErr.Step)
+			}
+			if buildErr.Cause == nil || buildErr.Cause.Error() != "exit status 1" {
+				t.Errorf("Cause = %v, want exit status 1", buildErr.Cause)
+			}
+			if len(commands) == 0 || !strings.HasPrefix(commands[0], fmt.Sprintf("pct create %d ", buildErr.ContainerID)) {
+				t.Errorf("ContainerID = %d, want the created container (commands: %v)", buildErr.ContainerID, commands)
+			}
+
+			destroy := fmt.Sprintf("pct destroy %d", buildErr.ContainerID)
+			destroyed := false
+			for _, command := range commands {
+				if command == destroy {
+					destroyed = true
+				}
+			}
+			if destroyed != tt.wantDestroy {
+				t.Errorf("destroyed = %v, want %v (commands: %v)", destroyed, tt.wantDestroy, commands)
+			}
+		})
+	}
+}
+
+func TestExpandBuildArgs(t *testing.T) {
+	args := map[string]string{"APP": "shop", "VERSION": "1.4"}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain reference", "/opt/$APP", "/opt/shop"},
+		{"braced reference", "/opt/${APP}-${VERSION}", "/opt/shop-1.4"},
+		{"longer name is not a match", "$APP_HOME/$APP", "$APP_HOME/shop"},
+		{"braced suffix", "${APP}_data", "shop_data"},
+		{"unknown name is kept", "echo $HOME ${PATH}", "echo $HOME ${PATH}"},
+		{"no references", "apt-get update", "apt-get update"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandBuildArgs(tt.input, args); got != tt.expected {
+				t.Errorf("expandBuildArgs(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildArgExpansionInSteps(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From: "ubuntu:22.04",
+		Setup: []models.SetupStep{
+			{Name: "ship", Copy: &models.CopyStep{Source: "./dist/${APP}", Dest: "/opt/${APP}"}},
+			{Name: "configure", Env: map[string]string{"APP_HOME": "/opt/$APP", "APP_VERSION": "${VERSION}"}},
+			{Name: "install", Run: "make install", WorkDir: "/opt/$APP"},
+			{Name: "migrate", Run: "./bin/migrate"},
+		},
+	}
+
+	executed := make(map[string]models.SetupStep)
+	b := New(&Config{DryRun: true})
+	b.execStep = func(_ context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+		executed[stepName] = step
+		return nil
+	}
+
+	if _, err := b.BuildTemplate(context.Background(), lxcfile, "shop", map[string]string{"APP": "shop", "VERSION": "2.0"}); err != nil {
+		t.Fatalf("BuildTemplate() unexpected error: %v", err)
+	}
+
+	if copyStep := executed["ship"].Copy; copyStep == nil || copyStep.Source != "./dist/shop" || copyStep.Dest != "/opt/shop" {
+		t.Errorf("copy step = %+v, want ./dist/shop -> /opt/shop", copyStep)
+	}
+	env := executed["configure"].Env
+	if env["APP_HOME"] != "/opt/shop" || env["APP_VERSION"] != "2.0" {
+		t.Errorf("env step = %v, want expanded values", env)
+	}
+	if workDir := executed["install"].WorkDir; workDir != "/opt/shop" {
+		t.Errorf("workdir = %q, want /opt/shop", workDir)
+	}
+	if workDir := executed["migrate"].WorkDir; workDir != "/opt/shop" {
+		t.Errorf("later step workdir = %q, want it to inherit /opt/shop", workDir)
+	}
+
+	// The LXCfile itself is left untouched
+	if lxcfile.Setup[0].Copy.Dest != "/opt/${APP}" {
+		t.Errorf("LXCfile copy dest was modified: %q", lxcfile.Setup[0].Copy.Dest)
+	}
+}
+
+func TestResolveBaseTemplate(t *testing.T) {
+	list := `Volid                                                  Format  Type     Size
+local:vztmpl/debian-11-standard_11.7-1_amd64.tar.zst   tzst    vztmpl   120000000
+local:vztmpl/debian-12-standard_12.0-1_amd64.tar.zst   tzst    vztmpl   126000000
+local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst   tzst    vztmpl   126331031
+local:vztmpl/alpine-3.18-default_20230607_amd64.tar.xz txz     vztmpl   2982664
+`
+
+	tests := []struct {
+		name     string
+		ref      string
+		expected string
+		wantErr  bool
+	}{
+		{name: "container template ID", ref: "9000", expected: "9000"},
+		{name: "volume ID", ref: "local:vztmpl/alpine-3.18-default_20230607_amd64.tar.xz", expected: "local:vztmpl/alpine-3.18-default_20230607_amd64.tar.xz"},
+		{name: "short name picks latest", ref: "debian:12", expected: "local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst"},
+		{name: "short name without version separator", ref: "debian:1", wantErr: true},
+		{name: "missing volume ID", ref: "local:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.zst", wantErr: true},
+		{name: "missing short name", ref: "ubuntu:22.04", wantErr: true},
+		{name: "template storage without vztmpl", ref: "local-lvm:vztmpl/debian-12.tar.zst", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBuilder(false)
+			b.config.DryRun = false
+			b.config.TemplateStorage = "local"
+			if strings.HasPrefix(tt.ref, "local-lvm:") {
+				b.config.TemplateStorage = "local-lvm"
+			}
+			b.output = func(_ context.Context, name string, args ...string) ([]byte, error) {
+				if len(args) > 0 && args[0] == "status" {
+					return []byte(storageStatus), nil
+				}
+				return []byte(list), nil
+			}
+
+			got, err := b.ResolveBaseTemplate(tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ResolveBaseTemplate(%q) = %q, want error", tt.ref, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveBaseTemplate(%q) unexpected error: %v", tt.ref, err)
+			}
+			if got != tt.expected {
+				t.Errorf("ResolveBaseTemplate(%q) = %q, want %q", tt.ref, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyContainerConfigLabels(t *testing.T) {
+	var commands [][]string
+	b := newTestBuilder(false)
+	b.config.DryRun = false
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, append([]string{name}, args...))
+		return nil
+	}
+
+	lxcfile := &models.LXCfile{
+		From:   "debian:12",
+		Labels: map[string]string{"tier": "backend", "compliance/owner": "platform-team"},
+	}
+	if err := b.applyContainerConfig(9100, lxcfile); err != nil {
+		t.Fatalf("applyContainerConfig() unexpected error: %v", err)
+	}
+
+	if len(commands) != 1 {
+		t.Fatalf("commands = %v, want one pct set", commands)
+	}
+	expected := []string{"pct", "set", "9100", "-description", "compliance/owner=platform-team\ntier=backend"}
+	if strings.Join(commands[0], "|") != strings.Join(expected, "|") {
+		t.Errorf("command = %q, want %q", commands[0], expected)
+	}
+}
+
+func TestRunStepArgs(t *testing.T) {
+	// Same argv as pxc exec and pxc enter produce for this user and workdir
+	expected := []string{"exec", "342", "--", "su", "-s", "/bin/sh", "node", "-c", "cd /srv/app && exec sh -c 'npm ci'"}
+
+	got := runStepArgs(342, "npm ci", "/srv/app", "node")
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("runStepArgs() = %q, want %q", got, expected)
+	}
+}
+
+func TestBuildTemplateSquash(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From:    "debian:12",
+		Setup:   []models.SetupStep{{Name: "install", Run: "apt-get install -y nginx"}},
+		Cleanup: []models.SetupStep{{Name: "purge", Run: "apt-get autoremove -y"}},
+	}
+
+	tests := []struct {
+		name     string
+		reclaim  []string
+		fstrim   error
+		expected []string
+	}{
+		{
+			name:     "default reclaim commands",
+			expected: DefaultReclaimCommands,
+		},
+		{
+			name:     "custom reclaim commands",
+			reclaim:  []string{"npm cache clean --force"},
+			expected: []string{"npm cache clean --force"},
+		},
+		{
+			name:     "trim failure only warns",
+			reclaim:  []string{"rm -rf /tmp/*"},
+			fstrim:   errors.New("discard not supported"),
+			expected: []string{"rm -rf /tmp/*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var commands [][]string
+			b := newTestBuilder(false)
+			b.config.DryRun = false
+			b.config.Squash = true
+			b.config.ReclaimCommands = tt.reclaim
+			b.run = func(_ context.Context, name string, args ...string) error {
+				commands = append(commands, append([]string{name}, args...))
+				if len(args) > 0 && args[0] == "fstrim" {
+					return tt.fstrim
+				}
+				return nil
+			}
+
+			result := &BuildResult{}
+			if err := b.squash(9200, result); err != nil {
+				t.Fatalf("squash() unexpected error: %v", err)
+			}
+
+			var reclaimed []string
+			trimmed := false
+			for _, command := range commands {
+				switch {
+				case len(command) == 7 && command[1] == "exec" && command[4] == "sh":
+					reclaimed = append(reclaimed, command[len(command)-1])
+				case strings.Join(command, " ") == "pct fstrim 9200":
+					trimmed = true
+				default:
+					t.Errorf("unexpected command %q", command)
+				}
+			}
+			if strings.Join(reclaimed, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("reclaim commands = %q, want %q", reclaimed, tt.expected)
+			}
+			if !trimmed {
+				t.Error("squash() did not run pct fstrim")
+			}
+			if step := findStep(result, "squash"); step == nil || step.Status != "ok" {
+				t.Errorf("squash step = %+v, want ok", step)
+			}
+		})
+	}
+
+	t.Run("build invokes squash after cleanup", func(t *testing.T) {
+		b := newTestBuilder(false)
+		b.config.Squash = true
+		result, err := b.BuildTemplate(context.Background(), lxcfile, "web", nil)
+		if err != nil {
+			t.Fatalf("BuildTemplate() unexpected error: %v", err)
+		}
+		expected := []string{"install", "purge", "squash"}
+		if strings.Join(result.ExecutedSteps, ",") != strings.Join(expected, ",") {
+			t.Errorf("ExecutedSteps = %v, want %v", result.ExecutedSteps, expected)
+		}
+	})
+
+	t.Run("failing reclaim command fails the build", func(t *testing.T) {
+		b := newTestBuilder(false)
+		b.config.DryRun = false
+		b.config.ReclaimCommands = []string{"false"}
+		b.run = func(_ context.Context, name string, args ...string) error {
+			return errors.New("exit status 1")
+		}
+		err := b.squash(9200, &BuildResult{})
+		var buildErr *BuildError
+		if !errors.As(err, &buildErr) || buildErr.Step != "squash" {
+			t.Errorf("squash() error = %v, want BuildError for step squash", err)
+		}
+	})
+}
+
+func TestWaitForContainerReadyProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     string
+		running   bool // pct status reports running
+		execWorks bool // pct exec true succeeds
+		errorMsg  string
+	}{
+		{name: "exec ready", probe: "exec", running: true, execWorks: true},
+		{name: "exec default mode", probe: "", running: true, execWorks: true},
+		{
+			name:     "exec fails in running container",
+			probe:    "exec",
+			running:  true,
+			errorMsg: "container 9300 is running but pct exec failed for 1m0s: exec agent not ready (try --ready-probe status)",
+		},
+		{name: "status accepts running container without exec", probe: "status", running: true},
+		{
+			name:      "status never running",
+			probe:     "status",
+			execWorks: true,
+			errorMsg:  "container 9300 never reached the running state within 1m0s",
+		},
+		{name: "both ready", probe: "both", running: true, execWorks: true},
+		{
+			name:     "both needs exec",
+			probe:    "both",
+			running:  true,
+			errorMsg: "container 9300 is running but pct exec failed for 1m0s: exec agent not ready (try --ready-probe status)",
+		},
+		{
+			name:      "both needs running",
+			probe:     "both",
+			execWorks: true,
+			errorMsg:  "container 9300 never reached the running state within 1m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(&Config{ReadyProbe: tt.probe})
+			b.sleep = func(time.Duration) {}
+			b.output = func(_ context.Context, name string, args ...string) ([]byte, error) {
+				switch args[0] {
+				case "status":
+					if tt.running {
+						return []byte("status: running\n"), nil
+					}
+					return []byte("status: stopped\n"), nil
+				case "exec":
+					if tt.execWorks {
+						return nil, nil
+					}
+					return nil, errors.New("exec agent not ready")
+				}
+				t.Fatalf("unexpected command %s %v", name, args)
+				return nil, nil
+			}
+
+			err := b.waitForContainer(9300)
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("waitForContainer() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.errorMsg {
+				t.Errorf("waitForContainer() error = %v, want %q", err, tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestBuildProgressPlain(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From: "debian:12",
+		Setup: []models.SetupStep{
+			{Name: "install", Run: "apt-get install -y nginx"},
+			{Name: "debug-tools", Run: "apt-get install -y strace", When: "DEBUG"},
+			{Name: "configure", Run: "nginx -t"},
+		},
+		Cleanup: []models.SetupStep{{Run: "apt-get clean"}},
+	}
+
+	originalNoColor := color.NoColor
+	defer func() { color.NoColor = originalNoColor }()
+	color.NoColor = true
+
+	var buf bytes.Buffer
+	b := New(&Config{DryRun: true, Progress: "plain", Output: &buf})
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b.progress = newStepProgress("plain", &buf, func() time.Time {
+		clock = clock.Add(1500 * time.Millisecond)
+		return clock
+	})
+	b.execStep = func(_ context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+		fmt.Fprintf(b.logOutput(), "output of %s\nsecond line\n", stepName)
+		if stepName == "configure" {
+			return errors.New("exit status 1")
+		}
+		return nil
+	}
+
+	if _, err := b.BuildTemplate(context.Background(), lxcfile, "web", nil); err == nil {
+		t.Fatal("BuildTemplate() expected error from configure")
+	}
+
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	expected := []string{
+		"#1 [setup 1/3] install",
+		"#1 output of install",
+		"#1 second line",
+		"#1 DONE 1.5s",
+		"#2 [setup 2/3] debug-tools",
+		"#2 ℹ debug-tools: Skipped (when: DEBUG)",
+		"#2 SKIPPED",
+		"#3 [setup 3/3] configure",
+		"#3 output of configure",
+		"#3 second line",
+		"#3 ERROR 1.5s: exit status 1",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("plain progress =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestResolveProgress(t *testing.T) {
+	tests := []struct {
+		mode     string
+		terminal bool
+		expected string
+	}{
+		{mode: "auto", terminal: false, expected: "plain"},
+		{mode: "auto", terminal: true, expected: "tty"},
+		{mode: "plain", terminal: true, expected: "plain"},
+		{mode: "tty", terminal: false, expected: "tty"},
+	}
+	for _, tt := range tests {
+		if got := ResolveProgress(tt.mode, tt.terminal); got != tt.expected {
+			t.Errorf("ResolveProgress(%q, %v) = %q, want %q", tt.mode, tt.terminal, got, tt.expected)
+		}
+	}
+
+	// A buffer is not a terminal, so auto picks plain
+	b := New(&Config{Progress: "auto", Output: &bytes.Buffer{}})
+	if _, ok := b.progress.(*plainProgress); !ok {
+		t.Errorf("auto progress on a non-terminal = %T, want *plainProgress", b.progress)
+	}
+
+	if err := ValidateProgress("fancy"); err == nil {
+		t.Error("ValidateProgress(fancy) expected error")
+	}
+}
+
+func TestExportRootfs(t *testing.T) {
+	var commands []string
+	failTar := false
+	b := New(&Config{OutputType: "tar", OutputDest: "/srv/export/web.tar.zst"})
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		if name == "tar" && failTar {
+			return errors.New("exit status 2")
+		}
+		return nil
+	}
+
+	if err := b.exportRootfs(12345, "/srv/export/web.tar.zst"); err != nil {
+		t.Fatalf("exportRootfs() unexpected error: %v", err)
+	}
+	expected := []string{
+		"pct mount 12345",
+		"tar --numeric-owner --auto-compress -cf /srv/export/web.tar.zst -C /var/lib/lxc/12345/rootfs .",
+		"pct unmount 12345",
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("commands = %q, want %q", commands, expected)
+	}
+
+	t.Run("container is unmounted when tar fails", func(t *testing.T) {
+		commands, failTar = nil, true
+		err := b.exportRootfs(12345, "/srv/export/web.tar.zst")
+		if err == nil || !strings.Contains(err.Error(), "failed to archive root filesystem") {
+			t.Fatalf("exportRootfs() error = %v, want archive failure", err)
+		}
+		if commands[len(commands)-1] != "pct unmount 12345" {
+			t.Errorf("commands = %q, want a final unmount", commands)
+		}
+	})
+}
+
+func TestBuildTemplateTarOutput(t *testing.T) {
+	b := newTestBuilder(false)
+	b.config.OutputType, b.config.OutputDest = "tar", "/srv/export/web.tar"
+	result, err := b.BuildTemplate(context.Background(), &models.LXCfile{From: "ubuntu:22.04"}, "web", nil)
+	if err != nil {
+		t.Fatalf("BuildTemplate() unexpected error: %v", err)
+	}
+	if result.ArchivePath != "/srv/export/web.tar" || result.TemplatePath != "" {
+		t.Errorf("ArchivePath = %q, TemplatePath = %q, want only the archive", result.ArchivePath, result.TemplatePath)
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		spec     string
+		wantType string
+		wantDest string
+		errorMsg string
+	}{
+		{name: "template", spec: "type=template", wantType: "template"},
+		{name: "tar with dest", spec: "type=tar,dest=" + dir + "/rootfs.tar.gz", wantType: "tar", wantDest: dir + "/rootfs.tar.gz"},
+		{name: "dest before type", spec: "dest=" + dir + "/rootfs.tar,type=tar", wantType: "tar", wantDest: dir + "/rootfs.tar"},
+		{name: "unknown type", spec: "type=oci", errorMsg: "unsupported output type 'oci', must be one of: template, tar"},
+		{name: "tar without dest", spec: "type=tar", errorMsg: "type=tar requires a dest"},
+		{name: "dest for template", spec: "type=template,dest=" + dir + "/rootfs.tar", errorMsg: "dest is only supported with type=tar"},
+		{name: "dest is a directory", spec: "type=tar,dest=" + dir, errorMsg: "dest '" + dir + "' is a directory, expected a file path"},
+		{name: "missing dest directory", spec: "type=tar,dest=" + dir + "/missing/rootfs.tar", errorMsg: "directory of dest '" + dir + "/missing/rootfs.tar' does not exist"},
+		{name: "unknown option", spec: "type=tar,compression=zstd", errorMsg: "unknown output option 'compression' (supported: type, dest)"},
+		{name: "malformed option", spec: "tar", errorMsg: "invalid output option 'tar', expected KEY=VALUE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputType, dest, err := ParseOutput(tt.spec)
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Errorf("ParseOutput(%q) error = %v, want %q", tt.spec, err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOutput(%q) unexpected error: %v", tt.spec, err)
+			}
+			if outputType != tt.wantType || dest != tt.wantDest {
+				t.Errorf("ParseOutput(%q) = %q, %q, want %q, %q", tt.spec, outputType, dest, tt.wantType, tt.wantDest)
+			}
+		})
+	}
+}
+
+func TestCheckTemplateStorage(t *testing.T) {
+	var commands []string
+	b := New(&Config{Compress: "zstd", TemplateStorage: "local-lvm"})
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	b.output = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return []byte(storageStatus), nil
+	}
+
+	_, err := b.exportTemplate(12345, "web")
+	if err == nil {
+		t.Fatal("exportTemplate() expected error for a storage without vztmpl content")
+	}
+	for _, want := range []string{"template storage 'local-lvm' does not support container templates", "set template_storage"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %q, want it to contain %q", err, want)
+		}
+	}
+	if strings.Join(commands, "\n") != "pvesm status --content vztmpl" {
+		t.Errorf("commands = %q, want only the storage check before the container is converted", commands)
+	}
+
+	t.Run("check runs once", func(t *testing.T) {
+		commands = nil
+		b.config.TemplateStorage = "local"
+		b.templateStorageChecked = false
+		for i := 0; i < 2; i++ {
+			if err := b.CheckTemplateStorage(); err != nil {
+				t.Fatalf("CheckTemplateStorage() unexpected error: %v", err)
+			}
+		}
+		if len(commands) != 1 {
+			t.Errorf("commands = %q, want a single pvesm status", commands)
+		}
+	})
+}
+
+func TestExecuteCopyStepDirectory(t *testing.T) {
+	source := t.TempDir()
+	var commands []string
+	b := New(&Config{})
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+
+	step := models.CopyStep{Source: source, Dest: "/srv/app", Owner: "app"}
+	if err := b.executeCopyStep(12345, step, "copy-app"); err != nil {
+		t.Fatalf("executeCopyStep() unexpected error: %v", err)
+	}
+	if len(commands) == 0 || !strings.HasPrefix(commands[0], "tar --numeric-owner -cpf ") || !strings.HasSuffix(commands[0], " -C "+source+" .") {
+		t.Fatalf("commands = %q, want the directory packed with tar first", commands)
+	}
+	want := "pct exec 12345 -- tar -xpf /tmp/pxc-build-copy-12345.tar -C /srv/app --no-same-owner"
+	found := false
+	for _, command := range commands {
+		found = found || command == want
+	}
+	if !found {
+		t.Errorf("commands = %q, want extraction %q", commands, want)
+	}
+	if last := commands[len(commands)-1]; last != "pct exec 12345 -- rm -f /tmp/pxc-build-copy-12345.tar" {
+		t.Errorf("last command = %q, want the archive removed in the container", last)
+	}
+}
@@ -0,0 +1,378 @@
+package builder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// CacheOptions configures build caching for a single build.
+//
+// Cache entries are container snapshots named after the setup steps they
+// contain. With To set, setup steps run in that container and a snapshot is
+// taken after each step, so a later build (or a retry after a failed step)
+// can resume from the deepest snapshot found in From.
+type CacheOptions struct {
+	From []string // Containers or snapshots to resume from (VMID or VMID@snapshot)
+	To   string   // Container that keeps per-step snapshots (VMID)
+
+	// Hostname is given to the To container whenever it is created, so a
+	// later build can find it again
+	Hostname string
+}
+
+// cacheHostnamePrefix names the containers of the automatic build cache
+const cacheHostnamePrefix = "pxc-cache-"
+
+// snapshotStorageTypes lists the storage types whose containers can be
+// snapshotted, which the build cache relies on
+var snapshotStorageTypes = []string{"lvmthin", "zfspool", "rbd", "btrfs"}
+
+// cacheSource is a cache_from container with the snapshots it offers
+type cacheSource struct {
+	VMID      int
+	Snapshots []string
+}
+
+// cacheHit is the snapshot a build resumes from. Setup steps up to and
+// including Step are already contained in the snapshot.
+type cacheHit struct {
+	VMID     int
+	Snapshot string
+	Step     int
+}
+
+// stepCacheKeys returns the snapshot name for the state after each setup
+// step. Each key covers the base template, build args and all steps up to
+// it, including the contents of copied files, so any change invalidates the
+// key of that step and every step after it. Files copied from stages are
+// covered by the stage's key from stageKeys, so the keys are known before
+// any stage is built.
+func stepCacheKeys(lxcfile *models.LXCfile, buildArgs map[string]string, stageKeys map[string]string) []string {
+	h := sha256.New()
+	fmt.Fprintf(h, "from=%s\n", lxcfile.From)
+	hashBuildArgs(h, buildArgs)
+	return chainStepKeys(h, lxcfile.Setup, buildArgs, stageKeys)
+}
+
+// stageCacheKeys returns a key for each stage the LXCfile copies from,
+// covering the stage's base template, the build args and its steps as
+// stepCacheKeys does, so a stage that did not change keeps its key
+func stageCacheKeys(lxcfile *models.LXCfile, buildArgs map[string]string) map[string]string {
+	keys := make(map[string]string)
+	for _, name := range lxcfile.StageOrder() {
+		stage := lxcfile.Stages[name]
+		h := sha256.New()
+		fmt.Fprintf(h, "stage %s from=%s\n", name, stage.From)
+		hashBuildArgs(h, buildArgs)
+		chainStepKeys(h, stage.Setup, buildArgs, keys)
+		keys[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return keys
+}
+
+// hashBuildArgs adds the build args to h in a stable order
+func hashBuildArgs(h hash.Hash, buildArgs map[string]string) {
+	names := make([]string, 0, len(buildArgs))
+	for name := range buildArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "arg %s=%s\n", name, buildArgs[name])
+	}
+}
+
+// chainStepKeys adds each step to h and returns the snapshot name for the
+// state after it
+func chainStepKeys(h hash.Hash, steps []models.SetupStep, buildArgs map[string]string, stageKeys map[string]string) []string {
+	keys := make([]string, len(steps))
+	for i, step := range steps {
+		step = expandStep(step, buildArgs)
+		data, _ := json.Marshal(step)
+		h.Write(data)
+		switch {
+		case step.Copy != nil && step.Copy.From != "":
+			fmt.Fprintf(h, "stage=%s\n", stageKeys[step.Copy.From])
+		case step.Copy != nil:
+			h.Write([]byte(copySourceDigest(step.Copy.Source)))
+		}
+		keys[i] = "pxc-" + hex.EncodeToString(h.Sum(nil))[:12]
+	}
+	return keys
+}
+
+// copySourceDigest hashes the names and contents of a copy step's source
+func copySourceDigest(source string) string {
+	hash := sha256.New()
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(source, path)
+		fmt.Fprintf(hash, "%s\n", rel)
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(hash, file)
+		return err
+	})
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// lookupCache picks the snapshot that covers the most setup steps. When
+// several sources hold the same step, the one listed first in cache_from wins.
+func lookupCache(keys []string, sources []cacheSource) (cacheHit, bool) {
+	for step := len(keys) - 1; step >= 0; step-- {
+		for _, source := range sources {
+			for _, snapshot := range source.Snapshots {
+				if snapshot == keys[step] {
+					return cacheHit{VMID: source.VMID, Snapshot: snapshot, Step: step}, true
+				}
+			}
+		}
+	}
+	return cacheHit{}, false
+}
+
+// findCache lists the snapshots of the cache_from containers and looks up
+// the deepest usable one. Unreachable sources are skipped with a warning.
+func (b *Builder) findCache(refs []string, keys []string) (cacheHit, bool) {
+	var sources []cacheSource
+	for _, ref := range refs {
+		cacheRef, err := models.ParseCacheRef(ref)
+		if err != nil {
+			b.logWarning("Ignoring cache_from %s: %v", ref, err)
+			continue
+		}
+		if cacheRef.Snapshot != "" {
+			sources = append(sources, cacheSource{VMID: cacheRef.VMID, Snapshots: []string{cacheRef.Snapshot}})
+			continue
+		}
+
+		output, err := b.output(b.ctx, "pct", "listsnapshot", strconv.Itoa(cacheRef.VMID))
+		if err != nil {
+			b.logWarning("Ignoring cache_from %s: failed to list snapshots: %v", ref, err)
+			continue
+		}
+		sources = append(sources, cacheSource{VMID: cacheRef.VMID, Snapshots: parseSnapshotList(string(output))})
+	}
+
+	return lookupCache(keys, sources)
+}
+
+// parseSnapshotList parses the output of pct listsnapshot:
+//
+//	`-> pxc-3f2a9c1b7d4e  2024-05-01 12:00:00  no-description
+//	 `-> current                               You are here!
+func parseSnapshotList(output string) []string {
+	var snapshots []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "`->")
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "current" {
+			continue
+		}
+		snapshots = append(snapshots, fields[0])
+	}
+	return snapshots
+}
+
+// LocalCache returns the options of the automatic build cache of a
+// template. Setup steps run in a cache container kept per template name
+// (without the tag), and a build resumes from the deepest matching snapshot
+// of any cache container on the node, so templates sharing a base and
+// leading steps share them. With noCache set nothing is reused and the
+// template's cache is rebuilt from scratch. The cache is skipped with a
+// warning when the build storage cannot take snapshots.
+func (b *Builder) LocalCache(templateName string, noCache bool) (CacheOptions, error) {
+	if b.config.DryRun {
+		return CacheOptions{}, nil
+	}
+
+	output, err := b.output(b.ctx, "pvesm", "status", "--storage", b.config.Storage)
+	if err != nil {
+		return CacheOptions{}, fmt.Errorf("failed to check storage '%s': %w", b.config.Storage, err)
+	}
+	if storageType := storageTypeOf(string(output), b.config.Storage); !containsString(snapshotStorageTypes, storageType) {
+		b.logWarning("Build cache disabled: storage '%s' (type %s) does not support snapshots", b.config.Storage, storageType)
+		return CacheOptions{}, nil
+	}
+
+	output, err = b.output(b.ctx, "pct", "list")
+	if err != nil {
+		return CacheOptions{}, fmt.Errorf("failed to list cache containers: %w", err)
+	}
+	caches := parseCacheContainers(string(output))
+
+	hostname := cacheHostname(templateName)
+	cacheID, exists := caches[hostname]
+	if !exists {
+		output, err := b.output(b.ctx, "pvesh", "get", "/cluster/nextid")
+		if err != nil {
+			return CacheOptions{}, fmt.Errorf("failed to allocate a cache container ID: %w", err)
+		}
+		if cacheID, err = strconv.Atoi(strings.TrimSpace(string(output))); err != nil {
+			return CacheOptions{}, fmt.Errorf("failed to allocate a cache container ID: unexpected output %q", output)
+		}
+	}
+
+	cache := CacheOptions{To: strconv.Itoa(cacheID), Hostname: hostname}
+	if noCache {
+		return cache, nil
+	}
+
+	// The template's own cache first, so it wins ties and is rolled back
+	// in place instead of being cloned
+	if exists {
+		cache.From = append(cache.From, cache.To)
+	}
+	others := make([]string, 0, len(caches))
+	for other := range caches {
+		if other != hostname {
+			others = append(others, other)
+		}
+	}
+	sort.Strings(others)
+	for _, other := range others {
+		cache.From = append(cache.From, strconv.Itoa(caches[other]))
+	}
+	return cache, nil
+}
+
+// cacheHostname returns the hostname of a template's cache container:
+// the template name without its tag, reduced to a valid hostname
+func cacheHostname(templateName string) string {
+	if i := strings.LastIndex(templateName, ":"); i >= 0 {
+		templateName = templateName[:i]
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, templateName)
+	hostname := cacheHostnamePrefix + strings.Trim(name, "-")
+	if len(hostname) > 63 {
+		hostname = strings.TrimRight(hostname[:63], "-")
+	}
+	return hostname
+}
+
+// parseCacheContainers returns the IDs of the cache containers in pct list
+// output (VMID Status Lock Name), by hostname
+func parseCacheContainers(output string) map[string]int {
+	caches := make(map[string]int)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[len(fields)-1], cacheHostnamePrefix) {
+			continue
+		}
+		if vmid, err := strconv.Atoi(fields[0]); err == nil {
+			caches[fields[len(fields)-1]] = vmid
+		}
+	}
+	return caches
+}
+
+// storageTypeOf returns the type of storage in pvesm status output (Name
+// Type Status ...), empty if it is not listed
+func storageTypeOf(output, storage string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[0] == storage {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareCacheContainer makes the cache_to container hold the state of the
+// cache hit, or creates it fresh from the base template on a miss. A
+// created container is given hostname unless it is empty.
+func (b *Builder) prepareCacheContainer(cacheID int, hostname, baseTemplate, osType string, keys []string, hit cacheHit, found bool) error {
+	if found && hit.VMID == cacheID {
+		// Drop snapshots of later steps so the hit is the latest snapshot,
+		// which every storage type can roll back to
+		for _, key := range keys[hit.Step+1:] {
+			_ = b.run(b.ctx, "pct", "delsnapshot", strconv.Itoa(cacheID), key)
+		}
+		return b.runPCTCommand("rollback", strconv.Itoa(cacheID), hit.Snapshot)
+	}
+
+	// Replace whatever the cache container held before
+	_ = b.runPCTCommand("stop", strconv.Itoa(cacheID))
+	_ = b.runPCTCommand("destroy", strconv.Itoa(cacheID))
+
+	if !found {
+		if err := b.createTempContainer(cacheID, baseTemplate, osType); err != nil {
+			return err
+		}
+		return b.setCacheHostname(cacheID, hostname)
+	}
+	if err := b.cloneFromSnapshot(hit.VMID, hit.Snapshot, cacheID); err != nil {
+		return err
+	}
+	if err := b.setCacheHostname(cacheID, hostname); err != nil {
+		return err
+	}
+	// Record the resumed state so the cache container is a complete source
+	return b.runPCTCommand("snapshot", strconv.Itoa(cacheID), hit.Snapshot)
+}
+
+// setCacheHostname names a cache container, unless hostname is empty
+func (b *Builder) setCacheHostname(cacheID int, hostname string) error {
+	if hostname == "" {
+		return nil
+	}
+	return b.runPCTCommand("set", strconv.Itoa(cacheID), "--hostname", hostname)
+}
+
+// cloneFromSnapshot creates a full clone of a container snapshot
+func (b *Builder) cloneFromSnapshot(sourceID int, snapshot string, containerID int) error {
+	b.log("Creating container %d from cache %d@%s", containerID, sourceID, snapshot)
+
+	return b.runPCTCommand("clone", strconv.Itoa(sourceID), strconv.Itoa(containerID),
+		"--snapname", snapshot,
+		"--full", "1",
+		"--hostname", fmt.Sprintf("%s%d", b.config.TempContainerPrefix, containerID))
+}
+
+// outputCommand executes an external command and returns its stdout
+func (b *Builder) outputCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return proxmox.CommandOutput(proxmox.CommandContext(ctx, name, args...))
+}
@@ -0,0 +1,335 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+func TestStepCacheKeys(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From: "ubuntu:22.04",
+		Setup: []models.SetupStep{
+			{Run: "apt-get update"},
+			{Run: "apt-get install -y nginx"},
+			{Run: "systemctl enable nginx"},
+		},
+	}
+	keys := stepCacheKeys(lxcfile, map[string]string{"VERSION": "1.0"}, nil)
+
+	if len(keys) != 3 {
+		t.Fatalf("stepCacheKeys() returned %d keys, want 3", len(keys))
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "pxc-") || len(key) != 16 {
+			t.Errorf("key %q is not a valid snapshot name", key)
+		}
+	}
+
+	if again := stepCacheKeys(lxcfile, map[string]string{"VERSION": "1.0"}, nil); !reflect.DeepEqual(again, keys) {
+		t.Errorf("stepCacheKeys() is not stable: %v != %v", again, keys)
+	}
+
+	changed := *lxcfile
+	changed.Setup = append([]models.SetupStep{}, lxcfile.Setup...)
+	changed.Setup[1].Run = "apt-get install -y nginx-light"
+	changedKeys := stepCacheKeys(&changed, map[string]string{"VERSION": "1.0"}, nil)
+	if changedKeys[0] != keys[0] {
+		t.Error("changing step 2 should keep the key of step 1")
+	}
+	if changedKeys[1] == keys[1] || changedKeys[2] == keys[2] {
+		t.Error("changing step 2 should invalidate steps 2 and 3")
+	}
+
+	if argKeys := stepCacheKeys(lxcfile, map[string]string{"VERSION": "2.0"}, nil); argKeys[0] == keys[0] {
+		t.Error("changing build args should invalidate every step")
+	}
+}
+
+func TestStepCacheKeysCopySource(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(source, []byte("port=80"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lxcfile := &models.LXCfile{
+		From:  "ubuntu:22.04",
+		Setup: []models.SetupStep{{Copy: &models.CopyStep{Source: source, Dest: "/etc/app.conf"}}},
+	}
+	before := stepCacheKeys(lxcfile, nil, nil)
+
+	if err := os.WriteFile(source, []byte("port=8080"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if after := stepCacheKeys(lxcfile, nil, nil); after[0] == before[0] {
+		t.Error("changing a copied file should invalidate the copy step")
+	}
+}
+
+func TestLookupCache(t *testing.T) {
+	keys := []string{"pxc-aaaaaaaaaaaa", "pxc-bbbbbbbbbbbb", "pxc-cccccccccccc"}
+
+	tests := []struct {
+		name     string
+		sources  []cacheSource
+		expected cacheHit
+		found    bool
+	}{
+		{
+			name:    "no sources",
+			sources: nil,
+		},
+		{
+			name:    "no matching snapshots",
+			sources: []cacheSource{{VMID: 9000, Snapshots: []string{"before-upgrade", "pxc-dddddddddddd"}}},
+		},
+		{
+			name:     "deepest snapshot wins",
+			sources:  []cacheSource{{VMID: 9000, Snapshots: []string{"pxc-aaaaaaaaaaaa", "pxc-bbbbbbbbbbbb"}}},
+			expected: cacheHit{VMID: 9000, Snapshot: "pxc-bbbbbbbbbbbb", Step: 1},
+			found:    true,
+		},
+		{
+			name: "deeper source wins over earlier source",
+			sources: []cacheSource{
+				{VMID: 9000, Snapshots: []string{"pxc-aaaaaaaaaaaa"}},
+				{VMID: 9001, Snapshots: []string{"pxc-aaaaaaaaaaaa", "pxc-bbbbbbbbbbbb", "pxc-cccccccccccc"}},
+			},
+			expected: cacheHit{VMID: 9001, Snapshot: "pxc-cccccccccccc", Step: 2},
+			found:    true,
+		},
+		{
+			name: "earlier source wins a tie",
+			sources: []cacheSource{
+				{VMID: 9000, Snapshots: []string{"pxc-bbbbbbbbbbbb"}},
+				{VMID: 9001, Snapshots: []string{"pxc-bbbbbbbbbbbb"}},
+			},
+			expected: cacheHit{VMID: 9000, Snapshot: "pxc-bbbbbbbbbbbb", Step: 1},
+			found:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hit, found := lookupCache(keys, tt.sources)
+			if found != tt.found {
+				t.Fatalf("lookupCache() found = %v, want %v", found, tt.found)
+			}
+			if hit != tt.expected {
+				t.Errorf("lookupCache() = %+v, want %+v", hit, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSnapshotList(t *testing.T) {
+	output := "`-> pxc-aaaaaaaaaaaa  2024-05-01 12:00:00  no-description\n" +
+		" `-> pxc-bbbbbbbbbbbb 2024-05-01 12:05:00  no-description\n" +
+		"  `-> current                              You are here!\n"
+
+	expected := []string{"pxc-aaaaaaaaaaaa", "pxc-bbbbbbbbbbbb"}
+	if got := parseSnapshotList(output); !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseSnapshotList() = %v, want %v", got, expected)
+	}
+}
+
+func TestBuildTemplateWithCache(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From: "ubuntu:22.04",
+		Setup: []models.SetupStep{
+			{Name: "update", Run: "apt-get update"},
+			{Name: "install", Run: "apt-get install -y nginx"},
+			{Name: "configure", Run: "nginx -t"},
+		},
+	}
+	keys := stepCacheKeys(lxcfile, nil, nil)
+
+	var commands []string
+	var executed []string
+	b := New(&Config{})
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	b.output = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		if args[0] == "listsnapshot" {
+			return []byte(fmt.Sprintf("`-> %s 2024-05-01 12:00:00 no-description\n `-> current You are here!\n", keys[1])), nil
+		}
+		return nil, nil
+	}
+	b.execStep = func(_ context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+		executed = append(executed, stepName)
+		return nil
+	}
+
+	result, err := b.BuildTemplateWithCache(context.Background(), lxcfile, "web", nil, CacheOptions{From: []string{"9000"}, To: "9000"})
+	if err != nil {
+		t.Fatalf("BuildTemplateWithCache() unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(executed, []string{"configure"}) {
+		t.Errorf("executed steps = %v, want only configure", executed)
+	}
+	statuses := []string{}
+	for _, step := range result.Steps {
+		statuses = append(statuses, step.Name+"="+step.Status)
+	}
+	if want := []string{"update=cached", "install=cached", "configure=ok"}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("steps = %v, want %v", statuses, want)
+	}
+
+	id := fmt.Sprint(result.ContainerID)
+	expected := []string{
+		"pct delsnapshot 9000 " + keys[2],
+		"pct rollback 9000 " + keys[1],
+		"pct start 9000",
+		"pct snapshot 9000 " + keys[2],
+		"pct clone 9000 " + id + " --snapname " + keys[2] + " --full 1 --hostname pxc-build-" + id,
+		"pct start " + id,
+		"pct stop " + id,
+		"pct template " + id,
+		"pct stop 9000",
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("commands =\n%s\nwant\n%s", strings.Join(commands, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestCacheHostname(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{template: "webapp:2.0", expected: "pxc-cache-webapp"},
+		{template: "My_App", expected: "pxc-cache-my-app"},
+		{template: "registry/base:latest", expected: "pxc-cache-registry-base"},
+		{template: strings.Repeat("a", 70), expected: "pxc-cache-" + strings.Repeat("a", 53)},
+	}
+
+	for _, tt := range tests {
+		if got := cacheHostname(tt.template); got != tt.expected {
+			t.Errorf("cacheHostname(%q) = %q, want %q", tt.template, got, tt.expected)
+		}
+	}
+}
+
+func TestLocalCache(t *testing.T) {
+	pctList := "VMID       Status     Lock         Name\n" +
+		"120        running                 web\n" +
+		"9001       stopped                 pxc-cache-worker\n" +
+		"9000       stopped                 pxc-cache-webapp\n"
+
+	newBuilder := func(storageType string) *Builder {
+		b := New(&Config{Storage: "local-lvm", Output: io.Discard})
+		b.output = func(_ context.Context, name string, args ...string) ([]byte, error) {
+			switch name + " " + args[0] {
+			case "pvesm status":
+				return []byte("Name Type Status Total Used Available %\nlocal-lvm " + storageType + " active 100 10 90 10%\n"), nil
+			case "pct list":
+				return []byte(pctList), nil
+			case "pvesh get":
+				return []byte("9002\n"), nil
+			}
+			return nil, fmt.Errorf("unexpected command %s %v", name, args)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		noCache     bool
+		storageType string
+		expected    CacheOptions
+	}{
+		{
+			name:        "existing cache first",
+			template:    "webapp:2.0",
+			storageType: "lvmthin",
+			expected:    CacheOptions{From: []string{"9000", "9001"}, To: "9000", Hostname: "pxc-cache-webapp"},
+		},
+		{
+			name:        "new cache container",
+			template:    "api:1.0",
+			storageType: "zfspool",
+			expected:    CacheOptions{From: []string{"9000", "9001"}, To: "9002", Hostname: "pxc-cache-api"},
+		},
+		{
+			name:        "no cache",
+			template:    "webapp:2.0",
+			noCache:     true,
+			storageType: "lvmthin",
+			expected:    CacheOptions{To: "9000", Hostname: "pxc-cache-webapp"},
+		},
+		{
+			name:        "storage without snapshots",
+			template:    "webapp:2.0",
+			storageType: "dir",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := newBuilder(tt.storageType).LocalCache(tt.template, tt.noCache)
+			if err != nil {
+				t.Fatalf("LocalCache() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(cache, tt.expected) {
+				t.Errorf("LocalCache() = %+v, want %+v", cache, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildTemplateWithNewCacheContainer(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From:  "ubuntu:22.04",
+		Setup: []models.SetupStep{{Name: "update", Run: "apt-get update"}},
+	}
+	keys := stepCacheKeys(lxcfile, nil, nil)
+
+	var commands []string
+	b := New(&Config{Output: io.Discard})
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	b.output = func(_ context.Context, name string, args ...string) ([]byte, error) { return nil, nil }
+	b.execStep = func(_ context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+		return nil
+	}
+
+	if _, err := b.BuildTemplateWithCache(context.Background(), lxcfile, "api", nil, CacheOptions{To: "9002", Hostname: "pxc-cache-api"}); err != nil {
+		t.Fatalf("BuildTemplateWithCache() unexpected error: %v", err)
+	}
+	want := []string{
+		"pct stop 9002",
+		"pct destroy 9002",
+		"pct create 9002 ubuntu:22.04 --hostname pxc-build-9002 --memory 512 --cores 1 --unprivileged 1 --storage local-lvm --ostype ubuntu",
+		"pct set 9002 --hostname pxc-cache-api",
+		"pct start 9002",
+		"pct snapshot 9002 " + keys[0],
+	}
+	if len(commands) < len(want) || !reflect.DeepEqual(commands[:len(want)], want) {
+		t.Errorf("commands =\n%s\nwant them to start with\n%s", strings.Join(commands, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Without setup steps there is nothing to cache
+	commands = nil
+	if _, err := b.BuildTemplateWithCache(context.Background(), &models.LXCfile{From: "ubuntu:22.04"}, "api", nil, CacheOptions{To: "9002", Hostname: "pxc-cache-api"}); err != nil {
+		t.Fatalf("BuildTemplateWithCache() unexpected error: %v", err)
+	}
+	for _, command := range commands {
+		if strings.Contains(command, "9002") {
+			t.Errorf("command %q touched the cache container of a build without setup steps", command)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package builder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile names the file in a build context listing paths that are not
+// part of it
+const IgnoreFile = ".pxcignore"
+
+// ignorePattern is one line of an ignore file
+type ignorePattern struct {
+	pattern  string
+	negate   bool // ! re-includes paths an earlier pattern excluded
+	dirOnly  bool // a trailing / matches directories only
+	anchored bool // contains a /, so matches from the context root
+}
+
+// IgnorePatterns decide which paths of a build context are ignored. Patterns
+// follow .dockerignore: blank lines and lines starting with # are skipped,
+// patterns are matched with path.Match against the slash-separated path
+// relative to the context, patterns without a / also match a base name at
+// any depth, a trailing / matches only directories, a leading ! re-includes
+// what earlier patterns excluded, and the last matching pattern wins.
+type IgnorePatterns []ignorePattern
+
+// ParseIgnore parses the contents of an ignore file
+func ParseIgnore(content string) (IgnorePatterns, error) {
+	var patterns IgnorePatterns
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var p ignorePattern
+		if strings.HasPrefix(text, "!") {
+			p.negate = true
+			text = text[1:]
+		}
+		if strings.HasSuffix(text, "/") {
+			p.dirOnly = true
+			text = strings.TrimRight(text, "/")
+		}
+		text = strings.TrimPrefix(path.Clean("/"+text), "/")
+		if text == "" {
+			continue
+		}
+		if _, err := path.Match(text, ""); err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern '%s': %w", line, scanner.Text(), err)
+		}
+		p.pattern = text
+		p.anchored = strings.Contains(text, "/")
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+// LoadIgnore reads the ignore file of a build context; a context without
+// one ignores nothing
+func LoadIgnore(context string) (IgnorePatterns, error) {
+	file := filepath.Join(context, IgnoreFile)
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	patterns, err := ParseIgnore(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", file, err)
+	}
+	return patterns, nil
+}
+
+// Ignored reports whether a path relative to the context is ignored. The
+// contents of an ignored directory are ignored too.
+func (p IgnorePatterns) Ignored(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+
+	ignored := false
+	for _, pattern := range p {
+		for depth := 1; depth <= len(parts); depth++ {
+			// Parent directories are matched as directories
+			if pattern.dirOnly && depth == len(parts) && !isDir {
+				continue
+			}
+			if pattern.matches(parts[:depth]) {
+				ignored = !pattern.negate
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// matches reports whether the pattern matches a path given as its parts
+func (p ignorePattern) matches(parts []string) bool {
+	if p.anchored {
+		matched, _ := path.Match(p.pattern, strings.Join(parts, "/"))
+		return matched
+	}
+	matched, _ := path.Match(p.pattern, parts[len(parts)-1])
+	return matched
+}
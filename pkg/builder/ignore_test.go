@@ -0,0 +1,62 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnorePatterns(t *testing.T) {
+	patterns, err := ParseIgnore(`# build output
+*.log
+node_modules/
+/dist
+docs/*.md
+!docs/README.md
+`)
+	if err != nil {
+		t.Fatalf("ParseIgnore() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "app.log", want: true},
+		{path: "logs/debug.log", want: true},
+		{path: "node_modules", isDir: true, want: true},
+		{path: "node_modules/lib/index.js", want: true},
+		{path: "src/node_modules", want: false}, // A file, not a directory
+		{path: "dist", isDir: true, want: true},
+		{path: "dist/bundle.js", want: true},
+		{path: "docs/guide.md", want: true},
+		{path: "docs/README.md", want: false},
+		{path: "src/app.js", want: false},
+		{path: "LXCfile.yml", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := patterns.Ignored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIgnore(t *testing.T) {
+	context := t.TempDir()
+
+	patterns, err := LoadIgnore(context)
+	if err != nil || patterns != nil {
+		t.Fatalf("LoadIgnore() without %s = %v, %v, want no patterns", IgnoreFile, patterns, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(context, IgnoreFile), []byte("[\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIgnore(context); err == nil {
+		t.Error("LoadIgnore() expected error for an invalid pattern, got nil")
+	}
+}
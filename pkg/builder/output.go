@@ -0,0 +1,94 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OutputTypes lists the supported build output types: a registered Proxmox
+// template, or a tarball of the container's root filesystem
+var OutputTypes = []string{"template", "tar"}
+
+// rootfsDir is where pct mount exposes container root filesystems
+var rootfsDir = "/var/lib/lxc"
+
+// ParseOutput splits an output spec such as "type=tar,dest=rootfs.tar.gz"
+// into its type and destination. The type defaults to template.
+func ParseOutput(spec string) (outputType, dest string, err error) {
+	outputType = "template"
+	for _, field := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return "", "", fmt.Errorf("invalid output option '%s', expected KEY=VALUE", field)
+		}
+		switch key {
+		case "type":
+			outputType = value
+		case "dest":
+			dest = value
+		default:
+			return "", "", fmt.Errorf("unknown output option '%s' (supported: type, dest)", key)
+		}
+	}
+	return outputType, dest, ValidateOutput(outputType, dest)
+}
+
+// ValidateOutput checks an output type and its destination. A tar output
+// needs a dest whose directory exists; a template has no dest.
+func ValidateOutput(outputType, dest string) error {
+	switch outputType {
+	case "", "template":
+		if dest != "" {
+			return fmt.Errorf("dest is only supported with type=tar")
+		}
+	case "tar":
+		if dest == "" {
+			return fmt.Errorf("type=tar requires a dest")
+		}
+		if info, err := os.Stat(dest); err == nil && info.IsDir() {
+			return fmt.Errorf("dest '%s' is a directory, expected a file path", dest)
+		}
+		if info, err := os.Stat(filepath.Dir(dest)); err != nil || !info.IsDir() {
+			return fmt.Errorf("directory of dest '%s' does not exist", dest)
+		}
+	default:
+		return fmt.Errorf("unsupported output type '%s', must be one of: %s", outputType, strings.Join(OutputTypes, ", "))
+	}
+	return nil
+}
+
+// exportRootfs writes the stopped container's root filesystem to dest as a
+// tarball. tar picks the compression from the dest suffix (.gz, .zst, .xz)
+// and keeps numeric owners so the archive maps back onto the same IDs.
+func (b *Builder) exportRootfs(containerID int, dest string) error {
+	b.log("Exporting root filesystem to %s", dest)
+
+	if b.config.DryRun {
+		b.log("DRY RUN: Would mount container %d and archive its root filesystem", containerID)
+		return nil
+	}
+
+	id := strconv.Itoa(containerID)
+	if err := b.runPCTCommand("mount", id); err != nil {
+		return fmt.Errorf("failed to mount container: %w", err)
+	}
+
+	err := b.run(b.ctx, "tar", rootfsTarArgs(containerID, dest)...)
+	if unmountErr := b.runPCTCommand("unmount", id); unmountErr != nil && err == nil {
+		err = fmt.Errorf("failed to unmount container: %w", unmountErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to archive root filesystem: %w", err)
+	}
+	return nil
+}
+
+// rootfsTarArgs returns the tar arguments archiving a mounted container's
+// root filesystem to dest
+func rootfsTarArgs(containerID int, dest string) []string {
+	rootfs := filepath.Join(rootfsDir, strconv.Itoa(containerID), "rootfs")
+	return []string{"--numeric-owner", "--auto-compress", "-cf", dest, "-C", rootfs, "."}
+}
@@ -0,0 +1,237 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brynnjknight/proxer/pkg/output"
+	"github.com/brynnjknight/proxer/pkg/terminal"
+)
+
+// ProgressModes lists the supported --progress values:
+//
+//	auto   tty when output goes to a terminal, plain otherwise
+//	plain  one line per event with numbered steps; step output is streamed
+//	       with the step's number in front of each line. Safe for CI logs.
+//	tty    one line per step, updated in place with the elapsed time; step
+//	       output is kept back and only shown when the step fails
+var ProgressModes = []string{"auto", "plain", "tty"}
+
+// ValidateProgress checks a progress mode against the supported list
+func ValidateProgress(mode string) error {
+	if mode == "" {
+		return nil
+	}
+	for _, supported := range ProgressModes {
+		if mode == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported progress mode '%s', must be one of: %s", mode, strings.Join(ProgressModes, ", "))
+}
+
+// ResolveProgress turns auto into tty when output goes to a terminal and
+// into plain otherwise. Other modes are returned unchanged.
+func ResolveProgress(mode string, isTerminal bool) string {
+	if mode != "auto" {
+		return mode
+	}
+	if isTerminal {
+		return "tty"
+	}
+	return "plain"
+}
+
+// isTerminalWriter reports whether w is a terminal
+func isTerminalWriter(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	return ok && terminal.IsTerminal(int(file.Fd()))
+}
+
+// stepProgress reports setup and cleanup steps as they run
+type stepProgress interface {
+	// start begins step number (counted across phases), the index-th of
+	// total steps in its phase
+	start(number, index, total int, phase, name string)
+
+	// finish ends the current step with its StepResult status
+	finish(status string, err error)
+
+	// output receives build logs and command output; while a step runs
+	// they belong to that step
+	output() io.Writer
+}
+
+// newStepProgress returns the progress display for a resolved mode, or nil
+// to log without step framing
+func newStepProgress(mode string, w io.Writer, now func() time.Time) stepProgress {
+	switch mode {
+	case "plain":
+		return &plainProgress{w: w, now: now}
+	case "tty":
+		return &ttyProgress{w: w, now: now}
+	}
+	return nil
+}
+
+// plainProgress prints every event on its own line
+type plainProgress struct {
+	w       io.Writer
+	now     func() time.Time
+	number  int
+	started time.Time
+	prefix  *prefixWriter
+}
+
+func (p *plainProgress) start(number, index, total int, phase, name string) {
+	p.number = number
+	p.started = p.now()
+	p.prefix = &prefixWriter{w: p.w, prefix: fmt.Sprintf("#%d ", number), lineStart: true}
+	fmt.Fprintf(p.w, "#%d [%s %d/%d] %s\n", number, phase, index, total, name)
+}
+
+func (p *plainProgress) finish(status string, err error) {
+	elapsed := p.now().Sub(p.started).Seconds()
+	switch status {
+	case "ok":
+		fmt.Fprintf(p.w, "#%d DONE %.1fs\n", p.number, elapsed)
+	case "failed":
+		fmt.Fprintf(p.w, "#%d ERROR %.1fs: %v\n", p.number, elapsed, err)
+	case "ignored":
+		fmt.Fprintf(p.w, "#%d IGNORED %.1fs: %v\n", p.number, elapsed, err)
+	default:
+		fmt.Fprintf(p.w, "#%d %s\n", p.number, strings.ToUpper(status))
+	}
+	p.prefix = nil
+}
+
+func (p *plainProgress) output() io.Writer {
+	if p.prefix == nil {
+		return p.w
+	}
+	return p.prefix
+}
+
+// prefixWriter writes prefix at the start of every line
+type prefixWriter struct {
+	w         io.Writer
+	prefix    string
+	lineStart bool
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, c := range data {
+		if p.lineStart {
+			buf.WriteString(p.prefix)
+		}
+		buf.WriteByte(c)
+		p.lineStart = c == '\n'
+	}
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// ttyProgress keeps one line per step, redrawn with the elapsed time while
+// the step runs
+type ttyProgress struct {
+	w   io.Writer
+	now func() time.Time
+
+	mu      sync.Mutex
+	line    string
+	started time.Time
+	buf     bytes.Buffer
+	done    chan struct{}
+	ticker  sync.WaitGroup
+}
+
+// ttyRefresh is how often the running step's line is redrawn
+const ttyRefresh = 100 * time.Millisecond
+
+func (p *ttyProgress) start(number, index, total int, phase, name string) {
+	p.mu.Lock()
+	p.line = fmt.Sprintf("[%s %d/%d] %s", phase, index, total, name)
+	p.started = p.now()
+	p.buf.Reset()
+	p.done = make(chan struct{})
+	fmt.Fprintf(p.w, "=> %s", p.line)
+	p.mu.Unlock()
+
+	p.ticker.Add(1)
+	go func(done chan struct{}) {
+		defer p.ticker.Done()
+		tick := time.NewTicker(ttyRefresh)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				p.mu.Lock()
+				fmt.Fprintf(p.w, "\r\033[K=> %s %.1fs", p.line, p.now().Sub(p.started).Seconds())
+				p.mu.Unlock()
+			}
+		}
+	}(p.done)
+}
+
+func (p *ttyProgress) finish(status string, err error) {
+	close(p.done)
+	p.ticker.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	level := output.Info
+	switch status {
+	case "ok":
+		level = output.Success
+	case "failed":
+		level = output.Error
+	case "ignored":
+		level = output.Warning
+	}
+	elapsed := p.now().Sub(p.started).Seconds()
+	fmt.Fprintf(p.w, "\r\033[K%s%s %.1fs", output.Prefix(level), p.line, elapsed)
+	if status == "skipped" || status == "cached" {
+		fmt.Fprintf(p.w, " (%s)", status)
+	}
+	fmt.Fprintln(p.w)
+
+	// Show what the step printed when it did not succeed
+	if err != nil && p.buf.Len() > 0 {
+		(&prefixWriter{w: p.w, prefix: "   ", lineStart: true}).Write(p.buf.Bytes())
+		if !bytes.HasSuffix(p.buf.Bytes(), []byte("\n")) {
+			fmt.Fprintln(p.w)
+		}
+	}
+	p.buf.Reset()
+	p.line = ""
+}
+
+func (p *ttyProgress) output() io.Writer {
+	return ttyOutput{p}
+}
+
+// ttyOutput sends writes to the running step's buffer, or straight to the
+// terminal between steps
+type ttyOutput struct {
+	p *ttyProgress
+}
+
+func (o ttyOutput) Write(data []byte) (int, error) {
+	o.p.mu.Lock()
+	defer o.p.mu.Unlock()
+	if o.p.line != "" {
+		return o.p.buf.Write(data)
+	}
+	return o.p.w.Write(data)
+}
@@ -0,0 +1,91 @@
+package builder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadyProbes lists the supported --ready-probe values:
+//
+//	exec    pct exec must succeed (default)
+//	status  pct status must report running; for hosts where pct exec only
+//	        works some time after the container is up
+//	both    pct status must report running and pct exec must succeed
+var ReadyProbes = []string{"exec", "status", "both"}
+
+// readyTimeout is how long waitForContainer waits for a container
+const readyTimeout = 60 * time.Second
+
+// ValidateReadyProbe checks a readiness probe against the supported list
+func ValidateReadyProbe(probe string) error {
+	if probe == "" {
+		return nil
+	}
+	for _, supported := range ReadyProbes {
+		if probe == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported ready probe '%s', must be one of: %s", probe, strings.Join(ReadyProbes, ", "))
+}
+
+// waitForContainer waits for the container to be ready for commands, as
+// decided by the configured ready probe. On timeout the error says whether
+// the container never reached the running state or was running but could
+// not be reached with pct exec.
+func (b *Builder) waitForContainer(containerID int) error {
+	if b.config.DryRun {
+		return nil
+	}
+
+	probe := b.config.ReadyProbe
+	if probe == "" {
+		probe = "exec"
+	}
+	if err := ValidateReadyProbe(probe); err != nil {
+		return err
+	}
+
+	b.log("Waiting for container %d to be ready...", containerID)
+
+	vmid := strconv.Itoa(containerID)
+	started := false
+	var execErr error
+	for elapsed := time.Duration(0); elapsed < readyTimeout; elapsed += time.Second {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		running := b.containerRunning(vmid)
+		started = started || running
+
+		if probe != "exec" && !running {
+			b.sleep(time.Second)
+			continue
+		}
+		if probe == "status" {
+			return nil
+		}
+
+		if _, execErr = b.output(b.ctx, "pct", "exec", vmid, "--", "true"); execErr == nil {
+			return nil
+		}
+		b.sleep(time.Second)
+	}
+
+	if !started {
+		return fmt.Errorf("container %d never reached the running state within %s", containerID, readyTimeout)
+	}
+	return fmt.Errorf("container %d is running but pct exec failed for %s: %v (try --ready-probe status)", containerID, readyTimeout, execErr)
+}
+
+// containerRunning reports whether pct status shows the container running
+func (b *Builder) containerRunning(vmid string) bool {
+	output, err := b.output(b.ctx, "pct", "status", vmid)
+	if err != nil {
+		return false
+	}
+	status, found := strings.CutPrefix(strings.TrimSpace(string(output)), "status:")
+	return found && strings.TrimSpace(status) == "running"
+}
@@ -0,0 +1,58 @@
+package builder
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// DefaultReclaimCommands free space in the build container when squashing.
+// Each one is a no-op on distributions it does not apply to, so the same
+// list works for Debian, Alpine and RHEL-family templates.
+var DefaultReclaimCommands = []string{
+	"if command -v apt-get >/dev/null 2>&1; then apt-get clean && rm -rf /var/lib/apt/lists/*; fi",
+	"if command -v apk >/dev/null 2>&1; then rm -rf /var/cache/apk/*; fi",
+	"if command -v dnf >/dev/null 2>&1; then dnf clean all; elif command -v yum >/dev/null 2>&1; then yum clean all; fi",
+	"rm -rf /tmp/* /var/tmp/*",
+	"find /var/log -type f -exec truncate -s 0 {} +",
+}
+
+// squash minimizes the finished container before it becomes a template: the
+// reclaim commands remove caches and scratch files the steps left behind,
+// then pct fstrim hands the freed blocks back to thin-provisioned storage.
+// Storage without discard support cannot be trimmed, which only warns.
+func (b *Builder) squash(containerID int, result *BuildResult) error {
+	commands := b.config.ReclaimCommands
+	if len(commands) == 0 {
+		commands = DefaultReclaimCommands
+	}
+
+	b.startStep(len(result.Steps)+1, 1, 1, "squash", "squash")
+	b.log("Squashing container %d: running %d reclaim command(s)", containerID, len(commands))
+	for _, command := range commands {
+		b.logDebug("Reclaim: %s", command)
+		if b.config.DryRun {
+			continue
+		}
+		args := proxmox.ExecArgs(containerID, proxmox.ExecOptions{}, []string{"sh", "-c", command})
+		if err := b.runPCTCommand(args...); err != nil {
+			outcome := StepResult{Name: "squash", Phase: "squash", Status: "failed", Error: err}
+			b.finishStep(outcome)
+			result.Steps = append(result.Steps, outcome)
+			return &BuildError{Step: "squash", ContainerID: containerID, Cause: fmt.Errorf("reclaim command '%s' failed: %w", command, err)}
+		}
+	}
+
+	if b.config.DryRun {
+		b.log("DRY RUN: Would trim container %d with pct fstrim", containerID)
+	} else if err := b.runPCTCommand("fstrim", strconv.Itoa(containerID)); err != nil {
+		b.logWarning("Could not trim container %d (storage may not support discard): %v", containerID, err)
+	}
+
+	outcome := StepResult{Name: "squash", Phase: "squash", Status: "ok"}
+	b.finishStep(outcome)
+	result.Steps = append(result.Steps, outcome)
+	result.ExecutedSteps = append(result.ExecutedSteps, "squash")
+	return nil
+}
@@ -0,0 +1,146 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// artifactKey identifies a path copied out of a stage
+func artifactKey(stage, source string) string {
+	return stage + ":" + source
+}
+
+// stageCopies returns the paths steps copy from each stage, with build args
+// expanded
+func stageCopies(steps []models.SetupStep, buildArgs map[string]string, copies map[string]map[string]bool) {
+	for _, step := range steps {
+		if step.Copy == nil || step.Copy.From == "" {
+			continue
+		}
+		if copies[step.Copy.From] == nil {
+			copies[step.Copy.From] = make(map[string]bool)
+		}
+		copies[step.Copy.From][expandBuildArgs(step.Copy.Source, buildArgs)] = true
+	}
+}
+
+// withArtifacts returns steps with copies from stages turned into copies of
+// the artifacts extracted to the host
+func withArtifacts(steps []models.SetupStep, buildArgs map[string]string, artifacts map[string]string) []models.SetupStep {
+	resolved := make([]models.SetupStep, len(steps))
+	for i, step := range steps {
+		if step.Copy != nil && step.Copy.From != "" {
+			copyStep := *step.Copy
+			copyStep.Source = artifacts[artifactKey(copyStep.From, expandBuildArgs(copyStep.Source, buildArgs))]
+			copyStep.From = ""
+			step.Copy = &copyStep
+		}
+		resolved[i] = step
+	}
+	return resolved
+}
+
+// buildStages builds the stages the given steps copy from, and the stages
+// those copy from, in dependency order, and extracts the paths copied from
+// each into dir on the host. Stages that only cached steps copy from are
+// skipped. Each stage container is removed once its files are extracted. It
+// returns where each path was extracted to, keyed by artifactKey.
+func (b *Builder) buildStages(lxcfile *models.LXCfile, steps []models.SetupStep, buildArgs map[string]string, dir string, result *BuildResult) (map[string]string, error) {
+	order := lxcfile.StageOrder()
+	copies := make(map[string]map[string]bool)
+	stageCopies(steps, buildArgs, copies)
+	// A stage comes after the stages it copies from, so walking the order
+	// backwards finds every stage a needed one copies from
+	for i := len(order) - 1; i >= 0; i-- {
+		if copies[order[i]] != nil {
+			stageCopies(lxcfile.Stages[order[i]].Setup, buildArgs, copies)
+		}
+	}
+
+	artifacts := make(map[string]string)
+	for _, name := range order {
+		if copies[name] == nil {
+			b.log("Skipping stage %s, the steps copying from it are cached", name)
+			continue
+		}
+		if err := b.buildStage(name, lxcfile.Stages[name], buildArgs, copies[name], filepath.Join(dir, name), artifacts, result); err != nil {
+			return nil, err
+		}
+	}
+	return artifacts, nil
+}
+
+// buildStage builds one stage in a temporary container and extracts the
+// given paths from it
+func (b *Builder) buildStage(name string, stage models.Stage, buildArgs map[string]string, paths map[string]bool, dir string, artifacts map[string]string, result *BuildResult) (err error) {
+	containerID, err := b.generateContainerID()
+	if err != nil {
+		return fmt.Errorf("failed to generate container ID: %w", err)
+	}
+	b.log("Building stage %s in container %d", name, containerID)
+
+	created := false
+	defer func() {
+		if !created {
+			return
+		}
+		if err != nil && b.config.KeepOnFailure {
+			b.logWarning("Keeping stage container %d for inspection", containerID)
+			return
+		}
+		if cleanupErr := b.detached().cleanupTempContainer(containerID); cleanupErr != nil {
+			b.logError("Failed to cleanup stage container %d: %v", containerID, cleanupErr)
+		}
+	}()
+
+	if err := b.createTempContainer(containerID, stage.From, models.ResolveOSType(stage.OSType, stage.From)); err != nil {
+		return &BuildError{Step: "create stage " + name, ContainerID: containerID, Cause: err}
+	}
+	created = true
+	if err := b.startContainer(containerID); err != nil {
+		return &BuildError{Step: "start stage " + name, ContainerID: containerID, Cause: err}
+	}
+	if err := b.waitForContainer(containerID); err != nil {
+		return &BuildError{Step: "wait for stage " + name, ContainerID: containerID, Cause: err}
+	}
+
+	// Stage steps are named after their stage, so they stand apart from
+	// the steps of the template in the build output and result
+	steps := withArtifacts(stage.Setup, buildArgs, artifacts)
+	for i := range steps {
+		if steps[i].Name == "" {
+			steps[i].Name = fmt.Sprintf("%s: Step %d", name, i+1)
+		} else {
+			steps[i].Name = name + ": " + steps[i].Name
+		}
+	}
+	if err := b.runSteps(containerID, "stage", steps, 0, buildArgs, result, nil); err != nil {
+		return err
+	}
+
+	sources := make([]string, 0, len(paths))
+	for source := range paths {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for i, source := range sources {
+		target := filepath.Join(dir, strconv.Itoa(i))
+		artifacts[artifactKey(name, source)] = filepath.Join(target, filepath.Base(source))
+		b.log("Copying %s out of stage %s", source, name)
+		if b.config.DryRun {
+			continue
+		}
+		archive := filepath.Join(os.TempDir(), fmt.Sprintf("pxc-stage-%d-%d.tar", containerID, i))
+		steps, cleanup := proxmox.ExtractPlan(containerID, source, target, archive)
+		if err := proxmox.RunCopyPlan(b.runInContext, steps, cleanup); err != nil {
+			return &BuildError{Step: fmt.Sprintf("copy %s from stage %s", source, name), ContainerID: containerID, Cause: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+func TestBuildTemplateStages(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From: "debian-12-standard",
+		Stages: map[string]models.Stage{
+			"deps":  {From: "alpine:3.18", Setup: []models.SetupStep{{Run: "fetch-deps"}}},
+			"build": {From: "golang:1.22", Setup: []models.SetupStep{{Name: "compile", Run: "make"}, {Copy: &models.CopyStep{From: "deps", Source: "/deps", Dest: "/src/deps"}}}},
+			"docs":  {From: "alpine:3.18", Setup: []models.SetupStep{{Run: "make docs"}}},
+		},
+		Setup: []models.SetupStep{
+			{Name: "install", Copy: &models.CopyStep{From: "build", Source: "/src/${APP}", Dest: "/usr/local/bin/app"}},
+		},
+	}
+
+	var commands []string
+	var executed []models.SetupStep
+	b := newTestBuilder(false)
+	b.config.DryRun = false
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	b.output = func(_ context.Context, name string, args ...string) ([]byte, error) { return nil, nil }
+	b.execStep = func(_ context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+		executed = append(executed, step)
+		return nil
+	}
+
+	result, err := b.BuildTemplate(context.Background(), lxcfile, "app", map[string]string{"APP": "server"})
+	if err != nil {
+		t.Fatalf("BuildTemplate() unexpected error: %v", err)
+	}
+
+	// Stages are built in dependency order; docs is not copied from
+	var names []string
+	for _, step := range result.Steps {
+		names = append(names, step.Phase+"/"+step.Name)
+	}
+	want := "stage/deps: Step 1,stage/build: compile,stage/build: Step 2,setup/install"
+	if strings.Join(names, ",") != want {
+		t.Errorf("steps = %v, want %s", names, want)
+	}
+
+	// Each stage container is removed before the template's is created
+	var creates, destroys []string
+	for _, command := range commands {
+		fields := strings.Fields(command)
+		switch {
+		case strings.HasPrefix(command, "pct create "):
+			creates = append(creates, fields[2]+" "+fields[3])
+		case strings.HasPrefix(command, "pct destroy "):
+			destroys = append(destroys, fields[2])
+		}
+	}
+	if len(creates) != 3 || !strings.HasSuffix(creates[0], " alpine:3.18") || !strings.HasSuffix(creates[1], " golang:1.22") || !strings.HasSuffix(creates[2], " debian-12-standard") {
+		t.Fatalf("created containers = %v, want deps, build, then the template", creates)
+	}
+	buildID := strings.Fields(creates[1])[0]
+	if len(destroys) != 2 || destroys[1] != buildID {
+		t.Errorf("destroyed containers = %v, want both stage containers", destroys)
+	}
+
+	pack := fmt.Sprintf("pct exec %s -- tar --numeric-owner -cpf /tmp/pxc-stage-%s-0.tar -C /src server", buildID, buildID)
+	if !strings.Contains(strings.Join(commands, "\n"), pack) {
+		t.Errorf("commands = %q, want %q", commands, pack)
+	}
+
+	// The copies read the files extracted to the host
+	install := executed[len(executed)-1]
+	if install.Copy == nil || install.Copy.From != "" || !strings.HasSuffix(install.Copy.Source, filepath.Join("build", "0", "server")) {
+		t.Errorf("install copy = %+v, want the extracted server binary", install.Copy)
+	}
+	deps := executed[2]
+	if deps.Copy == nil || !strings.HasSuffix(deps.Copy.Source, filepath.Join("deps", "0", "deps")) {
+		t.Errorf("build stage copy = %+v, want the extracted deps", deps.Copy)
+	}
+}
+
+func TestBuildTemplateSkipsCachedStages(t *testing.T) {
+	lxcfile := &models.LXCfile{
+		From: "debian-12-standard",
+		Stages: map[string]models.Stage{
+			"build": {From: "golang:1.22", Setup: []models.SetupStep{{Run: "make"}}},
+		},
+		Setup: []models.SetupStep{
+			{Name: "install", Copy: &models.CopyStep{From: "build", Source: "/src/app", Dest: "/usr/local/bin/app"}},
+			{Name: "configure", Run: "app --init"},
+		},
+	}
+	keys := stepCacheKeys(lxcfile, nil, stageCacheKeys(lxcfile, nil))
+
+	var commands, executed []string
+	b := newTestBuilder(false)
+	b.config.DryRun = false
+	b.run = func(_ context.Context, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	b.output = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		if args[0] == "listsnapshot" {
+			return []byte(fmt.Sprintf("`-> %s 2024-05-01 12:00:00 no-description\n", keys[0])), nil
+		}
+		return nil, nil
+	}
+	b.execStep = func(_ context.Context, containerID int, step models.SetupStep, stepName string, buildArgs map[string]string) error {
+		executed = append(executed, stepName)
+		return nil
+	}
+
+	if _, err := b.BuildTemplateWithCache(context.Background(), lxcfile, "app", nil, CacheOptions{From: []string{"9000"}}); err != nil {
+		t.Fatalf("BuildTemplateWithCache() unexpected error: %v", err)
+	}
+	if strings.Join(executed, ",") != "configure" {
+		t.Errorf("executed steps = %v, want only configure", executed)
+	}
+	for _, command := range commands {
+		if strings.Contains(command, "golang:1.22") {
+			t.Errorf("command %q built the stage that only a cached step copies from", command)
+		}
+	}
+
+	// A changed stage invalidates the steps copying from it
+	changed := *lxcfile
+	changed.Stages = map[string]models.Stage{
+		"build": {From: "golang:1.22", Setup: []models.SetupStep{{Run: "make release"}}},
+	}
+	if changedKeys := stepCacheKeys(&changed, nil, stageCacheKeys(&changed, nil)); changedKeys[0] == keys[0] {
+		t.Error("stepCacheKeys() did not change with the stage's steps")
+	}
+}
@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckTemplateStorage verifies that the configured template storage accepts
+// container templates (content type vztmpl), so a misconfigured
+// template_storage fails with guidance instead of a vzdump error at the end
+// of the build. The check runs once per builder.
+func (b *Builder) CheckTemplateStorage() error {
+	if b.templateStorageChecked || b.config.DryRun {
+		return nil
+	}
+
+	storage := b.config.TemplateStorage
+	output, err := b.output(b.ctx, "pvesm", "status", "--content", "vztmpl")
+	if err != nil {
+		return fmt.Errorf("failed to check template storage '%s': %w", storage, err)
+	}
+	if !storageListed(string(output), storage) {
+		return fmt.Errorf("template storage '%s' does not support container templates (content type vztmpl); "+
+			"set template_storage in the config file to a storage that does (see 'pvesm status --content vztmpl') "+
+			"or add vztmpl to the content types of '%s'", storage, storage)
+	}
+
+	b.templateStorageChecked = true
+	return nil
+}
+
+// storageListed reports whether pvesm status output (Name Type Status ...)
+// has a row for storage
+func storageListed(output, storage string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == storage {
+			return true
+		}
+	}
+	return false
+}
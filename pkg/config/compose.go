@@ -0,0 +1,696 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// composeFileNames are the file names of Compose files, which are converted
+// to a stack when loaded
+var composeFileNames = map[string]bool{
+	"docker-compose.yml":  true,
+	"docker-compose.yaml": true,
+	"compose.yml":         true,
+	"compose.yaml":        true,
+}
+
+// IsComposeFile reports whether filename is a Compose file rather than a
+// stack file, judged by its name
+func IsComposeFile(filename string) bool {
+	return composeFileNames[filepath.Base(filename)]
+}
+
+// composeFile is the part of the Compose file format that maps onto a stack
+type composeFile struct {
+	Name     string                     `yaml:"name"`
+	Services map[string]composeService  `yaml:"services"`
+	Volumes  map[string]*composeVolume  `yaml:"volumes"`
+	Networks map[string]*composeNetwork `yaml:"networks"`
+	Secrets  map[string]*composeFileRef `yaml:"secrets"`
+	Configs  map[string]*composeFileRef `yaml:"configs"`
+	Other    map[string]interface{}     `yaml:",inline"`
+}
+
+// composeService is a Compose service. Fields with a short and a long
+// syntax are kept as nodes and decoded by the converter.
+type composeService struct {
+	Image         string                 `yaml:"image"`
+	Build         yaml.Node              `yaml:"build"`
+	ContainerName string                 `yaml:"container_name"`
+	Hostname      string                 `yaml:"hostname"`
+	Environment   yaml.Node              `yaml:"environment"`
+	Ports         []yaml.Node            `yaml:"ports"`
+	Expose        []string               `yaml:"expose"`
+	Volumes       []yaml.Node            `yaml:"volumes"`
+	DependsOn     yaml.Node              `yaml:"depends_on"`
+	Healthcheck   *composeHealthcheck    `yaml:"healthcheck"`
+	Restart       string                 `yaml:"restart"`
+	Deploy        *models.Deploy         `yaml:"deploy"`
+	Networks      yaml.Node              `yaml:"networks"`
+	Labels        yaml.Node              `yaml:"labels"`
+	Secrets       []yaml.Node            `yaml:"secrets"`
+	Configs       []yaml.Node            `yaml:"configs"`
+	Pid           string                 `yaml:"pid"`
+	ShmSize       string                 `yaml:"shm_size"`
+	DNS           yaml.Node              `yaml:"dns"`
+	DNSSearch     yaml.Node              `yaml:"dns_search"`
+	Scale         int                    `yaml:"scale"`
+	Other         map[string]interface{} `yaml:",inline"`
+}
+
+// composeHealthcheck is a Compose healthcheck; test is a string or a
+// CMD, CMD-SHELL or NONE list
+type composeHealthcheck struct {
+	Test        yaml.Node `yaml:"test"`
+	Interval    string    `yaml:"interval"`
+	Timeout     string    `yaml:"timeout"`
+	Retries     int       `yaml:"retries"`
+	StartPeriod string    `yaml:"start_period"`
+	Disable     bool      `yaml:"disable"`
+}
+
+type composeVolume struct {
+	Driver     string                 `yaml:"driver"`
+	DriverOpts map[string]string      `yaml:"driver_opts"`
+	External   bool                   `yaml:"external"`
+	Other      map[string]interface{} `yaml:",inline"`
+}
+
+type composeNetwork struct {
+	Driver     string            `yaml:"driver"`
+	DriverOpts map[string]string `yaml:"driver_opts"`
+	Name       string            `yaml:"name"`
+	Internal   bool              `yaml:"internal"`
+	External   bool              `yaml:"external"`
+	IPAM       *struct {
+		Config []struct {
+			Subnet  string `yaml:"subnet"`
+			Gateway string `yaml:"gateway"`
+		} `yaml:"config"`
+	} `yaml:"ipam"`
+	Other map[string]interface{} `yaml:",inline"`
+}
+
+// composeFileRef is a top-level Compose secret or config
+type composeFileRef struct {
+	File        string                 `yaml:"file"`
+	Environment string                 `yaml:"environment"`
+	External    bool                   `yaml:"external"`
+	Name        string                 `yaml:"name"`
+	Other       map[string]interface{} `yaml:",inline"`
+}
+
+// LoadCompose reads a Compose file and converts it to a stack. ${VAR}
+// references are kept as they are, to be substituted when the stack is
+// loaded. The warnings name the Compose settings that have no equivalent
+// and were left out.
+func LoadCompose(filename string) (*models.LXCStack, []models.LintWarning, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse compose YAML: %w", err)
+	}
+	return ConvertCompose(&root)
+}
+
+// ConvertCompose converts a parsed Compose file to a stack: image becomes
+// template, healthcheck becomes health, and the short and long syntaxes of
+// ports, volumes, environment and the like become their stack forms
+func ConvertCompose(root *yaml.Node) (*models.LXCStack, []models.LintWarning, error) {
+	return convertCompose(root, nil)
+}
+
+// convertCompose is ConvertCompose resolving the environment variables a
+// service lists without a value with lookupEnv, leaving out those it does
+// not find as Compose does. Without lookupEnv they become ${VAR} references.
+func convertCompose(root *yaml.Node, lookupEnv func(string) (string, bool)) (*models.LXCStack, []models.LintWarning, error) {
+	var compose composeFile
+	if root.Kind != 0 {
+		if err := root.Decode(&compose); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse compose YAML: %w", err)
+		}
+	}
+
+	c := &composeConverter{lookupEnv: lookupEnv}
+	stack := &models.LXCStack{
+		Version:  "1.0",
+		Services: make(map[string]models.Service, len(compose.Services)),
+	}
+	if compose.Name != "" {
+		stack.Metadata = &models.Metadata{Name: compose.Name}
+	}
+	for _, key := range sortedKeys(compose.Other) {
+		if key != "version" && !strings.HasPrefix(key, "x-") {
+			c.warn(key, "'%s' is not supported and was left out", key)
+		}
+	}
+
+	for _, name := range sortedKeys(compose.Services) {
+		service, err := c.convertService(name, compose.Services[name])
+		if err != nil {
+			return nil, nil, fmt.Errorf("service '%s': %w", name, err)
+		}
+		stack.Services[name] = service
+	}
+
+	if len(compose.Volumes) > 0 {
+		stack.Volumes = make(map[string]models.Volume, len(compose.Volumes))
+		for _, name := range sortedKeys(compose.Volumes) {
+			stack.Volumes[name] = c.convertVolume(name, compose.Volumes[name])
+		}
+	}
+	if len(compose.Networks) > 0 {
+		stack.Networks = make(map[string]models.Network, len(compose.Networks))
+		for _, name := range sortedKeys(compose.Networks) {
+			stack.Networks[name] = c.convertNetwork(name, compose.Networks[name])
+		}
+	}
+	if len(compose.Secrets) > 0 {
+		stack.Secrets = make(map[string]models.Secret, len(compose.Secrets))
+		for _, name := range sortedKeys(compose.Secrets) {
+			secret := compose.Secrets[name]
+			if secret == nil {
+				secret = &composeFileRef{}
+			}
+			c.warnOther("secrets."+name, secret.Other)
+			stack.Secrets[name] = models.Secret{File: secret.File, Environment: secret.Environment, External: secret.External, Name: secret.Name}
+		}
+	}
+	if len(compose.Configs) > 0 {
+		stack.Configs = make(map[string]models.Config, len(compose.Configs))
+		for _, name := range sortedKeys(compose.Configs) {
+			config := compose.Configs[name]
+			if config == nil {
+				config = &composeFileRef{}
+			}
+			if config.External || config.Environment != "" {
+				c.warn("configs."+name, "only file configs are supported; set file")
+			}
+			c.warnOther("configs."+name, config.Other)
+			stack.Configs[name] = models.Config{File: config.File}
+		}
+	}
+
+	return stack, c.warnings, nil
+}
+
+// composeConverter collects the warnings of a conversion
+type composeConverter struct {
+	warnings  []models.LintWarning
+	lookupEnv func(string) (string, bool)
+}
+
+func (c *composeConverter) warn(path, format string, args ...interface{}) {
+	c.warnings = append(c.warnings, models.LintWarning{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// warnOther warns about each Compose key under path that the converter
+// does not know
+// passThrough returns the value of an environment variable listed without
+// one, and whether it is set
+func (c *composeConverter) passThrough(key string) (string, bool) {
+	if c.lookupEnv == nil {
+		return "${" + key + "}", true
+	}
+	return c.lookupEnv(key)
+}
+
+func (c *composeConverter) warnOther(path string, other map[string]interface{}) {
+	for _, key := range sortedKeys(other) {
+		if !strings.HasPrefix(key, "x-") {
+			c.warn(path+"."+key, "'%s' is not supported and was left out", key)
+		}
+	}
+}
+
+func (c *composeConverter) convertService(name string, compose composeService) (models.Service, error) {
+	path := "services." + name
+	service := models.Service{
+		Template: compose.Image,
+		Hostname: compose.Hostname,
+		Expose:   compose.Expose,
+		Restart:  compose.Restart,
+		Deploy:   compose.Deploy,
+		Pid:      compose.Pid,
+		ShmSize:  compose.ShmSize,
+		Scale:    compose.Scale,
+	}
+	c.warnOther(path, compose.Other)
+
+	if service.Hostname == "" {
+		service.Hostname = compose.ContainerName
+	}
+	if strings.HasPrefix(compose.Restart, "on-failure:") {
+		attempts, err := strconv.Atoi(strings.TrimPrefix(compose.Restart, "on-failure:"))
+		if err != nil {
+			return service, fmt.Errorf("invalid restart '%s'", compose.Restart)
+		}
+		service.Restart = "on-failure"
+		service.RestartPolicy = &models.RestartPolicy{MaxAttempts: attempts}
+	}
+
+	var err error
+	if service.Build, err = c.convertBuild(path, &compose.Build); err != nil {
+		return service, err
+	}
+	if service.Environment, err = decodeKeyValues(&compose.Environment, c.passThrough); err != nil {
+		return service, fmt.Errorf("environment: %w", err)
+	}
+	if service.Labels, err = decodeKeyValues(&compose.Labels, nil); err != nil {
+		return service, fmt.Errorf("labels: %w", err)
+	}
+	for i := range compose.Ports {
+		port, err := convertPort(&compose.Ports[i])
+		if err != nil {
+			return service, err
+		}
+		service.Ports = append(service.Ports, port)
+	}
+	for i := range compose.Volumes {
+		volume, err := c.convertVolumeMount(fmt.Sprintf("%s.volumes[%d]", path, i), &compose.Volumes[i])
+		if err != nil {
+			return service, err
+		}
+		if volume != "" {
+			service.Volumes = append(service.Volumes, volume)
+		}
+	}
+	if err := c.convertDependsOn(path, &compose.DependsOn, &service); err != nil {
+		return service, err
+	}
+	if service.Networks, err = decodeNames(&compose.Networks); err != nil {
+		return service, fmt.Errorf("networks: %w", err)
+	}
+	if compose.Networks.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(compose.Networks.Content); i += 2 {
+			if options := compose.Networks.Content[i+1]; options.Kind == yaml.MappingNode && len(options.Content) > 0 {
+				network := compose.Networks.Content[i].Value
+				c.warn(path+".networks."+network, "options of network '%s' such as aliases are not supported and were left out", network)
+			}
+		}
+	}
+	if service.DNS, err = decodeStrings(&compose.DNS); err != nil {
+		return service, fmt.Errorf("dns: %w", err)
+	}
+	if service.DNSSearch, err = decodeStrings(&compose.DNSSearch); err != nil {
+		return service, fmt.Errorf("dns_search: %w", err)
+	}
+	if service.Secrets, service.SecretMounts, err = c.convertFileRefs(path+".secrets", compose.Secrets); err != nil {
+		return service, fmt.Errorf("secrets: %w", err)
+	}
+	var configMounts map[string]models.FileMount
+	if service.Configs, configMounts, err = c.convertFileRefs(path+".configs", compose.Configs); err != nil {
+		return service, fmt.Errorf("configs: %w", err)
+	}
+	for _, name := range sortedKeys(configMounts) {
+		c.warn(path+".configs", "target, uid, gid and mode of config '%s' are not supported here; set target, user, group and mode on the config", name)
+	}
+	if compose.Healthcheck != nil {
+		if service.Health, err = convertHealthcheck(compose.Healthcheck); err != nil {
+			return service, fmt.Errorf("healthcheck: %w", err)
+		}
+	}
+
+	return service, nil
+}
+
+// convertBuild maps a Compose build onto a stack build. proxer builds from
+// the LXCfile in the context, so a Dockerfile name is left out.
+func (c *composeConverter) convertBuild(path string, node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.ScalarNode:
+		return node.Value, nil
+	}
+
+	var build struct {
+		Context    string                 `yaml:"context"`
+		Dockerfile string                 `yaml:"dockerfile"`
+		Args       yaml.Node              `yaml:"args"`
+		Target     string                 `yaml:"target"`
+		Other      map[string]interface{} `yaml:",inline"`
+	}
+	if err := node.Decode(&build); err != nil {
+		return nil, fmt.Errorf("build: %w", err)
+	}
+	if build.Dockerfile != "" {
+		c.warn(path+".build.dockerfile", "dockerfile '%s' was left out; proxer builds from the LXCfile.yml in the build context", build.Dockerfile)
+	}
+	c.warnOther(path+".build", build.Other)
+
+	converted := map[string]interface{}{"context": build.Context}
+	if build.Context == "" {
+		converted["context"] = "."
+	}
+	args, err := decodeKeyValues(&build.Args, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build args: %w", err)
+	}
+	if len(args) > 0 {
+		converted["args"] = args
+	}
+	if build.Target != "" {
+		converted["target"] = build.Target
+	}
+	return converted, nil
+}
+
+// convertPort turns a Compose port, a number, a short syntax string or the
+// long syntax, into a stack ports entry
+func convertPort(node *yaml.Node) (string, error) {
+	if node.Kind == yaml.ScalarNode {
+		if _, err := models.ParsePortMapping(node.Value); err != nil {
+			return "", err
+		}
+		return node.Value, nil
+	}
+
+	var port struct {
+		Target    int       `yaml:"target"`
+		Published yaml.Node `yaml:"published"`
+		HostIP    string    `yaml:"host_ip"`
+		Protocol  string    `yaml:"protocol"`
+	}
+	if err := node.Decode(&port); err != nil {
+		return "", fmt.Errorf("ports: %w", err)
+	}
+	spec := strconv.Itoa(port.Target)
+	if port.Published.Value != "" {
+		spec = port.Published.Value + ":" + spec
+		if port.HostIP != "" {
+			spec = port.HostIP + ":" + spec
+		}
+	}
+	if port.Protocol != "" && port.Protocol != "tcp" {
+		spec += "/" + port.Protocol
+	}
+	if _, err := models.ParsePortMapping(spec); err != nil {
+		return "", err
+	}
+	return spec, nil
+}
+
+// convertVolumeMount turns a Compose volume, short or long syntax, into a
+// stack volumes entry. tmpfs mounts have no equivalent and yield "".
+func (c *composeConverter) convertVolumeMount(path string, node *yaml.Node) (string, error) {
+	if node.Kind == yaml.ScalarNode {
+		return node.Value, nil
+	}
+
+	var volume struct {
+		Type     string                 `yaml:"type"`
+		Source   string                 `yaml:"source"`
+		Target   string                 `yaml:"target"`
+		ReadOnly bool                   `yaml:"read_only"`
+		Other    map[string]interface{} `yaml:",inline"`
+	}
+	if err := node.Decode(&volume); err != nil {
+		return "", fmt.Errorf("volumes: %w", err)
+	}
+	if volume.Type == "tmpfs" || volume.Type == "npipe" {
+		c.warn(path, "%s mount at %s is not supported and was left out", volume.Type, volume.Target)
+		return "", nil
+	}
+	c.warnOther(path, volume.Other)
+
+	spec := volume.Target
+	if volume.Source != "" {
+		spec = volume.Source + ":" + spec
+	}
+	if volume.ReadOnly {
+		spec += ":ro"
+	}
+	return spec, nil
+}
+
+// convertDependsOn copies a Compose depends_on, a list or a map with
+// conditions, onto a service
+func (c *composeConverter) convertDependsOn(path string, node *yaml.Node, service *models.Service) error {
+	if node.Kind != yaml.MappingNode {
+		names, err := decodeStrings(node)
+		if err != nil {
+			return fmt.Errorf("depends_on: %w", err)
+		}
+		service.DependsOn = names
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+		var dependency struct {
+			Condition string `yaml:"condition"`
+		}
+		if err := node.Content[i+1].Decode(&dependency); err != nil {
+			return fmt.Errorf("depends_on %s: %w", name, err)
+		}
+		service.DependsOn = append(service.DependsOn, name)
+
+		switch dependency.Condition {
+		case "", models.ConditionServiceStarted:
+		case models.ConditionServiceHealthy:
+			if service.DependsOnConditions == nil {
+				service.DependsOnConditions = make(map[string]string)
+			}
+			service.DependsOnConditions[name] = dependency.Condition
+		default:
+			c.warn(path+".depends_on."+name, "condition '%s' is not supported; %s waits for %s to start", dependency.Condition, strings.TrimPrefix(path, "services."), name)
+		}
+	}
+	return nil
+}
+
+// convertFileRefs turns the secrets or configs of a Compose service, names
+// or {source: ...} objects, into names and the mounts of the objects that
+// set a target, owner or mode
+func (c *composeConverter) convertFileRefs(path string, nodes []yaml.Node) ([]string, map[string]models.FileMount, error) {
+	var names []string
+	var mounts map[string]models.FileMount
+	for i := range nodes {
+		if nodes[i].Kind == yaml.ScalarNode {
+			names = append(names, nodes[i].Value)
+			continue
+		}
+		var ref struct {
+			Source           string `yaml:"source"`
+			models.FileMount `yaml:",inline"`
+			Other            map[string]interface{} `yaml:",inline"`
+		}
+		if err := nodes[i].Decode(&ref); err != nil {
+			return nil, nil, err
+		}
+		c.warnOther(fmt.Sprintf("%s[%d]", path, i), ref.Other)
+		names = append(names, ref.Source)
+		if ref.FileMount != (models.FileMount{}) {
+			if mounts == nil {
+				mounts = make(map[string]models.FileMount)
+			}
+			mounts[ref.Source] = ref.FileMount
+		}
+	}
+	return names, mounts, nil
+}
+
+// convertHealthcheck turns a Compose healthcheck into a health check run
+// in the container; a disabled one yields nil
+func convertHealthcheck(compose *composeHealthcheck) (*models.HealthCheck, error) {
+	if compose.Disable {
+		return nil, nil
+	}
+
+	health := &models.HealthCheck{Retries: compose.Retries}
+	switch compose.Test.Kind {
+	case yaml.ScalarNode:
+		health.Test = compose.Test.Value
+	case yaml.SequenceNode:
+		var test []string
+		if err := compose.Test.Decode(&test); err != nil {
+			return nil, err
+		}
+		if len(test) == 0 {
+			return nil, fmt.Errorf("test is empty")
+		}
+		switch test[0] {
+		case "NONE":
+			return nil, nil
+		case "CMD":
+			health.Test = shellJoin(test[1:])
+		case "CMD-SHELL":
+			health.Test = strings.Join(test[1:], " ")
+		default:
+			return nil, fmt.Errorf("test must start with CMD, CMD-SHELL or NONE, got '%s'", test[0])
+		}
+	default:
+		return nil, fmt.Errorf("test is missing")
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"interval", compose.Interval, &health.Interval},
+		{"timeout", compose.Timeout, &health.Timeout},
+		{"start_period", compose.StartPeriod, &health.StartPeriod},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s'", duration.name, duration.value)
+		}
+		*duration.field = parsed
+	}
+	return health, nil
+}
+
+// shellJoin quotes the arguments of a CMD health test so sh -c runs them
+// as given
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (c *composeConverter) convertVolume(name string, compose *composeVolume) models.Volume {
+	path := "volumes." + name
+	if compose == nil {
+		return models.Volume{}
+	}
+	c.warnOther(path, compose.Other)
+	if compose.External {
+		c.warn(path+".external", "external volumes are not supported; %s is created like any other volume", name)
+	}
+	if compose.Driver != "" && compose.Driver != "local" {
+		c.warn(path+".driver", "driver '%s' is not supported; use local, zfs or nfs", compose.Driver)
+	}
+	if len(compose.DriverOpts) > 0 {
+		c.warn(path+".driver_opts", "driver_opts were left out; set the options of the local, zfs or nfs driver instead")
+	}
+	return models.Volume{}
+}
+
+func (c *composeConverter) convertNetwork(name string, compose *composeNetwork) models.Network {
+	path := "networks." + name
+	if compose == nil {
+		return models.Network{}
+	}
+	c.warnOther(path, compose.Other)
+	if compose.External {
+		c.warn(path+".external", "external networks are not supported; %s is created like any other network", name)
+	}
+
+	network := models.Network{
+		Driver:   compose.Driver,
+		Name:     compose.Name,
+		Internal: compose.Internal,
+		Options:  compose.DriverOpts,
+	}
+	if compose.IPAM != nil && len(compose.IPAM.Config) > 0 {
+		network.Subnet = compose.IPAM.Config[0].Subnet
+		network.Gateway = compose.IPAM.Config[0].Gateway
+		if len(compose.IPAM.Config) > 1 {
+			c.warn(path+".ipam.config", "only the first subnet of %s was kept", name)
+		}
+	}
+	return network
+}
+
+// decodeKeyValues decodes a map or a list of KEY=VALUE strings. With
+// passThrough, an entry without a value refers to the variable of the same
+// name, as in Compose, and takes the value passThrough gives it, if any.
+func decodeKeyValues(node *yaml.Node, passThrough func(string) (string, bool)) (map[string]string, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.MappingNode:
+		values := make(map[string]string, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			if value.Tag != "!!null" {
+				values[key] = value.Value
+			} else if passThrough != nil {
+				if passed, set := passThrough(key); set {
+					values[key] = passed
+				}
+			}
+		}
+		return values, nil
+	}
+
+	var entries []string
+	if err := node.Decode(&entries); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, value, found := strings.Cut(entry, "=")
+		switch {
+		case found:
+			values[key] = value
+		case passThrough != nil:
+			if passed, set := passThrough(key); set {
+				values[key] = passed
+			}
+		default:
+			values[key] = ""
+		}
+	}
+	return values, nil
+}
+
+// decodeNames decodes a list of names or a map keyed by them, in order
+func decodeNames(node *yaml.Node) ([]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return decodeStrings(node)
+	}
+	var names []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		names = append(names, node.Content[i].Value)
+	}
+	return names, nil
+}
+
+// decodeStrings decodes a string or a list of strings
+func decodeStrings(node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	}
+	var values []string
+	err := node.Decode(&values)
+	return values, err
+}
+
+// sortedKeys returns the keys of a map in order, so conversions are
+// reported the same way every time
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
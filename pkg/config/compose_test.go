@@ -0,0 +1,289 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+const composeFixture = `version: "3.8"
+name: shop
+services:
+  web:
+    build:
+      context: ./web
+      dockerfile: Dockerfile.prod
+      args:
+        - VERSION=1.2
+    container_name: shop-web
+    command: ["npm", "start"]
+    ports:
+      - "8080:80"
+      - target: 443
+        published: 8443
+      - 53/udp
+    environment:
+      - NODE_ENV=production
+      - API_KEY
+    depends_on:
+      db:
+        condition: service_healthy
+    networks: [front, back]
+    restart: on-failure:5
+    volumes:
+      - ./static:/srv/static:ro
+      - type: volume
+        source: cache
+        target: /var/cache/app
+        read_only: true
+      - type: tmpfs
+        target: /tmp
+  db:
+    image: postgres:15
+    environment:
+      POSTGRES_DB: shop
+    labels:
+      - tier=data
+    healthcheck:
+      test: ["CMD", "pg_isready", "-U", "my user"]
+      interval: 10s
+      timeout: 5s
+      retries: 5
+      start_period: 30s
+    networks:
+      back:
+        aliases: [database]
+volumes:
+  cache:
+networks:
+  front:
+  back:
+    ipam:
+      config:
+        - subnet: 10.10.0.0/24
+          gateway: 10.10.0.1
+`
+
+func TestConvertCompose(t *testing.T) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(composeFixture), &root); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+
+	stack, warnings, err := ConvertCompose(&root)
+	if err != nil {
+		t.Fatalf("ConvertCompose() unexpected error: %v", err)
+	}
+	if stack.Version != "1.0" || stack.Metadata == nil || stack.Metadata.Name != "shop" {
+		t.Errorf("version/metadata = %q %+v", stack.Version, stack.Metadata)
+	}
+
+	web := stack.Services["web"]
+	if build, ok := web.Build.(map[string]interface{}); !ok || build["context"] != "./web" || build["dockerfile"] != nil {
+		t.Errorf("web build = %#v, want context ./web without dockerfile", web.Build)
+	}
+	if web.Hostname != "shop-web" {
+		t.Errorf("web hostname = %q, want container_name", web.Hostname)
+	}
+	if strings.Join(web.Ports, ",") != "8080:80,8443:443,53/udp" {
+		t.Errorf("web ports = %v", web.Ports)
+	}
+	if web.Environment["NODE_ENV"] != "production" || web.Environment["API_KEY"] != "${API_KEY}" {
+		t.Errorf("web environment = %v", web.Environment)
+	}
+	if web.DependencyCondition("db") != models.ConditionServiceHealthy {
+		t.Errorf("web depends_on = %v %v", web.DependsOn, web.DependsOnConditions)
+	}
+	if web.Restart != "on-failure" || web.RestartPolicy == nil || web.RestartPolicy.MaxAttempts != 5 {
+		t.Errorf("web restart = %q %+v", web.Restart, web.RestartPolicy)
+	}
+	if strings.Join(web.Volumes, ",") != "./static:/srv/static:ro,cache:/var/cache/app:ro" {
+		t.Errorf("web volumes = %v", web.Volumes)
+	}
+	if strings.Join(web.Networks, ",") != "front,back" {
+		t.Errorf("web networks = %v", web.Networks)
+	}
+
+	db := stack.Services["db"]
+	wantHealth := models.HealthCheck{Test: "pg_isready -U 'my user'", Interval: 10 * time.Second, Timeout: 5 * time.Second, Retries: 5, StartPeriod: 30 * time.Second}
+	if db.Template != "postgres:15" || db.Health == nil || *db.Health != wantHealth {
+		t.Errorf("db template = %q, health = %+v", db.Template, db.Health)
+	}
+	if db.Labels["tier"] != "data" || strings.Join(db.Networks, ",") != "back" {
+		t.Errorf("db labels = %v, networks = %v", db.Labels, db.Networks)
+	}
+
+	if network := stack.Networks["back"]; network.Subnet != "10.10.0.0/24" || network.Gateway != "10.10.0.1" {
+		t.Errorf("back network = %+v", network)
+	}
+	if _, exists := stack.Volumes["cache"]; !exists {
+		t.Errorf("volumes = %v, want cache", stack.Volumes)
+	}
+
+	var paths []string
+	for _, warning := range warnings {
+		paths = append(paths, warning.Path)
+	}
+	want := "services.db.networks.back,services.web.command,services.web.build.dockerfile,services.web.volumes[2]"
+	if strings.Join(paths, ",") != want {
+		t.Errorf("warnings at %v, want %s", paths, want)
+	}
+}
+
+func TestConvertComposeSecrets(t *testing.T) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(`services:
+  db:
+    image: postgres:15
+    secrets:
+      - api_key
+      - source: db_password
+        target: postgres_password
+        uid: "999"
+        mode: 0440
+secrets:
+  api_key:
+    environment: API_KEY
+  db_password:
+    file: ./db_password.txt
+`), &root); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+
+	stack, warnings, err := ConvertCompose(&root)
+	if err != nil {
+		t.Fatalf("ConvertCompose() unexpected error: %v", err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+	if secret := stack.Secrets["api_key"]; secret.Environment != "API_KEY" {
+		t.Errorf("api_key = %+v, want environment API_KEY", secret)
+	}
+	db := stack.Services["db"]
+	if strings.Join(db.Secrets, ",") != "api_key,db_password" {
+		t.Errorf("db secrets = %v", db.Secrets)
+	}
+	want := models.FileMount{Target: "postgres_password", UID: "999", Mode: 0440}
+	if mount := db.SecretMounts["db_password"]; mount != want {
+		t.Errorf("db_password mount = %+v, want %+v", mount, want)
+	}
+	if len(db.SecretMounts) != 1 {
+		t.Errorf("db secret mounts = %v, want db_password only", db.SecretMounts)
+	}
+}
+
+func TestConvertComposeHealthcheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		check    string
+		wantTest string
+		wantNil  bool
+		wantErr  bool
+	}{
+		{name: "string", check: `test: "curl -f http://localhost"`, wantTest: "curl -f http://localhost"},
+		{name: "cmd-shell", check: `test: ["CMD-SHELL", "redis-cli ping || exit 1"]`, wantTest: "redis-cli ping || exit 1"},
+		{name: "none", check: `test: ["NONE"]`, wantNil: true},
+		{name: "disabled", check: `disable: true`, wantNil: true},
+		{name: "bad form", check: `test: ["RUN", "true"]`, wantErr: true},
+		{name: "bad interval", check: "test: \"true\"\ninterval: often", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var check composeHealthcheck
+			if err := yaml.Unmarshal([]byte(tt.check), &check); err != nil {
+				t.Fatalf("Unmarshal() unexpected error: %v", err)
+			}
+			health, err := convertHealthcheck(&check)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertHealthcheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantNil != (health == nil) {
+				t.Fatalf("convertHealthcheck() = %+v, want nil %v", health, tt.wantNil)
+			}
+			if health != nil && health.Test != tt.wantTest {
+				t.Errorf("test = %q, want %q", health.Test, tt.wantTest)
+			}
+		})
+	}
+}
+
+func TestLoadLXCStackCompose(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker-compose.yml")
+	content := `services:
+  db:
+    image: postgres:15
+    environment:
+      POSTGRES_PASSWORD: ${COMPOSE_TEST_PASSWORD}
+    volumes:
+      - ./data:/var/lib/postgresql/data
+    deploy:
+      replicas: 2
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+	t.Setenv("COMPOSE_TEST_PASSWORD", "secret")
+
+	stack, err := LoadLXCStack(path)
+	if err != nil {
+		t.Fatalf("LoadLXCStack() unexpected error: %v", err)
+	}
+	db := stack.Services["db"]
+	if db.Template != "postgres:15" || db.Environment["POSTGRES_PASSWORD"] != "secret" || db.Scale != 2 {
+		t.Errorf("db = %+v", db)
+	}
+	if want := filepath.Join(dir, "data") + ":/var/lib/postgresql/data"; len(db.Volumes) != 1 || db.Volumes[0] != want {
+		t.Errorf("db volumes = %v, want %s", db.Volumes, want)
+	}
+	if err := stack.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+}
+
+func TestLoadLXCStackComposePassThrough(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker-compose.yml")
+	content := `services:
+  web:
+    image: nginx
+    environment:
+      - COMPOSE_TEST_TOKEN
+      - COMPOSE_TEST_UNSET
+      - LITERAL=$${COMPOSE_TEST_TOKEN}
+  api:
+    image: nginx
+    environment:
+      COMPOSE_TEST_TOKEN:
+      COMPOSE_TEST_UNSET:
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+	t.Setenv("COMPOSE_TEST_TOKEN", "t0ken")
+
+	stack, err := LoadLXCStack(path)
+	if err != nil {
+		t.Fatalf("LoadLXCStack() unexpected error: %v", err)
+	}
+	want := map[string]string{"COMPOSE_TEST_TOKEN": "t0ken", "LITERAL": "${COMPOSE_TEST_TOKEN}"}
+	if got := stack.Services["web"].Environment; !reflect.DeepEqual(got, want) {
+		t.Errorf("web environment = %v, want %v", got, want)
+	}
+	want = map[string]string{"COMPOSE_TEST_TOKEN": "t0ken"}
+	if got := stack.Services["api"].Environment; !reflect.DeepEqual(got, want) {
+		t.Errorf("api environment = %v, want %v", got, want)
+	}
+}
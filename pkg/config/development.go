@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// DevelopmentFile returns the development override file of a stack file,
+// e.g. lxc-stack.dev.yml next to lxc-stack.yml, or "" if there is none
+func DevelopmentFile(stackFile string) string {
+	ext := filepath.Ext(stackFile)
+	path := strings.TrimSuffix(stackFile, ext) + ".dev" + ext
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// LoadDevelopmentStack loads a stack like LoadLXCStack with its development
+// overrides applied (see LXCStack.ApplyDevelopment). The services and
+// extra_services of the stack's development file (see DevelopmentFile) are
+// merged over those of its development section. The source directories the
+// LXCfile of a built service copies in are bind-mounted over their copies,
+// so edits on the host show in the container without a rebuild.
+func LoadDevelopmentStack(filename string) (*models.LXCStack, error) {
+	stack, err := loadStack(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	if path := DevelopmentFile(filename); path != "" {
+		if err := mergeDevelopmentFile(stack, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := stack.ApplyDevelopment(); err != nil {
+		return nil, err
+	}
+	if err := mountSources(stack); err != nil {
+		return nil, err
+	}
+	return expandStack(stack)
+}
+
+// mergeDevelopmentFile merges a development file, holding services and
+// extra_services like the development section, into the stack's section
+func mergeDevelopmentFile(stack *models.LXCStack, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read development file: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("failed to parse development file %s: %w", path, err)
+	}
+	if err := interpolateNode(&root, envMissing); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var development models.Development
+	if root.Kind != 0 {
+		if err := root.Decode(&development); err != nil {
+			return fmt.Errorf("failed to parse development file %s: %w", path, err)
+		}
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve development file path: %w", err)
+	}
+	baseDir := filepath.Dir(absPath)
+	resolveServicePaths(development.Services, baseDir)
+	resolveServicePaths(development.ExtraServices, baseDir)
+
+	if stack.Development == nil {
+		stack.Development = &models.Development{}
+	}
+	merged := stack.Development
+	for name, service := range development.Services {
+		if merged.Services == nil {
+			merged.Services = make(map[string]models.Service)
+		}
+		if existing, exists := merged.Services[name]; exists {
+			service = existing.Override(service)
+		}
+		merged.Services[name] = service
+	}
+	for name, service := range development.ExtraServices {
+		if merged.ExtraServices == nil {
+			merged.ExtraServices = make(map[string]models.Service)
+		}
+		merged.ExtraServices[name] = service
+	}
+	return nil
+}
+
+// mountSources bind-mounts the directories the LXCfile of each built
+// service copies from the host at the paths they are copied to, unless the
+// service already mounts something there. Copies of single files, from
+// build stages and of sources using build arguments are left to the build.
+func mountSources(stack *models.LXCStack) error {
+	for name, service := range stack.Services {
+		buildConfig := service.GetBuildConfig()
+		if buildConfig == nil || buildConfig.Context == "" {
+			continue
+		}
+		lxcfilePath := filepath.Join(buildConfig.Context, "LXCfile.yml")
+		if buildConfig.Dockerfile != "" {
+			lxcfilePath = filepath.Join(buildConfig.Context, buildConfig.Dockerfile)
+		}
+		lxcfile, err := LoadLXCfile(lxcfilePath)
+		if err != nil {
+			return fmt.Errorf("service '%s': %w", name, err)
+		}
+
+		var mounts []string
+		for _, step := range lxcfile.Setup {
+			if step.Copy == nil || step.Copy.From != "" || strings.Contains(step.Copy.Source, "$") {
+				continue
+			}
+			if info, err := os.Stat(step.Copy.Source); err != nil || !info.IsDir() {
+				continue
+			}
+			mounted := false
+			for _, volume := range service.Volumes {
+				mounted = mounted || models.ParseVolumeMount(volume).Target == step.Copy.Dest
+			}
+			if !mounted {
+				mounts = append(mounts, step.Copy.Source+":"+step.Copy.Dest)
+			}
+		}
+		if len(mounts) > 0 {
+			service.Volumes = append(append([]string(nil), service.Volumes...), mounts...)
+			stack.Services[name] = service
+		}
+	}
+	return nil
+}
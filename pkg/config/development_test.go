@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDevelopmentStack(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	write("web/LXCfile.yml", `from: "debian-12"
+setup:
+  - copy:
+      source: ./src
+      dest: /opt/app/src
+  - copy:
+      source: ./package.json
+      dest: /opt/app/package.json
+  - copy:
+      source: ./config
+      dest: /etc/app
+`)
+	write("web/src/index.js", "")
+	write("web/package.json", "{}")
+	write("web/config/app.conf", "")
+	stackPath := write("lxc-stack.yml", `version: "1.0"
+services:
+  web:
+    build: ./web
+    environment:
+      MODE: production
+    volumes:
+      - ./settings:/etc/app
+development:
+  services:
+    web:
+      environment:
+        MODE: development
+        DEBUG: "1"
+`)
+
+	stack, err := LoadDevelopmentStack(stackPath)
+	if err != nil {
+		t.Fatalf("LoadDevelopmentStack() unexpected error: %v", err)
+	}
+	web := stack.Services["web"]
+	if want := map[string]string{"MODE": "development", "DEBUG": "1"}; !reflect.DeepEqual(web.Environment, want) {
+		t.Errorf("environment = %v, want %v", web.Environment, want)
+	}
+	// The source directory is mounted, the single file and the directory
+	// the service already mounts over are not
+	wantVolumes := []string{
+		filepath.Join(dir, "settings") + ":/etc/app",
+		filepath.Join(dir, "web", "src") + ":/opt/app/src",
+	}
+	if !reflect.DeepEqual(web.Volumes, wantVolumes) {
+		t.Errorf("volumes = %v, want %v", web.Volumes, wantVolumes)
+	}
+	if stack.Development != nil {
+		t.Error("development section kept after applying it")
+	}
+
+	// The development file is merged over the development section
+	write("lxc-stack.dev.yml", `services:
+  web:
+    environment:
+      DEBUG: "0"
+extra_services:
+  adminer:
+    template: "9001"
+    ports: ["8080:8080"]
+`)
+	if got := DevelopmentFile(stackPath); got != filepath.Join(dir, "lxc-stack.dev.yml") {
+		t.Errorf("DevelopmentFile() = %q, want lxc-stack.dev.yml", got)
+	}
+	stack, err = LoadDevelopmentStack(stackPath)
+	if err != nil {
+		t.Fatalf("LoadDevelopmentStack() unexpected error: %v", err)
+	}
+	if want := map[string]string{"MODE": "development", "DEBUG": "0"}; !reflect.DeepEqual(stack.Services["web"].Environment, want) {
+		t.Errorf("environment with development file = %v, want %v", stack.Services["web"].Environment, want)
+	}
+	if _, exists := stack.Services["adminer"]; !exists {
+		t.Error("extra service of the development file not added")
+	}
+
+	// Without development mode nothing is applied
+	stack, err = LoadLXCStack(stackPath)
+	if err != nil {
+		t.Fatalf("LoadLXCStack() unexpected error: %v", err)
+	}
+	if len(stack.Services) != 1 || stack.Services["web"].Environment["MODE"] != "production" {
+		t.Errorf("LoadLXCStack() applied development overrides: %+v", stack.Services)
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// StackDiff is a field-level comparison of two stacks
+type StackDiff struct {
+	Services []EntryDiff `json:"services"`
+	Networks []EntryDiff `json:"networks"`
+	Volumes  []EntryDiff `json:"volumes"`
+}
+
+// EntryDiff describes a service, network or volume that differs
+type EntryDiff struct {
+	Name   string        `json:"name"`
+	Change string        `json:"change"` // added | removed | changed
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field whose value differs. Path uses the stack file's
+// keys joined with dots, such as environment.LOG_LEVEL or resources.memory;
+// lists such as ports are compared as a whole. Old or New is nil when the
+// field is only set on one side.
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// Empty reports whether the stacks have no differences
+func (d *StackDiff) Empty() bool {
+	return len(d.Services) == 0 && len(d.Networks) == 0 && len(d.Volumes) == 0
+}
+
+// DiffStacks compares the services, networks and volumes of two stacks.
+// Entries are compared by their stack file representation, so fields that
+// are not set and fields set to their zero value are the same.
+func DiffStacks(base, other *models.LXCStack) (*StackDiff, error) {
+	var diff StackDiff
+	var err error
+	if diff.Services, err = diffSection(base.Services, other.Services); err != nil {
+		return nil, fmt.Errorf("failed to compare services: %w", err)
+	}
+	if diff.Networks, err = diffSection(base.Networks, other.Networks); err != nil {
+		return nil, fmt.Errorf("failed to compare networks: %w", err)
+	}
+	if diff.Volumes, err = diffSection(base.Volumes, other.Volumes); err != nil {
+		return nil, fmt.Errorf("failed to compare volumes: %w", err)
+	}
+	return &diff, nil
+}
+
+// diffSection compares the entries of one stack section, sorted by name
+func diffSection[T any](base, other map[string]T) ([]EntryDiff, error) {
+	names := make(map[string]bool, len(base)+len(other))
+	for name := range base {
+		names[name] = true
+	}
+	for name := range other {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	diffs := []EntryDiff{}
+	for _, name := range sorted {
+		before, inBase := base[name]
+		after, inOther := other[name]
+		switch {
+		case !inOther:
+			diffs = append(diffs, EntryDiff{Name: name, Change: "removed"})
+		case !inBase:
+			diffs = append(diffs, EntryDiff{Name: name, Change: "added"})
+		default:
+			beforeFields, err := toFields(before)
+			if err != nil {
+				return nil, err
+			}
+			afterFields, err := toFields(after)
+			if err != nil {
+				return nil, err
+			}
+			if changes := diffFields("", beforeFields, afterFields); len(changes) > 0 {
+				diffs = append(diffs, EntryDiff{Name: name, Change: "changed", Fields: changes})
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// toFields converts an entry to its stack file form as nested maps
+func toFields(entry interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// diffFields compares two maps, descending into nested maps
+func diffFields(prefix string, before, after map[string]interface{}) []FieldChange {
+	keys := make(map[string]bool, len(before)+len(after))
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var changes []FieldChange
+	for _, key := range sorted {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		oldValue, newValue := before[key], after[key]
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		switch {
+		case oldIsMap && newIsMap:
+			changes = append(changes, diffFields(path, oldMap, newMap)...)
+		case oldIsMap && newValue == nil:
+			changes = append(changes, diffFields(path, oldMap, map[string]interface{}{})...)
+		case newIsMap && oldValue == nil:
+			changes = append(changes, diffFields(path, map[string]interface{}{}, newMap)...)
+		case !reflect.DeepEqual(oldValue, newValue):
+			changes = append(changes, FieldChange{Path: path, Old: oldValue, New: newValue})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+func TestDiffStacks(t *testing.T) {
+	base := &models.LXCStack{
+		Services: map[string]models.Service{
+			"web":    {Template: "nginx:1.24", Ports: []string{"80:80"}},
+			"worker": {Template: "python:3.11", Environment: map[string]string{"QUEUE": "jobs", "LOG_LEVEL": "info"}},
+			"legacy": {Template: "debian:11"},
+		},
+		Networks: map[string]models.Network{"backend": {Subnet: "172.21.0.0/24"}},
+	}
+	other := &models.LXCStack{
+		Services: map[string]models.Service{
+			"web":    {Template: "nginx:1.25", Ports: []string{"80:80"}},
+			"worker": {Template: "python:3.11", Environment: map[string]string{"QUEUE": "jobs", "LOG_LEVEL": "debug", "WORKERS": "4"}},
+			"cache":  {Template: "redis:7"},
+		},
+		Networks: map[string]models.Network{"backend": {Subnet: "172.21.0.0/24"}},
+	}
+
+	diff, err := DiffStacks(base, other)
+	if err != nil {
+		t.Fatalf("DiffStacks() unexpected error: %v", err)
+	}
+
+	expected := `{"services":[` +
+		`{"name":"cache","change":"added"},` +
+		`{"name":"legacy","change":"removed"},` +
+		`{"name":"web","change":"changed","fields":[{"path":"template","old":"nginx:1.24","new":"nginx:1.25"}]},` +
+		`{"name":"worker","change":"changed","fields":[` +
+		`{"path":"environment.LOG_LEVEL","old":"info","new":"debug"},` +
+		`{"path":"environment.WORKERS","old":null,"new":"4"}]}],` +
+		`"networks":[],"volumes":[]}`
+	data, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatalf("Failed to marshal diff: %v", err)
+	}
+	if string(data) != expected {
+		t.Errorf("DiffStacks() =\n%s\nwant\n%s", data, expected)
+	}
+
+	same, err := DiffStacks(base, base)
+	if err != nil {
+		t.Fatalf("DiffStacks() unexpected error: %v", err)
+	}
+	if !same.Empty() {
+		t.Errorf("DiffStacks() of a stack with itself = %+v, want no differences", same)
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvMissingMode controls what interpolation does with a variable that is
+// unset and has no default
+type EnvMissingMode string
+
+const (
+	EnvMissingError EnvMissingMode = "error" // Fail loading the stack
+	EnvMissingEmpty EnvMissingMode = "empty" // Substitute an empty string
+	EnvMissingKeep  EnvMissingMode = "keep"  // Leave the reference as written
+)
+
+// envMissing is the mode used when loading stack files
+var envMissing = EnvMissingError
+
+// SetEnvMissing sets how stack files are interpolated when a variable is
+// unset and has no default
+func SetEnvMissing(mode EnvMissingMode) {
+	envMissing = mode
+}
+
+// ParseEnvMissingMode parses an --env-missing value
+func ParseEnvMissingMode(value string) (EnvMissingMode, error) {
+	switch mode := EnvMissingMode(value); mode {
+	case EnvMissingError, EnvMissingEmpty, EnvMissingKeep:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid env-missing mode '%s' (supported: error, empty, keep)", value)
+}
+
+// interpolationPattern matches $$, $NAME and ${NAME} with an optional
+// modifier: ${NAME:-default}, ${NAME-default}, ${NAME:?message} or
+// ${NAME?message}
+var interpolationPattern = regexp.MustCompile(`\$(?:\$|(\w+)|\{(\w+)(?:(:?[-?])([^}]*))?\})`)
+
+// interpolate replaces variable references in value as Compose does. With
+// the :- and :? forms an empty variable counts as unset. Unset variables
+// without a default are handled according to mode; their names are returned
+// when mode is EnvMissingError.
+func interpolate(value string, lookup func(string) (string, bool), mode EnvMissingMode) (string, []string, error) {
+	var missing []string
+	var failure error
+
+	result := interpolationPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		match := interpolationPattern.FindStringSubmatch(ref)
+		name, modifier, argument := match[1], match[3], match[4]
+		if name == "" {
+			name = match[2]
+		}
+
+		current, set := lookup(name)
+		if set && current == "" && strings.HasPrefix(modifier, ":") {
+			set = false
+		}
+		if set {
+			return current
+		}
+
+		switch strings.TrimPrefix(modifier, ":") {
+		case "-":
+			return argument
+		case "?":
+			if failure == nil {
+				if argument == "" {
+					argument = "is not set"
+				}
+				failure = fmt.Errorf("variable '%s' %s", name, argument)
+			}
+			return ref
+		}
+
+		switch mode {
+		case EnvMissingEmpty:
+			return ""
+		case EnvMissingKeep:
+			return ref
+		}
+		missing = append(missing, name)
+		return ref
+	})
+	return result, missing, failure
+}
+
+// RenderTemplate replaces variable references in the contents of a config
+// file as in stack files, looking names up with lookup. Unset variables
+// without a default are handled as set with SetEnvMissing.
+func RenderTemplate(text string, lookup func(string) (string, bool)) (string, error) {
+	rendered, missing, err := interpolate(text, lookup, envMissing)
+	if err != nil {
+		return "", err
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("variable '%s' is not set and has no default", missing[0])
+	}
+	return rendered, nil
+}
+
+// interpolateNode interpolates the scalar values below node from the
+// environment. Mapping keys are left alone. Plain scalars that changed are
+// retagged, so ${PORT} can decode into an integer field.
+func interpolateNode(node *yaml.Node, mode EnvMissingMode) error {
+	var problems []string
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		switch node.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, child := range node.Content {
+				walk(child)
+			}
+		case yaml.MappingNode:
+			for i := 1; i < len(node.Content); i += 2 {
+				walk(node.Content[i])
+			}
+		case yaml.ScalarNode:
+			value, missing, err := interpolate(node.Value, os.LookupEnv, mode)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %v", node.Line, err))
+				return
+			}
+			for _, name := range missing {
+				problems = append(problems, fmt.Sprintf("line %d: variable '%s' is not set and has no default", node.Line, name))
+			}
+			if value != node.Value {
+				node.Value = value
+				if node.Style == 0 {
+					node.Tag = ""
+				}
+			}
+		}
+	}
+	walk(node)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("interpolation failed (set the variables, give a default with ${NAME:-default}, or use --env-missing):\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"TAG": "1.2", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, set := env[name]
+		return value, set
+	}
+
+	tests := []struct {
+		name        string
+		value       string
+		mode        EnvMissingMode
+		want        string
+		wantMissing []string
+		wantErr     bool
+	}{
+		{name: "braced", value: "app:${TAG}", mode: EnvMissingError, want: "app:1.2"},
+		{name: "bare", value: "app:$TAG", mode: EnvMissingError, want: "app:1.2"},
+		{name: "escaped dollar", value: "cost $$5 ${TAG}", mode: EnvMissingError, want: "cost $5 1.2"},
+		{name: "default for unset", value: "${UNSET:-8080}", mode: EnvMissingError, want: "8080"},
+		{name: "colon default for empty", value: "${EMPTY:-fallback}", mode: EnvMissingError, want: "fallback"},
+		{name: "dash default keeps empty", value: "${EMPTY-fallback}", mode: EnvMissingError, want: ""},
+		{name: "required set", value: "${TAG:?tag required}", mode: EnvMissingError, want: "1.2"},
+		{name: "required unset", value: "${UNSET:?tag required}", mode: EnvMissingEmpty, wantErr: true},
+		{name: "unset with error mode", value: "app:${UNSET}", mode: EnvMissingError, want: "app:${UNSET}", wantMissing: []string{"UNSET"}},
+		{name: "unset with empty mode", value: "app:${UNSET}", mode: EnvMissingEmpty, want: "app:"},
+		{name: "unset with keep mode", value: "app:${UNSET}", mode: EnvMissingKeep, want: "app:${UNSET}"},
+		{name: "no references", value: "plain text", mode: EnvMissingError, want: "plain text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, missing, err := interpolate(tt.value, lookup, tt.mode)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("interpolate() expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interpolate() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("interpolate() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("interpolate() missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestLoadLXCStackEnvMissing(t *testing.T) {
+	t.Setenv("PXC_TEST_PORT", "8080")
+	os.Unsetenv("PXC_TEST_UNSET")
+
+	path := filepath.Join(t.TempDir(), "lxc-stack.yml")
+	content := `version: "1.0"
+# ${PXC_TEST_UNSET} in a comment is not interpolated
+services:
+  web:
+    template: "nginx:${PXC_TEST_UNSET}"
+    resources:
+      memory: ${PXC_TEST_PORT}
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer SetEnvMissing(EnvMissingError)
+
+	tests := []struct {
+		mode         EnvMissingMode
+		wantTemplate string
+		wantErr      string
+	}{
+		{mode: EnvMissingError, wantErr: "line 5: variable 'PXC_TEST_UNSET' is not set"},
+		{mode: EnvMissingEmpty, wantTemplate: "nginx:"},
+		{mode: EnvMissingKeep, wantTemplate: "nginx:${PXC_TEST_UNSET}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			SetEnvMissing(tt.mode)
+			stack, err := LoadLXCStack(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadLXCStack() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadLXCStack() unexpected error: %v", err)
+			}
+			web := stack.Services["web"]
+			if web.Template != tt.wantTemplate {
+				t.Errorf("template = %q, want %q", web.Template, tt.wantTemplate)
+			}
+			if web.Resources == nil || web.Resources.Memory != 8080 {
+				t.Errorf("resources = %+v, want memory 8080 from ${PXC_TEST_PORT}", web.Resources)
+			}
+		})
+	}
+}
+
+func TestParseEnvMissingMode(t *testing.T) {
+	for _, value := range []string{"error", "empty", "keep"} {
+		if mode, err := ParseEnvMissingMode(value); err != nil || string(mode) != value {
+			t.Errorf("ParseEnvMissingMode(%q) = %q, %v", value, mode, err)
+		}
+	}
+	if _, err := ParseEnvMissingMode("ignore"); err == nil {
+		t.Error("ParseEnvMissingMode(\"ignore\") expected error")
+	}
+}
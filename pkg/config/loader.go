@@ -26,7 +26,11 @@ func LoadLXCfile(filename string) (*models.LXCfile, error) {
 	}
 
 	// Resolve relative paths in copy steps relative to the LXCfile location
-	baseDir := filepath.Dir(filename)
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve LXCfile path: %w", err)
+	}
+	baseDir := filepath.Dir(absPath)
 	if err := resolveRelativePaths(&lxcfile, baseDir); err != nil {
 		return nil, fmt.Errorf("failed to resolve paths: %w", err)
 	}
@@ -34,27 +38,143 @@ func LoadLXCfile(filename string) (*models.LXCfile, error) {
 	return &lxcfile, nil
 }
 
-// LoadLXCStack loads and parses an lxc-stack.yml configuration
+// LoadLXCStack loads and parses an lxc-stack.yml configuration, merging
+// in the stack files it includes and expanding Compose deploy blocks and
+// resource profiles. A Compose file (see IsComposeFile) is converted with
+// ConvertCompose.
 func LoadLXCStack(filename string) (*models.LXCStack, error) {
+	stack, err := loadStack(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	return expandStack(stack)
+}
+
+// expandStack expands the Compose deploy blocks and resource profiles of a
+// loaded stack
+func expandStack(stack *models.LXCStack) (*models.LXCStack, error) {
+	if err := stack.ApplyDeploy(); err != nil {
+		return nil, err
+	}
+	if err := stack.ApplyResourceProfiles(); err != nil {
+		return nil, err
+	}
+	return stack, nil
+}
+
+// loadStack loads a stack file and, recursively, its includes. chain holds
+// the absolute paths of the files that led to this one, to detect cycles.
+func loadStack(filename string, chain []string) (*models.LXCStack, error) {
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve stack path: %w", err)
+	}
+	for i, including := range chain {
+		if including == absPath {
+			return nil, fmt.Errorf("circular include: %s -> %s", strings.Join(chain[i:], " -> "), absPath)
+		}
+	}
+	chain = append(chain, absPath)
+
 	// Read the file
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read lxc-stack file: %w", err)
 	}
 
-	// Parse YAML
-	var stack models.LXCStack
-	if err := yaml.Unmarshal(data, &stack); err != nil {
+	// Parse YAML, substituting ${VAR} references in values before decoding
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
 		return nil, fmt.Errorf("failed to parse lxc-stack YAML: %w", err)
 	}
+	if err := interpolateNode(&root, envMissing); err != nil {
+		return nil, err
+	}
+	var stack models.LXCStack
+	if IsComposeFile(filename) {
+		// What the conversion leaves out is reported by pxc validate and
+		// pxc convert
+		converted, _, err := convertCompose(&root, os.LookupEnv)
+		if err != nil {
+			return nil, err
+		}
+		stack = *converted
+	} else if root.Kind != 0 {
+		if err := root.Decode(&stack); err != nil {
+			return nil, fmt.Errorf("failed to parse lxc-stack YAML: %w", err)
+		}
+	}
 
 	// Resolve relative paths
-	baseDir := filepath.Dir(filename)
+	baseDir := filepath.Dir(absPath)
 	if err := resolveStackPaths(&stack, baseDir); err != nil {
 		return nil, fmt.Errorf("failed to resolve stack paths: %w", err)
 	}
 
-	return &stack, nil
+	if len(stack.Include) == 0 {
+		return &stack, nil
+	}
+
+	// The including file comes first, so its version, metadata and
+	// settings take precedence over those of the fragments
+	sources := []StackSource{{File: filename, Stack: &stack}}
+	for _, include := range stack.Include {
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		included, err := loadStack(path, chain)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", include, err)
+		}
+		sources = append(sources, StackSource{File: path, Stack: included})
+	}
+
+	return MergeStacks(sources)
+}
+
+// LoadScaleFile loads a scale file mapping service names to replica counts
+func LoadScaleFile(filename string) (map[string]int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scale file: %w", err)
+	}
+
+	scales := make(map[string]int)
+	if err := yaml.Unmarshal(data, &scales); err != nil {
+		return nil, fmt.Errorf("failed to parse scale file YAML: %w", err)
+	}
+
+	return scales, nil
+}
+
+// LoadLabelFile loads labels from a file of KEY=VALUE lines. Blank lines and
+// lines starting with # are ignored, and later lines override earlier ones.
+func LoadLabelFile(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read label file: %w", err)
+	}
+
+	labels := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE, got '%s'", filename, i+1, line)
+		}
+		key = strings.TrimSpace(key)
+		if err := models.ValidateLabelKey(key); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, i+1, err)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+
+	return labels, nil
 }
 
 // resolveRelativePaths converts relative paths in the LXCfile to absolute paths
@@ -84,9 +204,21 @@ func resolveRelativePaths(lxcfile *models.LXCfile, baseDir string) error {
 	return nil
 }
 
-// resolveStackPaths resolves relative paths in stack configurations
+// resolveStackPaths resolves relative paths in stack configurations,
+// including those of the development overrides
 func resolveStackPaths(stack *models.LXCStack, baseDir string) error {
-	for serviceName, service := range stack.Services {
+	resolveServicePaths(stack.Services, baseDir)
+	if stack.Development != nil {
+		resolveServicePaths(stack.Development.Services, baseDir)
+		resolveServicePaths(stack.Development.ExtraServices, baseDir)
+	}
+	return nil
+}
+
+// resolveServicePaths resolves the build contexts and bind mount sources of
+// services relative to baseDir
+func resolveServicePaths(services map[string]models.Service, baseDir string) {
+	for serviceName, service := range services {
 		// Resolve build context paths
 		if service.HasBuild() {
 			buildConfig := service.GetBuildConfig()
@@ -103,24 +235,21 @@ func resolveStackPaths(stack *models.LXCStack, baseDir string) error {
 			}
 		}
 
-		// Resolve volume paths
+		// Resolve relative bind mount sources (./data, ../shared); bare
+		// names are named volumes and are left alone
 		for i := range service.Volumes {
 			volume := &service.Volumes[i]
 			parts := strings.Split(*volume, ":")
-			if len(parts) >= 2 && !filepath.IsAbs(parts[0]) {
+			if len(parts) >= 2 && strings.HasPrefix(parts[0], ".") {
 				// Only resolve host paths (first part), not container paths
-				if !strings.HasPrefix(parts[0], "/") {
-					parts[0] = filepath.Join(baseDir, parts[0])
-					*volume = strings.Join(parts, ":")
-				}
+				parts[0] = filepath.Join(baseDir, parts[0])
+				*volume = strings.Join(parts, ":")
 			}
 		}
 
 		// Update the service back to the map
-		stack.Services[serviceName] = service
+		services[serviceName] = service
 	}
-
-	return nil
 }
 
 // ValidateConfigExists checks if a configuration file exists and returns a helpful error
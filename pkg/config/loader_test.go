@@ -305,6 +305,65 @@ services:
       NODE_ENV: "production"`,
 			wantErr:  false, // Loader doesn't validate, just parses YAML
 		},
+		{
+			name: "resource profiles",
+			content: `version: "1.0"
+x-resource-profiles:
+  small: {cores: 1, memory: 512}
+services:
+  web:
+    template: "nginx:latest"
+    resource_profile: small
+    resources:
+      memory: 1024`,
+			validate: func(t *testing.T, stack *models.LXCStack) {
+				want := models.Resources{Cores: 1, Memory: 1024}
+				if got := stack.Services["web"].Resources; got == nil || *got != want {
+					t.Errorf("web resources = %+v, want %+v", got, want)
+				}
+			},
+		},
+		{
+			name: "undefined resource profile",
+			content: `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    resource_profile: tiny`,
+			wantErr:  true,
+			errorMsg: "service 'web' references undefined resource profile 'tiny'",
+		},
+		{
+			name: "compose deploy block",
+			content: `version: "1.0"
+services:
+  worker:
+    template: "python:3.11"
+    deploy:
+      replicas: 3
+      resources:
+        limits:
+          cpus: "1.5"
+          memory: 512M
+        reservations:
+          memory: 256M
+      placement:
+        constraints: ["node.role == worker"]`,
+			validate: func(t *testing.T, stack *models.LXCStack) {
+				worker := stack.Services["worker"]
+				if worker.Scale != 3 {
+					t.Errorf("worker scale = %d, want 3", worker.Scale)
+				}
+				want := models.Resources{Cores: 2, Memory: 512}
+				if worker.Resources == nil || *worker.Resources != want {
+					t.Errorf("worker resources = %+v, want %+v", worker.Resources, want)
+				}
+				warnings := stack.DeployWarnings()
+				if len(warnings) != 1 || warnings[0].Path != "services.worker.deploy.placement" {
+					t.Errorf("DeployWarnings() = %+v, want one for deploy.placement", warnings)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -527,4 +586,208 @@ func containsString(s, substr string) bool {
 			}
 			return false
 		}())))
-}
\ No newline at end of file
+}
+
+func TestLoadScaleFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("valid scale file", func(t *testing.T) {
+		path := filepath.Join(tempDir, "scales.yml")
+		if err := os.WriteFile(path, []byte("web: 3\nworker: 2\n"), 0644); err != nil {
+			t.Fatalf("Failed to write scale file: %v", err)
+		}
+
+		scales, err := LoadScaleFile(path)
+		if err != nil {
+			t.Fatalf("LoadScaleFile() unexpected error: %v", err)
+		}
+		if scales["web"] != 3 || scales["worker"] != 2 || len(scales) != 2 {
+			t.Errorf("LoadScaleFile() = %v, want map[web:3 worker:2]", scales)
+		}
+	})
+
+	t.Run("non-numeric count", func(t *testing.T) {
+		path := filepath.Join(tempDir, "bad-scales.yml")
+		if err := os.WriteFile(path, []byte("web: many\n"), 0644); err != nil {
+			t.Fatalf("Failed to write scale file: %v", err)
+		}
+
+		_, err := LoadScaleFile(path)
+		if err == nil || !containsString(err.Error(), "failed to parse scale file") {
+			t.Errorf("LoadScaleFile() error = %v, want parse error", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadScaleFile(filepath.Join(tempDir, "missing.yml"))
+		if err == nil || !containsString(err.Error(), "failed to read scale file") {
+			t.Errorf("LoadScaleFile() error = %v, want read error", err)
+		}
+	})
+}
+
+func TestLoadLXCStackInclude(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFile := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	t.Run("two fragments", func(t *testing.T) {
+		writeFile("stacks/db.yml", `services:
+  database:
+    template: "postgres:15"
+volumes:
+  db-data:
+    driver: "local"
+`)
+		writeFile("stacks/web.yml", `services:
+  web:
+    build: "../web"
+    depends_on:
+      - database
+networks:
+  frontend:
+    driver: "bridge"
+`)
+		base := writeFile("lxc-stack.yml", `version: "1.0"
+include:
+  - ./stacks/db.yml
+  - ./stacks/web.yml
+services:
+  cache:
+    template: "redis:7"
+`)
+
+		stack, err := LoadLXCStack(base)
+		if err != nil {
+			t.Fatalf("LoadLXCStack() unexpected error: %v", err)
+		}
+
+		for _, name := range []string{"cache", "database", "web"} {
+			if _, exists := stack.Services[name]; !exists {
+				t.Errorf("Merged stack missing service %s", name)
+			}
+		}
+		if _, exists := stack.Volumes["db-data"]; !exists {
+			t.Error("Merged stack missing volume db-data")
+		}
+		if _, exists := stack.Networks["frontend"]; !exists {
+			t.Error("Merged stack missing network frontend")
+		}
+		if stack.Version != "1.0" {
+			t.Errorf("Version = %q, want 1.0 from the including file", stack.Version)
+		}
+
+		// Paths in a fragment are relative to the fragment
+		web := stack.Services["web"]
+		if context := web.GetBuildConfig().Context; context != filepath.Join(tempDir, "web") {
+			t.Errorf("web build context = %q, want %q", context, filepath.Join(tempDir, "web"))
+		}
+
+		if err := stack.Validate(); err != nil {
+			t.Errorf("Merged stack should be valid: %v", err)
+		}
+	})
+
+	t.Run("circular include", func(t *testing.T) {
+		writeFile("cycle/a.yml", `version: "1.0"
+include:
+  - b.yml
+services:
+  a:
+    template: "nginx:latest"
+`)
+		writeFile("cycle/b.yml", `include:
+  - a.yml
+services:
+  b:
+    template: "nginx:latest"
+`)
+
+		_, err := LoadLXCStack(filepath.Join(tempDir, "cycle", "a.yml"))
+		if err == nil || !containsString(err.Error(), "circular include") {
+			t.Fatalf("LoadLXCStack() error = %v, want circular include error", err)
+		}
+	})
+
+	t.Run("missing fragment", func(t *testing.T) {
+		base := writeFile("missing.yml", `version: "1.0"
+include:
+  - nowhere.yml
+services:
+  web:
+    template: "nginx:latest"
+`)
+
+		_, err := LoadLXCStack(base)
+		if err == nil || !containsString(err.Error(), "include nowhere.yml") {
+			t.Errorf("LoadLXCStack() error = %v, want error naming the include", err)
+		}
+	})
+}
+
+func TestLoadLabelFile(t *testing.T) {
+	tempDir := t.TempDir()
+	writeLabels := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write label file: %v", err)
+		}
+		return path
+	}
+
+	t.Run("valid label file", func(t *testing.T) {
+		path := writeLabels("labels.txt", `# Compliance labels
+org.opencontainers.image.vendor=ACME Corp
+compliance/owner = platform-team
+
+description=key=value pairs are allowed in values
+tier=frontend
+tier=backend
+`)
+
+		labels, err := LoadLabelFile(path)
+		if err != nil {
+			t.Fatalf("LoadLabelFile() unexpected error: %v", err)
+		}
+		expected := map[string]string{
+			"org.opencontainers.image.vendor": "ACME Corp",
+			"compliance/owner":                "platform-team",
+			"description":                     "key=value pairs are allowed in values",
+			"tier":                            "backend",
+		}
+		if len(labels) != len(expected) {
+			t.Errorf("LoadLabelFile() = %v, want %v", labels, expected)
+		}
+		for key, value := range expected {
+			if labels[key] != value {
+				t.Errorf("label %s = %q, want %q", key, labels[key], value)
+			}
+		}
+	})
+
+	t.Run("line without equals", func(t *testing.T) {
+		path := writeLabels("missing-equals.txt", "tier=frontend\nowner\n")
+		_, err := LoadLabelFile(path)
+		if err == nil || !containsString(err.Error(), "missing-equals.txt:2: expected KEY=VALUE") {
+			t.Errorf("LoadLabelFile() error = %v, want line 2 error", err)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		path := writeLabels("bad-key.txt", "-tier=frontend\n")
+		_, err := LoadLabelFile(path)
+		if err == nil || !containsString(err.Error(), "bad-key.txt:1: invalid label key '-tier'") {
+			t.Errorf("LoadLabelFile() error = %v, want invalid key error", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// StackSource is a loaded stack together with the file it was read from
+type StackSource struct {
+	File  string
+	Stack *models.LXCStack
+}
+
+// MergeStacks combines stacks into one. A service, network, volume, secret or
+// config may appear in several sources only if every definition is identical;
+// conflicting definitions are reported with both source files. Version,
+// metadata, settings, hooks and development overrides come from the first
+// source that sets them.
+func MergeStacks(sources []StackSource) (*models.LXCStack, error) {
+	merged := &models.LXCStack{}
+	origins := make(map[string]string)
+
+	for _, source := range sources {
+		stack := source.Stack
+
+		if merged.Version == "" {
+			merged.Version = stack.Version
+		}
+		if merged.Metadata == nil {
+			merged.Metadata = stack.Metadata
+		}
+		if merged.Settings == nil {
+			merged.Settings = stack.Settings
+		}
+		if merged.Hooks == nil {
+			merged.Hooks = stack.Hooks
+		}
+		if merged.Development == nil {
+			merged.Development = stack.Development
+		}
+
+		if err := mergeSection("service", &merged.Services, stack.Services, source.File, origins); err != nil {
+			return nil, err
+		}
+		if err := mergeSection("network", &merged.Networks, stack.Networks, source.File, origins); err != nil {
+			return nil, err
+		}
+		if err := mergeSection("volume", &merged.Volumes, stack.Volumes, source.File, origins); err != nil {
+			return nil, err
+		}
+		if err := mergeSection("secret", &merged.Secrets, stack.Secrets, source.File, origins); err != nil {
+			return nil, err
+		}
+		if err := mergeSection("config", &merged.Configs, stack.Configs, source.File, origins); err != nil {
+			return nil, err
+		}
+		if err := mergeSection("resource profile", &merged.ResourceProfiles, stack.ResourceProfiles, source.File, origins); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
+
+// mergeSection adds entries from one source into the merged section,
+// rejecting entries that are already defined differently by another source
+func mergeSection[T any](kind string, merged *map[string]T, entries map[string]T, file string, origins map[string]string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if *merged == nil {
+		*merged = make(map[string]T, len(entries))
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := entries[name]
+		key := kind + "/" + name
+
+		if existing, exists := (*merged)[name]; exists {
+			if !reflect.DeepEqual(existing, entry) {
+				return fmt.Errorf("%s '%s' is defined in both %s and %s with conflicting settings", kind, name, origins[key], file)
+			}
+			continue
+		}
+
+		(*merged)[name] = entry
+		origins[key] = file
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+func TestMergeStacks(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFile := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	base := writeFile("base.yml", `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    environment:
+      POSTGRES_DB: "app"
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - database
+`)
+	identical := writeFile("identical.yml", `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    environment:
+      POSTGRES_DB: "app"
+  cache:
+    template: "redis:7"
+`)
+	conflicting := writeFile("conflicting.yml", `version: "1.0"
+services:
+  database:
+    template: "postgres:16"
+`)
+
+	// merge loads the files and merges them in order
+	merge := func(t *testing.T, files ...string) (*models.LXCStack, error) {
+		t.Helper()
+		sources := make([]StackSource, 0, len(files))
+		for _, file := range files {
+			stack, err := LoadLXCStack(file)
+			if err != nil {
+				t.Fatalf("Failed to load %s: %v", file, err)
+			}
+			sources = append(sources, StackSource{File: file, Stack: stack})
+		}
+		return MergeStacks(sources)
+	}
+
+	t.Run("identical duplicate is allowed", func(t *testing.T) {
+		stack, err := merge(t, base, identical)
+		if err != nil {
+			t.Fatalf("MergeStacks() unexpected error: %v", err)
+		}
+
+		for _, name := range []string{"database", "web", "cache"} {
+			if _, exists := stack.Services[name]; !exists {
+				t.Errorf("Merged stack missing service %s", name)
+			}
+		}
+		if len(stack.Services) != 3 {
+			t.Errorf("Expected 3 services, got %d", len(stack.Services))
+		}
+		if err := stack.Validate(); err != nil {
+			t.Errorf("Merged stack failed validation: %v", err)
+		}
+	})
+
+	t.Run("conflicting duplicate is rejected", func(t *testing.T) {
+		_, err := merge(t, base, conflicting)
+		if err == nil {
+			t.Fatal("MergeStacks() expected error, got nil")
+		}
+
+		expected := "service 'database' is defined in both " + base + " and " + conflicting + " with conflicting settings"
+		if err.Error() != expected {
+			t.Errorf("MergeStacks() error = %q, want %q", err.Error(), expected)
+		}
+	})
+}
@@ -0,0 +1,453 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// Problem severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Problem is a validation error or lint warning in a stack, located by its
+// file, YAML path (e.g. services.web.ports[0]) and line
+type Problem struct {
+	File     string `json:"file"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+var (
+	// yamlLinePattern finds the line in yaml.v3 parse and type errors
+	yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+
+	// serviceErrorPattern matches validation errors about a service
+	serviceErrorPattern = regexp.MustCompile(`^service '([^']+)'`)
+
+	// lxcfileErrorPattern matches validation errors about an LXCfile entry,
+	// e.g. "setup step 2: ..." or "stage 'deps': setup step 1: ..."
+	lxcfileErrorPattern = regexp.MustCompile(`^(?:stage '([^']+)': )?(?:(setup step|cleanup step|mount|port) (\d+))?`)
+)
+
+// ValidateStack loads a stack file and reports its validation errors and
+// lint warnings, each located in the stack file or the include that defines
+// it.
+// The error is only set when the stack file cannot be read.
+func ValidateStack(filename string) ([]Problem, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lxc-stack file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return []Problem{{File: filename, Line: errorLine(err), Message: err.Error(), Severity: SeverityError}}, nil
+	}
+	index := indexStackFiles(filename, &root)
+
+	// Loading reports type errors and references it resolves, such as
+	// resource profiles
+	stack, err := LoadLXCStack(filename)
+	if err != nil {
+		return []Problem{index.errorProblem(err)}, nil
+	}
+
+	var problems []Problem
+	if IsComposeFile(filename) {
+		_, warnings, err := ConvertCompose(&root)
+		if err == nil {
+			for _, warning := range warnings {
+				problem := index.locate(warning.Path)
+				problem.Message, problem.Severity = warning.Message, SeverityWarning
+				problems = append(problems, problem)
+			}
+		}
+	}
+	for _, err := range splitErrors(stack.Validate()) {
+		problems = append(problems, index.errorProblem(err))
+	}
+	// A dependency cycle only surfaces when the deploy order is computed
+	if _, err := stack.GetServiceDependencyOrder(); err != nil {
+		problem := index.locate(cyclePath(err.Error()))
+		problem.Message, problem.Severity = err.Error(), SeverityError
+		problems = append(problems, problem)
+	}
+	problems = append(problems, buildProblems(stack, index)...)
+	for _, warning := range stack.Lint() {
+		problem := index.locate(warning.Path)
+		problem.Message, problem.Severity = warning.Message, SeverityWarning
+		problems = append(problems, problem)
+	}
+	return problems, nil
+}
+
+// splitErrors returns the errors joined in err with errors.Join, nested
+// joins included, or err itself; nil for a nil err
+func splitErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		if err == nil {
+			return nil
+		}
+		return []error{err}
+	}
+	var errs []error
+	for _, err := range joined.Unwrap() {
+		errs = append(errs, splitErrors(err)...)
+	}
+	return errs
+}
+
+// errorProblem locates an error from loading or validating the stack: at
+// the line yaml.v3 reports, or else at the path its message refers to
+func (index stackIndex) errorProblem(err error) Problem {
+	return index.problemAt(err, errorPath(err.Error(), index))
+}
+
+// problemAt locates an error at the line yaml.v3 reports, or else at path
+func (index stackIndex) problemAt(err error, path string) Problem {
+	problem := Problem{File: index[0].name, Line: errorLine(err)}
+	if problem.Line == 0 {
+		problem = index.locate(path)
+	}
+	problem.Message, problem.Severity = err.Error(), SeverityError
+	return problem
+}
+
+// cyclePath returns the depends_on of the first service of a reported
+// dependency cycle, e.g. "circular dependency detected: a -> b -> a"
+func cyclePath(message string) string {
+	_, cycle, _ := strings.Cut(message, ": ")
+	first, _, _ := strings.Cut(cycle, " -> ")
+	return "services." + first + ".depends_on"
+}
+
+// buildProblems checks that the build context of every service exists and
+// holds its LXCfile, and validates each LXCfile once. LXCfile problems are
+// located in the LXCfile.
+func buildProblems(stack *models.LXCStack, index stackIndex) []Problem {
+	names := make([]string, 0, len(stack.Services))
+	for name := range stack.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []Problem
+	checked := make(map[string]bool)
+	for _, name := range names {
+		service := stack.Services[name]
+		buildConfig := service.GetBuildConfig()
+		if buildConfig == nil || buildConfig.Context == "" {
+			continue
+		}
+		problem := index.locate("services." + name + ".build")
+		problem.Severity = SeverityError
+
+		if info, err := os.Stat(buildConfig.Context); err != nil || !info.IsDir() {
+			problem.Message = fmt.Sprintf("service '%s': build context '%s' does not exist", name, buildConfig.Context)
+			problems = append(problems, problem)
+			continue
+		}
+		lxcfilePath := filepath.Join(buildConfig.Context, "LXCfile.yml")
+		if buildConfig.Dockerfile != "" {
+			lxcfilePath = filepath.Join(buildConfig.Context, buildConfig.Dockerfile)
+		}
+		if _, err := os.Stat(lxcfilePath); err != nil {
+			problem.Message = fmt.Sprintf("service '%s': build context has no LXCfile '%s'", name, lxcfilePath)
+			problems = append(problems, problem)
+			continue
+		}
+		if checked[lxcfilePath] {
+			continue
+		}
+		checked[lxcfilePath] = true
+		lxcfileProblems, err := ValidateLXCfile(lxcfilePath)
+		if err != nil {
+			problem.Message = fmt.Sprintf("service '%s': %v", name, err)
+			lxcfileProblems = []Problem{problem}
+		}
+		problems = append(problems, lxcfileProblems...)
+	}
+	return problems
+}
+
+// ValidateLXCfile loads an LXCfile and reports its validation errors and
+// copy steps whose source does not exist, located by YAML path and line.
+// The error is only set when the file cannot be read.
+func ValidateLXCfile(filename string) ([]Problem, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LXCfile: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return []Problem{{File: filename, Line: errorLine(err), Message: err.Error(), Severity: SeverityError}}, nil
+	}
+	file := stackFile{name: filename, lines: make(map[string]int)}
+	recordPositions(&root, "", file.lines)
+	index := stackIndex{file}
+
+	lxcfile, err := LoadLXCfile(filename)
+	if err != nil {
+		return []Problem{index.problemAt(err, "")}, nil
+	}
+
+	var problems []Problem
+	for _, err := range splitErrors(lxcfile.Validate()) {
+		problems = append(problems, index.problemAt(err, lxcfileErrorPath(err.Error())))
+	}
+	for _, steps := range []struct {
+		key   string
+		steps []models.SetupStep
+	}{{"setup", lxcfile.Setup}, {"cleanup", lxcfile.Cleanup}} {
+		for i, step := range steps.steps {
+			if step.Copy == nil || step.Copy.From != "" || step.Copy.Source == "" || strings.ContainsAny(step.Copy.Source, "*?[") {
+				continue
+			}
+			if _, err := os.Stat(step.Copy.Source); err != nil {
+				problem := index.locate(fmt.Sprintf("%s[%d].copy.source", steps.key, i))
+				problem.Message = fmt.Sprintf("%s step %d: copy source '%s' does not exist", steps.key, i+1, step.Copy.Source)
+				problem.Severity = SeverityError
+				problems = append(problems, problem)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// lxcfileErrorPath maps an LXCfile validation error message to the YAML
+// path it is about, e.g. "setup step 2: ..." to setup[1]
+func lxcfileErrorPath(message string) string {
+	switch {
+	case strings.HasPrefix(message, "'from'"):
+		return "from"
+	case strings.HasPrefix(message, "'setup'"):
+		return "setup"
+	case strings.HasPrefix(message, "invalid label key"):
+		return "labels"
+	}
+
+	match := lxcfileErrorPattern.FindStringSubmatch(message)
+	path := ""
+	if match[1] != "" {
+		path = "stages." + match[1] + "."
+	}
+	if match[2] == "" {
+		return strings.TrimSuffix(path, ".")
+	}
+	step, _ := strconv.Atoi(match[3])
+	key := map[string]string{"setup step": "setup", "cleanup step": "cleanup", "mount": "mounts", "port": "ports"}[match[2]]
+	return fmt.Sprintf("%s%s[%d]", path, key, step-1)
+}
+
+// errorLine returns the line a yaml.v3 error refers to, 0 if none
+func errorLine(err error) int {
+	match := yamlLinePattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(match[1])
+	return line
+}
+
+// errorPath maps a validation error message to the YAML path it is about.
+// Errors about a service point at the service's key named in the message,
+// e.g. "service 'web': invalid dns entry ..." at services.web.dns, or at the
+// service itself when no key is named.
+func errorPath(message string, index stackIndex) string {
+	switch {
+	case strings.HasPrefix(message, "'version'"):
+		return "version"
+	case strings.HasPrefix(message, "'services'"):
+		return "services"
+	case strings.HasPrefix(message, "hooks:"):
+		return "hooks"
+	}
+
+	match := serviceErrorPattern.FindStringSubmatch(message)
+	if match == nil {
+		return ""
+	}
+	service := "services." + match[1]
+	detail := message[len(match[0]):]
+
+	best := ""
+	for _, key := range index.childKeys(service) {
+		names := []string{key, strings.TrimSuffix(key, "s"), strings.ReplaceAll(key, "_", " ")}
+		for _, name := range names {
+			if containsWord(detail, name) && len(key) > len(best) {
+				best = key
+			}
+		}
+	}
+	if best == "" {
+		return service
+	}
+	return service + "." + best
+}
+
+// containsWord reports whether phrase occurs in text between word
+// boundaries, e.g. "dns" in "invalid dns entry" but not in "dnssec"
+func containsWord(text, phrase string) bool {
+	if phrase == "" {
+		return false
+	}
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], phrase)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(phrase)
+		if (start == 0 || !isWordByte(text[start-1])) && (end == len(text) || !isWordByte(text[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// isWordByte reports whether c is a letter, digit or underscore
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// stackFile is a stack file and the line of each YAML path in it
+type stackFile struct {
+	name  string
+	lines map[string]int
+}
+
+// stackIndex holds the positions of a stack file and its includes, the
+// including file first
+type stackIndex []stackFile
+
+// indexStackFiles records the line of every YAML path in a stack file and,
+// recursively, the files it includes. Includes that cannot be read are
+// skipped; loading the stack reports them.
+func indexStackFiles(filename string, root *yaml.Node) stackIndex {
+	var index stackIndex
+	seen := make(map[string]bool)
+
+	var add func(filename string, root *yaml.Node)
+	add = func(filename string, root *yaml.Node) {
+		absPath, err := filepath.Abs(filename)
+		if err != nil || seen[absPath] {
+			return
+		}
+		seen[absPath] = true
+
+		file := stackFile{name: filename, lines: make(map[string]int)}
+		recordPositions(root, "", file.lines)
+		index = append(index, file)
+
+		for _, include := range includes(root) {
+			path := include
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			var included yaml.Node
+			if yaml.Unmarshal(data, &included) == nil {
+				add(path, &included)
+			}
+		}
+	}
+	add(filename, root)
+	return index
+}
+
+// recordPositions stores the line of node and its children under their YAML
+// paths. Mapping entries are located at their key.
+func recordPositions(node *yaml.Node, path string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			recordPositions(child, path, lines)
+		}
+		return
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			lines[key] = node.Content[i].Line
+			recordPositions(node.Content[i+1], key, lines)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			key := fmt.Sprintf("%s[%d]", path, i)
+			lines[key] = item.Line
+			recordPositions(item, key, lines)
+		}
+	}
+}
+
+// includes returns the include list of a parsed stack file
+func includes(root *yaml.Node) []string {
+	var doc struct {
+		Include []string `yaml:"include"`
+	}
+	if err := root.Decode(&doc); err != nil {
+		return nil
+	}
+	return doc.Include
+}
+
+// locate returns a problem positioned at path in the first file that defines
+// it. A path no file defines is placed at its closest defined parent in the
+// stack file, or at its first line.
+func (index stackIndex) locate(path string) Problem {
+	for _, file := range index {
+		if line, exists := file.lines[path]; exists {
+			return Problem{File: file.name, Path: path, Line: line}
+		}
+	}
+
+	main := index[0]
+	for parent := path; parent != ""; {
+		cut := strings.LastIndexAny(parent, ".[")
+		if cut < 0 {
+			break
+		}
+		parent = parent[:cut]
+		if line, exists := main.lines[parent]; exists {
+			return Problem{File: main.name, Path: path, Line: line}
+		}
+	}
+	return Problem{File: main.name, Path: path, Line: 1}
+}
+
+// childKeys returns the keys directly below path in any indexed file
+func (index stackIndex) childKeys(path string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, file := range index {
+		for key := range file.lines {
+			child, found := strings.CutPrefix(key, path+".")
+			if !found || strings.ContainsAny(child, ".[") || seen[child] {
+				continue
+			}
+			seen[child] = true
+			keys = append(keys, child)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
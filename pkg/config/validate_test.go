@@ -0,0 +1,265 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateStack(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	stackPath := write("lxc-stack.yml", `version: "1.0"
+include:
+  - workers.yml
+services:
+  web:
+    template: "nginx:latest"
+    dns:
+      - "10.0.0.53"
+      - "dns.example.com"
+`)
+	if err := os.Mkdir(filepath.Join(dir, "app"), 0755); err != nil {
+		t.Fatalf("Failed to create build context: %v", err)
+	}
+	write("app/LXCfile.yml", `from: "debian-12"
+setup:
+  - run: "apt-get update"
+  - copy:
+      source: ./dist
+      dest: /srv
+`)
+	workersPath := write("workers.yml", `version: "1.0"
+services:
+  worker:
+    template: "debian:latest"
+`)
+
+	tests := []struct {
+		name     string
+		file     string
+		expected []Problem
+	}{
+		{
+			name: "validation error and lint warnings",
+			file: stackPath,
+			expected: []Problem{
+				{File: stackPath, Path: "services.web.dns", Line: 7, Message: "service 'web': invalid dns entry 'dns.example.com', must be an IP address", Severity: SeverityError},
+				{File: stackPath, Path: "services.web.template", Line: 6, Message: "service 'web': template 'nginx:latest' uses the latest tag; pin a version so redeploys are reproducible", Severity: SeverityWarning},
+				{File: workersPath, Path: "services.worker.template", Line: 4, Message: "service 'worker': template 'debian:latest' uses the latest tag; pin a version so redeploys are reproducible", Severity: SeverityWarning},
+			},
+		},
+		{
+			name: "error found while loading",
+			file: write("profile.yml", `version: "1.0"
+services:
+  db:
+    template: "postgres:15"
+    resource_profile: huge
+`),
+			expected: []Problem{
+				{File: filepath.Join(dir, "profile.yml"), Path: "services.db.resource_profile", Line: 5, Message: "service 'db' references undefined resource profile 'huge'", Severity: SeverityError},
+			},
+		},
+		{
+			name: "missing version",
+			file: write("noversion.yml", `services:
+  db:
+    template: "postgres:15"
+`),
+			expected: []Problem{
+				{File: filepath.Join(dir, "noversion.yml"), Path: "version", Line: 1, Message: "'version' field is required", Severity: SeverityError},
+			},
+		},
+		{
+			name: "syntax error",
+			file: write("broken.yml", "version: \"1.0\"\nservices:\n  web: [\n"),
+			expected: []Problem{
+				{File: filepath.Join(dir, "broken.yml"), Line: 3, Message: "yaml: line 3: did not find expected node content", Severity: SeverityError},
+			},
+		},
+		{
+			name: "unused definitions and unreachable dependency",
+			file: write("unused.yml", `version: "1.0"
+services:
+  web:
+    template: "nginx:1.25"
+    depends_on: [db]
+  db:
+    template: "postgres:15"
+    networks: [backend]
+networks:
+  backend: {}
+  frontend: {}
+volumes:
+  data: {}
+`),
+			expected: []Problem{
+				{File: filepath.Join(dir, "unused.yml"), Path: "services.web.depends_on[0]", Line: 5, Message: "service 'web' depends on 'db' but shares no network with it, so it cannot reach it", Severity: SeverityWarning},
+				{File: filepath.Join(dir, "unused.yml"), Path: "networks.frontend", Line: 11, Message: "network 'frontend' is not used by any service", Severity: SeverityWarning},
+				{File: filepath.Join(dir, "unused.yml"), Path: "volumes.data", Line: 13, Message: "volume 'data' is not used by any service", Severity: SeverityWarning},
+			},
+		},
+		{
+			name: "dependency cycle",
+			file: write("cycle.yml", `version: "1.0"
+services:
+  api:
+    template: "debian:12"
+    depends_on: [worker]
+  worker:
+    template: "debian:12"
+    depends_on: [api]
+`),
+			expected: []Problem{
+				{File: filepath.Join(dir, "cycle.yml"), Path: "services.api.depends_on", Line: 5, Message: "circular dependency detected: api -> worker -> api", Severity: SeverityError},
+			},
+		},
+		{
+			name: "build contexts",
+			file: write("build.yml", `version: "1.0"
+services:
+  app:
+    build: ./app
+  gone:
+    build: ./missing
+`),
+			expected: []Problem{
+				{File: filepath.Join(dir, "app", "LXCfile.yml"), Path: "setup[1].copy.source", Line: 5, Message: "setup step 2: copy source '" + filepath.Join(dir, "app", "dist") + "' does not exist", Severity: SeverityError},
+				{File: filepath.Join(dir, "build.yml"), Path: "services.gone.build", Line: 6, Message: "service 'gone': build context '" + filepath.Join(dir, "missing") + "' does not exist", Severity: SeverityError},
+			},
+		},
+		{
+			name: "every validation error",
+			file: write("errors.yml", `version: "1.0"
+services:
+  web:
+    template: "nginx:1.25"
+    dns: ["dns.example.com"]
+  worker:
+    template: "debian:12"
+    networks: [backend]
+`),
+			expected: []Problem{
+				{File: filepath.Join(dir, "errors.yml"), Path: "services.web.dns", Line: 5, Message: "service 'web': invalid dns entry 'dns.example.com', must be an IP address", Severity: SeverityError},
+				{File: filepath.Join(dir, "errors.yml"), Path: "services.worker.networks", Line: 8, Message: "service 'worker' references undefined network 'backend'", Severity: SeverityError},
+			},
+		},
+		{
+			name: "clean stack",
+			file: write("clean.yml", "version: \"1.0\"\nservices:\n  db:\n    template: \"postgres:15\"\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := ValidateStack(tt.file)
+			if err != nil {
+				t.Fatalf("ValidateStack() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(problems, tt.expected) {
+				t.Errorf("ValidateStack() =\n%+v\nwant\n%+v", problems, tt.expected)
+			}
+		})
+	}
+
+	if _, err := ValidateStack(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Error("ValidateStack() expected error for a missing file")
+	}
+}
+
+func TestValidateLXCfile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		content  string
+		expected []Problem
+	}{
+		{
+			name: "invalid setup step",
+			content: `from: "debian-12"
+setup:
+  - run: "apt-get update"
+  - user: app
+    env:
+      MODE: prod
+`,
+			expected: []Problem{
+				{Path: "setup[1]", Line: 4, Message: "setup step 2: user only applies to run steps", Severity: SeverityError},
+			},
+		},
+		{
+			name: "several invalid entries",
+			content: `from: "debian-12"
+setup:
+  - user: app
+    workdir: /srv
+  - copy:
+      source: ./dist/*
+ports:
+  - container: 0
+`,
+			expected: []Problem{
+				{Path: "setup[0]", Line: 3, Message: "setup step 1: user only applies to run steps", Severity: SeverityError},
+				{Path: "setup[1]", Line: 5, Message: "setup step 2: copy dest is required", Severity: SeverityError},
+				{Path: "ports[0]", Line: 8, Message: "port 1: container port must be between 1 and 65535", Severity: SeverityError},
+			},
+		},
+		{
+			name: "invalid stage step",
+			content: `from: "debian-12"
+stages:
+  deps:
+    from: "debian-12"
+    setup:
+      - user: app
+        workdir: /srv
+setup:
+  - run: "true"
+`,
+			expected: []Problem{
+				{Path: "stages.deps.setup[0]", Line: 6, Message: "stage 'deps': setup step 1: user only applies to run steps", Severity: SeverityError},
+			},
+		},
+		{
+			name:    "missing from",
+			content: "setup:\n  - run: \"true\"\n",
+			expected: []Problem{
+				{Path: "from", Line: 1, Message: "'from' field is required", Severity: SeverityError},
+			},
+		},
+		{
+			name:    "valid",
+			content: "from: \"debian-12\"\nsetup:\n  - run: \"true\"\n",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("LXCfile-%d.yml", i))
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write LXCfile: %v", err)
+			}
+			for j := range tt.expected {
+				tt.expected[j].File = path
+			}
+
+			problems, err := ValidateLXCfile(path)
+			if err != nil {
+				t.Fatalf("ValidateLXCfile() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(problems, tt.expected) {
+				t.Errorf("ValidateLXCfile() =\n%+v\nwant\n%+v", problems, tt.expected)
+			}
+		})
+	}
+}
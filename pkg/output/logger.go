@@ -0,0 +1,160 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// LevelNames lists the --log-level values, from most to least verbose
+var LevelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name a level has in JSON output
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Success:
+		return "success"
+	case Warning:
+		return "warn"
+	case Error:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// severity orders levels for filtering; success messages are progress
+// like info messages
+func (l Level) severity() int {
+	switch l {
+	case Debug:
+		return 0
+	case Warning:
+		return 2
+	case Error:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// ParseLevel returns the level named by a --log-level value
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return Debug, nil
+	case "info":
+		return Info, nil
+	case "warn", "warning":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+	return Info, fmt.Errorf("invalid log level '%s', must be one of: %s", name, strings.Join(LevelNames, ", "))
+}
+
+// Logger prints the messages at or above its level, either as prefixed
+// lines or, in JSON mode, as one JSON object per line. Each message is
+// written with a single Write call.
+type Logger struct {
+	w     io.Writer // nil writes to the current os.Stdout
+	level Level
+	json  bool
+	now   func() time.Time
+}
+
+// NewLogger creates a logger writing messages at or above level to w
+func NewLogger(w io.Writer, level Level, json bool) *Logger {
+	return &Logger{w: w, level: level, json: json, now: time.Now}
+}
+
+// defaultLogger is the logger of the CLI, configured by its global flags
+var defaultLogger = NewLogger(nil, Info, false)
+
+// Default returns the shared logger that components log to unless they are
+// given one
+func Default() *Logger {
+	return defaultLogger
+}
+
+// SetDefault replaces the shared logger
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// Level returns the lowest level the logger prints
+func (l *Logger) Level() Level {
+	return l.level
+}
+
+// WithLevel returns a copy of the logger printing messages at or above level
+func (l *Logger) WithLevel(level Level) *Logger {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+// WithVerbose returns the logger, printing debug messages too if verbose
+func (l *Logger) WithVerbose(verbose bool) *Logger {
+	if !verbose || l.Enabled(Debug) {
+		return l
+	}
+	return l.WithLevel(Debug)
+}
+
+// WithWriter returns a copy of the logger writing to w
+func (l *Logger) WithWriter(w io.Writer) *Logger {
+	copied := *l
+	copied.w = w
+	return &copied
+}
+
+// Enabled reports whether the logger prints messages of a level
+func (l *Logger) Enabled(level Level) bool {
+	return level.severity() >= l.level.severity()
+}
+
+// JSON reports whether the logger prints JSON objects
+func (l *Logger) JSON() bool {
+	return l.json
+}
+
+// Writer returns where the logger writes
+func (l *Logger) Writer() io.Writer {
+	if l.w == nil {
+		return os.Stdout
+	}
+	return l.w
+}
+
+// Logf prints a message at a level
+func (l *Logger) Logf(level Level, format string, args ...interface{}) {
+	l.Fprintf(l.Writer(), level, format, args...)
+}
+
+// Fprintf prints a message at a level to w instead of the logger's writer,
+// such as a build's progress display
+func (l *Logger) Fprintf(w io.Writer, level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if !l.json {
+		io.WriteString(w, Prefix(level)+message+"\n")
+		return
+	}
+	line, err := json.Marshal(struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"msg"`
+	}{l.now().UTC().Format(time.RFC3339Nano), level.String(), message})
+	if err != nil {
+		return
+	}
+	w.Write(append(line, '\n'))
+}
@@ -0,0 +1,79 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+func TestLogger(t *testing.T) {
+	originalNoColor := color.NoColor
+	defer func() {
+		color.NoColor = originalNoColor
+		SetASCII(false)
+	}()
+	SetColor(false)
+	SetASCII(true)
+
+	tests := []struct {
+		name     string
+		level    Level
+		json     bool
+		expected string
+	}{
+		{
+			name:     "info",
+			level:    Info,
+			expected: "[INFO] deploying web\n[OK] web started\n[WARN] web is slow\n",
+		},
+		{
+			name:     "debug",
+			level:    Debug,
+			expected: "[DEBUG] Executing: pct start 101\n[INFO] deploying web\n[OK] web started\n[WARN] web is slow\n",
+		},
+		{
+			name:     "warnings only",
+			level:    Warning,
+			expected: "[WARN] web is slow\n",
+		},
+		{
+			name:  "json",
+			level: Info,
+			json:  true,
+			expected: `{"time":"2024-01-01T12:00:00Z","level":"info","msg":"deploying web"}
+{"time":"2024-01-01T12:00:00Z","level":"success","msg":"web started"}
+{"time":"2024-01-01T12:00:00Z","level":"warn","msg":"web is slow"}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := NewLogger(&buf, tt.level, tt.json)
+			logger.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+			logger.Logf(Debug, "Executing: pct start %d", 101)
+			logger.Logf(Info, "deploying %s", "web")
+			logger.Logf(Success, "web started")
+			logger.Logf(Warning, "web is slow")
+
+			if buf.String() != tt.expected {
+				t.Errorf("output = %q, want %q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"debug": Debug, "INFO": Info, "warn": Warning, "warning": Warning, "error": Error} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("trace"); err == nil {
+		t.Error("ParseLevel(\"trace\") expected error")
+	}
+}
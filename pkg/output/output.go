@@ -0,0 +1,76 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fatih/color"
+)
+
+// Level identifies the kind of message being printed
+type Level int
+
+const (
+	Info Level = iota
+	Success
+	Warning
+	Error
+)
+
+// Debug is the level of detail messages, such as the commands pxc runs,
+// which a Logger only prints when its level is Debug
+const Debug Level = -1
+
+// asciiMode replaces unicode glyphs with bracketed text labels
+var asciiMode bool
+
+// SetColor enables or disables ANSI colors for all output
+func SetColor(enabled bool) {
+	color.NoColor = !enabled
+}
+
+// SetASCII enables or disables ASCII-only message prefixes
+func SetASCII(enabled bool) {
+	asciiMode = enabled
+}
+
+// IsASCII returns true if ASCII-only output is enabled
+func IsASCII() bool {
+	return asciiMode
+}
+
+// Prefix returns the message prefix for a level, e.g. "✓ " or "[OK] "
+func Prefix(level Level) string {
+	switch level {
+	case Debug:
+		if asciiMode {
+			return color.HiBlackString("[DEBUG] ")
+		}
+		return color.HiBlackString("· ")
+	case Success:
+		if asciiMode {
+			return color.GreenString("[OK] ")
+		}
+		return color.GreenString("✓ ")
+	case Warning:
+		if asciiMode {
+			return color.YellowString("[WARN] ")
+		}
+		return color.YellowString("⚠ ")
+	case Error:
+		if asciiMode {
+			return color.RedString("[ERROR] ")
+		}
+		return color.RedString("✗ ")
+	default:
+		if asciiMode {
+			return color.BlueString("[INFO] ")
+		}
+		return color.BlueString("ℹ ")
+	}
+}
+
+// Fprintf writes a single prefixed message line to w
+func Fprintf(w io.Writer, level Level, format string, args ...interface{}) {
+	fmt.Fprintf(w, Prefix(level)+format+"\n", args...)
+}
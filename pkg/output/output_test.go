@@ -0,0 +1,93 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestFprintf(t *testing.T) {
+	originalNoColor := color.NoColor
+	defer func() {
+		color.NoColor = originalNoColor
+		SetASCII(false)
+	}()
+
+	tests := []struct {
+		name     string
+		color    bool
+		ascii    bool
+		level    Level
+		expected string
+	}{
+		{
+			name:     "plain unicode info",
+			level:    Info,
+			expected: "ℹ deploying web\n",
+		},
+		{
+			name:     "plain unicode success",
+			level:    Success,
+			expected: "✓ deploying web\n",
+		},
+		{
+			name:     "ascii info",
+			ascii:    true,
+			level:    Info,
+			expected: "[INFO] deploying web\n",
+		},
+		{
+			name:     "ascii success",
+			ascii:    true,
+			level:    Success,
+			expected: "[OK] deploying web\n",
+		},
+		{
+			name:     "ascii warning",
+			ascii:    true,
+			level:    Warning,
+			expected: "[WARN] deploying web\n",
+		},
+		{
+			name:     "ascii error",
+			ascii:    true,
+			level:    Error,
+			expected: "[ERROR] deploying web\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetColor(tt.color)
+			SetASCII(tt.ascii)
+
+			var buf bytes.Buffer
+			Fprintf(&buf, tt.level, "deploying %s", "web")
+
+			if buf.String() != tt.expected {
+				t.Errorf("Fprintf() = %q, want %q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestPrefixWithColor(t *testing.T) {
+	originalNoColor := color.NoColor
+	defer func() {
+		color.NoColor = originalNoColor
+		SetASCII(false)
+	}()
+
+	SetColor(true)
+	SetASCII(true)
+
+	prefix := Prefix(Warning)
+	if !strings.Contains(prefix, "\x1b[") {
+		t.Errorf("Prefix() = %q, expected ANSI color codes when color is enabled", prefix)
+	}
+	if !strings.Contains(prefix, "[WARN]") {
+		t.Errorf("Prefix() = %q, expected ASCII label", prefix)
+	}
+}
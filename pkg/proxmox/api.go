@@ -0,0 +1,574 @@
+package proxmox
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+// Transports select how pxc talks to Proxmox
+const (
+	TransportPCT = "pct" // Run pct and pvesm on the node itself
+	TransportAPI = "api" // Call the Proxmox VE HTTP API, from anywhere
+)
+
+// ErrAPIUnsupported is returned for operations the Proxmox VE HTTP API does
+// not offer for containers, such as running commands in them
+var ErrAPIUnsupported = errors.New("not supported by the Proxmox API transport, run pxc on the node with transport pct")
+
+// APIConfig configures access to the Proxmox VE HTTP API with an API token
+type APIConfig struct {
+	URL         string // e.g. https://pve.example.com:8006
+	TokenID     string // USER@REALM!TOKENID, e.g. pxc@pve!laptop
+	TokenSecret string
+	Insecure    bool // Skip TLS certificate verification, for self-signed certificates
+}
+
+// Validate checks that the API can be reached with the configuration
+func (c APIConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("api_url is required for the api transport")
+	}
+	parsed, err := url.Parse(c.URL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("invalid api_url '%s', expected e.g. https://pve.example.com:8006", c.URL)
+	}
+	if user, token, found := strings.Cut(c.TokenID, "!"); !found || !strings.Contains(user, "@") || token == "" {
+		return fmt.Errorf("invalid api_token_id '%s', expected USER@REALM!TOKENID", c.TokenID)
+	}
+	if c.TokenSecret == "" {
+		return fmt.Errorf("api_token_secret is required for the api transport")
+	}
+	return nil
+}
+
+// APIClient manages containers through the Proxmox VE HTTP API. It offers
+// the container lifecycle of Client without needing to run on the node,
+// but cannot run commands in containers or copy files into them.
+type APIClient struct {
+	node   string
+	config APIConfig
+	http   *http.Client
+	log    *output.Logger
+	dryRun bool
+
+	// taskPoll and taskTimeout pace waiting for asynchronous tasks
+	taskPoll    time.Duration
+	taskTimeout time.Duration
+}
+
+// NewAPIClient creates a client for the containers of a node through the
+// HTTP API
+func NewAPIClient(node string, config APIConfig, verbose, dryRun bool) *APIClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &APIClient{
+		node:        node,
+		config:      config,
+		http:        &http.Client{Transport: transport, Timeout: time.Minute},
+		log:         output.Default().WithVerbose(verbose),
+		dryRun:      dryRun,
+		taskPoll:    time.Second,
+		taskTimeout: 10 * time.Minute,
+	}
+}
+
+// WithLogger makes the client log to l and returns it
+func (c *APIClient) WithLogger(l *output.Logger) *APIClient {
+	c.log = l
+	return c
+}
+
+// apiError is an error response of the API
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("proxmox API returned %d: %s", e.status, e.message)
+}
+
+// request calls the API and decodes the data of its response into result,
+// if not nil. Parameters go in the query of GET and DELETE requests and in
+// the form body otherwise. Every request is recorded in the audit log.
+// The request stops when ctx is done.
+func (c *APIClient) request(ctx context.Context, method, path string, params url.Values, result interface{}) (err error) {
+	if c.node == "" {
+		return fmt.Errorf("no Proxmox node set, set proxmox_node or --node for the api transport")
+	}
+
+	start := time.Now()
+	status := 0
+	defer func() {
+		recordAudit("proxmox-api", []string{method, path}, start, status, err)
+	}()
+
+	endpoint := strings.TrimRight(c.config.URL, "/") + "/api2/json" + path
+	var body io.Reader
+	if method == http.MethodGet || method == http.MethodDelete {
+		if len(params) > 0 {
+			endpoint += "?" + params.Encode()
+		}
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create API request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("PVEAPIToken=%s=%s", c.config.TokenID, c.config.TokenSecret))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	c.log.Logf(output.Debug, "Requesting: %s %s", method, path)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		status = -1
+		return fmt.Errorf("proxmox API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		status = -1
+		return fmt.Errorf("failed to read API response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		status = resp.StatusCode
+		return &apiError{status: resp.StatusCode, message: apiErrorMessage(resp.Status, data)}
+	}
+
+	if result == nil {
+		return nil
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("failed to parse API response: %w", err)
+	}
+	if err := json.Unmarshal(envelope.Data, result); err != nil {
+		return fmt.Errorf("failed to parse API response: %w", err)
+	}
+	return nil
+}
+
+// apiErrorMessage extracts the reason for a failed request: the parameter
+// errors of the response if any, else its status line
+func apiErrorMessage(status string, body []byte) string {
+	var response struct {
+		Message string            `json:"message"`
+		Errors  map[string]string `json:"errors"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return status
+	}
+	if len(response.Errors) > 0 {
+		var reasons []string
+		for param, reason := range response.Errors {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", param, strings.TrimSpace(reason)))
+		}
+		return strings.Join(reasons, ", ")
+	}
+	if message := strings.TrimSpace(response.Message); message != "" {
+		return message
+	}
+	return status
+}
+
+// nodePath returns an API path below the client's node
+func (c *APIClient) nodePath(format string, args ...interface{}) string {
+	return "/nodes/" + url.PathEscape(c.node) + fmt.Sprintf(format, args...)
+}
+
+// task starts an asynchronous operation and waits for the task it returns
+func (c *APIClient) task(ctx context.Context, method, path string, params url.Values) error {
+	var upid string
+	if err := c.request(ctx, method, path, params, &upid); err != nil {
+		return err
+	}
+	if upid == "" {
+		return nil
+	}
+	return c.waitTask(ctx, upid)
+}
+
+// waitTask polls a task until it stops, failing if it did not end with OK
+func (c *APIClient) waitTask(ctx context.Context, upid string) error {
+	deadline := time.Now().Add(c.taskTimeout)
+	for {
+		var status struct {
+			Status     string `json:"status"`
+			ExitStatus string `json:"exitstatus"`
+		}
+		if err := c.request(ctx, http.MethodGet, c.nodePath("/tasks/%s/status", url.PathEscape(upid)), nil, &status); err != nil {
+			if ctx.Err() != nil {
+				c.stopTask(ctx, upid)
+			}
+			return fmt.Errorf("failed to get status of task %s: %w", upid, err)
+		}
+		if status.Status == "stopped" {
+			if status.ExitStatus != "OK" {
+				return fmt.Errorf("task %s failed: %s", upid, status.ExitStatus)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("task %s did not finish within %v", upid, c.taskTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			c.stopTask(ctx, upid)
+			return fmt.Errorf("task %s: %w", upid, ctx.Err())
+		case <-time.After(c.taskPoll):
+		}
+	}
+}
+
+// stopTask asks the node to stop a task that is no longer waited for
+func (c *APIClient) stopTask(ctx context.Context, upid string) {
+	ctx = context.WithoutCancel(ctx)
+	if err := c.request(ctx, http.MethodDelete, c.nodePath("/tasks/%s", url.PathEscape(upid)), nil, nil); err != nil {
+		c.log.Logf(output.Warning, "Failed to stop task %s: %v", upid, err)
+	}
+}
+
+// apiContainer is a container as listed by the API
+type apiContainer struct {
+	VMID    json.Number `json:"vmid"`
+	Name    string      `json:"name"`
+	Status  string      `json:"status"`
+	Lock    string      `json:"lock"`
+	CPUs    float64     `json:"cpus"`
+	CPU     float64     `json:"cpu"` // Share of its cores in use, 1 for all of them
+	MaxMem  int64       `json:"maxmem"`
+	Mem     int64       `json:"mem"`
+	MaxDisk int64       `json:"maxdisk"`
+	Uptime  int64       `json:"uptime"`
+	PID     json.Number `json:"pid"`
+	Tags    string      `json:"tags"`
+
+	// Counters since the container started
+	DiskRead  int64 `json:"diskread"`
+	DiskWrite int64 `json:"diskwrite"`
+	NetIn     int64 `json:"netin"`
+	NetOut    int64 `json:"netout"`
+}
+
+// info converts an API container to ContainerInfo
+func (a apiContainer) info() ContainerInfo {
+	vmid, _ := a.VMID.Int64()
+	pid, _ := a.PID.Int64()
+	return ContainerInfo{
+		VMID:        int(vmid),
+		Name:        a.Name,
+		Status:      a.Status,
+		Lock:        a.Lock,
+		CPUs:        a.CPUs,
+		CPUUsage:    a.CPU * a.CPUs * 100,
+		Memory:      a.MaxMem,
+		MemoryUsage: a.Mem,
+		Disk:        a.MaxDisk,
+		Uptime:      a.Uptime,
+		PID:         int(pid),
+		Tags:        strings.ReplaceAll(a.Tags, ";", ","),
+	}
+}
+
+// ListContainers returns the containers of the node
+func (c *APIClient) ListContainers() ([]ContainerInfo, error) {
+	var listed []apiContainer
+	if err := c.request(context.Background(), http.MethodGet, c.nodePath("/lxc"), nil, &listed); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	containers := make([]ContainerInfo, 0, len(listed))
+	for _, container := range listed {
+		containers = append(containers, container.info())
+	}
+	return containers, nil
+}
+
+// GetContainer returns the current status of a container. Like
+// ListContainers, it reads the API in a dry run too.
+func (c *APIClient) GetContainer(ctx context.Context, vmid int) (*ContainerInfo, error) {
+	var current apiContainer
+	err := c.request(ctx, http.MethodGet, c.nodePath("/lxc/%d/status/current", vmid), nil, &current)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.message, "does not exist") {
+		return nil, fmt.Errorf("container %d %w", vmid, ErrContainerNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container %d: %w", vmid, err)
+	}
+
+	info := current.info()
+	info.VMID = vmid
+	return &info, nil
+}
+
+// ReadContainerStats returns the usage of a container as Proxmox last
+// measured it. The CPU usage is Proxmox's own average, so it needs no
+// earlier sample.
+func (c *APIClient) ReadContainerStats(vmid int) (*ContainerMetrics, error) {
+	if c.dryRun {
+		return &ContainerMetrics{ReadAt: time.Now()}, nil
+	}
+
+	var current apiContainer
+	if err := c.request(context.Background(), http.MethodGet, c.nodePath("/lxc/%d/status/current", vmid), nil, &current); err != nil {
+		return nil, fmt.Errorf("failed to read usage of container %d: %w", vmid, err)
+	}
+	if current.Status != "running" {
+		return nil, fmt.Errorf("container %d is %s", vmid, current.Status)
+	}
+	return &ContainerMetrics{
+		CPUAverage:    current.CPU * current.CPUs * 100,
+		MemoryCurrent: current.Mem,
+		MemoryLimit:   current.MaxMem,
+		BlockRead:     current.DiskRead,
+		BlockWrite:    current.DiskWrite,
+		NetRx:         current.NetIn,
+		NetTx:         current.NetOut,
+		ReadAt:        time.Now(),
+	}, nil
+}
+
+// containerParams returns the API parameters of a container's settings
+func containerParams(config *ContainerConfig) url.Values {
+	params := url.Values{}
+	if config.Memory > 0 {
+		params.Set("memory", strconv.Itoa(config.Memory))
+	}
+	if config.Cores > 0 {
+		params.Set("cores", strconv.Itoa(config.Cores))
+	}
+	if config.OSType != "" {
+		params.Set("ostype", config.OSType)
+	}
+	if len(config.Tags) > 0 {
+		params.Set("tags", strings.Join(config.Tags, ";"))
+	}
+
+	if config.Net0 != "" {
+		params.Set("net0", config.Net0)
+	}
+	for i, net := range config.Nets {
+		params.Set(fmt.Sprintf("net%d", i+1), net)
+	}
+	if len(config.DNS) > 0 {
+		params.Set("nameserver", strings.Join(config.DNS, " "))
+	}
+	if len(config.DNSSearch) > 0 {
+		params.Set("searchdomain", strings.Join(config.DNSSearch, " "))
+	}
+	for key, value := range config.MountPoints {
+		params.Set(key, value)
+	}
+	return params
+}
+
+// CreateContainer creates a container from a template archive, or clones
+// it from a template container if template is a container ID
+func (c *APIClient) CreateContainer(ctx context.Context, vmid int, template string, config *ContainerConfig) error {
+	if len(config.LXC) > 0 {
+		return fmt.Errorf("raw lxc settings of container %d: %w", vmid, ErrAPIUnsupported)
+	}
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would create container %d from template %s via the API", vmid, template)
+		return nil
+	}
+
+	if _, err := strconv.Atoi(template); err == nil {
+		clone := url.Values{"newid": {strconv.Itoa(vmid)}}
+		if config.Hostname != "" {
+			clone.Set("hostname", config.Hostname)
+		}
+		if err := c.task(ctx, http.MethodPost, c.nodePath("/lxc/%s/clone", template), clone); err != nil {
+			return fmt.Errorf("failed to clone container %s: %w", template, err)
+		}
+		if err := c.request(ctx, http.MethodPut, c.nodePath("/lxc/%d/config", vmid), containerParams(config), nil); err != nil {
+			return fmt.Errorf("failed to configure container %d: %w", vmid, err)
+		}
+		return nil
+	}
+
+	// A clone keeps the interfaces of its template unless some are
+	// configured; a new container gets the default one, as with pct create
+	params := containerParams(config)
+	if config.Net0 == "" {
+		params.Set("net0", "name=eth0,bridge=vmbr0,ip=dhcp,type=veth")
+	}
+	params.Set("vmid", strconv.Itoa(vmid))
+	params.Set("ostemplate", template)
+	if config.Hostname != "" {
+		params.Set("hostname", config.Hostname)
+	}
+	if config.Storage != "" {
+		params.Set("storage", config.Storage)
+	}
+	if err := c.task(ctx, http.MethodPost, c.nodePath("/lxc"), params); err != nil {
+		return fmt.Errorf("failed to create container %d: %w", vmid, err)
+	}
+	return nil
+}
+
+// statusTask changes the run state of a container, e.g. start
+func (c *APIClient) statusTask(ctx context.Context, vmid int, action string, params url.Values) error {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would %s container %d via the API", action, vmid)
+		return nil
+	}
+	if err := c.task(ctx, http.MethodPost, c.nodePath("/lxc/%d/status/%s", vmid, action), params); err != nil {
+		return fmt.Errorf("failed to %s container %d: %w", action, vmid, err)
+	}
+	return nil
+}
+
+// StartContainer starts a container
+func (c *APIClient) StartContainer(ctx context.Context, vmid int) error {
+	return c.statusTask(ctx, vmid, "start", nil)
+}
+
+// StopContainer stops a container immediately
+func (c *APIClient) StopContainer(ctx context.Context, vmid int) error {
+	return c.statusTask(ctx, vmid, "stop", nil)
+}
+
+// ShutdownContainer asks a container to shut down cleanly, waiting up to
+// timeout. A container that has not shut down by then is left running and
+// an error returned.
+func (c *APIClient) ShutdownContainer(ctx context.Context, vmid int, timeout time.Duration) error {
+	return c.statusTask(ctx, vmid, "shutdown", url.Values{
+		"timeout": {strconv.Itoa(int(timeout.Seconds()))},
+	})
+}
+
+// DestroyContainer destroys a stopped container
+func (c *APIClient) DestroyContainer(ctx context.Context, vmid int) error {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would destroy container %d via the API", vmid)
+		return nil
+	}
+	if err := c.task(ctx, http.MethodDelete, c.nodePath("/lxc/%d", vmid), nil); err != nil {
+		return fmt.Errorf("failed to destroy container %d: %w", vmid, err)
+	}
+	return nil
+}
+
+// ExecCommand is not available through the API
+func (c *APIClient) ExecCommand(ctx context.Context, vmid int, command []string) error {
+	return fmt.Errorf("running commands in container %d: %w", vmid, ErrAPIUnsupported)
+}
+
+// PushFile is not available through the API
+func (c *APIClient) PushFile(ctx context.Context, vmid int, source, dest string, opts PushOptions) error {
+	return fmt.Errorf("copying files into container %d: %w", vmid, ErrAPIUnsupported)
+}
+
+// GetContainerIP returns the first IPv4 address of a running container's
+// interfaces other than loopback
+func (c *APIClient) GetContainerIP(ctx context.Context, vmid int) (string, error) {
+	if c.dryRun {
+		return "127.0.0.1", nil
+	}
+
+	var interfaces []struct {
+		Name string `json:"name"`
+		Inet string `json:"inet"`
+	}
+	if err := c.request(ctx, http.MethodGet, c.nodePath("/lxc/%d/interfaces", vmid), nil, &interfaces); err != nil {
+		return "", fmt.Errorf("failed to get container IP: %w", err)
+	}
+	for _, iface := range interfaces {
+		if iface.Name == "lo" || iface.Inet == "" {
+			continue
+		}
+		address, _, _ := strings.Cut(iface.Inet, "/")
+		return address, nil
+	}
+	return "", fmt.Errorf("container %d has no IP address", vmid)
+}
+
+// IsVMIDFree reports whether no container or VM in the cluster uses vmid
+func (c *APIClient) IsVMIDFree(ctx context.Context, vmid int) (bool, error) {
+	if c.dryRun {
+		return true, nil
+	}
+
+	err := c.request(ctx, http.MethodGet, "/cluster/nextid", url.Values{"vmid": {strconv.Itoa(vmid)}}, nil)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.message, "already exists") {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check container ID %d: %w", vmid, err)
+	}
+	return true, nil
+}
+
+// GetInterfaceAddresses returns the IPv4 address of each interface of a
+// running container other than loopback, keyed by interface name
+func (c *APIClient) GetInterfaceAddresses(ctx context.Context, vmid int) (map[string]string, error) {
+	if c.dryRun {
+		return map[string]string{"eth0": "127.0.0.1"}, nil
+	}
+
+	var interfaces []struct {
+		Name string `json:"name"`
+		Inet string `json:"inet"`
+	}
+	if err := c.request(ctx, http.MethodGet, c.nodePath("/lxc/%d/interfaces", vmid), nil, &interfaces); err != nil {
+		return nil, fmt.Errorf("failed to get addresses of container %d: %w", vmid, err)
+	}
+	addresses := make(map[string]string)
+	for _, iface := range interfaces {
+		if iface.Name == "lo" || iface.Inet == "" {
+			continue
+		}
+		address, _, _ := strings.Cut(iface.Inet, "/")
+		addresses[iface.Name] = address
+	}
+	return addresses, nil
+}
+
+// GetNodeCapacity reports the node's memory and CPUs and the free space on
+// storage (skipped if storage is empty)
+func (c *APIClient) GetNodeCapacity(storage string) (*NodeCapacity, error) {
+	var status json.RawMessage
+	if err := c.request(context.Background(), http.MethodGet, c.nodePath("/status"), nil, &status); err != nil {
+		return nil, fmt.Errorf("failed to get node status: %w", err)
+	}
+	capacity, err := parseNodeStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	if storage == "" {
+		return capacity, nil
+	}
+
+	var storageStatus struct {
+		Avail int64 `json:"avail"`
+	}
+	if err := c.request(context.Background(), http.MethodGet, c.nodePath("/storage/%s/status", url.PathEscape(storage)), nil, &storageStatus); err != nil {
+		return nil, fmt.Errorf("failed to get status of storage %s: %w", storage, err)
+	}
+	capacity.Storage = storage
+	capacity.DiskFreeGB = storageStatus.Avail >> 30
+	return capacity, nil
+}
@@ -0,0 +1,347 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI serves canned Proxmox API responses keyed by "METHOD path" and
+// records the requests it receives with their parameters
+type fakeAPI struct {
+	t         *testing.T
+	mu        sync.Mutex
+	responses map[string]interface{} // Data to return, or an *apiError
+	requests  []string
+	params    map[string]map[string]string
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, *APIClient) {
+	t.Helper()
+
+	fake := &fakeAPI{t: t, responses: make(map[string]interface{}), params: make(map[string]map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := NewAPIClient("pve", APIConfig{URL: server.URL, TokenID: "pxc@pve!test", TokenSecret: "s3cret"}, false, false)
+	client.taskPoll = time.Millisecond
+	return fake, client
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get("Authorization"); got != "PVEAPIToken=pxc@pve!test=s3cret" {
+		f.t.Errorf("Authorization = %q", got)
+	}
+	if err := r.ParseForm(); err != nil {
+		f.t.Errorf("invalid request parameters: %v", err)
+	}
+
+	key := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/api2/json")
+	f.mu.Lock()
+	f.requests = append(f.requests, key)
+	params := make(map[string]string)
+	for name := range r.Form {
+		params[name] = r.Form.Get(name)
+	}
+	f.params[key] = params
+	response, ok := f.responses[key]
+	f.mu.Unlock()
+
+	if apiErr, isErr := response.(*apiError); isErr {
+		w.WriteHeader(apiErr.status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": nil, "message": apiErr.message})
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": response})
+}
+
+// task makes an operation return a task that finished with exitStatus
+func (f *fakeAPI) task(key, upid, exitStatus string) {
+	f.responses[key] = upid
+	f.responses["GET /nodes/pve/tasks/"+upid+"/status"] = map[string]string{"status": "stopped", "exitstatus": exitStatus}
+}
+
+func TestAPIConfigValidate(t *testing.T) {
+	valid := APIConfig{URL: "https://pve.example.com:8006", TokenID: "pxc@pve!laptop", TokenSecret: "secret"}
+
+	tests := []struct {
+		name    string
+		modify  func(*APIConfig)
+		wantErr string
+	}{
+		{name: "valid", modify: func(*APIConfig) {}},
+		{name: "missing url", modify: func(c *APIConfig) { c.URL = "" }, wantErr: "api_url is required"},
+		{name: "url without scheme", modify: func(c *APIConfig) { c.URL = "pve.example.com:8006" }, wantErr: "invalid api_url"},
+		{name: "token id without realm", modify: func(c *APIConfig) { c.TokenID = "pxc!laptop" }, wantErr: "invalid api_token_id"},
+		{name: "token id without token", modify: func(c *APIConfig) { c.TokenID = "pxc@pve" }, wantErr: "invalid api_token_id"},
+		{name: "missing secret", modify: func(c *APIConfig) { c.TokenSecret = "" }, wantErr: "api_token_secret is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIClientCreateContainer(t *testing.T) {
+	t.Run("from template archive", func(t *testing.T) {
+		fake, client := newFakeAPI(t)
+		fake.task("POST /nodes/pve/lxc", "UPID:pve:1:create", "OK")
+
+		err := client.CreateContainer(context.Background(), 101, "local:vztmpl/debian-12.tar.zst", &ContainerConfig{
+			Hostname: "web",
+			Memory:   512,
+			Cores:    2,
+			Storage:  "local-lvm",
+			OSType:   "debian",
+			Nets:     []string{"name=eth1,bridge=vmbr1"},
+			DNS:      []string{"1.1.1.1", "8.8.8.8"},
+		})
+		if err != nil {
+			t.Fatalf("CreateContainer() unexpected error: %v", err)
+		}
+
+		want := map[string]string{
+			"vmid":       "101",
+			"ostemplate": "local:vztmpl/debian-12.tar.zst",
+			"hostname":   "web",
+			"memory":     "512",
+			"cores":      "2",
+			"storage":    "local-lvm",
+			"ostype":     "debian",
+			"net0":       "name=eth0,bridge=vmbr0,ip=dhcp,type=veth",
+			"net1":       "name=eth1,bridge=vmbr1",
+			"nameserver": "1.1.1.1 8.8.8.8",
+		}
+		if got := fake.params["POST /nodes/pve/lxc"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("create parameters = %v, want %v", got, want)
+		}
+		if last := fake.requests[len(fake.requests)-1]; last != "GET /nodes/pve/tasks/UPID:pve:1:create/status" {
+			t.Errorf("last request = %s, want the create task to be awaited", last)
+		}
+	})
+
+	t.Run("clone of template container", func(t *testing.T) {
+		fake, client := newFakeAPI(t)
+		fake.task("POST /nodes/pve/lxc/9001/clone", "UPID:pve:2:clone", "OK")
+		fake.responses["PUT /nodes/pve/lxc/102/config"] = nil
+
+		if err := client.CreateContainer(context.Background(), 102, "9001", &ContainerConfig{Hostname: "api", Memory: 1024}); err != nil {
+			t.Fatalf("CreateContainer() unexpected error: %v", err)
+		}
+		want := []string{
+			"POST /nodes/pve/lxc/9001/clone",
+			"GET /nodes/pve/tasks/UPID:pve:2:clone/status",
+			"PUT /nodes/pve/lxc/102/config",
+		}
+		if !reflect.DeepEqual(fake.requests, want) {
+			t.Errorf("requests = %v, want %v", fake.requests, want)
+		}
+		if got := fake.params["POST /nodes/pve/lxc/9001/clone"]; got["newid"] != "102" || got["hostname"] != "api" {
+			t.Errorf("clone parameters = %v", got)
+		}
+		if got := fake.params["PUT /nodes/pve/lxc/102/config"]; got["memory"] != "1024" {
+			t.Errorf("config parameters = %v, want memory 1024", got)
+		}
+		if got, set := fake.params["PUT /nodes/pve/lxc/102/config"]["net0"]; set {
+			t.Errorf("config parameters set net0 %q, want the template's interfaces kept", got)
+		}
+	})
+
+	t.Run("failed task", func(t *testing.T) {
+		fake, client := newFakeAPI(t)
+		fake.task("POST /nodes/pve/lxc", "UPID:pve:3:create", "storage 'fast' does not exist")
+
+		err := client.CreateContainer(context.Background(), 103, "local:vztmpl/debian-12.tar.zst", &ContainerConfig{})
+		if err == nil || !strings.Contains(err.Error(), "storage 'fast' does not exist") {
+			t.Errorf("CreateContainer() error = %v, want the task's exit status", err)
+		}
+	})
+
+	t.Run("raw lxc settings", func(t *testing.T) {
+		fake, client := newFakeAPI(t)
+		err := client.CreateContainer(context.Background(), 104, "local:vztmpl/debian-12.tar.zst", &ContainerConfig{LXC: []string{"lxc.cap.drop: sys_admin"}})
+		if !errors.Is(err, ErrAPIUnsupported) {
+			t.Errorf("CreateContainer() error = %v, want ErrAPIUnsupported", err)
+		}
+		if len(fake.requests) != 0 {
+			t.Errorf("requests = %v, want none", fake.requests)
+		}
+	})
+}
+
+func TestAPIClientLifecycle(t *testing.T) {
+	fake, client := newFakeAPI(t)
+	fake.task("POST /nodes/pve/lxc/101/status/start", "UPID:start", "OK")
+	fake.task("POST /nodes/pve/lxc/101/status/shutdown", "UPID:shutdown", "OK")
+	fake.task("DELETE /nodes/pve/lxc/101", "UPID:destroy", "OK")
+
+	if err := client.StartContainer(context.Background(), 101); err != nil {
+		t.Errorf("StartContainer() unexpected error: %v", err)
+	}
+	if err := client.ShutdownContainer(context.Background(), 101, 30*time.Second); err != nil {
+		t.Errorf("ShutdownContainer() unexpected error: %v", err)
+	}
+	if got := fake.params["POST /nodes/pve/lxc/101/status/shutdown"]; got["timeout"] != "30" || got["forceStop"] != "" {
+		t.Errorf("shutdown parameters = %v, want timeout 30 without forceStop", got)
+	}
+	if err := client.DestroyContainer(context.Background(), 101); err != nil {
+		t.Errorf("DestroyContainer() unexpected error: %v", err)
+	}
+
+	fake.responses["POST /nodes/pve/lxc/101/status/stop"] = &apiError{status: http.StatusForbidden, message: "Permission check failed (/vms/101, VM.PowerMgmt)"}
+	if err := client.StopContainer(context.Background(), 101); err == nil || !strings.Contains(err.Error(), "VM.PowerMgmt") {
+		t.Errorf("StopContainer() error = %v, want the permission error", err)
+	}
+}
+
+func TestAPIClientCancelStopsTask(t *testing.T) {
+	fake, client := newFakeAPI(t)
+	fake.responses["POST /nodes/pve/lxc/101/status/start"] = "UPID:start"
+	fake.responses["GET /nodes/pve/tasks/UPID:start/status"] = map[string]string{"status": "running"}
+	fake.responses["DELETE /nodes/pve/tasks/UPID:start"] = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	if err := client.StartContainer(ctx, 101); !errors.Is(err, context.Canceled) {
+		t.Fatalf("StartContainer() error = %v, want context.Canceled", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if last := fake.requests[len(fake.requests)-1]; last != "DELETE /nodes/pve/tasks/UPID:start" {
+		t.Errorf("last request = %q, want the task to be stopped", last)
+	}
+}
+
+func TestAPIClientGetContainer(t *testing.T) {
+	fake, client := newFakeAPI(t)
+	fake.responses["GET /nodes/pve/lxc/101/status/current"] = map[string]interface{}{
+		"vmid": 101, "name": "web", "status": "running", "maxmem": 536870912, "tags": "pxc;web",
+	}
+	fake.responses["GET /nodes/pve/lxc/999/status/current"] = &apiError{status: http.StatusInternalServerError, message: "Configuration file 'nodes/pve/lxc/999.conf' does not exist"}
+	fake.responses["GET /nodes/pve/lxc/101/interfaces"] = []map[string]string{
+		{"name": "lo", "inet": "127.0.0.1/8"},
+		{"name": "eth0", "inet": "10.0.0.5/24"},
+	}
+
+	container, err := client.GetContainer(context.Background(), 101)
+	if err != nil {
+		t.Fatalf("GetContainer() unexpected error: %v", err)
+	}
+	want := ContainerInfo{VMID: 101, Name: "web", Status: "running", Memory: 536870912, Tags: "pxc,web"}
+	if !reflect.DeepEqual(*container, want) {
+		t.Errorf("GetContainer() = %+v, want %+v", *container, want)
+	}
+
+	if _, err := client.GetContainer(context.Background(), 999); err == nil || err.Error() != "container 999 not found" {
+		t.Errorf("GetContainer() error = %v, want container 999 not found", err)
+	}
+
+	ip, err := client.GetContainerIP(context.Background(), 101)
+	if err != nil || ip != "10.0.0.5" {
+		t.Errorf("GetContainerIP() = %q, %v, want 10.0.0.5", ip, err)
+	}
+}
+
+func TestAPIClientListStorageVolumes(t *testing.T) {
+	fake, client := newFakeAPI(t)
+	fake.responses["GET /nodes/pve/storage/local/content"] = []map[string]interface{}{
+		{"volid": "local:vztmpl/debian-12.tar.zst", "format": "tzst", "content": "vztmpl", "size": 125829120},
+		{"volid": "local:base-9000-disk-0", "format": "raw", "content": "rootdir", "size": 2147483648, "vmid": 9000},
+	}
+
+	volumes, err := client.ListStorageVolumes("local", "vztmpl", 0)
+	if err != nil {
+		t.Fatalf("ListStorageVolumes() unexpected error: %v", err)
+	}
+	want := []StorageVolume{
+		{VolID: "local:vztmpl/debian-12.tar.zst", Format: "tzst", Type: "vztmpl", Size: 125829120},
+		{VolID: "local:base-9000-disk-0", Format: "raw", Type: "rootdir", Size: 2147483648, VMID: 9000},
+	}
+	if !reflect.DeepEqual(volumes, want) {
+		t.Errorf("ListStorageVolumes() = %+v, want %+v", volumes, want)
+	}
+	if got := fake.params["GET /nodes/pve/storage/local/content"]; !reflect.DeepEqual(got, map[string]string{"content": "vztmpl"}) {
+		t.Errorf("parameters = %v, want content vztmpl", got)
+	}
+}
+
+func TestAPIClientDownloadTemplate(t *testing.T) {
+	fake, client := newFakeAPI(t)
+	fake.responses["GET /nodes/pve/storage"] = []map[string]interface{}{{"storage": "local", "type": "dir"}}
+	fake.task("POST /nodes/pve/aplinfo", "UPID:download", "OK")
+
+	if err := client.DownloadTemplate(context.Background(), "local", "debian-12.tar.zst"); err != nil {
+		t.Fatalf("DownloadTemplate() unexpected error: %v", err)
+	}
+	if got := fake.params["GET /nodes/pve/storage"]; got["content"] != "vztmpl" {
+		t.Errorf("storage parameters = %v, want content vztmpl", got)
+	}
+
+	fake.requests = nil
+	err := client.DownloadTemplate(context.Background(), "local-lvm", "debian-12.tar.zst")
+	if err == nil || !strings.Contains(err.Error(), "storage 'local-lvm' on node pve does not support container templates") {
+		t.Errorf("DownloadTemplate() error = %v, want the storage to be rejected", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("requests = %q, want no download to a storage without vztmpl", fake.requests)
+	}
+}
+
+func TestAPIClientReadContainerStats(t *testing.T) {
+	fake, client := newFakeAPI(t)
+	fake.responses["GET /nodes/pve/lxc/101/status/current"] = map[string]interface{}{
+		"vmid": 101, "status": "running", "cpus": 2, "cpu": 0.25, "mem": 134217728, "maxmem": 536870912,
+		"diskread": 4096, "diskwrite": 1024, "netin": 2048, "netout": 512,
+	}
+	fake.responses["GET /nodes/pve/lxc/102/status/current"] = map[string]interface{}{"vmid": 102, "status": "stopped"}
+
+	metrics, err := client.ReadContainerStats(101)
+	if err != nil {
+		t.Fatalf("ReadContainerStats() unexpected error: %v", err)
+	}
+	metrics.ReadAt = time.Time{}
+	want := ContainerMetrics{CPUAverage: 50, MemoryCurrent: 134217728, MemoryLimit: 536870912,
+		BlockRead: 4096, BlockWrite: 1024, NetRx: 2048, NetTx: 512}
+	if *metrics != want {
+		t.Errorf("ReadContainerStats() = %+v, want %+v", *metrics, want)
+	}
+
+	if _, err := client.ReadContainerStats(102); err == nil || !strings.Contains(err.Error(), "stopped") {
+		t.Errorf("ReadContainerStats() error = %v, want container 102 is stopped", err)
+	}
+}
+
+func TestAPIClientUnsupported(t *testing.T) {
+	_, client := newFakeAPI(t)
+	if err := client.ExecCommand(context.Background(), 101, []string{"true"}); !errors.Is(err, ErrAPIUnsupported) {
+		t.Errorf("ExecCommand() error = %v, want ErrAPIUnsupported", err)
+	}
+	if err := client.PushFile(context.Background(), 101, "a", "/b", PushOptions{}); !errors.Is(err, ErrAPIUnsupported) {
+		t.Errorf("PushFile() error = %v, want ErrAPIUnsupported", err)
+	}
+}
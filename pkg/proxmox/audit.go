@@ -0,0 +1,184 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// redacted replaces secret values in audit records
+const redacted = "[REDACTED]"
+
+// AuditRecord is one executed command in the audit log
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	Args       []string  `json:"args"`
+	ExitStatus int       `json:"exit_status"` // -1 if the command could not be run
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// AuditLog writes audit records as JSON lines. It is safe for concurrent
+// use, so commands run by parallel builds do not interleave.
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAuditLog returns an audit log writing to w
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// OpenAuditLog opens an audit log file, appending to it if it exists. The
+// file is readable by its owner only.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return NewAuditLog(file), nil
+}
+
+// Record writes a record as one line
+func (l *AuditLog) Record(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// auditLog receives every command run through RunCommand and
+// CommandOutput; nil disables auditing
+var auditLog *AuditLog
+
+// SetAuditLog sets the audit log of executed commands, nil to disable it
+func SetAuditLog(log *AuditLog) {
+	auditLog = log
+}
+
+// RunCommand runs a command, recording it in the audit log. pxc runs pct
+// and the other Proxmox tools through it, or CommandOutput, so the log
+// covers builds, deployments and interactive commands alike.
+//
+// The output of the command is captured as well, so a failure returns a
+// *CommandError saying what went wrong.
+func RunCommand(cmd *exec.Cmd) error {
+	stdout, stderr := captureOutput(cmd)
+	start := time.Now()
+	err := cmd.Run()
+	AuditCommand(cmd, start, err)
+	if err != nil {
+		return newCommandError(cmd, err, stdout.String(), stderr.String())
+	}
+	return nil
+}
+
+// CommandOutput runs a command and returns its standard output, recording
+// it in the audit log. A failure returns a *CommandError.
+func CommandOutput(cmd *exec.Cmd) ([]byte, error) {
+	start := time.Now()
+	output, err := cmd.Output()
+	AuditCommand(cmd, start, err)
+	if err != nil {
+		return output, newCommandError(cmd, err, tail(string(output)), "")
+	}
+	return output, nil
+}
+
+// AuditCommand records a command that was started at start and finished
+// with err, for commands that are not run through RunCommand, such as
+// streamed ones. A log that cannot be written is reported on stderr
+// without failing the command.
+func AuditCommand(cmd *exec.Cmd, start time.Time, err error) {
+	name := filepath.Base(cmd.Path)
+	if len(cmd.Args) > 0 {
+		name = cmd.Args[0]
+	}
+	var args []string
+	if len(cmd.Args) > 1 {
+		args = cmd.Args[1:]
+	}
+
+	exitStatus := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitStatus = exitErr.ExitCode()
+		} else {
+			exitStatus = -1
+		}
+	}
+	recordAudit(name, args, start, exitStatus, err)
+}
+
+// recordAudit writes an audit record for a finished operation, redacting
+// its arguments
+func recordAudit(name string, args []string, start time.Time, exitStatus int, err error) {
+	log := auditLog
+	if log == nil {
+		return
+	}
+
+	record := AuditRecord{
+		Time:       start.UTC(),
+		Command:    name,
+		Args:       RedactArgs(args),
+		ExitStatus: exitStatus,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if err := log.Record(record); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// secretFlags take a secret as their value
+var secretFlags = map[string]bool{
+	"--password": true,
+	"--token":    true,
+	"--secret":   true,
+}
+
+// secretAssignment matches NAME=VALUE pairs, in an argument or a shell
+// script, whose name suggests a secret, e.g. DB_PASSWORD=hunter2
+var secretAssignment = regexp.MustCompile(`(?i)\b(\w*(?:pass|secret|token|key|credential|auth)\w*)=([^\s'"]+|'[^']*'|"[^"]*")`)
+
+// RedactArgs returns a copy of args with secrets replaced: the values of
+// flags such as --password, and of NAME=VALUE assignments whose name
+// mentions a password, secret, token, key, credential or auth
+func RedactArgs(args []string) []string {
+	redactedArgs := make([]string, len(args))
+	for i, arg := range args {
+		if i > 0 && secretFlags[args[i-1]] {
+			redactedArgs[i] = redacted
+			continue
+		}
+		// Also covers --password=VALUE
+		redactedArgs[i] = secretAssignment.ReplaceAllString(arg, "$1="+redacted)
+	}
+	return redactedArgs
+}
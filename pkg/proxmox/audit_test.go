@@ -0,0 +1,111 @@
+package proxmox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "password flag value",
+			args: []string{"create", "101", "local:vztmpl/debian.tar.zst", "--password", "hunter2", "--hostname", "web"},
+			want: []string{"create", "101", "local:vztmpl/debian.tar.zst", "--password", "[REDACTED]", "--hostname", "web"},
+		},
+		{
+			name: "password flag with equals",
+			args: []string{"create", "101", "--password=hunter2"},
+			want: []string{"create", "101", "--password=[REDACTED]"},
+		},
+		{
+			name: "environment assignment",
+			args: []string{"exec", "101", "--", "env", "DB_PASSWORD=hunter2", "API_TOKEN=abc123", "PORT=8080", "node", "server.js"},
+			want: []string{"exec", "101", "--", "env", "DB_PASSWORD=[REDACTED]", "API_TOKEN=[REDACTED]", "PORT=8080", "node", "server.js"},
+		},
+		{
+			name: "assignment in a shell script",
+			args: []string{"exec", "101", "--", "sh", "-c", "echo 'AWS_SECRET_ACCESS_KEY=wJalr' >> /etc/environment"},
+			want: []string{"exec", "101", "--", "sh", "-c", "echo 'AWS_SECRET_ACCESS_KEY=[REDACTED]' >> /etc/environment"},
+		},
+		{
+			name: "nothing secret",
+			args: []string{"push", "101", "/tmp/nginx.conf", "/etc/nginx/nginx.conf", "--perms", "0644"},
+			want: []string{"push", "101", "/tmp/nginx.conf", "/etc/nginx/nginx.conf", "--perms", "0644"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RedactArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandAudit(t *testing.T) {
+	var buf bytes.Buffer
+	SetAuditLog(NewAuditLog(&buf))
+	defer SetAuditLog(nil)
+
+	if err := RunCommand(exec.Command("sh", "-c", "exit 0", "DB_PASSWORD=hunter2")); err != nil {
+		t.Fatalf("RunCommand() unexpected error: %v", err)
+	}
+	if err := RunCommand(exec.Command("sh", "-c", "exit 3")); err == nil {
+		t.Fatal("RunCommand() expected error for exit status 3, got nil")
+	}
+	output, err := CommandOutput(exec.Command("echo", "--password", "hunter2"))
+	if err != nil {
+		t.Fatalf("CommandOutput() unexpected error: %v", err)
+	}
+	if string(output) != "--password hunter2\n" {
+		t.Errorf("CommandOutput() = %q, want the unredacted output", output)
+	}
+	if err := RunCommand(exec.Command("pxc-no-such-command")); err == nil {
+		t.Fatal("RunCommand() expected error for a missing command, got nil")
+	}
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("audit line %q is not JSON: %v", scanner.Text(), err)
+		}
+		if record.Time.IsZero() || record.DurationMS < 0 {
+			t.Errorf("audit record %+v lacks a time or duration", record)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 4 {
+		t.Fatalf("audit log has %d lines, want one per command:\n%s", len(records), buf.String())
+	}
+
+	want := []struct {
+		command    string
+		args       []string
+		exitStatus int
+	}{
+		{"sh", []string{"-c", "exit 0", "DB_PASSWORD=[REDACTED]"}, 0},
+		{"sh", []string{"-c", "exit 3"}, 3},
+		{"echo", []string{"--password", "[REDACTED]"}, 0},
+		{"pxc-no-such-command", []string{}, -1},
+	}
+	for i, w := range want {
+		record := records[i]
+		if record.Command != w.command || !reflect.DeepEqual(record.Args, w.args) || record.ExitStatus != w.exitStatus {
+			t.Errorf("record %d = %s %q exit %d, want %s %q exit %d", i, record.Command, record.Args, record.ExitStatus, w.command, w.args, w.exitStatus)
+		}
+		if (w.exitStatus != 0) != (record.Error != "") {
+			t.Errorf("record %d error = %q, want one only for failed commands", i, record.Error)
+		}
+	}
+}
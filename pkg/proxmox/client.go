@@ -1,41 +1,56 @@
 package proxmox
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/brynnjknight/proxer/pkg/output"
 )
 
 // Client represents a Proxmox client for interacting with LXC containers
 type Client struct {
-	node    string
-	verbose bool
-	dryRun  bool
+	node   string
+	log    *output.Logger
+	dryRun bool
 }
 
+// ErrContainerNotFound is returned by GetContainer for a container that
+// does not exist
+var ErrContainerNotFound = errors.New("not found")
+
 // ContainerInfo represents information about an LXC container
 type ContainerInfo struct {
-	VMID        int               `json:"vmid"`
-	Name        string            `json:"name"`
-	Status      string            `json:"status"`
-	Template    string            `json:"template,omitempty"`
-	Lock        string            `json:"lock,omitempty"`
-	CPUs        float64           `json:"cpus,omitempty"`
-	Memory      int64             `json:"maxmem,omitempty"`
-	Disk        int64             `json:"maxdisk,omitempty"`
-	Uptime      int64             `json:"uptime,omitempty"`
-	PID         int               `json:"pid,omitempty"`
-	Tags        string            `json:"tags,omitempty"`
-	Labels      map[string]string `json:"labels,omitempty"`
-	CreatedTime time.Time         `json:"created,omitempty"`
+	VMID        int               `json:"vmid" yaml:"vmid"`
+	Name        string            `json:"name" yaml:"name"`
+	Status      string            `json:"status" yaml:"status"`
+	Node        string            `json:"node,omitempty" yaml:"node,omitempty"`
+	Template    string            `json:"template,omitempty" yaml:"template,omitempty"`
+	Lock        string            `json:"lock,omitempty" yaml:"lock,omitempty"`
+	CPUs        float64           `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	CPUUsage    float64           `json:"cpu_percent,omitempty" yaml:"cpu_percent,omitempty"` // 100 is one core fully used
+	Memory      int64             `json:"maxmem,omitempty" yaml:"maxmem,omitempty"`
+	MemoryUsage int64             `json:"mem,omitempty" yaml:"mem,omitempty"` // Bytes in use
+	Disk        int64             `json:"maxdisk,omitempty" yaml:"maxdisk,omitempty"`
+	Uptime      int64             `json:"uptime,omitempty" yaml:"uptime,omitempty"`
+	PID         int               `json:"pid,omitempty" yaml:"pid,omitempty"`
+	Tags        string            `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	CreatedTime time.Time         `json:"created,omitempty" yaml:"created,omitempty"`
 }
 
 // ContainerConfig represents detailed container configuration
 type ContainerConfig struct {
 	VMID         int               `json:"vmid"`
 	Hostname     string            `json:"hostname,omitempty"`
+	OSType       string            `json:"ostype,omitempty"` // pct --ostype, e.g. debian; unset lets pct detect it
 	Memory       int               `json:"memory,omitempty"`
 	Swap         int               `json:"swap,omitempty"`
 	Cores        int               `json:"cores,omitempty"`
@@ -43,61 +58,119 @@ type ContainerConfig struct {
 	Storage      string            `json:"storage,omitempty"`
 	RootFS       string            `json:"rootfs,omitempty"`
 	Net0         string            `json:"net0,omitempty"`
+	Nets         []string          `json:"nets,omitempty"` // Additional interfaces net1, net2, ...
 	Features     string            `json:"features,omitempty"`
 	Unprivileged bool              `json:"unprivileged,omitempty"`
 	Environment  map[string]string `json:"env,omitempty"`
 	MountPoints  map[string]string `json:"mp,omitempty"`
+	DNS          []string          `json:"nameserver,omitempty"`
+	DNSSearch    []string          `json:"searchdomain,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	LXC          []string          `json:"lxc,omitempty"`     // Raw "lxc.key: value" lines for settings pct cannot set
+	Created      time.Time         `json:"created,omitempty"` // From the ctime in the meta line, zero if unknown
+}
+
+// lxcConfigDir holds the Proxmox container configuration files
+var lxcConfigDir = "/etc/pve/lxc"
+
+// StorageVolume represents a volume reported by pvesm list
+type StorageVolume struct {
+	VolID  string `json:"volid"`
+	Format string `json:"format"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+	VMID   int    `json:"vmid,omitempty"`
+}
+
+// Storage returns the storage part of the volume ID
+func (v StorageVolume) Storage() string {
+	storage, _, _ := strings.Cut(v.VolID, ":")
+	return storage
 }
 
-// NewClient creates a new Proxmox client
+// ArchiveFormat returns a readable format, e.g. "tar.zst" for a zstd
+// compressed template archive or "raw" for a container disk
+func (v StorageVolume) ArchiveFormat() string {
+	switch v.Format {
+	case "tzst":
+		return "tar.zst"
+	case "tgz":
+		return "tar.gz"
+	case "txz":
+		return "tar.xz"
+	}
+	for _, ext := range []string{"tar.zst", "tar.gz", "tar.xz", "tar"} {
+		if strings.HasSuffix(v.VolID, "."+ext) {
+			return ext
+		}
+	}
+	return v.Format
+}
+
+// NewClient creates a new Proxmox client logging to the shared logger,
+// with the commands it runs if verbose
 func NewClient(node string, verbose, dryRun bool) *Client {
 	if node == "" {
 		node = "localhost"
 	}
 	return &Client{
-		node:    node,
-		verbose: verbose,
-		dryRun:  dryRun,
+		node:   node,
+		log:    output.Default().WithVerbose(verbose),
+		dryRun: dryRun,
 	}
 }
 
+// WithLogger makes the client log to l and returns it
+func (c *Client) WithLogger(l *output.Logger) *Client {
+	c.log = l
+	return c
+}
+
 // ListContainers returns a list of all LXC containers
 func (c *Client) ListContainers() ([]ContainerInfo, error) {
-	if c.dryRun {
+	return c.listContainers(context.Background())
+}
+
+// listContainers is ListContainers stopping when ctx is done
+func (c *Client) listContainers(ctx context.Context) ([]ContainerInfo, error) {
+	if !c.readsState() {
 		// Return mock data for dry run
 		return []ContainerInfo{
 			{
-				VMID:   100,
-				Name:   "web-server",
-				Status: "running",
-				CPUs:   2.0,
-				Memory: 1024 * 1024 * 1024, // 1GB in bytes
-				Uptime: 3600,               // 1 hour
-				Tags:   "pxc,webapp",
+				VMID:        100,
+				Name:        "web-server",
+				Status:      "running",
+				CPUs:        2.0,
+				Memory:      1024 * 1024 * 1024, // 1GB in bytes
+				Uptime:      3600,               // 1 hour
+				Tags:        "pxc,webapp",
+				CreatedTime: time.Now().Add(-2 * time.Hour),
 			},
 			{
-				VMID:   101,
-				Name:   "database",
-				Status: "running",
-				CPUs:   1.0,
-				Memory: 512 * 1024 * 1024, // 512MB in bytes
-				Uptime: 7200,              // 2 hours
-				Tags:   "pxc,database",
+				VMID:        101,
+				Name:        "database",
+				Status:      "running",
+				CPUs:        1.0,
+				Memory:      512 * 1024 * 1024, // 512MB in bytes
+				Uptime:      7200,              // 2 hours
+				Tags:        "pxc,database",
+				CreatedTime: time.Now().Add(-3 * time.Hour),
 			},
 			{
-				VMID:   102,
-				Name:   "cache",
-				Status: "stopped",
-				CPUs:   1.0,
-				Memory: 256 * 1024 * 1024, // 256MB in bytes
-				Tags:   "pxc,cache",
+				VMID:        102,
+				Name:        "cache",
+				Status:      "stopped",
+				CPUs:        1.0,
+				Memory:      256 * 1024 * 1024, // 256MB in bytes
+				Tags:        "pxc,cache",
+				CreatedTime: time.Now().Add(-time.Hour),
 			},
 		}, nil
 	}
 
 	// Execute pct list command
-	cmd := exec.Command("pct", "list")
-	output, err := cmd.Output()
+	cmd := c.command(ctx, "pct", "list")
+	output, err := CommandOutput(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list containers: %w", err)
 	}
@@ -106,8 +179,8 @@ func (c *Client) ListContainers() ([]ContainerInfo, error) {
 }
 
 // GetContainer returns detailed information about a specific container
-func (c *Client) GetContainer(vmid int) (*ContainerInfo, error) {
-	if c.dryRun {
+func (c *Client) GetContainer(ctx context.Context, vmid int) (*ContainerInfo, error) {
+	if !c.readsState() {
 		// Return mock data for dry run
 		return &ContainerInfo{
 			VMID:   vmid,
@@ -120,7 +193,7 @@ func (c *Client) GetContainer(vmid int) (*ContainerInfo, error) {
 		}, nil
 	}
 
-	containers, err := c.ListContainers()
+	containers, err := c.listContainers(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -131,7 +204,18 @@ func (c *Client) GetContainer(vmid int) (*ContainerInfo, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("container %d not found", vmid)
+	return nil, fmt.Errorf("container %d %w", vmid, ErrContainerNotFound)
+}
+
+// readsState reports whether the client lists the real containers. A dry
+// run does too on a Proxmox host, where listing changes nothing, so it only
+// reports what would really be done; elsewhere it uses sample containers.
+func (c *Client) readsState() bool {
+	if !c.dryRun {
+		return true
+	}
+	_, err := exec.LookPath("pct")
+	return err == nil
 }
 
 // GetContainerConfig returns the configuration of a container
@@ -145,8 +229,8 @@ func (c *Client) GetContainerConfig(vmid int) (*ContainerConfig, error) {
 		}, nil
 	}
 
-	cmd := exec.Command("pct", "config", strconv.Itoa(vmid))
-	output, err := cmd.Output()
+	cmd := c.command(context.Background(), "pct", "config", strconv.Itoa(vmid))
+	output, err := CommandOutput(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get container config: %w", err)
 	}
@@ -154,19 +238,145 @@ func (c *Client) GetContainerConfig(vmid int) (*ContainerConfig, error) {
 	return c.parseContainerConfig(vmid, string(output))
 }
 
+// PopulateCreatedTimes sets the CreatedTime of each container from its
+// configuration. pct list does not report it, so this costs one pct config
+// call per container and is only done when the creation time is needed.
+func (c *Client) PopulateCreatedTimes(containers []ContainerInfo) error {
+	for i := range containers {
+		if !containers[i].CreatedTime.IsZero() {
+			continue
+		}
+		config, err := c.GetContainerConfig(containers[i].VMID)
+		if err != nil {
+			return fmt.Errorf("failed to get creation time of container %d: %w", containers[i].VMID, err)
+		}
+		containers[i].CreatedTime = config.Created
+	}
+	return nil
+}
+
+// PopulateDetails sets the Disk and PID of each container from the node's
+// container list in pvesh, as pct list does not report them
+func (c *Client) PopulateDetails(containers []ContainerInfo) error {
+	if c.dryRun || len(containers) == 0 {
+		return nil
+	}
+	node := c.node
+	if node == "" {
+		var err error
+		if node, err = LocalNode(); err != nil {
+			return err
+		}
+	}
+	output, err := CommandOutput(exec.Command("pvesh", "get", "/nodes/"+node+"/lxc", "--output-format", "json"))
+	if err != nil {
+		return fmt.Errorf("failed to get container details: %w", err)
+	}
+	return applyDetails(containers, output)
+}
+
+// applyDetails sets the Disk and PID of containers from a container list in
+// the API's JSON format
+func applyDetails(containers []ContainerInfo, data []byte) error {
+	var listed []apiContainer
+	if err := json.Unmarshal(data, &listed); err != nil {
+		return fmt.Errorf("failed to parse container details: %w", err)
+	}
+	details := make(map[int]ContainerInfo, len(listed))
+	for _, container := range listed {
+		info := container.info()
+		details[info.VMID] = info
+	}
+	for i := range containers {
+		if info, ok := details[containers[i].VMID]; ok {
+			containers[i].Disk = info.Disk
+			containers[i].PID = info.PID
+		}
+	}
+	return nil
+}
+
+// GetTemplateVolume returns the root filesystem volume of a template with
+// its size and format as reported by the storage. If the storage does not
+// list the volume, the size is taken from the rootfs configuration.
+func (c *Client) GetTemplateVolume(vmid int) (*StorageVolume, error) {
+	config, err := c.GetContainerConfig(vmid)
+	if err != nil {
+		return nil, err
+	}
+	if config.RootFS == "" {
+		return nil, fmt.Errorf("container %d has no root filesystem", vmid)
+	}
+
+	volid, _, _ := strings.Cut(config.RootFS, ",")
+	volume := StorageVolume{VolID: volid, VMID: vmid}
+
+	volumes, err := c.ListStorageVolumes(volume.Storage(), "", vmid)
+	if err == nil {
+		for _, listed := range volumes {
+			if listed.VolID == volid {
+				return &listed, nil
+			}
+		}
+	} else {
+		c.log.Logf(output.Debug, "Could not query storage %s: %v", volume.Storage(), err)
+	}
+
+	volume.Size, err = parseRootFSSize(config.RootFS)
+	if err != nil {
+		return nil, err
+	}
+	return &volume, nil
+}
+
+// ListStorageVolumes lists the volumes on a storage, optionally limited to a
+// content type (e.g. vztmpl, rootdir) and a VMID (0 for all)
+func (c *Client) ListStorageVolumes(storage, content string, vmid int) ([]StorageVolume, error) {
+	return c.listStorageVolumes(context.Background(), storage, content, vmid)
+}
+
+// listStorageVolumes is ListStorageVolumes stopping when ctx is done
+func (c *Client) listStorageVolumes(ctx context.Context, storage, content string, vmid int) ([]StorageVolume, error) {
+	if c.dryRun {
+		// Return mock data for dry run
+		return []StorageVolume{
+			{VolID: storage + ":vztmpl/debian-12-standard_12.2-1_amd64.tar.zst", Format: "tzst", Type: "vztmpl", Size: 120 << 20},
+			{VolID: storage + ":base-9000-disk-0", Format: "raw", Type: "rootdir", Size: 2 << 30, VMID: 9000},
+		}, nil
+	}
+
+	args := []string{"list", storage}
+	if content != "" {
+		args = append(args, "--content", content)
+	}
+	if vmid != 0 {
+		args = append(args, "--vmid", strconv.Itoa(vmid))
+	}
+
+	c.log.Logf(output.Debug, "Executing: pvesm %s", strings.Join(args, " "))
+
+	output, err := CommandOutput(c.command(ctx, "pvesm", args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage %s: %w", storage, err)
+	}
+
+	return ParseStorageList(string(output))
+}
+
 // CreateContainer creates a new LXC container
-func (c *Client) CreateContainer(vmid int, template string, config *ContainerConfig) error {
+func (c *Client) CreateContainer(ctx context.Context, vmid int, template string, config *ContainerConfig) error {
 	if c.dryRun {
-		if c.verbose {
-			fmt.Printf("DRY RUN: Would create container %d from template %s\n", vmid, template)
-		}
+		c.log.Logf(output.Debug, "DRY RUN: Would create container %d from template %s", vmid, template)
 		return nil
 	}
 
 	// Detect if template is a container ID (numeric) or file path
 	if _, err := strconv.Atoi(template); err == nil {
 		// Template is a container ID, use clone
-		return c.cloneContainer(vmid, template, config)
+		if err := c.cloneContainer(ctx, vmid, template, config); err != nil {
+			return err
+		}
+		return c.appendLXCConfig(ctx, vmid, config.LXC)
 	}
 
 	// Template is a file path, use create
@@ -184,6 +394,12 @@ func (c *Client) CreateContainer(vmid int, template string, config *ContainerCon
 	if config.Storage != "" {
 		args = append(args, "--storage", config.Storage)
 	}
+	if config.OSType != "" {
+		args = append(args, "--ostype", config.OSType)
+	}
+	if len(config.Tags) > 0 {
+		args = append(args, "--tags", strings.Join(config.Tags, ";"))
+	}
 
 	// Add default network configuration if not specified
 	if config.Net0 == "" {
@@ -192,12 +408,84 @@ func (c *Client) CreateContainer(vmid int, template string, config *ContainerCon
 	if config.Net0 != "" {
 		args = append(args, "--net0", config.Net0)
 	}
+	for i, net := range config.Nets {
+		args = append(args, fmt.Sprintf("--net%d", i+1), net)
+	}
+	args = append(args, MountPointArgs(config)...)
+
+	if err := c.runPCTCommand(ctx, args...); err != nil {
+		return err
+	}
+	if err := c.setDNS(ctx, vmid, config); err != nil {
+		return err
+	}
+	return c.appendLXCConfig(ctx, vmid, config.LXC)
+}
+
+// MountPointArgs returns the pct arguments attaching a container's mount
+// points, mp0 first
+func MountPointArgs(config *ContainerConfig) []string {
+	keys := make([]string, 0, len(config.MountPoints))
+	for key := range config.MountPoints {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return len(keys[i]) < len(keys[j]) || (len(keys[i]) == len(keys[j]) && keys[i] < keys[j])
+	})
+
+	var args []string
+	for _, key := range keys {
+		args = append(args, "--"+key, config.MountPoints[key])
+	}
+	return args
+}
 
-	return c.runPCTCommand(args...)
+// DNSArgs returns the pct set arguments applying a container's nameserver
+// and search domain overrides, nil if it has none
+func DNSArgs(config *ContainerConfig) []string {
+	var args []string
+	if len(config.DNS) > 0 {
+		args = append(args, "--nameserver", strings.Join(config.DNS, " "))
+	}
+	if len(config.DNSSearch) > 0 {
+		args = append(args, "--searchdomain", strings.Join(config.DNSSearch, " "))
+	}
+	return args
+}
+
+// setDNS applies the DNS overrides of a container with pct set
+func (c *Client) setDNS(ctx context.Context, vmid int, config *ContainerConfig) error {
+	args := DNSArgs(config)
+	if len(args) == 0 {
+		return nil
+	}
+	return c.runPCTCommand(ctx, append([]string{"set", strconv.Itoa(vmid)}, args...)...)
+}
+
+// appendLXCConfig adds raw LXC settings to a container's configuration file.
+// They take effect on the next container start.
+func (c *Client) appendLXCConfig(ctx context.Context, vmid int, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	path := c.configPath(vmid)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open container config: %w", err)
+	}
+	defer file.Close()
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(file, line); err != nil {
+			return fmt.Errorf("failed to write container config: %w", err)
+		}
+	}
+	return nil
 }
 
 // cloneContainer clones a container from a template container
-func (c *Client) cloneContainer(vmid int, templateID string, config *ContainerConfig) error {
+func (c *Client) cloneContainer(ctx context.Context, vmid int, templateID string, config *ContainerConfig) error {
 	// First, clone the template
 	args := []string{"clone", templateID, strconv.Itoa(vmid)}
 
@@ -205,16 +493,16 @@ func (c *Client) cloneContainer(vmid int, templateID string, config *ContainerCo
 		args = append(args, "--hostname", config.Hostname)
 	}
 
-	if err := c.runPCTCommand(args...); err != nil {
+	if err := c.runPCTCommand(ctx, args...); err != nil {
 		return err
 	}
 
 	// Then configure the cloned container with additional settings
-	return c.configureClonedContainer(vmid, config)
+	return c.configureClonedContainer(ctx, vmid, config)
 }
 
 // configureClonedContainer configures a cloned container with additional settings
-func (c *Client) configureClonedContainer(vmid int, config *ContainerConfig) error {
+func (c *Client) configureClonedContainer(ctx context.Context, vmid int, config *ContainerConfig) error {
 	var args []string
 
 	if config.Memory > 0 {
@@ -224,71 +512,194 @@ func (c *Client) configureClonedContainer(vmid int, config *ContainerConfig) err
 		args = append(args, "-cores", strconv.Itoa(config.Cores))
 	}
 
-	// Add default network configuration if not specified
-	if config.Net0 == "" {
-		// Set up default bridged network with DHCP
-		config.Net0 = "name=eth0,bridge=vmbr0,ip=dhcp,type=veth"
-	}
+	// The clone keeps the interfaces of its template unless some are set
 	if config.Net0 != "" {
 		args = append(args, "-net0", config.Net0)
 	}
+	for i, net := range config.Nets {
+		args = append(args, fmt.Sprintf("-net%d", i+1), net)
+	}
+	args = append(args, DNSArgs(config)...)
+	args = append(args, MountPointArgs(config)...)
+	if config.OSType != "" {
+		args = append(args, "--ostype", config.OSType)
+	}
+	// Replaces the tags of the template
+	if len(config.Tags) > 0 {
+		args = append(args, "--tags", strings.Join(config.Tags, ";"))
+	}
 
 	// Apply configuration if we have settings to apply
 	if len(args) > 0 {
 		setArgs := append([]string{"set", strconv.Itoa(vmid)}, args...)
-		return c.runPCTCommand(setArgs...)
+		return c.runPCTCommand(ctx, setArgs...)
 	}
 
 	return nil
 }
 
 // StartContainer starts a container
-func (c *Client) StartContainer(vmid int) error {
+func (c *Client) StartContainer(ctx context.Context, vmid int) error {
 	if c.dryRun {
-		if c.verbose {
-			fmt.Printf("DRY RUN: Would start container %d\n", vmid)
-		}
+		c.log.Logf(output.Debug, "DRY RUN: Would start container %d", vmid)
 		return nil
 	}
 
-	return c.runPCTCommand("start", strconv.Itoa(vmid))
+	return c.runPCTCommand(ctx, "start", strconv.Itoa(vmid))
 }
 
 // StopContainer stops a container
-func (c *Client) StopContainer(vmid int) error {
+func (c *Client) StopContainer(ctx context.Context, vmid int) error {
 	if c.dryRun {
-		if c.verbose {
-			fmt.Printf("DRY RUN: Would stop container %d\n", vmid)
-		}
+		c.log.Logf(output.Debug, "DRY RUN: Would stop container %d", vmid)
 		return nil
 	}
 
-	return c.runPCTCommand("stop", strconv.Itoa(vmid))
+	return c.runPCTCommand(ctx, "stop", strconv.Itoa(vmid))
+}
+
+// ShutdownContainer asks a container to shut down cleanly, waiting up to
+// timeout. A container that has not shut down by then is left running and
+// an error returned, so the caller can stop it forcibly and knows it had to.
+func (c *Client) ShutdownContainer(ctx context.Context, vmid int, timeout time.Duration) error {
+	seconds := strconv.Itoa(int(timeout.Seconds()))
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would shut down container %d (timeout %ss)", vmid, seconds)
+		return nil
+	}
+
+	return c.runPCTCommand(ctx, "shutdown", strconv.Itoa(vmid), "--timeout", seconds)
 }
 
 // DestroyContainer destroys a container
-func (c *Client) DestroyContainer(vmid int) error {
+func (c *Client) DestroyContainer(ctx context.Context, vmid int) error {
 	if c.dryRun {
-		if c.verbose {
-			fmt.Printf("DRY RUN: Would destroy container %d\n", vmid)
-		}
+		c.log.Logf(output.Debug, "DRY RUN: Would destroy container %d", vmid)
 		return nil
 	}
 
-	return c.runPCTCommand("destroy", strconv.Itoa(vmid))
+	return c.runPCTCommand(ctx, "destroy", strconv.Itoa(vmid))
 }
 
 // ExecCommand executes a command in a container
-func (c *Client) ExecCommand(vmid int, command []string) error {
+func (c *Client) ExecCommand(ctx context.Context, vmid int, command []string) error {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would execute in container %d: %s", vmid, strings.Join(command, " "))
+		return nil
+	}
+
+	return c.runPCTCommand(ctx, ExecArgs(vmid, ExecOptions{}, command)...)
+}
+
+// GetContainerIP returns the first IP address assigned inside a running container
+func (c *Client) GetContainerIP(ctx context.Context, vmid int) (string, error) {
+	if c.dryRun {
+		return "127.0.0.1", nil
+	}
+
+	cmd := c.command(ctx, "pct", "exec", strconv.Itoa(vmid), "--", "hostname", "-I")
+	output, err := CommandOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to get container IP: %w", err)
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("container %d has no IP address", vmid)
+	}
+
+	return fields[0], nil
+}
+
+// IsVMIDFree reports whether no container or VM anywhere in the cluster
+// uses vmid, asking pvesh as pct only knows the local node
+func (c *Client) IsVMIDFree(ctx context.Context, vmid int) (bool, error) {
+	if c.dryRun {
+		return true, nil
+	}
+
+	_, err := CommandOutput(CommandContext(ctx, "pvesh", "get", "/cluster/nextid", "--vmid", strconv.Itoa(vmid)))
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), "already exists") {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check container ID %d: %w", vmid, err)
+}
+
+// GetInterfaceAddresses returns the IPv4 address of each interface of a
+// running container, keyed by interface name, e.g. eth1
+func (c *Client) GetInterfaceAddresses(ctx context.Context, vmid int) (map[string]string, error) {
 	if c.dryRun {
-		if c.verbose {
-			fmt.Printf("DRY RUN: Would execute in container %d: %s\n", vmid, strings.Join(command, " "))
+		return map[string]string{"eth0": "127.0.0.1"}, nil
+	}
+
+	cmd := c.command(ctx, "pct", "exec", strconv.Itoa(vmid), "--", "ip", "-o", "-4", "addr", "show")
+	output, err := CommandOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get addresses of container %d: %w", vmid, err)
+	}
+	return parseInterfaceAddresses(string(output)), nil
+}
+
+// parseInterfaceAddresses parses the output of ip -o -4 addr show, keeping
+// the first address of each interface other than loopback
+func parseInterfaceAddresses(output string) map[string]string {
+	addresses := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] != "inet" {
+			continue
+		}
+		name, _, _ := strings.Cut(fields[1], "@")
+		if name == "lo" {
+			continue
 		}
+		if _, seen := addresses[name]; !seen {
+			address, _, _ := strings.Cut(fields[3], "/")
+			addresses[name] = address
+		}
+	}
+	return addresses
+}
+
+// PushOptions controls ownership and permissions of a pushed file
+type PushOptions struct {
+	Perms string
+	User  string
+	Group string
+}
+
+// PushFile copies a host file into a container. A container on another
+// node gets the file through a temporary copy on that node.
+func (c *Client) PushFile(ctx context.Context, vmid int, source, dest string, opts PushOptions) error {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would push %s to %s in container %d", source, dest, vmid)
 		return nil
 	}
 
-	args := append([]string{"exec", strconv.Itoa(vmid), "--"}, command...)
-	return c.runPCTCommand(args...)
+	args := []string{"push", strconv.Itoa(vmid), source, dest}
+	if opts.Perms != "" {
+		args = append(args, "--perms", opts.Perms)
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	if opts.Group != "" {
+		args = append(args, "--group", opts.Group)
+	}
+
+	if c.remote() {
+		staged, remove, err := c.stageFile(ctx, vmid, source)
+		if err != nil {
+			return err
+		}
+		defer remove()
+		args[2] = staged
+	}
+	return c.runPCTCommand(ctx, args...)
 }
 
 // GetContainerLogs returns logs from a container
@@ -304,8 +715,8 @@ func (c *Client) GetContainerLogs(vmid int, lines int) (string, error) {
 		args = []string{"exec", strconv.Itoa(vmid), "--", "journalctl"}
 	}
 
-	cmd := exec.Command("pct", args...)
-	output, err := cmd.Output()
+	cmd := c.command(context.Background(), "pct", args...)
+	output, err := CommandOutput(cmd)
 	if err != nil {
 		return "", fmt.Errorf("failed to get container logs: %w", err)
 	}
@@ -407,6 +818,8 @@ func (c *Client) parseContainerConfig(vmid int, output string) (*ContainerConfig
 			config.Features = value
 		case "unprivileged":
 			config.Unprivileged = value == "1"
+		case "meta":
+			config.Created = parseCreationTime(value)
 		default:
 			// Handle mount points (mp0, mp1, etc.)
 			if strings.HasPrefix(key, "mp") {
@@ -418,13 +831,107 @@ func (c *Client) parseContainerConfig(vmid int, output string) (*ContainerConfig
 	return config, nil
 }
 
-// runPCTCommand executes a pct command
-func (c *Client) runPCTCommand(args ...string) error {
-	cmd := exec.Command("pct", args...)
+// parseCreationTime extracts the ctime option from a meta value such as
+// "creation-qemu=8.1.2,ctime=1700000000". Containers created before Proxmox
+// recorded it have no ctime and get the zero time.
+func parseCreationTime(meta string) time.Time {
+	for _, option := range strings.Split(meta, ",") {
+		value, found := strings.CutPrefix(option, "ctime=")
+		if !found {
+			continue
+		}
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(seconds, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// parseRootFSSize extracts the size option from a rootfs value such as
+// "local-lvm:base-100-disk-0,size=8G" and converts it to bytes
+func parseRootFSSize(rootfs string) (int64, error) {
+	for _, option := range strings.Split(rootfs, ",") {
+		value, found := strings.CutPrefix(option, "size=")
+		if !found {
+			continue
+		}
+		if value == "" {
+			return 0, fmt.Errorf("invalid rootfs size '%s'", option)
+		}
 
-	if c.verbose {
-		fmt.Printf("Executing: pct %s\n", strings.Join(args, " "))
+		multiplier := int64(1)
+		switch strings.ToUpper(value[len(value)-1:]) {
+		case "K":
+			multiplier = 1 << 10
+		case "M":
+			multiplier = 1 << 20
+		case "G":
+			multiplier = 1 << 30
+		case "T":
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			value = value[:len(value)-1]
+		}
+
+		size, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid rootfs size '%s': %w", option, err)
+		}
+		return int64(size * float64(multiplier)), nil
 	}
 
-	return cmd.Run()
+	return 0, nil
+}
+
+// ParseStorageList parses the output of pvesm list:
+//
+//	Volid                                              Format  Type      Size VMID
+//	local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst tzst    vztmpl 126331031
+//	local-lvm:base-9000-disk-0                         raw     rootdir 8589934592 9000
+func ParseStorageList(output string) ([]StorageVolume, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return []StorageVolume{}, nil
+	}
+
+	var volumes []StorageVolume
+
+	// Skip header line
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size '%s' for volume %s", fields[3], fields[0])
+		}
+
+		volume := StorageVolume{
+			VolID:  fields[0],
+			Format: fields[1],
+			Type:   fields[2],
+			Size:   size,
+		}
+		if len(fields) > 4 {
+			if vmid, err := strconv.Atoi(fields[4]); err == nil {
+				volume.VMID = vmid
+			}
+		}
+
+		volumes = append(volumes, volume)
+	}
+
+	return volumes, nil
+}
+
+// runPCTCommand executes a pct command
+func (c *Client) runPCTCommand(ctx context.Context, args ...string) error {
+	cmd := c.command(ctx, "pct", args...)
+
+	c.log.Logf(output.Debug, "Executing: pct %s", strings.Join(args, " "))
+
+	return RunCommand(cmd)
 }
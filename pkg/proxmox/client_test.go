@@ -0,0 +1,208 @@
+package proxmox
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRootFSSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		rootfs   string
+		expected int64
+		wantErr  bool
+	}{
+		{
+			name:     "gigabytes",
+			rootfs:   "local-lvm:base-100-disk-0,size=8G",
+			expected: 8 << 30,
+		},
+		{
+			name:     "megabytes",
+			rootfs:   "local-zfs:subvol-101-disk-0,size=512M",
+			expected: 512 << 20,
+		},
+		{
+			name:     "fractional terabytes",
+			rootfs:   "tank:vm-102-disk-0,size=1.5T",
+			expected: 3 << 39,
+		},
+		{
+			name:     "no size option",
+			rootfs:   "local-lvm:base-100-disk-0",
+			expected: 0,
+		},
+		{
+			name:    "invalid size",
+			rootfs:  "local-lvm:base-100-disk-0,size=bigG",
+			wantErr: true,
+		},
+		{
+			name:    "empty size",
+			rootfs:  "local-lvm:base-100-disk-0,size=",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := parseRootFSSize(tt.rootfs)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseRootFSSize(%q) expected error, got nil", tt.rootfs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRootFSSize(%q) unexpected error: %v", tt.rootfs, err)
+			}
+			if size != tt.expected {
+				t.Errorf("parseRootFSSize(%q) = %d, want %d", tt.rootfs, size, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseStorageList(t *testing.T) {
+	output := `Volid                                                Format  Type          Size VMID
+local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst tzst    vztmpl   126331031
+local:vztmpl/alpine-3.18-default_20230607_amd64.tar.xz txz   vztmpl     2982664
+local-lvm:base-9000-disk-0                           raw     rootdir 8589934592 9000
+`
+
+	volumes, err := ParseStorageList(output)
+	if err != nil {
+		t.Fatalf("ParseStorageList() unexpected error: %v", err)
+	}
+	if len(volumes) != 3 {
+		t.Fatalf("ParseStorageList() returned %d volumes, want 3", len(volumes))
+	}
+
+	tests := []struct {
+		volume  StorageVolume
+		volid   string
+		storage string
+		format  string
+		size    int64
+		vmid    int
+	}{
+		{volumes[0], "local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst", "local", "tar.zst", 126331031, 0},
+		{volumes[1], "local:vztmpl/alpine-3.18-default_20230607_amd64.tar.xz", "local", "tar.xz", 2982664, 0},
+		{volumes[2], "local-lvm:base-9000-disk-0", "local-lvm", "raw", 8589934592, 9000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.volid, func(t *testing.T) {
+			if tt.volume.VolID != tt.volid {
+				t.Errorf("VolID = %q, want %q", tt.volume.VolID, tt.volid)
+			}
+			if tt.volume.Storage() != tt.storage {
+				t.Errorf("Storage() = %q, want %q", tt.volume.Storage(), tt.storage)
+			}
+			if tt.volume.ArchiveFormat() != tt.format {
+				t.Errorf("ArchiveFormat() = %q, want %q", tt.volume.ArchiveFormat(), tt.format)
+			}
+			if tt.volume.Size != tt.size {
+				t.Errorf("Size = %d, want %d", tt.volume.Size, tt.size)
+			}
+			if tt.volume.VMID != tt.vmid {
+				t.Errorf("VMID = %d, want %d", tt.volume.VMID, tt.vmid)
+			}
+		})
+	}
+}
+
+func TestParseStorageListErrors(t *testing.T) {
+	volumes, err := ParseStorageList("Volid Format Type Size VMID\n")
+	if err != nil || len(volumes) != 0 {
+		t.Errorf("header only: got %v, %v; want no volumes", volumes, err)
+	}
+
+	if _, err := ParseStorageList("Volid Format Type Size VMID\nlocal:vztmpl/a.tar.gz tgz vztmpl big\n"); err == nil {
+		t.Error("invalid size: expected error, got nil")
+	}
+}
+
+func TestArchiveFormatFromVolID(t *testing.T) {
+	volume := StorageVolume{VolID: "local:vztmpl/ubuntu-22.04.tar.gz", Format: "tgz"}
+	if got := volume.ArchiveFormat(); got != "tar.gz" {
+		t.Errorf("ArchiveFormat() = %q, want tar.gz", got)
+	}
+
+	volume = StorageVolume{VolID: "backup:vztmpl/custom.tar.zst"}
+	if got := volume.ArchiveFormat(); got != "tar.zst" {
+		t.Errorf("ArchiveFormat() = %q, want tar.zst", got)
+	}
+}
+
+func TestParseContainerConfigCreated(t *testing.T) {
+	client := NewClient("", false, false)
+
+	output := `arch: amd64
+hostname: web
+memory: 1024
+meta: creation-qemu=8.1.2,ctime=1700000000
+ostype: debian
+`
+	config, err := client.parseContainerConfig(100, output)
+	if err != nil {
+		t.Fatalf("parseContainerConfig() unexpected error: %v", err)
+	}
+	if !config.Created.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Created = %v, want %v", config.Created, time.Unix(1700000000, 0))
+	}
+
+	config, err = client.parseContainerConfig(101, "hostname: legacy\nmemory: 512\n")
+	if err != nil {
+		t.Fatalf("parseContainerConfig() unexpected error: %v", err)
+	}
+	if !config.Created.IsZero() {
+		t.Errorf("Created = %v, want zero time without a meta line", config.Created)
+	}
+}
+
+func TestApplyDetails(t *testing.T) {
+	containers := []ContainerInfo{{VMID: 100, Status: "running"}, {VMID: 101, Status: "stopped"}, {VMID: 102}}
+	data := `[{"vmid":100,"status":"running","maxdisk":8589934592,"pid":4242},
+{"vmid":"101","status":"stopped","maxdisk":4294967296}]`
+
+	if err := applyDetails(containers, []byte(data)); err != nil {
+		t.Fatalf("applyDetails() unexpected error: %v", err)
+	}
+	want := []ContainerInfo{
+		{VMID: 100, Status: "running", Disk: 8589934592, PID: 4242},
+		{VMID: 101, Status: "stopped", Disk: 4294967296},
+		{VMID: 102},
+	}
+	if !reflect.DeepEqual(containers, want) {
+		t.Errorf("applyDetails() = %+v, want %+v", containers, want)
+	}
+	if err := applyDetails(containers, []byte("not json")); err == nil {
+		t.Error("applyDetails() expected error for invalid output")
+	}
+}
+
+func TestMountPointArgs(t *testing.T) {
+	config := &ContainerConfig{MountPoints: map[string]string{}}
+	for i := 0; i < 11; i++ {
+		config.MountPoints["mp"+strconv.Itoa(i)] = "/srv/" + strconv.Itoa(i) + ",mp=/data" + strconv.Itoa(i)
+	}
+
+	args := MountPointArgs(config)
+	if len(args) != 22 {
+		t.Fatalf("MountPointArgs() = %q, want 11 mount points", args)
+	}
+	want := []string{"--mp0", "/srv/0,mp=/data0", "--mp1", "/srv/1,mp=/data1"}
+	if !reflect.DeepEqual(args[:4], want) {
+		t.Errorf("MountPointArgs() starts with %q, want %q", args[:4], want)
+	}
+	if args[20] != "--mp10" {
+		t.Errorf("MountPointArgs() ends with %q, want mp10 after mp9", args[20])
+	}
+
+	if args := MountPointArgs(&ContainerConfig{}); args != nil {
+		t.Errorf("MountPointArgs() = %q, want nil without mount points", args)
+	}
+}
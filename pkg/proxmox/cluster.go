@@ -0,0 +1,369 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+// hostname returns the name of the node pxc runs on
+var hostname = os.Hostname
+
+// nodesConfigDir holds the configuration of every node of the cluster, so
+// the configuration files of containers on other nodes can be written too
+var nodesConfigDir = "/etc/pve/nodes"
+
+// IsLocalNode reports whether node is the node pxc runs on, whose
+// containers pct manages directly. An empty node and localhost are local.
+func IsLocalNode(node string) bool {
+	if node == "" || node == "localhost" {
+		return true
+	}
+	name, err := hostname()
+	if err != nil {
+		return false
+	}
+	short, _, _ := strings.Cut(name, ".")
+	return node == name || node == short
+}
+
+// LocalNode returns the name of the node pxc runs on
+func LocalNode() (string, error) {
+	name, err := hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the local node name: %w", err)
+	}
+	short, _, _ := strings.Cut(name, ".")
+	return short, nil
+}
+
+// RemoteArgs returns the ssh arguments that run a command as root on
+// another cluster node. Proxmox clusters trust root between their nodes.
+func RemoteArgs(node, name string, args ...string) []string {
+	return []string{"-o", "BatchMode=yes", "root@" + node, "--", shellJoin(append([]string{name}, args...))}
+}
+
+// remote reports whether the client's node is another cluster node
+func (c *Client) remote() bool {
+	return !IsLocalNode(c.node)
+}
+
+// command returns a command running on the client's node: directly on the
+// local node, or over ssh on another one
+func (c *Client) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if !c.remote() {
+		return CommandContext(ctx, name, args...)
+	}
+	return CommandContext(ctx, "ssh", RemoteArgs(c.node, name, args...)...)
+}
+
+// configPath returns the configuration file of a container on the client's
+// node
+func (c *Client) configPath(vmid int) string {
+	if !c.remote() {
+		return filepath.Join(lxcConfigDir, strconv.Itoa(vmid)+".conf")
+	}
+	return filepath.Join(nodesConfigDir, c.node, "lxc", strconv.Itoa(vmid)+".conf")
+}
+
+// stageFile copies a local file to a temporary path on the client's node
+// for pct push, returning the path and a function that removes it again
+func (c *Client) stageFile(ctx context.Context, vmid int, source string) (string, func(), error) {
+	staged := fmt.Sprintf("/tmp/pxc-push-%d-%d-%s", vmid, os.Getpid(), filepath.Base(source))
+	c.log.Logf(output.Debug, "Executing: scp %s %s:%s", source, c.node, staged)
+	if err := RunCommand(CommandContext(ctx, "scp", "-q", "-o", "BatchMode=yes", source, "root@"+c.node+":"+staged)); err != nil {
+		return "", nil, fmt.Errorf("failed to copy %s to node %s: %w", source, c.node, err)
+	}
+	return staged, func() { _ = RunCommand(c.command(ctx, "rm", "-f", staged)) }, nil
+}
+
+// clusterResource is a guest as listed by /cluster/resources
+type clusterResource struct {
+	VMID     json.Number `json:"vmid"`
+	Node     string      `json:"node"`
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Status   string      `json:"status"`
+	Tags     string      `json:"tags"` // Separated by semicolons
+	Template json.Number `json:"template"`
+}
+
+// clusterContainers returns the containers among the cluster's guests, with
+// template containers given the status template
+func clusterContainers(resources []clusterResource) []ContainerInfo {
+	var containers []ContainerInfo
+	for _, resource := range resources {
+		id, err := resource.VMID.Int64()
+		if err != nil || resource.Type != "lxc" {
+			continue
+		}
+		container := ContainerInfo{
+			VMID:   int(id),
+			Name:   resource.Name,
+			Status: resource.Status,
+			Node:   resource.Node,
+			Tags:   strings.ReplaceAll(resource.Tags, ";", ","),
+		}
+		if template, _ := resource.Template.Int64(); template == 1 {
+			container.Status = "template"
+		}
+		containers = append(containers, container)
+	}
+	return containers
+}
+
+// HasTag reports whether a container carries a tag. Proxmox compares tags
+// case-insensitively.
+func (c ContainerInfo) HasTag(tag string) bool {
+	for _, t := range strings.Split(c.Tags, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// findGuestNode returns the node of a container among the cluster's guests
+func findGuestNode(resources []clusterResource, vmid int) (string, error) {
+	for _, resource := range resources {
+		if id, err := resource.VMID.Int64(); err == nil && int(id) == vmid && resource.Type == "lxc" {
+			return resource.Node, nil
+		}
+	}
+	return "", fmt.Errorf("container %d %w", vmid, ErrContainerNotFound)
+}
+
+// clusterResources lists the guests of the cluster with pvesh
+func (c *Client) clusterResources(ctx context.Context) ([]clusterResource, error) {
+	output, err := CommandOutput(CommandContext(ctx, "pvesh", "get", "/cluster/resources", "--type", "vm", "--output-format", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster resources: %w", err)
+	}
+	var resources []clusterResource
+	if err := json.Unmarshal(output, &resources); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster resources: %w", err)
+	}
+	return resources, nil
+}
+
+// ContainerNode returns the cluster node a container is on
+func (c *Client) ContainerNode(ctx context.Context, vmid int) (string, error) {
+	if c.dryRun {
+		return c.node, nil
+	}
+
+	resources, err := c.clusterResources(ctx)
+	if err != nil {
+		return "", err
+	}
+	return findGuestNode(resources, vmid)
+}
+
+// ListClusterContainers returns the containers on every node of the
+// cluster with their node and tags, which pct list does not report
+func (c *Client) ListClusterContainers(ctx context.Context) ([]ContainerInfo, error) {
+	if c.dryRun {
+		return nil, nil
+	}
+
+	resources, err := c.clusterResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return clusterContainers(resources), nil
+}
+
+// MigrateContainer moves a stopped container or template from the client's
+// node to target, copying its disks
+func (c *Client) MigrateContainer(ctx context.Context, vmid int, target string) error {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would migrate container %d to node %s", vmid, target)
+		return nil
+	}
+	return c.runPCTCommand(ctx, "migrate", strconv.Itoa(vmid), target)
+}
+
+// HasTemplate reports whether a template archive, given by volume ID, is on
+// its storage as seen from the client's node
+func (c *Client) HasTemplate(ctx context.Context, volid string) (bool, error) {
+	if c.dryRun {
+		return true, nil
+	}
+
+	storage, _, _ := strings.Cut(volid, ":")
+	volumes, err := c.listStorageVolumes(ctx, storage, "vztmpl", 0)
+	if err != nil {
+		return false, err
+	}
+	for _, volume := range volumes {
+		if volume.VolID == volid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DownloadTemplate downloads an appliance template, e.g.
+// debian-12-standard_12.2-1_amd64.tar.zst, to a storage of the client's node
+func (c *Client) DownloadTemplate(ctx context.Context, storage, template string) error {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would download template %s to %s on node %s", template, storage, c.node)
+		return nil
+	}
+	// Check the content types first, pveam's own error does not say why
+	status, err := CommandOutput(c.command(ctx, "pvesm", "status", "--content", "vztmpl"))
+	if err != nil {
+		return fmt.Errorf("failed to check storage '%s' on node %s: %w", storage, c.node, err)
+	}
+	if _, err := parseStorageStatus(string(status), storage); err != nil {
+		return templateContentError(storage, c.node)
+	}
+	c.log.Logf(output.Debug, "Executing: pveam download %s %s", storage, template)
+	if err := RunCommand(c.command(ctx, "pveam", "download", storage, template)); err != nil {
+		return fmt.Errorf("failed to download template %s: %w", template, err)
+	}
+	return nil
+}
+
+// templateContentError explains that a template cannot be downloaded to a
+// storage without the vztmpl content type
+func templateContentError(storage, node string) error {
+	return fmt.Errorf("storage '%s' on node %s does not support container templates (content type vztmpl); "+
+		"download the template to a storage that does (see 'pvesm status --content vztmpl') "+
+		"or add vztmpl to the content types of '%s'", storage, node, storage)
+}
+
+// ContainerNode returns the cluster node a container is on
+func (c *APIClient) ContainerNode(ctx context.Context, vmid int) (string, error) {
+	if c.dryRun {
+		return c.node, nil
+	}
+
+	var resources []clusterResource
+	if err := c.request(ctx, http.MethodGet, "/cluster/resources", url.Values{"type": {"vm"}}, &resources); err != nil {
+		return "", fmt.Errorf("failed to list cluster resources: %w", err)
+	}
+	return findGuestNode(resources, vmid)
+}
+
+// ListClusterContainers returns the containers on every node of the
+// cluster with their node and tags
+func (c *APIClient) ListClusterContainers(ctx context.Context) ([]ContainerInfo, error) {
+	if c.dryRun {
+		return nil, nil
+	}
+
+	var resources []clusterResource
+	if err := c.request(ctx, http.MethodGet, "/cluster/resources", url.Values{"type": {"vm"}}, &resources); err != nil {
+		return nil, fmt.Errorf("failed to list cluster resources: %w", err)
+	}
+	return clusterContainers(resources), nil
+}
+
+// MigrateContainer moves a stopped container or template from the client's
+// node to target, copying its disks
+func (c *APIClient) MigrateContainer(ctx context.Context, vmid int, target string) error {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would migrate container %d to node %s via the API", vmid, target)
+		return nil
+	}
+	if err := c.task(ctx, http.MethodPost, c.nodePath("/lxc/%d/migrate", vmid), url.Values{"target": {target}}); err != nil {
+		return fmt.Errorf("failed to migrate container %d to node %s: %w", vmid, target, err)
+	}
+	return nil
+}
+
+// ListStorageVolumes lists the volumes on a storage of the client's node,
+// optionally limited to a content type (e.g. vztmpl, rootdir) and a VMID
+// (0 for all)
+func (c *APIClient) ListStorageVolumes(storage, content string, vmid int) ([]StorageVolume, error) {
+	return c.listStorageVolumes(context.Background(), storage, content, vmid)
+}
+
+// listStorageVolumes is ListStorageVolumes stopping when ctx is done
+func (c *APIClient) listStorageVolumes(ctx context.Context, storage, content string, vmid int) ([]StorageVolume, error) {
+	if c.dryRun {
+		return []StorageVolume{
+			{VolID: storage + ":vztmpl/debian-12-standard_12.2-1_amd64.tar.zst", Format: "tzst", Type: "vztmpl", Size: 120 << 20},
+			{VolID: storage + ":base-9000-disk-0", Format: "raw", Type: "rootdir", Size: 2 << 30, VMID: 9000},
+		}, nil
+	}
+
+	params := url.Values{}
+	if content != "" {
+		params.Set("content", content)
+	}
+	if vmid != 0 {
+		params.Set("vmid", strconv.Itoa(vmid))
+	}
+	var listed []struct {
+		StorageVolume
+		Content string `json:"content"`
+	}
+	if err := c.request(ctx, http.MethodGet, c.nodePath("/storage/%s/content", url.PathEscape(storage)), params, &listed); err != nil {
+		return nil, fmt.Errorf("failed to list storage %s: %w", storage, err)
+	}
+
+	volumes := make([]StorageVolume, 0, len(listed))
+	for _, volume := range listed {
+		volume.Type = volume.Content
+		volumes = append(volumes, volume.StorageVolume)
+	}
+	return volumes, nil
+}
+
+// HasTemplate reports whether a template archive, given by volume ID, is on
+// its storage as seen from the client's node
+func (c *APIClient) HasTemplate(ctx context.Context, volid string) (bool, error) {
+	if c.dryRun {
+		return true, nil
+	}
+
+	storage, _, _ := strings.Cut(volid, ":")
+	volumes, err := c.listStorageVolumes(ctx, storage, "vztmpl", 0)
+	if err != nil {
+		return false, err
+	}
+	for _, volume := range volumes {
+		if volume.VolID == volid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DownloadTemplate downloads an appliance template to a storage of the
+// client's node
+func (c *APIClient) DownloadTemplate(ctx context.Context, storage, template string) error {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would download template %s to %s on node %s via the API", template, storage, c.node)
+		return nil
+	}
+	// Check the content types first, as the Client does
+	var storages []struct {
+		Storage string `json:"storage"`
+	}
+	if err := c.request(ctx, http.MethodGet, c.nodePath("/storage"), url.Values{"content": {"vztmpl"}}, &storages); err != nil {
+		return fmt.Errorf("failed to check storage '%s' on node %s: %w", storage, c.node, err)
+	}
+	found := false
+	for _, s := range storages {
+		found = found || s.Storage == storage
+	}
+	if !found {
+		return templateContentError(storage, c.node)
+	}
+	if err := c.task(ctx, http.MethodPost, c.nodePath("/aplinfo"), url.Values{"storage": {storage}, "template": {template}}); err != nil {
+		return fmt.Errorf("failed to download template %s: %w", template, err)
+	}
+	return nil
+}
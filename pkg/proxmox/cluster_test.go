@@ -0,0 +1,72 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRemoteNodes(t *testing.T) {
+	original := hostname
+	defer func() { hostname = original }()
+	hostname = func() (string, error) { return "pve1.example.com", nil }
+
+	for node, want := range map[string]bool{"": true, "localhost": true, "pve1": true, "pve1.example.com": true, "pve2": false} {
+		if got := IsLocalNode(node); got != want {
+			t.Errorf("IsLocalNode(%q) = %v, want %v", node, got, want)
+		}
+	}
+
+	client := NewClient("pve2", false, false)
+	cmd := client.command(context.Background(), "pct", "exec", "101", "--", "sh", "-c", "echo hi")
+	wantArgs := []string{"ssh", "-o", "BatchMode=yes", "root@pve2", "--", "pct exec 101 -- sh -c 'echo hi'"}
+	if !reflect.DeepEqual(cmd.Args, wantArgs) {
+		t.Errorf("command() = %q, want %q", cmd.Args, wantArgs)
+	}
+	if got, want := client.configPath(101), "/etc/pve/nodes/pve2/lxc/101.conf"; got != want {
+		t.Errorf("configPath() = %s, want %s", got, want)
+	}
+
+	local := NewClient("pve1", false, false)
+	if cmd := local.command(context.Background(), "pct", "list"); !reflect.DeepEqual(cmd.Args, []string{"pct", "list"}) {
+		t.Errorf("local command() = %q, want pct list", cmd.Args)
+	}
+	if got, want := local.configPath(101), "/etc/pve/lxc/101.conf"; got != want {
+		t.Errorf("local configPath() = %s, want %s", got, want)
+	}
+}
+
+func TestFindGuestNode(t *testing.T) {
+	resources := []clusterResource{
+		{VMID: "100", Node: "pve1", Type: "qemu"},
+		{VMID: "100", Node: "pve2", Type: "lxc"},
+		{VMID: "9000", Node: "pve3", Type: "lxc"},
+	}
+	if node, err := findGuestNode(resources, 100); err != nil || node != "pve2" {
+		t.Errorf("findGuestNode(100) = %q, %v, want pve2", node, err)
+	}
+	if _, err := findGuestNode(resources, 101); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("findGuestNode(101) error = %v, want not found", err)
+	}
+}
+
+func TestClusterContainers(t *testing.T) {
+	resources := []clusterResource{
+		{VMID: "100", Node: "pve1", Type: "qemu", Name: "vm"},
+		{VMID: "101", Node: "pve1", Type: "lxc", Name: "web", Status: "running", Tags: "pxc;pxc-shop"},
+		{VMID: "9000", Node: "pve2", Type: "lxc", Name: "base", Status: "stopped", Template: "1"},
+	}
+	want := []ContainerInfo{
+		{VMID: 101, Name: "web", Status: "running", Node: "pve1", Tags: "pxc,pxc-shop"},
+		{VMID: 9000, Name: "base", Status: "template", Node: "pve2"},
+	}
+	got := clusterContainers(resources)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("clusterContainers() = %+v, want %+v", got, want)
+	}
+
+	if !got[0].HasTag("PXC-Shop") || got[0].HasTag("pxc-shop2") || got[1].HasTag("pxc") {
+		t.Errorf("HasTag() does not match whole tags case-insensitively: %q", got[0].Tags)
+	}
+}
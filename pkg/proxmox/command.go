@@ -0,0 +1,170 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CommandContext returns a command that is interrupted, as Ctrl+C would,
+// when ctx is done, and killed if it has not exited 10 seconds later
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 10 * time.Second
+	return cmd
+}
+
+// commandOutputLimit is how much of the end of a failed command's stdout
+// and stderr a CommandError keeps
+const commandOutputLimit = 4096
+
+// CommandError is a command run by RunCommand or CommandOutput that failed,
+// with the end of what it printed. It unwraps to the *exec.ExitError or the
+// error that kept the command from running.
+type CommandError struct {
+	Args     []string // Command and arguments, with secrets redacted as in the audit log
+	ExitCode int      // -1 if the command could not be run
+	Stdout   string
+	Stderr   string
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	message := fmt.Sprintf("%s: %v", e.command(), e.Err)
+	if detail := e.detail(); detail != "" {
+		message += ": " + detail
+	}
+	return message
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// command names the command and its subcommand, e.g. pct start
+func (e *CommandError) command() string {
+	if len(e.Args) > 1 && !strings.HasPrefix(e.Args[1], "-") {
+		return e.Args[0] + " " + e.Args[1]
+	}
+	if len(e.Args) > 0 {
+		return e.Args[0]
+	}
+	return "command"
+}
+
+// detail returns the last lines the command printed to stderr, or to
+// stdout if it printed nothing to stderr, which is where pct and the
+// other Proxmox tools say what went wrong
+func (e *CommandError) detail() string {
+	output := strings.TrimSpace(e.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(e.Stdout)
+	}
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 3 {
+		lines = lines[len(lines)-3:]
+	}
+	return strings.Join(lines, "; ")
+}
+
+// commandHints suggest what to do about common failures, matched against
+// the output and error of a failed command
+var commandHints = []struct {
+	match, hint string
+}{
+	{`executable file not found`, "run pxc on a Proxmox VE node, where pct and pvesm are installed, or use --transport api"},
+	{`must be root`, "run pxc as root on the Proxmox VE node"},
+	{`permission denied`, "run pxc as root on the Proxmox VE node"},
+	{`already exists`, "the container ID is taken; remove the container (see 'pxc ps --all') or set another container ID range"},
+	{`no space left on device`, "free space on the storage or give the container a larger disk"},
+	{`storage '`, "check the storage setting (--storage, or storage in .pxc.yaml or the stack) against 'pvesm status'"},
+	{`volume '`, "check that the template exists with 'pxc templates' or 'pveam list <storage>'"},
+	{`temporary failure in name resolution`, "the container has no DNS; check its network and the node's resolv.conf"},
+}
+
+// Hint returns a suggestion for fixing a failed command that err wraps,
+// or "" if pxc has none
+func Hint(err error) string {
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) {
+		return ""
+	}
+	text := strings.ToLower(commandErr.Stderr + "\n" + commandErr.Stdout + "\n" + commandErr.Err.Error())
+	for _, hint := range commandHints {
+		if strings.Contains(text, hint.match) {
+			return hint.hint
+		}
+	}
+	return ""
+}
+
+// newCommandError describes a command that failed with err
+func newCommandError(cmd *exec.Cmd, err error, stdout, stderr string) *CommandError {
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+		if stderr == "" {
+			stderr = tail(string(exitErr.Stderr))
+		}
+	}
+	return &CommandError{Args: RedactArgs(cmd.Args), ExitCode: exitCode, Stdout: stdout, Stderr: stderr, Err: err}
+}
+
+// captureOutput makes a command's stdout and stderr also go to buffers,
+// unless they are terminals or files, such as those of interactive
+// commands, which must keep them
+func captureOutput(cmd *exec.Cmd) (stdout, stderr *tailBuffer) {
+	stdout, stderr = &tailBuffer{}, &tailBuffer{}
+	cmd.Stdout = teeOutput(cmd.Stdout, stdout)
+	cmd.Stderr = teeOutput(cmd.Stderr, stderr)
+	return stdout, stderr
+}
+
+func teeOutput(w io.Writer, buffer *tailBuffer) io.Writer {
+	switch w.(type) {
+	case nil:
+		return buffer
+	case *os.File:
+		return w
+	}
+	return io.MultiWriter(w, buffer)
+}
+
+// tailBuffer keeps the last commandOutputLimit bytes written to it
+type tailBuffer struct {
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > commandOutputLimit {
+		b.data = b.data[len(b.data)-commandOutputLimit:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
+
+// tail returns the last commandOutputLimit bytes of output
+func tail(output string) string {
+	if len(output) > commandOutputLimit {
+		return output[len(output)-commandOutputLimit:]
+	}
+	return output
+}
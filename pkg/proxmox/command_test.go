@@ -0,0 +1,109 @@
+package proxmox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommandError(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantExit   int
+		wantStderr string
+		wantError  string
+		wantHint   string
+	}{
+		{
+			name:       "stderr",
+			args:       []string{"sh", "-c", "echo starting; echo 'CT 101 already exists' >&2; exit 2"},
+			wantExit:   2,
+			wantStderr: "CT 101 already exists\n",
+			wantError:  "sh: exit status 2: CT 101 already exists",
+			wantHint:   "the container ID is taken",
+		},
+		{
+			name:      "last lines of stdout without stderr",
+			args:      []string{"sh", "-c", "for i in 1 2 3 4; do echo line $i; done; exit 1"},
+			wantExit:  1,
+			wantError: "sh: exit status 1: line 2; line 3; line 4",
+		},
+		{
+			name:      "missing executable",
+			args:      []string{"pxc-no-such-command", "start", "101"},
+			wantExit:  -1,
+			wantError: "pxc-no-such-command start: exec: \"pxc-no-such-command\": executable file not found",
+			wantHint:  "run pxc on a Proxmox VE node",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RunCommand(exec.Command(tt.args[0], tt.args[1:]...))
+			var commandErr *CommandError
+			if !errors.As(err, &commandErr) {
+				t.Fatalf("RunCommand() error = %v, want a *CommandError", err)
+			}
+			if commandErr.ExitCode != tt.wantExit {
+				t.Errorf("ExitCode = %d, want %d", commandErr.ExitCode, tt.wantExit)
+			}
+			if tt.wantStderr != "" && commandErr.Stderr != tt.wantStderr {
+				t.Errorf("Stderr = %q, want %q", commandErr.Stderr, tt.wantStderr)
+			}
+			if !strings.HasPrefix(err.Error(), tt.wantError) {
+				t.Errorf("Error() = %q, want prefix %q", err.Error(), tt.wantError)
+			}
+			if hint := Hint(err); !strings.Contains(hint, tt.wantHint) || (tt.wantHint == "") != (hint == "") {
+				t.Errorf("Hint() = %q, want %q", hint, tt.wantHint)
+			}
+		})
+	}
+}
+
+func TestRunCommandKeepsOutput(t *testing.T) {
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", "echo progress; echo failed >&2; exit 1")
+	cmd.Stdout = &stdout
+	err := RunCommand(cmd)
+
+	if stdout.String() != "progress\n" {
+		t.Errorf("stdout = %q, want the command's output", stdout.String())
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("RunCommand() error = %v, want it to wrap the exit status", err)
+	}
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) || commandErr.Stdout != "progress\n" || commandErr.Stderr != "failed\n" {
+		t.Errorf("RunCommand() error = %#v, want the captured output", err)
+	}
+}
+
+func TestCommandOutputError(t *testing.T) {
+	_, err := CommandOutput(exec.Command("sh", "-c", "echo \"storage 'fast' does not exist\" >&2; exit 255"))
+	if want := "sh: exit status 255: storage 'fast' does not exist"; err == nil || err.Error() != want {
+		t.Errorf("CommandOutput() error = %v, want %q", err, want)
+	}
+	if hint := Hint(err); !strings.Contains(hint, "pvesm status") {
+		t.Errorf("Hint() = %q, want the storage hint", hint)
+	}
+}
+
+func TestCommandContextInterrupts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := RunCommand(CommandContext(ctx, "sleep", "5"))
+	if err == nil {
+		t.Fatal("RunCommand() expected error after cancel, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command ran for %v after cancel", elapsed)
+	}
+}
@@ -0,0 +1,158 @@
+package proxmox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+// CopyOptions control how files are copied into a container
+type CopyOptions struct {
+	Archive bool   // Copy a file through a tar archive too, preserving its mode and owner
+	Chown   string // USER[:GROUP] to own the copied files instead of their host owner
+}
+
+// CopyPlan returns the commands that copy source on the host to dest in a
+// container, each starting with the program to run, and the commands that
+// clean up after them whether or not they succeed.
+//
+// pct push copies single files and does not keep their owner, so
+// directories, and files in archive mode, are packed with tar into archive
+// on the host, pushed and extracted in the container, which preserves modes,
+// owners and symlinks. A directory's contents are extracted into dest.
+// Chown extracts without the archived owners and then owns dest to it.
+func CopyPlan(vmid int, source string, isDir bool, dest, archive string, opts CopyOptions) (steps, cleanup [][]string) {
+	inContainer := func(command ...string) []string {
+		return append([]string{"pct"}, ExecArgs(vmid, ExecOptions{}, command)...)
+	}
+	id := strconv.Itoa(vmid)
+	parent := path.Dir(dest)
+
+	if !isDir && !opts.Archive {
+		push := []string{"pct", "push", id, source, dest}
+		if opts.Chown != "" {
+			user, group, _ := strings.Cut(opts.Chown, ":")
+			push = append(push, "--user", user)
+			if group != "" {
+				push = append(push, "--group", group)
+			}
+		}
+		return [][]string{inContainer("mkdir", "-p", parent), push}, nil
+	}
+
+	remote := "/tmp/" + filepath.Base(archive)
+	steps = [][]string{
+		append([]string{"tar"}, archiveCreateArgs(source, isDir, archive)...),
+		{"pct", "push", id, archive, remote},
+	}
+	if isDir {
+		steps = append(steps,
+			inContainer("mkdir", "-p", dest),
+			inContainer(append([]string{"tar"}, archiveExtractArgs(remote, dest, opts.Chown)...)...),
+		)
+		cleanup = [][]string{inContainer("rm", "-f", remote)}
+	} else {
+		// tar cannot rename the file, so it is extracted next to the
+		// archive and moved into place
+		staging := remote + ".d"
+		steps = append(steps,
+			inContainer("mkdir", "-p", staging, parent),
+			inContainer(append([]string{"tar"}, archiveExtractArgs(remote, staging, opts.Chown)...)...),
+			inContainer("mv", "-f", path.Join(staging, filepath.Base(source)), dest),
+		)
+		cleanup = [][]string{inContainer("rm", "-rf", remote, staging)}
+	}
+	if opts.Chown != "" {
+		steps = append(steps, inContainer("chown", "-R", opts.Chown, dest))
+	}
+	return steps, cleanup
+}
+
+// ExtractPlan returns the commands that copy source in a container, a file
+// or a directory, into dir on the host under its own name, and the commands
+// that clean up after them whether or not they succeed. source is packed
+// with tar into archive in the container, pulled and extracted, which
+// preserves modes, owners and symlinks.
+func ExtractPlan(vmid int, source, dir, archive string) (steps, cleanup [][]string) {
+	inContainer := func(command ...string) []string {
+		return append([]string{"pct"}, ExecArgs(vmid, ExecOptions{}, command)...)
+	}
+	remote := "/tmp/" + filepath.Base(archive)
+	steps = [][]string{
+		inContainer(append([]string{"tar"}, archiveCreateArgs(source, false, remote)...)...),
+		{"pct", "pull", strconv.Itoa(vmid), remote, archive},
+		{"mkdir", "-p", dir},
+		append([]string{"tar"}, archiveExtractArgs(archive, dir, "")...),
+	}
+	cleanup = [][]string{inContainer("rm", "-f", remote), {"rm", "-f", archive}}
+	return steps, cleanup
+}
+
+// archiveCreateArgs returns the tar arguments that pack a directory's
+// contents, or a single file, with numeric owners and permissions
+func archiveCreateArgs(source string, isDir bool, archive string) []string {
+	if isDir {
+		return []string{"--numeric-owner", "-cpf", archive, "-C", source, "."}
+	}
+	return []string{"--numeric-owner", "-cpf", archive, "-C", filepath.Dir(source), filepath.Base(source)}
+}
+
+// archiveExtractArgs returns the tar arguments that unpack an archive into
+// dir, restoring the archived owners unless chown replaces them
+func archiveExtractArgs(archive, dir, chown string) []string {
+	args := []string{"-xpf", archive, "-C", dir}
+	if chown != "" {
+		return append(args, "--no-same-owner")
+	}
+	return append(args, "--numeric-owner", "--same-owner")
+}
+
+// RunCopyPlan runs the commands of a copy plan with run, then its cleanup
+// commands, whose failures are ignored
+func RunCopyPlan(run func(name string, args ...string) error, steps, cleanup [][]string) error {
+	var err error
+	for _, step := range steps {
+		if err = run(step[0], step[1:]...); err != nil {
+			err = fmt.Errorf("%s failed: %w", strings.Join(step, " "), err)
+			break
+		}
+	}
+	for _, step := range cleanup {
+		_ = run(step[0], step[1:]...)
+	}
+	return err
+}
+
+// CopyToContainer copies a file or directory on the host to dest in a
+// container, as described by CopyPlan
+func (c *Client) CopyToContainer(vmid int, source, dest string, opts CopyOptions) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", source, err)
+	}
+
+	archive := filepath.Join(os.TempDir(), fmt.Sprintf("pxc-cp-%d-%d.tar", vmid, os.Getpid()))
+	steps, cleanup := CopyPlan(vmid, source, info.IsDir(), dest, archive, opts)
+	if c.dryRun {
+		for _, step := range steps {
+			c.log.Logf(output.Info, "DRY RUN: Would run: %s", strings.Join(step, " "))
+		}
+		return nil
+	}
+	defer os.Remove(archive)
+
+	run := func(name string, args ...string) error {
+		c.log.Logf(output.Debug, "Executing: %s %s", name, strings.Join(args, " "))
+		return RunCommand(exec.Command(name, args...))
+	}
+	if err := RunCopyPlan(run, steps, cleanup); err != nil {
+		return fmt.Errorf("failed to copy %s to container %d: %w", source, vmid, err)
+	}
+	return nil
+}
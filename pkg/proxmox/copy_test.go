@@ -0,0 +1,151 @@
+package proxmox
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCopyPlan(t *testing.T) {
+	archive := "/tmp/pxc-cp-101.tar"
+
+	tests := []struct {
+		name        string
+		source      string
+		isDir       bool
+		dest        string
+		opts        CopyOptions
+		wantSteps   []string
+		wantCleanup []string
+	}{
+		{
+			name:   "directory uses tar",
+			source: "/home/dev/site/public",
+			isDir:  true,
+			dest:   "/srv/www",
+			wantSteps: []string{
+				"tar --numeric-owner -cpf /tmp/pxc-cp-101.tar -C /home/dev/site/public .",
+				"pct push 101 /tmp/pxc-cp-101.tar /tmp/pxc-cp-101.tar",
+				"pct exec 101 -- mkdir -p /srv/www",
+				"pct exec 101 -- tar -xpf /tmp/pxc-cp-101.tar -C /srv/www --numeric-owner --same-owner",
+			},
+			wantCleanup: []string{"pct exec 101 -- rm -f /tmp/pxc-cp-101.tar"},
+		},
+		{
+			name:   "directory with chown",
+			source: "/home/dev/uploads",
+			isDir:  true,
+			dest:   "/srv/app/uploads",
+			opts:   CopyOptions{Chown: "app:app"},
+			wantSteps: []string{
+				"tar --numeric-owner -cpf /tmp/pxc-cp-101.tar -C /home/dev/uploads .",
+				"pct push 101 /tmp/pxc-cp-101.tar /tmp/pxc-cp-101.tar",
+				"pct exec 101 -- mkdir -p /srv/app/uploads",
+				"pct exec 101 -- tar -xpf /tmp/pxc-cp-101.tar -C /srv/app/uploads --no-same-owner",
+				"pct exec 101 -- chown -R app:app /srv/app/uploads",
+			},
+			wantCleanup: []string{"pct exec 101 -- rm -f /tmp/pxc-cp-101.tar"},
+		},
+		{
+			name:   "file is pushed",
+			source: "/home/dev/nginx.conf",
+			dest:   "/etc/nginx/nginx.conf",
+			wantSteps: []string{
+				"pct exec 101 -- mkdir -p /etc/nginx",
+				"pct push 101 /home/dev/nginx.conf /etc/nginx/nginx.conf",
+			},
+		},
+		{
+			name:   "file with chown is pushed with owner",
+			source: "/home/dev/nginx.conf",
+			dest:   "/etc/nginx/nginx.conf",
+			opts:   CopyOptions{Chown: "www-data:www-data"},
+			wantSteps: []string{
+				"pct exec 101 -- mkdir -p /etc/nginx",
+				"pct push 101 /home/dev/nginx.conf /etc/nginx/nginx.conf --user www-data --group www-data",
+			},
+		},
+		{
+			name:   "file in archive mode uses tar",
+			source: "/home/dev/deploy.sh",
+			dest:   "/usr/local/bin/deploy",
+			opts:   CopyOptions{Archive: true},
+			wantSteps: []string{
+				"tar --numeric-owner -cpf /tmp/pxc-cp-101.tar -C /home/dev deploy.sh",
+				"pct push 101 /tmp/pxc-cp-101.tar /tmp/pxc-cp-101.tar",
+				"pct exec 101 -- mkdir -p /tmp/pxc-cp-101.tar.d /usr/local/bin",
+				"pct exec 101 -- tar -xpf /tmp/pxc-cp-101.tar -C /tmp/pxc-cp-101.tar.d --numeric-owner --same-owner",
+				"pct exec 101 -- mv -f /tmp/pxc-cp-101.tar.d/deploy.sh /usr/local/bin/deploy",
+			},
+			wantCleanup: []string{"pct exec 101 -- rm -rf /tmp/pxc-cp-101.tar /tmp/pxc-cp-101.tar.d"},
+		},
+	}
+
+	join := func(commands [][]string) []string {
+		var joined []string
+		for _, command := range commands {
+			joined = append(joined, strings.Join(command, " "))
+		}
+		return joined
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, cleanup := CopyPlan(101, tt.source, tt.isDir, tt.dest, archive, tt.opts)
+			if got := join(steps); !reflect.DeepEqual(got, tt.wantSteps) {
+				t.Errorf("CopyPlan() steps =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.wantSteps, "\n"))
+			}
+			if got := join(cleanup); !reflect.DeepEqual(got, tt.wantCleanup) {
+				t.Errorf("CopyPlan() cleanup = %v, want %v", got, tt.wantCleanup)
+			}
+		})
+	}
+}
+
+func TestRunCopyPlan(t *testing.T) {
+	steps := [][]string{{"tar", "-cpf", "a.tar"}, {"pct", "push"}, {"pct", "exec"}}
+	cleanup := [][]string{{"pct", "rm"}}
+
+	var ran []string
+	err := RunCopyPlan(func(name string, args ...string) error {
+		ran = append(ran, strings.Join(append([]string{name}, args...), " "))
+		if name == "pct" && args[0] == "push" {
+			return errors.New("exit status 1")
+		}
+		return nil
+	}, steps, cleanup)
+
+	if err == nil || !strings.Contains(err.Error(), "pct push failed") {
+		t.Errorf("RunCopyPlan() error = %v, want pct push failure", err)
+	}
+	want := []string{"tar -cpf a.tar", "pct push", "pct rm"}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("RunCopyPlan() ran %v, want %v (cleanup after the failed step)", ran, want)
+	}
+}
+
+func TestExtractPlan(t *testing.T) {
+	steps, cleanup := ExtractPlan(101, "/src/app/dist", "/tmp/pxc-stages/build/0", "/tmp/pxc-stage-101.tar")
+
+	join := func(commands [][]string) []string {
+		var joined []string
+		for _, command := range commands {
+			joined = append(joined, strings.Join(command, " "))
+		}
+		return joined
+	}
+	wantSteps := []string{
+		"pct exec 101 -- tar --numeric-owner -cpf /tmp/pxc-stage-101.tar -C /src/app dist",
+		"pct pull 101 /tmp/pxc-stage-101.tar /tmp/pxc-stage-101.tar",
+		"mkdir -p /tmp/pxc-stages/build/0",
+		"tar -xpf /tmp/pxc-stage-101.tar -C /tmp/pxc-stages/build/0 --numeric-owner --same-owner",
+	}
+	if got := join(steps); !reflect.DeepEqual(got, wantSteps) {
+		t.Errorf("ExtractPlan() steps =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(wantSteps, "\n"))
+	}
+	wantCleanup := []string{"pct exec 101 -- rm -f /tmp/pxc-stage-101.tar", "rm -f /tmp/pxc-stage-101.tar"}
+	if got := join(cleanup); !reflect.DeepEqual(got, wantCleanup) {
+		t.Errorf("ExtractPlan() cleanup = %v, want %v", got, wantCleanup)
+	}
+}
@@ -0,0 +1,58 @@
+package proxmox
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ExecOptions control how a command runs inside a container
+type ExecOptions struct {
+	User    string   // Run as this user instead of root
+	WorkDir string   // Run from this directory instead of /
+	Env     []string // Set these KEY=VALUE variables for the command
+}
+
+// ExecArgs returns the pct arguments that run command in a container. Every
+// command run in a container (pxc exec, pxc enter and build run steps) is
+// built here, so user and working directory behave the same everywhere.
+//
+// Without options the command is passed to pct exec unchanged. A working
+// directory wraps it in sh -c 'cd DIR && exec COMMAND'; a user runs that
+// shell through su, which works with both util-linux and busybox.
+// Environment variables are set with env, as pct exec has no option for them.
+func ExecArgs(vmid int, opts ExecOptions, command []string) []string {
+	args := []string{"exec", strconv.Itoa(vmid), "--"}
+	if len(opts.Env) > 0 {
+		command = append(append([]string{"env"}, opts.Env...), command...)
+	}
+	if opts.User == "" && opts.WorkDir == "" {
+		return append(args, command...)
+	}
+
+	script := "exec " + shellJoin(command)
+	if opts.WorkDir != "" {
+		script = "cd " + shellQuote(opts.WorkDir) + " && " + script
+	}
+
+	if opts.User == "" {
+		return append(args, "sh", "-c", script)
+	}
+	return append(args, "su", "-s", "/bin/sh", opts.User, "-c", script)
+}
+
+// shellJoin quotes each word of a command for sh
+func shellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = shellQuote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes a string for sh, leaving simple words as they are
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:@%+,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,60 @@
+package proxmox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ExecOptions
+		command  []string
+		expected []string
+	}{
+		{
+			name:     "no options",
+			command:  []string{"ls", "-la", "/srv"},
+			expected: []string{"exec", "342", "--", "ls", "-la", "/srv"},
+		},
+		{
+			name:     "workdir",
+			opts:     ExecOptions{WorkDir: "/srv/app"},
+			command:  []string{"npm", "run", "migrate"},
+			expected: []string{"exec", "342", "--", "sh", "-c", "cd /srv/app && exec npm run migrate"},
+		},
+		{
+			name:     "user",
+			opts:     ExecOptions{User: "node"},
+			command:  []string{"whoami"},
+			expected: []string{"exec", "342", "--", "su", "-s", "/bin/sh", "node", "-c", "exec whoami"},
+		},
+		{
+			name:     "user and workdir with quoting",
+			opts:     ExecOptions{User: "node", WorkDir: "/srv/my app"},
+			command:  []string{"sh", "-c", "echo 'hi' && pwd"},
+			expected: []string{"exec", "342", "--", "su", "-s", "/bin/sh", "node", "-c", `cd '/srv/my app' && exec sh -c 'echo '\''hi'\'' && pwd'`},
+		},
+		{
+			name:     "environment",
+			opts:     ExecOptions{Env: []string{"LOG_LEVEL=debug", "GREETING=hello world"}},
+			command:  []string{"printenv"},
+			expected: []string{"exec", "342", "--", "env", "LOG_LEVEL=debug", "GREETING=hello world", "printenv"},
+		},
+		{
+			name:     "environment with user and workdir",
+			opts:     ExecOptions{User: "node", WorkDir: "/srv/app", Env: []string{"NODE_ENV=test"}},
+			command:  []string{"npm", "test"},
+			expected: []string{"exec", "342", "--", "su", "-s", "/bin/sh", "node", "-c", "cd /srv/app && exec env NODE_ENV=test npm test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExecArgs(342, tt.opts, tt.command)
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("ExecArgs() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
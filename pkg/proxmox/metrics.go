@@ -0,0 +1,358 @@
+package proxmox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+// ContainerMetrics is a sample of a container's CPU, memory and I/O usage
+// read from its cgroup. Two samples give the CPU usage over the time between
+// them.
+type ContainerMetrics struct {
+	CPUUsage      time.Duration // Total CPU time used since the container started
+	CPUAverage    float64       // CPU usage Proxmox measured, in percent of one core; API samples only
+	MemoryCurrent int64         // Bytes in use, including page cache
+	MemoryLimit   int64         // Bytes the container may use, 0 if unlimited
+	BlockRead     int64         // Bytes read from block devices since the container started
+	BlockWrite    int64         // Bytes written to block devices
+	NetRx         int64         // Bytes received on the container's interfaces
+	NetTx         int64         // Bytes sent
+	CgroupVersion int           // 1 or 2, 0 when reported by the API
+	ReadAt        time.Time
+}
+
+// CPUDelta returns the CPU time used since an earlier sample
+func (m *ContainerMetrics) CPUDelta(previous *ContainerMetrics) time.Duration {
+	if previous == nil || m.CPUUsage < previous.CPUUsage {
+		return 0
+	}
+	return m.CPUUsage - previous.CPUUsage
+}
+
+// CPUPercent returns the CPU usage since an earlier sample, where 100% is one
+// core fully used
+func (m *ContainerMetrics) CPUPercent(previous *ContainerMetrics) float64 {
+	if previous == nil {
+		return 0
+	}
+	elapsed := m.ReadAt.Sub(previous.ReadAt)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(m.CPUDelta(previous)) / float64(elapsed) * 100
+}
+
+// cgroupRoot is where the host mounts the cgroup hierarchy; Proxmox puts each
+// container below lxc/VMID
+var cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupV1Unlimited is where memory.limit_in_bytes means no limit; cgroup v1
+// reports the largest page-aligned int64 for an unlimited container
+const cgroupV1Unlimited = 1 << 62
+
+// cgroupReader reads a cgroup file
+type cgroupReader func(path string) (string, error)
+
+// ReadContainerMetrics samples the CPU and memory usage of a running
+// container. The container's cgroup is read on the host, falling back to
+// reading it inside the container with pct exec when the host path is not
+// available. Both cgroup v2 and v1 are supported.
+func (c *Client) ReadContainerMetrics(vmid int) (*ContainerMetrics, error) {
+	if c.dryRun {
+		return &ContainerMetrics{CgroupVersion: 2, ReadAt: time.Now()}, nil
+	}
+
+	hostRead := func(path string) (string, error) {
+		data, err := os.ReadFile(path)
+		return string(data), err
+	}
+	id := strconv.Itoa(vmid)
+	metrics, err := readCgroupMetrics(hostRead, cgroupPaths{
+		v2:       filepath.Join(cgroupRoot, "lxc", id),
+		v1CPU:    filepath.Join(cgroupRoot, "cpuacct", "lxc", id),
+		v1Memory: filepath.Join(cgroupRoot, "memory", "lxc", id),
+		v1Blkio:  filepath.Join(cgroupRoot, "blkio", "lxc", id),
+	})
+	if err == nil {
+		return metrics, nil
+	}
+	c.log.Logf(output.Debug, "Host cgroup of container %d unavailable (%v), reading it with pct exec", vmid, err)
+
+	// Inside its namespace a container sees its own cgroup at the root
+	containerRead := func(path string) (string, error) {
+		output, err := CommandOutput(c.command(context.Background(), "pct", "exec", id, "--", "cat", path))
+		return string(output), err
+	}
+	metrics, err = readCgroupMetrics(containerRead, cgroupPaths{
+		v2:       "/sys/fs/cgroup",
+		v1CPU:    "/sys/fs/cgroup/cpuacct",
+		v1Memory: "/sys/fs/cgroup/memory",
+		v1Blkio:  "/sys/fs/cgroup/blkio",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics of container %d: %w", vmid, err)
+	}
+	return metrics, nil
+}
+
+// cgroupPaths are the directories of a container's cgroup in either version
+type cgroupPaths struct {
+	v2       string
+	v1CPU    string
+	v1Memory string
+	v1Blkio  string
+}
+
+// readCgroupMetrics reads the cgroup v2 files of a container, or the v1 files
+// if there is no v2 cpu.stat. Block I/O is left at zero when the io or blkio
+// controller is not enabled for the container.
+func readCgroupMetrics(read cgroupReader, paths cgroupPaths) (*ContainerMetrics, error) {
+	readAt := time.Now()
+	if stat, err := read(filepath.Join(paths.v2, "cpu.stat")); err == nil {
+		metrics, err := parseCgroupV2(read, paths.v2, stat)
+		if err != nil {
+			return nil, err
+		}
+		if ioStat, err := read(filepath.Join(paths.v2, "io.stat")); err == nil {
+			metrics.BlockRead, metrics.BlockWrite = parseIOStat(ioStat)
+		}
+		metrics.ReadAt = readAt
+		return metrics, nil
+	}
+
+	usage, err := read(filepath.Join(paths.v1CPU, "cpuacct.usage"))
+	if err != nil {
+		return nil, fmt.Errorf("no cgroup v2 cpu.stat or v1 cpuacct.usage: %w", err)
+	}
+	metrics, err := parseCgroupV1(read, paths.v1Memory, usage)
+	if err != nil {
+		return nil, err
+	}
+	if serviced, err := read(filepath.Join(paths.v1Blkio, "blkio.throttle.io_service_bytes")); err == nil {
+		metrics.BlockRead, metrics.BlockWrite = parseBlkioServiced(serviced)
+	}
+	metrics.ReadAt = readAt
+	return metrics, nil
+}
+
+// parseCgroupV2 reads usage_usec from cpu.stat and memory.current and
+// memory.max from dir
+func parseCgroupV2(read cgroupReader, dir, stat string) (*ContainerMetrics, error) {
+	usec, err := parseCPUStat(stat)
+	if err != nil {
+		return nil, err
+	}
+	metrics := &ContainerMetrics{CPUUsage: time.Duration(usec) * time.Microsecond, CgroupVersion: 2}
+
+	current, err := read(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory.current: %w", err)
+	}
+	if metrics.MemoryCurrent, err = parseCgroupValue("memory.current", current); err != nil {
+		return nil, err
+	}
+
+	// memory.max is missing for the root cgroup, which is unlimited
+	if limit, err := read(filepath.Join(dir, "memory.max")); err == nil && strings.TrimSpace(limit) != "max" {
+		if metrics.MemoryLimit, err = parseCgroupValue("memory.max", limit); err != nil {
+			return nil, err
+		}
+	}
+	return metrics, nil
+}
+
+// parseCgroupV1 reads the nanoseconds in cpuacct.usage and the memory usage
+// and limit from memoryDir
+func parseCgroupV1(read cgroupReader, memoryDir, usage string) (*ContainerMetrics, error) {
+	nsec, err := parseCgroupValue("cpuacct.usage", usage)
+	if err != nil {
+		return nil, err
+	}
+	metrics := &ContainerMetrics{CPUUsage: time.Duration(nsec), CgroupVersion: 1}
+
+	current, err := read(filepath.Join(memoryDir, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory.usage_in_bytes: %w", err)
+	}
+	if metrics.MemoryCurrent, err = parseCgroupValue("memory.usage_in_bytes", current); err != nil {
+		return nil, err
+	}
+
+	if limit, err := read(filepath.Join(memoryDir, "memory.limit_in_bytes")); err == nil {
+		if metrics.MemoryLimit, err = parseCgroupValue("memory.limit_in_bytes", limit); err != nil {
+			return nil, err
+		}
+		if metrics.MemoryLimit >= cgroupV1Unlimited {
+			metrics.MemoryLimit = 0
+		}
+	}
+	return metrics, nil
+}
+
+// parseCPUStat returns usage_usec from a cgroup v2 cpu.stat file
+func parseCPUStat(content string) (int64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return parseCgroupValue("cpu.stat usage_usec", fields[1])
+		}
+	}
+	return 0, fmt.Errorf("no usage_usec in cpu.stat")
+}
+
+// parseIOStat sums the rbytes and wbytes of every device in a cgroup v2
+// io.stat file, whose lines look like "8:0 rbytes=1024 wbytes=512 rios=2 ..."
+func parseIOStat(content string) (read, written int64) {
+	for _, line := range strings.Split(content, "\n") {
+		for _, field := range strings.Fields(line) {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				read += n
+			case "wbytes":
+				written += n
+			}
+		}
+	}
+	return read, written
+}
+
+// parseBlkioServiced sums the Read and Write bytes of every device in a
+// cgroup v1 blkio.throttle.io_service_bytes file, whose lines look like
+// "8:0 Read 1024"
+func parseBlkioServiced(content string) (read, written int64) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[1] {
+		case "Read":
+			read += n
+		case "Write":
+			written += n
+		}
+	}
+	return read, written
+}
+
+// parseNetDev sums the bytes received and sent on every interface but the
+// loopback in a /proc/net/dev file
+func parseNetDev(content string) (received, sent int64, err error) {
+	for _, line := range strings.Split(content, "\n") {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, rxErr := strconv.ParseInt(fields[0], 10, 64)
+		tx, txErr := strconv.ParseInt(fields[8], 10, 64)
+		if rxErr != nil || txErr != nil {
+			return 0, 0, fmt.Errorf("invalid /proc/net/dev line '%s'", strings.TrimSpace(line))
+		}
+		received += rx
+		sent += tx
+	}
+	return received, sent, nil
+}
+
+// ReadContainerStats samples the CPU, memory, block and network I/O of a
+// running container for pxc stats. Network counters come from the /proc of
+// the container's init process on the host, or from inside the container
+// with pct exec. A container without network interfaces reports no traffic.
+func (c *Client) ReadContainerStats(vmid int) (*ContainerMetrics, error) {
+	metrics, err := c.ReadContainerMetrics(vmid)
+	if err != nil || c.dryRun {
+		return metrics, err
+	}
+
+	id := strconv.Itoa(vmid)
+	var netDev string
+	if !c.remote() {
+		if output, err := CommandOutput(c.command(context.Background(), "lxc-info", "-n", id, "-p", "-H")); err == nil {
+			if data, err := os.ReadFile(filepath.Join("/proc", strings.TrimSpace(string(output)), "net", "dev")); err == nil {
+				netDev = string(data)
+			}
+		}
+	}
+	if netDev == "" {
+		output, err := CommandOutput(c.command(context.Background(), "pct", "exec", id, "--", "cat", "/proc/net/dev"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read network usage of container %d: %w", vmid, err)
+		}
+		netDev = string(output)
+	}
+	if metrics.NetRx, metrics.NetTx, err = parseNetDev(netDev); err != nil {
+		c.log.Logf(output.Debug, "Network usage of container %d unavailable: %v", vmid, err)
+	}
+	return metrics, nil
+}
+
+// parseCgroupValue parses a cgroup file holding a single number
+func parseCgroupValue(name, content string) (int64, error) {
+	value, err := strconv.ParseInt(strings.TrimSpace(content), 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s value '%s'", name, strings.TrimSpace(content))
+	}
+	return value, nil
+}
+
+// PopulateUsage sets the CPUUsage and MemoryUsage of the running containers
+// from two samples of their cgroups taken interval apart. Containers whose
+// usage cannot be read keep zero usage.
+func (c *Client) PopulateUsage(containers []ContainerInfo, interval time.Duration) {
+	first := make(map[int]*ContainerMetrics)
+	for _, container := range containers {
+		if container.Status != "running" {
+			continue
+		}
+		metrics, err := c.ReadContainerMetrics(container.VMID)
+		if err != nil {
+			c.log.Logf(output.Debug, "Usage of container %d unavailable: %v", container.VMID, err)
+			continue
+		}
+		first[container.VMID] = metrics
+	}
+	if len(first) == 0 {
+		return
+	}
+
+	if !c.dryRun {
+		time.Sleep(interval)
+	}
+	for i := range containers {
+		previous, sampled := first[containers[i].VMID]
+		if !sampled {
+			continue
+		}
+		metrics, err := c.ReadContainerMetrics(containers[i].VMID)
+		if err != nil {
+			continue
+		}
+		containers[i].CPUUsage = metrics.CPUPercent(previous)
+		containers[i].MemoryUsage = metrics.MemoryCurrent
+	}
+}
@@ -0,0 +1,172 @@
+package proxmox
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReadCgroupMetrics(t *testing.T) {
+	paths := cgroupPaths{
+		v2:       "/sys/fs/cgroup/lxc/101",
+		v1CPU:    "/sys/fs/cgroup/cpuacct/lxc/101",
+		v1Memory: "/sys/fs/cgroup/memory/lxc/101",
+		v1Blkio:  "/sys/fs/cgroup/blkio/lxc/101",
+	}
+	cpuStat := "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\nnr_periods 0\n"
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    ContainerMetrics
+		wantErr bool
+	}{
+		{
+			name: "cgroup v2 with memory limit",
+			files: map[string]string{
+				"/sys/fs/cgroup/lxc/101/cpu.stat":       cpuStat,
+				"/sys/fs/cgroup/lxc/101/memory.current": "268435456\n",
+				"/sys/fs/cgroup/lxc/101/memory.max":     "536870912\n",
+			},
+			want: ContainerMetrics{CPUUsage: 2500 * time.Millisecond, MemoryCurrent: 268435456, MemoryLimit: 536870912, CgroupVersion: 2},
+		},
+		{
+			name: "cgroup v2 unlimited",
+			files: map[string]string{
+				"/sys/fs/cgroup/lxc/101/cpu.stat":       cpuStat,
+				"/sys/fs/cgroup/lxc/101/memory.current": "1048576\n",
+				"/sys/fs/cgroup/lxc/101/memory.max":     "max\n",
+			},
+			want: ContainerMetrics{CPUUsage: 2500 * time.Millisecond, MemoryCurrent: 1048576, CgroupVersion: 2},
+		},
+		{
+			name: "cgroup v2 with block I/O",
+			files: map[string]string{
+				"/sys/fs/cgroup/lxc/101/cpu.stat":       cpuStat,
+				"/sys/fs/cgroup/lxc/101/memory.current": "1048576\n",
+				"/sys/fs/cgroup/lxc/101/io.stat":        "8:0 rbytes=4096 wbytes=1024 rios=1 wios=1 dbytes=0 dios=0\n253:1 rbytes=2048 wbytes=0 rios=1 wios=0\n",
+			},
+			want: ContainerMetrics{CPUUsage: 2500 * time.Millisecond, MemoryCurrent: 1048576, BlockRead: 6144, BlockWrite: 1024, CgroupVersion: 2},
+		},
+		{
+			name: "cgroup v1 fallback",
+			files: map[string]string{
+				"/sys/fs/cgroup/cpuacct/lxc/101/cpuacct.usage":        "1500000000\n",
+				"/sys/fs/cgroup/memory/lxc/101/memory.usage_in_bytes": "134217728\n",
+				"/sys/fs/cgroup/memory/lxc/101/memory.limit_in_bytes": "268435456\n",
+			},
+			want: ContainerMetrics{CPUUsage: 1500 * time.Millisecond, MemoryCurrent: 134217728, MemoryLimit: 268435456, CgroupVersion: 1},
+		},
+		{
+			name: "cgroup v1 with block I/O",
+			files: map[string]string{
+				"/sys/fs/cgroup/cpuacct/lxc/101/cpuacct.usage":                 "1500000000\n",
+				"/sys/fs/cgroup/memory/lxc/101/memory.usage_in_bytes":          "134217728\n",
+				"/sys/fs/cgroup/blkio/lxc/101/blkio.throttle.io_service_bytes": "8:0 Read 4096\n8:0 Write 512\n8:0 Sync 512\n8:0 Total 4608\nTotal 4608\n",
+			},
+			want: ContainerMetrics{CPUUsage: 1500 * time.Millisecond, MemoryCurrent: 134217728, BlockRead: 4096, BlockWrite: 512, CgroupVersion: 1},
+		},
+		{
+			name: "cgroup v1 unlimited",
+			files: map[string]string{
+				"/sys/fs/cgroup/cpuacct/lxc/101/cpuacct.usage":        "1500000000\n",
+				"/sys/fs/cgroup/memory/lxc/101/memory.usage_in_bytes": "134217728\n",
+				"/sys/fs/cgroup/memory/lxc/101/memory.limit_in_bytes": "9223372036854771712\n",
+			},
+			want: ContainerMetrics{CPUUsage: 1500 * time.Millisecond, MemoryCurrent: 134217728, CgroupVersion: 1},
+		},
+		{
+			name: "cpu.stat without usage",
+			files: map[string]string{
+				"/sys/fs/cgroup/lxc/101/cpu.stat":       "nr_periods 0\n",
+				"/sys/fs/cgroup/lxc/101/memory.current": "1048576\n",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid memory value",
+			files: map[string]string{
+				"/sys/fs/cgroup/lxc/101/cpu.stat":       cpuStat,
+				"/sys/fs/cgroup/lxc/101/memory.current": "lots\n",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no cgroup",
+			files:   map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read := func(path string) (string, error) {
+				content, exists := tt.files[path]
+				if !exists {
+					return "", fmt.Errorf("open %s: no such file or directory", path)
+				}
+				return content, nil
+			}
+
+			metrics, err := readCgroupMetrics(read, paths)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("readCgroupMetrics() expected error, got %+v", metrics)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readCgroupMetrics() unexpected error: %v", err)
+			}
+			if metrics.ReadAt.IsZero() {
+				t.Error("readCgroupMetrics() did not set ReadAt")
+			}
+			metrics.ReadAt = time.Time{}
+			if *metrics != tt.want {
+				t.Errorf("readCgroupMetrics() = %+v, want %+v", *metrics, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerMetricsCPUPercent(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	previous := &ContainerMetrics{CPUUsage: 10 * time.Second, ReadAt: start}
+	current := &ContainerMetrics{CPUUsage: 13 * time.Second, ReadAt: start.Add(2 * time.Second)}
+
+	if delta := current.CPUDelta(previous); delta != 3*time.Second {
+		t.Errorf("CPUDelta() = %v, want 3s", delta)
+	}
+	if percent := current.CPUPercent(previous); percent != 150 {
+		t.Errorf("CPUPercent() = %v, want 150", percent)
+	}
+	if percent := current.CPUPercent(nil); percent != 0 {
+		t.Errorf("CPUPercent(nil) = %v, want 0", percent)
+	}
+
+	// A restarted container starts counting from zero again
+	restarted := &ContainerMetrics{CPUUsage: time.Second, ReadAt: start.Add(4 * time.Second)}
+	if delta := restarted.CPUDelta(current); delta != 0 {
+		t.Errorf("CPUDelta() after restart = %v, want 0", delta)
+	}
+}
+
+func TestParseNetDev(t *testing.T) {
+	content := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0: 2097152    1500    0    0    0     0          0         0    65536     800    0    0    0     0       0          0
+  eth1:    4096      20    0    0    0     0          0         0     1024      10    0    0    0     0       0          0
+`
+	received, sent, err := parseNetDev(content)
+	if err != nil {
+		t.Fatalf("parseNetDev() unexpected error: %v", err)
+	}
+	if received != 2101248 || sent != 66560 {
+		t.Errorf("parseNetDev() = %d, %d, want 2101248, 66560", received, sent)
+	}
+
+	if _, _, err := parseNetDev("  eth0: lots 0 0 0 0 0 0 0 0 0\n"); err == nil {
+		t.Error("parseNetDev() expected error for an invalid counter")
+	}
+}
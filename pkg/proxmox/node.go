@@ -0,0 +1,134 @@
+package proxmox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+// NodeCapacity is what a node has left for new containers
+type NodeCapacity struct {
+	MemoryTotalMB int64
+	MemoryFreeMB  int64
+	Cores         int
+	Storage       string // Storage DiskFreeGB refers to; empty if unknown
+	DiskFreeGB    int64
+}
+
+// meminfoPath is read when pvesh cannot report node memory
+var meminfoPath = "/proc/meminfo"
+
+// GetNodeCapacity reports the node's memory and CPUs and the free space on
+// storage (skipped if storage is empty). Memory and CPUs come from pvesh,
+// falling back to /proc/meminfo and the local CPU count.
+func (c *Client) GetNodeCapacity(storage string) (*NodeCapacity, error) {
+	var capacity *NodeCapacity
+
+	status, err := CommandOutput(exec.Command("pvesh", "get", "/nodes/"+c.node+"/status", "--output-format", "json"))
+	if err == nil {
+		capacity, err = parseNodeStatus(status)
+	}
+	if err != nil {
+		c.log.Logf(output.Debug, "pvesh node status unavailable (%v), reading %s", err, meminfoPath)
+		data, readErr := os.ReadFile(meminfoPath)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read node memory: %w", readErr)
+		}
+		if capacity, err = parseMeminfo(string(data)); err != nil {
+			return nil, err
+		}
+		capacity.Cores = runtime.NumCPU()
+	}
+
+	if storage == "" {
+		return capacity, nil
+	}
+
+	status, err = CommandOutput(c.command(context.Background(), "pvesm", "status", "--storage", storage))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of storage %s: %w", storage, err)
+	}
+	availableKB, err := parseStorageStatus(string(status), storage)
+	if err != nil {
+		return nil, err
+	}
+	capacity.Storage = storage
+	capacity.DiskFreeGB = availableKB >> 20
+
+	return capacity, nil
+}
+
+// parseNodeStatus parses the JSON output of pvesh get /nodes/NODE/status
+func parseNodeStatus(data []byte) (*NodeCapacity, error) {
+	var status struct {
+		Memory struct {
+			Total int64 `json:"total"`
+			Free  int64 `json:"free"`
+		} `json:"memory"`
+		CPUInfo struct {
+			CPUs int `json:"cpus"`
+		} `json:"cpuinfo"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse node status: %w", err)
+	}
+	if status.Memory.Total == 0 {
+		return nil, fmt.Errorf("node status has no memory information")
+	}
+
+	return &NodeCapacity{
+		MemoryTotalMB: status.Memory.Total >> 20,
+		MemoryFreeMB:  status.Memory.Free >> 20,
+		Cores:         status.CPUInfo.CPUs,
+	}, nil
+}
+
+// parseMeminfo reads total and available memory from /proc/meminfo
+func parseMeminfo(content string) (*NodeCapacity, error) {
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = kb
+	}
+
+	if values["MemTotal"] == 0 {
+		return nil, fmt.Errorf("no MemTotal in %s", meminfoPath)
+	}
+	return &NodeCapacity{
+		MemoryTotalMB: values["MemTotal"] >> 10,
+		MemoryFreeMB:  values["MemAvailable"] >> 10,
+	}, nil
+}
+
+// parseStorageStatus returns the available space in KiB of a storage from
+// pvesm status output (Name Type Status Total Used Available %)
+func parseStorageStatus(output, storage string) (int64, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] != storage {
+			continue
+		}
+		available, err := strconv.ParseInt(fields[5], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid available space '%s' for storage %s", fields[5], storage)
+		}
+		return available, nil
+	}
+	return 0, fmt.Errorf("storage %s not found in pvesm status", storage)
+}
@@ -0,0 +1,38 @@
+package proxmox
+
+import "testing"
+
+func TestParseNodeCapacity(t *testing.T) {
+	status := `{"memory":{"total":34359738368,"used":8589934592,"free":25769803776},"cpuinfo":{"cpus":8,"model":"AMD EPYC"},"uptime":3600}`
+	capacity, err := parseNodeStatus([]byte(status))
+	if err != nil {
+		t.Fatalf("parseNodeStatus() unexpected error: %v", err)
+	}
+	if capacity.MemoryTotalMB != 32768 || capacity.MemoryFreeMB != 24576 || capacity.Cores != 8 {
+		t.Errorf("parseNodeStatus() = %+v, want 32768 MB total, 24576 MB free, 8 cores", capacity)
+	}
+
+	meminfo := "MemTotal:       16384000 kB\nMemFree:         1024000 kB\nMemAvailable:    8192000 kB\n"
+	capacity, err = parseMeminfo(meminfo)
+	if err != nil {
+		t.Fatalf("parseMeminfo() unexpected error: %v", err)
+	}
+	if capacity.MemoryTotalMB != 16000 || capacity.MemoryFreeMB != 8000 {
+		t.Errorf("parseMeminfo() = %+v, want 16000 MB total, 8000 MB available", capacity)
+	}
+
+	pvesm := `Name             Type     Status           Total            Used       Available        %
+local             dir     active        98497780        12345678        81059796   12.53%
+local-lvm     lvmthin     active       366276608        36627660       329648948   10.00%
+`
+	available, err := parseStorageStatus(pvesm, "local-lvm")
+	if err != nil {
+		t.Fatalf("parseStorageStatus() unexpected error: %v", err)
+	}
+	if available != 329648948 {
+		t.Errorf("parseStorageStatus() = %d, want 329648948", available)
+	}
+	if _, err := parseStorageStatus(pvesm, "ceph"); err == nil {
+		t.Error("parseStorageStatus() expected error for unknown storage")
+	}
+}
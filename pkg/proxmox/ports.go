@@ -0,0 +1,337 @@
+package proxmox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+// Published ports are DNAT rules in an nftables table of their own, so
+// they never touch the Proxmox firewall's rules. Ports published on every
+// address of the node are kept in one map and ports published on a single
+// address in another; the rules look the destination up in both. The
+// forwarded connections are masqueraded, so replies come back through the
+// node whatever the containers' gateway.
+const (
+	nftTable    = "pxc"
+	nftPorts    = "ports"
+	nftAddrPort = "addr_ports"
+)
+
+// nftSetup creates the table, maps and chains unless they exist and
+// replaces the chains' rules, so it can run before every change
+var nftSetup = []string{
+	"add table ip " + nftTable,
+	"add map ip " + nftTable + " " + nftPorts + " { type inet_proto . inet_service : ipv4_addr . inet_service ; }",
+	"add map ip " + nftTable + " " + nftAddrPort + " { type ipv4_addr . inet_proto . inet_service : ipv4_addr . inet_service ; }",
+	"add chain ip " + nftTable + " prerouting { type nat hook prerouting priority -100 ; }",
+	"add chain ip " + nftTable + " output { type nat hook output priority -100 ; }",
+	"add chain ip " + nftTable + " postrouting { type nat hook postrouting priority 100 ; }",
+	"flush chain ip " + nftTable + " prerouting",
+	"flush chain ip " + nftTable + " output",
+	"flush chain ip " + nftTable + " postrouting",
+	"add rule ip " + nftTable + " prerouting fib daddr type local dnat ip addr . port to ip daddr . meta l4proto . th dport map @" + nftAddrPort,
+	"add rule ip " + nftTable + " prerouting fib daddr type local dnat ip addr . port to meta l4proto . th dport map @" + nftPorts,
+	"add rule ip " + nftTable + " output fib daddr type local dnat ip addr . port to ip daddr . meta l4proto . th dport map @" + nftAddrPort,
+	"add rule ip " + nftTable + " output fib daddr type local dnat ip addr . port to meta l4proto . th dport map @" + nftPorts,
+	"add rule ip " + nftTable + " postrouting ct status dnat masquerade",
+}
+
+// ipForwardPath is where the node reports whether it forwards IPv4
+var ipForwardPath = "/proc/sys/net/ipv4/ip_forward"
+
+// HostPort is a port on the node. An empty IP stands for every address.
+type HostPort struct {
+	IP       string
+	Port     int
+	Protocol string // tcp or udp
+}
+
+// String formats the port as 8080/tcp or 192.168.1.10:8080/tcp
+func (p HostPort) String() string {
+	port := fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+	if p.IP != "" {
+		port = p.IP + ":" + port
+	}
+	return port
+}
+
+// Overlaps reports whether traffic to one port could reach the other: the
+// same port and protocol, on the same address or on every address
+func (p HostPort) Overlaps(other HostPort) bool {
+	return p.Port == other.Port && p.Protocol == other.Protocol &&
+		(p.IP == "" || other.IP == "" || p.IP == other.IP)
+}
+
+// PortForward forwards a port of the node to a port of a container
+type PortForward struct {
+	HostPort
+	ContainerIP   string
+	ContainerPort int
+}
+
+// String formats the forward as 8080/tcp -> 10.0.0.5:80
+func (f PortForward) String() string {
+	return fmt.Sprintf("%s -> %s:%d", f.HostPort, f.ContainerIP, f.ContainerPort)
+}
+
+// nftKey is the map and the key of a port's element
+func nftKey(port HostPort) (string, string) {
+	key := port.Protocol + " . " + strconv.Itoa(port.Port)
+	if port.IP != "" {
+		return nftAddrPort, port.IP + " . " + key
+	}
+	return nftPorts, key
+}
+
+// portForwardScript returns the nft commands that set up the table, remove
+// the forwards of the given ports and add the given forwards, applied by
+// nft -f as one transaction. Every removed port must be published.
+func portForwardScript(remove []HostPort, add []PortForward) string {
+	lines := append([]string(nil), nftSetup...)
+	for _, port := range remove {
+		set, key := nftKey(port)
+		lines = append(lines, fmt.Sprintf("delete element ip %s %s { %s }", nftTable, set, key))
+	}
+	for _, forward := range add {
+		set, key := nftKey(forward.HostPort)
+		lines = append(lines, fmt.Sprintf("add element ip %s %s { %s : %s . %d }", nftTable, set, key, forward.ContainerIP, forward.ContainerPort))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// parsePortForwards reads the forwards from the output of
+// nft -n list table ip pxc
+func parsePortForwards(output string) ([]PortForward, error) {
+	var forwards []PortForward
+	set := ""
+	var elements strings.Builder
+	collecting := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, found := strings.CutPrefix(line, "map "); found {
+			set = strings.TrimSpace(strings.TrimSuffix(name, "{"))
+			continue
+		}
+		if rest, found := strings.CutPrefix(line, "elements = {"); found {
+			collecting = true
+			line = rest
+		}
+		if !collecting {
+			continue
+		}
+		if before, found := strings.CutSuffix(line, "}"); found {
+			elements.WriteString(before)
+			collecting = false
+			parsed, err := parseElements(set, elements.String())
+			if err != nil {
+				return nil, err
+			}
+			forwards = append(forwards, parsed...)
+			elements.Reset()
+			continue
+		}
+		elements.WriteString(line + " ")
+	}
+	return forwards, nil
+}
+
+// parseElements parses the elements of a ports map, e.g.
+// "tcp . 8080 : 10.0.0.5 . 80, udp . 53 : 10.0.0.6 . 53"
+func parseElements(set, text string) ([]PortForward, error) {
+	var forwards []PortForward
+	for _, element := range strings.Split(text, ",") {
+		element = strings.TrimSpace(element)
+		if element == "" {
+			continue
+		}
+		key, value, found := strings.Cut(element, " : ")
+		if !found {
+			return nil, fmt.Errorf("unexpected element '%s' in map %s", element, set)
+		}
+		keyFields := strings.Split(key, " . ")
+		valueFields := strings.Split(value, " . ")
+		if len(valueFields) != 2 {
+			return nil, fmt.Errorf("unexpected element '%s' in map %s", element, set)
+		}
+
+		var forward PortForward
+		switch {
+		case set == nftAddrPort && len(keyFields) == 3:
+			forward.IP, keyFields = keyFields[0], keyFields[1:]
+		case set == nftPorts && len(keyFields) == 2:
+		default:
+			return nil, fmt.Errorf("unexpected element '%s' in map %s", element, set)
+		}
+		forward.Protocol = protocolName(keyFields[0])
+		port, err := strconv.Atoi(keyFields[1])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected port in element '%s' of map %s", element, set)
+		}
+		containerPort, err := strconv.Atoi(valueFields[1])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected port in element '%s' of map %s", element, set)
+		}
+		forward.Port, forward.ContainerIP, forward.ContainerPort = port, valueFields[0], containerPort
+		forwards = append(forwards, forward)
+	}
+	return forwards, nil
+}
+
+// protocolName turns the protocol numbers nft -n may print into names
+func protocolName(protocol string) string {
+	switch protocol {
+	case "6":
+		return "tcp"
+	case "17":
+		return "udp"
+	}
+	return protocol
+}
+
+// parseListeningPorts reads the sockets listed by ss -Htuln
+func parseListeningPorts(output string) []HostPort {
+	var ports []HostPort
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || (fields[0] != "tcp" && fields[0] != "udp") {
+			continue
+		}
+		local := fields[4]
+		colon := strings.LastIndex(local, ":")
+		if colon < 0 {
+			continue
+		}
+		port, err := strconv.Atoi(local[colon+1:])
+		if err != nil {
+			continue
+		}
+		address, _, _ := strings.Cut(local[:colon], "%")
+		switch address {
+		case "*", "0.0.0.0", "[::]":
+			address = ""
+		}
+		if strings.HasPrefix(address, "[") {
+			// Only IPv4 is forwarded
+			continue
+		}
+		ports = append(ports, HostPort{IP: address, Port: port, Protocol: fields[0]})
+	}
+	return ports
+}
+
+// PortForwards returns the ports published on the node
+func (c *Client) PortForwards(ctx context.Context) ([]PortForward, error) {
+	if c.dryRun {
+		return nil, nil
+	}
+
+	output, err := CommandOutput(CommandContext(ctx, "nft", "-n", "list", "table", "ip", nftTable))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), "No such file or directory") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list published ports: %w", err)
+	}
+	return parsePortForwards(string(output))
+}
+
+// ListeningPorts returns the IPv4 and dual-stack ports that processes on
+// the node listen on
+func (c *Client) ListeningPorts(ctx context.Context) ([]HostPort, error) {
+	if c.dryRun {
+		return nil, nil
+	}
+
+	output, err := CommandOutput(CommandContext(ctx, "ss", "-Htuln"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listening ports: %w", err)
+	}
+	return parseListeningPorts(string(output)), nil
+}
+
+// UpdatePortForwards removes the forwards of the given ports and publishes
+// the given forwards, replacing forwards of the same ports, in one nft
+// transaction. Ports that are not published are skipped.
+func (c *Client) UpdatePortForwards(ctx context.Context, remove []HostPort, add []PortForward) error {
+	if len(remove) == 0 && len(add) == 0 {
+		return nil
+	}
+	if c.dryRun {
+		for _, port := range remove {
+			c.log.Logf(output.Debug, "DRY RUN: Would unpublish port %s", port)
+		}
+		for _, forward := range add {
+			c.log.Logf(output.Debug, "DRY RUN: Would publish port %s", forward)
+		}
+		return nil
+	}
+
+	current, err := c.PortForwards(ctx)
+	if err != nil {
+		return err
+	}
+	published := make(map[HostPort]bool, len(current))
+	for _, forward := range current {
+		published[forward.HostPort] = true
+	}
+
+	var stale []HostPort
+	seen := make(map[HostPort]bool)
+	candidates := append([]HostPort(nil), remove...)
+	for _, forward := range add {
+		candidates = append(candidates, forward.HostPort)
+	}
+	for _, port := range candidates {
+		if published[port] && !seen[port] {
+			stale = append(stale, port)
+			seen[port] = true
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].String() < stale[j].String() })
+
+	if len(add) > 0 {
+		if forwarding, err := os.ReadFile(ipForwardPath); err == nil && strings.TrimSpace(string(forwarding)) == "0" {
+			c.log.Logf(output.Warning, "IPv4 forwarding is disabled on the node, published ports will not reach the containers until net.ipv4.ip_forward is set to 1")
+		}
+	}
+
+	script := portForwardScript(stale, add)
+	c.log.Logf(output.Debug, "Executing: nft -f -\n%s", strings.TrimSuffix(script, "\n"))
+	cmd := CommandContext(ctx, "nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if _, err := CommandOutput(cmd); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return fmt.Errorf("failed to update published ports: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return fmt.Errorf("failed to update published ports: %w", err)
+	}
+	return nil
+}
+
+// PortForwards is not available through the API
+func (c *APIClient) PortForwards(ctx context.Context) ([]PortForward, error) {
+	return nil, fmt.Errorf("listing published ports: %w", ErrAPIUnsupported)
+}
+
+// ListeningPorts is not available through the API
+func (c *APIClient) ListeningPorts(ctx context.Context) ([]HostPort, error) {
+	return nil, fmt.Errorf("listing listening ports: %w", ErrAPIUnsupported)
+}
+
+// UpdatePortForwards is not available through the API
+func (c *APIClient) UpdatePortForwards(ctx context.Context, remove []HostPort, add []PortForward) error {
+	return fmt.Errorf("publishing ports: %w", ErrAPIUnsupported)
+}
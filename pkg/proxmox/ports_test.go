@@ -0,0 +1,106 @@
+package proxmox
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPortForwardScript(t *testing.T) {
+	script := portForwardScript(
+		[]HostPort{{Port: 8080, Protocol: "tcp"}},
+		[]PortForward{
+			{HostPort: HostPort{Port: 8080, Protocol: "tcp"}, ContainerIP: "10.0.0.6", ContainerPort: 80},
+			{HostPort: HostPort{IP: "192.168.1.10", Port: 53, Protocol: "udp"}, ContainerIP: "10.0.0.7", ContainerPort: 5353},
+		},
+	)
+
+	lines := strings.Split(strings.TrimSpace(script), "\n")
+	if !reflect.DeepEqual(lines[:len(nftSetup)], nftSetup) {
+		t.Errorf("script does not start with the table setup:\n%s", script)
+	}
+	want := []string{
+		"delete element ip pxc ports { tcp . 8080 }",
+		"add element ip pxc ports { tcp . 8080 : 10.0.0.6 . 80 }",
+		"add element ip pxc addr_ports { 192.168.1.10 . udp . 53 : 10.0.0.7 . 5353 }",
+	}
+	if !reflect.DeepEqual(lines[len(nftSetup):], want) {
+		t.Errorf("changes = %q, want %q", lines[len(nftSetup):], want)
+	}
+}
+
+func TestParsePortForwards(t *testing.T) {
+	output := `table ip pxc {
+	map ports {
+		type inet_proto . inet_service : ipv4_addr . inet_service
+		elements = { 6 . 8080 : 10.0.0.5 . 80, 6 . 8081 : 10.0.0.6 . 80,
+			     17 . 53 : 10.0.0.7 . 53 }
+	}
+
+	map addr_ports {
+		type ipv4_addr . inet_proto . inet_service : ipv4_addr . inet_service
+		elements = { 192.168.1.10 . tcp . 443 : 10.0.0.8 . 8443 }
+	}
+
+	chain prerouting {
+		type nat hook prerouting priority dstnat; policy accept;
+		fib daddr type local dnat ip addr . port to meta l4proto . th dport map @ports
+	}
+}
+`
+	forwards, err := parsePortForwards(output)
+	if err != nil {
+		t.Fatalf("parsePortForwards() unexpected error: %v", err)
+	}
+	want := []PortForward{
+		{HostPort: HostPort{Port: 8080, Protocol: "tcp"}, ContainerIP: "10.0.0.5", ContainerPort: 80},
+		{HostPort: HostPort{Port: 8081, Protocol: "tcp"}, ContainerIP: "10.0.0.6", ContainerPort: 80},
+		{HostPort: HostPort{Port: 53, Protocol: "udp"}, ContainerIP: "10.0.0.7", ContainerPort: 53},
+		{HostPort: HostPort{IP: "192.168.1.10", Port: 443, Protocol: "tcp"}, ContainerIP: "10.0.0.8", ContainerPort: 8443},
+	}
+	if !reflect.DeepEqual(forwards, want) {
+		t.Errorf("parsePortForwards() = %v, want %v", forwards, want)
+	}
+
+	if _, err := parsePortForwards("map ports {\nelements = { tcp . http : 10.0.0.5 . 80 }\n}"); err == nil {
+		t.Error("parsePortForwards() accepted a port name")
+	}
+}
+
+func TestParseListeningPorts(t *testing.T) {
+	output := `udp   UNCONN 0      0            0.0.0.0:111        0.0.0.0:*
+tcp   LISTEN 0      4096         0.0.0.0:8006       0.0.0.0:*
+tcp   LISTEN 0      128        127.0.0.1%lo:85      0.0.0.0:*
+tcp   LISTEN 0      128         192.168.1.10:3128   0.0.0.0:*
+tcp   LISTEN 0      4096            [::]:22            [::]:*
+tcp   LISTEN 0      4096           [::1]:25            [::]:*
+`
+	want := []HostPort{
+		{Port: 111, Protocol: "udp"},
+		{Port: 8006, Protocol: "tcp"},
+		{IP: "127.0.0.1", Port: 85, Protocol: "tcp"},
+		{IP: "192.168.1.10", Port: 3128, Protocol: "tcp"},
+		{Port: 22, Protocol: "tcp"},
+	}
+	if got := parseListeningPorts(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseListeningPorts() = %v, want %v", got, want)
+	}
+}
+
+func TestHostPortOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b     HostPort
+		expected bool
+	}{
+		{HostPort{Port: 80, Protocol: "tcp"}, HostPort{Port: 80, Protocol: "tcp"}, true},
+		{HostPort{Port: 80, Protocol: "tcp"}, HostPort{IP: "10.0.0.1", Port: 80, Protocol: "tcp"}, true},
+		{HostPort{IP: "10.0.0.1", Port: 80, Protocol: "tcp"}, HostPort{IP: "10.0.0.2", Port: 80, Protocol: "tcp"}, false},
+		{HostPort{Port: 80, Protocol: "tcp"}, HostPort{Port: 80, Protocol: "udp"}, false},
+		{HostPort{Port: 80, Protocol: "tcp"}, HostPort{Port: 81, Protocol: "tcp"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Overlaps(tt.b); got != tt.expected {
+			t.Errorf("%s.Overlaps(%s) = %v, want %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
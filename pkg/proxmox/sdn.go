@@ -0,0 +1,195 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/brynnjknight/proxer/pkg/output"
+)
+
+// SDNNetwork is a Proxmox SDN vnet in a simple zone, with an optional subnet
+// whose gateway lives on the node and whose addresses are handed out by the
+// zone's DHCP server
+type SDNNetwork struct {
+	Zone      string
+	VNet      string
+	Alias     string // Shown in the Proxmox UI, e.g. myapp/backend
+	Subnet    string // CIDR; empty for a vnet without addresses
+	Gateway   string
+	SNAT      bool // Masquerade traffic leaving the subnet
+	DHCPStart string
+	DHCPEnd   string
+}
+
+// sdnBackend reaches the cluster's SDN configuration, through pvesh on the
+// node or through the HTTP API
+type sdnBackend interface {
+	// sdnIDs returns the value of key in each entry listed at path
+	sdnIDs(ctx context.Context, path, key string) ([]string, error)
+	sdnCreate(ctx context.Context, path string, params url.Values) error
+	sdnApply(ctx context.Context) error
+}
+
+// ensureNetwork creates the zone, vnet and subnet of a network unless the
+// vnet exists, and applies the SDN configuration so the node brings the vnet
+// up. It reports whether the vnet was created. An existing vnet is reused as
+// it is, so its subnet is never changed.
+func ensureNetwork(ctx context.Context, backend sdnBackend, network SDNNetwork) (bool, error) {
+	vnets, err := backend.sdnIDs(ctx, "/cluster/sdn/vnets", "vnet")
+	if err != nil {
+		return false, fmt.Errorf("failed to list SDN vnets: %w", err)
+	}
+	if containsID(vnets, network.VNet) {
+		return false, nil
+	}
+
+	zones, err := backend.sdnIDs(ctx, "/cluster/sdn/zones", "zone")
+	if err != nil {
+		return false, fmt.Errorf("failed to list SDN zones: %w", err)
+	}
+	if !containsID(zones, network.Zone) {
+		zone := url.Values{"zone": {network.Zone}, "type": {"simple"}, "ipam": {"pve"}, "dhcp": {"dnsmasq"}}
+		if err := backend.sdnCreate(ctx, "/cluster/sdn/zones", zone); err != nil {
+			return false, fmt.Errorf("failed to create SDN zone %s: %w", network.Zone, err)
+		}
+	}
+
+	vnet := url.Values{"vnet": {network.VNet}, "zone": {network.Zone}}
+	if network.Alias != "" {
+		vnet.Set("alias", network.Alias)
+	}
+	if err := backend.sdnCreate(ctx, "/cluster/sdn/vnets", vnet); err != nil {
+		return false, fmt.Errorf("failed to create SDN vnet %s: %w", network.VNet, err)
+	}
+
+	if network.Subnet != "" {
+		subnet := url.Values{"subnet": {network.Subnet}, "type": {"subnet"}}
+		if network.Gateway != "" {
+			subnet.Set("gateway", network.Gateway)
+		}
+		if network.SNAT {
+			subnet.Set("snat", "1")
+		}
+		if network.DHCPStart != "" && network.DHCPEnd != "" {
+			subnet.Set("dhcp-range", fmt.Sprintf("start-address=%s,end-address=%s", network.DHCPStart, network.DHCPEnd))
+		}
+		if err := backend.sdnCreate(ctx, "/cluster/sdn/vnets/"+url.PathEscape(network.VNet)+"/subnets", subnet); err != nil {
+			return false, fmt.Errorf("failed to create subnet %s of SDN vnet %s: %w", network.Subnet, network.VNet, err)
+		}
+	}
+
+	if err := backend.sdnApply(ctx); err != nil {
+		return false, fmt.Errorf("failed to apply SDN configuration: %w", err)
+	}
+	return true, nil
+}
+
+// containsID reports whether ids contains id
+func containsID(ids []string, id string) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureNetwork creates an SDN network with pvesh unless its vnet exists,
+// reporting whether it was created
+func (c *Client) EnsureNetwork(ctx context.Context, network SDNNetwork) (bool, error) {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would create SDN vnet %s in zone %s", network.VNet, network.Zone)
+		return false, nil
+	}
+	return ensureNetwork(ctx, c, network)
+}
+
+// sdnIDs lists path with pvesh
+func (c *Client) sdnIDs(ctx context.Context, path, key string) ([]string, error) {
+	output, err := CommandOutput(CommandContext(ctx, "pvesh", "get", path, "--output-format", "json"))
+	if err != nil {
+		return nil, err
+	}
+	return parseSDNIDs(output, key)
+}
+
+// sdnCreate creates an SDN object with pvesh create
+func (c *Client) sdnCreate(ctx context.Context, path string, params url.Values) error {
+	return c.runPvesh(ctx, append([]string{"create", path}, pveshArgs(params)...)...)
+}
+
+// sdnApply applies pending SDN changes to every node
+func (c *Client) sdnApply(ctx context.Context) error {
+	return c.runPvesh(ctx, "set", "/cluster/sdn")
+}
+
+// runPvesh executes a pvesh command
+func (c *Client) runPvesh(ctx context.Context, args ...string) error {
+	c.log.Logf(output.Debug, "Executing: pvesh %s", strings.Join(args, " "))
+	return RunCommand(CommandContext(ctx, "pvesh", args...))
+}
+
+// pveshArgs turns parameters into pvesh options, sorted by name
+func pveshArgs(params url.Values) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		args = append(args, "--"+name, params.Get(name))
+	}
+	return args
+}
+
+// parseSDNIDs extracts key from each entry of a JSON SDN listing
+func parseSDNIDs(data []byte, key string) ([]string, error) {
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse SDN listing: %w", err)
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if id, ok := entry[key].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// EnsureNetwork creates an SDN network through the API unless its vnet
+// exists, reporting whether it was created
+func (c *APIClient) EnsureNetwork(ctx context.Context, network SDNNetwork) (bool, error) {
+	if c.dryRun {
+		c.log.Logf(output.Debug, "DRY RUN: Would create SDN vnet %s in zone %s via the API", network.VNet, network.Zone)
+		return false, nil
+	}
+	return ensureNetwork(ctx, c, network)
+}
+
+// sdnIDs lists path through the API
+func (c *APIClient) sdnIDs(ctx context.Context, path, key string) ([]string, error) {
+	var entries json.RawMessage
+	if err := c.request(ctx, http.MethodGet, path, nil, &entries); err != nil {
+		return nil, err
+	}
+	return parseSDNIDs(entries, key)
+}
+
+// sdnCreate creates an SDN object through the API
+func (c *APIClient) sdnCreate(ctx context.Context, path string, params url.Values) error {
+	return c.request(ctx, http.MethodPost, path, params, nil)
+}
+
+// sdnApply applies pending SDN changes to every node, waiting for the
+// reload task
+func (c *APIClient) sdnApply(ctx context.Context) error {
+	return c.task(ctx, http.MethodPut, "/cluster/sdn", nil)
+}
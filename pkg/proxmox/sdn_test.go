@@ -0,0 +1,155 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeSDN records SDN changes instead of running pvesh
+type fakeSDN struct {
+	ids     map[string][]string // IDs listed at each path
+	calls   []string
+	fail    error
+	created map[string]url.Values
+}
+
+func newFakeSDN() *fakeSDN {
+	return &fakeSDN{ids: make(map[string][]string), created: make(map[string]url.Values)}
+}
+
+func (f *fakeSDN) sdnIDs(ctx context.Context, path, key string) ([]string, error) {
+	return f.ids[path], nil
+}
+
+func (f *fakeSDN) sdnCreate(ctx context.Context, path string, params url.Values) error {
+	f.calls = append(f.calls, "create "+path)
+	f.created[path] = params
+	return f.fail
+}
+
+func (f *fakeSDN) sdnApply(ctx context.Context) error {
+	f.calls = append(f.calls, "apply")
+	return nil
+}
+
+func TestEnsureNetwork(t *testing.T) {
+	network := SDNNetwork{
+		Zone: "pxc", VNet: "back", Alias: "myapp backend", Subnet: "172.21.0.0/24",
+		Gateway: "172.21.0.1", SNAT: true, DHCPStart: "172.21.0.2", DHCPEnd: "172.21.0.254",
+	}
+
+	t.Run("new zone and vnet", func(t *testing.T) {
+		sdn := newFakeSDN()
+		created, err := ensureNetwork(context.Background(), sdn, network)
+		if err != nil || !created {
+			t.Fatalf("ensureNetwork() = %v, %v, want created", created, err)
+		}
+		want := []string{"create /cluster/sdn/zones", "create /cluster/sdn/vnets", "create /cluster/sdn/vnets/back/subnets", "apply"}
+		if !reflect.DeepEqual(sdn.calls, want) {
+			t.Errorf("calls = %v, want %v", sdn.calls, want)
+		}
+		subnet := sdn.created["/cluster/sdn/vnets/back/subnets"]
+		wantSubnet := url.Values{
+			"subnet":     {"172.21.0.0/24"},
+			"type":       {"subnet"},
+			"gateway":    {"172.21.0.1"},
+			"snat":       {"1"},
+			"dhcp-range": {"start-address=172.21.0.2,end-address=172.21.0.254"},
+		}
+		if !reflect.DeepEqual(subnet, wantSubnet) {
+			t.Errorf("subnet parameters = %v, want %v", subnet, wantSubnet)
+		}
+	})
+
+	t.Run("existing zone", func(t *testing.T) {
+		sdn := newFakeSDN()
+		sdn.ids["/cluster/sdn/zones"] = []string{"pxc"}
+		internal := network
+		internal.SNAT = false
+		if _, err := ensureNetwork(context.Background(), sdn, internal); err != nil {
+			t.Fatalf("ensureNetwork() unexpected error: %v", err)
+		}
+		if sdn.calls[0] != "create /cluster/sdn/vnets" {
+			t.Errorf("calls = %v, want the zone reused", sdn.calls)
+		}
+		if snat := sdn.created["/cluster/sdn/vnets/back/subnets"].Get("snat"); snat != "" {
+			t.Errorf("snat = %q, want none for an internal network", snat)
+		}
+	})
+
+	t.Run("existing vnet", func(t *testing.T) {
+		sdn := newFakeSDN()
+		sdn.ids["/cluster/sdn/vnets"] = []string{"front", "back"}
+		created, err := ensureNetwork(context.Background(), sdn, network)
+		if err != nil || created {
+			t.Errorf("ensureNetwork() = %v, %v, want the vnet reused", created, err)
+		}
+		if len(sdn.calls) != 0 {
+			t.Errorf("calls = %v, want none", sdn.calls)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		sdn := newFakeSDN()
+		sdn.fail = errors.New("permission denied")
+		_, err := ensureNetwork(context.Background(), sdn, network)
+		if err == nil || !strings.Contains(err.Error(), "failed to create SDN zone pxc") {
+			t.Errorf("ensureNetwork() error = %v, want the zone failure", err)
+		}
+	})
+}
+
+func TestPveshArgs(t *testing.T) {
+	got := pveshArgs(url.Values{"zone": {"pxc"}, "vnet": {"back"}, "alias": {"myapp backend"}})
+	want := []string{"--alias", "myapp backend", "--vnet", "back", "--zone", "pxc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pveshArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestParseInterfaceAddresses(t *testing.T) {
+	output := `1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+2: eth0    inet 172.20.0.17/24 brd 172.20.0.255 scope global dynamic eth0\       valid_lft 3500sec preferred_lft 3500sec
+3: eth1@if12    inet 172.21.0.9/24 brd 172.21.0.255 scope global eth1\       valid_lft forever preferred_lft forever
+3: eth1@if12    inet 172.21.0.200/24 scope global secondary eth1\       valid_lft forever preferred_lft forever
+`
+	want := map[string]string{"eth0": "172.20.0.17", "eth1": "172.21.0.9"}
+	if got := parseInterfaceAddresses(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseInterfaceAddresses() = %v, want %v", got, want)
+	}
+}
+
+func TestAPIClientEnsureNetwork(t *testing.T) {
+	fake, client := newFakeAPI(t)
+	fake.responses["GET /cluster/sdn/vnets"] = []map[string]string{{"vnet": "front", "zone": "pxc"}}
+	fake.responses["GET /cluster/sdn/zones"] = []map[string]string{{"zone": "pxc", "type": "simple"}}
+	fake.responses["POST /cluster/sdn/vnets"] = nil
+	fake.task("PUT /cluster/sdn", "UPID:pve:4:reloadnetworkall", "OK")
+
+	created, err := client.EnsureNetwork(context.Background(), SDNNetwork{Zone: "pxc", VNet: "back"})
+	if err != nil || !created {
+		t.Fatalf("EnsureNetwork() = %v, %v, want created", created, err)
+	}
+	want := []string{
+		"GET /cluster/sdn/vnets",
+		"GET /cluster/sdn/zones",
+		"POST /cluster/sdn/vnets",
+		"PUT /cluster/sdn",
+		"GET /nodes/pve/tasks/UPID:pve:4:reloadnetworkall/status",
+	}
+	if !reflect.DeepEqual(fake.requests, want) {
+		t.Errorf("requests = %v, want %v", fake.requests, want)
+	}
+	if got := fake.params["POST /cluster/sdn/vnets"]; got["vnet"] != "back" || got["zone"] != "pxc" {
+		t.Errorf("vnet parameters = %v", got)
+	}
+
+	fake.requests = nil
+	if created, err := client.EnsureNetwork(context.Background(), SDNNetwork{Zone: "pxc", VNet: "front"}); err != nil || created {
+		t.Errorf("EnsureNetwork() = %v, %v, want the existing vnet reused", created, err)
+	}
+}
@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// httpStore keeps objects on a server that answers GET and PUT on
+// BASE/KEY, such as a WebDAV share or nginx with dav_methods PUT
+type httpStore struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+func (s *httpStore) httpClient() *http.Client {
+	if s.client != nil {
+		return s.client
+	}
+	return http.DefaultClient
+}
+
+func (s *httpStore) Put(key string, r io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, s.base+"/"+key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	return s.do(req, key, nil)
+}
+
+func (s *httpStore) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.base+"/"+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	var body io.ReadCloser
+	if err := s.do(req, key, &body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// do sends req and checks its status; with body set the response body is
+// handed over instead of closed
+func (s *httpStore) do(req *http.Request, key string, body *io.ReadCloser) error {
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	return doRequest(s.httpClient(), req, key, body)
+}
+
+// doRequest sends req and maps its status to an error: 404 to ErrNotFound,
+// anything but 2xx to the status and the start of the response body
+func doRequest(client *http.Client, req *http.Request, key string, body *io.ReadCloser) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return fmt.Errorf("%s %s: %s: %s", req.Method, key, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if body != nil {
+		*body = resp.Body
+		return nil
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Store keeps objects in an S3 bucket, addressed path-style so that
+// S3-compatible servers such as MinIO work too
+type s3Store struct {
+	endpoint  string
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3Store returns a store for objects under prefix in bucket. The
+// credentials and region come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_REGION (default us-east-1); AWS_ENDPOINT_URL points it at an
+// S3-compatible server instead of AWS.
+func NewS3Store(bucket, prefix string) (Store, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid registry: use s3://bucket/prefix")
+	}
+	store := &s3Store{
+		endpoint:  strings.TrimSuffix(os.Getenv("AWS_ENDPOINT_URL"), "/"),
+		region:    os.Getenv("AWS_REGION"),
+		bucket:    bucket,
+		prefix:    prefix,
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		client:    http.DefaultClient,
+		now:       time.Now,
+	}
+	if store.accessKey == "" || store.secretKey == "" {
+		return nil, fmt.Errorf("s3 registry needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if store.region == "" {
+		store.region = "us-east-1"
+	}
+	if store.endpoint == "" {
+		store.endpoint = "https://s3." + store.region + ".amazonaws.com"
+	}
+	return store, nil
+}
+
+func (s *s3Store) objectURL(key string) string {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	return s.endpoint + "/" + s.bucket + "/" + key
+}
+
+func (s *s3Store) Put(key string, r io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	s.sign(req)
+	return doRequest(s.client, req, key, nil)
+}
+
+func (s *s3Store) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req)
+	var body io.ReadCloser
+	if err := doRequest(s.client, req, key, &body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req. The
+// payload is not signed, so archives are streamed without hashing them
+// twice; the manifest digest protects their content.
+func (s *s3Store) sign(req *http.Request) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	const payload = "UNSIGNED-PAYLOAD"
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payload)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.EscapedPath()),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payload + "\nx-amz-date:" + amzDate + "\n",
+		"host;x-amz-content-sha256;x-amz-date",
+		payload,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s",
+		s.accessKey, scope, signature))
+}
+
+// escapePath escapes a URL path the way SigV4 expects: every byte but
+// unreserved characters and slashes percent-encoded
+func escapePath(escaped string) string {
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		return escaped
+	}
+	var b strings.Builder
+	for _, c := range []byte(unescaped) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
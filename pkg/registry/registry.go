@@ -0,0 +1,199 @@
+// Package registry pushes built templates to a remote store and pulls them
+// by name:tag. A pushed template is a vzdump archive of the template
+// container plus a JSON manifest describing it:
+//
+//	NAME/manifests/TAG.json
+//	NAME/blobs/sha256-DIGEST.tar.zst
+//
+// The manifest is written after the archive, so a pull never sees a tag
+// whose archive is missing.
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultTag is the tag of a reference that does not name one
+const DefaultTag = "latest"
+
+// ErrNotFound is returned by a store for a key it does not hold
+var ErrNotFound = errors.New("not found")
+
+var (
+	namePattern = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*$`)
+	tagPattern  = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// Manifest describes a pushed template
+type Manifest struct {
+	Name    string            `json:"name"`
+	Tag     string            `json:"tag"`
+	Digest  string            `json:"digest"`  // sha256:HEX of the archive
+	Size    int64             `json:"size"`    // Archive size in bytes
+	Archive string            `json:"archive"` // Key of the archive in the store
+	OSType  string            `json:"ostype,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Created time.Time         `json:"created"`
+}
+
+// ParseReference splits a NAME[:TAG] reference, defaulting the tag to
+// latest. Names are lowercase and may have /-separated components, like
+// team/app.
+func ParseReference(ref string) (name, tag string, err error) {
+	name, tag = ref, DefaultTag
+	if i := strings.LastIndex(ref, ":"); i >= 0 {
+		name, tag = ref[:i], ref[i+1:]
+	}
+	if !namePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid template name '%s': use lowercase letters, digits and . _ - separators", name)
+	}
+	if !tagPattern.MatchString(tag) {
+		return "", "", fmt.Errorf("invalid tag '%s'", tag)
+	}
+	return name, tag, nil
+}
+
+// Store holds the archives and manifests of a registry
+type Store interface {
+	// Put writes size bytes from r under key, replacing what is there
+	Put(key string, r io.Reader, size int64) error
+
+	// Get opens the object under key; it returns an error wrapping
+	// ErrNotFound if there is none
+	Get(key string) (io.ReadCloser, error)
+}
+
+// Registry pushes and pulls templates to and from a store
+type Registry struct {
+	store Store
+}
+
+// New returns a registry backed by store
+func New(store Store) *Registry {
+	return &Registry{store: store}
+}
+
+func manifestKey(name, tag string) string {
+	return path.Join(name, "manifests", tag+".json")
+}
+
+// Push uploads an archive and then the manifest that tags it. The name,
+// tag, ostype and labels are taken from manifest; the digest, size and
+// archive key are filled in.
+func (r *Registry) Push(archivePath string, manifest Manifest) (*Manifest, error) {
+	digest, size, err := fileDigest(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Digest = "sha256:" + digest
+	manifest.Size = size
+	manifest.Archive = path.Join(manifest.Name, "blobs", "sha256-"+digest+archiveExtension(archivePath))
+	if manifest.Created.IsZero() {
+		manifest.Created = time.Now().UTC()
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer archive.Close()
+	if err := r.store.Put(manifest.Archive, archive, size); err != nil {
+		return nil, fmt.Errorf("failed to upload archive: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.Put(manifestKey(manifest.Name, manifest.Tag), strings.NewReader(string(data)), int64(len(data))); err != nil {
+		return nil, fmt.Errorf("failed to upload manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Manifest fetches the manifest of name:tag
+func (r *Registry) Manifest(name, tag string) (*Manifest, error) {
+	body, err := r.store.Get(manifestKey(name, tag))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("template %s:%s is not in the registry", name, tag)
+		}
+		return nil, fmt.Errorf("failed to fetch manifest of %s:%s: %w", name, tag, err)
+	}
+	defer body.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest for %s:%s: %w", name, tag, err)
+	}
+	if manifest.Archive == "" || !strings.HasPrefix(manifest.Digest, "sha256:") {
+		return nil, fmt.Errorf("invalid manifest for %s:%s: archive or digest missing", name, tag)
+	}
+	return &manifest, nil
+}
+
+// Download writes the archive of a manifest to dest and checks it against
+// the manifest's digest; a corrupt download is removed
+func (r *Registry) Download(manifest *Manifest, dest string) error {
+	body, err := r.store.Get(manifest.Archive)
+	if err != nil {
+		return fmt.Errorf("failed to fetch archive %s: %w", manifest.Archive, err)
+	}
+	defer body.Close()
+
+	file, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if digest := "sha256:" + hex.EncodeToString(hash.Sum(nil)); digest != manifest.Digest {
+			err = fmt.Errorf("archive digest %s does not match manifest digest %s", digest, manifest.Digest)
+		}
+	}
+	if err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	return nil
+}
+
+// fileDigest returns the hex SHA-256 and size of a file
+func fileDigest(filename string) (string, int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// archiveExtension returns the extension of a vzdump archive, including the
+// compression suffix, e.g. .tar.zst
+func archiveExtension(filename string) string {
+	base := path.Base(filename)
+	if i := strings.Index(base, ".tar"); i >= 0 {
+		return base[i:]
+	}
+	return path.Ext(base)
+}
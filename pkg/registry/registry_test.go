@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref      string
+		wantName string
+		wantTag  string
+		wantErr  bool
+	}{
+		{ref: "myapp", wantName: "myapp", wantTag: "latest"},
+		{ref: "myapp:1.2", wantName: "myapp", wantTag: "1.2"},
+		{ref: "team/web-app:v2_rc1", wantName: "team/web-app", wantTag: "v2_rc1"},
+		{ref: "MyApp:1", wantErr: true},
+		{ref: "myapp:", wantErr: true},
+		{ref: "../etc:1", wantErr: true},
+		{ref: "myapp:1/2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			name, tag, err := ParseReference(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.wantName || tag != tt.wantTag {
+				t.Errorf("ParseReference() = %q, %q, want %q, %q", name, tag, tt.wantName, tt.wantTag)
+			}
+		})
+	}
+}
+
+func TestPushPull(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "vzdump-lxc-9001-2024_01_02-03_04_05.tar.zst")
+	if err := os.WriteFile(archive, []byte("template archive"), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+
+	root := t.TempDir()
+	reg := New(&dirStore{root: root})
+	pushed, err := reg.Push(archive, Manifest{Name: "team/app", Tag: "1.2", OSType: "debian", Labels: map[string]string{"version": "1.2"}})
+	if err != nil {
+		t.Fatalf("Push() unexpected error: %v", err)
+	}
+	sum := sha256.Sum256([]byte("template archive"))
+	if pushed.Digest != "sha256:"+hex.EncodeToString(sum[:]) || pushed.Size != 16 {
+		t.Errorf("pushed digest = %q, size = %d", pushed.Digest, pushed.Size)
+	}
+	if want := "team/app/blobs/sha256-" + strings.TrimPrefix(pushed.Digest, "sha256:") + ".tar.zst"; pushed.Archive != want {
+		t.Errorf("archive key = %q, want %q", pushed.Archive, want)
+	}
+	if _, err := os.Stat(filepath.Join(root, "team", "app", "manifests", "1.2.json")); err != nil {
+		t.Errorf("manifest not written: %v", err)
+	}
+
+	manifest, err := reg.Manifest("team/app", "1.2")
+	if err != nil {
+		t.Fatalf("Manifest() unexpected error: %v", err)
+	}
+	if manifest.Digest != pushed.Digest || manifest.OSType != "debian" || manifest.Labels["version"] != "1.2" {
+		t.Errorf("Manifest() = %+v, want %+v", manifest, pushed)
+	}
+
+	dest := filepath.Join(t.TempDir(), "pulled.tar.zst")
+	if err := reg.Download(manifest, dest); err != nil {
+		t.Fatalf("Download() unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "template archive" {
+		t.Errorf("downloaded %q", data)
+	}
+
+	t.Run("corrupt archive", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(manifest.Archive)), []byte("tampered"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(t.TempDir(), "pulled.tar.zst")
+		if err := reg.Download(manifest, dest); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Errorf("Download() error = %v, want a digest mismatch", err)
+		}
+		if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("corrupt download was kept")
+		}
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		if _, err := reg.Manifest("team/app", "9.9"); err == nil || !strings.Contains(err.Error(), "is not in the registry") {
+			t.Errorf("Manifest() error = %v, want not in the registry", err)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// Schemes lists the URL schemes of registry locations
+var Schemes = []string{"file", "ssh", "http", "https", "s3"}
+
+// CheckLocation checks that a registry location is a path or a URL with
+// one of Schemes, without connecting to it
+func CheckLocation(location string) error {
+	if !strings.Contains(location, "://") {
+		return nil
+	}
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return fmt.Errorf("invalid registry '%s': %w", location, err)
+	}
+	for _, scheme := range Schemes {
+		if parsed.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported registry scheme '%s' (supported: %s)", parsed.Scheme, strings.Join(Schemes, ", "))
+}
+
+// Open returns the store at a registry location:
+//   - a path or file:///path: a directory, e.g. on storage shared by the
+//     nodes such as /mnt/pve/nfs/pxc-registry
+//   - ssh://[user@]host/path: a directory on another node, reached with ssh
+//   - http://host/path or https://...: a server answering GET and PUT, with
+//     PXC_REGISTRY_TOKEN sent as a bearer token if set
+//   - s3://bucket/prefix: an S3 bucket, see NewS3Store
+func Open(location string) (Store, error) {
+	if location == "" {
+		return nil, fmt.Errorf("no registry configured: set registry in the config file or pass --registry")
+	}
+	if !strings.Contains(location, "://") {
+		return &dirStore{root: location}, nil
+	}
+
+	if err := CheckLocation(location); err != nil {
+		return nil, err
+	}
+	parsed, _ := url.Parse(location)
+	switch parsed.Scheme {
+	case "file":
+		return &dirStore{root: parsed.Path}, nil
+	case "ssh":
+		if parsed.Host == "" || parsed.Path == "" {
+			return nil, fmt.Errorf("invalid registry '%s': use ssh://[user@]host/path", location)
+		}
+		host := parsed.Host
+		if parsed.User != nil {
+			host = parsed.User.Username() + "@" + host
+		}
+		return &sshStore{host: host, root: parsed.Path, run: runSSH, open: openSSH}, nil
+	case "http", "https":
+		return &httpStore{base: strings.TrimSuffix(location, "/"), token: os.Getenv("PXC_REGISTRY_TOKEN")}, nil
+	default:
+		return NewS3Store(parsed.Host, strings.Trim(parsed.Path, "/"))
+	}
+}
+
+// dirStore keeps objects as files under a directory
+type dirStore struct {
+	root string
+}
+
+// Put writes to a temporary file first, so readers never see a partial
+// object
+func (s *dirStore) Put(key string, r io.Reader, size int64) error {
+	target := filepath.Join(s.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(temp, r)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), target)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+func (s *dirStore) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(s.root, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return file, err
+}
+
+// sshStore keeps objects as files under a directory on another host
+type sshStore struct {
+	host string
+	root string
+
+	// run runs a shell command on host with stdin
+	run func(host, command string, stdin io.Reader) error
+
+	// open runs a shell command on host and streams its stdout
+	open func(host, command string) (io.ReadCloser, error)
+}
+
+func (s *sshStore) Put(key string, r io.Reader, size int64) error {
+	target := path.Join(s.root, key)
+	temp := path.Join(path.Dir(target), ".upload-"+path.Base(target))
+	command := fmt.Sprintf("mkdir -p %s && cat > %s && mv %s %s",
+		shellQuote(path.Dir(target)), shellQuote(temp), shellQuote(temp), shellQuote(target))
+	return s.run(s.host, command, r)
+}
+
+// Get checks that the object exists before streaming it, as a failed cat
+// only shows once the stream is read
+func (s *sshStore) Get(key string) (io.ReadCloser, error) {
+	target := path.Join(s.root, key)
+	if err := s.run(s.host, "test -f "+shellQuote(target), nil); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	return s.open(s.host, "cat "+shellQuote(target))
+}
+
+// runSSH runs command on host with ssh in batch mode
+func runSSH(host, command string, stdin io.Reader) error {
+	cmd := exec.Command("ssh", "-o", "BatchMode=yes", host, command)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := proxmox.RunCommand(cmd); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("ssh %s: %w: %s", host, err, message)
+		}
+		return fmt.Errorf("ssh %s: %w", host, err)
+	}
+	return nil
+}
+
+// openSSH starts command on host with ssh and returns its stdout; closing
+// it waits for the command and reports its failure
+func openSSH(host, command string) (io.ReadCloser, error) {
+	cmd := exec.Command("ssh", "-o", "BatchMode=yes", host, command)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ssh %s: %w", host, err)
+	}
+	return &commandReader{ReadCloser: stdout, wait: func() error {
+		err := cmd.Wait()
+		proxmox.AuditCommand(cmd, start, err)
+		if err != nil {
+			return fmt.Errorf("ssh %s: %w: %s", host, err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}}, nil
+}
+
+// commandReader is the stdout of a running command
+type commandReader struct {
+	io.ReadCloser
+	wait func() error
+}
+
+func (r *commandReader) Close() error {
+	r.ReadCloser.Close()
+	return r.wait()
+}
+
+// shellQuote quotes a value for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_REGION", "")
+
+	tests := []struct {
+		location string
+		want     string
+		wantErr  string
+	}{
+		{location: "/mnt/pve/shared/pxc", want: "*registry.dirStore"},
+		{location: "file:///srv/pxc", want: "*registry.dirStore"},
+		{location: "ssh://root@pve2/var/lib/pxc", want: "*registry.sshStore"},
+		{location: "https://registry.example.com/pxc/", want: "*registry.httpStore"},
+		{location: "s3://templates/pxc", want: "*registry.s3Store"},
+		{location: "", wantErr: "no registry configured"},
+		{location: "ssh://pve2", wantErr: "use ssh://"},
+		{location: "ftp://host/pxc", wantErr: "unsupported registry scheme 'ftp'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			store, err := Open(tt.location)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Open() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open() unexpected error: %v", err)
+			}
+			if got := fmt.Sprintf("%T", store); got != tt.want {
+				t.Errorf("Open() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	s3, _ := Open("s3://templates/pxc")
+	if got := s3.(*s3Store).objectURL("app/manifests/1.json"); got != "https://s3.us-east-1.amazonaws.com/templates/pxc/app/manifests/1.json" {
+		t.Errorf("objectURL() = %s", got)
+	}
+}
+
+func TestSSHStore(t *testing.T) {
+	var commands []string
+	var uploaded bytes.Buffer
+	store := &sshStore{
+		host: "root@pve2",
+		root: "/var/lib/pxc",
+		run: func(host, command string, stdin io.Reader) error {
+			commands = append(commands, host+" "+command)
+			if stdin != nil {
+				io.Copy(&uploaded, stdin)
+			}
+			if strings.Contains(command, "missing") {
+				return exec.Command("sh", "-c", "exit 1").Run()
+			}
+			return nil
+		},
+		open: func(host, command string) (io.ReadCloser, error) {
+			commands = append(commands, host+" "+command)
+			return io.NopCloser(strings.NewReader("data")), nil
+		},
+	}
+
+	if err := store.Put("app/manifests/1.json", strings.NewReader("{}"), 2); err != nil {
+		t.Fatalf("Put() unexpected error: %v", err)
+	}
+	body, err := store.Get("app/manifests/1.json")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	body.Close()
+	if _, err := store.Get("missing.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing key error = %v, want ErrNotFound", err)
+	}
+
+	want := []string{
+		"root@pve2 mkdir -p '/var/lib/pxc/app/manifests' && cat > '/var/lib/pxc/app/manifests/.upload-1.json' && mv '/var/lib/pxc/app/manifests/.upload-1.json' '/var/lib/pxc/app/manifests/1.json'",
+		"root@pve2 test -f '/var/lib/pxc/app/manifests/1.json'",
+		"root@pve2 cat '/var/lib/pxc/app/manifests/1.json'",
+		"root@pve2 test -f '/var/lib/pxc/missing.json'",
+	}
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands =\n%s\nwant\n%s", strings.Join(commands, "\n"), strings.Join(want, "\n"))
+	}
+	if uploaded.String() != "{}" {
+		t.Errorf("uploaded %q", uploaded.String())
+	}
+}
+
+// objectServer is an HTTP server keeping PUT bodies in memory
+func objectServer(t *testing.T, check func(r *http.Request)) *httptest.Server {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPStore(t *testing.T) {
+	server := objectServer(t, func(r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			t.Errorf("%s %s without the bearer token", r.Method, r.URL.Path)
+		}
+	})
+	store := &httpStore{base: server.URL + "/pxc", token: "s3cret"}
+	checkStore(t, store)
+}
+
+func TestS3Store(t *testing.T) {
+	server := objectServer(t, func(r *http.Request) {
+		want := "AWS4-HMAC-SHA256 Credential=AKID/20240102/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+		if !strings.HasPrefix(r.Header.Get("Authorization"), want) || r.Header.Get("x-amz-date") != "20240102T030405Z" {
+			t.Errorf("%s %s signed as %q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		}
+	})
+	store := &s3Store{
+		endpoint:  server.URL,
+		region:    "eu-west-1",
+		bucket:    "templates",
+		prefix:    "pxc",
+		accessKey: "AKID",
+		secretKey: "secret",
+		client:    server.Client(),
+		now:       func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	checkStore(t, store)
+}
+
+// checkStore puts an object, reads it back and checks a missing key
+func checkStore(t *testing.T, store Store) {
+	t.Helper()
+	if err := store.Put("app/manifests/1.json", strings.NewReader(`{"name":"app"}`), 14); err != nil {
+		t.Fatalf("Put() unexpected error: %v", err)
+	}
+	body, err := store.Get("app/manifests/1.json")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != `{"name":"app"}` {
+		t.Errorf("Get() = %q", data)
+	}
+	if _, err := store.Get("app/manifests/2.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing key error = %v, want ErrNotFound", err)
+	}
+}
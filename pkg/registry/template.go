@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// Templates exports template containers to vzdump archives and restores
+// pulled archives as templates on the local node
+type Templates struct {
+	storage string
+	verbose bool
+	out     io.Writer
+
+	// run executes a command such as vzdump or pct restore
+	run func(name string, args ...string) error
+
+	// output executes a command and returns its stdout
+	output func(name string, args ...string) ([]byte, error)
+}
+
+// NewTemplates returns Templates restoring to storage, logging executed
+// commands to out when verbose
+func NewTemplates(storage string, verbose bool, out io.Writer) *Templates {
+	t := &Templates{storage: storage, verbose: verbose, out: out}
+	t.run = t.runCommand
+	t.output = func(name string, args ...string) ([]byte, error) {
+		return proxmox.CommandOutput(exec.Command(name, args...))
+	}
+	return t
+}
+
+// Export writes a zstd-compressed vzdump archive of template container
+// vmid to dir. It returns the archive's path and a manifest carrying the
+// template's ostype and labels.
+func (t *Templates) Export(vmid int, dir string) (string, Manifest, error) {
+	var manifest Manifest
+	output, err := t.output("pct", "config", strconv.Itoa(vmid))
+	if err != nil {
+		return "", manifest, fmt.Errorf("failed to read container %d: %w", vmid, err)
+	}
+	config := parseConfig(string(output))
+	if config.values["template"] != "1" {
+		return "", manifest, fmt.Errorf("container %d is not a template; push the template a pxc build created", vmid)
+	}
+	manifest.OSType = config.values["ostype"]
+	manifest.Labels = config.labels
+
+	if err := t.run("vzdump", strconv.Itoa(vmid), "--mode", "stop", "--compress", "zstd", "--dumpdir", dir); err != nil {
+		return "", manifest, fmt.Errorf("failed to export template %d: %w", vmid, err)
+	}
+	archives, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("vzdump-lxc-%d-*.tar.zst", vmid)))
+	if len(archives) == 0 {
+		return "", manifest, fmt.Errorf("vzdump wrote no archive of template %d to %s", vmid, dir)
+	}
+	sort.Strings(archives)
+	return archives[len(archives)-1], manifest, nil
+}
+
+// Import restores an archive as template vmid, or the next free ID if vmid
+// is 0, and returns the ID
+func (t *Templates) Import(archive string, vmid int) (int, error) {
+	if vmid == 0 {
+		output, err := t.output("pvesh", "get", "/cluster/nextid")
+		if err != nil {
+			return 0, fmt.Errorf("failed to allocate a container ID: %w", err)
+		}
+		if vmid, err = strconv.Atoi(strings.TrimSpace(string(output))); err != nil {
+			return 0, fmt.Errorf("failed to allocate a container ID: unexpected output %q", output)
+		}
+	}
+
+	id := strconv.Itoa(vmid)
+	if err := t.run("pct", "restore", id, archive, "--storage", t.storage); err != nil {
+		return 0, fmt.Errorf("failed to restore template %d: %w", vmid, err)
+	}
+
+	// vzdump keeps the template flag, but an archive of a plain container
+	// still has to be converted
+	output, err := t.output("pct", "config", id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read container %d: %w", vmid, err)
+	}
+	if parseConfig(string(output)).values["template"] != "1" {
+		if err := t.run("pct", "template", id); err != nil {
+			return 0, fmt.Errorf("failed to convert container %d to a template: %w", vmid, err)
+		}
+	}
+	return vmid, nil
+}
+
+// containerConfig is the output of pct config: its key: value settings
+// and the labels pxc build writes into the description
+type containerConfig struct {
+	values map[string]string
+	labels map[string]string
+}
+
+// parseConfig parses pct config output. The description comes first, as
+// URL-encoded # comment lines; KEY=VALUE lines in it are labels.
+func parseConfig(output string) containerConfig {
+	config := containerConfig{values: make(map[string]string)}
+	for _, line := range strings.Split(output, "\n") {
+		if comment, found := strings.CutPrefix(line, "#"); found {
+			if decoded, err := url.PathUnescape(comment); err == nil {
+				comment = decoded
+			}
+			if key, value, found := strings.Cut(comment, "="); found && key != "" {
+				if config.labels == nil {
+					config.labels = make(map[string]string)
+				}
+				config.labels[key] = value
+			}
+			continue
+		}
+		if key, value, found := strings.Cut(line, ": "); found {
+			config.values[key] = strings.TrimSpace(value)
+		}
+	}
+	return config
+}
+
+func (t *Templates) runCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if t.verbose {
+		fmt.Fprintf(t.out, "Executing: %s %s\n", name, strings.Join(args, " "))
+		cmd.Stdout, cmd.Stderr = t.out, t.out
+	}
+	return proxmox.RunCommand(cmd)
+}
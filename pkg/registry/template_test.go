@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTemplates returns Templates whose commands are recorded, with pct
+// config answering config and vzdump writing an archive to its dumpdir
+func fakeTemplates(config string) (*Templates, *[]string) {
+	var calls []string
+	t := NewTemplates("local-zfs", false, &bytes.Buffer{})
+	t.run = func(name string, args ...string) error {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		if name == "vzdump" {
+			dir := args[len(args)-1]
+			return os.WriteFile(filepath.Join(dir, fmt.Sprintf("vzdump-lxc-%s-2024_01_02-03_04_05.tar.zst", args[0])), []byte("archive"), 0644)
+		}
+		return nil
+	}
+	t.output = func(name string, args ...string) ([]byte, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		if name == "pvesh" {
+			return []byte("9005\n"), nil
+		}
+		return []byte(config), nil
+	}
+	return t, &calls
+}
+
+func TestTemplatesExport(t *testing.T) {
+	config := "#maintainer=team%40example.com\n#version=1.2\narch: amd64\nostype: debian\ntemplate: 1\n"
+	templates, calls := fakeTemplates(config)
+	dir := t.TempDir()
+
+	archive, manifest, err := templates.Export(9001, dir)
+	if err != nil {
+		t.Fatalf("Export() unexpected error: %v", err)
+	}
+	if want := filepath.Join(dir, "vzdump-lxc-9001-2024_01_02-03_04_05.tar.zst"); archive != want {
+		t.Errorf("archive = %s, want %s", archive, want)
+	}
+	if manifest.OSType != "debian" || manifest.Labels["maintainer"] != "team@example.com" || manifest.Labels["version"] != "1.2" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if want := "vzdump 9001 --mode stop --compress zstd --dumpdir " + dir; (*calls)[1] != want {
+		t.Errorf("calls = %v, want %s", *calls, want)
+	}
+
+	t.Run("not a template", func(t *testing.T) {
+		templates, _ := fakeTemplates("ostype: debian\n")
+		if _, _, err := templates.Export(101, t.TempDir()); err == nil || !strings.Contains(err.Error(), "is not a template") {
+			t.Errorf("Export() error = %v, want not a template", err)
+		}
+	})
+}
+
+func TestTemplatesImport(t *testing.T) {
+	tests := []struct {
+		name      string
+		vmid      int
+		config    string
+		wantID    int
+		wantCalls []string
+	}{
+		{
+			name:   "next free ID",
+			config: "template: 1\n",
+			wantID: 9005,
+			wantCalls: []string{
+				"pvesh get /cluster/nextid",
+				"pct restore 9005 /tmp/app.tar.zst --storage local-zfs",
+				"pct config 9005",
+			},
+		},
+		{
+			name:   "converts a plain container",
+			vmid:   9001,
+			config: "ostype: debian\n",
+			wantID: 9001,
+			wantCalls: []string{
+				"pct restore 9001 /tmp/app.tar.zst --storage local-zfs",
+				"pct config 9001",
+				"pct template 9001",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates, calls := fakeTemplates(tt.config)
+			vmid, err := templates.Import("/tmp/app.tar.zst", tt.vmid)
+			if err != nil {
+				t.Fatalf("Import() unexpected error: %v", err)
+			}
+			if vmid != tt.wantID {
+				t.Errorf("Import() = %d, want %d", vmid, tt.wantID)
+			}
+			if strings.Join(*calls, "\n") != strings.Join(tt.wantCalls, "\n") {
+				t.Errorf("calls = %v, want %v", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
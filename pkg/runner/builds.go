@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// pendingBuild is a template build running in the background. template and
+// err are set before done is closed.
+type pendingBuild struct {
+	done     chan struct{}
+	template string
+	err      error
+}
+
+// finished reports whether the build has completed
+func (p *pendingBuild) finished() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// startBuilds starts building the templates of all build-based services that
+// will need a new container, so they build while other services deploy.
+// Each finished build sends on finished, which must have room for them all.
+func (o *Orchestrator) startBuilds(ctx context.Context, stack *models.LXCStack, projectState *state.ProjectState, order []string, finished chan<- struct{}) map[string]*pendingBuild {
+	builds := make(map[string]*pendingBuild)
+	for _, name := range order {
+		service := stack.Services[name]
+		if service.Template != "" || service.GetBuildConfig() == nil || !o.needsContainer(ctx, name, service, stack, projectState) {
+			continue
+		}
+		builds[name] = &pendingBuild{done: make(chan struct{})}
+	}
+
+	for name, pending := range builds {
+		go func(name string, service models.Service, pending *pendingBuild) {
+			pending.template, pending.err = o.build(ctx, name, service.GetBuildConfig())
+			close(pending.done)
+			finished <- struct{}{}
+		}(name, stack.Services[name], pending)
+	}
+	return builds
+}
+
+// needsContainer reports whether up will create a container for the service
+func (o *Orchestrator) needsContainer(ctx context.Context, name string, service models.Service, stack *models.LXCStack, projectState *state.ProjectState) bool {
+	if (o.renew && canRenew(service)) || o.recreate[name] {
+		return true
+	}
+
+	digest, filesDigest, err := o.serviceDigests(name, service, stack)
+	if err != nil {
+		// Let the deploy report the error
+		return false
+	}
+
+	previous, deployed := projectState.Services[name]
+	if deployed {
+		if _, err := o.client.GetContainer(ctx, previous.ContainerID); err != nil {
+			deployed = false
+		}
+	}
+
+	action := planUpdate(previous, deployed, digest, filesDigest)
+	return action == actionCreate || action == actionRecreate
+}
+
+// nextReady returns the index of the first service in remaining whose
+// dependencies are deployed and whose template build, if any, and networks
+// and volumes have finished, or -1 if every remaining service is waiting on
+// a build or resource
+func nextReady(stack *models.LXCStack, remaining []string, deployed map[string]bool, builds map[string]*pendingBuild, resources map[string]*pendingResource) int {
+	for i, name := range remaining {
+		service := stack.Services[name]
+
+		ready := true
+		for _, dep := range service.DependsOn {
+			if !deployed[dep] {
+				ready = false
+				break
+			}
+		}
+		if target := service.PidService(); target != "" && !deployed[target] {
+			ready = false
+		}
+		if pending, ok := builds[name]; ok && !pending.finished() {
+			ready = false
+		}
+		for _, resource := range serviceResources(stack, service, resources) {
+			if !resource.finished() {
+				ready = false
+			}
+		}
+
+		if ready {
+			return i
+		}
+	}
+	return -1
+}
+
+// waitBuilds blocks until all background builds have finished
+func waitBuilds(builds map[string]*pendingBuild) {
+	for _, pending := range builds {
+		<-pending.done
+	}
+}
+
+// syncWriter serializes writes from concurrent builds and deploys
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,21 @@
+package runner
+
+import (
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// loadStack loads a stack file for commands other than Up, with the
+// development overrides applied when Development is set or the project was
+// last deployed with them, so the services pxc up --dev added are seen
+func (o *Orchestrator) loadStack(stackFile string) (*models.LXCStack, error) {
+	if o.development {
+		return config.LoadDevelopmentStack(stackFile)
+	}
+	projectState, err := state.Load(state.Path(o.baseDir, o.projectName), o.projectName)
+	if err == nil && projectState.Development {
+		return config.LoadDevelopmentStack(stackFile)
+	}
+	return config.LoadLXCStack(stackFile)
+}
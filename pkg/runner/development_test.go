@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestUpDevelopment(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst"
+    environment:
+      MODE: production
+development:
+  services:
+    web:
+      environment:
+        MODE: development
+  extra_services:
+    adminer:
+      template: "local:vztmpl/alpine-3.19-default_20240207_amd64.tar.zst"
+`)
+	baseDir := t.TempDir()
+	client := newFakeClient()
+	orchestrator := New(&Config{ProjectName: "dev", BaseDir: baseDir, Development: true, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	ids := make(map[string]int)
+	for _, service := range result.Services {
+		if service.Error != nil {
+			t.Fatalf("service %s failed: %v", service.Name, service.Error)
+		}
+		ids[service.Name] = service.ContainerID
+	}
+	if _, deployed := ids["adminer"]; !deployed {
+		t.Fatalf("extra service not deployed: %v", ids)
+	}
+
+	projectState, err := state.Load(state.Path(baseDir, "dev"), "dev")
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if !projectState.Development {
+		t.Error("state does not record the development deployment")
+	}
+
+	// Down without --dev still tears down the extra service
+	client.reset()
+	orchestrator = New(&Config{ProjectName: "dev", BaseDir: baseDir, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+	if _, err := orchestrator.Down(context.Background(), stackPath, false); err != nil {
+		t.Fatalf("Down() unexpected error: %v", err)
+	}
+	calls := strings.Join(client.calls, "\n")
+	for _, name := range []string{"web", "adminer"} {
+		if want := fmt.Sprintf("destroy %d", ids[name]); !strings.Contains(calls, want) {
+			t.Errorf("Down() calls missing %q:\n%s", want, calls)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// fakeClient records container operations instead of running pct. It is
+// safe for services deploying at once.
+type fakeClient struct {
+	mu         sync.Mutex
+	calls      []string
+	containers map[int]bool
+	stopped    map[int]bool
+	fail       map[string]error                          // Errors to return, keyed by "op vmid"
+	onStart    func(vmid int)                            // Called after a container is started
+	onExec     func(ctx context.Context, vmid int) error // Replaces the result of exec when set
+	taken      map[int]bool                              // IDs used by VMs or other projects
+	hostnames  map[int]string                            // Hostnames containers were created with
+	forwards   map[proxmox.HostPort]proxmox.PortForward
+	listening  []proxmox.HostPort      // Ports processes on the node listen on
+	pushed     map[string]pushedFile   // Pushed files, keyed by "vmid dest"
+	guestNodes map[int]string          // Nodes of containers elsewhere in the cluster
+	templates  map[string]bool         // Template archives on the node's storage
+	listed     []proxmox.ContainerInfo // Containers listed across the cluster
+}
+
+// pushedFile is the contents and options of a pushed file
+type pushedFile struct {
+	content string
+	opts    proxmox.PushOptions
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{containers: make(map[int]bool), stopped: make(map[int]bool), hostnames: make(map[int]string)}
+}
+
+func (f *fakeClient) record(format string, args ...interface{}) {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+// failure returns the injected error for an operation, if any
+func (f *fakeClient) failure(op string, vmid int) error {
+	return f.fail[fmt.Sprintf("%s %d", op, vmid)]
+}
+
+func (f *fakeClient) GetContainer(ctx context.Context, vmid int) (*proxmox.ContainerInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.containers[vmid] {
+		return nil, fmt.Errorf("container %d %w", vmid, proxmox.ErrContainerNotFound)
+	}
+	status := "running"
+	if f.stopped[vmid] {
+		status = "stopped"
+	}
+	return &proxmox.ContainerInfo{VMID: vmid, Status: status}, nil
+}
+
+func (f *fakeClient) CreateContainer(ctx context.Context, vmid int, template string, config *proxmox.ContainerConfig) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create %d %s", vmid, template)
+	f.containers[vmid] = true
+	f.hostnames[vmid] = config.Hostname
+	return nil
+}
+
+func (f *fakeClient) StartContainer(ctx context.Context, vmid int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("start %d", vmid)
+	if err := f.failure("start", vmid); err != nil {
+		return err
+	}
+	delete(f.stopped, vmid)
+	if f.onStart != nil {
+		f.onStart(vmid)
+	}
+	return nil
+}
+
+func (f *fakeClient) StopContainer(ctx context.Context, vmid int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("stop %d", vmid)
+	if err := f.failure("stop", vmid); err != nil {
+		return err
+	}
+	f.stopped[vmid] = true
+	return nil
+}
+
+func (f *fakeClient) ShutdownContainer(ctx context.Context, vmid int, timeout time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("shutdown %d %s", vmid, timeout)
+	if err := f.failure("shutdown", vmid); err != nil {
+		return err
+	}
+	f.stopped[vmid] = true
+	return nil
+}
+
+func (f *fakeClient) DestroyContainer(ctx context.Context, vmid int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("destroy %d", vmid)
+	if err := f.failure("destroy", vmid); err != nil {
+		return err
+	}
+	delete(f.containers, vmid)
+	delete(f.stopped, vmid)
+	return nil
+}
+
+func (f *fakeClient) ExecCommand(ctx context.Context, vmid int, command []string) error {
+	f.mu.Lock()
+	f.record("exec %d %s", vmid, strings.Join(command, " "))
+	err, onExec := f.failure("exec", vmid), f.onExec
+	f.mu.Unlock()
+	if onExec != nil {
+		return onExec(ctx, vmid)
+	}
+	return err
+}
+
+func (f *fakeClient) GetContainerIP(ctx context.Context, vmid int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return "127.0.0.1", nil
+}
+
+func (f *fakeClient) PushFile(ctx context.Context, vmid int, source, dest string, opts proxmox.PushOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("push %d %s", vmid, dest)
+	if content, err := os.ReadFile(source); err == nil {
+		if f.pushed == nil {
+			f.pushed = make(map[string]pushedFile)
+		}
+		f.pushed[fmt.Sprintf("%d %s", vmid, dest)] = pushedFile{string(content), opts}
+	}
+	return f.failure("push", vmid)
+}
+
+// GetInterfaceAddresses puts every container on 10.0.N.VMID%250 for its
+// interface ethN
+func (f *fakeClient) GetInterfaceAddresses(ctx context.Context, vmid int) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure("addresses", vmid); err != nil {
+		return nil, err
+	}
+	addresses := make(map[string]string)
+	for i := 0; i < 4; i++ {
+		addresses[fmt.Sprintf("eth%d", i)] = fmt.Sprintf("10.0.%d.%d", i, vmid%250)
+	}
+	return addresses, nil
+}
+
+// IsVMIDFree reports IDs of known containers, and those in taken, as used
+func (f *fakeClient) IsVMIDFree(ctx context.Context, vmid int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.containers[vmid] && !f.taken[vmid], nil
+}
+
+func (f *fakeClient) EnsureNetwork(ctx context.Context, network proxmox.SDNNetwork) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("network %s %s", network.Zone, network.VNet)
+	return true, f.fail["network "+network.VNet]
+}
+
+// reset clears recorded calls, keeping known containers
+func (f *fakeClient) reset() {
+	f.calls = nil
+}
+
+// PortForwards returns the forwards published through the fake
+func (f *fakeClient) PortForwards(ctx context.Context) ([]proxmox.PortForward, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var forwards []proxmox.PortForward
+	for _, forward := range f.forwards {
+		forwards = append(forwards, forward)
+	}
+	return forwards, nil
+}
+
+func (f *fakeClient) ListeningPorts(ctx context.Context) ([]proxmox.HostPort, error) {
+	return f.listening, nil
+}
+
+func (f *fakeClient) UpdatePortForwards(ctx context.Context, remove []proxmox.HostPort, add []proxmox.PortForward) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.forwards == nil {
+		f.forwards = make(map[proxmox.HostPort]proxmox.PortForward)
+	}
+	for _, port := range remove {
+		delete(f.forwards, port)
+	}
+	for _, forward := range add {
+		f.forwards[forward.HostPort] = forward
+	}
+	return nil
+}
+
+// ContainerNode returns the node recorded in guestNodes, if any
+func (f *fakeClient) ContainerNode(ctx context.Context, vmid int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if node, ok := f.guestNodes[vmid]; ok {
+		return node, nil
+	}
+	return "", fmt.Errorf("container %d %w", vmid, proxmox.ErrContainerNotFound)
+}
+
+func (f *fakeClient) MigrateContainer(ctx context.Context, vmid int, target string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("migrate %d %s", vmid, target)
+	return f.failure("migrate", vmid)
+}
+
+func (f *fakeClient) HasTemplate(ctx context.Context, volid string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.templates[volid], nil
+}
+
+func (f *fakeClient) ListClusterContainers(ctx context.Context) ([]proxmox.ContainerInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.listed, f.fail["list"]
+}
+
+func (f *fakeClient) DownloadTemplate(ctx context.Context, storage, template string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("download %s %s", storage, template)
+	return f.fail["download "+template]
+}
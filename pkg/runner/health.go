@@ -0,0 +1,253 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// Health check defaults applied when the stack leaves them unset
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	defaultHealthRetries  = 3
+)
+
+// waitForHealthCheck probes a started container until it reports healthy or
+// the configured retries are used up
+func (o *Orchestrator) waitForHealthCheck(ctx context.Context, containerID int, health *models.HealthCheck) error {
+	if o.dryRun {
+		o.log("DRY RUN: Would wait for container %d to become healthy", containerID)
+		return nil
+	}
+
+	interval := health.Interval
+	if interval == 0 {
+		interval = defaultHealthInterval
+	}
+	retries := health.Retries
+	if retries == 0 {
+		retries = defaultHealthRetries
+	}
+
+	// Failures during the start period don't count against the retries,
+	// but a check that passes in it ends the wait
+	startPeriodEnd := o.now().Add(health.StartPeriod)
+
+	var err error
+	attempt := 0
+	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err = o.probeHealth(ctx, containerID, health); err == nil {
+			return nil
+		}
+		if o.now().Before(startPeriodEnd) {
+			o.logDebug("Health check for container %d failed during its start period: %v", containerID, err)
+		} else {
+			attempt++
+			o.logDebug("Health check attempt %d/%d for container %d failed: %v", attempt, retries, containerID, err)
+			if attempt >= retries {
+				break
+			}
+		}
+		o.sleep(interval)
+	}
+
+	return fmt.Errorf("unhealthy after %d attempts: %w", retries, err)
+}
+
+// dependencyWait is a service_healthy dependency whose health check must
+// pass before a service is deployed
+type dependencyWait struct {
+	name        string
+	containerID int
+	health      *models.HealthCheck
+}
+
+// healthyDependencies returns the service_healthy dependencies of a service
+// that are still to be waited for: those this run left starting and those
+// it did not deploy. It fails if one of them turned out unhealthy. A
+// dependency without a health check in this run counts as healthy.
+func (o *Orchestrator) healthyDependencies(service models.Service, stack *models.LXCStack, statuses map[string]string, projectState *state.ProjectState) ([]dependencyWait, error) {
+	if o.ignoreHealth {
+		return nil, nil
+	}
+
+	var waits []dependencyWait
+	for _, dep := range service.DependsOn {
+		if service.DependencyCondition(dep) != models.ConditionServiceHealthy {
+			continue
+		}
+		health := o.serviceHealth(dep, stack.Services[dep])
+		if health == nil {
+			continue
+		}
+
+		status, deployedNow := statuses[dep]
+		if status == "unhealthy" {
+			return nil, fmt.Errorf("dependency %s is unhealthy", dep)
+		}
+		if deployedNow && status != "starting" {
+			continue
+		}
+
+		o.stateMu.Lock()
+		recorded, exists := projectState.Services[dep]
+		o.stateMu.Unlock()
+		if !exists {
+			if o.dryRun {
+				continue
+			}
+			return nil, fmt.Errorf("dependency %s is not deployed", dep)
+		}
+		waits = append(waits, dependencyWait{name: dep, containerID: recorded.ContainerID, health: health})
+	}
+	return waits, nil
+}
+
+// waitForDependencies waits for the health checks of dependencies to pass
+func (o *Orchestrator) waitForDependencies(ctx context.Context, waits []dependencyWait) error {
+	for _, wait := range waits {
+		o.log("Waiting for dependency %s to become healthy", wait.name)
+		if err := o.healthCheck(ctx, wait.containerID, wait.health); err != nil {
+			return fmt.Errorf("dependency %s did not become healthy: %w", wait.name, err)
+		}
+	}
+	return nil
+}
+
+// CheckHealth runs a single health check against a service container
+func (o *Orchestrator) CheckHealth(ctx context.Context, containerID int, health *models.HealthCheck) error {
+	return o.probeHealth(ctx, containerID, health)
+}
+
+// probeHealth runs a single health check against a container
+func (o *Orchestrator) probeHealth(ctx context.Context, containerID int, health *models.HealthCheck) error {
+	timeout := health.Timeout
+	if timeout == 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	switch {
+	case health.TCPPort != 0:
+		ip, err := o.client.GetContainerIP(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		return probeTCP(net.JoinHostPort(ip, strconv.Itoa(health.TCPPort)), timeout)
+	case health.HTTP != nil:
+		ip, err := o.client.GetContainerIP(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		return probeHTTP(net.JoinHostPort(ip, strconv.Itoa(health.HTTP.Port)), health.HTTP, timeout)
+	default:
+		return probeExec(ctx, func(ctx context.Context) error {
+			return o.client.ExecCommand(ctx, containerID, []string{"sh", "-c", health.Test})
+		}, timeout)
+	}
+}
+
+// probeExec runs a health test command, failing it once timeout passes.
+// pct exec has no timeout of its own, so the command runs in a context that
+// interrupts a test that hangs.
+func probeExec(ctx context.Context, run func(ctx context.Context) error, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := run(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("health test timed out after %v", timeout)
+	}
+	return err
+}
+
+// probeTCP succeeds if address accepts a TCP connection
+func probeTCP(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return fmt.Errorf("tcp %s: %w", address, err)
+	}
+	return conn.Close()
+}
+
+// probeHTTP succeeds if a GET on the check's path returns the expected status
+func probeHTTP(address string, check *models.HTTPCheck, timeout time.Duration) error {
+	path := check.Path
+	if path == "" {
+		path = "/"
+	}
+	expect := check.ExpectStatus
+	if expect == 0 {
+		expect = http.StatusOK
+	}
+
+	url := "http://" + address + path
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("http %s: %w", url, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != expect {
+		return fmt.Errorf("http %s: status %d, want %d", url, resp.StatusCode, expect)
+	}
+	return nil
+}
+
+// resolveHealthOverrides turns --healthcheck tests and --no-healthcheck
+// services into per-service health checks for this run. An override keeps
+// the timing settings of the service's own check; a disabled service maps
+// to nil.
+func resolveHealthOverrides(stack *models.LXCStack, tests map[string]string, disabled []string) (map[string]*models.HealthCheck, error) {
+	overrides := make(map[string]*models.HealthCheck)
+
+	for name, test := range tests {
+		service, exists := stack.Services[name]
+		if !exists {
+			return nil, fmt.Errorf("healthcheck references undefined service '%s'", name)
+		}
+		if test == "" {
+			return nil, fmt.Errorf("healthcheck for service '%s' is empty", name)
+		}
+
+		override := &models.HealthCheck{Test: test}
+		if service.Health != nil {
+			override.Interval = service.Health.Interval
+			override.Timeout = service.Health.Timeout
+			override.Retries = service.Health.Retries
+			override.StartPeriod = service.Health.StartPeriod
+		}
+		overrides[name] = override
+	}
+
+	for _, name := range disabled {
+		if _, exists := stack.Services[name]; !exists {
+			return nil, fmt.Errorf("no-healthcheck references undefined service '%s'", name)
+		}
+		if _, overridden := tests[name]; overridden {
+			return nil, fmt.Errorf("service '%s' has both a healthcheck override and no-healthcheck", name)
+		}
+		overrides[name] = nil
+	}
+
+	return overrides, nil
+}
+
+// serviceHealth returns the health check used for a service in this run
+func (o *Orchestrator) serviceHealth(name string, service models.Service) *models.HealthCheck {
+	if override, exists := o.healthOverrides[name]; exists {
+		return override
+	}
+	return service.Health
+}
@@ -0,0 +1,364 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+func TestProbeHealth(t *testing.T) {
+	// Listener standing in for a container port that accepts connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	// Port with nothing listening
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/ready":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	_, portString, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	httpPort, _ := strconv.Atoi(portString)
+
+	tests := []struct {
+		name     string
+		health   *models.HealthCheck
+		errorMsg string
+	}{
+		{
+			name:   "tcp port accepting connections",
+			health: &models.HealthCheck{TCPPort: openPort},
+		},
+		{
+			name:     "tcp port refusing connections",
+			health:   &models.HealthCheck{TCPPort: closedPort, Timeout: time.Second},
+			errorMsg: "tcp 127.0.0.1:" + strconv.Itoa(closedPort),
+		},
+		{
+			name:   "http default status",
+			health: &models.HealthCheck{HTTP: &models.HTTPCheck{Path: "/health", Port: httpPort}},
+		},
+		{
+			name:   "http expected status",
+			health: &models.HealthCheck{HTTP: &models.HTTPCheck{Path: "/ready", Port: httpPort, ExpectStatus: 204}},
+		},
+		{
+			name:     "http unexpected status",
+			health:   &models.HealthCheck{HTTP: &models.HTTPCheck{Path: "/", Port: httpPort}},
+			errorMsg: "status 503, want 200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orchestrator := New(&Config{Output: &bytes.Buffer{}})
+			orchestrator.client = newFakeClient()
+
+			err := orchestrator.probeHealth(context.Background(), 301, tt.health)
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("probeHealth() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("probeHealth() error = %v, want error containing %q", err, tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestWaitForHealthCheckRetries(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	orchestrator := New(&Config{Output: &bytes.Buffer{}})
+	orchestrator.client = newFakeClient()
+
+	err = orchestrator.waitForHealthCheck(context.Background(), 301, &models.HealthCheck{
+		TCPPort:  port,
+		Interval: time.Millisecond,
+		Timeout:  100 * time.Millisecond,
+		Retries:  2,
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "unhealthy after 2 attempts") {
+		t.Errorf("waitForHealthCheck() error = %v, want unhealthy after 2 attempts", err)
+	}
+}
+
+func TestProbeHealthCommand(t *testing.T) {
+	client := newFakeClient()
+	orchestrator := New(&Config{Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	if err := orchestrator.probeHealth(context.Background(), 301, &models.HealthCheck{Test: "pg_isready"}); err != nil {
+		t.Fatalf("probeHealth() unexpected error: %v", err)
+	}
+	if len(client.calls) != 1 || client.calls[0] != "exec 301 sh -c pg_isready" {
+		t.Errorf("calls = %v, want exec of the test command", client.calls)
+	}
+}
+
+func TestUpHealthcheckOverrides(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+  web:
+    template: "node:20"
+    health:
+      test: "curl -f http://localhost:3000/health"
+      interval: 2s
+      retries: 5
+  cache:
+    template: "redis:7"
+`)
+
+	orchestrator := New(&Config{
+		ProjectName:    "healthcheck",
+		BaseDir:        filepath.Dir(stackPath),
+		HealthChecks:   map[string]string{"web": "curl -sf localhost:3000", "cache": "redis-cli ping"},
+		NoHealthChecks: []string{"database"},
+		Output:         &bytes.Buffer{},
+	})
+	orchestrator.client = newFakeClient()
+
+	checks := make(map[int]*models.HealthCheck)
+	orchestrator.healthCheck = func(_ context.Context, containerID int, health *models.HealthCheck) error {
+		checks[containerID] = health
+		return nil
+	}
+
+	if _, err := orchestrator.Up(context.Background(), stackPath); err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+
+	id := func(service string) int {
+		containerID := orchestrator.generateContainerID(service)
+		return containerID
+	}
+	if _, checked := checks[id("database")]; checked {
+		t.Error("database health check ran despite --no-healthcheck")
+	}
+	web := checks[id("web")]
+	if web == nil || web.Test != "curl -sf localhost:3000" {
+		t.Fatalf("web health check = %+v, want overridden test", web)
+	}
+	if web.Interval != 2*time.Second || web.Retries != 5 {
+		t.Errorf("web override lost the service's timing: %+v", web)
+	}
+	if cache := checks[id("cache")]; cache == nil || cache.Test != "redis-cli ping" {
+		t.Errorf("cache health check = %+v, want added test", cache)
+	}
+}
+
+func TestResolveHealthOverridesErrors(t *testing.T) {
+	stack := &models.LXCStack{Services: map[string]models.Service{"web": {Template: "nginx:latest"}}}
+
+	tests := []struct {
+		name     string
+		tests    map[string]string
+		disabled []string
+		errorMsg string
+	}{
+		{name: "undefined healthcheck service", tests: map[string]string{"api": "true"}, errorMsg: "healthcheck references undefined service 'api'"},
+		{name: "undefined no-healthcheck service", disabled: []string{"api"}, errorMsg: "no-healthcheck references undefined service 'api'"},
+		{name: "override and disable", tests: map[string]string{"web": "true"}, disabled: []string{"web"}, errorMsg: "service 'web' has both a healthcheck override and no-healthcheck"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveHealthOverrides(stack, tt.tests, tt.disabled)
+			if err == nil || err.Error() != tt.errorMsg {
+				t.Errorf("resolveHealthOverrides() error = %v, want %q", err, tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestWaitForHealthCheckStartPeriod(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		wantErr    bool
+		wantProbes int
+	}{
+		// Three failures inside the 30s start period, then a pass
+		{name: "healthy after start period failures", failures: 4, wantProbes: 5},
+		// Start period failures plus the two counted retries
+		{name: "unhealthy", failures: 10, wantErr: true, wantProbes: 5},
+		{name: "healthy at once", failures: 0, wantProbes: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeClient()
+			orchestrator := New(&Config{Output: &bytes.Buffer{}})
+			orchestrator.client = client
+
+			now := time.Unix(0, 0)
+			orchestrator.now = func() time.Time { return now }
+			orchestrator.sleep = func(d time.Duration) { now = now.Add(d) }
+
+			probes := 0
+			client.onExec = func(context.Context, int) error {
+				probes++
+				if probes <= tt.failures {
+					return errors.New("not ready")
+				}
+				return nil
+			}
+
+			err := orchestrator.waitForHealthCheck(context.Background(), 301, &models.HealthCheck{
+				Test:        "pg_isready",
+				Interval:    10 * time.Second,
+				Retries:     2,
+				StartPeriod: 30 * time.Second,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("waitForHealthCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if probes != tt.wantProbes {
+				t.Errorf("probes = %d, want %d", probes, tt.wantProbes)
+			}
+		})
+	}
+}
+
+func TestProbeHealthCommandTimeout(t *testing.T) {
+	client := newFakeClient()
+	orchestrator := New(&Config{Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	client.onExec = func(ctx context.Context, _ int) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+			t.Error("health test command was not stopped at the timeout")
+			return nil
+		}
+	}
+
+	err := orchestrator.probeHealth(context.Background(), 301, &models.HealthCheck{Test: "sleep 60", Timeout: 10 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("probeHealth() error = %v, want a timeout", err)
+	}
+}
+
+func TestUpDependsOnHealthy(t *testing.T) {
+	const stack = `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    depends_on:
+      database:
+        condition: service_healthy
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+`
+
+	tests := []struct {
+		name       string
+		config     Config
+		health     error
+		wantErr    string
+		wantWeb    bool
+		wantChecks int
+	}{
+		{name: "healthy", wantWeb: true, wantChecks: 1},
+		{name: "unhealthy", health: errors.New("connection refused"), wantErr: "dependency database is unhealthy", wantChecks: 1},
+		// database is left starting, so web waits for it instead
+		{name: "wait for web", config: Config{WaitFor: "web"}, wantWeb: true, wantChecks: 1},
+		{name: "ignore health", config: Config{IgnoreHealth: true}, health: errors.New("connection refused"), wantWeb: true},
+		{name: "no healthcheck", config: Config{NoHealthChecks: []string{"database"}}, health: errors.New("connection refused"), wantWeb: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, stack)
+			config := tt.config
+			config.ProjectName = "healthy"
+			config.BaseDir = t.TempDir()
+			config.Output = &bytes.Buffer{}
+			orchestrator := New(&config)
+			client := newFakeClient()
+			orchestrator.client = client
+
+			checks := 0
+			orchestrator.healthCheck = func(context.Context, int, *models.HealthCheck) error {
+				checks++
+				return tt.health
+			}
+
+			result, err := orchestrator.Up(context.Background(), stackPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Up() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Up() unexpected error: %v", err)
+			}
+
+			deployedWeb := false
+			for _, call := range client.calls {
+				if strings.HasPrefix(call, "create") && strings.HasSuffix(call, "nginx:latest") {
+					deployedWeb = true
+				}
+			}
+			if deployedWeb != tt.wantWeb {
+				t.Errorf("web deployed = %v, want %v (calls %v)", deployedWeb, tt.wantWeb, client.calls)
+			}
+			if checks != tt.wantChecks {
+				t.Errorf("health checks = %d, want %d", checks, tt.wantChecks)
+			}
+			if tt.name == "unhealthy" && result.Services[0].Status != "unhealthy" {
+				t.Errorf("database status = %q, want unhealthy", result.Services[0].Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// hostsScript replaces the block pxc manages in /etc/hosts with its
+// arguments, one line each
+const hostsScript = `sed -i '/^# BEGIN pxc$/,/^# END pxc$/d' /etc/hosts && { echo '# BEGIN pxc'; printf '%s\n' "$@"; echo '# END pxc'; } >> /etc/hosts`
+
+// networkMember is a container attached to a created network
+type networkMember struct {
+	containerID int
+	iface       string   // Interface on the network, e.g. eth1
+	names       []string // Service name, replica key and hostname
+}
+
+// updateHosts lets services on the same created network reach each other by
+// name: every container on such a network gets an /etc/hosts block mapping
+// the service name, replica key and hostname of each container sharing a
+// network with it to that container's address on the network. The block is
+// rewritten on every Up, so it follows containers that were recreated.
+// Failures are warnings, as services addressed by IP keep working.
+func (o *Orchestrator) updateHosts(ctx context.Context, stack *models.LXCStack, projectState *state.ProjectState) {
+	if o.dryRun {
+		return
+	}
+
+	members := o.networkMembers(stack, projectState)
+	if len(members) == 0 {
+		return
+	}
+	if o.api != nil {
+		o.logWarning("Services cannot resolve each other by name with the api transport; use their addresses")
+		return
+	}
+
+	// Addresses of each container, looked up once
+	addresses := make(map[int]map[string]string)
+	for _, network := range members {
+		for _, member := range network {
+			if _, done := addresses[member.containerID]; done {
+				continue
+			}
+			found, err := o.client.GetInterfaceAddresses(ctx, member.containerID)
+			if err != nil {
+				o.logWarning("Failed to get addresses of container %d: %v", member.containerID, err)
+			}
+			addresses[member.containerID] = found
+		}
+	}
+
+	// Entries for each container, from every network it is on
+	entries := make(map[int][]string)
+	networks := make([]string, 0, len(members))
+	for name := range members {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+	for _, name := range networks {
+		var lines []string
+		for _, member := range members[name] {
+			if address := addresses[member.containerID][member.iface]; address != "" {
+				lines = append(lines, address+" "+strings.Join(member.names, " "))
+			}
+		}
+		for _, member := range members[name] {
+			entries[member.containerID] = append(entries[member.containerID], lines...)
+		}
+	}
+
+	containers := make([]int, 0, len(entries))
+	for containerID := range entries {
+		containers = append(containers, containerID)
+	}
+	sort.Ints(containers)
+	for _, containerID := range containers {
+		command := append([]string{"sh", "-c", hostsScript, "sh"}, entries[containerID]...)
+		if err := o.client.ExecCommand(ctx, containerID, command); err != nil {
+			o.logWarning("Failed to update /etc/hosts of container %d: %v", containerID, err)
+		}
+	}
+}
+
+// networkMembers returns the deployed containers on each created network,
+// in service and replica order
+func (o *Orchestrator) networkMembers(stack *models.LXCStack, projectState *state.ProjectState) map[string][]networkMember {
+	services := make([]string, 0, len(stack.Services))
+	for name := range stack.Services {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+
+	members := make(map[string][]networkMember)
+	for _, serviceName := range services {
+		service := stack.Services[serviceName]
+		for i, networkName := range serviceNetworks(service) {
+			network, defined := stack.Networks[networkName]
+			if !defined || !managedNetwork(network) {
+				continue
+			}
+			for _, key := range serviceStateKeys(stack, projectState, serviceName) {
+				r := replicaOf(serviceName, key, service)
+				names := []string{serviceName}
+				if r.label != serviceName {
+					names = append(names, r.label)
+				}
+				if hostname := o.getContainerHostname(r, service); hostname != serviceName && hostname != r.label {
+					names = append(names, hostname)
+				}
+				members[networkName] = append(members[networkName], networkMember{
+					containerID: projectState.Services[key].ContainerID,
+					iface:       fmt.Sprintf("eth%d", i),
+					names:       names,
+				})
+			}
+		}
+	}
+	return members
+}
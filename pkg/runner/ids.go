@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// Container IDs are allocated from this range unless Config sets another,
+// e.g. from the vmid_range setting. IDs below 200 are left for containers
+// created by hand.
+const (
+	DefaultMinContainerID = 200
+	DefaultMaxContainerID = 999999999
+)
+
+// maxContainerIDProbes bounds the search for a free container ID
+const maxContainerIDProbes = 100
+
+// generateContainerID returns the preferred container ID of a service,
+// derived from the project and service names so a service gets the same ID
+// on every host while it is free. The names are hashed across the whole ID
+// range, so services spread over all of it.
+func (o *Orchestrator) generateContainerID(serviceName string) int {
+	span := o.maxID - o.minID + 1
+	hash := 0
+	for _, char := range o.projectName + serviceName {
+		hash = (hash*31 + int(char)) % span
+	}
+	return o.minID + hash
+}
+
+// reservedContainerIDs returns the container IDs recorded for the project's
+// services other than key, which no other service may be given even while
+// their containers are gone
+func reservedContainerIDs(projectState *state.ProjectState, key string) map[int]bool {
+	reserved := make(map[int]bool, len(projectState.Services))
+	for other, recorded := range projectState.Services {
+		if other != key && recorded.ContainerID != 0 {
+			reserved[recorded.ContainerID] = true
+		}
+	}
+	return reserved
+}
+
+// freeContainerID claims the first container ID from the service's
+// preferred ID upwards, wrapping around the ID range, that is neither
+// reserved, claimed nor used by a container or VM anywhere in the cluster
+func (o *Orchestrator) freeContainerID(ctx context.Context, serviceName string, reserved map[int]bool) (int, error) {
+	o.idMu.Lock()
+	defer o.idMu.Unlock()
+
+	start := o.generateContainerID(serviceName)
+	span := o.maxID - o.minID + 1
+	for i := 0; i < maxContainerIDProbes && i < span; i++ {
+		containerID := o.minID + (start-o.minID+i)%span
+		if reserved[containerID] || o.claimedIDs[containerID] {
+			continue
+		}
+		free, err := o.client.IsVMIDFree(ctx, containerID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check container ID %d: %w", containerID, err)
+		}
+		if free {
+			o.claimID(containerID)
+			return containerID, nil
+		}
+	}
+	return 0, fmt.Errorf("no free container ID found for %s in %d-%d", serviceName, o.minID, o.maxID)
+}
+
+// allocateContainerID returns the container ID to deploy a service with:
+// the ID recorded for it if that is free again, e.g. once its container was
+// removed to be recreated, so services keep their IDs, or else a free one
+func (o *Orchestrator) allocateContainerID(ctx context.Context, key string, projectState *state.ProjectState) (int, error) {
+	reserved := reservedContainerIDs(projectState, key)
+	if recorded, exists := projectState.Services[key]; exists && recorded.ContainerID != 0 && !reserved[recorded.ContainerID] {
+		o.idMu.Lock()
+		free := !o.claimedIDs[recorded.ContainerID]
+		var err error
+		if free {
+			free, err = o.client.IsVMIDFree(ctx, recorded.ContainerID)
+		}
+		if free && err == nil {
+			o.claimID(recorded.ContainerID)
+		}
+		o.idMu.Unlock()
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to check container ID %d: %w", recorded.ContainerID, err)
+		}
+		if free {
+			return recorded.ContainerID, nil
+		}
+	}
+	return o.freeContainerID(ctx, key, reserved)
+}
+
+// claimID records a container ID as handed out; the caller holds idMu
+func (o *Orchestrator) claimID(containerID int) {
+	if o.claimedIDs == nil {
+		o.claimedIDs = make(map[int]bool)
+	}
+	o.claimedIDs[containerID] = true
+}
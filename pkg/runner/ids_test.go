@@ -0,0 +1,118 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestAllocateContainerID(t *testing.T) {
+	newOrchestrator := func(config *Config) (*Orchestrator, *fakeClient) {
+		config.ProjectName = "ids"
+		config.Output = &bytes.Buffer{}
+		orchestrator := New(config)
+		client := newFakeClient()
+		client.taken = make(map[int]bool)
+		orchestrator.client = client
+		return orchestrator, client
+	}
+
+	orchestrator, client := newOrchestrator(&Config{})
+	preferred := orchestrator.generateContainerID("web")
+
+	t.Run("preferred ID", func(t *testing.T) {
+		got, err := orchestrator.allocateContainerID(context.Background(), "web", &state.ProjectState{Services: map[string]state.ServiceState{}})
+		if err != nil || got != preferred {
+			t.Errorf("allocateContainerID() = %d, %v, want %d", got, err, preferred)
+		}
+	})
+
+	t.Run("recorded ID is kept", func(t *testing.T) {
+		projectState := &state.ProjectState{Services: map[string]state.ServiceState{"web": {ContainerID: 4242}}}
+		got, err := orchestrator.allocateContainerID(context.Background(), "web", projectState)
+		if err != nil || got != 4242 {
+			t.Errorf("allocateContainerID() = %d, %v, want the recorded 4242", got, err)
+		}
+	})
+
+	t.Run("IDs used elsewhere are skipped", func(t *testing.T) {
+		client.taken[4242] = true
+		client.taken[preferred] = true
+		defer func() { client.taken = make(map[int]bool) }()
+
+		// Another service of the project recorded the next ID, though its
+		// container is gone
+		projectState := &state.ProjectState{Services: map[string]state.ServiceState{
+			"web": {ContainerID: 4242},
+			"db":  {ContainerID: preferred + 1},
+		}}
+		got, err := orchestrator.allocateContainerID(context.Background(), "web", projectState)
+		if err != nil || got != preferred+2 {
+			t.Errorf("allocateContainerID() = %d, %v, want %d", got, err, preferred+2)
+		}
+	})
+
+	t.Run("range wraps around", func(t *testing.T) {
+		orchestrator, client := newOrchestrator(&Config{MinContainerID: 9000, MaxContainerID: 9002})
+		start := orchestrator.generateContainerID("web")
+		if start < 9000 || start > 9002 {
+			t.Fatalf("generateContainerID() = %d, want it in 9000-9002", start)
+		}
+		for id := 9000; id <= 9002; id++ {
+			client.taken[id] = id != 9000 && id != 9001
+		}
+		client.taken[9001] = start != 9001
+		got, err := orchestrator.allocateContainerID(context.Background(), "web", &state.ProjectState{Services: map[string]state.ServiceState{}})
+		if err != nil || (got != 9000 && got != 9001) {
+			t.Errorf("allocateContainerID() = %d, %v, want a free ID in the range", got, err)
+		}
+
+		for id := 9000; id <= 9002; id++ {
+			client.taken[id] = true
+		}
+		if _, err := orchestrator.allocateContainerID(context.Background(), "web", &state.ProjectState{Services: map[string]state.ServiceState{}}); err == nil || !strings.Contains(err.Error(), "no free container ID found for web in 9000-9002") {
+			t.Errorf("allocateContainerID() error = %v, want the range exhausted", err)
+		}
+	})
+}
+
+func TestGenerateContainerIDSpreadsOverRange(t *testing.T) {
+	orchestrator := New(&Config{ProjectName: "ids", MinContainerID: 100000, MaxContainerID: 199999})
+	beyond := 0
+	for _, service := range []string{"web", "db", "cache", "worker", "api", "proxy"} {
+		id := orchestrator.generateContainerID(service)
+		if id < 100000 || id > 199999 {
+			t.Fatalf("generateContainerID(%q) = %d, want it in 100000-199999", service, id)
+		}
+		if id >= 101000 {
+			beyond++
+		}
+	}
+	if beyond == 0 {
+		t.Error("generateContainerID() kept every ID within the first 1000 of the range")
+	}
+}
+
+func TestUpAvoidsUsedContainerIDs(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+`)
+	orchestrator := New(&Config{ProjectName: "clash", BaseDir: t.TempDir(), Output: &bytes.Buffer{}})
+	client := newFakeClient()
+	preferred := orchestrator.generateContainerID("web")
+	client.taken = map[int]bool{preferred: true} // e.g. a VM
+	orchestrator.client = client
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	if got := result.Services[0].ContainerID; got == preferred || got == 0 {
+		t.Errorf("web deployed in container %d, want a free ID other than %d", got, preferred)
+	}
+}
@@ -0,0 +1,166 @@
+package runner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"regexp"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// defaultBridge is the Proxmox bridge of the default network and of
+// networks pxc does not create
+const defaultBridge = "vmbr0"
+
+// defaultZone is the SDN zone networks are created in unless their zone
+// option names another
+const defaultZone = "pxc"
+
+// sdnID matches the IDs Proxmox accepts for SDN zones and vnets
+var sdnID = regexp.MustCompile(`^[a-z][a-z0-9]{0,7}$`)
+
+// managedNetwork reports whether pxc creates a network as an SDN vnet:
+// bridge networks without a parent option. A network with a parent attaches
+// to that existing bridge, and host and none networks to the parent or the
+// default bridge.
+func managedNetwork(network models.Network) bool {
+	driver := network.Driver
+	return (driver == "" || driver == "bridge") && network.Options["parent"] == ""
+}
+
+// vnetName returns the SDN vnet of a created network: its name if set,
+// otherwise one derived from the project and network names, since vnet IDs
+// are limited to eight characters
+func vnetName(project, name string, network models.Network) string {
+	if network.Name != "" {
+		return network.Name
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(project + "/" + name))
+	return fmt.Sprintf("px%06x", hash.Sum32()&0xffffff)
+}
+
+// networkBridge returns the bridge interfaces on a network attach to. The
+// default network, unless the stack defines it, is the default bridge.
+func networkBridge(project, name string, stack *models.LXCStack) string {
+	network, defined := stack.Networks[name]
+	if defined && managedNetwork(network) {
+		return vnetName(project, name, network)
+	}
+	if parent := network.Options["parent"]; parent != "" {
+		return parent
+	}
+	return defaultBridge
+}
+
+// sdnNetwork describes the SDN vnet of a created network. A subnet gets a
+// gateway on the node, its first address unless gateway is set, and hands
+// out the rest of its addresses by DHCP. Traffic leaving the subnet is
+// masqueraded unless the network is internal.
+func sdnNetwork(project, name string, network models.Network) (proxmox.SDNNetwork, error) {
+	spec := proxmox.SDNNetwork{
+		Zone:  network.Options["zone"],
+		VNet:  vnetName(project, name, network),
+		Alias: fmt.Sprintf("%s %s", project, name),
+	}
+	if spec.Zone == "" {
+		spec.Zone = defaultZone
+	}
+	if !sdnID.MatchString(spec.VNet) {
+		return spec, fmt.Errorf("network %s: name %q is not a valid Proxmox SDN vnet ID (lowercase letters and digits, starting with a letter, at most 8 characters)", name, spec.VNet)
+	}
+	if !sdnID.MatchString(spec.Zone) {
+		return spec, fmt.Errorf("network %s: zone %q is not a valid Proxmox SDN zone ID (lowercase letters and digits, starting with a letter, at most 8 characters)", name, spec.Zone)
+	}
+
+	if network.Subnet == "" {
+		if network.Gateway != "" {
+			return spec, fmt.Errorf("network %s: gateway %s requires a subnet", name, network.Gateway)
+		}
+		return spec, nil
+	}
+
+	_, subnet, err := net.ParseCIDR(network.Subnet)
+	if err != nil || subnet.IP.To4() == nil {
+		return spec, fmt.Errorf("network %s: subnet %q is not an IPv4 CIDR", name, network.Subnet)
+	}
+	ones, bits := subnet.Mask.Size()
+	if bits-ones < 2 {
+		return spec, fmt.Errorf("network %s: subnet %s is too small, use a /30 or larger", name, network.Subnet)
+	}
+	first := binary.BigEndian.Uint32(subnet.IP.To4())
+	last := first | (1<<uint(bits-ones) - 1)
+
+	gateway := first + 1
+	if network.Gateway != "" {
+		ip := net.ParseIP(network.Gateway)
+		if ip == nil || ip.To4() == nil || !subnet.Contains(ip) {
+			return spec, fmt.Errorf("network %s: gateway %s is not in subnet %s", name, network.Gateway, network.Subnet)
+		}
+		gateway = binary.BigEndian.Uint32(ip.To4())
+	}
+
+	// DHCP hands out the usable addresses, leaving out the gateway when it
+	// is at either end of them
+	start, end := first+1, last-1
+	if gateway == start {
+		start++
+	}
+	if gateway == end {
+		end--
+	}
+
+	spec.Subnet = subnet.String()
+	spec.Gateway = ipv4(gateway)
+	spec.SNAT = !network.Internal
+	spec.DHCPStart = ipv4(start)
+	spec.DHCPEnd = ipv4(end)
+	return spec, nil
+}
+
+// ipv4 formats an IPv4 address held in an integer
+func ipv4(address uint32) string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, address)
+	return ip.String()
+}
+
+// serviceNetworks returns the networks a service is attached to, in
+// interface order; a service without networks is on the default network
+func serviceNetworks(service models.Service) []string {
+	if len(service.Networks) == 0 {
+		return []string{"default"}
+	}
+	return service.Networks
+}
+
+// serviceInterfaces returns the pct netN values for a service, one per
+// network in the order the service lists them. The first network is the
+// primary interface: it is eth0 and the only one given the network's gateway,
+// so the container's default route always goes through it. Later networks
+// are secondary interfaces without a gateway. A service without networks
+// gets none, so it keeps the interfaces of its template or the default one.
+func serviceInterfaces(service models.Service, stack *models.LXCStack, project string) []string {
+	if len(service.Networks) == 0 {
+		return nil
+	}
+
+	interfaces := make([]string, len(service.Networks))
+	for i, name := range service.Networks {
+		network := stack.Networks[name]
+		bridge := networkBridge(project, name, stack)
+
+		iface := fmt.Sprintf("name=eth%d,bridge=%s,ip=dhcp,type=veth", i, bridge)
+		if vlan := network.Options["vlan"]; vlan != "" {
+			iface += ",tag=" + vlan
+		}
+		if i == 0 && network.Gateway != "" && !network.Internal {
+			iface += ",gw=" + network.Gateway
+		}
+		interfaces[i] = iface
+	}
+	return interfaces
+}
@@ -0,0 +1,291 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+func TestServiceInterfaces(t *testing.T) {
+	stack := &models.LXCStack{
+		Networks: map[string]models.Network{
+			"frontend": {Gateway: "172.20.0.1", Options: map[string]string{"parent": "vmbr0"}},
+			"backend":  {Gateway: "172.21.0.1", Options: map[string]string{"parent": "vmbr1", "vlan": "20"}},
+			"storage":  {Gateway: "172.22.0.1", Internal: true, Options: map[string]string{"parent": "vmbr2"}},
+			"cache":    {Name: "pxcache", Subnet: "172.23.0.0/24"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		networks []string
+		expected []string
+	}{
+		{
+			name:     "no networks",
+			expected: nil,
+		},
+		{
+			name:     "first network is primary",
+			networks: []string{"frontend", "backend"},
+			expected: []string{
+				"name=eth0,bridge=vmbr0,ip=dhcp,type=veth,gw=172.20.0.1",
+				"name=eth1,bridge=vmbr1,ip=dhcp,type=veth,tag=20",
+			},
+		},
+		{
+			name:     "order decides the primary",
+			networks: []string{"backend", "frontend"},
+			expected: []string{
+				"name=eth0,bridge=vmbr1,ip=dhcp,type=veth,tag=20,gw=172.21.0.1",
+				"name=eth1,bridge=vmbr0,ip=dhcp,type=veth",
+			},
+		},
+		{
+			name:     "internal primary has no gateway",
+			networks: []string{"storage", "frontend"},
+			expected: []string{
+				"name=eth0,bridge=vmbr2,ip=dhcp,type=veth",
+				"name=eth1,bridge=vmbr0,ip=dhcp,type=veth",
+			},
+		},
+		{
+			name:     "created network uses its vnet",
+			networks: []string{"cache"},
+			expected: []string{"name=eth0,bridge=pxcache,ip=dhcp,type=veth"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serviceInterfaces(models.Service{Networks: tt.networks}, stack, "myapp")
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("serviceInterfaces() = %q, want %q", got, tt.expected)
+			}
+
+			gateways := 0
+			for _, iface := range got {
+				if strings.Contains(iface, ",gw=") {
+					gateways++
+				}
+			}
+			if gateways > 1 {
+				t.Errorf("%d interfaces have a gateway, want at most one", gateways)
+			}
+		})
+	}
+}
+
+func TestBuildContainerConfigNetworks(t *testing.T) {
+	stack := &models.LXCStack{
+		Networks: map[string]models.Network{
+			"frontend": {Name: "pxfront", Subnet: "172.20.0.0/24", Gateway: "172.20.0.1"},
+			"backend":  {Gateway: "172.21.0.1", Options: map[string]string{"parent": "vmbr1"}},
+		},
+	}
+	service := models.Service{Template: "nginx:latest", Networks: []string{"frontend", "backend"}}
+
+	config := New(&Config{DryRun: true}).buildContainerConfig(service, stack)
+	if config.Net0 != "name=eth0,bridge=pxfront,ip=dhcp,type=veth,gw=172.20.0.1" {
+		t.Errorf("Net0 = %q, want the frontend interface with its gateway", config.Net0)
+	}
+	if !reflect.DeepEqual(config.Nets, []string{"name=eth1,bridge=vmbr1,ip=dhcp,type=veth"}) {
+		t.Errorf("Nets = %q, want the backend interface without a gateway", config.Nets)
+	}
+
+	config = New(&Config{DryRun: true}).buildContainerConfig(models.Service{Template: "nginx:latest"}, stack)
+	if config.Net0 != "" || len(config.Nets) != 0 {
+		t.Errorf("interfaces = %q %q, want none for a service without networks", config.Net0, config.Nets)
+	}
+}
+
+func TestBuildContainerConfigDNS(t *testing.T) {
+	service := models.Service{
+		Template:  "nginx:latest",
+		DNS:       []string{"10.0.0.53", "1.1.1.1"},
+		DNSSearch: []string{"internal.example.com", "example.com"},
+	}
+
+	config := New(&Config{DryRun: true}).buildContainerConfig(service, &models.LXCStack{})
+	want := []string{"--nameserver", "10.0.0.53 1.1.1.1", "--searchdomain", "internal.example.com example.com"}
+	if got := proxmox.DNSArgs(config); !reflect.DeepEqual(got, want) {
+		t.Errorf("DNSArgs() = %q, want %q", got, want)
+	}
+
+	config = New(&Config{DryRun: true}).buildContainerConfig(models.Service{Template: "nginx:latest"}, &models.LXCStack{})
+	if got := proxmox.DNSArgs(config); got != nil {
+		t.Errorf("DNSArgs() = %q, want nil without overrides", got)
+	}
+}
+
+func TestBuildContainerConfigOSType(t *testing.T) {
+	orchestrator := New(&Config{DryRun: true})
+
+	config := orchestrator.buildContainerConfig(models.Service{Template: "ubuntu:22.04"}, &models.LXCStack{})
+	if config.OSType != "ubuntu" {
+		t.Errorf("OSType = %q, want ubuntu inferred from the template", config.OSType)
+	}
+
+	config = orchestrator.buildContainerConfig(models.Service{Template: "ubuntu:22.04", OSType: "debian"}, &models.LXCStack{})
+	if config.OSType != "debian" {
+		t.Errorf("OSType = %q, want the explicit debian", config.OSType)
+	}
+}
+
+func TestSDNNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		network models.Network
+		want    proxmox.SDNNetwork
+		wantErr string
+	}{
+		{
+			name:    "subnet with default gateway",
+			network: models.Network{Name: "backend", Subnet: "172.21.0.0/24"},
+			want: proxmox.SDNNetwork{
+				Zone: "pxc", VNet: "backend", Alias: "myapp backend", Subnet: "172.21.0.0/24",
+				Gateway: "172.21.0.1", SNAT: true, DHCPStart: "172.21.0.2", DHCPEnd: "172.21.0.254",
+			},
+		},
+		{
+			name:    "internal network is not masqueraded",
+			network: models.Network{Name: "storage", Subnet: "10.9.8.0/28", Gateway: "10.9.8.14", Internal: true, Options: map[string]string{"zone": "lab"}},
+			want: proxmox.SDNNetwork{
+				Zone: "lab", VNet: "storage", Alias: "myapp backend", Subnet: "10.9.8.0/28",
+				Gateway: "10.9.8.14", DHCPStart: "10.9.8.1", DHCPEnd: "10.9.8.13",
+			},
+		},
+		{
+			name:    "vnet without subnet",
+			network: models.Network{Name: "l2only"},
+			want:    proxmox.SDNNetwork{Zone: "pxc", VNet: "l2only", Alias: "myapp backend"},
+		},
+		{name: "name too long", network: models.Network{Name: "web-frontend"}, wantErr: "not a valid Proxmox SDN vnet ID"},
+		{name: "invalid zone", network: models.Network{Options: map[string]string{"zone": "My Zone"}}, wantErr: "not a valid Proxmox SDN zone ID"},
+		{name: "gateway without subnet", network: models.Network{Gateway: "10.0.0.1"}, wantErr: "requires a subnet"},
+		{name: "gateway outside subnet", network: models.Network{Subnet: "10.0.0.0/24", Gateway: "10.0.1.1"}, wantErr: "not in subnet"},
+		{name: "ipv6 subnet", network: models.Network{Subnet: "fd00::/64"}, wantErr: "not an IPv4 CIDR"},
+		{name: "subnet too small", network: models.Network{Subnet: "10.0.0.0/31"}, wantErr: "too small"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sdnNetwork("myapp", "backend", tt.network)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("sdnNetwork() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sdnNetwork() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("sdnNetwork() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVNetName(t *testing.T) {
+	generated := vnetName("myapp", "backend", models.Network{})
+	if !sdnID.MatchString(generated) {
+		t.Errorf("vnetName() = %q, not a valid vnet ID", generated)
+	}
+	if other := vnetName("otherapp", "backend", models.Network{}); other == generated {
+		t.Errorf("vnetName() = %q for two projects, want distinct vnets", other)
+	}
+	if got := vnetName("myapp", "backend", models.Network{Name: "appnet"}); got != "appnet" {
+		t.Errorf("vnetName() = %q, want the network's name", got)
+	}
+}
+
+func TestUpCreatesNetworks(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    networks: [frontend, backend]
+  api:
+    template: "node:20"
+    networks: [backend]
+  proxy:
+    template: "nginx:latest"
+    networks: [edge]
+networks:
+  frontend:
+    name: front
+    subnet: "172.20.0.0/24"
+  backend:
+    name: back
+    subnet: "172.21.0.0/24"
+    internal: true
+  edge:
+    options:
+      parent: vmbr1
+`)
+
+	client := newFakeClient()
+	orchestrator := New(&Config{ProjectName: "myapp", BaseDir: t.TempDir(), Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	if len(result.Networks) != 3 {
+		t.Fatalf("Up() networks = %+v, want all three", result.Networks)
+	}
+
+	var networks []string
+	hosts := make(map[int]string)
+	for _, call := range client.calls {
+		if strings.HasPrefix(call, "network ") {
+			networks = append(networks, call)
+		}
+		var vmid int
+		if _, err := fmt.Sscanf(call, "exec %d", &vmid); err == nil && strings.Contains(call, "/etc/hosts") {
+			hosts[vmid] = call
+		}
+	}
+	sort.Strings(networks)
+	if want := []string{"network pxc back", "network pxc front"}; !reflect.DeepEqual(networks, want) {
+		t.Errorf("created networks %v, want %v and none for the parent bridge", networks, want)
+	}
+
+	ids := make(map[string]int)
+	for _, service := range result.Services {
+		ids[service.Name] = service.ContainerID
+	}
+	webBackend := fmt.Sprintf("10.0.1.%d web myapp-web", ids["web"]%250)
+	apiBackend := fmt.Sprintf("10.0.0.%d api myapp-api", ids["api"]%250)
+	webFrontend := fmt.Sprintf("10.0.0.%d web myapp-web", ids["web"]%250)
+
+	for _, tt := range []struct {
+		service string
+		want    []string
+	}{
+		{"web", []string{apiBackend, webBackend, webFrontend}},
+		{"api", []string{apiBackend, webBackend}},
+	} {
+		call := hosts[ids[tt.service]]
+		for _, entry := range tt.want {
+			if !strings.Contains(call, entry) {
+				t.Errorf("hosts of %s = %q, want entry %q", tt.service, call, entry)
+			}
+		}
+		if tt.service == "api" && strings.Contains(call, webFrontend) {
+			t.Errorf("hosts of api = %q, want no entry for a network it is not on", call)
+		}
+	}
+	if call, ok := hosts[ids["proxy"]]; ok {
+		t.Errorf("proxy hosts updated with %q, want none on an existing bridge", call)
+	}
+}
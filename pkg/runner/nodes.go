@@ -0,0 +1,289 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// nodeRouter spreads a stack over cluster nodes: the calls for a container
+// go to the client of the node it is placed on, and the rest, such as
+// networks and port forwards, to the stack's node
+type nodeRouter struct {
+	containerClient // Client of the stack's node
+
+	node      string
+	newClient func(node string) containerClient
+
+	mu      sync.Mutex
+	clients map[string]containerClient
+	placed  map[int]string
+}
+
+func newNodeRouter(client containerClient, node string, newClient func(node string) containerClient) *nodeRouter {
+	return &nodeRouter{
+		containerClient: client,
+		node:            node,
+		newClient:       newClient,
+		clients:         make(map[string]containerClient),
+		placed:          make(map[int]string),
+	}
+}
+
+// place records the node a container is on
+func (r *nodeRouter) place(vmid int, node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if node == "" || node == r.node {
+		delete(r.placed, vmid)
+		return
+	}
+	r.placed[vmid] = node
+}
+
+// nodeClient returns the client of a node
+func (r *nodeRouter) nodeClient(node string) containerClient {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.clientLocked(node)
+}
+
+func (r *nodeRouter) clientLocked(node string) containerClient {
+	if node == "" || node == r.node {
+		return r.containerClient
+	}
+	client, ok := r.clients[node]
+	if !ok {
+		client = r.newClient(node)
+		r.clients[node] = client
+	}
+	return client
+}
+
+// container returns the client of the node a container is placed on
+func (r *nodeRouter) container(vmid int) containerClient {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.clientLocked(r.placed[vmid])
+}
+
+func (r *nodeRouter) GetContainer(ctx context.Context, vmid int) (*proxmox.ContainerInfo, error) {
+	return r.container(vmid).GetContainer(ctx, vmid)
+}
+
+func (r *nodeRouter) CreateContainer(ctx context.Context, vmid int, template string, config *proxmox.ContainerConfig) error {
+	return r.container(vmid).CreateContainer(ctx, vmid, template, config)
+}
+
+func (r *nodeRouter) StartContainer(ctx context.Context, vmid int) error {
+	return r.container(vmid).StartContainer(ctx, vmid)
+}
+
+func (r *nodeRouter) StopContainer(ctx context.Context, vmid int) error {
+	return r.container(vmid).StopContainer(ctx, vmid)
+}
+
+func (r *nodeRouter) ShutdownContainer(ctx context.Context, vmid int, timeout time.Duration) error {
+	return r.container(vmid).ShutdownContainer(ctx, vmid, timeout)
+}
+
+func (r *nodeRouter) DestroyContainer(ctx context.Context, vmid int) error {
+	return r.container(vmid).DestroyContainer(ctx, vmid)
+}
+
+func (r *nodeRouter) ExecCommand(ctx context.Context, vmid int, command []string) error {
+	return r.container(vmid).ExecCommand(ctx, vmid, command)
+}
+
+func (r *nodeRouter) GetContainerIP(ctx context.Context, vmid int) (string, error) {
+	return r.container(vmid).GetContainerIP(ctx, vmid)
+}
+
+func (r *nodeRouter) PushFile(ctx context.Context, vmid int, source, dest string, opts proxmox.PushOptions) error {
+	return r.container(vmid).PushFile(ctx, vmid, source, dest, opts)
+}
+
+func (r *nodeRouter) GetInterfaceAddresses(ctx context.Context, vmid int) (map[string]string, error) {
+	return r.container(vmid).GetInterfaceAddresses(ctx, vmid)
+}
+
+// stackNode returns the name of the stack's node: the resolved node, or
+// with pct on the local node, the local host name
+func (o *Orchestrator) stackNode() string {
+	if o.node != "" && o.node != "localhost" {
+		return o.node
+	}
+	if name, err := proxmox.LocalNode(); err == nil {
+		return name
+	}
+	return o.node
+}
+
+// serviceNode returns the node a service's containers are placed on
+func (o *Orchestrator) serviceNode(service models.Service) string {
+	if service.Node != "" && !o.isStackNode(service.Node) {
+		return service.Node
+	}
+	return o.stackNode()
+}
+
+// isStackNode reports whether node names the stack's node
+func (o *Orchestrator) isStackNode(node string) bool {
+	if node == o.node {
+		return true
+	}
+	if o.api == nil && (o.node == "" || o.node == "localhost") {
+		return proxmox.IsLocalNode(node)
+	}
+	return false
+}
+
+// spreadNodes sends container calls to the nodes containers are placed on
+// when the stack places services on other nodes, or previous runs did
+func (o *Orchestrator) spreadNodes(stack *models.LXCStack, projectState *state.ProjectState) {
+	router, ok := o.client.(*nodeRouter)
+	if !ok {
+		spread := false
+		for _, service := range stack.Services {
+			spread = spread || (service.Node != "" && !o.isStackNode(service.Node))
+		}
+		for _, entry := range projectState.Services {
+			spread = spread || (entry.Node != "" && !o.isStackNode(entry.Node))
+		}
+		if !spread {
+			return
+		}
+		router = newNodeRouter(o.client, o.stackNode(), o.newClient)
+		o.client = router
+	}
+	for _, entry := range projectState.Services {
+		if entry.Node != "" && !o.isStackNode(entry.Node) {
+			router.place(entry.ContainerID, entry.Node)
+		}
+	}
+}
+
+// placeContainer records the node a new container of a service is created
+// on
+func (o *Orchestrator) placeContainer(containerID int, service models.Service) {
+	if router, ok := o.client.(*nodeRouter); ok {
+		router.place(containerID, o.serviceNode(service))
+	}
+}
+
+// recordedNode returns the node of a container for the project state, empty
+// for the stack's node
+func (o *Orchestrator) recordedNode(containerID int) string {
+	router, ok := o.client.(*nodeRouter)
+	if !ok {
+		return ""
+	}
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	return router.placed[containerID]
+}
+
+// checkNodes rejects placements the other nodes cannot serve: ports are
+// forwarded and named volumes created on the stack's node only, and a
+// template container can only be on one node at a time
+func (o *Orchestrator) checkNodes(stack *models.LXCStack, order []string) error {
+	var problems []string
+	templateNodes := make(map[string]map[string]bool)
+	for _, name := range order {
+		service := stack.Services[name]
+		node := o.serviceNode(service)
+		if _, err := strconv.Atoi(service.Template); err == nil {
+			if templateNodes[service.Template] == nil {
+				templateNodes[service.Template] = make(map[string]bool)
+			}
+			templateNodes[service.Template][node] = true
+		}
+		if node == o.stackNode() {
+			continue
+		}
+
+		var needs []string
+		if len(service.Ports) > 0 {
+			needs = append(needs, "ports")
+		}
+		if _, volumes := stack.RequiredResources(service); len(volumes) > 0 {
+			needs = append(needs, "named volumes")
+		}
+		if len(needs) > 0 {
+			problems = append(problems, fmt.Sprintf("%s on node %s has %s", name, node, strings.Join(needs, " and ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("ports and named volumes are only set up on the stack's node %s: %s", o.stackNode(), strings.Join(problems, "; "))
+	}
+
+	for template, nodes := range templateNodes {
+		if len(nodes) > 1 {
+			names := make([]string, 0, len(nodes))
+			for node := range nodes {
+				names = append(names, node)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("template container %s is used on nodes %s, but can only be on one node; use a template archive or a template per node", template, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// nodeTemplate makes a template available on the node a service is placed
+// on. A template container on another node, such as one just built on the
+// stack's node, is migrated there; a template archive the node's storage
+// lacks is downloaded with the node's appliance manager.
+func (o *Orchestrator) nodeTemplate(ctx context.Context, template string, service models.Service) error {
+	router, ok := o.client.(*nodeRouter)
+	if !ok {
+		return nil
+	}
+	node := o.serviceNode(service)
+
+	// Replicas of a service deploy at once and share the template
+	o.templateMu.Lock()
+	defer o.templateMu.Unlock()
+
+	client := router.nodeClient(node)
+	if vmid, err := strconv.Atoi(template); err == nil {
+		current, err := client.ContainerNode(ctx, vmid)
+		if err != nil {
+			return fmt.Errorf("failed to find template %d: %w", vmid, err)
+		}
+		if current == node {
+			return nil
+		}
+		o.log("Migrating template %d from node %s to %s", vmid, current, node)
+		if err := router.nodeClient(current).MigrateContainer(ctx, vmid, node); err != nil {
+			return fmt.Errorf("failed to migrate template %d to node %s: %w", vmid, node, err)
+		}
+		return nil
+	}
+
+	storage, path, found := strings.Cut(template, ":")
+	if !found {
+		return nil
+	}
+	available, err := client.HasTemplate(ctx, template)
+	if err != nil {
+		return fmt.Errorf("failed to check template %s on node %s: %w", template, node, err)
+	}
+	if available {
+		return nil
+	}
+	file := path[strings.LastIndex(path, "/")+1:]
+	o.log("Downloading template %s to storage %s on node %s", file, storage, node)
+	if err := client.DownloadTemplate(ctx, storage, file); err != nil {
+		return fmt.Errorf("template %s is not on node %s and could not be downloaded, copy it there or use shared storage: %w", template, node, err)
+	}
+	return nil
+}
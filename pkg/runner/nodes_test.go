@@ -0,0 +1,170 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestUpPlacesServicesOnNodes(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+settings:
+  proxmox:
+    node: pve1
+    nodes: [pve1, pve2]
+services:
+  db:
+    template: "local:vztmpl/debian-12-standard_12.2-1_amd64.tar.zst"
+  web:
+    template: "9000"
+    node: pve2
+  cache:
+    template: "local:vztmpl/alpine-3.19-default_20240207_amd64.tar.zst"
+    node: pve2
+`)
+	baseDir := t.TempDir()
+	newOrchestrator := func(main, remote *fakeClient) *Orchestrator {
+		orchestrator := New(&Config{ProjectName: "spread", BaseDir: baseDir, Output: &bytes.Buffer{}})
+		orchestrator.client = main
+		orchestrator.newClient = func(node string) containerClient {
+			if node != "pve2" {
+				t.Fatalf("client created for node %s, want pve2", node)
+			}
+			return remote
+		}
+		return orchestrator
+	}
+
+	main, remote := newFakeClient(), newFakeClient()
+	remote.guestNodes = map[int]string{9000: "pve1"}
+	result, err := newOrchestrator(main, remote).Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+
+	ids := make(map[string]int)
+	for _, service := range result.Services {
+		if service.Error != nil {
+			t.Fatalf("service %s failed: %v", service.Name, service.Error)
+		}
+		ids[service.Name] = service.ContainerID
+	}
+
+	mainCalls := strings.Join(main.calls, "\n")
+	remoteCalls := strings.Join(remote.calls, "\n")
+	for _, want := range []string{
+		fmt.Sprintf("create %d local:vztmpl/debian-12", ids["db"]),
+		"migrate 9000 pve2",
+	} {
+		if !strings.Contains(mainCalls, want) {
+			t.Errorf("stack's node calls missing %q:\n%s", want, mainCalls)
+		}
+	}
+	for _, want := range []string{
+		fmt.Sprintf("create %d 9000", ids["web"]),
+		"download local alpine-3.19-default_20240207_amd64.tar.zst",
+		fmt.Sprintf("create %d local:vztmpl/alpine-3.19", ids["cache"]),
+		fmt.Sprintf("start %d", ids["cache"]),
+	} {
+		if !strings.Contains(remoteCalls, want) {
+			t.Errorf("pve2 calls missing %q:\n%s", want, remoteCalls)
+		}
+	}
+	if strings.Contains(remoteCalls, fmt.Sprintf("create %d ", ids["db"])) {
+		t.Errorf("db created on pve2:\n%s", remoteCalls)
+	}
+
+	projectState, err := state.Load(state.Path(baseDir, "spread"), "spread")
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	for name, want := range map[string]string{"db": "", "web": "pve2", "cache": "pve2"} {
+		if got := projectState.Services[name].Node; got != want {
+			t.Errorf("state node of %s = %q, want %q", name, got, want)
+		}
+	}
+
+	// A later run finds the containers on their nodes through the state
+	main.reset()
+	remote.reset()
+	if _, err := newOrchestrator(main, remote).Down(context.Background(), stackPath, false); err != nil {
+		t.Fatalf("Down() unexpected error: %v", err)
+	}
+	if want := fmt.Sprintf("destroy %d", ids["web"]); !strings.Contains(strings.Join(remote.calls, "\n"), want) {
+		t.Errorf("pve2 calls missing %q:\n%v", want, remote.calls)
+	}
+	if want := fmt.Sprintf("destroy %d", ids["db"]); !strings.Contains(strings.Join(main.calls, "\n"), want) {
+		t.Errorf("stack's node calls missing %q:\n%v", want, main.calls)
+	}
+}
+
+func TestCheckNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		stack   string
+		wantErr string
+	}{
+		{
+			name: "services on both nodes",
+			stack: `
+  web:
+    template: "9000"
+    node: pve2
+  db:
+    template: "9001"
+    ports: ["5432:5432"]
+`,
+		},
+		{
+			name: "ports on another node",
+			stack: `
+  web:
+    template: "9000"
+    node: pve2
+    ports: ["8080:80"]
+`,
+			wantErr: "web on node pve2 has ports",
+		},
+		{
+			name: "template container on two nodes",
+			stack: `
+  web:
+    template: "9000"
+    node: pve2
+  api:
+    template: "9000"
+`,
+			wantErr: "template container 9000 is used on nodes pve1, pve2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, "version: \"1.0\"\nsettings:\n  proxmox:\n    node: pve1\nservices:"+tt.stack)
+			orchestrator := New(&Config{ProjectName: "nodes", BaseDir: t.TempDir(), Output: &bytes.Buffer{}})
+			main, remote := newFakeClient(), newFakeClient()
+			main.guestNodes = map[int]string{9001: "pve1"}
+			remote.guestNodes = map[int]string{9000: "pve2"}
+			orchestrator.client = main
+			orchestrator.newClient = func(string) containerClient { return remote }
+
+			_, err := orchestrator.Up(context.Background(), stackPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Up() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Up() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(main.calls)+len(remote.calls) != 0 {
+				t.Errorf("containers changed despite the error: %v %v", main.calls, remote.calls)
+			}
+		})
+	}
+}
@@ -1,48 +1,260 @@
 package runner
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/fatih/color"
-
 	"github.com/brynnjknight/proxer/internal/models"
 	"github.com/brynnjknight/proxer/pkg/builder"
 	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/output"
 	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
 )
 
+// containerClient is the subset of the Proxmox client used by the orchestrator
+type containerClient interface {
+	GetContainer(ctx context.Context, vmid int) (*proxmox.ContainerInfo, error)
+	CreateContainer(ctx context.Context, vmid int, template string, config *proxmox.ContainerConfig) error
+	StartContainer(ctx context.Context, vmid int) error
+	StopContainer(ctx context.Context, vmid int) error
+	ShutdownContainer(ctx context.Context, vmid int, timeout time.Duration) error
+	DestroyContainer(ctx context.Context, vmid int) error
+	ExecCommand(ctx context.Context, vmid int, command []string) error
+	GetContainerIP(ctx context.Context, vmid int) (string, error)
+	PushFile(ctx context.Context, vmid int, source, dest string, opts proxmox.PushOptions) error
+	GetInterfaceAddresses(ctx context.Context, vmid int) (map[string]string, error)
+	IsVMIDFree(ctx context.Context, vmid int) (bool, error)
+	EnsureNetwork(ctx context.Context, network proxmox.SDNNetwork) (bool, error)
+	PortForwards(ctx context.Context) ([]proxmox.PortForward, error)
+	ListeningPorts(ctx context.Context) ([]proxmox.HostPort, error)
+	UpdatePortForwards(ctx context.Context, remove []proxmox.HostPort, add []proxmox.PortForward) error
+	ContainerNode(ctx context.Context, vmid int) (string, error)
+	MigrateContainer(ctx context.Context, vmid int, target string) error
+	HasTemplate(ctx context.Context, volid string) (bool, error)
+	DownloadTemplate(ctx context.Context, storage, template string) error
+	ListClusterContainers(ctx context.Context) ([]proxmox.ContainerInfo, error)
+}
+
 // Orchestrator manages multi-container applications
 type Orchestrator struct {
-	client          *proxmox.Client
+	client          containerClient
 	builder         *builder.Builder
 	verbose         bool
 	dryRun          bool
 	projectName     string
 	baseDir         string
+	node            string
 	storage         string
 	templateStorage string
+	overrides       models.ProxmoxConfig
+	defaults        models.ProxmoxConfig
+	builderConfig   builder.Config
+	scales          map[string]int
+	waitFor         string
+	buildArgs       map[string]string
+	serviceArgs     map[string]map[string]string
+	buildFrom       string
+	renew           bool
+	batch           int
+	healthTests     map[string]string
+	noHealth        []string
+	strict          bool
+	development     bool
+	rollback        bool
+	stopTimeout     time.Duration
+	stopOnError     bool
+	services        []string
+	noDeps          bool
+	ignoreHealth    bool
+	recreate        map[string]bool
+	api             *proxmox.APIConfig
+	minID           int
+	maxID           int
+	parallel        int
+	out             io.Writer
+	logger          *output.Logger
+
+	// state is the project state of the current Up. Services deploying in
+	// the background work on copies; stateMu guards it while their entries
+	// are merged back.
+	state   *state.ProjectState
+	stateMu sync.Mutex
+
+	// claimedIDs are the container IDs handed out by the current Up, so
+	// services deploying at once never get the same one
+	claimedIDs map[int]bool
+	idMu       sync.Mutex
+
+	// healthOverrides replace the health checks of services for the
+	// current Up; a nil entry disables the check
+	healthOverrides map[string]*models.HealthCheck
+
+	// healthCheck waits for a started container to report healthy
+	healthCheck func(ctx context.Context, containerID int, health *models.HealthCheck) error
+
+	// sleep and now pace health checks
+	sleep func(time.Duration)
+	now   func() time.Time
+
+	// nodeCapacity reports what the node has left for new containers
+	nodeCapacity func(node, storage string) (*proxmox.NodeCapacity, error)
+
+	// newClient creates the client of another cluster node, for services
+	// placed on it
+	newClient func(node string) containerClient
+
+	// templateMu serializes making templates available on other nodes
+	templateMu sync.Mutex
+
+	// build builds the template of a build-based service
+	build func(ctx context.Context, serviceName string, buildConfig *models.BuildConfig) (string, error)
+
+	// builds are the template builds started by the current Up
+	builds map[string]*pendingBuild
+
+	// createResource creates a network or volume of the stack
+	createResource func(ctx context.Context, kind, name string, stack *models.LXCStack) error
+
+	// fetchSecret returns an external secret by name; nil leaves external
+	// secrets to be managed outside pxc
+	fetchSecret func(name string) ([]byte, error)
+
+	// networkMu serializes network creation: networks share their SDN
+	// zone, and the SDN configuration is applied as a whole
+	networkMu sync.Mutex
+
+	// created are the containers the current Up created, which are removed
+	// again when it is interrupted
+	createdMu sync.Mutex
+	created   []int
 }
 
 // Config holds orchestrator configuration
 type Config struct {
-	Verbose         bool
-	DryRun          bool
-	ProjectName     string
-	BaseDir         string
+	Verbose     bool
+	DryRun      bool
+	ProjectName string
+	BaseDir     string
+
+	// ProxmoxNode, Storage and TemplateStorage come from flags or the
+	// environment and win over a stack's settings.proxmox
 	ProxmoxNode     string
 	Storage         string
 	TemplateStorage string
+
+	// ProxmoxDefaults come from config files and are used for what neither
+	// the fields above nor the stack's settings.proxmox set
+	ProxmoxDefaults models.ProxmoxConfig
+
+	// Scales overrides service replica counts from the stack file
+	Scales map[string]int
+
+	// WaitFor names the only service whose health check gates Up; other
+	// services are started without waiting for them to become healthy
+	WaitFor string
+
+	// BuildArgs are passed to every service build; ServiceBuildArgs to the
+	// named service only. Both override args from the stack file, and
+	// service-specific args override global ones.
+	BuildArgs        map[string]string
+	ServiceBuildArgs map[string]map[string]string
+
+	// BuildFrom overrides the base template of every service build
+	BuildFrom string
+
+	// ReadyProbe decides when build containers are ready (see
+	// builder.ReadyProbes)
+	ReadyProbe string
+
+	// Renew replaces the running containers of services without host ports
+	// with new ones, Batch containers at a time (default 1), removing old
+	// containers only once their replacements are healthy
+	Renew bool
+	Batch int
+
+	// HealthChecks replaces the health test of the named services for this
+	// run; NoHealthChecks disables their health checks
+	HealthChecks   map[string]string
+	NoHealthChecks []string
+
+	// Strict fails Up when the stack would over-commit the node's memory,
+	// disk or cores, instead of warning
+	Strict bool
+
+	// Development deploys the stack with its development overrides applied
+	// (see config.LoadDevelopmentStack). Later runs apply them as long as
+	// the project state records a development deployment.
+	Development bool
+
+	// Rollback makes a failed Up stop and destroy the containers it created
+	// and record their services as they were before it. An interrupted Up
+	// is always rolled back.
+	Rollback bool
+
+	// Services limits Up to the named services and their dependencies, or
+	// only the named services with NoDeps
+	Services []string
+	NoDeps   bool
+
+	// IgnoreHealth starts services without waiting for the health checks of
+	// the services they depend on
+	IgnoreHealth bool
+
+	// Recreate names services whose templates are rebuilt and containers
+	// replaced even if their definition is unchanged, e.g. because files in
+	// their build context changed
+	Recreate []string
+
+	// StopTimeout is how long Down gives each container to shut down
+	// cleanly before it is stopped forcibly. Zero stops containers at once.
+	StopTimeout time.Duration
+
+	// API selects the Proxmox VE HTTP API transport instead of running pct
+	// on the node; services are then created on the resolved node remotely
+	API *proxmox.APIConfig
+
+	// MinContainerID and MaxContainerID bound the IDs given to new
+	// containers (default DefaultMinContainerID-DefaultMaxContainerID)
+	MinContainerID int
+	MaxContainerID int
+
+	// Parallel is how many services Up deploys at once; a service still
+	// waits for the services it depends on. Zero deploys one at a time.
+	Parallel int
+
+	// StopOnError makes Down stop at the first resource it cannot remove
+	// instead of attempting every one
+	StopOnError bool
+
+	// SecretsProvider is a shell command that prints an external secret,
+	// given its name as the argument. Without one, external secrets are not
+	// pushed into containers.
+	SecretsProvider string
+
+	// Logger filters and formats progress logging, and is passed on to the
+	// builder and Proxmox clients (default: output.Default())
+	Logger *output.Logger
+
+	// Output receives progress logging (default: the logger's writer)
+	Output io.Writer
 }
 
 // DeploymentResult contains the results of a deployment operation
 type DeploymentResult struct {
-	Services       []ServiceResult
-	Networks       []NetworkResult
-	Volumes        []VolumeResult
-	DeploymentTime time.Duration
+	Services        []ServiceResult
+	Networks        []NetworkResult
+	Volumes         []VolumeResult
+	RemovedReplicas []string // Replicas above a service's scale, e.g. web-3
+	DeploymentTime  time.Duration
 }
 
 // ServiceResult contains the results for a single service
@@ -52,6 +264,8 @@ type ServiceResult struct {
 	Status      string
 	BuildTime   time.Duration
 	StartTime   time.Duration
+	Ports       []string        // Host port mappings, offset for replicas
+	Replicas    []ServiceResult // Per-replica results of a scaled service
 	Error       error
 }
 
@@ -83,39 +297,147 @@ func New(config *Config) *Orchestrator {
 		config.BaseDir = "."
 	}
 
-	return &Orchestrator{
-		client: proxmox.NewClient("", config.Verbose, config.DryRun),
-		builder: builder.New(&builder.Config{
-			Verbose:         config.Verbose,
-			DryRun:          config.DryRun,
-			ProxmoxNode:     config.ProxmoxNode,
+	if config.Logger == nil {
+		config.Logger = output.Default()
+	}
+	if config.Output == nil {
+		config.Output = config.Logger.Writer()
+	}
+	out := &syncWriter{w: config.Output}
+	logger := config.Logger.WithVerbose(config.Verbose).WithWriter(out)
+
+	o := &Orchestrator{
+		client: proxmox.NewClient("", config.Verbose, config.DryRun).WithLogger(logger),
+		builderConfig: builder.Config{
+			Verbose:    config.Verbose,
+			DryRun:     config.DryRun,
+			ReadyProbe: config.ReadyProbe,
+			Logger:     logger,
+		},
+		logger:      logger,
+		verbose:     config.Verbose,
+		dryRun:      config.DryRun,
+		projectName: config.ProjectName,
+		baseDir:     config.BaseDir,
+		overrides: models.ProxmoxConfig{
+			Node:            config.ProxmoxNode,
 			Storage:         config.Storage,
 			TemplateStorage: config.TemplateStorage,
-		}),
-		verbose:         config.Verbose,
-		dryRun:          config.DryRun,
-		projectName:     config.ProjectName,
-		baseDir:         config.BaseDir,
-		storage:         config.Storage,
-		templateStorage: config.TemplateStorage,
+		},
+		defaults:     config.ProxmoxDefaults,
+		scales:       config.Scales,
+		waitFor:      config.WaitFor,
+		buildArgs:    config.BuildArgs,
+		serviceArgs:  config.ServiceBuildArgs,
+		buildFrom:    config.BuildFrom,
+		renew:        config.Renew,
+		batch:        config.Batch,
+		healthTests:  config.HealthChecks,
+		noHealth:     config.NoHealthChecks,
+		strict:       config.Strict,
+		development:  config.Development,
+		rollback:     config.Rollback,
+		stopTimeout:  config.StopTimeout,
+		stopOnError:  config.StopOnError,
+		services:     config.Services,
+		noDeps:       config.NoDeps,
+		ignoreHealth: config.IgnoreHealth,
+		recreate:     make(map[string]bool, len(config.Recreate)),
+		api:          config.API,
+		minID:        config.MinContainerID,
+		maxID:        config.MaxContainerID,
+		parallel:     max(config.Parallel, 1),
+		out:          out,
+	}
+	if o.minID == 0 {
+		o.minID = DefaultMinContainerID
+	}
+	if o.maxID == 0 || o.maxID < o.minID {
+		o.maxID = DefaultMaxContainerID
 	}
+	for _, name := range config.Recreate {
+		o.recreate[name] = true
+	}
+	o.healthCheck = o.waitForHealthCheck
+	o.sleep = time.Sleep
+	o.now = time.Now
+	o.nodeCapacity = func(node, storage string) (*proxmox.NodeCapacity, error) {
+		if config.API != nil {
+			return proxmox.NewAPIClient(node, *config.API, config.Verbose, config.DryRun).WithLogger(logger).GetNodeCapacity(storage)
+		}
+		return proxmox.NewClient(node, config.Verbose, config.DryRun).WithLogger(logger).GetNodeCapacity(storage)
+	}
+	o.newClient = func(node string) containerClient {
+		var client containerClient = proxmox.NewClient(node, config.Verbose, config.DryRun).WithLogger(logger)
+		if config.API != nil {
+			client = proxmox.NewAPIClient(node, *config.API, config.Verbose, config.DryRun).WithLogger(logger)
+		}
+		return client
+	}
+	o.applyProxmoxSettings(nil)
+	o.build = o.buildTemplate
+	if config.SecretsProvider != "" {
+		o.fetchSecret = func(name string) ([]byte, error) {
+			return providerSecret(config.SecretsProvider, name)
+		}
+	}
+	o.createResource = o.createStackResource
+
+	return o
 }
 
-// Up deploys a multi-container application
-func (o *Orchestrator) Up(stackFile string) (*DeploymentResult, error) {
+// Up deploys a multi-container application. When ctx is done, no further
+// service is started, the running Proxmox commands and builds are
+// interrupted, and the containers created so far are removed, as they are
+// after a failure with Rollback set.
+func (o *Orchestrator) Up(ctx context.Context, stackFile string) (*DeploymentResult, error) {
 	startTime := time.Now()
+	o.claimedIDs = make(map[int]bool)
+	o.created = nil
 
 	// Load stack configuration
 	o.log("Loading stack configuration: %s", stackFile)
-	stack, err := config.LoadLXCStack(stackFile)
+	load := config.LoadLXCStack
+	if o.development {
+		o.log("Applying development overrides")
+		load = config.LoadDevelopmentStack
+	}
+	stack, err := load(stackFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load stack: %w", err)
 	}
 
+	for _, warning := range stack.DeployWarnings() {
+		o.logWarning("%s", warning.Message)
+	}
+
+	// Apply replica count overrides
+	if err := stack.ApplyScale(o.scales); err != nil {
+		return nil, fmt.Errorf("invalid scale override: %w", err)
+	}
+
 	// Validate stack
 	if err := stack.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid stack configuration: %w", err)
 	}
+	o.applyProxmoxSettings(stack)
+
+	if o.waitFor != "" {
+		if _, exists := stack.Services[o.waitFor]; !exists {
+			return nil, fmt.Errorf("wait-for service '%s' is not defined in the stack", o.waitFor)
+		}
+	}
+	if err := o.validateSelection(stack); err != nil {
+		return nil, err
+	}
+	for service := range o.serviceArgs {
+		if _, exists := stack.Services[service]; !exists {
+			return nil, fmt.Errorf("build-arg references undefined service '%s'", service)
+		}
+	}
+	if o.healthOverrides, err = resolveHealthOverrides(stack, o.healthTests, o.noHealth); err != nil {
+		return nil, err
+	}
 
 	result := &DeploymentResult{
 		Services: make([]ServiceResult, 0, len(stack.Services)),
@@ -125,14 +447,27 @@ func (o *Orchestrator) Up(stackFile string) (*DeploymentResult, error) {
 
 	o.log("Deploying stack: %s", o.getStackName(stack))
 
-	// Create networks
-	if err := o.createNetworks(stack, result); err != nil {
-		return result, fmt.Errorf("failed to create networks: %w", err)
-	}
+	// Networks, volumes and template builds progress in the background and
+	// report on finished as they complete
+	finished := make(chan struct{}, len(stack.Networks)+len(stack.Volumes)+len(stack.Services))
 
-	// Create volumes
-	if err := o.createVolumes(stack, result); err != nil {
-		return result, fmt.Errorf("failed to create volumes: %w", err)
+	// Create networks and volumes; each service is deployed only once the
+	// ones it uses exist
+	resources := o.startResources(ctx, stack, finished)
+	defer waitResources(resources, result)
+
+	// Execute init hooks once networks and volumes exist, before any service starts
+	if stack.Hooks != nil && len(stack.Hooks.Init) > 0 {
+		for _, pending := range resources {
+			<-pending.done
+		}
+		if err := failedResource(resources); err != nil {
+			return result, err
+		}
+		o.log("Executing init hooks")
+		if err := o.executeInitHooks(ctx, stack); err != nil {
+			return result, fmt.Errorf("init hooks failed: %w", err)
+		}
 	}
 
 	// Get service dependency order
@@ -140,24 +475,176 @@ func (o *Orchestrator) Up(stackFile string) (*DeploymentResult, error) {
 	if err != nil {
 		return result, fmt.Errorf("failed to resolve service dependencies: %w", err)
 	}
+	if len(o.services) > 0 {
+		serviceOrder = stack.SelectServices(serviceOrder, o.services, !o.noDeps)
+	}
+	if o.waitFor != "" {
+		serviceOrder = stack.PrioritizeService(serviceOrder, o.waitFor)
+	}
 
 	o.log("Service startup order: %s", strings.Join(serviceOrder, " -> "))
 
-	// Deploy services in dependency order
-	for _, serviceName := range serviceOrder {
+	if err := o.checkTransport(stack, serviceOrder); err != nil {
+		return result, err
+	}
+
+	// Load what previous runs deployed so unchanged services are left alone
+	statePath := state.Path(o.baseDir, o.projectName)
+	projectState, err := state.Load(statePath, o.projectName)
+	if err != nil {
+		return result, err
+	}
+	prior := projectState.Clone()
+	o.state = projectState
+	projectState.Development = o.development
+	o.spreadNodes(stack, projectState)
+	if err := o.checkNodes(stack, serviceOrder); err != nil {
+		return result, err
+	}
+
+	// Check that the node can hold the containers about to be created
+	if err := o.preflight(ctx, stack, projectState, serviceOrder); err != nil {
+		return result, err
+	}
+	if err := o.checkPorts(ctx, stack, projectState, serviceOrder); err != nil {
+		return result, err
+	}
+
+	// Build templates in the background while services that don't wait on
+	// them are deployed
+	builds := o.startBuilds(ctx, stack, projectState, serviceOrder, finished)
+	o.builds = builds
+	defer waitBuilds(builds)
+
+	// From here on a failure removes what the run created, if enabled
+	rollback := func(err error) (*DeploymentResult, error) {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("deployment interrupted: %w", ctx.Err())
+		} else if !o.rollback {
+			return result, err
+		}
+		waitBuilds(builds)
+		o.removeCreated(context.WithoutCancel(ctx), prior, projectState, statePath)
+		return result, err
+	}
+
+	// Deploy services in dependency order, up to o.parallel at a time, each
+	// as soon as its dependencies are deployed, its template is built and
+	// its networks and volumes exist
+	remaining := append([]string(nil), serviceOrder...)
+	deployed := make(map[string]bool, len(serviceOrder))
+
+	// statuses are those of the services deployed by this run, which
+	// service_healthy dependencies are checked against
+	statuses := make(map[string]string, len(serviceOrder))
+
+	// Services left out of the selection are not waited for
+	selected := make(map[string]bool, len(serviceOrder))
+	for _, name := range serviceOrder {
+		selected[name] = true
+	}
+	for name := range stack.Services {
+		if !selected[name] {
+			deployed[name] = true
+		}
+	}
+
+	// After the first failure no further service is started, but the ones
+	// already deploying are waited for and recorded
+	completions := make(chan serviceDeployment, len(serviceOrder))
+	running := 0
+	var failure error
+	interrupted := ctx.Done()
+	for len(remaining) > 0 || running > 0 {
+		if failure == nil && ctx.Err() != nil {
+			failure = fmt.Errorf("deployment interrupted: %w", ctx.Err())
+		}
+		next := -1
+		if failure == nil && running < o.parallel {
+			next = nextReady(stack, remaining, deployed, builds, resources)
+		}
+		if next < 0 {
+			if running == 0 && failure != nil {
+				break
+			}
+			if running == 0 {
+				select {
+				case <-finished:
+				case <-interrupted:
+					interrupted = nil
+				}
+				continue
+			}
+			select {
+			case <-finished:
+			case <-interrupted:
+				interrupted = nil
+			case deployment := <-completions:
+				running--
+				if err := o.finishDeployment(deployment, stack, projectState, statePath, result); err != nil && failure == nil {
+					failure = err
+				}
+				if deployment.result.Error == nil {
+					deployed[deployment.name] = true
+					statuses[deployment.name] = deployment.result.Status
+				}
+			}
+			continue
+		}
+		serviceName := remaining[next]
+		remaining = append(remaining[:next], remaining[next+1:]...)
+
 		service := stack.Services[serviceName]
-		serviceResult := o.deployService(serviceName, service, stack)
-		result.Services = append(result.Services, serviceResult)
+		if err := resourceError(serviceResources(stack, service, resources)); err != nil {
+			result.Services = append(result.Services, ServiceResult{Name: serviceName, Status: "failed", Error: err})
+			failure = fmt.Errorf("failed to deploy service %s: %w", serviceName, err)
+			continue
+		}
+		waits, err := o.healthyDependencies(service, stack, statuses, projectState)
+		if err != nil {
+			result.Services = append(result.Services, ServiceResult{Name: serviceName, Status: "failed", Error: err})
+			failure = fmt.Errorf("failed to deploy service %s: %w", serviceName, err)
+			continue
+		}
+
+		running++
+		go func(name string, service models.Service, serviceState *state.ProjectState) {
+			if err := o.waitForDependencies(ctx, waits); err != nil {
+				completions <- serviceDeployment{name: name, result: ServiceResult{Name: name, Status: "failed", Error: err}, state: serviceState}
+				return
+			}
+			completions <- o.deployWithState(ctx, name, service, stack, serviceState)
+		}(serviceName, service, projectState.Clone())
+	}
+	if failure != nil || ctx.Err() != nil {
+		return rollback(failure)
+	}
 
-		if serviceResult.Error != nil {
-			return result, fmt.Errorf("failed to deploy service %s: %w", serviceName, serviceResult.Error)
+	// Resources no deployed service uses must exist too
+	for _, pending := range resources {
+		<-pending.done
+	}
+	if err := failedResource(resources); err != nil {
+		return rollback(err)
+	}
+
+	// Forward the host ports to the containers, wherever they ended up
+	if err := o.publishPorts(ctx, stack, projectState); err != nil {
+		return rollback(err)
+	}
+	if !o.dryRun {
+		if err := projectState.Save(statePath); err != nil {
+			return result, err
 		}
 	}
 
+	// Let services on the same networks reach each other by name
+	o.updateHosts(ctx, stack, projectState)
+
 	// Execute post-start hooks
 	if stack.Hooks != nil && len(stack.Hooks.PostStart) > 0 {
 		o.log("Executing post-start hooks")
-		if err := o.executeHooks(stack.Hooks.PostStart); err != nil {
+		if err := o.executeHooks(ctx, stack.Hooks.PostStart); err != nil {
 			o.logWarning("Post-start hooks failed: %v", err)
 		}
 	}
@@ -168,20 +655,77 @@ func (o *Orchestrator) Up(stackFile string) (*DeploymentResult, error) {
 	return result, nil
 }
 
-// Down stops and removes a multi-container application
-func (o *Orchestrator) Down(stackFile string, removeVolumes bool) error {
+// DownResult reports what a teardown stopped and removed. It is filled in
+// even when some resources fail to be removed.
+type DownResult struct {
+	Stopped         []string        `json:"stopped"`
+	ForceStopped    []string        `json:"force_stopped,omitempty"` // Did not shut down within the stop timeout
+	Removed         []string        `json:"removed"`
+	VolumesRemoved  []string        `json:"volumes_removed"`
+	NetworksRemoved []string        `json:"networks_removed"`
+	Errors          []TeardownError `json:"errors"`
+	Skipped         []string        `json:"skipped,omitempty"` // Not attempted after an error with StopOnError
+}
+
+// TeardownError records a resource that could not be stopped or removed
+type TeardownError struct {
+	Resource string `json:"resource"`
+	Error    string `json:"error"`
+}
+
+func (r *DownResult) addError(resource string, err error) {
+	r.Errors = append(r.Errors, TeardownError{Resource: resource, Error: err.Error()})
+}
+
+// Err combines the teardown errors into one error naming every resource
+// that failed, nil if there were none
+func (r *DownResult) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	lines := make([]string, len(r.Errors))
+	for i, teardownErr := range r.Errors {
+		lines[i] = fmt.Sprintf("%s: %s", teardownErr.Resource, teardownErr.Error)
+	}
+	message := fmt.Sprintf("stack stopped with %d error(s):\n  %s", len(r.Errors), strings.Join(lines, "\n  "))
+	if len(r.Skipped) > 0 {
+		message += fmt.Sprintf("\nnot attempted: %s", strings.Join(r.Skipped, ", "))
+	}
+	return errors.New(message)
+}
+
+// Down stops and removes a multi-container application. When ctx is done,
+// the running Proxmox command is interrupted and the remaining services are
+// skipped.
+func (o *Orchestrator) Down(ctx context.Context, stackFile string, removeVolumes bool) (*DownResult, error) {
+	result := &DownResult{
+		Stopped:         []string{},
+		Removed:         []string{},
+		VolumesRemoved:  []string{},
+		NetworksRemoved: []string{},
+		Errors:          []TeardownError{},
+	}
+
 	// Load stack configuration
-	stack, err := config.LoadLXCStack(stackFile)
+	stack, err := o.loadStack(stackFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stack: %w", err)
+	}
+	o.applyProxmoxSettings(stack)
+
+	statePath := state.Path(o.baseDir, o.projectName)
+	projectState, err := state.Load(statePath, o.projectName)
 	if err != nil {
-		return fmt.Errorf("failed to load stack: %w", err)
+		return nil, err
 	}
+	o.spreadNodes(stack, projectState)
 
 	o.log("Stopping stack: %s", o.getStackName(stack))
 
 	// Execute pre-stop hooks
 	if stack.Hooks != nil && len(stack.Hooks.PreStop) > 0 {
 		o.log("Executing pre-stop hooks")
-		if err := o.executeHooks(stack.Hooks.PreStop); err != nil {
+		if err := o.executeHooks(ctx, stack.Hooks.PreStop); err != nil {
 			o.logWarning("Pre-stop hooks failed: %v", err)
 		}
 	}
@@ -189,7 +733,7 @@ func (o *Orchestrator) Down(stackFile string, removeVolumes bool) error {
 	// Get service order (reverse for shutdown)
 	serviceOrder, err := stack.GetServiceDependencyOrder()
 	if err != nil {
-		return fmt.Errorf("failed to resolve service dependencies: %w", err)
+		return nil, fmt.Errorf("failed to resolve service dependencies: %w", err)
 	}
 
 	// Reverse the order for shutdown
@@ -200,114 +744,518 @@ func (o *Orchestrator) Down(stackFile string, removeVolumes bool) error {
 
 	o.log("Service shutdown order: %s", strings.Join(serviceOrder, " -> "))
 
-	// Stop and remove services
+	// Stop and remove services. Every resource is attempted unless
+	// StopOnError is set, in which case the rest are skipped after a failure.
+	stopped := false
+	var removed []string
 	for _, serviceName := range serviceOrder {
-		if err := o.removeService(serviceName); err != nil {
-			o.logWarning("Failed to remove service %s: %v", serviceName, err)
+		for _, key := range serviceStateKeys(stack, projectState, serviceName) {
+			if stopped || ctx.Err() != nil {
+				result.Skipped = append(result.Skipped, key)
+				continue
+			}
+			if err := o.removeService(ctx, key, projectState.Services[key].ContainerID, result); err != nil {
+				o.logWarning("Failed to remove service %s: %v", key, err)
+				result.addError(key, err)
+				stopped = o.stopOnError
+				continue
+			}
+			delete(projectState.Services, key)
+			removed = append(removed, key)
 		}
 	}
 
-	// Remove volumes if requested
-	if removeVolumes {
-		if err := o.removeVolumes(stack); err != nil {
-			o.logWarning("Failed to remove volumes: %v", err)
+	// Nothing is forwarded to the removed containers anymore
+	if err := o.unpublishPorts(ctx, projectState, removed); err != nil {
+		o.logWarning("%v", err)
+		result.addError("ports", err)
+	}
+
+	if !o.dryRun {
+		if err := projectState.Save(statePath); err != nil {
+			o.logWarning("Failed to save state: %v", err)
 		}
 	}
 
-	// Execute post-stop hooks
-	if stack.Hooks != nil && len(stack.Hooks.PostStop) > 0 {
+	if ctx.Err() != nil {
+		o.logWarning("Interrupted; %d resource(s) not attempted", len(result.Skipped))
+		return result, fmt.Errorf("teardown interrupted: %w", ctx.Err())
+	}
+
+	// Remove volumes if requested
+	if removeVolumes && stopped {
+		result.Skipped = append(result.Skipped, "volumes")
+	} else if removeVolumes {
+		o.removeVolumes(stack, result)
+	}
+
+	// Execute post-stop hooks, unless the stack was left partly running
+	if stack.Hooks != nil && len(stack.Hooks.PostStop) > 0 && !stopped {
 		o.log("Executing post-stop hooks")
-		if err := o.executeHooks(stack.Hooks.PostStop); err != nil {
+		if err := o.executeHooks(ctx, stack.Hooks.PostStop); err != nil {
 			o.logWarning("Post-stop hooks failed: %v", err)
 		}
 	}
 
-	o.logSuccess("Stack stopped successfully")
+	if stopped {
+		o.logWarning("Stopped at the first error; %d resource(s) not attempted", len(result.Skipped))
+	} else if len(result.Errors) > 0 {
+		o.logWarning("Stack stopped with %d error(s)", len(result.Errors))
+	} else {
+		o.logSuccess("Stack stopped successfully")
+	}
+	return result, nil
+}
+
+// validateSelection checks the service selection and health options of Up
+// against the stack and each other
+func (o *Orchestrator) validateSelection(stack *models.LXCStack) error {
+	for _, name := range o.services {
+		if _, exists := stack.Services[name]; !exists {
+			return fmt.Errorf("service '%s' is not defined in the stack", name)
+		}
+	}
+	if o.noDeps && len(o.services) == 0 {
+		return fmt.Errorf("--no-deps requires the services to deploy")
+	}
+	if o.waitFor != "" && len(o.services) > 0 {
+		selected := stack.SelectServices([]string{o.waitFor}, o.services, !o.noDeps)
+		if len(selected) == 0 {
+			return fmt.Errorf("wait-for service '%s' is not among the services being deployed", o.waitFor)
+		}
+	}
+	if o.ignoreHealth {
+		if o.waitFor != "" {
+			return fmt.Errorf("--ignore-health cannot be combined with --wait-for, which waits for a health check")
+		}
+		if o.renew {
+			return fmt.Errorf("--ignore-health cannot be combined with --renew, which needs health checks to replace containers safely")
+		}
+	}
 	return nil
 }
 
-// deployService deploys a single service
-func (o *Orchestrator) deployService(name string, service models.Service, stack *models.LXCStack) ServiceResult {
+// serviceStateKeys returns the state entries of a service: the service name
+// itself and its replicas recorded as name-N
+func serviceStateKeys(stack *models.LXCStack, projectState *state.ProjectState, service string) []string {
+	var keys []string
+	for key := range projectState.Services {
+		if key == service {
+			keys = append(keys, key)
+			continue
+		}
+		suffix, found := strings.CutPrefix(key, service+"-")
+		if !found {
+			continue
+		}
+		if _, err := strconv.Atoi(suffix); err != nil {
+			continue
+		}
+		if _, other := stack.Services[key]; other {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// removeExcessReplicas stops and removes the recorded replicas of a service
+// above its scale, e.g. web-2 and web-3 after scaling web from 3 to 1.
+// Replicas 1 to scale are left alone.
+func (o *Orchestrator) removeExcessReplicas(ctx context.Context, stack *models.LXCStack, projectState *state.ProjectState, name string) ([]string, error) {
+	desired := max(stack.Services[name].Scale, 1)
+	teardown := &DownResult{}
+
+	var removed []string
+	for _, key := range serviceStateKeys(stack, projectState, name) {
+		if key == name {
+			continue
+		}
+		if replicaOf(name, key, stack.Services[name]).index <= desired {
+			continue
+		}
+		if err := o.removeService(ctx, key, projectState.Services[key].ContainerID, teardown); err != nil {
+			return removed, fmt.Errorf("failed to remove replica %s: %w", key, err)
+		}
+		delete(projectState.Services, key)
+		removed = append(removed, key)
+	}
+	return removed, nil
+}
+
+// serviceDeployment is the outcome of deploying a service in the background,
+// with the copy of the project state the deploy updated
+type serviceDeployment struct {
+	name    string
+	result  ServiceResult
+	removed []string
+	state   *state.ProjectState
+}
+
+// deployWithState deploys a service, or renews it, against its own copy of
+// the project state, and removes its replicas above its scale
+func (o *Orchestrator) deployWithState(ctx context.Context, name string, service models.Service, stack *models.LXCStack, projectState *state.ProjectState) serviceDeployment {
+	deployment := serviceDeployment{name: name}
+	if o.renew {
+		deployment.result = o.renewService(ctx, name, service, stack, projectState)
+	} else {
+		deployment.result = o.updateService(ctx, name, service, stack, projectState)
+	}
+	deployment.state = projectState
+
+	// Replicas left over from a larger scale are removed once the service
+	// itself is deployed
+	if deployment.result.Error == nil {
+		removed, err := o.removeExcessReplicas(ctx, stack, projectState, name)
+		deployment.removed = removed
+		if err != nil {
+			o.logWarning("%v", err)
+		}
+	}
+	return deployment
+}
+
+// finishDeployment records a service deployed in the background: its result
+// and its state entries, which are saved straight away, including for a
+// failed service, so a re-run resumes from here
+func (o *Orchestrator) finishDeployment(deployment serviceDeployment, stack *models.LXCStack, projectState *state.ProjectState, statePath string, result *DeploymentResult) error {
+	name := deployment.name
+	result.Services = append(result.Services, deployment.result)
+	result.RemovedReplicas = append(result.RemovedReplicas, deployment.removed...)
+
+	o.stateMu.Lock()
+	for _, key := range serviceStateKeys(stack, projectState, name) {
+		delete(projectState.Services, key)
+	}
+	for _, key := range serviceStateKeys(stack, deployment.state, name) {
+		projectState.Services[key] = deployment.state.Services[key]
+	}
+	o.stateMu.Unlock()
+
+	if !o.dryRun {
+		if err := projectState.Save(statePath); err != nil {
+			return err
+		}
+	}
+	if deployment.result.Error != nil {
+		return fmt.Errorf("failed to deploy service %s: %w", name, deployment.result.Error)
+	}
+	return nil
+}
+
+// updateReplica brings a service replica in line with the stack: new or
+// changed services get a new container, config-only changes are pushed into
+// the running container, and unchanged services are left as they are if
+// they are running and healthy. This lets a failed up be re-run: replicas
+// that were already deployed are skipped and the rest are (re)attempted.
+func (o *Orchestrator) updateReplica(ctx context.Context, r replica, service models.Service, stack *models.LXCStack, projectState *state.ProjectState) ServiceResult {
+	digest, filesDigest, err := o.serviceDigests(r.service, service, stack)
+	if err != nil {
+		return ServiceResult{Name: r.label, Error: err}
+	}
+
+	previous, deployed := projectState.Services[r.key]
+	var container *proxmox.ContainerInfo
+	if deployed {
+		if container, err = o.client.GetContainer(ctx, previous.ContainerID); err != nil {
+			deployed = false
+		}
+	}
+
+	action := planUpdate(previous, deployed, digest, filesDigest)
+	if deployed && o.recreate[r.service] {
+		action = actionRecreate
+	}
+	if action == actionNone {
+		result, ready := o.resumeService(ctx, r, service, stack, previous.ContainerID, container.Status)
+		if ready {
+			return result
+		}
+		action = actionRecreate
+	}
+
+	var result ServiceResult
+	switch action {
+	case actionReload:
+		result = ServiceResult{Name: r.label, ContainerID: previous.ContainerID, Status: "reloaded", Ports: replicaPorts(r, service)}
+		if err := o.reloadService(ctx, r, previous.ContainerID, service, stack); err != nil {
+			result.Error = fmt.Errorf("failed to reload service: %w", err)
+			return result
+		}
+	case actionRecreate:
+		o.log("Recreating service %s (container %d)", r.label, previous.ContainerID)
+		_ = o.client.StopContainer(ctx, previous.ContainerID)
+		if err := o.client.DestroyContainer(ctx, previous.ContainerID); err != nil {
+			return ServiceResult{Name: r.label, Error: fmt.Errorf("failed to remove old container: %w", err)}
+		}
+		result = o.deployNewService(ctx, r, service, stack, projectState)
+	default:
+		result = o.deployNewService(ctx, r, service, stack, projectState)
+	}
+
+	switch {
+	case result.Error == nil:
+		projectState.Services[r.key] = state.ServiceState{
+			ContainerID: result.ContainerID,
+			Digest:      digest,
+			FilesDigest: filesDigest,
+			UpdatedAt:   time.Now(),
+			Node:        o.recordedNode(result.ContainerID),
+		}
+	case result.ContainerID != 0:
+		// Record the half-deployed container without a digest so the next
+		// up replaces it instead of colliding with it
+		projectState.Services[r.key] = state.ServiceState{
+			ContainerID: result.ContainerID,
+			UpdatedAt:   time.Now(),
+			Node:        o.recordedNode(result.ContainerID),
+		}
+	}
+
+	return result
+}
+
+// resumeService checks an unchanged replica's container. A running
+// container that passes its health check is left alone; a stopped one is
+// started. It returns false if the replica must be recreated.
+func (o *Orchestrator) resumeService(ctx context.Context, r replica, service models.Service, stack *models.LXCStack, containerID int, status string) (ServiceResult, bool) {
+	name := r.label
+	result := ServiceResult{Name: name, ContainerID: containerID, Status: "up-to-date", Ports: replicaPorts(r, service)}
+	health := o.serviceHealth(r.service, service)
+
+	if status != "running" {
+		o.log("Service %s is %s, starting container %d", name, status, containerID)
+		if err := o.client.StartContainer(ctx, containerID); err != nil {
+			o.logWarning("Failed to start container %d: %v", containerID, err)
+			return result, false
+		}
+		if err := o.restoreSecrets(ctx, containerID, service, stack); err != nil {
+			o.logWarning("Failed to push secrets of service %s: %v", name, err)
+			return result, false
+		}
+		result.Status = "started"
+		if health != nil && !o.ignoreHealth {
+			if err := o.healthCheck(ctx, containerID, health); err != nil {
+				o.logWarning("Service %s is unhealthy after start: %v", name, err)
+				return result, false
+			}
+		}
+		o.logSuccess("Service %s started (container %d)", name, containerID)
+		return result, true
+	}
+
+	if health != nil {
+		if err := o.probeHealth(ctx, containerID, health); err != nil {
+			o.logWarning("Service %s is unhealthy: %v", name, err)
+			return result, false
+		}
+	}
+
+	o.log("Service %s is up to date (container %d)", name, containerID)
+	return result, true
+}
+
+// deployNewService deploys a service replica in a new container, with the
+// ID recorded for it if that is free or else a free one
+func (o *Orchestrator) deployNewService(ctx context.Context, r replica, service models.Service, stack *models.LXCStack, projectState *state.ProjectState) ServiceResult {
+	containerID, err := o.allocateContainerID(ctx, r.key, projectState)
+	if err != nil {
+		return ServiceResult{Name: r.label, Error: err}
+	}
+	return o.deployService(ctx, r, containerID, service, stack)
+}
+
+// deployService deploys a single service replica in container containerID
+func (o *Orchestrator) deployService(ctx context.Context, r replica, containerID int, service models.Service, stack *models.LXCStack) ServiceResult {
+	name := r.service
 	result := ServiceResult{
-		Name: name,
+		Name:  r.label,
+		Ports: replicaPorts(r, service),
 	}
 
-	o.log("Deploying service: %s", name)
+	o.log("Deploying service: %s", r.label)
 
 	// Build or get template
-	templateName, err := o.ensureTemplate(name, service)
+	templateName, err := o.ensureTemplate(ctx, name, service)
 	if err != nil {
 		result.Error = err
 		return result
 	}
 
-	// Generate container ID
-	containerID, err := o.generateContainerID(name)
+	// Only a container that is still there is recorded, so a failed launch
+	// that was rolled back does not collide with the next attempt
+	var exists bool
+	result.StartTime, exists, err = o.launchContainer(ctx, r, containerID, templateName, service, stack)
+	if exists {
+		result.ContainerID = containerID
+	}
 	if err != nil {
 		result.Error = err
 		return result
 	}
-	result.ContainerID = containerID
+
+	result.Status = "running"
+
+	// Wait for health check if defined. With a wait-for target only that
+	// service gates the deployment; the rest are left starting, as are all
+	// services with --ignore-health. A service that fails its check is
+	// left unhealthy, which holds back services that need it healthy.
+	health := o.serviceHealth(name, service)
+	switch {
+	case o.ignoreHealth || (o.waitFor != "" && o.waitFor != name):
+		if health != nil {
+			result.Status = "starting"
+		}
+	case o.waitFor == name:
+		if health != nil {
+			if err := o.healthCheck(ctx, containerID, health); err != nil {
+				result.Error = fmt.Errorf("service did not become healthy: %w", err)
+				return result
+			}
+			o.logSuccess("Service %s is healthy", name)
+		}
+	case health != nil:
+		if err := o.healthCheck(ctx, containerID, health); err != nil {
+			o.logWarning("Health check failed for service %s: %v", r.label, err)
+			result.Status = "unhealthy"
+		}
+	}
+
+	o.logSuccess("Service %s deployed successfully (container %d)", r.label, containerID)
+
+	return result
+}
+
+// launchContainer creates, configures and starts a service container from
+// templateName and pushes its configs and secrets. It returns how long the
+// start took and whether the container exists: when a step after creating
+// it fails, the container is stopped and destroyed again, and only remains
+// if that fails too.
+func (o *Orchestrator) launchContainer(ctx context.Context, r replica, containerID int, templateName string, service models.Service, stack *models.LXCStack) (time.Duration, bool, error) {
+	name := r.label
 
 	// Create container configuration
 	containerConfig := o.buildContainerConfig(service, stack)
-	containerConfig.Hostname = o.getContainerHostname(name, service)
+	containerConfig.Hostname = o.getContainerHostname(r, service)
 
-	// Create container
-	if err := o.client.CreateContainer(containerID, templateName, containerConfig); err != nil {
-		result.Error = fmt.Errorf("failed to create container: %w", err)
-		return result
+	// Create container on the service's node, with the template there
+	if err := o.nodeTemplate(ctx, templateName, service); err != nil {
+		return 0, false, err
+	}
+	o.placeContainer(containerID, service)
+	o.recordCreated(containerID)
+	if err := o.client.CreateContainer(ctx, containerID, templateName, containerConfig); err != nil {
+		return 0, false, fmt.Errorf("failed to create container: %w", err)
 	}
 
 	// Configure container (set additional properties)
 	if err := o.configureContainer(containerID, service); err != nil {
-		result.Error = fmt.Errorf("failed to configure container: %w", err)
-		return result
+		return 0, o.rollbackContainer(ctx, name, containerID, false), fmt.Errorf("failed to configure container: %w", err)
 	}
 
 	// Start container
 	startTime := time.Now()
-	if err := o.client.StartContainer(containerID); err != nil {
-		result.Error = fmt.Errorf("failed to start container: %w", err)
-		return result
+	if err := o.startWithBackoff(ctx, name, containerID, service); err != nil {
+		return 0, o.rollbackContainer(ctx, name, containerID, false), fmt.Errorf("failed to start container: %w", err)
 	}
-	result.StartTime = time.Since(startTime)
+	startDuration := time.Since(startTime)
 
-	// Wait for health check if defined
-	if service.Health != nil {
-		if err := o.waitForHealthCheck(containerID, service.Health); err != nil {
-			o.logWarning("Health check failed for service %s: %v", name, err)
-		}
+	// Push configs and secrets
+	if err := o.pushServiceFiles(ctx, r.service, containerID, service, stack); err != nil {
+		return startDuration, o.rollbackContainer(ctx, name, containerID, true), err
 	}
 
-	result.Status = "running"
-	o.logSuccess("Service %s deployed successfully (container %d)", name, containerID)
+	return startDuration, true, nil
+}
 
-	return result
+// rollbackContainer destroys a container whose launch failed, stopping it
+// first if it was started. It reports whether the container is left behind.
+func (o *Orchestrator) rollbackContainer(ctx context.Context, name string, containerID int, started bool) bool {
+	o.log("Removing container %d of service %s after failed launch", containerID, name)
+	if started {
+		_ = o.client.StopContainer(ctx, containerID)
+	}
+	if err := o.client.DestroyContainer(ctx, containerID); err != nil {
+		o.logWarning("Failed to remove container %d of service %s: %v", containerID, name, err)
+		return true
+	}
+	return false
+}
+
+// recordCreated records a container the current Up creates
+func (o *Orchestrator) recordCreated(containerID int) {
+	o.createdMu.Lock()
+	defer o.createdMu.Unlock()
+	o.created = append(o.created, containerID)
+}
+
+// removeCreated stops and destroys the containers the current Up created,
+// newest first, and records their services as they were before it: with
+// their previous container if that is still there, and otherwise not at all
+func (o *Orchestrator) removeCreated(ctx context.Context, prior, projectState *state.ProjectState, statePath string) {
+	if o.dryRun {
+		return
+	}
+
+	removed := make(map[int]bool, len(o.created))
+	for i := len(o.created) - 1; i >= 0; i-- {
+		containerID := o.created[i]
+		if _, err := o.client.GetContainer(ctx, containerID); errors.Is(err, proxmox.ErrContainerNotFound) {
+			removed[containerID] = true
+			continue
+		}
+		o.log("Rolling back container %d created by this deployment", containerID)
+		_ = o.client.StopContainer(ctx, containerID)
+		if err := o.client.DestroyContainer(ctx, containerID); err != nil {
+			o.logWarning("Failed to remove container %d: %v", containerID, err)
+			continue
+		}
+		removed[containerID] = true
+	}
+
+	for key, recorded := range projectState.Services {
+		if !removed[recorded.ContainerID] {
+			continue
+		}
+		previous, existed := prior.Services[key]
+		if existed && previous.ContainerID != recorded.ContainerID {
+			if _, err := o.client.GetContainer(ctx, previous.ContainerID); err == nil {
+				projectState.Services[key] = previous
+				continue
+			}
+		}
+		delete(projectState.Services, key)
+	}
+	if err := projectState.Save(statePath); err != nil {
+		o.logWarning("Failed to save state: %v", err)
+	}
 }
 
 // ensureTemplate builds or retrieves the template for a service
-func (o *Orchestrator) ensureTemplate(serviceName string, service models.Service) (string, error) {
+func (o *Orchestrator) ensureTemplate(ctx context.Context, serviceName string, service models.Service) (string, error) {
 	if service.Template != "" {
 		// Use existing template
 		return service.Template, nil
 	}
 
+	if pending, ok := o.builds[serviceName]; ok {
+		<-pending.done
+		return pending.template, pending.err
+	}
+
 	buildConfig := service.GetBuildConfig()
 	if buildConfig == nil {
 		return "", fmt.Errorf("service %s must specify either 'template' or 'build'", serviceName)
 	}
+	return o.build(ctx, serviceName, buildConfig)
+}
 
-	// Build template from LXCfile
-	lxcfilePath := filepath.Join(buildConfig.Context, buildConfig.Dockerfile)
-	if buildConfig.Dockerfile == "" {
-		lxcfilePath = filepath.Join(buildConfig.Context, "LXCfile.yml")
-	}
-
-	// Load LXCfile
-	lxcfile, err := config.LoadLXCfile(lxcfilePath)
+// buildTemplate builds a service's template from its LXCfile
+func (o *Orchestrator) buildTemplate(ctx context.Context, serviceName string, buildConfig *models.BuildConfig) (string, error) {
+	lxcfile, err := o.loadLXCfile(serviceName, buildConfig)
 	if err != nil {
-		return "", fmt.Errorf("failed to load LXCfile for service %s: %w", serviceName, err)
+		return "", err
 	}
 
 	// Generate template name
@@ -316,7 +1264,11 @@ func (o *Orchestrator) ensureTemplate(serviceName string, service models.Service
 	// Build template
 	o.log("Building template for service %s", serviceName)
 	buildStart := time.Now()
-	result, err := o.builder.BuildTemplate(lxcfile, templateName, buildConfig.Args)
+	buildArgs := mergeBuildArgs(buildConfig.Args, o.buildArgs, o.serviceArgs[serviceName])
+	result, err := o.builder.BuildTemplateWithCache(ctx, lxcfile, templateName, buildArgs, builder.CacheOptions{
+		From: buildConfig.CacheFrom,
+		To:   buildConfig.CacheTo,
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to build template for service %s: %w", serviceName, err)
 	}
@@ -326,27 +1278,57 @@ func (o *Orchestrator) ensureTemplate(serviceName string, service models.Service
 	return result.TemplatePath, nil
 }
 
-// generateContainerID generates a unique container ID for a service
-func (o *Orchestrator) generateContainerID(serviceName string) (int, error) {
-	// Use a hash-based approach for consistent IDs
-	// In production, we might want to track these in a state file
-	baseID := 200 // Start from 200 to avoid conflicts with manual containers
+// loadLXCfile loads a service's LXCfile, selects the stage named by
+// build.target, and applies any base template override: --build-from, then
+// build.from in the stack file
+func (o *Orchestrator) loadLXCfile(serviceName string, buildConfig *models.BuildConfig) (*models.LXCfile, error) {
+	lxcfilePath := filepath.Join(buildConfig.Context, buildConfig.Dockerfile)
+	if buildConfig.Dockerfile == "" {
+		lxcfilePath = filepath.Join(buildConfig.Context, "LXCfile.yml")
+	}
+
+	lxcfile, err := config.LoadLXCfile(lxcfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load LXCfile for service %s: %w", serviceName, err)
+	}
+	if lxcfile, err = lxcfile.ForTarget(buildConfig.Target); err != nil {
+		return nil, fmt.Errorf("service %s: %w", serviceName, err)
+	}
+
+	from := o.buildFrom
+	if from == "" {
+		from = buildConfig.From
+	}
+	if from == "" {
+		return lxcfile, nil
+	}
 
-	// Simple hash of project name + service name
-	hash := 0
-	for _, char := range o.projectName + serviceName {
-		hash = (hash*31 + int(char)) % 1000
+	resolved, err := o.builder.ResolveBaseTemplate(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base template override for service %s: %w", serviceName, err)
 	}
+	o.log("Building %s from %s instead of %s", serviceName, resolved, lxcfile.From)
+	return builder.WithBaseTemplate(lxcfile, resolved), nil
+}
 
-	return baseID + hash, nil
+// mergeBuildArgs layers build args; later layers override earlier ones
+func mergeBuildArgs(layers ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, layer := range layers {
+		for key, value := range layer {
+			merged[key] = value
+		}
+	}
+	return merged
 }
 
 // buildContainerConfig creates container configuration from service definition
 func (o *Orchestrator) buildContainerConfig(service models.Service, stack *models.LXCStack) *proxmox.ContainerConfig {
 	config := &proxmox.ContainerConfig{
 		Environment: make(map[string]string),
-		MountPoints: make(map[string]string),
+		MountPoints: o.serviceMountPoints(service, stack),
 		Storage:     o.storage, // Set storage from orchestrator config
+		Tags:        []string{"pxc", projectTag(o.projectName)},
 	}
 
 	// Apply resource limits
@@ -375,14 +1357,56 @@ func (o *Orchestrator) buildContainerConfig(service models.Service, stack *model
 		config.Environment[key] = value
 	}
 
-	// Override with stack-specific storage if set
-	if stack.Settings != nil && stack.Settings.Proxmox != nil && stack.Settings.Proxmox.Storage != "" {
-		config.Storage = stack.Settings.Proxmox.Storage
+	// Attach the service's networks, the first one as the primary interface
+	if interfaces := serviceInterfaces(service, stack, o.projectName); len(interfaces) > 0 {
+		config.Net0 = interfaces[0]
+		config.Nets = interfaces[1:]
 	}
 
+	// Templates from Proxmox are named after their distribution; built
+	// templates are cloned and keep the ostype of their build container
+	// unless the service sets one
+	config.OSType = models.ResolveOSType(service.OSType, service.Template)
+
+	// Override the resolver settings inherited from the host
+	config.DNS = service.DNS
+	config.DNSSearch = service.DNSSearch
+
+	config.LXC = o.namespaceConfig(service)
+
 	return config
 }
 
+// namespaceConfig returns the raw LXC settings for a service's pid and
+// shm_size options. The stack has been validated, so both are well formed.
+func (o *Orchestrator) namespaceConfig(service models.Service) []string {
+	var lines []string
+
+	switch {
+	case service.Pid == "host":
+		lines = append(lines, "lxc.namespace.keep: pid")
+	case service.PidService() != "":
+		// Containers are named by VMID, and the shared service is deployed
+		// first, so its container is recorded
+		containerID := o.generateContainerID(service.PidService())
+		o.stateMu.Lock()
+		if o.state != nil {
+			if recorded, exists := o.state.Services[service.PidService()]; exists {
+				containerID = recorded.ContainerID
+			}
+		}
+		o.stateMu.Unlock()
+		lines = append(lines, fmt.Sprintf("lxc.namespace.share.pid: %d", containerID))
+	}
+
+	if service.ShmSize != "" {
+		size, _ := models.ParseShmSize(service.ShmSize)
+		lines = append(lines, fmt.Sprintf("lxc.mount.entry: tmpfs dev/shm tmpfs rw,nosuid,nodev,size=%d,create=dir 0 0", size))
+	}
+
+	return lines
+}
+
 // Additional helper methods would go here...
 
 func (o *Orchestrator) getStackName(stack *models.LXCStack) string {
@@ -392,65 +1416,156 @@ func (o *Orchestrator) getStackName(stack *models.LXCStack) string {
 	return o.projectName
 }
 
-func (o *Orchestrator) getContainerHostname(serviceName string, service models.Service) string {
-	if service.Hostname != "" {
-		return service.Hostname
+// getContainerHostname returns the hostname of a service replica: the
+// service's hostname, or project-service, with -N appended for replicas
+// after the first
+func (o *Orchestrator) getContainerHostname(r replica, service models.Service) string {
+	hostname := service.Hostname
+	if hostname == "" {
+		hostname = fmt.Sprintf("%s-%s", o.projectName, r.service)
+	}
+	if r.index > 1 {
+		hostname = fmt.Sprintf("%s-%d", hostname, r.index)
 	}
-	return fmt.Sprintf("%s-%s", o.projectName, serviceName)
+	return hostname
 }
 
 // Placeholder implementations for remaining methods
-func (o *Orchestrator) createNetworks(stack *models.LXCStack, result *DeploymentResult) error {
-	// TODO: Implement network creation
-	if o.verbose {
-		o.log("Creating networks (placeholder)")
-	}
+func (o *Orchestrator) configureContainer(containerID int, service models.Service) error {
+	// TODO: Implement additional container configuration
 	return nil
 }
 
-func (o *Orchestrator) createVolumes(stack *models.LXCStack, result *DeploymentResult) error {
-	// TODO: Implement volume creation
-	if o.verbose {
-		o.log("Creating volumes (placeholder)")
+// executeHooks runs hook commands on the host, from the stack's directory
+func (o *Orchestrator) executeHooks(ctx context.Context, hooks []string) error {
+	for _, hook := range hooks {
+		if o.dryRun {
+			o.log("DRY RUN: Would execute hook: %s", hook)
+			continue
+		}
+
+		o.logDebug("Executing hook: %s", hook)
+
+		cmd := proxmox.CommandContext(ctx, "sh", "-c", hook)
+		cmd.Dir = o.baseDir
+		cmd.Stdout = o.out
+		cmd.Stderr = o.out
+		if err := proxmox.RunCommand(cmd); err != nil {
+			return fmt.Errorf("hook %q failed: %w", hook, err)
+		}
 	}
 	return nil
 }
 
-func (o *Orchestrator) configureContainer(containerID int, service models.Service) error {
-	// TODO: Implement additional container configuration
-	return nil
-}
+// executeInitHooks runs the init hooks, either on the host or inside an
+// ephemeral container created from hooks.init_template and destroyed afterwards
+func (o *Orchestrator) executeInitHooks(ctx context.Context, stack *models.LXCStack) error {
+	if stack.Hooks.InitTemplate == "" {
+		return o.executeHooks(ctx, stack.Hooks.Init)
+	}
 
-func (o *Orchestrator) waitForHealthCheck(containerID int, health *models.HealthCheck) error {
-	// TODO: Implement health check waiting
-	return nil
-}
+	containerID, err := o.freeContainerID(ctx, "init", nil)
+	if err != nil {
+		return err
+	}
+
+	o.log("Creating init container %d from template: %s", containerID, stack.Hooks.InitTemplate)
+
+	containerConfig := o.buildContainerConfig(models.Service{}, stack)
+	containerConfig.Hostname = fmt.Sprintf("%s-init", o.projectName)
+
+	if err := o.client.CreateContainer(ctx, containerID, stack.Hooks.InitTemplate, containerConfig); err != nil {
+		return fmt.Errorf("failed to create init container: %w", err)
+	}
+	defer func() {
+		_ = o.client.StopContainer(ctx, containerID)
+		if err := o.client.DestroyContainer(ctx, containerID); err != nil {
+			o.logWarning("Failed to remove init container %d: %v", containerID, err)
+		}
+	}()
+
+	if err := o.client.StartContainer(ctx, containerID); err != nil {
+		return fmt.Errorf("failed to start init container: %w", err)
+	}
+
+	for _, hook := range stack.Hooks.Init {
+		o.logDebug("Executing init hook in container %d: %s", containerID, hook)
+		if err := o.client.ExecCommand(ctx, containerID, []string{"sh", "-c", hook}); err != nil {
+			return fmt.Errorf("hook %q failed: %w", hook, err)
+		}
+	}
 
-func (o *Orchestrator) executeHooks(hooks []string) error {
-	// TODO: Implement hook execution
 	return nil
 }
 
-func (o *Orchestrator) removeService(serviceName string) error {
-	// TODO: Implement service removal
-	o.log("Removing service: %s", serviceName)
+// removeService stops and destroys a service container, recording each
+// completed action in result. A container that is already stopped is only
+// destroyed, and one that no longer exists counts as removed, except in a
+// dry run, which only reports what it would stop and remove.
+func (o *Orchestrator) removeService(ctx context.Context, serviceName string, containerID int, result *DownResult) error {
+	o.log("Removing service: %s (container %d)", serviceName, containerID)
+
+	info, err := o.client.GetContainer(ctx, containerID)
+	if errors.Is(err, proxmox.ErrContainerNotFound) {
+		o.log("Container %d of service %s is already gone", containerID, serviceName)
+		if !o.dryRun {
+			result.Removed = append(result.Removed, serviceName)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get container %d: %w", containerID, err)
+	}
+
+	if info.Status != "stopped" {
+		forced, err := o.stopContainer(ctx, containerID)
+		if err != nil {
+			return fmt.Errorf("failed to stop container %d: %w", containerID, err)
+		}
+		if forced {
+			result.ForceStopped = append(result.ForceStopped, serviceName)
+		}
+		result.Stopped = append(result.Stopped, serviceName)
+	}
+
+	if err := o.client.DestroyContainer(ctx, containerID); err != nil {
+		return fmt.Errorf("failed to destroy container %d: %w", containerID, err)
+	}
+	result.Removed = append(result.Removed, serviceName)
+
 	return nil
 }
 
-func (o *Orchestrator) removeVolumes(stack *models.LXCStack) error {
-	// TODO: Implement volume removal
-	return nil
+// stopContainer stops a container, giving it the stop timeout to shut down
+// cleanly when one is set. If the shutdown fails, e.g. because the container
+// hangs past the timeout, it is stopped forcibly and forced is set. Without
+// a timeout the container is stopped at once, which does not count as
+// forced.
+func (o *Orchestrator) stopContainer(ctx context.Context, containerID int) (forced bool, err error) {
+	if o.stopTimeout <= 0 {
+		return false, o.client.StopContainer(ctx, containerID)
+	}
+	shutdownErr := o.client.ShutdownContainer(ctx, containerID, o.stopTimeout)
+	if shutdownErr == nil {
+		return false, nil
+	}
+	o.logWarning("Container %d did not shut down within %v, stopping it forcibly: %v", containerID, o.stopTimeout, shutdownErr)
+	return true, o.client.StopContainer(ctx, containerID)
 }
 
 // Logging functions
 func (o *Orchestrator) log(format string, args ...interface{}) {
-	fmt.Printf(color.BlueString("ℹ ")+format+"\n", args...)
+	o.logger.Logf(output.Info, format, args...)
+}
+
+func (o *Orchestrator) logDebug(format string, args ...interface{}) {
+	o.logger.Logf(output.Debug, format, args...)
 }
 
 func (o *Orchestrator) logSuccess(format string, args ...interface{}) {
-	fmt.Printf(color.GreenString("✓ ")+format+"\n", args...)
+	o.logger.Logf(output.Success, format, args...)
 }
 
 func (o *Orchestrator) logWarning(format string, args ...interface{}) {
-	fmt.Printf(color.YellowString("⚠ ")+format+"\n", args...)
+	o.logger.Logf(output.Warning, format, args...)
 }
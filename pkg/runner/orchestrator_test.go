@@ -0,0 +1,1494 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// writeStack writes a stack file into a temporary directory and returns its path
+func writeStack(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "lxc-stack.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+	return path
+}
+
+func TestUpInitHookOrdering(t *testing.T) {
+	tests := []struct {
+		name      string
+		hooks     string
+		initEntry string
+	}{
+		{
+			name: "host init hooks",
+			hooks: `hooks:
+  init:
+    - "./migrate.sh"`,
+			initEntry: "Would execute hook: ./migrate.sh",
+		},
+		{
+			name: "ephemeral container init hooks",
+			hooks: `hooks:
+  init_template: "local:vztmpl/alpine.tar.zst"
+  init:
+    - "./migrate.sh"`,
+			initEntry: "Creating init container",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    volumes:
+      - "db-data:/var/lib/postgresql/data"
+volumes:
+  db-data:
+    driver: "local"
+`+tt.hooks)
+
+			var out bytes.Buffer
+			orchestrator := New(&Config{
+				Verbose:     true,
+				DryRun:      true,
+				ProjectName: "hooks",
+				Output:      &out,
+			})
+
+			if _, err := orchestrator.Up(context.Background(), stackPath); err != nil {
+				t.Fatalf("Up() unexpected error: %v", err)
+			}
+
+			output := out.String()
+			volumeIdx := strings.Index(output, "Creating volume db-data")
+			initIdx := strings.Index(output, tt.initEntry)
+			deployIdx := strings.Index(output, "Deploying service: database")
+
+			if volumeIdx < 0 || initIdx < 0 || deployIdx < 0 {
+				t.Fatalf("Expected volume, init and deploy phases in output, got:\n%s", output)
+			}
+			if volumeIdx > initIdx {
+				t.Errorf("init hooks ran before volume creation:\n%s", output)
+			}
+			if initIdx > deployIdx {
+				t.Errorf("init hooks ran after service deploy started:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestUpWithoutInitHooks(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"`)
+
+	var out bytes.Buffer
+	orchestrator := New(&Config{DryRun: true, Output: &out})
+
+	if _, err := orchestrator.Up(context.Background(), stackPath); err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "init hooks") {
+		t.Errorf("Expected no init phase without init hooks, got:\n%s", out.String())
+	}
+}
+
+func TestUpWaitFor(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - api
+    health:
+      test: "curl -f http://localhost/"
+  api:
+    template: "node:18"
+    depends_on:
+      - database
+    health:
+      test: "curl -f http://localhost:3000/health"
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+  cache:
+    template: "redis:7"
+    health:
+      test: "redis-cli ping"
+`)
+
+	var out bytes.Buffer
+	orchestrator := New(&Config{
+		DryRun:      true,
+		ProjectName: "waitfor",
+		WaitFor:     "database",
+		Output:      &out,
+	})
+
+	var checked int
+	orchestrator.healthCheck = func(_ context.Context, containerID int, health *models.HealthCheck) error {
+		checked++
+		if health.Test != "pg_isready" {
+			t.Errorf("health check waited on non-target service: %s", health.Test)
+		}
+		return nil
+	}
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+
+	if checked != 1 {
+		t.Errorf("Expected 1 health check wait, got %d", checked)
+	}
+
+	if len(result.Services) == 0 || result.Services[0].Name != "database" {
+		t.Fatalf("Expected database to be deployed first, got %+v", result.Services)
+	}
+
+	for _, service := range result.Services {
+		want := "starting"
+		if service.Name == "database" {
+			want = "running"
+		}
+		if service.Status != want {
+			t.Errorf("Service %s status = %q, want %q", service.Name, service.Status, want)
+		}
+	}
+
+	if !strings.Contains(out.String(), "Service database is healthy") {
+		t.Errorf("Expected healthy notice in output, got:\n%s", out.String())
+	}
+}
+
+func TestUpWaitForWithoutHealthCheck(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  cache:
+    template: "redis:7"
+`)
+
+	var out bytes.Buffer
+	orchestrator := New(&Config{DryRun: true, ProjectName: "nohealth", WaitFor: "cache", Output: &out})
+	orchestrator.healthCheck = func(context.Context, int, *models.HealthCheck) error {
+		t.Error("health check waited on for a service without one")
+		return nil
+	}
+
+	if _, err := orchestrator.Up(context.Background(), stackPath); err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "is healthy") {
+		t.Errorf("output claims a health check passed:\n%s", out.String())
+	}
+}
+
+func TestUpWaitForErrors(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+`)
+
+	tests := []struct {
+		name     string
+		waitFor  string
+		health   error
+		errorMsg string
+	}{
+		{
+			name:     "undefined service",
+			waitFor:  "cache",
+			errorMsg: "wait-for service 'cache' is not defined in the stack",
+		},
+		{
+			name:     "service never healthy",
+			waitFor:  "database",
+			health:   errors.New("timed out"),
+			errorMsg: "failed to deploy service database: service did not become healthy: timed out",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orchestrator := New(&Config{
+				DryRun:  true,
+				WaitFor: tt.waitFor,
+				Output:  &bytes.Buffer{},
+			})
+			orchestrator.healthCheck = func(context.Context, int, *models.HealthCheck) error {
+				return tt.health
+			}
+
+			_, err := orchestrator.Up(context.Background(), stackPath)
+			if err == nil {
+				t.Fatal("Up() expected error, got nil")
+			}
+			if err.Error() != tt.errorMsg {
+				t.Errorf("Up() error = %q, want %q", err.Error(), tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestUpIgnoreHealth(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - database
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+`)
+
+	orchestrator := New(&Config{
+		DryRun:       true,
+		ProjectName:  "ignorehealth",
+		IgnoreHealth: true,
+		Output:       &bytes.Buffer{},
+	})
+	orchestrator.healthCheck = func(context.Context, int, *models.HealthCheck) error {
+		t.Error("health check waited on with --ignore-health")
+		return nil
+	}
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, service := range result.Services {
+		names = append(names, service.Name+"="+service.Status)
+	}
+	if got, want := strings.Join(names, " "), "database=starting web=running"; got != want {
+		t.Errorf("Up() services = %q, want %q", got, want)
+	}
+}
+
+func TestUpServiceSelection(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - api
+  api:
+    template: "node:18"
+    depends_on:
+      - database
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+  cache:
+    template: "redis:7"
+`)
+
+	tests := []struct {
+		name     string
+		services []string
+		noDeps   bool
+		want     string
+	}{
+		{
+			name:     "with dependencies",
+			services: []string{"api"},
+			want:     "database api",
+		},
+		{
+			name:     "no deps",
+			services: []string{"web"},
+			noDeps:   true,
+			want:     "web",
+		},
+		{
+			name:     "no deps keeps dependency order",
+			services: []string{"web", "database"},
+			noDeps:   true,
+			want:     "database web",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orchestrator := New(&Config{
+				DryRun:      true,
+				ProjectName: "selection",
+				Services:    tt.services,
+				NoDeps:      tt.noDeps,
+				Output:      &bytes.Buffer{},
+			})
+			orchestrator.healthCheck = func(context.Context, int, *models.HealthCheck) error { return nil }
+
+			result, err := orchestrator.Up(context.Background(), stackPath)
+			if err != nil {
+				t.Fatalf("Up() unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, service := range result.Services {
+				names = append(names, service.Name)
+			}
+			if got := strings.Join(names, " "); got != tt.want {
+				t.Errorf("Up() deployed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpServiceSelectionErrors(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - database
+  database:
+    template: "postgres:15"
+`)
+
+	tests := []struct {
+		name     string
+		config   Config
+		errorMsg string
+	}{
+		{
+			name:     "undefined service",
+			config:   Config{Services: []string{"cache"}},
+			errorMsg: "service 'cache' is not defined in the stack",
+		},
+		{
+			name:     "no deps without services",
+			config:   Config{NoDeps: true},
+			errorMsg: "--no-deps requires the services to deploy",
+		},
+		{
+			name:     "wait-for outside the selection",
+			config:   Config{Services: []string{"web"}, NoDeps: true, WaitFor: "database"},
+			errorMsg: "wait-for service 'database' is not among the services being deployed",
+		},
+		{
+			name:     "ignore health with wait-for",
+			config:   Config{IgnoreHealth: true, WaitFor: "database"},
+			errorMsg: "--ignore-health cannot be combined with --wait-for, which waits for a health check",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.DryRun = true
+			config.Output = &bytes.Buffer{}
+
+			_, err := New(&config).Up(context.Background(), stackPath)
+			if err == nil {
+				t.Fatal("Up() expected error, got nil")
+			}
+			if err.Error() != tt.errorMsg {
+				t.Errorf("Up() error = %q, want %q", err.Error(), tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestUpIncrementalConfigReload(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    configs:
+      - nginx_conf
+    secrets:
+      - tls_key
+    reload_signal: "SIGHUP"
+    environment:
+      MODE: "one"
+configs:
+  nginx_conf:
+    file: "./nginx.conf"
+    target: "/etc/nginx/nginx.conf"
+secrets:
+  tls_key:
+    file: "./tls.key"
+`)
+	baseDir := filepath.Dir(stackPath)
+	writeFile := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(baseDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	writeFile("nginx.conf", "worker_processes 1;")
+	writeFile("tls.key", "key-1")
+
+	client := newFakeClient()
+	up := func() *DeploymentResult {
+		t.Helper()
+		orchestrator := New(&Config{
+			ProjectName: "reload",
+			BaseDir:     baseDir,
+			Output:      &bytes.Buffer{},
+		})
+		orchestrator.client = client
+
+		client.reset()
+		result, err := orchestrator.Up(context.Background(), stackPath)
+		if err != nil {
+			t.Fatalf("Up() unexpected error: %v", err)
+		}
+		return result
+	}
+
+	result := up()
+	containerID := result.Services[0].ContainerID
+	expectCalls := func(step string, expected ...string) {
+		t.Helper()
+		if strings.Join(client.calls, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%s: calls =\n%s\nwant\n%s", step, strings.Join(client.calls, "\n"), strings.Join(expected, "\n"))
+		}
+	}
+	expectCalls("initial deploy",
+		fmt.Sprintf("create %d nginx:latest", containerID),
+		fmt.Sprintf("start %d", containerID),
+		fmt.Sprintf("exec %d mkdir -p /etc/nginx /run/secrets", containerID),
+		fmt.Sprintf("push %d /etc/nginx/nginx.conf", containerID),
+		fmt.Sprintf("push %d /run/secrets/tls_key", containerID),
+	)
+
+	// Nothing changed
+	result = up()
+	expectCalls("unchanged")
+	if result.Services[0].Status != "up-to-date" {
+		t.Errorf("unchanged status = %q, want %q", result.Services[0].Status, "up-to-date")
+	}
+
+	// Only the config file changed
+	writeFile("nginx.conf", "worker_processes 4;")
+	result = up()
+	expectCalls("config change",
+		fmt.Sprintf("exec %d mkdir -p /etc/nginx /run/secrets", containerID),
+		fmt.Sprintf("push %d /etc/nginx/nginx.conf", containerID),
+		fmt.Sprintf("push %d /run/secrets/tls_key", containerID),
+		fmt.Sprintf("exec %d kill -s HUP 1", containerID),
+	)
+	if result.Services[0].Status != "reloaded" {
+		t.Errorf("config change status = %q, want %q", result.Services[0].Status, "reloaded")
+	}
+
+	// The service definition changed
+	if err := os.WriteFile(stackPath, bytes.Replace(mustRead(t, stackPath), []byte(`MODE: "one"`), []byte(`MODE: "two"`), 1), 0644); err != nil {
+		t.Fatalf("Failed to update stack file: %v", err)
+	}
+	up()
+	expectCalls("definition change",
+		fmt.Sprintf("stop %d", containerID),
+		fmt.Sprintf("destroy %d", containerID),
+		fmt.Sprintf("create %d nginx:latest", containerID),
+		fmt.Sprintf("start %d", containerID),
+		fmt.Sprintf("exec %d mkdir -p /etc/nginx /run/secrets", containerID),
+		fmt.Sprintf("push %d /etc/nginx/nginx.conf", containerID),
+		fmt.Sprintf("push %d /run/secrets/tls_key", containerID),
+	)
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return data
+}
+
+func TestMergeBuildArgs(t *testing.T) {
+	stackArgs := map[string]string{"VERSION": "1.0", "NODE_ENV": "development", "PORT": "3000"}
+
+	tests := []struct {
+		name     string
+		global   map[string]string
+		scoped   map[string]string
+		expected map[string]string
+	}{
+		{
+			name:     "stack args only",
+			expected: map[string]string{"VERSION": "1.0", "NODE_ENV": "development", "PORT": "3000"},
+		},
+		{
+			name:     "global overrides stack",
+			global:   map[string]string{"NODE_ENV": "production", "COMMIT": "abc123"},
+			expected: map[string]string{"VERSION": "1.0", "NODE_ENV": "production", "PORT": "3000", "COMMIT": "abc123"},
+		},
+		{
+			name:     "scoped overrides stack",
+			scoped:   map[string]string{"VERSION": "2.0"},
+			expected: map[string]string{"VERSION": "2.0", "NODE_ENV": "development", "PORT": "3000"},
+		},
+		{
+			name:     "scoped wins over global",
+			global:   map[string]string{"VERSION": "1.5", "NODE_ENV": "production"},
+			scoped:   map[string]string{"VERSION": "2.0"},
+			expected: map[string]string{"VERSION": "2.0", "NODE_ENV": "production", "PORT": "3000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeBuildArgs(stackArgs, tt.global, tt.scoped)
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("mergeBuildArgs() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if stackArgs["VERSION"] != "1.0" {
+		t.Error("mergeBuildArgs() modified the stack args")
+	}
+}
+
+func TestUpBuildArgUndefinedService(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+`)
+
+	orchestrator := New(&Config{
+		DryRun:           true,
+		ServiceBuildArgs: map[string]map[string]string{"api": {"VERSION": "2.0"}},
+		Output:           &bytes.Buffer{},
+	})
+
+	_, err := orchestrator.Up(context.Background(), stackPath)
+	if err == nil || !strings.Contains(err.Error(), "build-arg references undefined service 'api'") {
+		t.Errorf("Up() error = %v, want undefined service error", err)
+	}
+}
+
+func TestDownResult(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 2
+    depends_on:
+      - database
+  database:
+    template: "postgres:15"
+`)
+	baseDir := filepath.Dir(stackPath)
+	statePath := state.Path(baseDir, "teardown")
+	projectState := &state.ProjectState{
+		Project: "teardown",
+		Services: map[string]state.ServiceState{
+			"web-1":    {ContainerID: 201},
+			"web-2":    {ContainerID: 202},
+			"database": {ContainerID: 203},
+		},
+	}
+	if err := projectState.Save(statePath); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	client := newFakeClient()
+	client.containers = map[int]bool{201: true, 202: true, 203: true}
+	client.fail = map[string]error{"stop 202": errors.New("timeout waiting for shutdown")}
+
+	orchestrator := New(&Config{ProjectName: "teardown", BaseDir: baseDir, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	result, err := orchestrator.Down(context.Background(), stackPath, false)
+	if err != nil {
+		t.Fatalf("Down() unexpected error: %v", err)
+	}
+
+	if got := strings.Join(result.Stopped, ","); got != "web-1,database" {
+		t.Errorf("Stopped = %q, want %q", got, "web-1,database")
+	}
+	if got := strings.Join(result.Removed, ","); got != "web-1,database" {
+		t.Errorf("Removed = %q, want %q", got, "web-1,database")
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("Errors = %+v, want one entry", result.Errors)
+	}
+	if result.Errors[0].Resource != "web-2" || !strings.Contains(result.Errors[0].Error, "timeout waiting for shutdown") {
+		t.Errorf("Errors[0] = %+v, want web-2 stop failure", result.Errors[0])
+	}
+
+	// The failed service stays in state so a later down can retry it
+	remaining, err := state.Load(statePath, "teardown")
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if _, ok := remaining.Services["web-2"]; !ok || len(remaining.Services) != 1 {
+		t.Errorf("state services = %v, want only web-2", remaining.Services)
+	}
+}
+
+func TestDownDryRunResult(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 2
+    depends_on:
+      - database
+  database:
+    template: "postgres:15"
+`)
+	baseDir := filepath.Dir(stackPath)
+	projectState := &state.ProjectState{
+		Project: "dryrun",
+		Services: map[string]state.ServiceState{
+			"web-1":    {ContainerID: 201},
+			"web-2":    {ContainerID: 202}, // Already gone
+			"database": {ContainerID: 203},
+		},
+	}
+	if err := projectState.Save(state.Path(baseDir, "dryrun")); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	client := newFakeClient()
+	client.containers = map[int]bool{201: true, 203: true}
+	client.stopped[203] = true
+
+	orchestrator := New(&Config{ProjectName: "dryrun", BaseDir: baseDir, DryRun: true, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	result, err := orchestrator.Down(context.Background(), stackPath, false)
+	if err != nil {
+		t.Fatalf("Down() unexpected error: %v", err)
+	}
+	if got := strings.Join(result.Stopped, ","); got != "web-1" {
+		t.Errorf("Stopped = %q, want only the running container", got)
+	}
+	if got := strings.Join(result.Removed, ","); got != "web-1,database" {
+		t.Errorf("Removed = %q, want only the containers that exist", got)
+	}
+}
+
+func TestDownKeepGoing(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 2
+    depends_on:
+      - database
+  database:
+    template: "postgres:15"
+`)
+	baseDir := filepath.Dir(stackPath)
+	projectState := &state.ProjectState{
+		Project: "keepgoing",
+		Services: map[string]state.ServiceState{
+			"web-1":    {ContainerID: 201},
+			"web-2":    {ContainerID: 202},
+			"database": {ContainerID: 203},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		stopOnError bool
+		wantCalls   []string
+		wantErrors  []string
+		wantSkipped []string
+	}{
+		{
+			name:       "every resource is attempted",
+			wantCalls:  []string{"stop 201", "stop 202", "destroy 202", "stop 203"},
+			wantErrors: []string{"web-1", "database"},
+		},
+		{
+			name:        "stop on first error",
+			stopOnError: true,
+			wantCalls:   []string{"stop 201"},
+			wantErrors:  []string{"web-1"},
+			wantSkipped: []string{"web-2", "database", "volumes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := projectState.Save(state.Path(baseDir, "keepgoing")); err != nil {
+				t.Fatalf("Failed to save state: %v", err)
+			}
+			client := newFakeClient()
+			client.containers = map[int]bool{201: true, 202: true, 203: true}
+			client.fail = map[string]error{
+				"stop 201": errors.New("timeout waiting for shutdown"),
+				"stop 203": errors.New("container is locked"),
+			}
+			orchestrator := New(&Config{ProjectName: "keepgoing", BaseDir: baseDir, StopOnError: tt.stopOnError, Output: &bytes.Buffer{}})
+			orchestrator.client = client
+
+			result, err := orchestrator.Down(context.Background(), stackPath, true)
+			if err != nil {
+				t.Fatalf("Down() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(client.calls, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", client.calls, tt.wantCalls)
+			}
+			var failed []string
+			for _, teardownErr := range result.Errors {
+				failed = append(failed, teardownErr.Resource)
+			}
+			if !reflect.DeepEqual(failed, tt.wantErrors) {
+				t.Errorf("failed resources = %q, want %q", failed, tt.wantErrors)
+			}
+			if !reflect.DeepEqual(result.Skipped, tt.wantSkipped) {
+				t.Errorf("Skipped = %q, want %q", result.Skipped, tt.wantSkipped)
+			}
+
+			combined := result.Err()
+			if combined == nil {
+				t.Fatal("Err() = nil, want the combined teardown error")
+			}
+			for _, resource := range tt.wantErrors {
+				if !strings.Contains(combined.Error(), resource+": ") {
+					t.Errorf("Err() = %q, want it to name %s", combined, resource)
+				}
+			}
+		})
+	}
+
+	if err := (&DownResult{}).Err(); err != nil {
+		t.Errorf("Err() = %v for a clean teardown, want nil", err)
+	}
+}
+
+func TestDownStopTimeout(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+`)
+	baseDir := filepath.Dir(stackPath)
+	projectState := &state.ProjectState{
+		Project:  "graceful",
+		Services: map[string]state.ServiceState{"database": {ContainerID: 210}},
+	}
+
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		missing  bool
+		stopped  bool
+		fail     map[string]error
+		expected []string
+		forced   bool
+	}{
+		{name: "timeout reaches the shutdown", timeout: 60 * time.Second, expected: []string{"shutdown 210 1m0s", "destroy 210"}},
+		{name: "zero timeout stops at once", expected: []string{"stop 210", "destroy 210"}},
+		{
+			name:     "failed shutdown falls back to stop",
+			timeout:  60 * time.Second,
+			fail:     map[string]error{"shutdown 210": errors.New("got timeout")},
+			expected: []string{"shutdown 210 1m0s", "stop 210", "destroy 210"},
+			forced:   true,
+		},
+		{name: "stopped container is only destroyed", timeout: 60 * time.Second, stopped: true, expected: []string{"destroy 210"}},
+		{name: "missing container is already removed", timeout: 60 * time.Second, missing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := projectState.Save(state.Path(baseDir, "graceful")); err != nil {
+				t.Fatalf("Failed to save state: %v", err)
+			}
+
+			client := newFakeClient()
+			client.containers[210] = !tt.missing
+			client.stopped[210] = tt.stopped
+			client.fail = tt.fail
+			orchestrator := New(&Config{ProjectName: "graceful", BaseDir: baseDir, StopTimeout: tt.timeout, Output: &bytes.Buffer{}})
+			orchestrator.client = client
+
+			result, err := orchestrator.Down(context.Background(), stackPath, false)
+			if err != nil {
+				t.Fatalf("Down() unexpected error: %v", err)
+			}
+			if len(result.Errors) > 0 {
+				t.Fatalf("Down() errors = %+v", result.Errors)
+			}
+			if strings.Join(client.calls, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("calls = %q, want %q", client.calls, tt.expected)
+			}
+			if strings.Join(result.Removed, ",") != "database" {
+				t.Errorf("Removed = %v, want [database]", result.Removed)
+			}
+			if forced := len(result.ForceStopped) > 0; forced != tt.forced {
+				t.Errorf("ForceStopped = %v, want forced %v", result.ForceStopped, tt.forced)
+			}
+			reloaded, err := state.Load(state.Path(baseDir, "graceful"), "graceful")
+			if err != nil {
+				t.Fatalf("state.Load() unexpected error: %v", err)
+			}
+			if _, recorded := reloaded.Services["database"]; recorded {
+				t.Errorf("database is still recorded after Down()")
+			}
+		})
+	}
+}
+
+func TestDeployServiceRollback(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(configPath, []byte("port=3000\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	stack := &models.LXCStack{
+		Version: "1.0",
+		Services: map[string]models.Service{
+			"api": {Template: "node:20", Configs: []string{"app"}},
+		},
+		Configs: map[string]models.Config{"app": {File: configPath, Target: "/etc/app.conf"}},
+	}
+
+	orchestrator := New(&Config{ProjectName: "rollback", BaseDir: dir, Output: &bytes.Buffer{}})
+	apiID := orchestrator.generateContainerID("api")
+
+	tests := []struct {
+		name       string
+		fail       []string
+		expected   []string
+		recordedID int
+	}{
+		{
+			name:     "start failure",
+			fail:     []string{"start"},
+			expected: []string{"create %d node:20", "start %d", "destroy %d"},
+		},
+		{
+			name:     "config push failure",
+			fail:     []string{"push"},
+			expected: []string{"create %d node:20", "start %d", "exec %d mkdir -p /etc", "push %d /etc/app.conf", "stop %d", "destroy %d"},
+		},
+		{
+			name:       "container kept when removal fails",
+			fail:       []string{"start", "destroy"},
+			expected:   []string{"create %d node:20", "start %d", "destroy %d"},
+			recordedID: apiID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeClient()
+			client.fail = map[string]error{}
+			for _, op := range tt.fail {
+				client.fail[fmt.Sprintf("%s %d", op, apiID)] = errors.New("injected failure")
+			}
+			orchestrator.client = client
+
+			result := orchestrator.deployService(context.Background(), newReplica("api", 1, stack.Services["api"]), apiID, stack.Services["api"], stack)
+			if result.Error == nil {
+				t.Fatal("deployService() expected error, got nil")
+			}
+			if result.ContainerID != tt.recordedID {
+				t.Errorf("ContainerID = %d, want %d", result.ContainerID, tt.recordedID)
+			}
+
+			var expected []string
+			for _, call := range tt.expected {
+				expected = append(expected, fmt.Sprintf(call, apiID))
+			}
+			if strings.Join(client.calls, "\n") != strings.Join(expected, "\n") {
+				t.Errorf("calls = %q, want %q", client.calls, expected)
+			}
+		})
+	}
+}
+
+func TestUpInterrupted(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  db:
+    template: "postgres:15"
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - db
+`)
+	baseDir := filepath.Dir(stackPath)
+	orchestrator := New(&Config{ProjectName: "interrupted", BaseDir: baseDir, Output: &bytes.Buffer{}})
+	client := newFakeClient()
+	orchestrator.client = client
+
+	// Ctrl+C arrives while db is starting
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dbID := orchestrator.generateContainerID("db")
+	client.onStart = func(vmid int) {
+		if vmid == dbID {
+			cancel()
+		}
+	}
+
+	_, err := orchestrator.Up(ctx, stackPath)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Up() error = %v, want context.Canceled", err)
+	}
+
+	expected := []string{fmt.Sprintf("create %d postgres:15", dbID), fmt.Sprintf("start %d", dbID), fmt.Sprintf("stop %d", dbID), fmt.Sprintf("destroy %d", dbID)}
+	if strings.Join(client.calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("calls = %q, want %q", client.calls, expected)
+	}
+
+	projectState, err := state.Load(state.Path(baseDir, "interrupted"), "interrupted")
+	if err != nil {
+		t.Fatalf("state.Load() unexpected error: %v", err)
+	}
+	if len(projectState.Services) != 0 {
+		t.Errorf("recorded services = %v, want none", projectState.Services)
+	}
+}
+
+func TestUpRollback(t *testing.T) {
+	tests := []struct {
+		name     string
+		rollback bool
+		recorded int
+	}{
+		{name: "rollback removes the services started before the failure", rollback: true, recorded: 0},
+		{name: "without rollback they keep running", rollback: false, recorded: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, `version: "1.0"
+services:
+  db:
+    template: "postgres:15"
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - db
+`)
+			baseDir := filepath.Dir(stackPath)
+			orchestrator := New(&Config{ProjectName: "rollback", BaseDir: baseDir, Rollback: tt.rollback, Output: &bytes.Buffer{}})
+			client := newFakeClient()
+			orchestrator.client = client
+
+			dbID := orchestrator.generateContainerID("db")
+			webID := orchestrator.generateContainerID("web")
+			client.fail = map[string]error{fmt.Sprintf("start %d", webID): errors.New("injected failure")}
+
+			if _, err := orchestrator.Up(context.Background(), stackPath); err == nil {
+				t.Fatal("Up() expected error, got nil")
+			}
+
+			if _, err := client.GetContainer(context.Background(), dbID); (err == nil) == tt.rollback {
+				t.Errorf("db container exists = %v, want %v", err == nil, !tt.rollback)
+			}
+			if _, err := client.GetContainer(context.Background(), webID); err == nil {
+				t.Error("web container exists after its failed start")
+			}
+			projectState, err := state.Load(state.Path(baseDir, "rollback"), "rollback")
+			if err != nil {
+				t.Fatalf("state.Load() unexpected error: %v", err)
+			}
+			if len(projectState.Services) != tt.recorded {
+				t.Errorf("recorded services = %v, want %d", projectState.Services, tt.recorded)
+			}
+		})
+	}
+}
+
+func TestUpRestoresPriorState(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  db:
+    template: "postgres:15"
+`)
+	baseDir := filepath.Dir(stackPath)
+	orchestrator := New(&Config{ProjectName: "restore", BaseDir: baseDir, Rollback: true, Output: &bytes.Buffer{}})
+	client := newFakeClient()
+	orchestrator.client = client
+	if _, err := orchestrator.Up(context.Background(), stackPath); err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+
+	// Adding a service whose start fails leaves db as it was
+	if err := os.WriteFile(stackPath, []byte(`version: "1.0"
+services:
+  db:
+    template: "postgres:15"
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - db
+`), 0644); err != nil {
+		t.Fatalf("Failed to write stack: %v", err)
+	}
+	dbID := orchestrator.generateContainerID("db")
+	webID := orchestrator.generateContainerID("web")
+	client.fail = map[string]error{fmt.Sprintf("start %d", webID): errors.New("injected failure")}
+	if _, err := orchestrator.Up(context.Background(), stackPath); err == nil {
+		t.Fatal("Up() expected error, got nil")
+	}
+
+	if _, err := client.GetContainer(context.Background(), dbID); err != nil {
+		t.Errorf("db container was removed: %v", err)
+	}
+	projectState, err := state.Load(state.Path(baseDir, "restore"), "restore")
+	if err != nil {
+		t.Fatalf("state.Load() unexpected error: %v", err)
+	}
+	if recorded, ok := projectState.Services["db"]; !ok || recorded.ContainerID != dbID || len(projectState.Services) != 1 {
+		t.Errorf("recorded services = %v, want only db in container %d", projectState.Services, dbID)
+	}
+}
+
+func TestUpResume(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+  cache:
+    template: "redis:7"
+    health:
+      test: "redis-cli ping"
+  api:
+    template: "node:20"
+    depends_on:
+      - database
+      - cache
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - api
+`)
+	client := newFakeClient()
+	up := func() (*DeploymentResult, error) {
+		orchestrator := New(&Config{
+			ProjectName: "resume",
+			BaseDir:     filepath.Dir(stackPath),
+			Output:      &bytes.Buffer{},
+		})
+		orchestrator.client = client
+		orchestrator.healthCheck = orchestrator.probeHealth
+		client.reset()
+		return orchestrator.Up(context.Background(), stackPath)
+	}
+	serviceResults := func(result *DeploymentResult) map[string]ServiceResult {
+		results := make(map[string]ServiceResult)
+		for _, service := range result.Services {
+			results[service.Name] = service
+		}
+		return results
+	}
+
+	// The first run fails to start api after database and cache are healthy
+	apiID := New(&Config{ProjectName: "resume"}).generateContainerID("api")
+	client.fail = map[string]error{fmt.Sprintf("start %d", apiID): errors.New("no space left on device")}
+	first, err := up()
+	if err == nil {
+		t.Fatal("Up() expected error for api, got nil")
+	}
+	deployed := serviceResults(first)
+	databaseID, cacheID := deployed["database"].ContainerID, deployed["cache"].ContainerID
+
+	// The half-deployed api container is removed so a re-run cannot collide
+	// with it
+	if !strings.Contains(strings.Join(client.calls, "\n"), fmt.Sprintf("destroy %d", apiID)) {
+		t.Errorf("half-deployed api container %d was not rolled back:\n%s", apiID, strings.Join(client.calls, "\n"))
+	}
+
+	// After fixing the problem, re-running skips the healthy services and
+	// deploys api again
+	client.fail = nil
+	second, err := up()
+	if err != nil {
+		t.Fatalf("Up() resume unexpected error: %v", err)
+	}
+	resumed := serviceResults(second)
+	for _, name := range []string{"database", "cache"} {
+		if resumed[name].Status != "up-to-date" {
+			t.Errorf("%s status = %q, want up-to-date", name, resumed[name].Status)
+		}
+	}
+	for _, name := range []string{"api", "web"} {
+		if resumed[name].Status != "running" {
+			t.Errorf("%s status = %q, want running", name, resumed[name].Status)
+		}
+	}
+	calls := strings.Join(client.calls, "\n")
+	for _, id := range []int{databaseID, cacheID} {
+		if strings.Contains(calls, fmt.Sprintf("create %d", id)) || strings.Contains(calls, fmt.Sprintf("start %d", id)) {
+			t.Errorf("healthy container %d was redeployed:\n%s", id, calls)
+		}
+		if !strings.Contains(calls, fmt.Sprintf("exec %d", id)) {
+			t.Errorf("healthy container %d was not health checked:\n%s", id, calls)
+		}
+	}
+	if !strings.Contains(calls, fmt.Sprintf("create %d", apiID)) {
+		t.Errorf("api container %d was not deployed again:\n%s", apiID, calls)
+	}
+
+	// A stopped service is started again; an unhealthy one is recreated
+	client.stopped[cacheID] = true
+	client.fail = map[string]error{fmt.Sprintf("exec %d", databaseID): errors.New("exit status 2")}
+	third, err := up()
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	results := serviceResults(third)
+	if results["cache"].Status != "started" {
+		t.Errorf("cache status = %q, want started", results["cache"].Status)
+	}
+	if !strings.Contains(strings.Join(client.calls, "\n"), fmt.Sprintf("destroy %d", databaseID)) {
+		t.Errorf("unhealthy database was not recreated:\n%s", strings.Join(client.calls, "\n"))
+	}
+}
+
+func TestUpScaleDownRemovesReplicas(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 1
+`)
+	client := newFakeClient()
+	up := func() (*DeploymentResult, error) {
+		orchestrator := New(&Config{
+			ProjectName: "scaled",
+			BaseDir:     filepath.Dir(stackPath),
+			Output:      &bytes.Buffer{},
+		})
+		orchestrator.client = client
+		client.reset()
+		return orchestrator.Up(context.Background(), stackPath)
+	}
+
+	if _, err := up(); err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+
+	// Replicas 2 and 3 are left over from when web was scaled to 3
+	statePath := state.Path(filepath.Dir(stackPath), "scaled")
+	projectState, err := state.Load(statePath, "scaled")
+	if err != nil {
+		t.Fatalf("state.Load() unexpected error: %v", err)
+	}
+	webID := projectState.Services["web"].ContainerID
+	projectState.Services["web-2"] = state.ServiceState{ContainerID: 902}
+	projectState.Services["web-3"] = state.ServiceState{ContainerID: 903}
+	client.containers[902], client.containers[903] = true, true
+	if err := projectState.Save(statePath); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+
+	result, err := up()
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	if strings.Join(result.RemovedReplicas, ",") != "web-2,web-3" {
+		t.Errorf("RemovedReplicas = %v, want [web-2 web-3]", result.RemovedReplicas)
+	}
+
+	calls := strings.Join(client.calls, "\n")
+	for _, id := range []int{902, 903} {
+		if !strings.Contains(calls, fmt.Sprintf("stop %d", id)) || !strings.Contains(calls, fmt.Sprintf("destroy %d", id)) {
+			t.Errorf("replica container %d was not stopped and removed:\n%s", id, calls)
+		}
+	}
+	for _, op := range []string{"stop", "destroy", "create"} {
+		if strings.Contains(calls, fmt.Sprintf("%s %d", op, webID)) {
+			t.Errorf("replica 1 (container %d) was touched by %s:\n%s", webID, op, calls)
+		}
+	}
+
+	projectState, err = state.Load(statePath, "scaled")
+	if err != nil {
+		t.Fatalf("state.Load() unexpected error: %v", err)
+	}
+	if _, exists := projectState.Services["web-2"]; exists {
+		t.Errorf("state still records web-2: %v", projectState.Services)
+	}
+	if _, exists := projectState.Services["web-3"]; exists {
+		t.Errorf("state still records web-3: %v", projectState.Services)
+	}
+	if projectState.Services["web"].ContainerID != webID {
+		t.Errorf("web container = %d, want %d", projectState.Services["web"].ContainerID, webID)
+	}
+}
+
+func TestNamespaceConfig(t *testing.T) {
+	orchestrator := New(&Config{ProjectName: "shop", Output: &bytes.Buffer{}})
+	appID := orchestrator.generateContainerID("app")
+
+	tests := []struct {
+		name     string
+		service  models.Service
+		expected []string
+	}{
+		{
+			name:     "no options",
+			service:  models.Service{Template: "nginx:latest"},
+			expected: nil,
+		},
+		{
+			name:     "host pid namespace",
+			service:  models.Service{Template: "alpine:3.19", Pid: "host"},
+			expected: []string{"lxc.namespace.keep: pid"},
+		},
+		{
+			name:     "shared pid namespace",
+			service:  models.Service{Template: "alpine:3.19", Pid: "service:app"},
+			expected: []string{fmt.Sprintf("lxc.namespace.share.pid: %d", appID)},
+		},
+		{
+			name:    "shm size with shared namespace",
+			service: models.Service{Template: "alpine:3.19", Pid: "service:app", ShmSize: "1g"},
+			expected: []string{
+				fmt.Sprintf("lxc.namespace.share.pid: %d", appID),
+				"lxc.mount.entry: tmpfs dev/shm tmpfs rw,nosuid,nodev,size=1073741824,create=dir 0 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := orchestrator.buildContainerConfig(tt.service, &models.LXCStack{}).LXC
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("LXC config = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUpInterleavesBuilds(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  api:
+    build: "./api"
+  worker:
+    build: "./worker"
+    depends_on:
+      - api
+  web:
+    template: "nginx:latest"
+`)
+	orchestrator := New(&Config{
+		ProjectName: "interleave",
+		BaseDir:     filepath.Dir(stackPath),
+		Output:      &bytes.Buffer{},
+	})
+	client := newFakeClient()
+	orchestrator.client = client
+
+	webID := orchestrator.generateContainerID("web")
+	webStarted := make(chan struct{})
+	client.onStart = func(vmid int) {
+		if vmid == webID {
+			close(webStarted)
+		}
+	}
+
+	// The api build only finishes once web has started, so Up can only
+	// complete if web is deployed while the build is still running
+	var mu sync.Mutex
+	var builds []string
+	orchestrator.build = func(_ context.Context, serviceName string, buildConfig *models.BuildConfig) (string, error) {
+		if serviceName == "api" {
+			select {
+			case <-webStarted:
+			case <-time.After(5 * time.Second):
+				return "", errors.New("web was not started while api was building")
+			}
+		}
+		mu.Lock()
+		builds = append(builds, serviceName)
+		mu.Unlock()
+		return "local:vztmpl/" + serviceName + ".tar.zst", nil
+	}
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+
+	var order []string
+	for _, service := range result.Services {
+		order = append(order, service.Name)
+	}
+	if order[0] != "web" {
+		t.Errorf("deploy order = %v, want web first", order)
+	}
+	apiIdx, workerIdx := -1, -1
+	for i, name := range order {
+		switch name {
+		case "api":
+			apiIdx = i
+		case "worker":
+			workerIdx = i
+		}
+	}
+	if apiIdx < 0 || workerIdx < apiIdx {
+		t.Errorf("deploy order = %v, want worker after its dependency api", order)
+	}
+	if len(builds) != 2 {
+		t.Errorf("builds = %v, want api and worker", builds)
+	}
+}
+
+func TestUpWaitsForVolumes(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    volumes:
+      - "db-data:/var/lib/postgresql/data"
+  cache:
+    template: "redis:7"
+volumes:
+  db-data:
+    driver: "local"
+`)
+
+	tests := []struct {
+		name      string
+		volumeErr error
+		wantErr   string
+	}{
+		{name: "service starts after its volume exists"},
+		{name: "service fails with its volume", volumeErr: errors.New("storage full"), wantErr: "failed to create volume db-data: storage full"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orchestrator := New(&Config{
+				ProjectName: "volumes",
+				BaseDir:     t.TempDir(),
+				Output:      &bytes.Buffer{},
+			})
+			client := newFakeClient()
+			orchestrator.client = client
+
+			cacheID := orchestrator.generateContainerID("cache")
+			databaseID := orchestrator.generateContainerID("database")
+			cacheStarted := make(chan struct{})
+
+			var mu sync.Mutex
+			var events []string
+			record := func(event string) {
+				mu.Lock()
+				events = append(events, event)
+				mu.Unlock()
+			}
+			client.onStart = func(vmid int) {
+				switch vmid {
+				case cacheID:
+					record("start cache")
+					close(cacheStarted)
+				case databaseID:
+					record("start database")
+				}
+			}
+
+			// The volume is only created once cache has started, so Up can
+			// only complete if cache deploys while database waits for it
+			orchestrator.createResource = func(_ context.Context, kind, name string, stack *models.LXCStack) error {
+				select {
+				case <-cacheStarted:
+				case <-time.After(5 * time.Second):
+					return errors.New("cache was not started while the volume was being created")
+				}
+				record("create " + kind + " " + name)
+				return tt.volumeErr
+			}
+
+			result, err := orchestrator.Up(context.Background(), stackPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Up() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Up() unexpected error: %v", err)
+			}
+
+			want := []string{"start cache", "create volume db-data", "start database"}
+			if tt.volumeErr != nil {
+				want = want[:2]
+			}
+			if !reflect.DeepEqual(events, want) {
+				t.Errorf("events = %q, want %q", events, want)
+			}
+			if len(result.Volumes) != 1 || result.Volumes[0].Name != "db-data" {
+				t.Errorf("Volumes = %+v, want db-data", result.Volumes)
+			}
+		})
+	}
+}
+
+func TestLoadLXCfileBaseOverride(t *testing.T) {
+	dir := t.TempDir()
+	lxcfile := "from: \"debian:12\"\nsetup:\n  - run: \"apt-get update\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "LXCfile.yml"), []byte(lxcfile), 0644); err != nil {
+		t.Fatalf("Failed to write LXCfile: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		buildFrom string
+		stackFrom string
+		expected  string
+	}{
+		{name: "no override uses the LXCfile", expected: "debian:12"},
+		{name: "stack build.from", stackFrom: "ubuntu:22.04", expected: "ubuntu:22.04"},
+		{name: "--build-from", buildFrom: "alpine:3.18", expected: "alpine:3.18"},
+		{name: "--build-from wins over build.from", buildFrom: "alpine:3.18", stackFrom: "ubuntu:22.04", expected: "alpine:3.18"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orchestrator := New(&Config{
+				DryRun:    true,
+				BuildFrom: tt.buildFrom,
+				Output:    &bytes.Buffer{},
+			})
+
+			got, err := orchestrator.loadLXCfile("api", &models.BuildConfig{Context: dir, From: tt.stackFrom})
+			if err != nil {
+				t.Fatalf("loadLXCfile() unexpected error: %v", err)
+			}
+			if got.From != tt.expected {
+				t.Errorf("From = %q, want %q", got.From, tt.expected)
+			}
+			if got.Setup[0].Run != "apt-get update" {
+				t.Errorf("Setup was not preserved: %+v", got.Setup)
+			}
+		})
+	}
+}
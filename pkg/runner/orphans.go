@@ -0,0 +1,171 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// Orphan is a container of the project that its stack no longer defines,
+// such as the container of a service removed from the stack
+type Orphan struct {
+	ContainerID int    `json:"container_id"`
+	Name        string `json:"name,omitempty"`
+	Node        string `json:"node,omitempty"`
+	Key         string `json:"service,omitempty"` // State key it is recorded under, empty if unrecorded
+}
+
+// projectTag returns the tag pxc gives the containers of a project. Proxmox
+// tags hold letters, digits and - _ + . only, and compare case-insensitively.
+func projectTag(project string) string {
+	tag := []byte("pxc-" + strings.ToLower(project))
+	for i := len("pxc-"); i < len(tag); i++ {
+		c := tag[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_+.", c) >= 0) {
+			tag[i] = '-'
+		}
+	}
+	return string(tag)
+}
+
+// stackStateKeys returns the recorded state keys of the stack's services,
+// replicas above their scale included, which Down removes with the service
+func stackStateKeys(stack *models.LXCStack, projectState *state.ProjectState) map[string]bool {
+	keys := make(map[string]bool)
+	for name := range stack.Services {
+		for _, key := range serviceStateKeys(stack, projectState, name) {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// FindOrphans returns the containers of the project that the stack does
+// not define: containers recorded for services removed from the stack, and
+// containers tagged with the project that are recorded for no service of
+// the stack, e.g. after the project state was lost. Replicas above a
+// service's scale are not orphans, as Down removes them with the service.
+// Template containers are never orphans.
+func (o *Orchestrator) FindOrphans(ctx context.Context, stackFile string) ([]Orphan, error) {
+	stack, err := o.loadStack(stackFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stack: %w", err)
+	}
+	o.applyProxmoxSettings(stack)
+	projectState, err := state.Load(state.Path(o.baseDir, o.projectName), o.projectName)
+	if err != nil {
+		return nil, err
+	}
+	o.spreadNodes(stack, projectState)
+	return o.findOrphans(ctx, stack, projectState)
+}
+
+func (o *Orchestrator) findOrphans(ctx context.Context, stack *models.LXCStack, projectState *state.ProjectState) ([]Orphan, error) {
+	containers, err := o.client.ListClusterContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := stackStateKeys(stack, projectState)
+	kept := make(map[int]bool)
+	recorded := make(map[int]string)
+	for key, entry := range projectState.Services {
+		recorded[entry.ContainerID] = key
+		if expected[key] {
+			kept[entry.ContainerID] = true
+		}
+	}
+
+	var orphans []Orphan
+	found := make(map[int]bool)
+	tag := projectTag(o.projectName)
+	for _, container := range containers {
+		if container.Status == "template" || kept[container.VMID] {
+			continue
+		}
+		key, isRecorded := recorded[container.VMID]
+		if !isRecorded && !container.HasTag(tag) {
+			continue
+		}
+		orphans = append(orphans, Orphan{ContainerID: container.VMID, Name: container.Name, Node: container.Node, Key: key})
+		found[container.VMID] = true
+	}
+
+	// Containers recorded before they were tagged, or on a node the listing
+	// missed, are looked up one by one
+	for key, entry := range projectState.Services {
+		if expected[key] || found[entry.ContainerID] {
+			continue
+		}
+		if _, err := o.client.GetContainer(ctx, entry.ContainerID); err != nil {
+			continue
+		}
+		orphans = append(orphans, Orphan{ContainerID: entry.ContainerID, Node: entry.Node, Key: key})
+	}
+
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].ContainerID < orphans[j].ContainerID })
+	return orphans, nil
+}
+
+// RemoveOrphans stops and destroys orphaned containers found by
+// FindOrphans and drops the recorded ones from the project state. Every
+// orphan is attempted unless StopOnError is set; the outcome is added to
+// result under the orphan's state key, or orphan-ID for unrecorded ones.
+// An error is only returned if the orphans could not be attempted.
+func (o *Orchestrator) RemoveOrphans(ctx context.Context, orphans []Orphan, result *DownResult) error {
+	statePath := state.Path(o.baseDir, o.projectName)
+	projectState, err := state.Load(statePath, o.projectName)
+	if err != nil {
+		return err
+	}
+	o.spreadNodes(&models.LXCStack{}, projectState)
+	o.placeOrphans(orphans)
+
+	for i, orphan := range orphans {
+		name := orphan.Key
+		if name == "" {
+			name = fmt.Sprintf("orphan-%d", orphan.ContainerID)
+		}
+		if err := o.removeService(ctx, name, orphan.ContainerID, result); err != nil {
+			o.logWarning("Failed to remove orphaned container %d: %v", orphan.ContainerID, err)
+			result.addError(name, err)
+			if o.stopOnError {
+				for _, skipped := range orphans[i+1:] {
+					result.Skipped = append(result.Skipped, fmt.Sprintf("orphan-%d", skipped.ContainerID))
+				}
+				break
+			}
+			continue
+		}
+		if orphan.Key != "" {
+			delete(projectState.Services, orphan.Key)
+		}
+	}
+
+	if !o.dryRun {
+		if err := projectState.Save(statePath); err != nil {
+			o.logWarning("Failed to save state: %v", err)
+		}
+	}
+	return nil
+}
+
+// placeOrphans sends the calls for orphans on other cluster nodes to their
+// node
+func (o *Orchestrator) placeOrphans(orphans []Orphan) {
+	for _, orphan := range orphans {
+		if orphan.Node == "" || o.isStackNode(orphan.Node) {
+			continue
+		}
+		router, ok := o.client.(*nodeRouter)
+		if !ok {
+			router = newNodeRouter(o.client, o.stackNode(), o.newClient)
+			o.client = router
+		}
+		router.place(orphan.ContainerID, orphan.Node)
+	}
+}
@@ -0,0 +1,161 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestProjectTag(t *testing.T) {
+	for project, want := range map[string]string{
+		"shop":        "pxc-shop",
+		"My_Shop.v2":  "pxc-my_shop.v2",
+		"shop stack!": "pxc-shop-stack-",
+	} {
+		if got := projectTag(project); got != want {
+			t.Errorf("projectTag(%q) = %q, want %q", project, got, want)
+		}
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "9000"
+    scale: 2
+  db:
+    template: "9001"
+`)
+	baseDir := filepath.Dir(stackPath)
+	projectState := &state.ProjectState{
+		Project: "shop",
+		Services: map[string]state.ServiceState{
+			"web":    {ContainerID: 200},
+			"web-2":  {ContainerID: 201},
+			"web-3":  {ContainerID: 202}, // Above the scale, removed by Down
+			"db":     {ContainerID: 203},
+			"worker": {ContainerID: 204}, // Removed from the stack
+			"old":    {ContainerID: 205}, // Recorded before tagging, not listed
+		},
+	}
+	if err := projectState.Save(state.Path(baseDir, "shop")); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	client := newFakeClient()
+	for id := 200; id <= 207; id++ {
+		client.containers[id] = true
+	}
+	client.listed = []proxmox.ContainerInfo{
+		{VMID: 200, Name: "shop-web-1", Tags: "pxc,pxc-shop"},
+		{VMID: 201, Name: "shop-web-2", Tags: "pxc,pxc-shop"},
+		{VMID: 202, Name: "shop-web-3", Tags: "pxc,pxc-shop"},
+		{VMID: 203, Name: "shop-db", Tags: "pxc,pxc-shop"},
+		{VMID: 204, Name: "shop-worker", Tags: "pxc,pxc-shop"},
+		{VMID: 206, Name: "shop-lost", Tags: "pxc,pxc-shop", Node: "pve1"},
+		{VMID: 207, Name: "other-web", Tags: "pxc,pxc-other"},
+		{VMID: 9000, Name: "base", Tags: "pxc-shop", Status: "template"},
+	}
+	orchestrator := New(&Config{ProjectName: "shop", BaseDir: baseDir, ProxmoxNode: "pve1", Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	orphans, err := orchestrator.FindOrphans(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("FindOrphans() unexpected error: %v", err)
+	}
+	want := []Orphan{
+		{ContainerID: 204, Name: "shop-worker", Key: "worker"},
+		{ContainerID: 205, Key: "old"},
+		{ContainerID: 206, Name: "shop-lost", Node: "pve1"},
+	}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Errorf("FindOrphans() = %+v, want %+v", orphans, want)
+	}
+
+	result := &DownResult{}
+	if err := orchestrator.RemoveOrphans(context.Background(), orphans, result); err != nil {
+		t.Fatalf("RemoveOrphans() unexpected error: %v", err)
+	}
+	calls := strings.Join(client.calls, "\n")
+	for _, id := range []string{"204", "205", "206"} {
+		if !strings.Contains(calls, "destroy "+id) {
+			t.Errorf("orphan %s not destroyed:\n%s", id, calls)
+		}
+	}
+	for _, id := range []string{"200", "201", "202", "203", "207", "9000"} {
+		if strings.Contains(calls, " "+id+"\n") || strings.HasSuffix(calls, " "+id) {
+			t.Errorf("container %s touched:\n%s", id, calls)
+		}
+	}
+	if wantRemoved := []string{"worker", "old", "orphan-206"}; !reflect.DeepEqual(result.Removed, wantRemoved) {
+		t.Errorf("Removed = %v, want %v", result.Removed, wantRemoved)
+	}
+
+	reloaded, err := state.Load(state.Path(baseDir, "shop"), "shop")
+	if err != nil {
+		t.Fatalf("state.Load() unexpected error: %v", err)
+	}
+	var keys []string
+	for key := range reloaded.Services {
+		keys = append(keys, key)
+	}
+	if len(keys) != 4 || reloaded.Services["web-3"].ContainerID != 202 || reloaded.Services["worker"].ContainerID != 0 {
+		t.Errorf("state after RemoveOrphans() = %v, want web, web-2, web-3 and db", keys)
+	}
+}
+
+func TestDownThenRemoveOrphans(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "9000"
+`)
+	baseDir := filepath.Dir(stackPath)
+	projectState := &state.ProjectState{
+		Project: "shop",
+		Services: map[string]state.ServiceState{
+			"web":    {ContainerID: 200},
+			"web-2":  {ContainerID: 201}, // Above the scale
+			"worker": {ContainerID: 202}, // Removed from the stack
+		},
+	}
+	if err := projectState.Save(state.Path(baseDir, "shop")); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	client := newFakeClient()
+	for id := 200; id <= 202; id++ {
+		client.containers[id] = true
+	}
+	orchestrator := New(&Config{ProjectName: "shop", BaseDir: baseDir, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	orphans, err := orchestrator.FindOrphans(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("FindOrphans() unexpected error: %v", err)
+	}
+	result, err := orchestrator.Down(context.Background(), stackPath, false)
+	if err != nil {
+		t.Fatalf("Down() unexpected error: %v", err)
+	}
+	if err := orchestrator.RemoveOrphans(context.Background(), orphans, result); err != nil {
+		t.Fatalf("RemoveOrphans() unexpected error: %v", err)
+	}
+
+	removed := append([]string(nil), result.Removed...)
+	sort.Strings(removed)
+	if want := []string{"web", "web-2", "worker"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("Removed = %v, want each container once: %v", result.Removed, want)
+	}
+	if len(result.Errors) != 0 {
+		t.Errorf("Errors = %v, want none", result.Errors)
+	}
+}
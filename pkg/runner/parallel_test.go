@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+const parallelStack = `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - database
+      - cache
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+  cache:
+    template: "redis:7"
+    health:
+      test: "redis-cli ping"
+`
+
+// barrierHealth returns a health check that reports whether the database
+// and cache checks ran at the same time: the first check waits for the
+// second one to start
+func barrierHealth() (func(context.Context, int, *models.HealthCheck) error, func() bool) {
+	var mu sync.Mutex
+	arrived := 0
+	both := make(chan struct{})
+	overlapped := false
+	check := func(_ context.Context, containerID int, health *models.HealthCheck) error {
+		mu.Lock()
+		arrived++
+		first := arrived == 1
+		if arrived == 2 {
+			close(both)
+		}
+		mu.Unlock()
+		if !first {
+			return nil
+		}
+
+		select {
+		case <-both:
+			mu.Lock()
+			overlapped = true
+			mu.Unlock()
+		case <-time.After(200 * time.Millisecond):
+		}
+		return nil
+	}
+	return check, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return overlapped
+	}
+}
+
+func TestUpParallel(t *testing.T) {
+	tests := []struct {
+		name       string
+		parallel   int
+		overlapped bool
+	}{
+		{name: "independent services deploy at once", parallel: 2, overlapped: true},
+		{name: "one at a time by default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, parallelStack)
+			orchestrator := New(&Config{ProjectName: "parallel", BaseDir: t.TempDir(), Parallel: tt.parallel, Output: &bytes.Buffer{}})
+			client := newFakeClient()
+			orchestrator.client = client
+			check, overlapped := barrierHealth()
+			orchestrator.healthCheck = check
+
+			result, err := orchestrator.Up(context.Background(), stackPath)
+			if err != nil {
+				t.Fatalf("Up() unexpected error: %v", err)
+			}
+			if got := overlapped(); got != tt.overlapped {
+				t.Errorf("database and cache deployed at once = %v, want %v", got, tt.overlapped)
+			}
+
+			if len(result.Services) != 3 || result.Services[2].Name != "web" {
+				t.Fatalf("services = %+v, want web deployed last", result.Services)
+			}
+			ids := make(map[int]bool)
+			for _, service := range result.Services {
+				if ids[service.ContainerID] {
+					t.Errorf("container ID %d given to more than one service", service.ContainerID)
+				}
+				ids[service.ContainerID] = true
+			}
+			// web only starts once both of its dependencies are up
+			last := client.calls[len(client.calls)-1]
+			if want := fmt.Sprintf("start %d", result.Services[2].ContainerID); last != want {
+				t.Errorf("last call = %q, want %q", last, want)
+			}
+		})
+	}
+}
+
+func TestUpParallelFailFast(t *testing.T) {
+	stackPath := writeStack(t, parallelStack)
+	orchestrator := New(&Config{ProjectName: "failfast", BaseDir: t.TempDir(), Parallel: 2, Output: &bytes.Buffer{}})
+	client := newFakeClient()
+	databaseID := orchestrator.generateContainerID("database")
+	client.fail = map[string]error{fmt.Sprintf("start %d", databaseID): errors.New("out of memory")}
+	orchestrator.client = client
+	orchestrator.healthCheck = func(context.Context, int, *models.HealthCheck) error { return nil }
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err == nil || !strings.Contains(err.Error(), "failed to deploy service database") {
+		t.Fatalf("Up() error = %v, want the database failure", err)
+	}
+
+	var names []string
+	for _, service := range result.Services {
+		names = append(names, service.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "cache,database" {
+		t.Errorf("services = %v, want cache and database, and web never started", names)
+	}
+	for _, call := range client.calls {
+		if strings.HasPrefix(call, "create") && strings.HasSuffix(call, "nginx:latest") {
+			t.Errorf("web was deployed after database failed: %q", call)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// portForwards expands port mappings into one forward per host port, to
+// the matching port of the container at address
+func portForwards(mappings []models.PortMapping, address string) []proxmox.PortForward {
+	var forwards []proxmox.PortForward
+	for _, mapping := range mappings {
+		for offset := 0; offset <= mapping.HostEnd-mapping.HostStart; offset++ {
+			forwards = append(forwards, proxmox.PortForward{
+				HostPort: proxmox.HostPort{
+					IP:       mapping.HostIP,
+					Port:     mapping.HostStart + offset,
+					Protocol: mapping.Protocol,
+				},
+				ContainerIP:   address,
+				ContainerPort: mapping.ContainerStart + offset,
+			})
+		}
+	}
+	return forwards
+}
+
+// hostPorts returns the host ports of ports entries as recorded in the
+// project state
+func hostPorts(specs []string) []proxmox.HostPort {
+	var ports []proxmox.HostPort
+	for _, spec := range specs {
+		mapping, err := models.ParsePortMapping(spec)
+		if err != nil {
+			continue
+		}
+		for _, forward := range portForwards([]models.PortMapping{mapping}, "") {
+			ports = append(ports, forward.HostPort)
+		}
+	}
+	return ports
+}
+
+// publishedPorts returns every host port the project has published
+func publishedPorts(projectState *state.ProjectState) []proxmox.HostPort {
+	var ports []proxmox.HostPort
+	for _, specs := range projectState.Ports {
+		ports = append(ports, hostPorts(specs)...)
+	}
+	return ports
+}
+
+// checkPorts makes sure the host ports of the services about to be
+// deployed are free on the node: not published by another project and not
+// listened on by a process of the node, such as the Proxmox web interface.
+// Ports the project published itself are free for it.
+func (o *Orchestrator) checkPorts(ctx context.Context, stack *models.LXCStack, projectState *state.ProjectState, order []string) error {
+	if o.dryRun || o.api != nil {
+		return nil
+	}
+
+	type wantedPort struct {
+		label string
+		port  proxmox.HostPort
+	}
+	var wanted []wantedPort
+	for _, name := range order {
+		service := stack.Services[name]
+		for index := 1; index <= max(service.Scale, 1); index++ {
+			r := newReplica(name, index, service)
+			for _, forward := range portForwards(service.ReplicaPorts(index), "") {
+				wanted = append(wanted, wantedPort{label: r.label, port: forward.HostPort})
+			}
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	forwards, err := o.client.PortForwards(ctx)
+	if err != nil {
+		return err
+	}
+	listening, err := o.client.ListeningPorts(ctx)
+	if err != nil {
+		return err
+	}
+	owned := publishedPorts(projectState)
+
+	var problems []string
+	for _, w := range wanted {
+		for _, forward := range forwards {
+			if w.port.Overlaps(forward.HostPort) && !containsPort(owned, forward.HostPort) {
+				problems = append(problems, fmt.Sprintf("%s: host port %s is already published to %s:%d",
+					w.label, w.port, forward.ContainerIP, forward.ContainerPort))
+			}
+		}
+		for _, port := range listening {
+			if w.port.Overlaps(port) {
+				problems = append(problems, fmt.Sprintf("%s: host port %s is in use on the node (%s)", w.label, w.port, port))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("cannot publish ports: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func containsPort(ports []proxmox.HostPort, port proxmox.HostPort) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// publishPorts forwards the host ports of every deployed replica to its
+// container's first interface and removes the ports the project published
+// before that no replica maps anymore, e.g. after a scale-down or an edit
+// of the ports. The forwards follow containers that were recreated with a
+// new address. A replica whose address can't be found, e.g. a stopped one,
+// keeps what it had. The published ports are recorded in the project state.
+func (o *Orchestrator) publishPorts(ctx context.Context, stack *models.LXCStack, projectState *state.ProjectState) error {
+	names := make([]string, 0, len(stack.Services))
+	for name, service := range stack.Services {
+		if len(service.Ports) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if o.api != nil {
+		if len(names) > 0 {
+			o.logWarning("Ports of %s are not published with the api transport; use transport pct", strings.Join(names, ", "))
+		}
+		return nil
+	}
+	if o.dryRun {
+		if len(names) > 0 {
+			o.log("DRY RUN: Would publish the ports of %s", strings.Join(names, ", "))
+		}
+		return nil
+	}
+
+	published := make(map[string][]string)
+	var add []proxmox.PortForward
+	for _, name := range names {
+		service := stack.Services[name]
+		for _, key := range serviceStateKeys(stack, projectState, name) {
+			r := replicaOf(name, key, service)
+			containerID := projectState.Services[key].ContainerID
+			address, err := o.containerAddress(ctx, containerID)
+			if err != nil {
+				o.logWarning("Ports of %s are not updated: %v", r.label, err)
+				if previous, recorded := projectState.Ports[key]; recorded {
+					published[key] = previous
+				}
+				continue
+			}
+			mappings := service.ReplicaPorts(r.index)
+			add = append(add, portForwards(mappings, address)...)
+			for _, mapping := range mappings {
+				published[key] = append(published[key], mapping.String())
+			}
+		}
+	}
+
+	var kept []proxmox.HostPort
+	for _, specs := range published {
+		kept = append(kept, hostPorts(specs)...)
+	}
+	var remove []proxmox.HostPort
+	for _, port := range publishedPorts(projectState) {
+		if !containsPort(kept, port) && !containsPort(remove, port) {
+			remove = append(remove, port)
+		}
+	}
+
+	if err := o.client.UpdatePortForwards(ctx, remove, add); err != nil {
+		return fmt.Errorf("failed to publish ports: %w", err)
+	}
+	projectState.Ports = published
+	if len(projectState.Ports) == 0 {
+		projectState.Ports = nil
+	}
+	for _, forward := range add {
+		o.log("Published port %s", forward)
+	}
+	return nil
+}
+
+// containerAddress returns the IPv4 address of a container's first
+// interface, which published ports are forwarded to
+func (o *Orchestrator) containerAddress(ctx context.Context, containerID int) (string, error) {
+	addresses, err := o.client.GetInterfaceAddresses(ctx, containerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get addresses of container %d: %w", containerID, err)
+	}
+	if address := addresses["eth0"]; address != "" {
+		return address, nil
+	}
+	interfaces := make([]string, 0, len(addresses))
+	for iface := range addresses {
+		interfaces = append(interfaces, iface)
+	}
+	sort.Strings(interfaces)
+	if len(interfaces) == 0 {
+		return "", fmt.Errorf("container %d has no IPv4 address", containerID)
+	}
+	return addresses[interfaces[0]], nil
+}
+
+// unpublishPorts removes the ports published for the given service state
+// keys, e.g. of the containers Down removed
+func (o *Orchestrator) unpublishPorts(ctx context.Context, projectState *state.ProjectState, keys []string) error {
+	var remove []proxmox.HostPort
+	for _, key := range keys {
+		remove = append(remove, hostPorts(projectState.Ports[key])...)
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+
+	o.log("Unpublishing %d port(s)", len(remove))
+	if err := o.client.UpdatePortForwards(ctx, remove, nil); err != nil {
+		return fmt.Errorf("failed to unpublish ports: %w", err)
+	}
+	for _, key := range keys {
+		delete(projectState.Ports, key)
+	}
+	if len(projectState.Ports) == 0 {
+		projectState.Ports = nil
+	}
+	return nil
+}
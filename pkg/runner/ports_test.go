@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestPublishPorts(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 2
+    ports:
+      - "8080:80"
+  dns:
+    template: "dnsmasq:latest"
+    ports:
+      - "10.1.1.1:53:5353/udp"
+`)
+	client := newFakeClient()
+	orchestrator := func() *Orchestrator {
+		o := New(&Config{ProjectName: "shop", BaseDir: filepath.Dir(stackPath), Output: &bytes.Buffer{}})
+		o.client = client
+		return o
+	}
+	forwards := func() string {
+		var list []string
+		for _, forward := range client.forwards {
+			list = append(list, forward.String())
+		}
+		sort.Strings(list)
+		return strings.Join(list, ", ")
+	}
+
+	if _, err := orchestrator().Up(context.Background(), stackPath); err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	projectState, err := state.Load(state.Path(filepath.Dir(stackPath), "shop"), "shop")
+	if err != nil {
+		t.Fatalf("state.Load() unexpected error: %v", err)
+	}
+	web, web2, dns := projectState.Services["web"].ContainerID, projectState.Services["web-2"].ContainerID, projectState.Services["dns"].ContainerID
+	want := strings.Join([]string{
+		fmt.Sprintf("10.1.1.1:53/udp -> 10.0.0.%d:5353", dns%250),
+		fmt.Sprintf("8080/tcp -> 10.0.0.%d:80", web%250),
+		fmt.Sprintf("8081/tcp -> 10.0.0.%d:80", web2%250),
+	}, ", ")
+	if got := forwards(); got != want {
+		t.Errorf("forwards = %s, want %s", got, want)
+	}
+	if got := strings.Join(projectState.Ports["web-2"], ","); got != "8081:80/tcp" {
+		t.Errorf("recorded ports of web-2 = %q, want 8081:80/tcp", got)
+	}
+
+	// Scaling down removes the forward of the removed replica
+	scaled := bytes.Replace(mustRead(t, stackPath), []byte("scale: 2"), []byte("scale: 1"), 1)
+	if err := os.WriteFile(stackPath, scaled, 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+	if _, err := orchestrator().Up(context.Background(), stackPath); err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	if got := forwards(); strings.Contains(got, "8081/tcp") || !strings.Contains(got, "8080/tcp") {
+		t.Errorf("forwards after scaling down = %s, want 8080 only", got)
+	}
+
+	// Down removes every forward
+	result, err := orchestrator().Down(context.Background(), stackPath, false)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Down() = %+v, %v, want no errors", result, err)
+	}
+	if got := forwards(); got != "" {
+		t.Errorf("forwards after down = %s, want none", got)
+	}
+}
+
+func TestCheckPortsConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwards  []proxmox.PortForward
+		listening []proxmox.HostPort
+		owned     map[string][]string
+		errorMsg  string
+	}{
+		{
+			name:      "free ports",
+			listening: []proxmox.HostPort{{Port: 8006, Protocol: "tcp"}, {Port: 8080, Protocol: "udp"}},
+		},
+		{
+			name:     "published by another project",
+			forwards: []proxmox.PortForward{{HostPort: proxmox.HostPort{Port: 8081, Protocol: "tcp"}, ContainerIP: "10.0.0.9", ContainerPort: 80}},
+			errorMsg: "cannot publish ports: web-2: host port 8081/tcp is already published to 10.0.0.9:80",
+		},
+		{
+			name:     "published by this project",
+			forwards: []proxmox.PortForward{{HostPort: proxmox.HostPort{Port: 8080, Protocol: "tcp"}, ContainerIP: "10.0.0.9", ContainerPort: 80}},
+			owned:    map[string][]string{"web": {"8080:80/tcp"}},
+		},
+		{
+			name:      "in use on the node",
+			listening: []proxmox.HostPort{{IP: "127.0.0.1", Port: 8080, Protocol: "tcp"}},
+			errorMsg:  "cannot publish ports: web-1: host port 8080/tcp is in use on the node (127.0.0.1:8080/tcp)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 2
+    ports:
+      - "8080:80"
+`)
+			baseDir := filepath.Dir(stackPath)
+			projectState := &state.ProjectState{Project: "shop", Services: map[string]state.ServiceState{}, Ports: tt.owned}
+			if err := projectState.Save(state.Path(baseDir, "shop")); err != nil {
+				t.Fatalf("Failed to save state: %v", err)
+			}
+
+			client := newFakeClient()
+			client.listening = tt.listening
+			if err := client.UpdatePortForwards(context.Background(), nil, tt.forwards); err != nil {
+				t.Fatalf("UpdatePortForwards() unexpected error: %v", err)
+			}
+			orchestrator := New(&Config{ProjectName: "shop", BaseDir: baseDir, Output: &bytes.Buffer{}})
+			orchestrator.client = client
+
+			_, err := orchestrator.Up(context.Background(), stackPath)
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("Up() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.errorMsg {
+				t.Errorf("Up() error = %v, want %q", err, tt.errorMsg)
+			}
+			for _, call := range client.calls {
+				if strings.HasPrefix(call, "create ") {
+					t.Errorf("Up() created a container despite the conflict: %v", client.calls)
+					break
+				}
+			}
+		})
+	}
+}
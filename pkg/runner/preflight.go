@@ -0,0 +1,212 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// Resources assumed for containers whose service and stack defaults don't
+// set them, matching what pct create allocates
+const (
+	defaultContainerMemoryMB = 512
+	defaultContainerCores    = 1
+	defaultContainerRootFSGB = 8
+)
+
+// ResourceRequest is what a set of new containers asks of the node
+type ResourceRequest struct {
+	Containers int
+	MemoryMB   int64
+	DiskGB     int64
+	MaxCores   int // Largest core count of a single container
+}
+
+// stackRequirements sums the resources of the given services, counting each
+// replica. Service resources take precedence over the stack's
+// default_resources.
+func stackRequirements(stack *models.LXCStack, services []string) ResourceRequest {
+	var defaults models.Resources
+	if stack.Settings != nil && stack.Settings.DefaultResources != nil {
+		defaults = *stack.Settings.DefaultResources
+	}
+
+	var request ResourceRequest
+	for _, name := range services {
+		service := stack.Services[name]
+		resources := defaults
+		if service.Resources != nil {
+			if service.Resources.Memory > 0 {
+				resources.Memory = service.Resources.Memory
+			}
+			if service.Resources.Cores > 0 {
+				resources.Cores = service.Resources.Cores
+			}
+			if service.Resources.RootFS > 0 {
+				resources.RootFS = service.Resources.RootFS
+			}
+		}
+		if resources.Memory == 0 {
+			resources.Memory = defaultContainerMemoryMB
+		}
+		if resources.Cores == 0 {
+			resources.Cores = defaultContainerCores
+		}
+		if resources.RootFS == 0 {
+			resources.RootFS = defaultContainerRootFSGB
+		}
+
+		replicas := max(service.Scale, 1)
+		request.Containers += replicas
+		request.MemoryMB += int64(resources.Memory * replicas)
+		request.DiskGB += int64(resources.RootFS * replicas)
+		request.MaxCores = max(request.MaxCores, resources.Cores)
+	}
+	return request
+}
+
+// checkCapacity describes every way the request over-commits the node
+func checkCapacity(request ResourceRequest, capacity *proxmox.NodeCapacity) []string {
+	var problems []string
+	if request.MemoryMB > capacity.MemoryFreeMB {
+		problems = append(problems, fmt.Sprintf("%d container(s) request %d MB of memory, but the node has %d MB free (%d MB total)",
+			request.Containers, request.MemoryMB, capacity.MemoryFreeMB, capacity.MemoryTotalMB))
+	}
+	if capacity.Storage != "" && request.DiskGB > capacity.DiskFreeGB {
+		problems = append(problems, fmt.Sprintf("%d container(s) request %d GB of disk, but storage %s has %d GB free",
+			request.Containers, request.DiskGB, capacity.Storage, capacity.DiskFreeGB))
+	}
+	if capacity.Cores > 0 && request.MaxCores > capacity.Cores {
+		problems = append(problems, fmt.Sprintf("a container requests %d cores, but the node has %d",
+			request.MaxCores, capacity.Cores))
+	}
+	return problems
+}
+
+// preflight compares the resources of the containers Up is about to create
+// with what their nodes have left. Over-commits are warnings, or an error in
+// strict mode. Services whose container already exists are not counted.
+func (o *Orchestrator) preflight(ctx context.Context, stack *models.LXCStack, projectState *state.ProjectState, order []string) error {
+	if o.dryRun {
+		o.log("DRY RUN: Would check node capacity for the stack")
+		return nil
+	}
+
+	// Services on the stack's node are checked against o.node, the others
+	// against the node they are placed on
+	var nodes []string
+	services := make(map[string][]string)
+	for _, name := range order {
+		if previous, deployed := projectState.Services[name]; deployed {
+			if _, err := o.client.GetContainer(ctx, previous.ContainerID); err == nil {
+				continue
+			}
+		}
+		node := o.node
+		if service := stack.Services[name]; service.Node != "" && !o.isStackNode(service.Node) {
+			node = service.Node
+		}
+		if _, seen := services[node]; !seen {
+			nodes = append(nodes, node)
+		}
+		services[node] = append(services[node], name)
+	}
+
+	for _, node := range nodes {
+		if err := o.preflightNode(stack, node, services[node]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preflightNode checks the containers of services about to be created on a
+// node against what it has left
+func (o *Orchestrator) preflightNode(stack *models.LXCStack, node string, services []string) error {
+	storage := o.storage
+	capacity, err := o.nodeCapacity(node, storage)
+	if err != nil {
+		if o.strict {
+			return fmt.Errorf("failed to check node capacity: %w", err)
+		}
+		o.logWarning("Skipping resource preflight: %v", err)
+		return nil
+	}
+
+	subject := "the node"
+	if node != o.node {
+		subject = "node " + node
+	}
+	problems := checkCapacity(stackRequirements(stack, services), capacity)
+	if len(problems) == 0 {
+		return nil
+	}
+	if o.strict {
+		return fmt.Errorf("stack would over-commit %s: %s", subject, strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		o.logWarning("Stack would over-commit %s: %s", subject, problem)
+	}
+	return nil
+}
+
+// CheckCapacity compares the resource totals of every service of a stack
+// with the nodes they are placed on, as pxc validate reports them. Unlike
+// the preflight of Up it ignores what is running: memory is compared with
+// the node's total rather than what is free, so the stack's own running
+// containers are not counted twice, and disk is not checked. An error is
+// returned if a node's capacity cannot be read.
+func (o *Orchestrator) CheckCapacity(stackFile string) ([]string, error) {
+	stack, err := config.LoadLXCStack(stackFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stack: %w", err)
+	}
+	o.applyProxmoxSettings(stack)
+
+	names := make([]string, 0, len(stack.Services))
+	for name := range stack.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var nodes []string
+	services := make(map[string][]string)
+	for _, name := range names {
+		node := o.node
+		if service := stack.Services[name]; service.Node != "" && !o.isStackNode(service.Node) {
+			node = service.Node
+		}
+		if _, seen := services[node]; !seen {
+			nodes = append(nodes, node)
+		}
+		services[node] = append(services[node], name)
+	}
+
+	var problems []string
+	for _, node := range nodes {
+		capacity, err := o.nodeCapacity(node, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to check node capacity: %w", err)
+		}
+		subject := "the node"
+		if node != o.node {
+			subject = "node " + node
+		}
+		request := stackRequirements(stack, services[node])
+		if request.MemoryMB > capacity.MemoryTotalMB {
+			problems = append(problems, fmt.Sprintf("%d container(s) on %s request %d MB of memory, but it has %d MB",
+				request.Containers, subject, request.MemoryMB, capacity.MemoryTotalMB))
+		}
+		if capacity.Cores > 0 && request.MaxCores > capacity.Cores {
+			problems = append(problems, fmt.Sprintf("a container on %s requests %d cores, but it has %d",
+				subject, request.MaxCores, capacity.Cores))
+		}
+	}
+	return problems, nil
+}
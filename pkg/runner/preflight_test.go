@@ -0,0 +1,177 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestStackRequirements(t *testing.T) {
+	stack := &models.LXCStack{
+		Services: map[string]models.Service{
+			"web":      {Template: "nginx:latest", Scale: 3, Resources: &models.Resources{Memory: 1024, Cores: 2}},
+			"database": {Template: "postgres:15", Resources: &models.Resources{Memory: 4096, Cores: 4, RootFS: 50}},
+			"worker":   {Template: "python:3.11", Scale: 2},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		settings *models.Settings
+		services []string
+		expected ResourceRequest
+	}{
+		{
+			name:     "replicas are counted",
+			services: []string{"web"},
+			expected: ResourceRequest{Containers: 3, MemoryMB: 3072, DiskGB: 24, MaxCores: 2},
+		},
+		{
+			name:     "whole stack with pct defaults",
+			services: []string{"database", "web", "worker"},
+			expected: ResourceRequest{Containers: 6, MemoryMB: 4096 + 3072 + 1024, DiskGB: 50 + 24 + 16, MaxCores: 4},
+		},
+		{
+			name:     "stack default resources fill gaps",
+			settings: &models.Settings{DefaultResources: &models.Resources{Memory: 256, Cores: 1, RootFS: 4}},
+			services: []string{"web", "worker"},
+			expected: ResourceRequest{Containers: 5, MemoryMB: 3072 + 512, DiskGB: 12 + 8, MaxCores: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stack.Settings = tt.settings
+			if got := stackRequirements(stack, tt.services); got != tt.expected {
+				t.Errorf("stackRequirements() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	stack := &models.LXCStack{
+		Services: map[string]models.Service{
+			"web":      {Template: "nginx:latest", Scale: 4, Resources: &models.Resources{Memory: 2048, RootFS: 10}},
+			"database": {Template: "postgres:15", Resources: &models.Resources{Memory: 4096, RootFS: 20}},
+		},
+	}
+	order := []string{"database", "web"}
+
+	tests := []struct {
+		name     string
+		capacity proxmox.NodeCapacity
+		deployed bool // database already has a running container
+		strict   bool
+		warning  string
+		errorMsg string
+	}{
+		{
+			name:     "fits",
+			capacity: proxmox.NodeCapacity{MemoryTotalMB: 32768, MemoryFreeMB: 16384, Cores: 8, Storage: "local-lvm", DiskFreeGB: 100},
+		},
+		{
+			name:     "memory over-commit warns",
+			capacity: proxmox.NodeCapacity{MemoryTotalMB: 16384, MemoryFreeMB: 8192, Cores: 8, Storage: "local-lvm", DiskFreeGB: 100},
+			warning:  "5 container(s) request 12288 MB of memory, but the node has 8192 MB free (16384 MB total)",
+		},
+		{
+			name:     "existing containers are not counted",
+			capacity: proxmox.NodeCapacity{MemoryTotalMB: 16384, MemoryFreeMB: 8192, Cores: 8, Storage: "local-lvm", DiskFreeGB: 100},
+			deployed: true,
+		},
+		{
+			name:     "disk over-commit fails in strict mode",
+			capacity: proxmox.NodeCapacity{MemoryTotalMB: 32768, MemoryFreeMB: 16384, Cores: 8, Storage: "local-lvm", DiskFreeGB: 40},
+			strict:   true,
+			errorMsg: "stack would over-commit the node: 5 container(s) request 60 GB of disk, but storage local-lvm has 40 GB free",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			orchestrator := New(&Config{Strict: tt.strict, Storage: "local-lvm", Output: &out})
+			client := newFakeClient()
+			orchestrator.client = client
+			orchestrator.nodeCapacity = func(node, storage string) (*proxmox.NodeCapacity, error) {
+				if storage != "local-lvm" {
+					t.Errorf("nodeCapacity(%q), want local-lvm", storage)
+				}
+				capacity := tt.capacity
+				return &capacity, nil
+			}
+
+			projectState := &state.ProjectState{Services: map[string]state.ServiceState{}}
+			if tt.deployed {
+				projectState.Services["database"] = state.ServiceState{ContainerID: 250}
+				client.containers[250] = true
+			}
+
+			err := orchestrator.preflight(context.Background(), stack, projectState, order)
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Errorf("preflight() error = %v, want %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("preflight() unexpected error: %v", err)
+			}
+
+			if tt.warning == "" {
+				if strings.Contains(out.String(), "over-commit") {
+					t.Errorf("unexpected over-commit warning:\n%s", out.String())
+				}
+			} else if !strings.Contains(out.String(), tt.warning) {
+				t.Errorf("output missing warning %q:\n%s", tt.warning, out.String())
+			}
+		})
+	}
+}
+
+func TestCheckCapacity(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+settings:
+  proxmox:
+    node: pve1
+services:
+  web:
+    template: "9000"
+    scale: 3
+    resources:
+      memory: 4096
+  db:
+    template: "9001"
+    node: pve2
+    resources:
+      cores: 16
+`)
+	orchestrator := New(&Config{Output: &bytes.Buffer{}})
+	var checked []string
+	orchestrator.nodeCapacity = func(node, storage string) (*proxmox.NodeCapacity, error) {
+		checked = append(checked, node)
+		// Little is free, but the stack's own containers may be using it
+		return &proxmox.NodeCapacity{MemoryTotalMB: 8192, MemoryFreeMB: 1024, Cores: 8}, nil
+	}
+
+	problems, err := orchestrator.CheckCapacity(stackPath)
+	if err != nil {
+		t.Fatalf("CheckCapacity() unexpected error: %v", err)
+	}
+	want := []string{
+		"a container on node pve2 requests 16 cores, but it has 8",
+		"3 container(s) on the node request 12288 MB of memory, but it has 8192 MB",
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("CheckCapacity() =\n%s\nwant\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+	if strings.Join(checked, ",") != "pve2,pve1" {
+		t.Errorf("checked nodes %v, want pve2 and pve1", checked)
+	}
+}
@@ -0,0 +1,363 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// updateAction is what incremental up does with a previously deployed service
+type updateAction int
+
+const (
+	actionCreate updateAction = iota
+	actionRecreate
+	actionReload
+	actionNone
+)
+
+// planUpdate compares a service's recorded digests with its current ones.
+// A changed definition needs a new container; changed config or secret
+// contents alone are re-pushed into the running container.
+func planUpdate(previous state.ServiceState, deployed bool, digest, filesDigest string) updateAction {
+	switch {
+	case !deployed:
+		return actionCreate
+	case previous.Digest != digest:
+		return actionRecreate
+	case previous.FilesDigest != filesDigest:
+		return actionReload
+	default:
+		return actionNone
+	}
+}
+
+// serviceDigests hashes a service definition, including the config and secret
+// definitions it references, separately from the contents of those files.
+// The replica count is left out, so scaling a service leaves its existing
+// replicas alone, and so are the ports, which are published on the node.
+func (o *Orchestrator) serviceDigests(name string, service models.Service, stack *models.LXCStack) (string, string, error) {
+	service.Scale = 0
+	service.Ports = nil
+	if service.Deploy != nil {
+		deploy := *service.Deploy
+		deploy.Replicas = 0
+		service.Deploy = &deploy
+	}
+	definition := struct {
+		Service models.Service
+		Configs map[string]models.Config
+		Secrets map[string]models.Secret
+	}{
+		Service: service,
+		Configs: make(map[string]models.Config),
+		Secrets: make(map[string]models.Secret),
+	}
+	for _, name := range service.Configs {
+		definition.Configs[name] = stack.Configs[name]
+	}
+	for _, name := range service.Secrets {
+		definition.Secrets[name] = stack.Secrets[name]
+	}
+
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash service definition: %w", err)
+	}
+	digest := sha256.Sum256(data)
+
+	files, err := o.serviceFiles(name, service, stack)
+	if err != nil {
+		return "", "", err
+	}
+	if len(files) == 0 {
+		return hex.EncodeToString(digest[:]), "", nil
+	}
+
+	hash := sha256.New()
+	for _, file := range files {
+		content := file.data
+		if file.source != "" {
+			if content, err = os.ReadFile(file.source); err != nil {
+				return "", "", fmt.Errorf("failed to read %s: %w", file.source, err)
+			}
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", file.dest, len(content))
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(digest[:]), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// serviceFile is a host file, or contents rendered or read by pxc, pushed
+// into a service's container
+type serviceFile struct {
+	source string
+	data   []byte // Contents to push when there is no source
+	dest   string
+	opts   proxmox.PushOptions
+}
+
+// serviceFiles resolves the config and secret files referenced by a service
+func (o *Orchestrator) serviceFiles(name string, service models.Service, stack *models.LXCStack) ([]serviceFile, error) {
+	files, err := o.configFiles(name, service, stack)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := o.secretFiles(service, stack)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, secrets...), nil
+}
+
+// configFiles resolves the config files referenced by a service, rendering
+// templates for it
+func (o *Orchestrator) configFiles(serviceName string, service models.Service, stack *models.LXCStack) ([]serviceFile, error) {
+	var files []serviceFile
+
+	configNames := append([]string{}, service.Configs...)
+	sort.Strings(configNames)
+	for _, name := range configNames {
+		cfg := stack.Configs[name]
+		if cfg.File == "" {
+			return nil, fmt.Errorf("config '%s' has no file", name)
+		}
+
+		file := serviceFile{
+			source: o.resolvePath(cfg.File),
+			dest:   cfg.Target,
+			opts:   proxmox.PushOptions{User: cfg.User, Group: cfg.Group},
+		}
+		if file.dest == "" {
+			file.dest = "/" + name
+		}
+		if cfg.Mode > 0 {
+			file.opts.Perms = fmt.Sprintf("%o", cfg.Mode)
+		}
+		if cfg.Template {
+			data, err := o.renderConfig(serviceName, service, file.source)
+			if err != nil {
+				return nil, fmt.Errorf("config '%s': %w", name, err)
+			}
+			file.source, file.data = "", data
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// renderConfig substitutes variable references in a config template, as in
+// stack files, from the service's build args, then its environment, then
+// pxc's environment
+func (o *Orchestrator) renderConfig(serviceName string, service models.Service, source string) ([]byte, error) {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+
+	var buildArgs map[string]string
+	if buildConfig := service.GetBuildConfig(); buildConfig != nil {
+		buildArgs = buildConfig.Args
+	}
+	buildArgs = mergeBuildArgs(buildArgs, o.buildArgs, o.serviceArgs[serviceName])
+	lookup := func(name string) (string, bool) {
+		if value, found := buildArgs[name]; found {
+			return value, true
+		}
+		if value, found := service.Environment[name]; found {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	}
+
+	rendered, err := config.RenderTemplate(string(content), lookup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", source, err)
+	}
+	return []byte(rendered), nil
+}
+
+// secretFiles resolves the secrets referenced by a service. Environment
+// secrets are read from pxc's environment and external ones from the
+// secrets provider; without a provider, external secrets are managed
+// outside pxc and are not pushed.
+func (o *Orchestrator) secretFiles(service models.Service, stack *models.LXCStack) ([]serviceFile, error) {
+	var files []serviceFile
+
+	secretNames := append([]string{}, service.Secrets...)
+	sort.Strings(secretNames)
+	for _, name := range secretNames {
+		secret := stack.Secrets[name]
+		mount := service.SecretMount(name)
+		file := serviceFile{
+			dest: mount.Target,
+			opts: proxmox.PushOptions{Perms: "400", User: mount.UID, Group: mount.GID},
+		}
+		if mount.Mode > 0 {
+			file.opts.Perms = fmt.Sprintf("%o", mount.Mode)
+		}
+
+		switch {
+		case secret.File != "":
+			file.source = o.resolvePath(secret.File)
+		case secret.Environment != "":
+			value, found := os.LookupEnv(secret.Environment)
+			if !found {
+				return nil, fmt.Errorf("secret '%s': environment variable %s is not set", name, secret.Environment)
+			}
+			file.data = []byte(value)
+		case secret.External:
+			if o.fetchSecret == nil {
+				continue
+			}
+			external := name
+			if secret.Name != "" {
+				external = secret.Name
+			}
+			data, err := o.fetchSecret(external)
+			if err != nil {
+				return nil, fmt.Errorf("secret '%s': %w", name, err)
+			}
+			file.data = data
+		default:
+			return nil, fmt.Errorf("secret '%s' has no source", name)
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// pushServiceFiles copies a service's configs and secrets into its container
+func (o *Orchestrator) pushServiceFiles(ctx context.Context, name string, containerID int, service models.Service, stack *models.LXCStack) error {
+	files, err := o.serviceFiles(name, service, stack)
+	if err != nil {
+		return err
+	}
+	return o.pushFiles(ctx, containerID, files)
+}
+
+// restoreSecrets pushes a service's secrets into its container again after
+// the container was started: /run is a tmpfs, so they are gone after a stop
+func (o *Orchestrator) restoreSecrets(ctx context.Context, containerID int, service models.Service, stack *models.LXCStack) error {
+	files, err := o.secretFiles(service, stack)
+	if err != nil {
+		return err
+	}
+	return o.pushFiles(ctx, containerID, files)
+}
+
+// pushFiles creates the target directories, which pct push does not, and
+// copies the files into a container. Contents without a source file are
+// written to a private temporary file first.
+func (o *Orchestrator) pushFiles(ctx context.Context, containerID int, files []serviceFile) error {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if dir := path.Dir(file.dest); !seen[dir] {
+			dirs = append(dirs, dir)
+			seen[dir] = true
+		}
+	}
+	if len(dirs) > 0 {
+		if err := o.client.ExecCommand(ctx, containerID, append([]string{"mkdir", "-p"}, dirs...)); err != nil {
+			return fmt.Errorf("failed to create %s: %w", strings.Join(dirs, ", "), err)
+		}
+	}
+
+	for _, file := range files {
+		source := file.source
+		if source == "" {
+			tmp, err := writeTempFile(file.data)
+			if err != nil {
+				return fmt.Errorf("failed to push %s: %w", file.dest, err)
+			}
+			defer os.RemoveAll(filepath.Dir(tmp))
+			source = tmp
+		}
+		o.logDebug("Pushing %s to %s in container %d", source, file.dest, containerID)
+		if err := o.client.PushFile(ctx, containerID, source, file.dest, file.opts); err != nil {
+			return fmt.Errorf("failed to push %s: %w", file.dest, err)
+		}
+	}
+
+	return nil
+}
+
+// writeTempFile writes contents to a file only the current user can read, in
+// a directory of its own that the caller removes
+func writeTempFile(data []byte) (string, error) {
+	dir, err := os.MkdirTemp("", "pxc-secret-")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "secret")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return file, nil
+}
+
+// providerSecret returns a secret from the secrets provider: the provider
+// command is run by sh with the secret's name as its argument and prints the
+// secret on stdout
+func providerSecret(provider, name string) ([]byte, error) {
+	cmd := exec.Command("sh", "-c", provider+` "$1"`, "sh", name)
+	output, err := proxmox.CommandOutput(cmd)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("secrets provider failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("secrets provider failed: %w", err)
+	}
+	return output, nil
+}
+
+// reloadService re-pushes changed configs and secrets into a running
+// container and signals its init process if a reload_signal is set
+func (o *Orchestrator) reloadService(ctx context.Context, r replica, containerID int, service models.Service, stack *models.LXCStack) error {
+	name := r.label
+	o.log("Updating configs and secrets for service %s (container %d)", name, containerID)
+
+	if err := o.pushServiceFiles(ctx, r.service, containerID, service, stack); err != nil {
+		return err
+	}
+
+	if service.ReloadSignal == "" {
+		return nil
+	}
+
+	signal := strings.TrimPrefix(strings.ToUpper(service.ReloadSignal), "SIG")
+	o.log("Sending SIG%s to service %s", signal, name)
+	if err := o.client.ExecCommand(ctx, containerID, []string{"kill", "-s", signal, "1"}); err != nil {
+		return fmt.Errorf("failed to send reload signal: %w", err)
+	}
+
+	return nil
+}
+
+// resolvePath resolves a stack-relative path against the stack directory
+func (o *Orchestrator) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(o.baseDir, path)
+}
@@ -0,0 +1,169 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+func TestPushSecrets(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  db:
+    template: "postgres:16"
+    secrets:
+      - tls_key
+      - source: db_password
+        target: postgres_password
+        uid: "999"
+        mode: 0440
+      - source: api_key
+        target: /etc/app/api_key
+secrets:
+  tls_key:
+    file: "./tls.key"
+  db_password:
+    environment: PXC_TEST_DB_PASSWORD
+  api_key:
+    external: true
+    name: prod/api_key
+`)
+	baseDir := filepath.Dir(stackPath)
+	if err := os.WriteFile(filepath.Join(baseDir, "tls.key"), []byte("key-1"), 0644); err != nil {
+		t.Fatalf("Failed to write tls.key: %v", err)
+	}
+	t.Setenv("PXC_TEST_DB_PASSWORD", "hunter2")
+
+	client := newFakeClient()
+	orchestrator := New(&Config{ProjectName: "secrets", BaseDir: baseDir, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+	var fetched []string
+	orchestrator.fetchSecret = func(name string) ([]byte, error) {
+		fetched = append(fetched, name)
+		return []byte("api-" + name), nil
+	}
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	containerID := result.Services[0].ContainerID
+
+	expected := map[string]pushedFile{
+		"/run/secrets/tls_key":           {"key-1", proxmox.PushOptions{Perms: "400"}},
+		"/run/secrets/postgres_password": {"hunter2", proxmox.PushOptions{Perms: "440", User: "999"}},
+		"/etc/app/api_key":               {"api-prod/api_key", proxmox.PushOptions{Perms: "400"}},
+	}
+	for dest, want := range expected {
+		if got := client.pushed[fmt.Sprintf("%d %s", containerID, dest)]; got != want {
+			t.Errorf("pushed %s = %+v, want %+v", dest, got, want)
+		}
+	}
+	mkdir := fmt.Sprintf("exec %d mkdir -p /etc/app /run/secrets", containerID)
+	if !strings.Contains(strings.Join(client.calls, "\n"), mkdir) {
+		t.Errorf("calls = %v, want %q", client.calls, mkdir)
+	}
+	if len(fetched) == 0 || fetched[0] != "prod/api_key" {
+		t.Errorf("fetched = %v, want prod/api_key", fetched)
+	}
+
+	// The secrets are pushed again when the stopped container is started
+	client.stopped[containerID] = true
+	client.reset()
+	client.pushed = nil
+	if _, err := orchestrator.Start(context.Background(), stackPath, nil); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	if len(client.pushed) != len(expected) {
+		t.Errorf("pushed after start = %v, want %d secrets", client.pushed, len(expected))
+	}
+
+	// A missing environment variable is an error
+	os.Unsetenv("PXC_TEST_DB_PASSWORD")
+	client.stopped[containerID] = true
+	_, err = orchestrator.Start(context.Background(), stackPath, nil)
+	if err == nil || !strings.Contains(err.Error(), "environment variable PXC_TEST_DB_PASSWORD is not set") {
+		t.Errorf("Start() error = %v, want unset variable error", err)
+	}
+}
+
+func TestRenderConfigTemplate(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    configs: [nginx_conf, static_conf]
+    environment:
+      PORT: "8080"
+      DOMAIN: "from-environment"
+configs:
+  nginx_conf:
+    file: "./nginx.conf"
+    target: "/etc/nginx/nginx.conf"
+    mode: 0640
+    user: "nginx"
+    template: true
+  static_conf:
+    file: "./static.conf"
+    target: "/etc/static.conf"
+`)
+	baseDir := filepath.Dir(stackPath)
+	writeFile := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(baseDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	writeFile("nginx.conf", "listen ${PORT}; server_name ${DOMAIN}; root ${PXC_TEST_ROOT}; set $$host ${HOST:-localhost};")
+	writeFile("static.conf", "listen ${PORT};")
+	t.Setenv("PXC_TEST_ROOT", "/srv")
+
+	client := newFakeClient()
+	orchestrator := New(&Config{
+		ProjectName:      "render",
+		BaseDir:          baseDir,
+		Output:           &bytes.Buffer{},
+		ServiceBuildArgs: map[string]map[string]string{"web": {"DOMAIN": "example.com"}},
+	})
+	orchestrator.client = client
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	containerID := result.Services[0].ContainerID
+
+	expected := map[string]pushedFile{
+		"/etc/nginx/nginx.conf": {"listen 8080; server_name example.com; root /srv; set $host localhost;", proxmox.PushOptions{Perms: "640", User: "nginx"}},
+		"/etc/static.conf":      {"listen ${PORT};", proxmox.PushOptions{}},
+	}
+	for dest, want := range expected {
+		if got := client.pushed[fmt.Sprintf("%d %s", containerID, dest)]; got != want {
+			t.Errorf("pushed %s = %+v, want %+v", dest, got, want)
+		}
+	}
+
+	// A changed variable re-renders the template and reloads the service
+	t.Setenv("PXC_TEST_ROOT", "/var/www")
+	client.reset()
+	result, err = orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	if result.Services[0].Status != "reloaded" {
+		t.Errorf("status after variable change = %q, want %q", result.Services[0].Status, "reloaded")
+	}
+
+	// An unset variable without a default is an error
+	writeFile("nginx.conf", "root ${PXC_TEST_UNSET};")
+	_, err = orchestrator.Up(context.Background(), stackPath)
+	if err == nil || !strings.Contains(err.Error(), "variable 'PXC_TEST_UNSET' is not set") {
+		t.Errorf("Up() error = %v, want unset variable error", err)
+	}
+}
@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// canRenew reports whether a service's containers can be replaced while the
+// old ones keep running. Every ports entry binds a host port, which old and
+// new containers cannot hold at the same time.
+func canRenew(service models.Service) bool {
+	return len(service.Ports) == 0
+}
+
+// renewService replaces a service's running containers without downtime:
+// a batch of new containers is started and must become healthy before the
+// containers it replaces are removed. If a new container fails, the new
+// containers of that batch are removed and the remaining old ones are kept.
+// Services that can't be renewed safely, or have no running containers yet,
+// are updated as usual.
+func (o *Orchestrator) renewService(ctx context.Context, name string, service models.Service, stack *models.LXCStack, projectState *state.ProjectState) ServiceResult {
+	if !canRenew(service) {
+		o.log("Service %s publishes host ports, updating it in place instead of renewing", name)
+		return o.updateService(ctx, name, service, stack, projectState)
+	}
+
+	// Replicas above the scale are removed afterwards instead of renewed
+	replicas := max(service.Scale, 1)
+	var keys []string
+	for _, key := range serviceStateKeys(stack, projectState, name) {
+		if replicaOf(name, key, service).index > replicas {
+			continue
+		}
+		if _, err := o.client.GetContainer(ctx, projectState.Services[key].ContainerID); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return o.updateService(ctx, name, service, stack, projectState)
+	}
+
+	digest, filesDigest, err := o.serviceDigests(name, service, stack)
+	if err != nil {
+		return ServiceResult{Name: name, Error: err}
+	}
+
+	templateName, err := o.ensureTemplate(ctx, name, service)
+	if err != nil {
+		return ServiceResult{Name: name, Error: err}
+	}
+
+	batch := o.batch
+	if batch < 1 {
+		batch = 1
+	}
+
+	result := ServiceResult{Name: name, Status: "renewed"}
+	for start := 0; start < len(keys); start += batch {
+		end := min(start+batch, len(keys))
+
+		replacements, err := o.startReplacements(ctx, name, keys[start:end], templateName, service, stack, reservedContainerIDs(projectState, ""))
+		if err != nil {
+			result.Error = fmt.Errorf("renew aborted, kept the old containers: %w", err)
+			return result
+		}
+
+		for i, key := range keys[start:end] {
+			old := projectState.Services[key].ContainerID
+			o.log("Removing container %d of service %s", old, name)
+			_ = o.client.StopContainer(ctx, old)
+			if err := o.client.DestroyContainer(ctx, old); err != nil {
+				o.logWarning("Failed to remove old container %d: %v", old, err)
+			}
+
+			projectState.Services[key] = state.ServiceState{
+				ContainerID: replacements[i],
+				Digest:      digest,
+				FilesDigest: filesDigest,
+				UpdatedAt:   time.Now(),
+				Node:        o.recordedNode(replacements[i]),
+			}
+		}
+	}
+
+	result.ContainerID = projectState.Services[keys[0]].ContainerID
+	o.logSuccess("Service %s renewed (%d container(s))", name, len(keys))
+
+	// Replicas added by scaling the service up have nothing to replace
+	renewed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		renewed[key] = true
+	}
+	for index := 1; index <= replicas; index++ {
+		r := newReplica(name, index, service)
+		if renewed[r.key] {
+			continue
+		}
+		replicaResult := o.updateReplica(ctx, r, service, stack, projectState)
+		result.Replicas = append(result.Replicas, replicaResult)
+		if replicaResult.Error != nil {
+			result.Error = fmt.Errorf("replica %s: %w", r.label, replicaResult.Error)
+			return result
+		}
+	}
+	return result
+}
+
+// startReplacements starts one new container per key, with IDs that are not
+// reserved, and waits for each to become healthy. On failure the containers
+// started so far are removed.
+func (o *Orchestrator) startReplacements(ctx context.Context, name string, keys []string, templateName string, service models.Service, stack *models.LXCStack, reserved map[int]bool) ([]int, error) {
+	var started []int
+	abort := func(err error) ([]int, error) {
+		for _, containerID := range started {
+			_ = o.client.StopContainer(ctx, containerID)
+			if destroyErr := o.client.DestroyContainer(ctx, containerID); destroyErr != nil {
+				o.logWarning("Failed to remove new container %d: %v", containerID, destroyErr)
+			}
+		}
+		return nil, err
+	}
+
+	for _, key := range keys {
+		containerID, err := o.freeContainerID(ctx, key, reserved)
+		if err != nil {
+			return abort(err)
+		}
+
+		o.log("Starting replacement container %d for %s", containerID, key)
+		_, exists, err := o.launchContainer(ctx, replicaOf(name, key, service), containerID, templateName, service, stack)
+		if exists {
+			started = append(started, containerID)
+		}
+		if err != nil {
+			return abort(fmt.Errorf("replacement for %s: %w", key, err))
+		}
+
+		if health := o.serviceHealth(name, service); health != nil {
+			if err := o.healthCheck(ctx, containerID, health); err != nil {
+				return abort(fmt.Errorf("replacement for %s did not become healthy: %w", key, err))
+			}
+		}
+	}
+	return started, nil
+}
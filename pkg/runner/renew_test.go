@@ -0,0 +1,195 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// setupRenew deploys three recorded web replicas (containers 301-303) and
+// returns a renewing orchestrator whose health checks fail for the
+// containers in unhealthy
+func setupRenew(t *testing.T, stackPath string, batch int, unhealthy map[int]bool) (*Orchestrator, *fakeClient) {
+	t.Helper()
+
+	baseDir := filepath.Dir(stackPath)
+	projectState := &state.ProjectState{Project: "renew", Services: map[string]state.ServiceState{
+		"web":   {ContainerID: 301},
+		"web-2": {ContainerID: 302},
+		"web-3": {ContainerID: 303},
+	}}
+	if err := projectState.Save(state.Path(baseDir, "renew")); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	client := newFakeClient()
+	for _, id := range []int{301, 302, 303} {
+		client.containers[id] = true
+	}
+
+	orchestrator := New(&Config{
+		ProjectName: "renew",
+		BaseDir:     baseDir,
+		Renew:       true,
+		Batch:       batch,
+		Output:      &bytes.Buffer{},
+	})
+	orchestrator.client = client
+	orchestrator.healthCheck = func(_ context.Context, containerID int, health *models.HealthCheck) error {
+		client.record("health %d", containerID)
+		if unhealthy[containerID] {
+			return errors.New("health check timed out")
+		}
+		return nil
+	}
+	return orchestrator, client
+}
+
+// containerIDs returns the container recorded for each web replica
+func containerIDs(t *testing.T, baseDir string) []int {
+	t.Helper()
+
+	projectState, err := state.Load(state.Path(baseDir, "renew"), "renew")
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	var ids []int
+	for _, key := range []string{"web", "web-2", "web-3"} {
+		ids = append(ids, projectState.Services[key].ContainerID)
+	}
+	return ids
+}
+
+const renewStack = `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 3
+    health:
+      test: "curl -f http://localhost/"
+`
+
+func TestRenewRollingReplace(t *testing.T) {
+	tests := []struct {
+		name     string
+		batch    int
+		expected func(n map[string]int) []string
+	}{
+		{
+			name:  "one at a time",
+			batch: 1,
+			expected: func(n map[string]int) []string {
+				return []string{
+					fmt.Sprintf("create %d nginx:latest", n["web"]), fmt.Sprintf("start %d", n["web"]), fmt.Sprintf("health %d", n["web"]),
+					"stop 301", "destroy 301",
+					fmt.Sprintf("create %d nginx:latest", n["web-2"]), fmt.Sprintf("start %d", n["web-2"]), fmt.Sprintf("health %d", n["web-2"]),
+					"stop 302", "destroy 302",
+					fmt.Sprintf("create %d nginx:latest", n["web-3"]), fmt.Sprintf("start %d", n["web-3"]), fmt.Sprintf("health %d", n["web-3"]),
+					"stop 303", "destroy 303",
+				}
+			},
+		},
+		{
+			name:  "batches of two",
+			batch: 2,
+			expected: func(n map[string]int) []string {
+				return []string{
+					fmt.Sprintf("create %d nginx:latest", n["web"]), fmt.Sprintf("start %d", n["web"]), fmt.Sprintf("health %d", n["web"]),
+					fmt.Sprintf("create %d nginx:latest", n["web-2"]), fmt.Sprintf("start %d", n["web-2"]), fmt.Sprintf("health %d", n["web-2"]),
+					"stop 301", "destroy 301", "stop 302", "destroy 302",
+					fmt.Sprintf("create %d nginx:latest", n["web-3"]), fmt.Sprintf("start %d", n["web-3"]), fmt.Sprintf("health %d", n["web-3"]),
+					"stop 303", "destroy 303",
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, renewStack)
+			orchestrator, client := setupRenew(t, stackPath, tt.batch, nil)
+
+			newIDs := make(map[string]int)
+			for _, key := range []string{"web", "web-2", "web-3"} {
+				newIDs[key] = orchestrator.generateContainerID(key)
+			}
+
+			result, err := orchestrator.Up(context.Background(), stackPath)
+			if err != nil {
+				t.Fatalf("Up() unexpected error: %v", err)
+			}
+			if result.Services[0].Status != "renewed" {
+				t.Errorf("Status = %q, want renewed", result.Services[0].Status)
+			}
+
+			expected := tt.expected(newIDs)
+			if strings.Join(client.calls, "\n") != strings.Join(expected, "\n") {
+				t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(client.calls, "\n"), strings.Join(expected, "\n"))
+			}
+
+			ids := containerIDs(t, filepath.Dir(stackPath))
+			want := []int{newIDs["web"], newIDs["web-2"], newIDs["web-3"]}
+			if fmt.Sprint(ids) != fmt.Sprint(want) {
+				t.Errorf("recorded containers = %v, want %v", ids, want)
+			}
+		})
+	}
+}
+
+func TestRenewAbortsOnUnhealthyReplica(t *testing.T) {
+	stackPath := writeStack(t, renewStack)
+	first := New(&Config{ProjectName: "renew"}).generateContainerID("web")
+	second := New(&Config{ProjectName: "renew"}).generateContainerID("web-2")
+	orchestrator, client := setupRenew(t, stackPath, 1, map[int]bool{second: true})
+
+	if _, err := orchestrator.Up(context.Background(), stackPath); err == nil {
+		t.Fatal("Up() expected error for unhealthy replacement, got nil")
+	}
+
+	calls := strings.Join(client.calls, "\n")
+	if !strings.Contains(calls, fmt.Sprintf("destroy %d", second)) {
+		t.Errorf("unhealthy replacement %d was not removed:\n%s", second, calls)
+	}
+	for _, id := range []int{302, 303} {
+		if strings.Contains(calls, fmt.Sprintf("destroy %d", id)) || !client.containers[id] {
+			t.Errorf("old container %d was removed:\n%s", id, calls)
+		}
+	}
+
+	// The replica renewed before the failure keeps its new container
+	ids := containerIDs(t, filepath.Dir(stackPath))
+	if fmt.Sprint(ids) != fmt.Sprint([]int{first, 302, 303}) {
+		t.Errorf("recorded containers = %v, want [%d 302 303]", ids, first)
+	}
+}
+
+func TestRenewSkipsServicesWithHostPorts(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    ports:
+      - "8080:80"
+`)
+	orchestrator, client := setupRenew(t, stackPath, 1, nil)
+
+	if _, err := orchestrator.Up(context.Background(), stackPath); err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+
+	// Without a recorded digest the service is recreated in place: the old
+	// container goes before the new one starts
+	calls := strings.Join(client.calls, "\n")
+	destroy := strings.Index(calls, "destroy 301")
+	create := strings.Index(calls, "create ")
+	if destroy < 0 || create < 0 || destroy > create {
+		t.Errorf("expected in-place recreate (destroy before create):\n%s", calls)
+	}
+}
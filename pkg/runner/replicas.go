@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// replica is one container of a service. Replica 1 is recorded under the
+// service name, so scaling a service up or down keeps its first container;
+// further replicas are recorded as service-N.
+type replica struct {
+	service string // Service name
+	index   int    // 1 to the service's scale
+	key     string // Project state key
+	label   string // Name shown to users: service-N when the service is scaled
+}
+
+// newReplica returns replica index of a service
+func newReplica(name string, index int, service models.Service) replica {
+	r := replica{service: name, index: index, key: name, label: name}
+	if index > 1 {
+		r.key = fmt.Sprintf("%s-%d", name, index)
+	}
+	if service.Scale > 1 || index > 1 {
+		r.label = fmt.Sprintf("%s-%d", name, index)
+	}
+	return r
+}
+
+// replicaOf returns the replica a service's state key belongs to, as listed
+// by serviceStateKeys
+func replicaOf(name, key string, service models.Service) replica {
+	index := 1
+	if suffix, found := strings.CutPrefix(key, name+"-"); found {
+		if n, err := strconv.Atoi(suffix); err == nil {
+			index = n
+		}
+	}
+	return newReplica(name, index, service)
+}
+
+// updateService brings every replica of a service in line with the stack,
+// one after the other. The result of a scaled service carries the results
+// of its replicas; it fails at the first replica that fails, and is
+// unhealthy if any replica is.
+func (o *Orchestrator) updateService(ctx context.Context, name string, service models.Service, stack *models.LXCStack, projectState *state.ProjectState) ServiceResult {
+	replicas := max(service.Scale, 1)
+	if replicas == 1 {
+		return o.updateReplica(ctx, newReplica(name, 1, service), service, stack, projectState)
+	}
+
+	o.log("Deploying %d replicas of service %s", replicas, name)
+	result := ServiceResult{Name: name}
+	for index := 1; index <= replicas; index++ {
+		r := newReplica(name, index, service)
+		replicaResult := o.updateReplica(ctx, r, service, stack, projectState)
+		result.Replicas = append(result.Replicas, replicaResult)
+		if index == 1 {
+			result.ContainerID = replicaResult.ContainerID
+			result.Status = replicaResult.Status
+		}
+		if replicaResult.Status == "unhealthy" {
+			result.Status = "unhealthy"
+		}
+		result.StartTime += replicaResult.StartTime
+		if replicaResult.Error != nil {
+			result.Error = fmt.Errorf("replica %s: %w", r.label, replicaResult.Error)
+			return result
+		}
+	}
+	return result
+}
+
+// replicaPorts returns the host port mappings of a replica
+func replicaPorts(r replica, service models.Service) []string {
+	var ports []string
+	for _, mapping := range service.ReplicaPorts(r.index) {
+		ports = append(ports, mapping.String())
+	}
+	return ports
+}
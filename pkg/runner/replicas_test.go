@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestUpScaledService(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+    scale: 3
+    ports:
+      - "8080:80"
+`)
+	client := newFakeClient()
+	up := func() *DeploymentResult {
+		t.Helper()
+		orchestrator := New(&Config{
+			ProjectName: "shop",
+			BaseDir:     filepath.Dir(stackPath),
+			Output:      &bytes.Buffer{},
+		})
+		orchestrator.client = client
+		client.reset()
+		result, err := orchestrator.Up(context.Background(), stackPath)
+		if err != nil {
+			t.Fatalf("Up() unexpected error: %v", err)
+		}
+		return result
+	}
+
+	result := up()
+	web := result.Services[0]
+	var names, ports []string
+	for _, replica := range web.Replicas {
+		names = append(names, replica.Name)
+		ports = append(ports, replica.Ports...)
+	}
+	if !reflect.DeepEqual(names, []string{"web-1", "web-2", "web-3"}) {
+		t.Errorf("replicas = %v, want [web-1 web-2 web-3]", names)
+	}
+	if !reflect.DeepEqual(ports, []string{"8080:80/tcp", "8081:80/tcp", "8082:80/tcp"}) {
+		t.Errorf("replica ports = %v, want 8080-8082", ports)
+	}
+	if web.Status != "running" || web.ContainerID != web.Replicas[0].ContainerID {
+		t.Errorf("web = %s (container %d), want running as container %d", web.Status, web.ContainerID, web.Replicas[0].ContainerID)
+	}
+
+	statePath := state.Path(filepath.Dir(stackPath), "shop")
+	projectState, err := state.Load(statePath, "shop")
+	if err != nil {
+		t.Fatalf("state.Load() unexpected error: %v", err)
+	}
+	hostnames := map[string]string{"web": "shop-web", "web-2": "shop-web-2", "web-3": "shop-web-3"}
+	seen := make(map[int]bool)
+	for key, hostname := range hostnames {
+		containerID := projectState.Services[key].ContainerID
+		if containerID == 0 || seen[containerID] {
+			t.Fatalf("replica %s has container %d, want its own container: %v", key, containerID, projectState.Services)
+		}
+		seen[containerID] = true
+		if client.hostnames[containerID] != hostname {
+			t.Errorf("replica %s hostname = %q, want %q", key, client.hostnames[containerID], hostname)
+		}
+	}
+
+	// Scaling up adds a replica and leaves the others alone
+	scaled := bytes.Replace(mustRead(t, stackPath), []byte("scale: 3"), []byte("scale: 4"), 1)
+	if err := os.WriteFile(stackPath, scaled, 0644); err != nil {
+		t.Fatalf("Failed to write stack file: %v", err)
+	}
+	result = up()
+	var creates []string
+	for _, call := range client.calls {
+		if strings.HasPrefix(call, "create ") {
+			creates = append(creates, call)
+		}
+	}
+	if len(creates) != 1 {
+		t.Errorf("scaling to 4 created %v, want only web-4", creates)
+	}
+	if replicas := result.Services[0].Replicas; len(replicas) != 4 || replicas[3].Ports[0] != "8083:80/tcp" {
+		t.Errorf("replicas after scaling = %+v, want web-4 on 8083", replicas)
+	}
+}
@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// Kinds of stack resources services depend on
+const (
+	resourceNetwork = "network"
+	resourceVolume  = "volume"
+)
+
+// pendingResource is a network or volume being created in the background.
+// err is set before done is closed.
+type pendingResource struct {
+	kind string
+	name string
+	done chan struct{}
+	err  error
+}
+
+// finished reports whether the creation has completed
+func (p *pendingResource) finished() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// resourceKey identifies a resource, e.g. volume:db-data
+func resourceKey(kind, name string) string {
+	return kind + ":" + name
+}
+
+// startResources starts creating the stack's networks and volumes in the
+// background, so services that need none of them can deploy meanwhile. Each
+// finished creation sends on finished, which must have room for them all.
+func (o *Orchestrator) startResources(ctx context.Context, stack *models.LXCStack, finished chan<- struct{}) map[string]*pendingResource {
+	resources := make(map[string]*pendingResource, len(stack.Networks)+len(stack.Volumes))
+	for name := range stack.Networks {
+		resources[resourceKey(resourceNetwork, name)] = &pendingResource{kind: resourceNetwork, name: name, done: make(chan struct{})}
+	}
+	for name := range stack.Volumes {
+		resources[resourceKey(resourceVolume, name)] = &pendingResource{kind: resourceVolume, name: name, done: make(chan struct{})}
+	}
+
+	for _, pending := range resources {
+		go func(pending *pendingResource) {
+			pending.err = o.createResource(ctx, pending.kind, pending.name, stack)
+			close(pending.done)
+			finished <- struct{}{}
+		}(pending)
+	}
+	return resources
+}
+
+// createStackResource creates a network or volume
+func (o *Orchestrator) createStackResource(ctx context.Context, kind, name string, stack *models.LXCStack) error {
+	if kind == resourceNetwork {
+		return o.createNetwork(ctx, name, stack)
+	}
+	return o.createVolume(name, stack)
+}
+
+// createNetwork creates the SDN vnet of a bridge network unless it exists.
+// Networks on an existing parent bridge, and host and none networks, need
+// nothing created.
+func (o *Orchestrator) createNetwork(ctx context.Context, name string, stack *models.LXCStack) error {
+	network := stack.Networks[name]
+	if !managedNetwork(network) {
+		o.logDebug("Network %s uses bridge %s", name, networkBridge(o.projectName, name, stack))
+		return nil
+	}
+
+	spec, err := sdnNetwork(o.projectName, name, network)
+	if err != nil {
+		return err
+	}
+
+	o.networkMu.Lock()
+	defer o.networkMu.Unlock()
+
+	created, err := o.client.EnsureNetwork(ctx, spec)
+	if err != nil {
+		return err
+	}
+	if created {
+		o.log("Created network %s (SDN vnet %s in zone %s)", name, spec.VNet, spec.Zone)
+	} else {
+		o.logDebug("Network %s uses SDN vnet %s", name, spec.VNet)
+	}
+	return nil
+}
+
+// serviceResources returns the pending creations of the networks and
+// volumes a service needs
+func serviceResources(stack *models.LXCStack, service models.Service, resources map[string]*pendingResource) []*pendingResource {
+	networks, volumes := stack.RequiredResources(service)
+	var needed []*pendingResource
+	for _, name := range networks {
+		if pending, ok := resources[resourceKey(resourceNetwork, name)]; ok {
+			needed = append(needed, pending)
+		}
+	}
+	for _, name := range volumes {
+		if pending, ok := resources[resourceKey(resourceVolume, name)]; ok {
+			needed = append(needed, pending)
+		}
+	}
+	return needed
+}
+
+// resourceError returns the error of the first failed resource in pending
+func resourceError(pending []*pendingResource) error {
+	for _, resource := range pending {
+		if resource.finished() && resource.err != nil {
+			return fmt.Errorf("failed to create %s %s: %w", resource.kind, resource.name, resource.err)
+		}
+	}
+	return nil
+}
+
+// waitResources blocks until every resource is created and records their
+// results, networks and volumes each in name order
+func waitResources(resources map[string]*pendingResource, result *DeploymentResult) {
+	keys := make([]string, 0, len(resources))
+	for key, pending := range resources {
+		<-pending.done
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		pending := resources[key]
+		status := "created"
+		if pending.err != nil {
+			status = "failed"
+		}
+		switch pending.kind {
+		case resourceNetwork:
+			result.Networks = append(result.Networks, NetworkResult{Name: pending.name, Status: status, Error: pending.err})
+		case resourceVolume:
+			result.Volumes = append(result.Volumes, VolumeResult{Name: pending.name, Status: status, Error: pending.err})
+		}
+	}
+}
+
+// failedResource returns the error of the first resource, in name order,
+// that could not be created
+func failedResource(resources map[string]*pendingResource) error {
+	keys := make([]string, 0, len(resources))
+	for key := range resources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pending := make([]*pendingResource, len(keys))
+	for i, key := range keys {
+		pending[i] = resources[key]
+	}
+	return resourceError(pending)
+}
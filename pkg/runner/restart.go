@@ -0,0 +1,401 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// defaultStartRetries bounds how often Restart and Start retry a container
+// that fails to start when its restart policy allows unlimited attempts
+const defaultStartRetries = 3
+
+// lifecycleTarget is a recorded container that Restart, Stop or Start acts on
+type lifecycleTarget struct {
+	key         string // Project state key, e.g. web or web-2
+	name        string // Service name
+	service     models.Service
+	stack       *models.LXCStack
+	containerID int
+}
+
+// lifecycle is what Restart, Stop and Start work on: the recorded
+// containers of the selected services in the order to handle them, and the
+// project state they update
+type lifecycle struct {
+	targets   []lifecycleTarget
+	state     *state.ProjectState
+	statePath string
+}
+
+// loadLifecycle loads the stack and the project state and returns the
+// recorded containers of the given services, or of every service when none
+// are given, in dependency order, or reverse dependency order for stopping.
+// A named service without a recorded container is an error.
+func (o *Orchestrator) loadLifecycle(stackFile string, services []string, reverse bool) (*lifecycle, error) {
+	stack, err := o.loadStack(stackFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stack: %w", err)
+	}
+	o.applyProxmoxSettings(stack)
+	if o.healthOverrides, err = resolveHealthOverrides(stack, o.healthTests, o.noHealth); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(services))
+	for _, name := range services {
+		if _, exists := stack.Services[name]; !exists {
+			return nil, fmt.Errorf("service '%s' is not defined in the stack", name)
+		}
+		selected[name] = true
+	}
+
+	statePath := state.Path(o.baseDir, o.projectName)
+	projectState, err := state.Load(statePath, o.projectName)
+	if err != nil {
+		return nil, err
+	}
+	o.spreadNodes(stack, projectState)
+
+	order, err := stack.GetServiceDependencyOrder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve service dependencies: %w", err)
+	}
+	if reverse {
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	}
+
+	l := &lifecycle{state: projectState, statePath: statePath}
+	for _, name := range order {
+		if len(selected) > 0 && !selected[name] {
+			continue
+		}
+		keys := serviceStateKeys(stack, projectState, name)
+		if len(keys) == 0 && selected[name] {
+			return nil, fmt.Errorf("service '%s' has no container (run 'pxc up' first)", name)
+		}
+		for _, key := range keys {
+			l.targets = append(l.targets, lifecycleTarget{
+				key:         key,
+				name:        name,
+				service:     stack.Services[name],
+				stack:       stack,
+				containerID: projectState.Services[key].ContainerID,
+			})
+		}
+	}
+	return l, nil
+}
+
+// setStopped records whether a container was stopped by 'pxc stop'
+func (l *lifecycle) setStopped(target lifecycleTarget, stopped bool) {
+	recorded := l.state.Services[target.key]
+	recorded.Stopped = stopped
+	l.state.Services[target.key] = recorded
+}
+
+// save writes the project state; a failure is only a warning, as the
+// containers have been handled already
+func (o *Orchestrator) saveLifecycle(l *lifecycle) {
+	if o.dryRun {
+		return
+	}
+	if err := l.state.Save(l.statePath); err != nil {
+		o.logWarning("Failed to save state: %v", err)
+	}
+}
+
+// Restart stops and starts the recorded containers of the given services,
+// or of every service when none are given, in dependency order. Each
+// container is shut down within the stop timeout and, once started again,
+// must pass its service's health check. Restart stops at the first container
+// that fails to restart or stays unhealthy and returns an error; the result
+// lists every container handled until then.
+func (o *Orchestrator) Restart(ctx context.Context, stackFile string, services []string) ([]ServiceResult, error) {
+	l, err := o.loadLifecycle(stackFile, services, false)
+	if err != nil {
+		return nil, err
+	}
+	defer o.saveLifecycle(l)
+
+	var results []ServiceResult
+	for _, target := range l.targets {
+		result := o.restartContainer(ctx, target)
+		if result.Error == nil {
+			l.setStopped(target, false)
+			o.checkStartedHealth(ctx, target, "restart", &result)
+		}
+		results = append(results, result)
+		if result.Error != nil {
+			return results, result.Error
+		}
+		o.logSuccess("Service %s restarted (container %d)", target.key, result.ContainerID)
+	}
+
+	return results, nil
+}
+
+// Stop stops the recorded containers of the given services, or of every
+// service when none are given, in reverse dependency order, giving each the
+// stop timeout to shut down cleanly. The containers are kept and recorded
+// as stopped, so restart policies leave them down until Start or Up starts
+// them again. Stop stops at the first container that fails to stop.
+func (o *Orchestrator) Stop(ctx context.Context, stackFile string, services []string) ([]ServiceResult, error) {
+	l, err := o.loadLifecycle(stackFile, services, true)
+	if err != nil {
+		return nil, err
+	}
+	defer o.saveLifecycle(l)
+
+	var results []ServiceResult
+	for _, target := range l.targets {
+		result := ServiceResult{Name: target.key, ContainerID: target.containerID, Status: "failed"}
+		info, err := o.client.GetContainer(ctx, target.containerID)
+		switch {
+		case err != nil:
+			result.Error = fmt.Errorf("container %d of service %s not found: %w", target.containerID, target.key, err)
+		case info.Status == "stopped":
+			result.Status = "already stopped"
+		default:
+			o.log("Stopping service: %s (container %d)", target.key, target.containerID)
+			if _, err := o.stopContainer(ctx, target.containerID); err != nil {
+				result.Error = fmt.Errorf("failed to stop container %d: %w", target.containerID, err)
+			} else {
+				result.Status = "stopped"
+			}
+		}
+		results = append(results, result)
+		if result.Error != nil {
+			return results, result.Error
+		}
+		l.setStopped(target, true)
+		if result.Status == "stopped" {
+			o.logSuccess("Service %s stopped (container %d)", target.key, target.containerID)
+		}
+	}
+
+	return results, nil
+}
+
+// Start starts the recorded containers of the given services, or of every
+// service when none are given, in dependency order. Containers that are
+// running already are left alone; started ones must pass their service's
+// health check before the next one is started. Start stops at the first
+// container that fails to start or stays unhealthy.
+func (o *Orchestrator) Start(ctx context.Context, stackFile string, services []string) ([]ServiceResult, error) {
+	l, err := o.loadLifecycle(stackFile, services, false)
+	if err != nil {
+		return nil, err
+	}
+	defer o.saveLifecycle(l)
+
+	var results []ServiceResult
+	for _, target := range l.targets {
+		result := ServiceResult{Name: target.key, ContainerID: target.containerID, Status: "failed"}
+		info, err := o.client.GetContainer(ctx, target.containerID)
+		switch {
+		case err != nil:
+			result.Error = fmt.Errorf("container %d of service %s not found: %w", target.containerID, target.key, err)
+		case info.Status == "running":
+			result.Status = "already running"
+		default:
+			o.log("Starting service: %s (container %d)", target.key, target.containerID)
+			if err := o.startContainer(ctx, target); err != nil {
+				result.Error = fmt.Errorf("failed to start container %d: %w", target.containerID, err)
+			} else {
+				result.Status = "started"
+				o.checkStartedHealth(ctx, target, "start", &result)
+			}
+		}
+		if result.Error == nil || result.Status == "unhealthy" {
+			l.setStopped(target, false)
+		}
+		results = append(results, result)
+		if result.Error != nil {
+			return results, result.Error
+		}
+		if result.Status == "started" {
+			o.logSuccess("Service %s started (container %d)", target.key, target.containerID)
+		}
+	}
+
+	return results, nil
+}
+
+// restartContainer stops a container if it is running and starts it again
+func (o *Orchestrator) restartContainer(ctx context.Context, target lifecycleTarget) ServiceResult {
+	name, containerID := target.key, target.containerID
+	result := ServiceResult{Name: name, ContainerID: containerID, Status: "failed"}
+	o.log("Restarting service: %s (container %d)", name, containerID)
+
+	info, err := o.client.GetContainer(ctx, containerID)
+	if err != nil {
+		result.Error = fmt.Errorf("container %d of service %s not found: %w", containerID, name, err)
+		return result
+	}
+
+	if info.Status == "running" {
+		if _, err := o.stopContainer(ctx, containerID); err != nil {
+			result.Error = fmt.Errorf("failed to stop container %d: %w", containerID, err)
+			return result
+		}
+	}
+
+	if err := o.startContainer(ctx, target); err != nil {
+		result.Error = fmt.Errorf("failed to start container %d: %w", containerID, err)
+		return result
+	}
+
+	result.Status = "restarted"
+	return result
+}
+
+// startContainer starts a service container. A start that fails is retried
+// as the service's restart policy allows: not at all with restart: "no",
+// otherwise up to restart_policy.max_attempts times (defaultStartRetries if
+// unlimited), waiting the policy's delay, doubled after each failure.
+// The service's secrets are pushed again once the container runs.
+func (o *Orchestrator) startContainer(ctx context.Context, target lifecycleTarget) error {
+	if err := o.launchStart(ctx, target); err != nil {
+		return err
+	}
+	return o.restoreSecrets(ctx, target.containerID, target.service, target.stack)
+}
+
+// launchStart starts a container, retrying as its restart policy allows
+func (o *Orchestrator) launchStart(ctx context.Context, target lifecycleTarget) error {
+	err := o.client.StartContainer(ctx, target.containerID)
+	if err == nil || !target.service.RestartsOnFailure() {
+		return err
+	}
+
+	policy := target.service.RestartPolicy
+	retries := defaultStartRetries
+	if policy != nil && policy.MaxAttempts > 0 {
+		retries = policy.MaxAttempts
+	}
+	for attempt := 1; attempt <= retries; attempt++ {
+		delay := policy.RestartDelay(attempt)
+		o.logWarning("Container %d of service %s failed to start, retrying in %v (%d/%d): %v",
+			target.containerID, target.key, delay, attempt, retries, err)
+		o.sleep(delay)
+		if err = o.client.StartContainer(ctx, target.containerID); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// checkStartedHealth waits for a container started by action, restart or
+// start, to pass its service's health check, marking the result unhealthy
+// if it does not
+func (o *Orchestrator) checkStartedHealth(ctx context.Context, target lifecycleTarget, action string, result *ServiceResult) {
+	health := o.serviceHealth(target.name, target.service)
+	if health == nil {
+		return
+	}
+	if err := o.healthCheck(ctx, target.containerID, health); err != nil {
+		result.Status = "unhealthy"
+		result.Error = fmt.Errorf("service %s is unhealthy after %s: %w", target.key, action, err)
+	}
+}
+
+// RestartDecision describes what the monitor should do after a failure
+type RestartDecision struct {
+	Restart bool          // Restart the container after Delay
+	Delay   time.Duration // Time to wait before restarting
+	Failed  bool          // Attempts are exhausted; mark the service failed
+}
+
+// RestartTracker applies a service's restart backoff policy to a sequence of
+// failures. It is not safe for concurrent use.
+type RestartTracker struct {
+	policy      *models.RestartPolicy
+	failures    []time.Time // Failures within the policy window
+	consecutive int         // Failures since the last Reset
+	failed      bool
+}
+
+// NewRestartTracker creates a tracker for the given policy (nil means no limits)
+func NewRestartTracker(policy *models.RestartPolicy) *RestartTracker {
+	return &RestartTracker{policy: policy}
+}
+
+// RecordFailure registers a container failure at the given time and decides
+// whether to restart it and after what delay
+func (t *RestartTracker) RecordFailure(now time.Time) RestartDecision {
+	if t.failed {
+		return RestartDecision{Failed: true}
+	}
+
+	// Forget failures that fell out of the counting window; the delay
+	// grows only with the failures still in it
+	if t.policy != nil && t.policy.Window > 0 {
+		recent := t.failures[:0]
+		for _, failure := range t.failures {
+			if now.Sub(failure) < t.policy.Window {
+				recent = append(recent, failure)
+			}
+		}
+		t.failures = recent
+		t.consecutive = min(t.consecutive, len(t.failures))
+	}
+
+	if t.policy != nil && t.policy.MaxAttempts > 0 && len(t.failures) >= t.policy.MaxAttempts {
+		t.failed = true
+		return RestartDecision{Failed: true}
+	}
+
+	t.consecutive++
+	if t.policy != nil && (t.policy.Window > 0 || t.policy.MaxAttempts > 0) {
+		t.failures = append(t.failures, now)
+	}
+	return RestartDecision{Restart: true, Delay: t.policy.RestartDelay(t.consecutive)}
+}
+
+// Reset starts the delay over, e.g. once a restarted container has kept
+// running for a while. Failures within the window still count toward
+// max_attempts.
+func (t *RestartTracker) Reset() {
+	t.consecutive = 0
+}
+
+// Attempts returns the number of restarts since the last Reset
+func (t *RestartTracker) Attempts() int {
+	return t.consecutive
+}
+
+// Failed returns true once the tracker has exhausted its restart attempts
+func (t *RestartTracker) Failed() bool {
+	return t.failed
+}
+
+// startWithBackoff starts a service's container. A start that fails is
+// retried when the service has a restart_policy with max_attempts and a
+// restart policy other than "no": RestartTracker decides the delay before
+// each retry, and the start fails once the attempts are used up.
+func (o *Orchestrator) startWithBackoff(ctx context.Context, name string, containerID int, service models.Service) error {
+	err := o.client.StartContainer(ctx, containerID)
+	policy := service.RestartPolicy
+	if err == nil || !service.RestartsOnFailure() || policy == nil || policy.MaxAttempts == 0 {
+		return err
+	}
+
+	tracker := NewRestartTracker(policy)
+	for attempt := 1; ; attempt++ {
+		decision := tracker.RecordFailure(o.now())
+		if decision.Failed || attempt > policy.MaxAttempts {
+			return fmt.Errorf("gave up after %d attempt(s): %w", attempt, err)
+		}
+		o.logWarning("Container %d of service %s failed to start, retrying in %v: %v", containerID, name, decision.Delay, err)
+		o.sleep(decision.Delay)
+		if err = o.client.StartContainer(ctx, containerID); err == nil {
+			return nil
+		}
+	}
+}
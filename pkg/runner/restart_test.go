@@ -0,0 +1,421 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestRestart(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+  web:
+    template: "nginx:latest"
+    depends_on:
+      - database
+`)
+	baseDir := filepath.Dir(stackPath)
+	projectState := &state.ProjectState{
+		Project: "restart",
+		Services: map[string]state.ServiceState{
+			"database": {ContainerID: 220},
+			"web":      {ContainerID: 221},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		services  []string
+		unhealthy bool
+		errorMsg  string
+		expected  []string
+	}{
+		{
+			name:     "services come back healthy",
+			expected: []string{"shutdown 220 30s", "start 220", "health 220", "shutdown 221 30s", "start 221"},
+		},
+		{
+			name:     "only the named service",
+			services: []string{"web"},
+			expected: []string{"shutdown 221 30s", "start 221"},
+		},
+		{
+			name:      "unhealthy service fails the restart",
+			unhealthy: true,
+			errorMsg:  "service database is unhealthy after restart: health check timed out",
+			expected:  []string{"shutdown 220 30s", "start 220", "health 220"},
+		},
+		{
+			name:     "undefined service",
+			services: []string{"cache"},
+			errorMsg: "service 'cache' is not defined in the stack",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := projectState.Save(state.Path(baseDir, "restart")); err != nil {
+				t.Fatalf("Failed to save state: %v", err)
+			}
+
+			client := newFakeClient()
+			client.containers[220] = true
+			client.containers[221] = true
+			orchestrator := New(&Config{ProjectName: "restart", BaseDir: baseDir, StopTimeout: 30 * time.Second, Output: &bytes.Buffer{}})
+			orchestrator.client = client
+			orchestrator.healthCheck = func(_ context.Context, containerID int, health *models.HealthCheck) error {
+				client.record("health %d", containerID)
+				if tt.unhealthy {
+					return errors.New("health check timed out")
+				}
+				return nil
+			}
+
+			results, err := orchestrator.Restart(context.Background(), stackPath, tt.services)
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Errorf("Restart() error = %v, want %q", err, tt.errorMsg)
+				}
+			} else if err != nil {
+				t.Fatalf("Restart() unexpected error: %v", err)
+			}
+
+			if strings.Join(client.calls, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("calls = %q, want %q", client.calls, tt.expected)
+			}
+			if tt.unhealthy && (len(results) != 1 || results[0].Status != "unhealthy") {
+				t.Errorf("results = %+v, want database unhealthy", results)
+			}
+		})
+	}
+}
+
+func TestStopStart(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    health:
+      test: "pg_isready"
+  web:
+    template: "nginx:latest"
+    scale: 2
+    depends_on:
+      - database
+`)
+	baseDir := filepath.Dir(stackPath)
+	statePath := state.Path(baseDir, "lifecycle")
+	projectState := &state.ProjectState{
+		Project: "lifecycle",
+		Services: map[string]state.ServiceState{
+			"database": {ContainerID: 230},
+			"web":      {ContainerID: 231},
+			"web-2":    {ContainerID: 232},
+		},
+	}
+	if err := projectState.Save(statePath); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	client := newFakeClient()
+	for _, id := range []int{230, 231, 232} {
+		client.containers[id] = true
+	}
+	orchestrator := New(&Config{ProjectName: "lifecycle", BaseDir: baseDir, StopTimeout: 30 * time.Second, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+	orchestrator.healthCheck = func(_ context.Context, containerID int, health *models.HealthCheck) error {
+		client.record("health %d", containerID)
+		return nil
+	}
+
+	stopped := func() []string {
+		t.Helper()
+		loaded, err := state.Load(statePath, "lifecycle")
+		if err != nil {
+			t.Fatalf("Failed to load state: %v", err)
+		}
+		var keys []string
+		for _, key := range []string{"database", "web", "web-2"} {
+			if loaded.Services[key].Stopped {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+
+	// Dependents stop first
+	if _, err := orchestrator.Stop(context.Background(), stackPath, nil); err != nil {
+		t.Fatalf("Stop() unexpected error: %v", err)
+	}
+	expected := []string{"shutdown 231 30s", "shutdown 232 30s", "shutdown 230 30s"}
+	if strings.Join(client.calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Stop() calls = %q, want %q", client.calls, expected)
+	}
+	if got := stopped(); strings.Join(got, ",") != "database,web,web-2" {
+		t.Errorf("stopped = %v, want every container", got)
+	}
+
+	// Starting web alone starts both replicas and leaves the database down
+	client.reset()
+	results, err := orchestrator.Start(context.Background(), stackPath, []string{"web"})
+	if err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	expected = []string{"start 231", "start 232"}
+	if strings.Join(client.calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Start() calls = %q, want %q", client.calls, expected)
+	}
+	if len(results) != 2 || results[1].Name != "web-2" || results[1].Status != "started" {
+		t.Errorf("Start() results = %+v, want web and web-2 started", results)
+	}
+	if got := stopped(); strings.Join(got, ",") != "database" {
+		t.Errorf("stopped = %v, want only database", got)
+	}
+
+	// Starting everything starts the database, checks its health and skips
+	// the running replicas
+	client.reset()
+	results, err = orchestrator.Start(context.Background(), stackPath, nil)
+	if err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	expected = []string{"start 230", "health 230"}
+	if strings.Join(client.calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Start() calls = %q, want %q", client.calls, expected)
+	}
+	if len(results) != 3 || results[1].Status != "already running" {
+		t.Errorf("Start() results = %+v, want web already running", results)
+	}
+	if got := stopped(); len(got) != 0 {
+		t.Errorf("stopped = %v, want none", got)
+	}
+}
+
+func TestStartRetriesPerRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		expected []time.Duration
+	}{
+		{
+			name:   "restart no does not retry",
+			policy: `restart: "no"`,
+		},
+		{
+			name:     "default policy retries with doubling delay",
+			policy:   `restart: "unless-stopped"`,
+			expected: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name: "restart_policy limits attempts and sets the delay",
+			policy: `restart: "on-failure"
+    restart_policy:
+      max_attempts: 2
+      delay: 5s`,
+			expected: []time.Duration{5 * time.Second, 10 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, `version: "1.0"
+services:
+  worker:
+    template: "python:3.11"
+    `+tt.policy+`
+`)
+			baseDir := filepath.Dir(stackPath)
+			projectState := &state.ProjectState{Project: "retry", Services: map[string]state.ServiceState{"worker": {ContainerID: 240}}}
+			if err := projectState.Save(state.Path(baseDir, "retry")); err != nil {
+				t.Fatalf("Failed to save state: %v", err)
+			}
+
+			client := newFakeClient()
+			client.containers[240] = true
+			client.stopped[240] = true
+			client.fail = map[string]error{"start 240": errors.New("startup for container '240' failed")}
+			orchestrator := New(&Config{ProjectName: "retry", BaseDir: baseDir, Output: &bytes.Buffer{}})
+			orchestrator.client = client
+			var delays []time.Duration
+			orchestrator.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+			_, err := orchestrator.Start(context.Background(), stackPath, nil)
+			if err == nil || !strings.Contains(err.Error(), "startup for container '240' failed") {
+				t.Errorf("Start() error = %v, want the start failure", err)
+			}
+			if strings.Join(client.calls, ",") != strings.Repeat("start 240,", len(tt.expected))+"start 240" {
+				t.Errorf("calls = %q, want %d start attempts", client.calls, len(tt.expected)+1)
+			}
+			if fmt.Sprint(delays) != fmt.Sprint(tt.expected) {
+				t.Errorf("delays = %v, want %v", delays, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRestartTracker(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		policy   *models.RestartPolicy
+		failures []time.Duration // offsets from base
+		expected []RestartDecision
+	}{
+		{
+			name:     "no policy restarts with growing delay",
+			policy:   nil,
+			failures: []time.Duration{0, time.Second, 2 * time.Second},
+			expected: []RestartDecision{
+				{Restart: true, Delay: time.Second},
+				{Restart: true, Delay: 2 * time.Second},
+				{Restart: true, Delay: 4 * time.Second},
+			},
+		},
+		{
+			name:     "attempt cap marks service failed",
+			policy:   &models.RestartPolicy{MaxAttempts: 2, Delay: 5 * time.Second},
+			failures: []time.Duration{0, 10 * time.Second, 20 * time.Second, 30 * time.Second},
+			expected: []RestartDecision{
+				{Restart: true, Delay: 5 * time.Second},
+				{Restart: true, Delay: 10 * time.Second},
+				{Failed: true},
+				{Failed: true},
+			},
+		},
+		{
+			name:     "failures outside window are forgotten",
+			policy:   &models.RestartPolicy{MaxAttempts: 2, Window: time.Minute, Delay: time.Second},
+			failures: []time.Duration{0, 10 * time.Second, 2 * time.Minute, 2*time.Minute + 5*time.Second},
+			expected: []RestartDecision{
+				{Restart: true, Delay: time.Second},
+				{Restart: true, Delay: 2 * time.Second},
+				{Restart: true, Delay: time.Second},
+				{Restart: true, Delay: 2 * time.Second},
+			},
+		},
+		{
+			name:     "window cap within burst",
+			policy:   &models.RestartPolicy{MaxAttempts: 2, Window: time.Minute, Delay: time.Second},
+			failures: []time.Duration{0, 10 * time.Second, 20 * time.Second},
+			expected: []RestartDecision{
+				{Restart: true, Delay: time.Second},
+				{Restart: true, Delay: 2 * time.Second},
+				{Failed: true},
+			},
+		},
+		{
+			name:     "delay is capped",
+			policy:   &models.RestartPolicy{Delay: 2 * time.Minute},
+			failures: []time.Duration{0, time.Second, 2 * time.Second},
+			expected: []RestartDecision{
+				{Restart: true, Delay: 2 * time.Minute},
+				{Restart: true, Delay: 4 * time.Minute},
+				{Restart: true, Delay: models.MaxRestartDelay},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewRestartTracker(tt.policy)
+
+			for i, offset := range tt.failures {
+				got := tracker.RecordFailure(base.Add(offset))
+				if got != tt.expected[i] {
+					t.Errorf("failure %d: RecordFailure() = %+v, want %+v", i+1, got, tt.expected[i])
+				}
+			}
+
+			wantFailed := tt.expected[len(tt.expected)-1].Failed
+			if tracker.Failed() != wantFailed {
+				t.Errorf("Failed() = %v, want %v", tracker.Failed(), wantFailed)
+			}
+		})
+	}
+}
+
+func TestRestartTrackerReset(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewRestartTracker(&models.RestartPolicy{MaxAttempts: 3, Window: time.Hour})
+
+	tracker.RecordFailure(base)
+	tracker.RecordFailure(base.Add(time.Minute))
+	tracker.Reset()
+
+	// The delay starts over, but the earlier failures still count
+	if got := tracker.RecordFailure(base.Add(2 * time.Minute)); got != (RestartDecision{Restart: true, Delay: time.Second}) {
+		t.Errorf("RecordFailure() after Reset = %+v, want a restart after 1s", got)
+	}
+	if got := tracker.RecordFailure(base.Add(3 * time.Minute)); !got.Failed {
+		t.Errorf("RecordFailure() = %+v, want the attempts exhausted", got)
+	}
+}
+
+func TestUpRetriesFailedStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		expected []time.Duration
+	}{
+		{
+			name:   "without max_attempts the start is not retried",
+			policy: `restart: "on-failure"`,
+		},
+		{
+			name: "restart_policy retries with growing delay",
+			policy: `restart: "on-failure"
+    restart_policy:
+      max_attempts: 2
+      delay: 5s`,
+			expected: []time.Duration{5 * time.Second, 10 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, `version: "1.0"
+services:
+  worker:
+    template: "python:3.11"
+    `+tt.policy+`
+`)
+			orchestrator := New(&Config{ProjectName: "retry", BaseDir: t.TempDir(), Output: &bytes.Buffer{}})
+			containerID := orchestrator.generateContainerID("worker")
+			client := newFakeClient()
+			client.fail = map[string]error{fmt.Sprintf("start %d", containerID): errors.New("startup failed")}
+			orchestrator.client = client
+			var delays []time.Duration
+			orchestrator.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+			_, err := orchestrator.Up(context.Background(), stackPath)
+			if err == nil || !strings.Contains(err.Error(), "startup failed") {
+				t.Fatalf("Up() error = %v, want the start failure", err)
+			}
+			starts := 0
+			for _, call := range client.calls {
+				if call == fmt.Sprintf("start %d", containerID) {
+					starts++
+				}
+			}
+			if starts != len(tt.expected)+1 {
+				t.Errorf("start attempts = %d, want %d", starts, len(tt.expected)+1)
+			}
+			if fmt.Sprint(delays) != fmt.Sprint(tt.expected) {
+				t.Errorf("delays = %v, want %v", delays, tt.expected)
+			}
+		})
+	}
+}
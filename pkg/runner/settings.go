@@ -0,0 +1,42 @@
+package runner
+
+import (
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/builder"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// applyProxmoxSettings resolves the target node and storages for a stack:
+// flags and environment first, then the stack's settings.proxmox, then the
+// config files. The builder is recreated to build on the resolved target,
+// as is the API client with the API transport.
+func (o *Orchestrator) applyProxmoxSettings(stack *models.LXCStack) {
+	var pinned models.ProxmoxConfig
+	if stack != nil && stack.Settings != nil && stack.Settings.Proxmox != nil {
+		pinned = *stack.Settings.Proxmox
+	}
+
+	o.node = firstSetting(o.overrides.Node, pinned.Node, o.defaults.Node)
+	o.storage = firstSetting(o.overrides.Storage, pinned.Storage, o.defaults.Storage)
+	o.templateStorage = firstSetting(o.overrides.TemplateStorage, pinned.TemplateStorage, o.defaults.TemplateStorage)
+
+	config := o.builderConfig
+	config.ProxmoxNode = o.node
+	config.Storage = o.storage
+	config.TemplateStorage = o.templateStorage
+	o.builder = builder.New(&config)
+
+	if o.api != nil {
+		o.client = proxmox.NewAPIClient(o.node, *o.api, o.verbose, o.dryRun).WithLogger(o.logger)
+	}
+}
+
+// firstSetting returns the first non-empty value
+func firstSetting(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestApplyProxmoxSettings(t *testing.T) {
+	pinned := &models.ProxmoxConfig{Node: "stack-node", Storage: "stack-storage"}
+	defaults := models.ProxmoxConfig{Node: "config-node", Storage: "config-storage", TemplateStorage: "config-templates"}
+
+	tests := []struct {
+		name     string
+		config   Config
+		pinned   *models.ProxmoxConfig
+		wantNode string
+		want     [2]string // storage, template storage
+	}{
+		{
+			name:     "stack settings over config files",
+			config:   Config{ProxmoxDefaults: defaults},
+			pinned:   pinned,
+			wantNode: "stack-node",
+			want:     [2]string{"stack-storage", "config-templates"},
+		},
+		{
+			name:     "flags over stack settings",
+			config:   Config{ProxmoxNode: "flag-node", TemplateStorage: "flag-templates", ProxmoxDefaults: defaults},
+			pinned:   pinned,
+			wantNode: "flag-node",
+			want:     [2]string{"stack-storage", "flag-templates"},
+		},
+		{
+			name:     "config files without stack settings",
+			config:   Config{ProxmoxDefaults: defaults},
+			wantNode: "config-node",
+			want:     [2]string{"config-storage", "config-templates"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Output = &bytes.Buffer{}
+			orchestrator := New(&tt.config)
+			orchestrator.client = newFakeClient()
+
+			stack := &models.LXCStack{
+				Services: map[string]models.Service{"web": {Template: "nginx:latest"}},
+				Settings: &models.Settings{Proxmox: tt.pinned},
+			}
+			orchestrator.applyProxmoxSettings(stack)
+
+			if orchestrator.node != tt.wantNode {
+				t.Errorf("node = %q, want %q", orchestrator.node, tt.wantNode)
+			}
+			if got := [2]string{orchestrator.storage, orchestrator.templateStorage}; got != tt.want {
+				t.Errorf("storage, template storage = %q, want %q", got, tt.want)
+			}
+
+			// The preflight checks the node the stack is deployed to
+			var checked string
+			orchestrator.nodeCapacity = func(node, storage string) (*proxmox.NodeCapacity, error) {
+				checked = node + "/" + storage
+				return &proxmox.NodeCapacity{MemoryTotalMB: 65536, MemoryFreeMB: 65536, Cores: 64, DiskFreeGB: 1024}, nil
+			}
+			projectState := &state.ProjectState{Services: map[string]state.ServiceState{}}
+			if err := orchestrator.preflight(context.Background(), stack, projectState, []string{"web"}); err != nil {
+				t.Fatalf("preflight() unexpected error: %v", err)
+			}
+			if want := tt.wantNode + "/" + tt.want[0]; checked != want {
+				t.Errorf("nodeCapacity(%s), want %s", checked, want)
+			}
+		})
+	}
+}
+
+func TestLifecycleAppliesProxmoxSettings(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    template: "nginx:latest"
+settings:
+  proxmox:
+    node: stack-node
+    storage: stack-storage
+`)
+
+	operations := map[string]func(o *Orchestrator) error{
+		"down": func(o *Orchestrator) error {
+			_, err := o.Down(context.Background(), stackPath, false)
+			return err
+		},
+		"stop": func(o *Orchestrator) error {
+			_, err := o.Stop(context.Background(), stackPath, nil)
+			return err
+		},
+		"orphans": func(o *Orchestrator) error {
+			_, err := o.FindOrphans(context.Background(), stackPath)
+			return err
+		},
+	}
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			orchestrator := New(&Config{ProjectName: "settings", BaseDir: filepath.Dir(stackPath), Output: &bytes.Buffer{}})
+			orchestrator.client = newFakeClient()
+			if err := operation(orchestrator); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if orchestrator.node != "stack-node" || orchestrator.storage != "stack-storage" {
+				t.Errorf("node, storage = %q, %q, want the stack's settings", orchestrator.node, orchestrator.storage)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// DefaultSuperviseInterval is how often a Supervisor checks its containers
+const DefaultSuperviseInterval = 5 * time.Second
+
+// restartResetAfter is how long a restarted container must keep running
+// before its next failure is treated as the first again
+const restartResetAfter = 10 * time.Second
+
+// Supervisor enforces the restart policies of a deployed stack: it polls
+// the containers 'pxc up' recorded and starts the stopped ones whose policy
+// says so. LXC reports no exit status, so a container that stops without
+// 'pxc stop' counts as failed:
+//   - no: never restarted
+//   - on-failure, unless-stopped: restarted unless stopped with 'pxc stop'
+//   - always: restarted unless stopped with 'pxc stop' while the supervisor
+//     runs; containers stopped that way before it started are restarted too
+//
+// A restart waits restart_policy.delay, doubled after each consecutive
+// failure, and a container that reaches restart_policy.max_attempts
+// restarts within the window is given up on.
+type Supervisor struct {
+	o         *Orchestrator
+	stackFile string
+	services  map[string]bool
+	interval  time.Duration
+
+	tracks map[string]*restartTrack
+	polled bool
+}
+
+// restartTrack is what a Supervisor knows of one container's restarts
+type restartTrack struct {
+	containerID  int
+	tracker      *RestartTracker
+	due          time.Time // When the pending restart is due
+	runningSince time.Time
+
+	// ignoreStop restarts an always container that was stopped with
+	// 'pxc stop' before the supervisor started
+	ignoreStop bool
+}
+
+// NewSupervisor returns a supervisor for the containers of the given
+// services, or of every service when none are given, checking them every
+// interval (default DefaultSuperviseInterval)
+func (o *Orchestrator) NewSupervisor(stackFile string, services []string, interval time.Duration) *Supervisor {
+	if interval <= 0 {
+		interval = DefaultSuperviseInterval
+	}
+	s := &Supervisor{
+		o:         o,
+		stackFile: stackFile,
+		services:  make(map[string]bool, len(services)),
+		interval:  interval,
+		tracks:    make(map[string]*restartTrack),
+	}
+	for _, name := range services {
+		s.services[name] = true
+	}
+	return s
+}
+
+// Poll checks every supervised container once, restarting those that are
+// due. The stack and the project state are read again on every poll, so
+// redeployed and stopped services are picked up.
+func (s *Supervisor) Poll(ctx context.Context) error {
+	stack, err := s.o.loadStack(s.stackFile)
+	if err != nil {
+		return fmt.Errorf("failed to load stack: %w", err)
+	}
+	s.o.applyProxmoxSettings(stack)
+	for name := range s.services {
+		if _, exists := stack.Services[name]; !exists {
+			return fmt.Errorf("service '%s' is not defined in the stack", name)
+		}
+	}
+	projectState, err := state.Load(state.Path(s.o.baseDir, s.o.projectName), s.o.projectName)
+	if err != nil {
+		return err
+	}
+	s.o.spreadNodes(stack, projectState)
+
+	first := !s.polled
+	s.polled = true
+
+	names := make([]string, 0, len(stack.Services))
+	for name := range stack.Services {
+		if len(s.services) == 0 || s.services[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs []error
+	seen := make(map[string]bool)
+	for _, name := range names {
+		service := stack.Services[name]
+		for _, key := range serviceStateKeys(stack, projectState, name) {
+			seen[key] = true
+			if err := s.check(ctx, key, service, stack, projectState.Services[key], first); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	// Containers removed by 'pxc down' or a scale-down are forgotten
+	for key := range s.tracks {
+		if !seen[key] {
+			delete(s.tracks, key)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check handles one container: a running one is left alone, a stopped one
+// is restarted once its delay has passed, if its policy allows it
+func (s *Supervisor) check(ctx context.Context, key string, service models.Service, stack *models.LXCStack, recorded state.ServiceState, first bool) error {
+	track := s.tracks[key]
+	if track == nil || track.containerID != recorded.ContainerID {
+		// A recreated container starts with a clean slate
+		track = &restartTrack{containerID: recorded.ContainerID, tracker: NewRestartTracker(service.RestartPolicy)}
+		s.tracks[key] = track
+	}
+	now := s.o.now()
+
+	info, err := s.o.client.GetContainer(ctx, recorded.ContainerID)
+	if errors.Is(err, proxmox.ErrContainerNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check container %d of service %s: %w", recorded.ContainerID, key, err)
+	}
+
+	if info.Status == "running" {
+		track.due = time.Time{}
+		track.ignoreStop = false
+		if track.tracker.Failed() {
+			// Started by hand after the supervisor gave up on it
+			track.tracker = NewRestartTracker(service.RestartPolicy)
+		}
+		if track.runningSince.IsZero() {
+			track.runningSince = now
+		}
+		if now.Sub(track.runningSince) >= restartResetAfter {
+			track.tracker.Reset()
+		}
+		return nil
+	}
+	track.runningSince = time.Time{}
+
+	if first && recorded.Stopped && service.RestartPolicyName() == "always" {
+		track.ignoreStop = true
+	}
+	if !restartDue(service.RestartPolicyName(), recorded.Stopped && !track.ignoreStop) || track.tracker.Failed() {
+		track.due = time.Time{}
+		return nil
+	}
+
+	if track.due.IsZero() {
+		decision := track.tracker.RecordFailure(now)
+		if decision.Failed {
+			return fmt.Errorf("service %s failed: container %d was restarted %d time(s) and is %s again, giving up",
+				key, recorded.ContainerID, service.RestartPolicy.MaxAttempts, info.Status)
+		}
+		track.due = now.Add(decision.Delay)
+		s.o.logWarning("Container %d of service %s is %s, restarting in %v", recorded.ContainerID, key, info.Status, decision.Delay)
+		return nil
+	}
+	if now.Before(track.due) {
+		return nil
+	}
+
+	track.due = time.Time{}
+	s.o.log("Restarting service %s (container %d, attempt %d)", key, recorded.ContainerID, track.tracker.Attempts())
+	if err := s.o.client.StartContainer(ctx, recorded.ContainerID); err != nil {
+		return fmt.Errorf("failed to restart container %d of service %s: %w", recorded.ContainerID, key, err)
+	}
+	if err := s.o.restoreSecrets(ctx, recorded.ContainerID, service, stack); err != nil {
+		return fmt.Errorf("failed to push secrets of service %s: %w", key, err)
+	}
+	s.o.logSuccess("Service %s restarted (container %d)", key, recorded.ContainerID)
+	return nil
+}
+
+// restartDue reports whether a stopped container is restarted under a
+// restart policy; stopped is set for containers stopped with 'pxc stop'
+func restartDue(policy string, stopped bool) bool {
+	return policy != "no" && !stopped
+}
+
+// Run polls until ctx is cancelled, passing every failed poll to onError;
+// a poll cut short by the cancellation is not reported
+func (s *Supervisor) Run(ctx context.Context, onError func(error)) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := s.Poll(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+
+		timer := time.NewTimer(s.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
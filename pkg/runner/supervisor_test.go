@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestSupervisorPoll(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		stopped  bool // Recorded as stopped by 'pxc stop'
+		crashes  int  // Times the container stops again right after a restart
+		expected []time.Duration
+		errorMsg string
+	}{
+		{
+			name:     "failed container restarts with doubling delay",
+			policy:   `restart: "unless-stopped"`,
+			crashes:  2,
+			expected: []time.Duration{time.Second, 4 * time.Second, 9 * time.Second},
+		},
+		{
+			name:   "restart no leaves it down",
+			policy: `restart: "no"`,
+		},
+		{
+			name:    "unless-stopped leaves a stopped service down",
+			policy:  `restart: "unless-stopped"`,
+			stopped: true,
+		},
+		{
+			name:     "always restarts a service stopped before supervising",
+			policy:   `restart: "always"`,
+			stopped:  true,
+			expected: []time.Duration{time.Second},
+		},
+		{
+			name: "gives up after max_attempts",
+			policy: `restart: "on-failure"
+    restart_policy:
+      max_attempts: 1`,
+			crashes:  5,
+			expected: []time.Duration{time.Second},
+			errorMsg: "service worker failed: container 250 was restarted 1 time(s) and is stopped again, giving up",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stackPath := writeStack(t, `version: "1.0"
+services:
+  worker:
+    template: "python:3.11"
+    `+tt.policy+`
+`)
+			baseDir := filepath.Dir(stackPath)
+			projectState := &state.ProjectState{Project: "supervise", Services: map[string]state.ServiceState{
+				"worker": {ContainerID: 250, Stopped: tt.stopped},
+			}}
+			if err := projectState.Save(state.Path(baseDir, "supervise")); err != nil {
+				t.Fatalf("Failed to save state: %v", err)
+			}
+
+			client := newFakeClient()
+			client.containers[250] = true
+			client.stopped[250] = true
+			crashes := tt.crashes
+			client.onStart = func(vmid int) {
+				if crashes > 0 {
+					crashes--
+					client.stopped[vmid] = true
+				}
+			}
+			orchestrator := New(&Config{ProjectName: "supervise", BaseDir: baseDir, Output: &bytes.Buffer{}})
+			orchestrator.client = client
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			now := start
+			orchestrator.now = func() time.Time { return now }
+
+			supervisor := orchestrator.NewSupervisor(stackPath, nil, time.Second)
+			var restarts []time.Duration
+			var errs []string
+			for step := 0; step <= 10; step++ {
+				now = start.Add(time.Duration(step) * time.Second)
+				client.reset()
+				if err := supervisor.Poll(context.Background()); err != nil {
+					errs = append(errs, err.Error())
+				}
+				for _, call := range client.calls {
+					if strings.HasPrefix(call, "start ") {
+						restarts = append(restarts, now.Sub(start))
+					}
+				}
+			}
+
+			if fmt.Sprint(restarts) != fmt.Sprint(tt.expected) {
+				t.Errorf("restarts at %v, want %v", restarts, tt.expected)
+			}
+			if tt.errorMsg == "" && len(errs) > 0 {
+				t.Errorf("Poll() unexpected errors: %v", errs)
+			}
+			if tt.errorMsg != "" && (len(errs) != 1 || errs[0] != tt.errorMsg) {
+				t.Errorf("Poll() errors = %q, want once %q", errs, tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestSupervisorRunStopsWhileWaiting(t *testing.T) {
+	orchestrator := New(&Config{ProjectName: "supervise", BaseDir: t.TempDir(), Output: &bytes.Buffer{}})
+	supervisor := orchestrator.NewSupervisor(filepath.Join(t.TempDir(), "missing.yml"), nil, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	polls := 0
+	go func() {
+		supervisor.Run(ctx, func(error) {
+			polls++
+			if polls == 1 {
+				cancel()
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() kept waiting for the next poll after its context was cancelled")
+	}
+	if polls != 1 {
+		t.Errorf("polls = %d, want 1", polls)
+	}
+}
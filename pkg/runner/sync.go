@@ -0,0 +1,175 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+// SyncRule is a host file or directory that the LXCfile of a service
+// copies into its template, which pxc watch pushes into the service's
+// running containers as it changes
+type SyncRule struct {
+	Service string
+	Source  string // Host path
+	Dest    string // Path in the container
+	Owner   string // USER[:GROUP] of the copy step
+	Mode    string // chmod mode of the copy step
+}
+
+// Name identifies the rule to a Watcher
+func (r SyncRule) Name() string {
+	return r.Service + ":" + r.Dest
+}
+
+// SyncRules returns the copy steps of the LXCfiles of the build-based
+// services among services, or of every one if services is empty. Copies
+// from build stages, of sources using build arguments and to paths the
+// service bind-mounts something over, such as the source directories
+// pxc up --dev mounts, are left out: there is nothing to push for them.
+func SyncRules(stack *models.LXCStack, services []string) ([]SyncRule, error) {
+	contexts := WatchContexts(stack, services)
+	names := make([]string, 0, len(contexts))
+	for name := range contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rules []SyncRule
+	for _, name := range names {
+		service := stack.Services[name]
+		buildConfig := service.GetBuildConfig()
+		lxcfilePath := filepath.Join(buildConfig.Context, "LXCfile.yml")
+		if buildConfig.Dockerfile != "" {
+			lxcfilePath = filepath.Join(buildConfig.Context, buildConfig.Dockerfile)
+		}
+		lxcfile, err := config.LoadLXCfile(lxcfilePath)
+		if err != nil {
+			return nil, fmt.Errorf("service '%s': %w", name, err)
+		}
+
+		mounted := make(map[string]bool)
+		for _, volume := range service.Volumes {
+			mounted[models.ParseVolumeMount(volume).Target] = true
+		}
+		for _, step := range lxcfile.Setup {
+			if step.Copy == nil || step.Copy.From != "" || strings.Contains(step.Copy.Source, "$") || mounted[step.Copy.Dest] {
+				continue
+			}
+			if _, err := os.Stat(step.Copy.Source); err != nil {
+				continue
+			}
+			rules = append(rules, SyncRule{Service: name, Source: step.Copy.Source, Dest: step.Copy.Dest, Owner: step.Copy.Owner, Mode: step.Copy.Mode})
+		}
+	}
+	return rules, nil
+}
+
+// SyncFiles pushes files changed under a rule's source, given relative to
+// it as a Watcher reports them, into every deployed replica of the rule's
+// service, and removes the files deleted on the host. Replicas are signaled
+// with the service's reload_signal afterwards. Every replica is attempted;
+// the errors are joined.
+func (o *Orchestrator) SyncFiles(ctx context.Context, stackFile string, rule SyncRule, files []string) error {
+	stack, err := o.loadStack(stackFile)
+	if err != nil {
+		return fmt.Errorf("failed to load stack: %w", err)
+	}
+	o.applyProxmoxSettings(stack)
+	service, exists := stack.Services[rule.Service]
+	if !exists {
+		return fmt.Errorf("service '%s' is not defined in the stack", rule.Service)
+	}
+	projectState, err := state.Load(state.Path(o.baseDir, o.projectName), o.projectName)
+	if err != nil {
+		return err
+	}
+	o.spreadNodes(stack, projectState)
+
+	keys := serviceStateKeys(stack, projectState, rule.Service)
+	if len(keys) == 0 {
+		return fmt.Errorf("service '%s' is not deployed", rule.Service)
+	}
+
+	var errs []string
+	for _, key := range keys {
+		containerID := projectState.Services[key].ContainerID
+		if err := o.syncContainer(ctx, containerID, rule, files); err != nil {
+			errs = append(errs, fmt.Sprintf("%s (container %d): %v", key, containerID, err))
+			continue
+		}
+		if service.ReloadSignal == "" {
+			continue
+		}
+		signal := strings.TrimPrefix(strings.ToUpper(service.ReloadSignal), "SIG")
+		if err := o.client.ExecCommand(ctx, containerID, []string{"kill", "-s", signal, "1"}); err != nil {
+			errs = append(errs, fmt.Sprintf("%s (container %d): failed to send reload signal: %v", key, containerID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to sync %s: %s", rule.Dest, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// syncContainer pushes or removes the changed files of a rule in one
+// container. A single file copied to a directory, a dest ending in /, keeps
+// its name, and the copy step's mode is applied to every pushed file.
+func (o *Orchestrator) syncContainer(ctx context.Context, containerID int, rule SyncRule, files []string) error {
+	info, err := os.Stat(rule.Source)
+	if err != nil {
+		return err
+	}
+	user, group, _ := strings.Cut(rule.Owner, ":")
+
+	created := make(map[string]bool)
+	for _, file := range files {
+		source, dest := rule.Source, rule.Dest
+		switch {
+		case info.IsDir():
+			source = filepath.Join(rule.Source, filepath.FromSlash(file))
+			dest = path.Join(rule.Dest, file)
+		case strings.HasSuffix(rule.Dest, "/"):
+			dest = path.Join(rule.Dest, filepath.Base(rule.Source))
+		}
+
+		fileInfo, err := os.Stat(source)
+		if os.IsNotExist(err) {
+			o.log("Removing %s from container %d", dest, containerID)
+			if err := o.client.ExecCommand(ctx, containerID, []string{"rm", "-f", dest}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if parent := path.Dir(dest); !created[parent] {
+			if err := o.client.ExecCommand(ctx, containerID, []string{"mkdir", "-p", parent}); err != nil {
+				return err
+			}
+			created[parent] = true
+		}
+		o.log("Pushing %s to %s in container %d", source, dest, containerID)
+		opts := proxmox.PushOptions{Perms: fmt.Sprintf("%o", fileInfo.Mode().Perm()), User: user, Group: group}
+		if err := o.client.PushFile(ctx, containerID, source, dest, opts); err != nil {
+			return err
+		}
+		if rule.Mode != "" {
+			if err := o.client.ExecCommand(ctx, containerID, []string{"chmod", rule.Mode, dest}); err != nil {
+				return fmt.Errorf("failed to set permissions of %s: %w", dest, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/pkg/config"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+	"github.com/brynnjknight/proxer/pkg/state"
+)
+
+func TestSyncFiles(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    build: ./web
+    reload_signal: SIGHUP
+    scale: 2
+    volumes:
+      - ./web/static:/srv/static
+`)
+	baseDir := filepath.Dir(stackPath)
+	dir := filepath.Join(baseDir, "web")
+	writeContextFile(t, dir, "LXCfile.yml", `from: ubuntu:22.04
+setup:
+  - copy:
+      source: src
+      dest: /opt/app
+      owner: app:app
+  - copy:
+      source: app.conf
+      dest: /etc/app/app.conf
+  - copy:
+      source: static
+      dest: /srv/static
+  - copy:
+      source: missing
+      dest: /opt/missing
+  - copy:
+      source: run.sh
+      dest: /usr/local/bin/
+      mode: "0750"
+`)
+	writeContextFile(t, dir, "src/main.py", "print(1)\n")
+	writeContextFile(t, dir, "src/lib/util.py", "x = 1\n")
+	writeContextFile(t, dir, "app.conf", "debug = true\n")
+	writeContextFile(t, dir, "static/index.html", "<html></html>\n")
+	writeContextFile(t, dir, "run.sh", "#!/bin/sh\n")
+
+	stack, err := config.LoadLXCStack(stackPath)
+	if err != nil {
+		t.Fatalf("LoadLXCStack() unexpected error: %v", err)
+	}
+	rules, err := SyncRules(stack, nil)
+	if err != nil {
+		t.Fatalf("SyncRules() unexpected error: %v", err)
+	}
+	want := []SyncRule{
+		{Service: "web", Source: filepath.Join(dir, "src"), Dest: "/opt/app", Owner: "app:app"},
+		{Service: "web", Source: filepath.Join(dir, "app.conf"), Dest: "/etc/app/app.conf"},
+		{Service: "web", Source: filepath.Join(dir, "run.sh"), Dest: "/usr/local/bin/", Mode: "0750"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Fatalf("SyncRules() = %+v, want %+v", rules, want)
+	}
+
+	projectState := &state.ProjectState{Project: "sync", Services: map[string]state.ServiceState{
+		"web":   {ContainerID: 101},
+		"web-2": {ContainerID: 102},
+	}}
+	if err := projectState.Save(state.Path(baseDir, "sync")); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	client := newFakeClient()
+	orchestrator := New(&Config{ProjectName: "sync", BaseDir: baseDir, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	if err := os.Chmod(filepath.Join(dir, "src/main.py"), 0755); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	if err := orchestrator.SyncFiles(context.Background(), stackPath, rules[0], []string{"main.py", "lib/util.py", "old.py"}); err != nil {
+		t.Fatalf("SyncFiles() unexpected error: %v", err)
+	}
+	calls := strings.Join(client.calls, "\n")
+	for _, id := range []int{101, 102} {
+		for _, call := range []string{
+			fmt.Sprintf("exec %d mkdir -p /opt/app\npush %d /opt/app/main.py", id, id),
+			fmt.Sprintf("exec %d mkdir -p /opt/app/lib\npush %d /opt/app/lib/util.py", id, id),
+			fmt.Sprintf("exec %d rm -f /opt/app/old.py", id),
+			fmt.Sprintf("exec %d kill -s HUP 1", id),
+		} {
+			if !strings.Contains(calls, call) {
+				t.Errorf("calls missing %q:\n%s", call, calls)
+			}
+		}
+	}
+	wantPush := pushedFile{"print(1)\n", proxmox.PushOptions{Perms: "755", User: "app", Group: "app"}}
+	if got := client.pushed["102 /opt/app/main.py"]; got != wantPush {
+		t.Errorf("pushed main.py = %+v, want %+v", got, wantPush)
+	}
+
+	// A single file is pushed to its destination
+	client.reset()
+	if err := orchestrator.SyncFiles(context.Background(), stackPath, rules[1], []string{"app.conf"}); err != nil {
+		t.Fatalf("SyncFiles() unexpected error: %v", err)
+	}
+	if got := client.pushed["101 /etc/app/app.conf"]; got.content != "debug = true\n" || got.opts.Perms != "644" {
+		t.Errorf("pushed app.conf = %+v", got)
+	}
+
+	// A file copied to a directory keeps its name and gets the step's mode
+	client.reset()
+	if err := orchestrator.SyncFiles(context.Background(), stackPath, rules[2], []string{"run.sh"}); err != nil {
+		t.Fatalf("SyncFiles() unexpected error: %v", err)
+	}
+	calls = strings.Join(client.calls, "\n")
+	if want := "push 101 /usr/local/bin/run.sh\nexec 101 chmod 0750 /usr/local/bin/run.sh"; !strings.Contains(calls, want) {
+		t.Errorf("calls missing %q:\n%s", want, calls)
+	}
+
+	// Every replica is attempted
+	client.reset()
+	client.fail = map[string]error{"push 101": errors.New("pct push failed")}
+	err = orchestrator.SyncFiles(context.Background(), stackPath, rules[1], []string{"app.conf"})
+	if err == nil || !strings.Contains(err.Error(), "web (container 101)") {
+		t.Errorf("SyncFiles() error = %v, want failure of container 101", err)
+	}
+	if !strings.Contains(strings.Join(client.calls, "\n"), "push 102 /etc/app/app.conf") {
+		t.Errorf("container 102 not synced after container 101 failed:\n%v", client.calls)
+	}
+}
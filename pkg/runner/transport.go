@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// checkTransport rejects services the API transport cannot deploy: the
+// Proxmox VE HTTP API cannot run commands in containers or copy files into
+// them, which builds, health checks and configs and secrets need, and
+// named volumes are directories created on the node
+func (o *Orchestrator) checkTransport(stack *models.LXCStack, order []string) error {
+	if o.api == nil {
+		return nil
+	}
+
+	var problems []string
+	for _, name := range order {
+		service := stack.Services[name]
+		var needs []string
+		if service.Template == "" && service.HasBuild() {
+			needs = append(needs, "a template build")
+		}
+		if o.serviceHealth(name, service) != nil {
+			needs = append(needs, "a health check")
+		}
+		if len(service.Configs) > 0 || len(service.Secrets) > 0 {
+			needs = append(needs, "configs or secrets")
+		}
+		if _, volumes := stack.RequiredResources(service); len(volumes) > 0 {
+			needs = append(needs, "named volumes")
+		}
+		if len(needs) > 0 {
+			problems = append(problems, fmt.Sprintf("%s needs %s", name, strings.Join(needs, " and ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the api transport cannot run commands in containers or create volumes on the node: %s; build templates on the node and use --no-healthcheck, or use transport pct", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+func TestAPITransport(t *testing.T) {
+	api := &proxmox.APIConfig{URL: "https://pve.example.com:8006", TokenID: "pxc@pve!test", TokenSecret: "secret"}
+
+	orchestrator := New(&Config{ProxmoxNode: "pve-2", API: api, Output: &bytes.Buffer{}})
+	if _, ok := orchestrator.client.(*proxmox.APIClient); !ok {
+		t.Fatalf("client = %T, want *proxmox.APIClient", orchestrator.client)
+	}
+
+	stack := &models.LXCStack{Services: map[string]models.Service{
+		"cache":  {Template: "redis:7"},
+		"api":    {Build: "./api"},
+		"web":    {Template: "nginx:latest", Health: &models.HealthCheck{Test: "curl -f localhost"}},
+		"worker": {Template: "node:20", Configs: []string{"app"}},
+		"db":     {Template: "postgres:15", Volumes: []string{"db-data:/var/lib/postgresql/data", "/srv/backups:/backups"}},
+	}, Volumes: map[string]models.Volume{"db-data": {}}}
+
+	tests := []struct {
+		name    string
+		order   []string
+		noCheck []string
+		wantErr []string
+	}{
+		{name: "template services", order: []string{"cache"}},
+		{
+			name:    "services that run commands in containers",
+			order:   []string{"cache", "api", "web", "worker", "db"},
+			wantErr: []string{"api needs a template build", "web needs a health check", "worker needs configs or secrets", "db needs named volumes"},
+		},
+		{name: "disabled health check", order: []string{"web"}, noCheck: []string{"web"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orchestrator := New(&Config{API: api, NoHealthChecks: tt.noCheck, Output: &bytes.Buffer{}})
+			var err error
+			if orchestrator.healthOverrides, err = resolveHealthOverrides(stack, nil, tt.noCheck); err != nil {
+				t.Fatal(err)
+			}
+
+			err = orchestrator.checkTransport(stack, tt.order)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("checkTransport() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("checkTransport() expected error, got nil")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("checkTransport() error = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+
+	// The pct transport runs everything on the node
+	if err := New(&Config{Output: &bytes.Buffer{}}).checkTransport(stack, []string{"api", "web", "worker"}); err != nil {
+		t.Errorf("checkTransport() with pct unexpected error: %v", err)
+	}
+}
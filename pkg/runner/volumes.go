@@ -0,0 +1,258 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/proxmox"
+)
+
+// Volume drivers
+const (
+	volumeLocal = "local"
+	volumeZFS   = "zfs"
+	volumeNFS   = "nfs"
+)
+
+// defaultZFSPool holds the datasets of zfs volumes unless their pool option
+// names another
+const defaultZFSPool = "rpool/data"
+
+// volumeRoot holds the directories of local volumes
+var volumeRoot = "/var/lib/pxc/volumes"
+
+// storageMountRoot is where Proxmox mounts network storages such as NFS
+var storageMountRoot = "/mnt/pve"
+
+// namedVolume is where a named volume lives on the node. Every driver ends
+// up as a host directory bind mounted into containers, so the data outlives
+// the containers using it.
+type namedVolume struct {
+	driver     string
+	path       string            // Host directory mounted into containers
+	dataset    string            // ZFS dataset of a zfs volume
+	properties map[string]string // ZFS properties of a zfs volume
+	owned      bool              // Created by pxc, so removed by pxc down --volumes
+}
+
+// resolveVolume works out where a named volume lives:
+//   - local: a directory under /var/lib/pxc/volumes, or the path option
+//   - zfs: a dataset under the pool option (default rpool/data) mounted at
+//     /POOL/pxc/PROJECT/NAME; the other options are ZFS properties
+//   - nfs: a directory on the Proxmox storage named by the storage option,
+//     or the path option
+//
+// A volume whose path or dataset option is set is the user's and is never
+// removed.
+func resolveVolume(project, name string, volume models.Volume) (namedVolume, error) {
+	driver := volume.Driver
+	if driver == "" {
+		driver = volumeLocal
+	}
+	resolved := namedVolume{driver: driver, path: volume.Options["path"], owned: volume.Options["path"] == ""}
+
+	var allowed []string
+	switch driver {
+	case volumeLocal:
+		allowed = []string{"path"}
+		if resolved.path == "" {
+			resolved.path = filepath.Join(volumeRoot, project, name)
+		}
+	case volumeNFS:
+		allowed = []string{"path", "storage"}
+		if resolved.path == "" {
+			storage := volume.Options["storage"]
+			if storage == "" {
+				return resolved, fmt.Errorf("volume %s: the nfs driver needs a storage or path option", name)
+			}
+			resolved.path = filepath.Join(storageMountRoot, storage, "pxc", project, name)
+		}
+	case volumeZFS:
+		if resolved.path != "" {
+			return resolved, fmt.Errorf("volume %s: the zfs driver takes a pool or dataset option, not path", name)
+		}
+		resolved.dataset = volume.Options["dataset"]
+		resolved.owned = resolved.dataset == ""
+		if resolved.dataset == "" {
+			pool := volume.Options["pool"]
+			if pool == "" {
+				pool = defaultZFSPool
+			}
+			resolved.dataset = strings.Join([]string{strings.Trim(pool, "/"), "pxc", project, name}, "/")
+		}
+		resolved.path = "/" + resolved.dataset
+		resolved.properties = make(map[string]string)
+		for option, value := range volume.Options {
+			if option != "pool" && option != "dataset" {
+				resolved.properties[option] = value
+			}
+		}
+		return resolved, nil
+	default:
+		return resolved, fmt.Errorf("volume %s: unsupported driver %q, use local, zfs or nfs", name, driver)
+	}
+
+	for option := range volume.Options {
+		supported := false
+		for _, candidate := range allowed {
+			supported = supported || option == candidate
+		}
+		if !supported {
+			return resolved, fmt.Errorf("volume %s: the %s driver does not support option %q", name, driver, option)
+		}
+	}
+	if !filepath.IsAbs(resolved.path) {
+		return resolved, fmt.Errorf("volume %s: path %q must be absolute", name, resolved.path)
+	}
+	return resolved, nil
+}
+
+// createVolume creates a named volume on the node unless it exists
+func (o *Orchestrator) createVolume(name string, stack *models.LXCStack) error {
+	volume, err := resolveVolume(o.projectName, name, stack.Volumes[name])
+	if err != nil {
+		return err
+	}
+	if o.api != nil {
+		return fmt.Errorf("volume %s: named volumes need the pct transport, as they are created on the node", name)
+	}
+
+	if o.dryRun {
+		o.log("Creating volume %s at %s", name, volume.path)
+		return nil
+	}
+	o.logDebug("Creating volume %s at %s", name, volume.path)
+
+	if volume.driver == volumeZFS {
+		return o.createDataset(name, volume)
+	}
+
+	if volume.driver == volumeNFS && volume.owned {
+		mount := filepath.Join(storageMountRoot, stack.Volumes[name].Options["storage"])
+		if _, err := os.Stat(mount); err != nil {
+			return fmt.Errorf("volume %s: storage %s is not mounted at %s: %w", name, stack.Volumes[name].Options["storage"], mount, err)
+		}
+	}
+	if _, err := os.Stat(volume.path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(volume.path, 0755); err != nil {
+		return fmt.Errorf("failed to create volume %s: %w", name, err)
+	}
+	o.log("Created volume %s", name)
+	return nil
+}
+
+// createDataset creates the dataset of a zfs volume unless it exists
+func (o *Orchestrator) createDataset(name string, volume namedVolume) error {
+	if err := proxmox.RunCommand(exec.Command("zfs", "list", "-H", "-o", "name", volume.dataset)); err == nil {
+		return nil
+	}
+	if err := proxmox.RunCommand(exec.Command("zfs", zfsCreateArgs(volume)...)); err != nil {
+		return fmt.Errorf("failed to create dataset %s of volume %s: %w", volume.dataset, name, err)
+	}
+	o.log("Created volume %s (dataset %s)", name, volume.dataset)
+	return nil
+}
+
+// zfsCreateArgs returns the zfs arguments creating a volume's dataset,
+// mounted at the volume path and with its properties, sorted by name
+func zfsCreateArgs(volume namedVolume) []string {
+	args := []string{"create", "-p", "-o", "mountpoint=" + volume.path}
+	properties := make([]string, 0, len(volume.properties))
+	for property := range volume.properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+	for _, property := range properties {
+		args = append(args, "-o", property+"="+volume.properties[property])
+	}
+	return append(args, volume.dataset)
+}
+
+// removeVolumes removes the named volumes pxc created, and their data.
+// Volumes set by a path or dataset option are kept.
+func (o *Orchestrator) removeVolumes(stack *models.LXCStack, result *DownResult) {
+	names := make([]string, 0, len(stack.Volumes))
+	for name := range stack.Volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		volume, err := resolveVolume(o.projectName, name, stack.Volumes[name])
+		if err != nil {
+			result.addError("volume "+name, err)
+			continue
+		}
+		if !volume.owned {
+			o.log("Keeping volume %s at %s, which pxc did not create", name, volume.path)
+			continue
+		}
+		if o.dryRun {
+			o.log("DRY RUN: Would remove volume %s at %s", name, volume.path)
+			continue
+		}
+		if err := o.removeVolume(volume); err != nil {
+			o.logWarning("Failed to remove volume %s: %v", name, err)
+			result.addError("volume "+name, err)
+			continue
+		}
+		o.log("Removed volume %s", name)
+		result.VolumesRemoved = append(result.VolumesRemoved, name)
+	}
+}
+
+// removeVolume deletes a volume's dataset or directory; one already gone is
+// not an error
+func (o *Orchestrator) removeVolume(volume namedVolume) error {
+	if o.api != nil {
+		return fmt.Errorf("named volumes need the pct transport, as they are removed on the node")
+	}
+	if volume.driver == volumeZFS {
+		if err := proxmox.RunCommand(exec.Command("zfs", "list", "-H", "-o", "name", volume.dataset)); err != nil {
+			return nil
+		}
+		return proxmox.RunCommand(exec.Command("zfs", "destroy", "-r", volume.dataset))
+	}
+	if _, err := os.Stat(volume.path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return os.RemoveAll(volume.path)
+}
+
+// serviceMountPoints returns the pct mpN values for a service's named
+// volumes and host paths, in the order it lists them. Anonymous volumes are
+// left in the container's root filesystem.
+func (o *Orchestrator) serviceMountPoints(service models.Service, stack *models.LXCStack) map[string]string {
+	mountPoints := make(map[string]string)
+	for _, entry := range service.Volumes {
+		mount := models.ParseVolumeMount(entry)
+		source := mount.Source
+		if source == "" {
+			continue
+		}
+		if definition, named := stack.Volumes[source]; named {
+			volume, err := resolveVolume(o.projectName, source, definition)
+			if err != nil {
+				// Creating the volume fails with this error first
+				continue
+			}
+			source = volume.path
+		}
+
+		value := source + ",mp=" + mount.Target
+		if mount.ReadOnly {
+			value += ",ro=1"
+		}
+		mountPoints[fmt.Sprintf("mp%d", len(mountPoints))] = value
+	}
+	return mountPoints
+}
@@ -0,0 +1,175 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+func TestResolveVolume(t *testing.T) {
+	tests := []struct {
+		name    string
+		volume  models.Volume
+		want    namedVolume
+		wantErr string
+	}{
+		{
+			name:   "local by default",
+			volume: models.Volume{},
+			want:   namedVolume{driver: "local", path: "/var/lib/pxc/volumes/myapp/data", owned: true},
+		},
+		{
+			name:   "local at a path",
+			volume: models.Volume{Driver: "local", Options: map[string]string{"path": "/srv/data"}},
+			want:   namedVolume{driver: "local", path: "/srv/data"},
+		},
+		{
+			name:   "zfs dataset with properties",
+			volume: models.Volume{Driver: "zfs", Options: map[string]string{"pool": "tank", "compression": "lz4"}},
+			want: namedVolume{
+				driver: "zfs", path: "/tank/pxc/myapp/data", dataset: "tank/pxc/myapp/data",
+				properties: map[string]string{"compression": "lz4"}, owned: true,
+			},
+		},
+		{
+			name:   "existing zfs dataset",
+			volume: models.Volume{Driver: "zfs", Options: map[string]string{"dataset": "tank/shared"}},
+			want:   namedVolume{driver: "zfs", path: "/tank/shared", dataset: "tank/shared", properties: map[string]string{}},
+		},
+		{
+			name:   "nfs storage",
+			volume: models.Volume{Driver: "nfs", Options: map[string]string{"storage": "nas"}},
+			want:   namedVolume{driver: "nfs", path: "/mnt/pve/nas/pxc/myapp/data", owned: true},
+		},
+		{name: "nfs without storage", volume: models.Volume{Driver: "nfs"}, wantErr: "needs a storage or path option"},
+		{name: "unknown driver", volume: models.Volume{Driver: "ceph"}, wantErr: `unsupported driver "ceph"`},
+		{name: "unknown option", volume: models.Volume{Options: map[string]string{"type": "tmpfs"}}, wantErr: `does not support option "type"`},
+		{name: "relative path", volume: models.Volume{Options: map[string]string{"path": "data"}}, wantErr: "must be absolute"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveVolume("myapp", "data", tt.volume)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveVolume() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveVolume() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveVolume() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZFSCreateArgs(t *testing.T) {
+	volume := namedVolume{
+		path: "/tank/pxc/myapp/data", dataset: "tank/pxc/myapp/data",
+		properties: map[string]string{"recordsize": "8k", "compression": "lz4"},
+	}
+	want := []string{"create", "-p", "-o", "mountpoint=/tank/pxc/myapp/data", "-o", "compression=lz4", "-o", "recordsize=8k", "tank/pxc/myapp/data"}
+	if got := zfsCreateArgs(volume); !reflect.DeepEqual(got, want) {
+		t.Errorf("zfsCreateArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestServiceMountPoints(t *testing.T) {
+	stack := &models.LXCStack{Volumes: map[string]models.Volume{
+		"db-data": {},
+		"shared":  {Options: map[string]string{"path": "/srv/shared"}},
+	}}
+	service := models.Service{Volumes: []string{
+		"db-data:/var/lib/postgresql/data",
+		"/var/cache/app",
+		"/etc/ssl/certs:/etc/ssl/certs:ro",
+		"shared:/shared",
+	}}
+
+	got := New(&Config{ProjectName: "myapp", Output: &bytes.Buffer{}}).serviceMountPoints(service, stack)
+	want := map[string]string{
+		"mp0": "/var/lib/pxc/volumes/myapp/db-data,mp=/var/lib/postgresql/data",
+		"mp1": "/etc/ssl/certs,mp=/etc/ssl/certs,ro=1",
+		"mp2": "/srv/shared,mp=/shared",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceMountPoints() = %v, want %v", got, want)
+	}
+}
+
+func TestVolumeLifecycle(t *testing.T) {
+	root := t.TempDir()
+	originalRoot := volumeRoot
+	volumeRoot = root
+	defer func() { volumeRoot = originalRoot }()
+
+	external := filepath.Join(t.TempDir(), "shared")
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  database:
+    template: "postgres:15"
+    volumes:
+      - "db-data:/var/lib/postgresql/data"
+      - "shared:/shared"
+volumes:
+  db-data:
+    driver: "local"
+  shared:
+    options:
+      path: "`+external+`"
+`)
+	baseDir := filepath.Dir(stackPath)
+	client := newFakeClient()
+	orchestrator := New(&Config{ProjectName: "vols", BaseDir: baseDir, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+
+	result, err := orchestrator.Up(context.Background(), stackPath)
+	if err != nil {
+		t.Fatalf("Up() unexpected error: %v", err)
+	}
+	dataPath := filepath.Join(root, "vols", "db-data")
+	for _, path := range []string{dataPath, external} {
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			t.Errorf("volume directory %s not created: %v", path, err)
+		}
+	}
+	if len(result.Volumes) != 2 || result.Volumes[0].Status != "created" {
+		t.Errorf("Up() volumes = %+v, want both created", result.Volumes)
+	}
+	if err := os.WriteFile(filepath.Join(dataPath, "PG_VERSION"), []byte("15\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Data survives a teardown that keeps volumes
+	orchestrator = New(&Config{ProjectName: "vols", BaseDir: baseDir, Output: &bytes.Buffer{}})
+	orchestrator.client = client
+	if _, err := orchestrator.Down(context.Background(), stackPath, false); err != nil {
+		t.Fatalf("Down() unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataPath, "PG_VERSION")); err != nil {
+		t.Errorf("volume data removed without --volumes: %v", err)
+	}
+
+	down, err := orchestrator.Down(context.Background(), stackPath, true)
+	if err != nil {
+		t.Fatalf("Down() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(down.VolumesRemoved, []string{"db-data"}) {
+		t.Errorf("VolumesRemoved = %v, want only the volume pxc created", down.VolumesRemoved)
+	}
+	if _, err := os.Stat(dataPath); !os.IsNotExist(err) {
+		t.Errorf("volume directory still exists after down --volumes: %v", err)
+	}
+	if _, err := os.Stat(external); err != nil {
+		t.Errorf("volume at a path option removed: %v", err)
+	}
+}
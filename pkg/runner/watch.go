@@ -0,0 +1,251 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+	"github.com/brynnjknight/proxer/pkg/builder"
+)
+
+// Default timings of a Watcher
+const (
+	DefaultWatchInterval = 500 * time.Millisecond
+	DefaultWatchDebounce = time.Second
+)
+
+// WatchContexts returns the build context of each build-based service among
+// services, or of every build-based service if services is empty
+func WatchContexts(stack *models.LXCStack, services []string) map[string]string {
+	if len(services) == 0 {
+		for name := range stack.Services {
+			services = append(services, name)
+		}
+	}
+
+	contexts := make(map[string]string)
+	for _, name := range services {
+		service, exists := stack.Services[name]
+		if !exists || service.Template != "" {
+			continue
+		}
+		if buildConfig := service.GetBuildConfig(); buildConfig != nil && buildConfig.Context != "" {
+			contexts[name] = buildConfig.Context
+		}
+	}
+	return contexts
+}
+
+// fileStamp is what a snapshot records of a file to notice it changed
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	mode    fs.FileMode
+}
+
+// snapshotContext records every file of a build context that its .pxcignore
+// does not exclude; directories change as their files do. The ignore file is
+// read on every snapshot so edits to it take effect. A single file is
+// recorded under its base name.
+func snapshotContext(context string) (map[string]fileStamp, error) {
+	if info, err := os.Stat(context); err == nil && !info.IsDir() {
+		return map[string]fileStamp{filepath.Base(context): {modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}}, nil
+	}
+
+	ignore, err := builder.LoadIgnore(context)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]fileStamp)
+	err = filepath.WalkDir(context, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files removed while walking are picked up by the next snapshot
+			if errors.Is(err, fs.ErrNotExist) && path != context {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(context, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if ignore.Ignored(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = fileStamp{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan build context %s: %w", context, err)
+	}
+	return files, nil
+}
+
+// changedFiles returns the paths added, removed or modified between two
+// snapshots, sorted
+func changedFiles(previous, current map[string]fileStamp) []string {
+	var changed []string
+	for path, stamp := range current {
+		if old, exists := previous[path]; !exists || !old.modTime.Equal(stamp.modTime) || old.size != stamp.size || old.mode != stamp.mode {
+			changed = append(changed, path)
+		}
+	}
+	for path := range previous {
+		if _, exists := current[path]; !exists {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// WatchChange is a settled change to a service's build context
+type WatchChange struct {
+	Service string
+	Files   []string // Changed paths relative to the context
+}
+
+// pendingChange collects the changes to a context until they settle
+type pendingChange struct {
+	files map[string]bool
+	last  time.Time
+}
+
+// Watcher polls the build contexts of services for changes. Changes are
+// reported once a context has seen none for the debounce period, so saving
+// many files at once, or a file several times, rebuilds a service once.
+type Watcher struct {
+	contexts  map[string]string
+	snapshots map[string]map[string]fileStamp
+	pending   map[string]*pendingChange
+
+	interval time.Duration
+	debounce time.Duration
+
+	// now and sleep are replaced in tests
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewWatcher snapshots the build contexts of services, mapped from service
+// name to context directory, to watch them for changes. Other paths, such
+// as the sources of SyncRules, can be watched under any name, and a path
+// may be a single file.
+func NewWatcher(contexts map[string]string, interval, debounce time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	if debounce < 0 {
+		debounce = 0
+	}
+
+	w := &Watcher{
+		contexts:  contexts,
+		snapshots: make(map[string]map[string]fileStamp, len(contexts)),
+		pending:   make(map[string]*pendingChange),
+		interval:  interval,
+		debounce:  debounce,
+		now:       time.Now,
+		sleep:     time.Sleep,
+	}
+	for service, context := range contexts {
+		if _, err := os.Stat(context); err != nil {
+			return nil, fmt.Errorf("cannot watch build context of service %s: %w", service, err)
+		}
+		snapshot, err := snapshotContext(context)
+		if err != nil {
+			return nil, err
+		}
+		w.snapshots[service] = snapshot
+	}
+	return w, nil
+}
+
+// Poll snapshots every context and returns the changes, in service order,
+// of the services whose context has not changed again for the debounce
+// period
+func (w *Watcher) Poll() ([]WatchChange, error) {
+	now := w.now()
+
+	services := make([]string, 0, len(w.contexts))
+	for service := range w.contexts {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var errs []error
+	var settled []WatchChange
+	for _, service := range services {
+		snapshot, err := snapshotContext(w.contexts[service])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if files := changedFiles(w.snapshots[service], snapshot); len(files) > 0 {
+			pending := w.pending[service]
+			if pending == nil {
+				pending = &pendingChange{files: make(map[string]bool)}
+				w.pending[service] = pending
+			}
+			for _, file := range files {
+				pending.files[file] = true
+			}
+			pending.last = now
+		}
+		w.snapshots[service] = snapshot
+
+		if pending, ok := w.pending[service]; ok && now.Sub(pending.last) >= w.debounce {
+			change := WatchChange{Service: service}
+			for file := range pending.files {
+				change.Files = append(change.Files, file)
+			}
+			sort.Strings(change.Files)
+			settled = append(settled, change)
+			delete(w.pending, service)
+		}
+	}
+	return settled, errors.Join(errs...)
+}
+
+// Run polls the contexts until stop is closed, passing every settled change
+// to onChange and every failed poll to onError. onChange runs on the
+// polling goroutine, so changes made while it runs are reported after it.
+func (w *Watcher) Run(stop <-chan struct{}, onChange func(WatchChange), onError func(error)) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		changes, err := w.Poll()
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		for _, change := range changes {
+			onChange(change)
+		}
+		w.sleep(w.interval)
+	}
+}
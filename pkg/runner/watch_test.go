@@ -0,0 +1,299 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brynnjknight/proxer/internal/models"
+)
+
+// writeContextFile writes a file in a build context, creating directories
+func writeContextFile(t *testing.T, context, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(context, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+// newTestWatcher watches contexts with a clock the test advances
+func newTestWatcher(t *testing.T, contexts map[string]string, debounce time.Duration) (*Watcher, *time.Time) {
+	t.Helper()
+
+	watcher, err := NewWatcher(contexts, time.Millisecond, debounce)
+	if err != nil {
+		t.Fatalf("NewWatcher() unexpected error: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	watcher.now = func() time.Time { return now }
+	return watcher, &now
+}
+
+// poll polls the watcher at the given offset from its start
+func poll(t *testing.T, watcher *Watcher, clock *time.Time, start time.Time, offset time.Duration) []WatchChange {
+	t.Helper()
+
+	*clock = start.Add(offset)
+	changes, err := watcher.Poll()
+	if err != nil {
+		t.Fatalf("Poll() unexpected error: %v", err)
+	}
+	return changes
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	context := t.TempDir()
+	writeContextFile(t, context, "LXCfile.yml", "from: ubuntu:22.04\n")
+	writeContextFile(t, context, "src/app.js", "console.log(1)\n")
+
+	watcher, clock := newTestWatcher(t, map[string]string{"web": context}, time.Second)
+	start := *clock
+
+	if changes := poll(t, watcher, clock, start, 0); len(changes) != 0 {
+		t.Fatalf("Poll() without changes = %v, want none", changes)
+	}
+
+	// A burst of edits is reported once, after the last one has settled
+	writeContextFile(t, context, "src/app.js", "console.log(2) // edited\n")
+	if changes := poll(t, watcher, clock, start, 100*time.Millisecond); len(changes) != 0 {
+		t.Fatalf("Poll() right after a change = %v, want none until it settles", changes)
+	}
+	writeContextFile(t, context, "src/util.js", "export {}\n")
+	if changes := poll(t, watcher, clock, start, 800*time.Millisecond); len(changes) != 0 {
+		t.Fatalf("Poll() during a burst = %v, want none", changes)
+	}
+	if changes := poll(t, watcher, clock, start, 1500*time.Millisecond); len(changes) != 0 {
+		t.Fatalf("Poll() 700ms after the last change = %v, want none", changes)
+	}
+
+	changes := poll(t, watcher, clock, start, 1800*time.Millisecond)
+	want := []WatchChange{{Service: "web", Files: []string{"src/app.js", "src/util.js"}}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("Poll() after settling = %v, want %v", changes, want)
+	}
+
+	// The change is reported only once
+	if changes := poll(t, watcher, clock, start, 5*time.Second); len(changes) != 0 {
+		t.Errorf("Poll() after reporting = %v, want none", changes)
+	}
+
+	// Removed files are changes too
+	if err := os.Remove(filepath.Join(context, "src/util.js")); err != nil {
+		t.Fatal(err)
+	}
+	poll(t, watcher, clock, start, 6*time.Second)
+	changes = poll(t, watcher, clock, start, 7*time.Second)
+	want = []WatchChange{{Service: "web", Files: []string{"src/util.js"}}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Poll() after removing a file = %v, want %v", changes, want)
+	}
+}
+
+func TestWatcherIgnore(t *testing.T) {
+	context := t.TempDir()
+	writeContextFile(t, context, "LXCfile.yml", "from: ubuntu:22.04\n")
+	writeContextFile(t, context, ".pxcignore", "# dependencies and logs\nnode_modules/\n*.log\n")
+	writeContextFile(t, context, "node_modules/lib/index.js", "module.exports = 1\n")
+
+	watcher, clock := newTestWatcher(t, map[string]string{"web": context}, 0)
+	start := *clock
+
+	writeContextFile(t, context, "node_modules/lib/index.js", "module.exports = 2 // updated\n")
+	writeContextFile(t, context, "node_modules/other.js", "new\n")
+	writeContextFile(t, context, "logs/debug.log", "request\n")
+	if changes := poll(t, watcher, clock, start, time.Second); len(changes) != 0 {
+		t.Fatalf("Poll() after changing ignored files = %v, want none", changes)
+	}
+
+	writeContextFile(t, context, "LXCfile.yml", "from: debian:12\n")
+	changes := poll(t, watcher, clock, start, 2*time.Second)
+	want := []WatchChange{{Service: "web", Files: []string{"LXCfile.yml"}}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Poll() after changing the LXCfile = %v, want %v", changes, want)
+	}
+}
+
+func TestWatcherTargetsAffectedService(t *testing.T) {
+	root := t.TempDir()
+	contexts := map[string]string{
+		"web":    filepath.Join(root, "web"),
+		"api":    filepath.Join(root, "api"),
+		"worker": filepath.Join(root, "api"), // Shares api's context
+	}
+	writeContextFile(t, contexts["web"], "LXCfile.yml", "from: nginx\n")
+	writeContextFile(t, contexts["api"], "LXCfile.yml", "from: node\n")
+
+	watcher, clock := newTestWatcher(t, contexts, 0)
+	start := *clock
+
+	writeContextFile(t, contexts["web"], "index.html", "<h1>hi</h1>\n")
+	changes := poll(t, watcher, clock, start, time.Second)
+	want := []WatchChange{{Service: "web", Files: []string{"index.html"}}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("Poll() after changing web = %v, want %v", changes, want)
+	}
+
+	writeContextFile(t, contexts["api"], "server.js", "listen()\n")
+	changes = poll(t, watcher, clock, start, 2*time.Second)
+	want = []WatchChange{
+		{Service: "api", Files: []string{"server.js"}},
+		{Service: "worker", Files: []string{"server.js"}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Poll() after changing the shared context = %v, want %v", changes, want)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	context := t.TempDir()
+	writeContextFile(t, context, "LXCfile.yml", "from: ubuntu:22.04\n")
+
+	watcher, err := NewWatcher(map[string]string{"web": context}, time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("NewWatcher() unexpected error: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var once sync.Once
+	polls := 0
+	watcher.sleep = func(time.Duration) {
+		polls++
+		if polls == 1 {
+			writeContextFile(t, context, "app.py", "print('hi')\n")
+		}
+	}
+
+	var changes []WatchChange
+	watcher.Run(stop, func(change WatchChange) {
+		changes = append(changes, change)
+		once.Do(func() { close(stop) })
+	}, func(err error) {
+		t.Errorf("Run() unexpected error: %v", err)
+	})
+
+	want := []WatchChange{{Service: "web", Files: []string{"app.py"}}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Run() reported %v, want %v", changes, want)
+	}
+}
+
+func TestNewWatcherMissingContext(t *testing.T) {
+	_, err := NewWatcher(map[string]string{"web": filepath.Join(t.TempDir(), "missing")}, 0, 0)
+	if err == nil || !strings.Contains(err.Error(), "service web") {
+		t.Errorf("NewWatcher() error = %v, want missing context of service web", err)
+	}
+}
+
+func TestWatchContexts(t *testing.T) {
+	stack := &models.LXCStack{Services: map[string]models.Service{
+		"web":      {Build: "/src/web"},
+		"api":      {Build: map[string]interface{}{"context": "/src/api"}},
+		"database": {Template: "postgres:15"},
+	}}
+
+	tests := []struct {
+		name     string
+		services []string
+		want     map[string]string
+	}{
+		{
+			name: "all build services",
+			want: map[string]string{"web": "/src/web", "api": "/src/api"},
+		},
+		{
+			name:     "selected services",
+			services: []string{"api", "database"},
+			want:     map[string]string{"api": "/src/api"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WatchContexts(stack, tt.services); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WatchContexts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpRecreate(t *testing.T) {
+	stackPath := writeStack(t, `version: "1.0"
+services:
+  web:
+    build: ./web
+  api:
+    build: ./api
+`)
+	baseDir := filepath.Dir(stackPath)
+	for _, name := range []string{"web", "api"} {
+		writeContextFile(t, filepath.Join(baseDir, name), "LXCfile.yml", "from: ubuntu:22.04\n")
+	}
+
+	// Services build concurrently; templates are named after the run
+	client := newFakeClient()
+	var mu sync.Mutex
+	var built []string
+	run := 0
+	up := func(config *Config) *DeploymentResult {
+		t.Helper()
+
+		run++
+		config.ProjectName = "watch"
+		config.BaseDir = baseDir
+		config.Output = &bytes.Buffer{}
+		orchestrator := New(config)
+		orchestrator.client = client
+		template := run
+		orchestrator.build = func(_ context.Context, serviceName string, buildConfig *models.BuildConfig) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			built = append(built, serviceName)
+			return fmt.Sprintf("tpl-%s-%d", serviceName, template), nil
+		}
+		client.reset()
+		result, err := orchestrator.Up(context.Background(), stackPath)
+		if err != nil {
+			t.Fatalf("Up() unexpected error: %v", err)
+		}
+		return result
+	}
+
+	first := up(&Config{})
+	ids := make(map[string]int)
+	for _, service := range first.Services {
+		ids[service.Name] = service.ContainerID
+	}
+
+	// An unchanged definition is left alone unless it is to be recreated
+	built = nil
+	result := up(&Config{Services: []string{"web"}, NoDeps: true, Recreate: []string{"web"}})
+
+	if !reflect.DeepEqual(built, []string{"web"}) {
+		t.Errorf("built %v, want only web", built)
+	}
+	if len(result.Services) != 1 || result.Services[0].Name != "web" {
+		t.Fatalf("Up() deployed %v, want only web", result.Services)
+	}
+	calls := strings.Join(client.calls, "\n")
+	if !strings.Contains(calls, fmt.Sprintf("destroy %d", ids["web"])) {
+		t.Errorf("old web container %d was not removed:\n%s", ids["web"], calls)
+	}
+	if !strings.Contains(calls, "tpl-web-2") {
+		t.Errorf("web was not recreated from its rebuilt template:\n%s", calls)
+	}
+	if strings.Contains(calls, fmt.Sprintf(" %d", ids["api"])) {
+		t.Errorf("api container %d was touched:\n%s", ids["api"], calls)
+	}
+}
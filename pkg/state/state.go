@@ -0,0 +1,107 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ProjectState records what pxc deployed for a project
+type ProjectState struct {
+	Project  string                  `json:"project"`
+	Services map[string]ServiceState `json:"services"`
+
+	// Ports published on the node for each service state key, as ports
+	// entries with the replica's host ports, e.g. 8081:80/tcp
+	Ports map[string][]string `json:"ports,omitempty"`
+
+	// Development is set when the project was deployed with its development
+	// overrides, so later commands load the stack with them
+	Development bool `json:"development,omitempty"`
+}
+
+// ServiceState records the deployed container and definition of a service
+type ServiceState struct {
+	ContainerID int       `json:"container_id"`
+	Digest      string    `json:"digest"`                 // Hash of the service definition
+	FilesDigest string    `json:"files_digest,omitempty"` // Hash of config and secret file contents
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Node is the cluster node the container was placed on with the
+	// service's node setting; empty for the stack's node
+	Node string `json:"node,omitempty"`
+
+	// Stopped is set while the container is stopped by 'pxc stop', so
+	// unless-stopped restart policies leave it down
+	Stopped bool `json:"stopped,omitempty"`
+}
+
+// Path returns the state file location for a project in a stack directory
+func Path(baseDir, project string) string {
+	return filepath.Join(baseDir, ".pxc", project+".state.json")
+}
+
+// Load reads project state, returning empty state if the file does not exist
+func Load(path, project string) (*ProjectState, error) {
+	st := &ProjectState{
+		Project:  project,
+		Services: make(map[string]ServiceState),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	if st.Services == nil {
+		st.Services = make(map[string]ServiceState)
+	}
+
+	return st, nil
+}
+
+// Clone returns a copy of the state that can be changed independently
+func (s *ProjectState) Clone() *ProjectState {
+	clone := &ProjectState{Project: s.Project, Services: make(map[string]ServiceState, len(s.Services))}
+	for key, service := range s.Services {
+		clone.Services[key] = service
+	}
+	if s.Ports != nil {
+		clone.Ports = make(map[string][]string, len(s.Ports))
+		for key, ports := range s.Ports {
+			clone.Ports[key] = append([]string(nil), ports...)
+		}
+	}
+	return clone
+}
+
+// Save writes project state, creating the state directory if needed
+func (s *ProjectState) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	// Write atomically so an interrupted save never leaves a truncated file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadMissingFile(t *testing.T) {
+	st, err := Load(filepath.Join(t.TempDir(), "missing.json"), "myapp")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if st.Project != "myapp" {
+		t.Errorf("Project = %q, want %q", st.Project, "myapp")
+	}
+	if len(st.Services) != 0 {
+		t.Errorf("Expected no services, got %v", st.Services)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := Path(t.TempDir(), "myapp")
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	st := &ProjectState{
+		Project: "myapp",
+		Services: map[string]ServiceState{
+			"web": {ContainerID: 301, Digest: "abc", FilesDigest: "def", UpdatedAt: updated},
+		},
+	}
+	if err := st.Save(path); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+
+	loaded, err := Load(path, "myapp")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+
+	web, exists := loaded.Services["web"]
+	if !exists {
+		t.Fatalf("Expected web service in state, got %v", loaded.Services)
+	}
+	if web.ContainerID != 301 || web.Digest != "abc" || web.FilesDigest != "def" || !web.UpdatedAt.Equal(updated) {
+		t.Errorf("Loaded service state = %+v", web)
+	}
+}
+
+func TestLoadInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	if _, err := Load(path, "myapp"); err == nil {
+		t.Error("Load() expected error for invalid JSON, got nil")
+	}
+}
@@ -0,0 +1,141 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultDetachKeys is the key sequence that detaches from an interactive session
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// ErrDetached is returned by a DetachReader once the detach sequence is read
+var ErrDetached = errors.New("detached from session")
+
+// ParseDetachKeys converts a comma-separated key sequence such as
+// "ctrl-p,ctrl-q" into the bytes a terminal sends for it. Each key is either
+// a single character or ctrl- followed by a letter or one of @ [ \ ] ^ _.
+func ParseDetachKeys(spec string) ([]byte, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("detach keys cannot be empty")
+	}
+
+	var keys []byte
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+
+		if ctrl, found := strings.CutPrefix(strings.ToLower(key), "ctrl-"); found {
+			if len(ctrl) != 1 {
+				return nil, fmt.Errorf("invalid detach key '%s'", key)
+			}
+			c := ctrl[0]
+			switch {
+			case c >= 'a' && c <= 'z':
+				keys = append(keys, c-'a'+1)
+			case c == '@':
+				keys = append(keys, 0)
+			case c >= '[' && c <= '_':
+				keys = append(keys, c-'['+27)
+			default:
+				return nil, fmt.Errorf("invalid detach key '%s'", key)
+			}
+			continue
+		}
+
+		if len(key) != 1 {
+			return nil, fmt.Errorf("invalid detach key '%s'", key)
+		}
+		keys = append(keys, key[0])
+	}
+
+	return keys, nil
+}
+
+// DetachReader forwards input from a terminal until the detach sequence is
+// typed. Bytes that start the sequence are held back until it is either
+// completed, which ends the session with ErrDetached, or broken, in which
+// case they are forwarded as normal input.
+type DetachReader struct {
+	r        io.Reader
+	keys     []byte
+	matched  int
+	detached bool
+	pending  []byte
+	err      error
+	buf      []byte
+}
+
+// NewDetachReader wraps r to watch for the given detach key sequence
+func NewDetachReader(r io.Reader, keys []byte) *DetachReader {
+	return &DetachReader{r: r, keys: keys}
+}
+
+// Detached reports whether the detach sequence has been read
+func (d *DetachReader) Detached() bool {
+	return d.detached
+}
+
+// Read implements io.Reader
+func (d *DetachReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for len(d.pending) == 0 {
+		if d.detached {
+			return 0, ErrDetached
+		}
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		if cap(d.buf) < len(p) {
+			d.buf = make([]byte, len(p))
+		}
+		n, err := d.r.Read(d.buf[:len(p)])
+		d.pending = d.feed(d.buf[:n])
+		d.err = err
+
+		// Input ended mid-sequence: the held-back keys were ordinary input
+		if err != nil && !d.detached {
+			d.pending = append(d.pending, d.keys[:d.matched]...)
+			d.matched = 0
+		}
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// feed runs input through the detach state machine and returns the bytes to
+// forward. It stops consuming as soon as the full sequence is matched.
+func (d *DetachReader) feed(input []byte) []byte {
+	var out []byte
+	for _, b := range input {
+		if len(d.keys) == 0 {
+			out = append(out, b)
+			continue
+		}
+
+		if b == d.keys[d.matched] {
+			d.matched++
+			if d.matched == len(d.keys) {
+				d.detached = true
+				return out
+			}
+			continue
+		}
+
+		// Sequence broken: release the held-back prefix
+		out = append(out, d.keys[:d.matched]...)
+		d.matched = 0
+		if b == d.keys[0] {
+			d.matched = 1
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
@@ -0,0 +1,158 @@
+package terminal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected []byte
+		wantErr  bool
+	}{
+		{name: "default", spec: DefaultDetachKeys, expected: []byte{0x10, 0x11}},
+		{name: "single ctrl key", spec: "ctrl-a", expected: []byte{0x01}},
+		{name: "uppercase and spaces", spec: "CTRL-X, q", expected: []byte{0x18, 'q'}},
+		{name: "ctrl symbols", spec: "ctrl-@,ctrl-[,ctrl-_", expected: []byte{0x00, 0x1b, 0x1f}},
+		{name: "empty", spec: "", wantErr: true},
+		{name: "multi-character key", spec: "ctrl-p,ab", wantErr: true},
+		{name: "invalid ctrl key", spec: "ctrl-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseDetachKeys(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseDetachKeys(%q) expected error, got %v", tt.spec, keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDetachKeys(%q) unexpected error: %v", tt.spec, err)
+			}
+			if !bytes.Equal(keys, tt.expected) {
+				t.Errorf("ParseDetachKeys(%q) = %v, want %v", tt.spec, keys, tt.expected)
+			}
+		})
+	}
+}
+
+// chunkReader returns one chunk per Read call
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.chunks[0])
+	c.chunks = c.chunks[1:]
+	return n, nil
+}
+
+func TestDetachReader(t *testing.T) {
+	keys := []byte{0x10, 0x11} // ctrl-p, ctrl-q
+
+	tests := []struct {
+		name      string
+		chunks    [][]byte
+		forwarded string
+		detached  bool
+	}{
+		{
+			name:      "plain input is forwarded",
+			chunks:    [][]byte{[]byte("ls -la\r")},
+			forwarded: "ls -la\r",
+		},
+		{
+			name:      "sequence detaches after earlier input",
+			chunks:    [][]byte{[]byte("top\r\x10\x11ignored")},
+			forwarded: "top\r",
+			detached:  true,
+		},
+		{
+			name:      "sequence split across reads",
+			chunks:    [][]byte{[]byte("a\x10"), []byte("\x11b")},
+			forwarded: "a",
+			detached:  true,
+		},
+		{
+			name:      "broken sequence is forwarded",
+			chunks:    [][]byte{[]byte("\x10x\x10\x10\x11")},
+			forwarded: "\x10x\x10",
+			detached:  true,
+		},
+		{
+			name:      "partial sequence at end of input is forwarded",
+			chunks:    [][]byte{[]byte("vi\x10")},
+			forwarded: "vi\x10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewDetachReader(&chunkReader{chunks: tt.chunks}, keys)
+
+			forwarded, err := io.ReadAll(reader)
+			if tt.detached {
+				if !errors.Is(err, ErrDetached) {
+					t.Errorf("ReadAll() error = %v, want ErrDetached", err)
+				}
+			} else if err != nil {
+				t.Errorf("ReadAll() unexpected error: %v", err)
+			}
+
+			if string(forwarded) != tt.forwarded {
+				t.Errorf("forwarded = %q, want %q", forwarded, tt.forwarded)
+			}
+			if reader.Detached() != tt.detached {
+				t.Errorf("Detached() = %v, want %v", reader.Detached(), tt.detached)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	keys := []byte{0x10, 0x11}
+
+	t.Run("command exits at end of input", func(t *testing.T) {
+		var out bytes.Buffer
+		cmd := exec.Command("cat")
+		cmd.Stdout = &out
+
+		detached, err := Run(cmd, bytes.NewReader([]byte("hello")), keys)
+		if err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		if detached {
+			t.Error("Run() detached, want command to exit")
+		}
+		if out.String() != "hello" {
+			t.Errorf("output = %q, want %q", out.String(), "hello")
+		}
+	})
+
+	t.Run("detach keys stop the session", func(t *testing.T) {
+		cmd := exec.Command("sleep", "30")
+
+		start := time.Now()
+		detached, err := Run(cmd, bytes.NewReader(keys), keys)
+		if err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		if !detached {
+			t.Error("Run() did not detach")
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Error("Run() waited for the command instead of detaching")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+//go:build linux
+
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// RunPTY starts cmd on a new pseudo-terminal relayed to the terminal in and
+// out until the command exits or the detach keys are typed. Unlike Run, the
+// command sees a terminal, so pct exec gives the process in the container
+// one too. Detaching leaves the command running: the pseudo-terminal is
+// handed to a holder process that discards further output, so the command
+// gets no hangup, and the holder ends when the command does. The caller puts
+// the terminal in raw mode.
+func RunPTY(cmd *exec.Cmd, in *os.File, out io.Writer, keys []byte) (bool, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return false, err
+	}
+	defer master.Close()
+
+	resize := func() {
+		if size, err := unix.IoctlGetWinsize(int(in.Fd()), unix.TIOCGWINSZ); err == nil {
+			_ = unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, size)
+		}
+	}
+	resize()
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	go func() {
+		for range winch {
+			resize()
+		}
+	}()
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	err = cmd.Start()
+	slave.Close()
+	if err != nil {
+		return false, fmt.Errorf("failed to start %s: %w", cmd.Path, err)
+	}
+
+	// Reading the master fails once the command and its children closed
+	// the terminal, after all their output was read
+	output := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(out, master)
+		close(output)
+	}()
+
+	detached := make(chan struct{})
+	go func() {
+		_, err := io.Copy(master, NewDetachReader(in, keys))
+		if errors.Is(err, ErrDetached) {
+			close(detached)
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		<-output
+		return false, err
+	case <-detached:
+		return true, holdPTY(master)
+	}
+}
+
+// holdPTY keeps a pseudo-terminal open after pxc exits by passing it to a
+// cat in a session of its own, which reads the command's output until the
+// command closes its end
+var holdPTY = func(master *os.File) error {
+	holder := exec.Command("cat")
+	holder.Stdin = master
+	holder.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := holder.Start(); err != nil {
+		return fmt.Errorf("failed to keep the session open: %w", err)
+	}
+	return holder.Process.Release()
+}
+
+// openPTY opens a new pseudo-terminal pair
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open a pseudo-terminal: %w", err)
+	}
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to unlock the pseudo-terminal: %w", err)
+	}
+	number, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to find the pseudo-terminal: %w", err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", number), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to open the pseudo-terminal: %w", err)
+	}
+	return master, slave, nil
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package terminal
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunPTY(t *testing.T) {
+	keys := []byte{0x10, 0x11}
+
+	t.Run("command runs on a terminal", func(t *testing.T) {
+		in, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Pipe() unexpected error: %v", err)
+		}
+		defer in.Close()
+		defer w.Close()
+
+		var out bytes.Buffer
+		cmd := exec.Command("sh", "-c", "test -t 0 && test -t 1 && echo terminal")
+		detached, err := RunPTY(cmd, in, &out, keys)
+		if err != nil {
+			t.Fatalf("RunPTY() unexpected error: %v", err)
+		}
+		if detached {
+			t.Error("RunPTY() detached, want command to exit")
+		}
+		if strings.TrimSpace(out.String()) != "terminal" {
+			t.Errorf("output = %q, want the command to see a terminal", out.String())
+		}
+	})
+
+	t.Run("detach keys leave the command running", func(t *testing.T) {
+		in, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Pipe() unexpected error: %v", err)
+		}
+		defer in.Close()
+		defer w.Close()
+		if _, err := w.Write(keys); err != nil {
+			t.Fatalf("Write() unexpected error: %v", err)
+		}
+
+		start := time.Now()
+		cmd := exec.Command("sleep", "30")
+		detached, err := RunPTY(cmd, in, &bytes.Buffer{}, keys)
+		if err != nil {
+			t.Fatalf("RunPTY() unexpected error: %v", err)
+		}
+		defer cmd.Process.Kill()
+		if !detached {
+			t.Error("RunPTY() did not detach")
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Error("RunPTY() waited for the command instead of detaching")
+		}
+
+		// The command outlives the session, as its terminal is still open
+		time.Sleep(100 * time.Millisecond)
+		if err := cmd.Process.Signal(syscall.Signal(0)); err != nil {
+			t.Errorf("command ended after detaching: %v", err)
+		}
+	})
+}
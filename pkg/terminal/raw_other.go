@@ -0,0 +1,25 @@
+//go:build !linux
+
+package terminal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// MakeRaw is only supported on Linux, where Proxmox VE runs
+func MakeRaw(fd int) (func() error, error) {
+	return nil, fmt.Errorf("raw terminal mode is not supported on this platform")
+}
+
+// IsTerminal reports whether fd refers to a terminal
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// RunPTY is only supported on Linux, where Proxmox VE runs
+func RunPTY(cmd *exec.Cmd, in *os.File, out io.Writer, keys []byte) (bool, error) {
+	return false, fmt.Errorf("pseudo-terminals are not supported on this platform")
+}
@@ -0,0 +1,47 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Run starts cmd with its stdin fed from in until the command exits or the
+// detach keys are typed. Detaching stops only the local command (e.g. pct
+// console); whatever runs in the container keeps running. The caller wires
+// cmd's stdout and stderr and puts the terminal in raw mode if needed.
+func Run(cmd *exec.Cmd, in io.Reader, keys []byte) (bool, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return false, fmt.Errorf("failed to open stdin: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return false, fmt.Errorf("failed to start %s: %w", cmd.Path, err)
+	}
+
+	detached := make(chan struct{})
+	go func() {
+		_, err := io.Copy(stdin, NewDetachReader(in, keys))
+		if errors.Is(err, ErrDetached) {
+			close(detached)
+			return
+		}
+		stdin.Close()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return false, err
+	case <-detached:
+		_ = cmd.Process.Kill()
+		<-done
+		return true, nil
+	}
+}